@@ -3,6 +3,7 @@ package auth
 import (
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
 	"github.com/golang-jwt/jwt/v4"
+	"strconv"
 	"time"
 )
 
@@ -11,7 +12,7 @@ var jwtKey = Env.GetString("JWT_KEY", "") // Replace with an environment variabl
 // GenerateJWT generates a new JWT token for a user.
 func GenerateJWT(userID int) (string, error) {
 	claims := &jwt.RegisteredClaims{
-		Subject:   string(userID),
+		Subject:   strconv.Itoa(userID),
 		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24-hour expiration
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
 	}
@@ -3,19 +3,49 @@ package Database
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	"log"
+	_ "modernc.org/sqlite"
 	"time"
 )
 
-func DBConnection(addr string) (*sql.DB, error) {
+// DB wraps *sql.DB with the dialect of the connected database.
+// Its query methods rebind "?" placeholders, so services write one query for every driver.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Tx is a transaction that rebinds placeholders like DB
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+// DBConnection opens and pings a database with the given driver ("mysql", "postgres" or "sqlite")
+func DBConnection(driver, addr string) (*DB, error) {
+
+	dialect, err := NewDialect(driver)
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("mysql", addr)
+	db, err := sql.Open(driver, addr)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if driver == "sqlite" {
+		// SQLite allows a single writer; one connection also keeps ":memory:" databases shared
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+			return nil, fmt.Errorf("could not enable foreign keys: %w", err)
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 
 	defer cancel()
@@ -24,6 +54,70 @@ func DBConnection(addr string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	log.Print("DB Connected \n")
-	return db, nil
+	log.Printf("DB Connected (%s) \n", driver)
+	return &DB{DB: db, Dialect: dialect}, nil
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+// InsertID runs an INSERT and returns the generated value of idColumn.
+// PostgreSQL has no LastInsertId, so the query gets a RETURNING clause there.
+func (db *DB) InsertID(ctx context.Context, query string, idColumn string, args ...interface{}) (int64, error) {
+	if db.Dialect.Name() == "postgres" {
+		var id int64
+		err := db.QueryRowContext(ctx, query+" RETURNING "+idColumn, args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// BeginTx starts a transaction that rebinds placeholders
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: db.Dialect}, nil
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.Dialect.Rebind(query), args...)
+}
+
+// InsertID is DB.InsertID inside the transaction
+func (tx *Tx) InsertID(ctx context.Context, query string, idColumn string, args ...interface{}) (int64, error) {
+	if tx.Dialect.Name() == "postgres" {
+		var id int64
+		err := tx.QueryRowContext(ctx, query+" RETURNING "+idColumn, args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
 }
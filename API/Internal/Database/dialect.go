@@ -0,0 +1,323 @@
+package Database
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	geo "github.com/paulmach/go.geo"
+	"math"
+	"modernc.org/sqlite"
+	"strconv"
+	"strings"
+)
+
+// Dialect hides the SQL differences between the supported databases.
+// Queries are written with "?" placeholders and MySQL-style column types,
+// and the dialect supplies the spatial expressions around them.
+type Dialect interface {
+	// Name is the dialect name used for driver selection and migration directories
+	Name() string
+
+	// Rebind rewrites "?" placeholders into the driver's placeholder style
+	Rebind(query string) string
+
+	// Point selects a point column so that go.geo's Point.Scan can read it
+	Point(column string) string
+
+	// PointValue is the placeholder expression for a point written with PointArg
+	PointValue() string
+
+	// PointArg converts a point into the argument bound to PointValue
+	PointArg(p *geo.Point) interface{}
+
+	// Distance returns an expression giving the distance in metres between column
+	// and a PointValue placeholder. ok is false when the database cannot compute it,
+	// in which case callers filter by distance in Go.
+	Distance(column string) (expr string, ok bool)
+
+	// X and Y select the longitude and latitude of a point column
+	X(column string) string
+	Y(column string) string
+
+	// Within returns a condition that holds when column lies inside the box bound as
+	// min longitude, min latitude, max longitude, max latitude placeholders
+	Within(column string) string
+
+	// Polygon selects a polygon column as WKB, the format ParsePolygonWKB reads
+	Polygon(column string) string
+
+	// PolygonValue is the placeholder expression for a polygon bound as PolygonWKB
+	PolygonValue() string
+
+	// Contains returns a condition that holds when the polygon column contains a
+	// PointValue placeholder. ok is false when the database cannot evaluate it,
+	// in which case callers test the polygons in Go.
+	Contains(column string) (expr string, ok bool)
+
+	// Like is the case-insensitive pattern matching operator
+	Like() string
+
+	// Timestamp formats a timestamp column as "2006-01-02 15:04:05"
+	Timestamp(column string) string
+
+	// Date formats a date column as "2006-01-02"
+	Date(column string) string
+
+	// Age returns the number of seconds elapsed since a timestamp column, measured by
+	// the database clock that wrote it so retention windows ignore the server's time zone
+	Age(column string) string
+
+	// FromNow is a timestamp expression for the current time plus a number of seconds
+	// bound as its placeholder, the counterpart of Age for writing future timestamps
+	FromNow() string
+
+	// IgnoreConflict ends an INSERT so that a row clashing with the unique key made of
+	// columns is skipped instead of failing
+	IgnoreConflict(columns ...string) string
+}
+
+// NewDialect returns the dialect for a driver name
+func NewDialect(driver string) (Dialect, error) {
+	switch driver {
+	case "mysql":
+		return MySQL{}, nil
+	case "postgres":
+		return Postgres{}, nil
+	case "sqlite":
+		return SQLite{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// MySQL is the dialect for MySQL 8 spatial types
+type MySQL struct{}
+
+func (MySQL) Name() string                      { return "mysql" }
+func (MySQL) Rebind(query string) string        { return query }
+func (MySQL) Point(column string) string        { return column }
+func (MySQL) PointValue() string                { return "ST_GeomFromText(?)" }
+func (MySQL) PointArg(p *geo.Point) interface{} { return p.ToWKT() }
+func (MySQL) Like() string                      { return "LIKE" }
+func (MySQL) Timestamp(column string) string    { return column }
+func (MySQL) Date(column string) string         { return column }
+
+func (MySQL) Age(column string) string {
+	return "TIMESTAMPDIFF(SECOND, " + column + ", CURRENT_TIMESTAMP)"
+}
+
+func (MySQL) FromNow() string { return "TIMESTAMPADD(SECOND, ?, CURRENT_TIMESTAMP)" }
+
+// INSERT IGNORE would hide other errors too, so the clash updates a key column to itself
+func (MySQL) IgnoreConflict(columns ...string) string {
+	return "ON DUPLICATE KEY UPDATE " + columns[0] + " = " + columns[0]
+}
+
+func (MySQL) Distance(column string) (string, bool) {
+	return "ST_Distance_Sphere(" + column + ", ST_GeomFromText(?))", true
+}
+
+func (MySQL) X(column string) string { return "ST_X(" + column + ")" }
+func (MySQL) Y(column string) string { return "ST_Y(" + column + ")" }
+
+func (MySQL) Within(column string) string {
+	return "MBRCovers(ST_MakeEnvelope(POINT(?, ?), POINT(?, ?)), " + column + ")"
+}
+
+func (MySQL) Polygon(column string) string { return "ST_AsBinary(" + column + ")" }
+func (MySQL) PolygonValue() string         { return "ST_GeomFromWKB(?)" }
+
+func (MySQL) Contains(column string) (string, bool) {
+	return "ST_Contains(" + column + ", ST_GeomFromText(?))", true
+}
+
+// Postgres is the dialect for PostgreSQL with the PostGIS extension
+type Postgres struct{}
+
+func (Postgres) Name() string                      { return "postgres" }
+func (Postgres) Point(column string) string        { return "ST_AsBinary(" + column + ")" }
+func (Postgres) PointValue() string                { return "ST_GeomFromText(?, 4326)" }
+func (Postgres) PointArg(p *geo.Point) interface{} { return p.ToWKT() }
+func (Postgres) Like() string                      { return "ILIKE" }
+
+func (Postgres) Timestamp(column string) string {
+	return "to_char(" + column + ", 'YYYY-MM-DD HH24:MI:SS')"
+}
+
+func (Postgres) Date(column string) string {
+	return "to_char(" + column + ", 'YYYY-MM-DD')"
+}
+
+func (Postgres) Age(column string) string {
+	return "EXTRACT(EPOCH FROM (LOCALTIMESTAMP - " + column + "))"
+}
+
+func (Postgres) FromNow() string { return "LOCALTIMESTAMP + make_interval(secs => ?)" }
+
+func (Postgres) IgnoreConflict(columns ...string) string {
+	return "ON CONFLICT (" + strings.Join(columns, ", ") + ") DO NOTHING"
+}
+
+func (Postgres) Distance(column string) (string, bool) {
+	return "ST_DistanceSphere(" + column + ", ST_GeomFromText(?, 4326))", true
+}
+
+func (Postgres) X(column string) string { return "ST_X(" + column + ")" }
+func (Postgres) Y(column string) string { return "ST_Y(" + column + ")" }
+
+func (Postgres) Within(column string) string {
+	return column + " && ST_MakeEnvelope(?, ?, ?, ?, 4326)"
+}
+
+func (Postgres) Polygon(column string) string { return "ST_AsBinary(" + column + ")" }
+func (Postgres) PolygonValue() string         { return "ST_GeomFromWKB(?, 4326)" }
+
+func (Postgres) Contains(column string) (string, bool) {
+	return "ST_Contains(" + column + ", ST_GeomFromText(?, 4326))", true
+}
+
+// Rebind numbers placeholders as $1, $2, ... skipping question marks inside string literals
+func (Postgres) Rebind(query string) string {
+	var out strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+			out.WriteRune(r)
+		case r == '?' && !inString:
+			n++
+			out.WriteString("$" + strconv.Itoa(n))
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// SQLite is the dialect for SQLite, which stores points as plain WKB blobs
+// and has no spatial functions, so distances are computed in Go. The coordinates
+// of points are read by the st_x and st_y functions registered with the driver.
+type SQLite struct{}
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("st_x", 1, pointCoordinate(0))
+	sqlite.MustRegisterDeterministicScalarFunction("st_y", 1, pointCoordinate(1))
+}
+
+// pointCoordinate returns an SQL function reading the longitude (0) or latitude (1) of a WKB point
+func pointCoordinate(axis int) func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+	return func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		data, ok := args[0].([]byte)
+		if !ok {
+			return nil, nil
+		}
+		if len(data) < 21 {
+			return nil, fmt.Errorf("point WKB too short: %d bytes", len(data))
+		}
+		var order binary.ByteOrder = binary.LittleEndian
+		if data[0] == 0 {
+			order = binary.BigEndian
+		}
+		if kind := order.Uint32(data[1:5]); kind != 1 {
+			return nil, fmt.Errorf("WKB geometry type %d is not a point", kind)
+		}
+		return math.Float64frombits(order.Uint64(data[5+8*axis:])), nil
+	}
+}
+
+func (SQLite) Name() string                          { return "sqlite" }
+func (SQLite) Rebind(query string) string            { return query }
+func (SQLite) Point(column string) string            { return column }
+func (SQLite) PointValue() string                    { return "?" }
+func (SQLite) PointArg(p *geo.Point) interface{}     { return PointWKB(p) }
+func (SQLite) Distance(column string) (string, bool) { return "", false }
+func (SQLite) Polygon(column string) string          { return column }
+func (SQLite) PolygonValue() string                  { return "?" }
+func (SQLite) Contains(column string) (string, bool) { return "", false }
+func (SQLite) Like() string                          { return "LIKE" }
+func (SQLite) X(column string) string                { return "st_x(" + column + ")" }
+func (SQLite) Y(column string) string                { return "st_y(" + column + ")" }
+
+func (SQLite) Within(column string) string {
+	return "(st_x(" + column + ") >= ? AND st_y(" + column + ") >= ? AND st_x(" + column + ") <= ? AND st_y(" + column + ") <= ?)"
+}
+
+// The driver scans DATE and DATETIME columns as RFC 3339, so they are formatted in SQL
+func (SQLite) Timestamp(column string) string {
+	return "strftime('%Y-%m-%d %H:%M:%S', " + column + ")"
+}
+
+func (SQLite) Date(column string) string {
+	return "strftime('%Y-%m-%d', " + column + ")"
+}
+
+func (SQLite) Age(column string) string {
+	return "((julianday('now') - julianday(" + column + ")) * 86400)"
+}
+
+func (SQLite) FromNow() string { return "datetime('now', ? || ' seconds')" }
+
+func (SQLite) IgnoreConflict(columns ...string) string {
+	return "ON CONFLICT (" + strings.Join(columns, ", ") + ") DO NOTHING"
+}
+
+// PointWKB encodes a point as little-endian WKB, the format go.geo scans
+func PointWKB(p *geo.Point) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(1) // little endian
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(p.X()))
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(p.Y()))
+	return buf.Bytes()
+}
+
+// PolygonWKB encodes a polygon with a single ring of [longitude, latitude] points as little-endian WKB
+func PolygonWKB(ring [][2]float64) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(1) // little endian
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	binary.Write(&buf, binary.LittleEndian, uint32(len(ring)))
+	for _, p := range ring {
+		binary.Write(&buf, binary.LittleEndian, math.Float64bits(p[0]))
+		binary.Write(&buf, binary.LittleEndian, math.Float64bits(p[1]))
+	}
+	return buf.Bytes()
+}
+
+// ParsePolygonWKB decodes the outer ring of a WKB polygon in either byte order.
+// Inner rings (holes) are not used by the API and are skipped.
+func ParsePolygonWKB(data []byte) ([][2]float64, error) {
+	if len(data) < 9 {
+		return nil, fmt.Errorf("polygon WKB too short: %d bytes", len(data))
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[0] == 0 {
+		order = binary.BigEndian
+	}
+	if kind := order.Uint32(data[1:5]); kind != 3 {
+		return nil, fmt.Errorf("WKB geometry type %d is not a polygon", kind)
+	}
+	if order.Uint32(data[5:9]) == 0 {
+		return [][2]float64{}, nil
+	}
+	if len(data) < 13 {
+		return nil, fmt.Errorf("polygon WKB too short: %d bytes", len(data))
+	}
+	count := int(order.Uint32(data[9:13]))
+	if len(data) < 13+count*16 {
+		return nil, fmt.Errorf("polygon WKB holds fewer than %d points", count)
+	}
+	ring := make([][2]float64, count)
+	for i := range ring {
+		offset := 13 + i*16
+		ring[i] = [2]float64{
+			math.Float64frombits(order.Uint64(data[offset:])),
+			math.Float64frombits(order.Uint64(data[offset+8:])),
+		}
+	}
+	return ring, nil
+}
@@ -0,0 +1,140 @@
+package Database
+
+import (
+	"context"
+	geo "github.com/paulmach/go.geo"
+	"testing"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	query := `SELECT a FROM t WHERE b = ? AND c = '?' AND d LIKE ?`
+	want := `SELECT a FROM t WHERE b = $1 AND c = '?' AND d LIKE $2`
+	if got := (Postgres{}).Rebind(query); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPointWKBRoundTrip(t *testing.T) {
+	p := geo.NewPoint(35.5018, 33.8938)
+
+	var scanned geo.Point
+	if err := scanned.Scan(PointWKB(p)); err != nil {
+		t.Fatal(err)
+	}
+	if !scanned.Equals(p) {
+		t.Fatalf("got %v, want %v", scanned, *p)
+	}
+}
+
+func TestPolygonWKBRoundTrip(t *testing.T) {
+	ring := [][2]float64{{35.47, 33.86}, {35.54, 33.86}, {35.54, 33.91}, {35.47, 33.91}, {35.47, 33.86}}
+
+	parsed, err := ParsePolygonWKB(PolygonWKB(ring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(ring) {
+		t.Fatalf("got %d points, want %d", len(parsed), len(ring))
+	}
+	for i := range ring {
+		if parsed[i] != ring[i] {
+			t.Fatalf("point %d: got %v, want %v", i, parsed[i], ring[i])
+		}
+	}
+
+	if _, err := ParsePolygonWKB(PointWKB(geo.NewPoint(35.5, 33.9))); err == nil {
+		t.Fatal("expected a point to be rejected")
+	}
+}
+
+func TestSQLiteStoresPoints(t *testing.T) {
+	db, err := DBConnection("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE places (id INTEGER PRIMARY KEY AUTOINCREMENT, location blob)`); err != nil {
+		t.Fatal(err)
+	}
+	p := geo.NewPoint(35.5018, 33.8938)
+	id, err := db.InsertID(context.Background(), `INSERT INTO places (location) VALUES (`+db.Dialect.PointValue()+`)`, "id", db.Dialect.PointArg(p))
+	if err != nil || id != 1 {
+		t.Fatalf("unexpected insert %d %v", id, err)
+	}
+
+	var scanned geo.Point
+	if err := db.QueryRow(`SELECT `+db.Dialect.Point("location")+` FROM places WHERE id = ?`, id).Scan(&scanned); err != nil {
+		t.Fatal(err)
+	}
+	if !scanned.Equals(p) {
+		t.Fatalf("got %v, want %v", scanned, *p)
+	}
+}
+
+func TestSQLitePointCoordinates(t *testing.T) {
+	db, err := DBConnection("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE places (location blob)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO places (location) VALUES (?), (?)`, PointWKB(geo.NewPoint(35.5018, 33.8938)), PointWKB(geo.NewPoint(35.8498, 34.4346))); err != nil {
+		t.Fatal(err)
+	}
+
+	var lng, lat float64
+	err = db.QueryRow(`SELECT `+db.Dialect.X("location")+`, `+db.Dialect.Y("location")+` FROM places WHERE `+db.Dialect.Within("location"), 35.4, 33.8, 35.6, 34.0).Scan(&lng, &lat)
+	if err != nil || lng != 35.5018 || lat != 33.8938 {
+		t.Fatalf("expected the Beirut point inside the box, got %v, %v: %v", lng, lat, err)
+	}
+}
+
+func TestSQLiteAge(t *testing.T) {
+	db, err := DBConnection("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var age float64
+	if err := db.QueryRow(`SELECT ` + db.Dialect.Age("datetime('now', '-1 hour')")).Scan(&age); err != nil {
+		t.Fatal(err)
+	}
+	if age < 3599 || age > 3601 {
+		t.Fatalf("expected an hour, got %v seconds", age)
+	}
+
+	// A timestamp an hour from now is an hour younger than now
+	if err := db.QueryRow(`SELECT `+db.Dialect.Age(db.Dialect.FromNow()), 3600).Scan(&age); err != nil {
+		t.Fatal(err)
+	}
+	if age < -3601 || age > -3599 {
+		t.Fatalf("expected minus an hour, got %v seconds", age)
+	}
+}
+
+func TestSQLiteIgnoreConflict(t *testing.T) {
+	db, err := DBConnection("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE counts (a INTEGER, b TEXT, n INTEGER, PRIMARY KEY (a, b))`); err != nil {
+		t.Fatal(err)
+	}
+	insert := `INSERT INTO counts (a, b, n) VALUES (?, ?, ?) ` + db.Dialect.IgnoreConflict("a", "b")
+	for _, n := range []int{1, 2} {
+		if _, err := db.Exec(insert, 1, "x", n); err != nil {
+			t.Fatalf("expected the clashing row to be skipped, got %v", err)
+		}
+	}
+	var n int
+	if err := db.QueryRow(`SELECT n FROM counts WHERE a = 1 AND b = 'x'`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected the first row kept, got %d %v", n, err)
+	}
+}
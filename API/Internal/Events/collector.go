@@ -0,0 +1,55 @@
+package Events
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Collector buffers events in memory so that recording one never waits on storage.
+// A job calls Flush to write what was buffered in batches. When the buffer is full,
+// events are dropped and counted rather than holding up the caller.
+type Collector[T any] struct {
+	buffer  chan T
+	batch   int
+	write   func(ctx context.Context, events []T) error
+	dropped atomic.Int64
+}
+
+// NewCollector returns a collector holding up to size events, written batch at a time with write
+func NewCollector[T any](size, batch int, write func(ctx context.Context, events []T) error) *Collector[T] {
+	return &Collector[T]{buffer: make(chan T, max(size, 1)), batch: max(batch, 1), write: write}
+}
+
+// Add buffers an event, reporting false when the buffer was full and the event dropped
+func (c *Collector[T]) Add(event T) bool {
+	select {
+	case c.buffer <- event:
+		return true
+	default:
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// Flush writes the events buffered when it is called and returns how many it wrote. Events
+// added meanwhile wait for the next flush. A failed batch is lost along with the error.
+func (c *Collector[T]) Flush(ctx context.Context) (int, error) {
+	written := 0
+	for pending := len(c.buffer); pending > 0; {
+		events := make([]T, 0, min(pending, c.batch))
+		for len(events) < cap(events) {
+			events = append(events, <-c.buffer)
+		}
+		pending -= len(events)
+		if err := c.write(ctx, events); err != nil {
+			return written, err
+		}
+		written += len(events)
+	}
+	return written, nil
+}
+
+// Dropped returns how many events were dropped since the last call, and resets the count
+func (c *Collector[T]) Dropped() int64 {
+	return c.dropped.Swap(0)
+}
@@ -0,0 +1,67 @@
+package Events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCollectorWritesInBatches(t *testing.T) {
+	var batches [][]int
+	c := NewCollector(10, 4, func(ctx context.Context, events []int) error {
+		batches = append(batches, events)
+		return nil
+	})
+
+	for i := 1; i <= 9; i++ {
+		if !c.Add(i) {
+			t.Fatalf("event %d dropped with room in the buffer", i)
+		}
+	}
+	written, err := c.Flush(context.Background())
+	if err != nil || written != 9 {
+		t.Fatalf("expected 9 events written, got %d (%v)", written, err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 4 || len(batches[2]) != 1 || batches[2][0] != 9 {
+		t.Fatalf("expected batches of 4, 4 and 1 in order, got %v", batches)
+	}
+
+	// Nothing buffered, nothing written
+	if written, err := c.Flush(context.Background()); err != nil || written != 0 || len(batches) != 3 {
+		t.Fatalf("expected an empty flush, got %d (%v)", written, err)
+	}
+}
+
+func TestCollectorDropsWhenFull(t *testing.T) {
+	failing := true
+	c := NewCollector(2, 10, func(ctx context.Context, events []string) error {
+		if failing {
+			return errors.New("storage is down")
+		}
+		return nil
+	})
+
+	c.Add("a")
+	c.Add("b")
+	if c.Add("c") || c.Add("d") {
+		t.Fatal("expected events past the buffer to be dropped")
+	}
+	if dropped := c.Dropped(); dropped != 2 {
+		t.Fatalf("expected 2 dropped, got %d", dropped)
+	}
+	if dropped := c.Dropped(); dropped != 0 {
+		t.Fatalf("expected the count to reset, got %d", dropped)
+	}
+
+	// A failed write frees the buffer instead of blocking later events
+	if _, err := c.Flush(context.Background()); err == nil {
+		t.Fatal("expected the write error")
+	}
+	failing = false
+	if !c.Add("e") {
+		t.Fatal("expected room after the failed flush")
+	}
+	if written, err := c.Flush(context.Background()); err != nil || written != 1 {
+		t.Fatalf("expected 1 event written, got %d (%v)", written, err)
+	}
+}
@@ -0,0 +1,38 @@
+package Jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobsRepeatUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 10)
+
+	Start(ctx, Job{Name: "test", Interval: time.Millisecond, Run: func(ctx context.Context) error {
+		runs <- struct{}{}
+		return errors.New("failures do not stop the job")
+	}})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("job ran %d times, expected 3", i)
+		}
+	}
+	cancel()
+
+	// Drain a run that may have started before the cancellation was seen
+	time.Sleep(10 * time.Millisecond)
+	for len(runs) > 0 {
+		<-runs
+	}
+	select {
+	case <-runs:
+		t.Fatal("job kept running after cancellation")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,138 @@
+package Middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// APIKeys authenticates API keys and meters their use, as Services.Service.APIClients does
+type APIKeys interface {
+	Authenticate(ctx context.Context, key string) (Services.APIClient, error)
+	Meter(ctx context.Context, clientID int, day string, quota int) (bool, error)
+}
+
+// APIKeyMiddleware authenticates third-party clients by the key in the X-API-Key header,
+// holds each client to its rate limit and daily quota, and meters its requests. The
+// client_id and scopes are passed to the next handler in the context.
+func APIKeyMiddleware(keys APIKeys) func(http.Handler) http.Handler {
+	limiter := &rateLimiter{windows: map[int]*rateWindow{}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if key == "" {
+				Utils.RespondProblem(w, r, http.StatusUnauthorized, "unauthorized", "Missing X-API-Key header")
+				return
+			}
+
+			client, err := keys.Authenticate(r.Context(), key)
+			if errors.Is(err, Services.ErrUnauthorized) {
+				Utils.RespondProblem(w, r, http.StatusUnauthorized, "unauthorized", "Invalid or revoked API key")
+				return
+			}
+			if err != nil {
+				log.Printf("could not authenticate API key: %v", err)
+				Utils.RespondProblem(w, r, http.StatusInternalServerError, "internal_error", "An internal error occurred")
+				return
+			}
+
+			// Requests over the rate limit are refused before they are metered
+			now := time.Now()
+			remaining, reset, ok := limiter.allow(client.ClientID, client.RateLimit, now)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(client.RateLimit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !ok {
+				w.Header().Set("Retry-After", retryAfter(reset))
+				Utils.RespondProblem(w, r, http.StatusTooManyRequests, "rate_limited", "Rate limit of "+strconv.Itoa(client.RateLimit)+" requests per minute exceeded")
+				return
+			}
+
+			allowed, err := keys.Meter(r.Context(), client.ClientID, now.Format("2006-01-02"), client.DailyQuota)
+			if err != nil {
+				log.Printf("could not meter API client %d: %v", client.ClientID, err)
+				Utils.RespondProblem(w, r, http.StatusInternalServerError, "internal_error", "An internal error occurred")
+				return
+			}
+			if !allowed {
+				midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+				w.Header().Set("Retry-After", retryAfter(midnight.Sub(now)))
+				Utils.RespondProblem(w, r, http.StatusTooManyRequests, "quota_exceeded", "Daily quota of "+strconv.Itoa(client.DailyQuota)+" requests used up")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "api_client_id", client.ClientID)
+			ctx = context.WithValue(ctx, "api_scopes", client.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects API clients that were not granted scope.
+// It must run after APIKeyMiddleware, which puts the scopes in the context.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes, _ := r.Context().Value("api_scopes").([]string); !slices.Contains(scopes, scope) {
+				Utils.RespondProblem(w, r, http.StatusForbidden, "forbidden", "API key lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// retryAfter formats a wait for the Retry-After header, in whole seconds rounded up
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int((wait + time.Second - 1) / time.Second))
+}
+
+// rateWindow counts a client's requests in the minute started at start
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter holds each client to a number of requests per minute, in fixed windows.
+// Counts are kept in memory, so each instance of the API limits clients on its own.
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[int]*rateWindow
+	swept   time.Time
+}
+
+// allow counts a request of a client against limit, reporting the requests left in the
+// window, how long until it resets and whether the request is allowed
+func (l *rateLimiter) allow(clientID, limit int, at time.Time) (int, time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Windows over for a minute are dropped once a minute, so clients that stopped calling
+	// do not stay in memory
+	if at.Sub(l.swept) >= time.Minute {
+		for id, window := range l.windows {
+			if at.Sub(window.start) >= time.Minute {
+				delete(l.windows, id)
+			}
+		}
+		l.swept = at
+	}
+
+	window, ok := l.windows[clientID]
+	if !ok || at.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: at}
+		l.windows[clientID] = window
+	}
+	reset := window.start.Add(time.Minute).Sub(at)
+	if window.count >= limit {
+		return 0, reset, false
+	}
+	window.count++
+	return limit - window.count, reset, true
+}
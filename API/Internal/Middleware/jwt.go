@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
 	"strings"
@@ -18,14 +19,14 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		// Get the token from the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+			Utils.RespondProblem(w, r, http.StatusUnauthorized, "unauthorized", "Missing Authorization header")
 			return
 		}
 
 		// The token should be in the form "Bearer <token>"
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			http.Error(w, "Invalid token format", http.StatusUnauthorized)
+			Utils.RespondProblem(w, r, http.StatusUnauthorized, "unauthorized", "Invalid token format")
 			return
 		}
 
@@ -40,14 +41,40 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		})
 
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			Utils.RespondProblem(w, r, http.StatusUnauthorized, "unauthorized", "Invalid or expired token")
 			return
 		}
 
-		// Store user_id in the context to be used in the controller
+		// Store user_id and role in the context to be used in the controller
 		ctx := context.WithValue(r.Context(), "token_user_id", claims.UserID)
+		ctx = context.WithValue(ctx, "token_role", claims.Role)
 
 		// Pass the context with user_id to the next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// OptionalAuth identifies the caller on public routes that show more to signed in users.
+// Requests without a token pass through anonymously, but a token that is sent must be valid.
+func OptionalAuth(next http.Handler) http.Handler {
+	authenticated := AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// AdminOnly rejects callers whose token does not carry the admin role.
+// It must run after AuthMiddleware, which puts the role in the context.
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if role, _ := r.Context().Value("token_role").(string); role != Services.RoleAdmin {
+			Utils.RespondProblem(w, r, http.StatusForbidden, "forbidden", "Admin role required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,269 @@
+package Migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration files are embedded in the binary, one directory per dialect, and named
+// <version>_<name>.up.sql / <version>_<name>.down.sql, e.g. sql/mysql/0001_initial.up.sql.
+// Every dialect must carry the same versions so a database can move between drivers.
+//
+//go:embed sql/mysql/*.sql sql/postgres/*.sql sql/sqlite/*.sql
+var files embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a single versioned schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied to the database
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+// Load reads the embedded migration files for a dialect, sorted by version
+func Load(dialect string) ([]Migration, error) {
+	dir := path.Join("sql", dialect)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %q: %w", dialect, err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := files.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %q: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Latest returns the highest version embedded in the binary for a dialect
+func Latest(dialect string) (int, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// ensureTable creates the bookkeeping table if it does not exist yet
+func ensureTable(ctx context.Context, db *Database.DB) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version int NOT NULL,
+			name varchar(255) NOT NULL,
+			applied_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (version)
+		)`
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("could not create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// applied returns the applied versions mapped to the time they were applied
+func applied(ctx context.Context, db *Database.DB) (map[int]string, error) {
+	if err := ensureTable(ctx, db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := map[int]string{}
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("could not scan schema_migrations: %w", err)
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// Current returns the highest applied version, or 0 for an empty database
+func Current(ctx context.Context, db *Database.DB) (int, error) {
+	versions, err := applied(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	current := 0
+	for version := range versions {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
+// List returns every embedded migration together with its applied state
+func List(ctx context.Context, db *Database.DB) ([]Status, error) {
+	migrations, err := Load(db.Dialect.Name())
+	if err != nil {
+		return nil, err
+	}
+	versions, err := applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		appliedAt, ok := versions[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns the ones it applied
+func Up(ctx context.Context, db *Database.DB) ([]Migration, error) {
+	statuses, err := List(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		if err := run(ctx, db, status.Migration.Up); err != nil {
+			return done, fmt.Errorf("migration %04d_%s failed: %w", status.Version, status.Name, err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, status.Version, status.Name); err != nil {
+			return done, fmt.Errorf("could not record migration %d: %w", status.Version, err)
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the given number of applied migrations, newest first
+func Down(ctx context.Context, db *Database.DB, steps int) ([]Migration, error) {
+	statuses, err := List(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if err := run(ctx, db, status.Migration.Down); err != nil {
+			return done, fmt.Errorf("rollback of %04d_%s failed: %w", status.Version, status.Name, err)
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, status.Version); err != nil {
+			return done, fmt.Errorf("could not remove migration %d: %w", status.Version, err)
+		}
+		done = append(done, status.Migration)
+	}
+	return done, nil
+}
+
+// Check returns an error unless the database is at exactly the version embedded in the binary
+func Check(ctx context.Context, db *Database.DB) error {
+	latest, err := Latest(db.Dialect.Name())
+	if err != nil {
+		return err
+	}
+	current, err := Current(ctx, db)
+	if err != nil {
+		return err
+	}
+	if current != latest {
+		return fmt.Errorf("database schema is at version %d but this build expects version %d; run \"api migrate up\" or deploy the matching build", current, latest)
+	}
+	return nil
+}
+
+// run executes each statement of a migration script in order
+func run(ctx context.Context, db *Database.DB, script string) error {
+	for _, statement := range split(script) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split breaks a script into statements on semicolons that end a line, dropping comment lines
+func split(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+			statements = append(statements, statement)
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,105 @@
+package Migrations
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"testing"
+)
+
+func TestDialectsShareVersions(t *testing.T) {
+	mysql, err := Load("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		migrations, err := Load(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != len(mysql) {
+			t.Fatalf("%s has %d migrations, mysql has %d", dialect, len(migrations), len(mysql))
+		}
+		for i, migration := range migrations {
+			if migration.Version != mysql[i].Version || migration.Name != mysql[i].Name {
+				t.Fatalf("%s migration %04d_%s does not match mysql %04d_%s", dialect, migration.Version, migration.Name, mysql[i].Version, mysql[i].Name)
+			}
+		}
+	}
+}
+
+func TestUpCheckDown(t *testing.T) {
+	ctx := context.Background()
+	db, err := Database.DBConnection("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Check(ctx, db); err == nil {
+		t.Fatal("expected an empty database to fail the version check")
+	}
+
+	migrations, err := Load("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := Up(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrations), len(done))
+	}
+	if err := Check(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if done, err := Up(ctx, db); err != nil || len(done) != 0 {
+		t.Fatalf("expected a second run to do nothing, got %v %v", done, err)
+	}
+
+	if _, err := Down(ctx, db, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := Current(ctx, db); err != nil || current != 0 {
+		t.Fatalf("expected version 0 after rolling back, got %d %v", current, err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	db, err := Database.DBConnection("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Seed(ctx, db); err == nil {
+		t.Fatal("expected seeding a database without the schema to fail")
+	}
+	if _, err := Up(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := Seed(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	for table, want := range map[string]int{"users": len(seedUsers), "listings": len(seedListings), "images": len(seedImages), "transactions": len(seedTransactions)} {
+		var count int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&count); err != nil || count != want {
+			t.Fatalf("expected %d %s, got %d %v", want, table, count, err)
+		}
+	}
+	// Rows are linked through the ids the database gave them, not those of the dump
+	var title string
+	err = db.QueryRowContext(ctx, `SELECT l.title FROM transactions t JOIN listings l ON l.listing_id = t.listing_id
+		JOIN users u ON u.user_id = t.user_offered_id WHERE u.phone_number = '03601360' LIMIT 1`).Scan(&title)
+	if err != nil || title != "ADS_Connectivity_Graph" {
+		t.Fatalf("expected transactions on the seeded listing, got %q %v", title, err)
+	}
+
+	if err := Seed(ctx, db); err == nil {
+		t.Fatal("expected seeding a database with users to fail")
+	}
+}
@@ -0,0 +1,197 @@
+package Migrations
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	geo "github.com/paulmach/go.geo"
+)
+
+// The demo data below is what APP/myapp/db.sql held before the schema moved to migrations.
+// Ids are the ones of the dump, only used to link rows: the database assigns new ones.
+// Points keep the x and y they were stored with, and the image files were never part of
+// the dump, so seeded images have no file behind them until one is copied into SRV_DIR.
+
+type seedUser struct {
+	id                                                int
+	firstName, lastName, phone, birthDate, profession string
+	x, y                                              float64
+	password, city, country                           string
+	profileImage                                      int
+}
+
+type seedListing struct {
+	id                                             int
+	kind                                           string
+	x, y                                           float64
+	userID                                         int
+	title, description, dateCreated, city, country string
+}
+
+type seedImage struct {
+	id                int
+	url               string
+	userID, listingID int
+	dateCreated       string
+}
+
+type seedTransaction struct {
+	offeredID, offeringID, listingID                         int
+	priceMinor                                               int64
+	currency, dateCreated, jobStart, jobEnd, details, status string
+}
+
+var seedUsers = []seedUser{
+	{2, "John", "Doe", "+1234567890", "1990-05-15", "Software Engineer", 55.243683, 34.052235, "$2a$10$yk0iyuXu/BreqUpTtZI26OO0rsdepXXrW2xP.0xGpLug2y8KoXmFy", "دهستان بیابانک", "Iran", 16},
+	{4, "John", "Doe", "1234567890", "1990-05-15", "Software Engineer", 55.243683, 34.052235, "$2a$10$uajyaEVQArQHHdkXCeCuYO/6LjUMVc1p7R9NTx28v25exAGGAJLXy", "دهستان بیابانک", "Iran", 0},
+	{6, "John", "Doe", "11234567890", "1990-05-15", "Software Engineer L1", 34.36126409279654, 35.83190917968751, "$2a$10$g4W31r/KgVfTx2hf2gqe0eW74q4cdC7Td08bI4AzOEM1MyW4.e03a", "", "Cyprus", 58},
+	{14, "Adam", "Elhassan", "9613601360", "2003-08-01", "Software Engineer", 35.833690166473396, 34.362143106071905, "$2a$10$g0QWBoh3BSGr3Os4Gxauu.3p6sJB0owQk1Zacz.ff35c64LLVo/dG", "Nakhleh", "Lebanon", 0},
+	{31, "Adam", "Elhassan", "03601360", "2024-12-03", "Software Engineer1", 35.48640369207076, 33.8872146765117, "$2a$10$8MmBO4kvbbaQdJL589jhyeN4fAk25RVrP6bGNpgYMISJe.q0zs95K", "Dar Al Fatwa", "Lebanon", 66},
+	{32, "Maji", "Wajdi", "1123456789012121", "2024-12-03", "Batata", 33.89482566531713, 35.48015912709417, "$2a$10$rMC/zB9K3H9VSv/SkSld2umR2AcZytHhWHNyq3SCk.S1yJt30tv3u", "", "Cyprus", 0},
+	{33, "Majdi", "Wajdi", "11234567890111", "2024-12-01", "Batata", 35.48033066709342, 33.88998087799329, "$2a$10$qJlfWq1Ikq4adQp7.p9rBO3VhhvYqJpOUD5TvfoV6ZE4vdOKll0v2", "Beirut", "Lebanon", 0},
+}
+
+var seedListings = []seedListing{
+	{19, "Offer", 51.50050219113399, -0.09077765629626812, 6, "Potato Farmer", "20$ per hour good job", "2024-12-01 09:29:45", "", ""},
+	{20, "Request", 0.0, 0.0, 6, "Manga Taza lal bei3333", "batata", "2024-12-01 09:30:42", "", ""},
+	{22, "Request", 0.0, 0.0, 6, "Makdoos Baladi", "fresh", "2024-12-01 09:31:59", "", ""},
+	{23, "Offer", 0.0, 0.0, 6, "Mjadra", "", "2024-12-01 09:32:57", "", ""},
+	{24, "Request", 34.29593790032167, 35.92267123516649, 6, "Maraba MeshMosh", "", "2024-12-01 09:33:38", "", ""},
+	{25, "Offer", 34.083444015144245, 35.65859361318872, 6, "Shawarma ", "Extra Toum", "2024-12-01 09:34:55", "", "Cyprus"},
+	{26, "Offer", 34.43948710089203, 35.83420320181177, 6, "Batoun", "M3alem Nb1 Batoun", "2024-12-13 06:45:31", "", "Cyprus"},
+	{27, "Offer", 34.439340902451306, 35.83777687861585, 6, "King of  Ceramic", "Best from italy nb1", "2024-12-13 07:01:42", "", "Cyprus"},
+	{28, "Offer", 34.33919675998744, 35.84838867187501, 6, "Washing Machine Repair", "Specialized in modern brands but can work on all types", "2024-12-13 07:04:58", "", ""},
+	{29, "Request", 34.31629249083248, 35.81130981445313, 6, "House Cleaner", "Get it squeeky clean", "2024-12-13 07:07:20", "", "Cyprus"},
+	{30, "Request", 34.395652655380246, 35.82366943359376, 6, "Car Detailing", "Ceramic", "2024-12-13 07:08:59", "", "Cyprus"},
+	{31, "Request", 35.86074829101563, 34.42284455169542, 6, "Blat", "M3alem Blat", "2024-12-13 07:50:16", "Mejdlaiya", "Lebanon"},
+	{32, "Request", 35.84838867187501, 34.38212744475687, 6, "ADS_Connectivity_Graph", "2121", "2024-12-13 07:56:55", "Dahr El Ain", "Lebanon"},
+	{33, "Offer", 36.05352401733399, 34.246856651662135, 6, "Mountain", "POtato", "2024-12-16 00:34:24", "El Arz", "Lebanon"},
+}
+
+var seedImages = []seedImage{
+	{26, "a3746f6f-64f1-4305-8ea5-2435aa7577d0.png", 6, 0, "2024-11-12 19:09:16"},
+	{27, "76abbd58-a766-44d8-a48a-c4021a6333e3.png", 6, 5, "2024-11-18 08:12:53"},
+	{28, "d5412e25-36c4-4929-9a0a-c107d0740481.png", 6, 4, "2024-11-18 08:56:28"},
+	{29, "0f51c2ab-78d8-4808-8019-e3af9372759c.png", 6, 11, "2024-11-18 20:23:33"},
+	{30, "16e139d8-23f9-41a2-957b-f1ec96e299d3.png", 6, 11, "2024-11-18 20:23:33"},
+	{31, "020132e3-2c1f-4f2a-919e-7f1c5c486cef.png", 6, 12, "2024-11-18 20:25:05"},
+	{32, "55e94a5b-7bdb-41b6-9e94-b486a4f964ad.png", 6, 12, "2024-11-18 20:25:05"},
+	{33, "33aeff0a-3603-4784-b253-36fa99d81d50.png", 6, 16, "2024-11-19 13:17:02"},
+	{34, "62199bb5-6cc2-473c-9639-25dce5ea79b7.png", 6, 17, "2024-11-19 18:44:14"},
+	{35, "3f428f54-096a-4b90-8b47-abe97a178ddc.png", 6, 17, "2024-11-19 18:44:14"},
+	{36, "ed74fba2-6831-4f08-a29c-fe9c2274ad6f.png", 6, 18, "2024-11-19 19:32:55"},
+	{37, "ee227802-6ea0-4e2f-955f-1f09f68fd537.png", 6, 18, "2024-11-19 19:32:55"},
+	{38, "7ab08e08-3929-4e38-ae13-d7895bb4b4f0.png", 6, 4, "2024-11-30 16:53:16"},
+	{39, "fb1e2222-a3ce-4985-b3aa-8850e2f46652.png", 6, 0, "2024-12-01 04:58:40"},
+	{40, "78c22fac-cd4e-43fc-8887-a5d27e751393.png", 6, 0, "2024-12-01 05:18:40"},
+	{41, "ece1705e-bc98-4626-9f81-a42a66bb78ab.png", 6, 0, "2024-12-01 05:21:13"},
+	{42, "72b0c794-0ceb-40c4-95f4-47a312f4c293.png", 6, 0, "2024-12-01 05:23:12"},
+	{43, "c365a886-58b4-46a8-9f0a-094088d4d8db.png", 6, 0, "2024-12-01 05:23:21"},
+	{44, "4b23a9d8-c406-47a1-be58-fbbde04c8843.jpg", 6, 19, "2024-12-01 09:29:45"},
+	{45, "f0efbd61-db08-4e38-86ac-7825f9804b90.jpg", 6, 19, "2024-12-01 09:29:45"},
+	{46, "1a6a5665-aa19-4fc8-9039-3c060d0b4baf.jpg", 6, 19, "2024-12-01 09:29:45"},
+	{47, "659ed22b-dcfd-4379-bdff-decae6f758b1.jpg", 6, 20, "2024-12-01 09:30:42"},
+	{48, "362390ed-77db-43c8-bba7-72d611c6bc7f.jpg", 6, 20, "2024-12-01 09:30:42"},
+	{49, "b72da60d-fd36-4036-902f-085c73e337f1.jpg", 6, 22, "2024-12-01 09:31:59"},
+	{50, "f4b956f5-ebf4-4537-b215-ae2ec0fc1fe7.jpg", 6, 22, "2024-12-01 09:31:59"},
+	{51, "e3bd06c7-15ad-4705-867c-bde6f3a5c56e.jpg", 6, 23, "2024-12-01 09:32:57"},
+	{52, "a989373b-fc86-4d06-b680-07b0c9b9a124.jpg", 6, 23, "2024-12-01 09:32:57"},
+	{53, "d01ae7a0-0e91-4071-8fcc-65d7d65c20b4.jpg", 6, 24, "2024-12-01 09:33:38"},
+	{54, "9c478e1c-9083-42a0-acfa-bcefb7d4afe0.jpg", 6, 24, "2024-12-01 09:33:38"},
+	{55, "002c85a7-cc6b-424b-a343-568c4b4146c9.jpg", 6, 25, "2024-12-01 09:34:56"},
+	{56, "9a502cf5-7574-4472-80e5-21a722dbda14.jpg", 6, 25, "2024-12-01 09:34:56"},
+	{57, "9d0a6c07-24a0-489a-babf-36f62be07edc.jpg", 6, 0, "2024-12-01 09:36:53"},
+	{58, "ba0151c2-1a87-4ecc-92cb-0c7d37ca112d.jpg", 6, 0, "2024-12-01 13:40:25"},
+	{59, "833b9c4d-a458-420a-841a-fdea89eedaf0.jpg", 6, 26, "2024-12-13 06:45:31"},
+	{60, "64c0148e-b5ce-4c37-85ce-158aee54cf1d.jpg", 6, 27, "2024-12-13 07:01:42"},
+	{61, "801a8427-f485-484f-a21d-930574a8f8e4.jpg", 6, 28, "2024-12-13 07:04:58"},
+	{62, "d459d35d-7937-4bfe-910b-f16f37a758a6.jpg", 6, 29, "2024-12-13 07:07:20"},
+	{63, "74872d70-47ae-4ee7-897b-92106432c439.jpg", 6, 30, "2024-12-13 07:08:59"},
+	{64, "139d3c4f-e9d1-498d-ad8d-d8f1b418fb39.jpg", 6, 31, "2024-12-13 07:50:16"},
+	{65, "2adf6434-5b74-4ddd-a2de-e415eba33581.jpg", 6, 32, "2024-12-13 07:56:55"},
+	{66, "04a2d0c2-a72e-4ef7-b858-16427886b84c.jpeg", 31, 0, "2024-12-15 22:31:45"},
+	{67, "c9dc8e25-7e1a-4580-8273-fe810ad04f92.jpg", 6, 33, "2024-12-16 00:34:24"},
+}
+
+var seedTransactions = []seedTransaction{
+	{31, 6, 32, 2100, "USD", "2024-12-15 15:42:26", "2024-12-09", "2024-12-27", "Price is per hour", "Completed"},
+	{31, 6, 32, 2100, "USD", "2024-12-15 15:42:45", "2024-12-09", "2024-12-27", "Price is per hour", "Accepted"},
+	{31, 6, 32, 2100, "USD", "2024-12-15 15:43:10", "2024-12-09", "2024-12-27", "Price is per hour", "Completed"},
+	{31, 6, 32, 211100, "EUR", "2024-12-15 15:43:35", "2024-12-06", "2024-12-25", "Matata", "Completed"},
+	{31, 6, 32, 211100, "EUR", "2024-12-15 15:44:40", "2024-12-06", "2024-12-25", "Matata", "Pending"},
+	{31, 6, 32, 211100, "EUR", "2024-12-15 15:44:59", "2024-12-06", "2024-12-25", "Matata", "Pending"},
+	{31, 6, 32, 211100, "EUR", "2024-12-15 15:47:36", "2024-12-06", "2024-12-25", "Matata", "Pending"},
+	{31, 6, 32, 211100, "USD", "2024-12-15 17:39:41", "2024-12-09", "2024-12-27", "ssss", "Pending"},
+}
+
+// Seed fills an up-to-date database that has no users yet with the demo data
+func Seed(ctx context.Context, db *Database.DB) error {
+	if err := Check(ctx, db); err != nil {
+		return err
+	}
+	var users int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&users); err != nil {
+		return fmt.Errorf("could not count users: %w", err)
+	}
+	if users > 0 {
+		return fmt.Errorf("database already has %d users, seed only fills an empty one", users)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userIDs := map[int]int64{}
+	for _, user := range seedUsers {
+		id, err := tx.InsertID(ctx, `INSERT INTO users (first_name, last_name, phone_number, date_of_birth, profession, location, password, city, country)
+			VALUES (?, ?, ?, ?, ?, `+db.Dialect.PointValue()+`, ?, ?, ?)`, "user_id",
+			user.firstName, user.lastName, user.phone, user.birthDate, user.profession, db.Dialect.PointArg(geo.NewPoint(user.x, user.y)),
+			user.password, user.city, user.country)
+		if err != nil {
+			return fmt.Errorf("could not seed user %d: %w", user.id, err)
+		}
+		userIDs[user.id] = id
+	}
+
+	listingIDs := map[int]int64{0: 0}
+	for _, listing := range seedListings {
+		id, err := tx.InsertID(ctx, `INSERT INTO listings (type, location, user_id, title, description, date_created, city, country)
+			VALUES (?, `+db.Dialect.PointValue()+`, ?, ?, ?, ?, ?, ?)`, "listing_id",
+			listing.kind, db.Dialect.PointArg(geo.NewPoint(listing.x, listing.y)), userIDs[listing.userID],
+			listing.title, listing.description, listing.dateCreated, listing.city, listing.country)
+		if err != nil {
+			return fmt.Errorf("could not seed listing %d: %w", listing.id, err)
+		}
+		listingIDs[listing.id] = id
+	}
+
+	imageIDs := map[int]int64{}
+	for _, image := range seedImages {
+		id, err := tx.InsertID(ctx, `INSERT INTO images (url, user_id, listing_id, show_on_profile, date_created) VALUES (?, ?, ?, ?, ?)`, "image_id",
+			image.url, userIDs[image.userID], listingIDs[image.listingID], true, image.dateCreated)
+		if err != nil {
+			return fmt.Errorf("could not seed image %d: %w", image.id, err)
+		}
+		imageIDs[image.id] = id
+	}
+	// Profile images point at images, which only exist once users do. One points at an
+	// image the dump did not have and is left without.
+	for _, user := range seedUsers {
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET profile_image = ? WHERE user_id = ?`, imageIDs[user.profileImage], userIDs[user.id]); err != nil {
+			return fmt.Errorf("could not seed profile image of user %d: %w", user.id, err)
+		}
+	}
+
+	for _, transaction := range seedTransactions {
+		_, err := tx.ExecContext(ctx, `INSERT INTO transactions (user_offered_id, user_offering_id, listing_id, price_minor, currency, date_created,
+			job_start_date, job_end_date, details_from_offered, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			userIDs[transaction.offeredID], userIDs[transaction.offeringID], listingIDs[transaction.listingID], transaction.priceMinor,
+			transaction.currency, transaction.dateCreated, transaction.jobStart, transaction.jobEnd, transaction.details, transaction.status)
+		if err != nil {
+			return fmt.Errorf("could not seed transaction: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,73 @@
+-- Initial schema, taken from the original minbya3mili mysqldump.
+-- Tables are created only when missing so that databases restored from
+-- the dump can be brought under version control without changes.
+
+CREATE TABLE IF NOT EXISTS `users` (
+  `user_id` int NOT NULL AUTO_INCREMENT,
+  `first_name` varchar(50) NOT NULL,
+  `last_name` varchar(50) NOT NULL,
+  `phone_number` varchar(20) NOT NULL,
+  `date_of_birth` date NOT NULL,
+  `profession` varchar(100) NOT NULL,
+  `location` point NOT NULL,
+  `password` varchar(255) NOT NULL,
+  `city` varchar(25) NOT NULL,
+  `country` varchar(25) NOT NULL,
+  `profile_image` int NOT NULL DEFAULT '0',
+  PRIMARY KEY (`user_id`),
+  UNIQUE KEY `user_id_UNIQUE` (`user_id`),
+  SPATIAL KEY `location` (`location`),
+  KEY `profile_image_idx` (`profile_image`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `listings` (
+  `listing_id` int NOT NULL AUTO_INCREMENT,
+  `type` enum('Request','Offer') NOT NULL,
+  `location` point NOT NULL,
+  `user_id` int NOT NULL,
+  `title` varchar(255) NOT NULL,
+  `description` text NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `active` tinyint(1) NOT NULL DEFAULT '1',
+  `city` varchar(255) NOT NULL,
+  `country` varchar(255) NOT NULL,
+  PRIMARY KEY (`listing_id`),
+  SPATIAL KEY `location` (`location`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `listings_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `images` (
+  `image_id` int NOT NULL AUTO_INCREMENT,
+  `url` varchar(255) NOT NULL,
+  `user_id` int NOT NULL,
+  `listing_id` int NOT NULL DEFAULT '0',
+  `show_on_profile` tinyint(1) DEFAULT '0',
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`image_id`),
+  UNIQUE KEY `url_UNIQUE` (`url`),
+  KEY `fk_images_1_idx` (`user_id`),
+  CONSTRAINT `fk_images_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS `transactions` (
+  `transaction_id` int NOT NULL AUTO_INCREMENT,
+  `user_offered_id` int NOT NULL,
+  `user_offering_id` int NOT NULL,
+  `listing_id` int NOT NULL,
+  `price` double NOT NULL,
+  `date_created` timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  `job_start_date` date NOT NULL,
+  `job_end_date` date NOT NULL,
+  `details_from_offered` varchar(1000) NOT NULL,
+  `details_from_offering` varchar(1000) NOT NULL DEFAULT '',
+  `currency` varchar(10) NOT NULL DEFAULT 'USD',
+  `status` enum('Pending','Accepted','Completed') NOT NULL DEFAULT 'Pending',
+  PRIMARY KEY (`transaction_id`),
+  KEY `user_offered_id` (`user_offered_id`),
+  KEY `user_offering_id` (`user_offering_id`),
+  KEY `listing_id` (`listing_id`),
+  CONSTRAINT `transactions_ibfk_1` FOREIGN KEY (`user_offered_id`) REFERENCES `users` (`user_id`),
+  CONSTRAINT `transactions_ibfk_2` FOREIGN KEY (`user_offering_id`) REFERENCES `users` (`user_id`),
+  CONSTRAINT `transactions_ibfk_3` FOREIGN KEY (`listing_id`) REFERENCES `listings` (`listing_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,6 @@
+ALTER TABLE `transactions` DROP COLUMN `rating`;
+
+ALTER TABLE `users`
+  DROP COLUMN `phone_visibility`,
+  DROP COLUMN `birth_date_visibility`,
+  DROP COLUMN `location_visibility`;
@@ -0,0 +1,11 @@
+-- Per-field profile visibility and ratings left on completed transactions.
+-- Visibility is one of 'public', 'counterparties' (users sharing an Accepted
+-- transaction) or 'private'.
+
+ALTER TABLE `users`
+  ADD COLUMN `phone_visibility` enum('counterparties','private') NOT NULL DEFAULT 'counterparties',
+  ADD COLUMN `birth_date_visibility` enum('public','counterparties','private') NOT NULL DEFAULT 'private',
+  ADD COLUMN `location_visibility` enum('counterparties','private') NOT NULL DEFAULT 'counterparties';
+
+ALTER TABLE `transactions`
+  ADD COLUMN `rating` tinyint DEFAULT NULL;
@@ -0,0 +1,3 @@
+-- Closed accounts keep their row, anonymised, so transactions still reference them.
+
+ALTER TABLE `users` ADD COLUMN `deleted_at` timestamp NULL DEFAULT NULL;
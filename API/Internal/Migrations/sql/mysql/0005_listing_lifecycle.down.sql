@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS `notifications`;
+
+ALTER TABLE `listings`
+  DROP COLUMN `reminded_at`,
+  DROP COLUMN `expires_at`,
+  DROP COLUMN `status`;
@@ -0,0 +1,24 @@
+-- Listings move through draft, published, paused, expired and closed. Published
+-- listings expire at expires_at; reminded_at records the reminder sent before that.
+-- active is kept in step with the status for older clients.
+
+ALTER TABLE `listings`
+  ADD COLUMN `status` enum('draft','published','paused','expired','closed') NOT NULL DEFAULT 'published',
+  ADD COLUMN `expires_at` timestamp NULL DEFAULT NULL,
+  ADD COLUMN `reminded_at` timestamp NULL DEFAULT NULL;
+
+UPDATE `listings` SET `status` = 'closed' WHERE `active` = 0;
+UPDATE `listings` SET `expires_at` = DATE_ADD(`date_created`, INTERVAL 30 DAY) WHERE `status` = 'published';
+
+CREATE TABLE IF NOT EXISTS `notifications` (
+  `notification_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `kind` varchar(50) NOT NULL,
+  `message` varchar(500) NOT NULL,
+  `listing_id` int DEFAULT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `read_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`notification_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `notifications_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
@@ -0,0 +1,39 @@
+-- Listings gain a category. revision is bumped whenever a listing is edited and
+-- matched_revision records the revision the saved search matcher last looked at,
+-- so the matcher only evaluates new and updated listings.
+
+ALTER TABLE `listings`
+  ADD COLUMN `category` varchar(50) NOT NULL DEFAULT '',
+  ADD COLUMN `revision` int NOT NULL DEFAULT '1',
+  ADD COLUMN `matched_revision` int NOT NULL DEFAULT '0';
+
+UPDATE `listings` SET `matched_revision` = `revision`;
+
+CREATE TABLE IF NOT EXISTS `saved_searches` (
+  `search_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `type` varchar(10) NOT NULL DEFAULT '',
+  `query` varchar(255) NOT NULL DEFAULT '',
+  `category` varchar(50) NOT NULL DEFAULT '',
+  `longitude` double DEFAULT NULL,
+  `latitude` double DEFAULT NULL,
+  `max_distance` double NOT NULL DEFAULT '0',
+  `frequency` enum('instant','daily') NOT NULL DEFAULT 'instant',
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `last_digest_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`search_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `saved_searches_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
+
+-- Each listing matches a saved search at most once; notified_at is set once the owner was told
+CREATE TABLE IF NOT EXISTS `saved_search_matches` (
+  `search_id` int NOT NULL,
+  `listing_id` int NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `notified_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`search_id`, `listing_id`),
+  KEY `listing_id` (`listing_id`),
+  CONSTRAINT `saved_search_matches_ibfk_1` FOREIGN KEY (`search_id`) REFERENCES `saved_searches` (`search_id`) ON DELETE CASCADE
+);
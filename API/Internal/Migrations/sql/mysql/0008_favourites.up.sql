@@ -0,0 +1,27 @@
+-- Favourites and named shortlists. A row holds either a listing or a user; rows
+-- without a shortlist are the user's favourites. Rows outlive the listings they
+-- point at, so shortlists can tell the user what happened to them.
+
+CREATE TABLE IF NOT EXISTS `shortlists` (
+  `shortlist_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`shortlist_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `shortlists_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `favourites` (
+  `favourite_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `shortlist_id` int DEFAULT NULL,
+  `listing_id` int DEFAULT NULL,
+  `target_user_id` int DEFAULT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`favourite_id`),
+  KEY `user_id` (`user_id`),
+  KEY `listing_id` (`listing_id`),
+  CONSTRAINT `favourites_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`),
+  CONSTRAINT `favourites_ibfk_2` FOREIGN KEY (`shortlist_id`) REFERENCES `shortlists` (`shortlist_id`) ON DELETE CASCADE
+);
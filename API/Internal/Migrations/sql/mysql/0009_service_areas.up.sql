@@ -0,0 +1,16 @@
+-- Service areas are the polygons a user works in, drawn by hand or copied from a
+-- named district. Radius searches also return the offers of users whose area
+-- contains the searched point.
+
+CREATE TABLE IF NOT EXISTS `service_areas` (
+  `area_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `district` varchar(50) NOT NULL DEFAULT '',
+  `area` polygon NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`area_id`),
+  KEY `user_id` (`user_id`),
+  SPATIAL KEY `area` (`area`),
+  CONSTRAINT `service_areas_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
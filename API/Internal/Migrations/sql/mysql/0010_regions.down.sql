@@ -0,0 +1,9 @@
+ALTER TABLE `users`
+  DROP KEY `region_id`,
+  DROP COLUMN `region_id`;
+
+ALTER TABLE `listings`
+  DROP KEY `region_id`,
+  DROP COLUMN `region_id`;
+
+DROP TABLE IF EXISTS `regions`;
@@ -0,0 +1,26 @@
+-- The gazetteer: countries, governorates, districts and cities with English and
+-- Arabic names and boundary polygons, each inside its parent. Listings and users
+-- carry the most specific region containing their location.
+
+CREATE TABLE IF NOT EXISTS `regions` (
+  `region_id` int NOT NULL AUTO_INCREMENT,
+  `parent_id` int DEFAULT NULL,
+  `level` enum('country','governorate','district','city') NOT NULL,
+  `code` varchar(50) NOT NULL,
+  `name_en` varchar(100) NOT NULL,
+  `name_ar` varchar(100) NOT NULL,
+  `boundary` polygon NOT NULL,
+  PRIMARY KEY (`region_id`),
+  UNIQUE KEY `code` (`code`),
+  KEY `parent_id` (`parent_id`),
+  SPATIAL KEY `boundary` (`boundary`),
+  CONSTRAINT `regions_ibfk_1` FOREIGN KEY (`parent_id`) REFERENCES `regions` (`region_id`)
+);
+
+ALTER TABLE `listings`
+  ADD COLUMN `region_id` int DEFAULT NULL,
+  ADD KEY `region_id` (`region_id`);
+
+ALTER TABLE `users`
+  ADD COLUMN `region_id` int DEFAULT NULL,
+  ADD KEY `region_id` (`region_id`);
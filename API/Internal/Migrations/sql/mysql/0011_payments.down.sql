@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS `ledger_entries`;
+
+DROP TABLE IF EXISTS `payments`;
+
+-- The old schema has no status for cancelled transactions, so they are deleted
+UPDATE `transactions` SET `status` = 'Pending', `deleted_at` = COALESCE(`deleted_at`, CURRENT_TIMESTAMP) WHERE `status` = 'Cancelled';
+
+ALTER TABLE `transactions`
+  MODIFY COLUMN `status` enum('Pending','Accepted','Completed') NOT NULL DEFAULT 'Pending';
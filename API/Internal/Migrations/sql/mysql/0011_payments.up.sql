@@ -0,0 +1,43 @@
+-- Payments hold a transaction's price in escrow from acceptance until the job is
+-- completed, when it is released to the tradesman less the platform fee, or the
+-- transaction is cancelled, when it is refunded. Every movement of money is
+-- recorded in the ledger as entries that sum to zero. Payments and the ledger
+-- are kept when their transaction is purged.
+
+ALTER TABLE `transactions`
+  MODIFY COLUMN `status` enum('Pending','Accepted','Completed','Cancelled') NOT NULL DEFAULT 'Pending';
+
+CREATE TABLE IF NOT EXISTS `payments` (
+  `payment_id` int NOT NULL AUTO_INCREMENT,
+  `transaction_id` int NOT NULL,
+  `payer_id` int NOT NULL,
+  `payee_id` int NOT NULL,
+  `amount` double NOT NULL,
+  `fee` double NOT NULL,
+  `currency` varchar(10) NOT NULL,
+  `status` enum('held','released','refunded') NOT NULL DEFAULT 'held',
+  `provider` varchar(50) NOT NULL,
+  `reference` varchar(100) NOT NULL DEFAULT '',
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `date_settled` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`payment_id`),
+  UNIQUE KEY `transaction_id` (`transaction_id`),
+  KEY `payer_id` (`payer_id`),
+  KEY `payee_id` (`payee_id`),
+  CONSTRAINT `payments_ibfk_1` FOREIGN KEY (`payer_id`) REFERENCES `users` (`user_id`),
+  CONSTRAINT `payments_ibfk_2` FOREIGN KEY (`payee_id`) REFERENCES `users` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `ledger_entries` (
+  `entry_id` int NOT NULL AUTO_INCREMENT,
+  `payment_id` int NOT NULL,
+  `movement` enum('hold','release','refund') NOT NULL,
+  `account` varchar(50) NOT NULL,
+  `amount` double NOT NULL,
+  `currency` varchar(10) NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`entry_id`),
+  KEY `payment_id` (`payment_id`),
+  KEY `account` (`account`),
+  CONSTRAINT `ledger_entries_ibfk_1` FOREIGN KEY (`payment_id`) REFERENCES `payments` (`payment_id`)
+);
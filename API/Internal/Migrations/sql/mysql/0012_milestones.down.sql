@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS `milestone_evidence`;
+
+DROP TABLE IF EXISTS `milestones`;
+
+-- The old schema only releases deposits in full, so partly released ones must be settled first
+ALTER TABLE `payments` DROP COLUMN `released`;
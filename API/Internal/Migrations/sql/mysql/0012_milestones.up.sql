@@ -0,0 +1,33 @@
+-- Milestones split a transaction's price into parts with their own due dates. The
+-- tradesman marks each done with photos as evidence, and the client's approval releases
+-- its amount from escrow. Payments track how much has been released so far.
+
+ALTER TABLE `payments` ADD COLUMN `released` double NOT NULL DEFAULT 0 AFTER `fee`;
+
+UPDATE `payments` SET `released` = `amount` WHERE `status` = 'released';
+
+CREATE TABLE IF NOT EXISTS `milestones` (
+  `milestone_id` int NOT NULL AUTO_INCREMENT,
+  `transaction_id` int NOT NULL,
+  `position` int NOT NULL,
+  `description` varchar(500) NOT NULL,
+  `amount` double NOT NULL,
+  `due_date` date NOT NULL,
+  `status` enum('Pending','Done','Approved') NOT NULL DEFAULT 'Pending',
+  `date_done` timestamp NULL DEFAULT NULL,
+  `date_approved` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`milestone_id`),
+  KEY `transaction_id` (`transaction_id`),
+  CONSTRAINT `milestones_ibfk_1` FOREIGN KEY (`transaction_id`) REFERENCES `transactions` (`transaction_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `milestone_evidence` (
+  `evidence_id` int NOT NULL AUTO_INCREMENT,
+  `milestone_id` int NOT NULL,
+  `url` varchar(255) NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`evidence_id`),
+  UNIQUE KEY `url` (`url`),
+  KEY `milestone_id` (`milestone_id`),
+  CONSTRAINT `milestone_evidence_ibfk_1` FOREIGN KEY (`milestone_id`) REFERENCES `milestones` (`milestone_id`)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `invoice_items`;
+
+DROP TABLE IF EXISTS `invoices`;
@@ -0,0 +1,40 @@
+-- Invoices are issued for Completed transactions and numbered per tradesman. They copy
+-- the names, items and amounts they print, and are kept when their transaction is purged.
+
+CREATE TABLE IF NOT EXISTS `invoices` (
+  `invoice_id` int NOT NULL AUTO_INCREMENT,
+  `transaction_id` int NOT NULL,
+  `tradesman_id` int NOT NULL,
+  `client_id` int NOT NULL,
+  `number` int NOT NULL,
+  `tradesman_name` varchar(255) NOT NULL,
+  `client_name` varchar(255) NOT NULL,
+  `listing_title` varchar(255) NOT NULL,
+  `currency` varchar(10) NOT NULL,
+  `subtotal` double NOT NULL,
+  `tax_country` varchar(100) NOT NULL DEFAULT '',
+  `tax_rate` double NOT NULL DEFAULT 0,
+  `tax` double NOT NULL DEFAULT 0,
+  `total` double NOT NULL,
+  `platform_fee` double NOT NULL DEFAULT 0,
+  `payout` double NOT NULL,
+  `date_paid` timestamp NULL DEFAULT NULL,
+  `date_issued` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`invoice_id`),
+  UNIQUE KEY `transaction_id` (`transaction_id`),
+  UNIQUE KEY `tradesman_number` (`tradesman_id`, `number`),
+  KEY `client_id` (`client_id`),
+  CONSTRAINT `invoices_ibfk_1` FOREIGN KEY (`tradesman_id`) REFERENCES `users` (`user_id`),
+  CONSTRAINT `invoices_ibfk_2` FOREIGN KEY (`client_id`) REFERENCES `users` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `invoice_items` (
+  `item_id` int NOT NULL AUTO_INCREMENT,
+  `invoice_id` int NOT NULL,
+  `position` int NOT NULL,
+  `description` varchar(500) NOT NULL,
+  `amount` double NOT NULL,
+  PRIMARY KEY (`item_id`),
+  KEY `invoice_id` (`invoice_id`),
+  CONSTRAINT `invoice_items_ibfk_1` FOREIGN KEY (`invoice_id`) REFERENCES `invoices` (`invoice_id`)
+);
@@ -0,0 +1,120 @@
+-- Blank currency codes are left as USD, which they meant
+
+ALTER TABLE `listings`
+  ADD COLUMN `price` double DEFAULT NULL AFTER `category`;
+
+UPDATE `listings` SET
+  `price` = `price_minor` * 1.0 / CASE WHEN `currency` IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN `currency` IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END
+  WHERE `price_minor` IS NOT NULL;
+
+ALTER TABLE `listings`
+  DROP COLUMN `currency`,
+  DROP COLUMN `price_minor`;
+
+DROP TABLE IF EXISTS `transaction_rates`;
+
+DROP TABLE IF EXISTS `exchange_rates`;
+
+ALTER TABLE `users` DROP COLUMN `preferred_currency`;
+
+-- The minor units in a major unit of the currencies that do not have 100 of them. The
+-- conversions below join it and it is dropped once they are done.
+CREATE TABLE IF NOT EXISTS `currency_factors` (
+  `currency` varchar(3) NOT NULL,
+  `factor` int NOT NULL,
+  PRIMARY KEY (`currency`)
+);
+
+INSERT IGNORE INTO `currency_factors` (`currency`, `factor`) VALUES
+  ('BIF', 1), ('CLP', 1), ('DJF', 1), ('GNF', 1), ('ISK', 1), ('JPY', 1), ('KMF', 1), ('KRW', 1),
+  ('PYG', 1), ('RWF', 1), ('UGX', 1), ('VND', 1), ('VUV', 1), ('XAF', 1), ('XOF', 1), ('XPF', 1),
+  ('BHD', 1000), ('IQD', 1000), ('JOD', 1000), ('KWD', 1000), ('LYD', 1000), ('OMR', 1000), ('TND', 1000);
+
+ALTER TABLE `transactions`
+  ADD COLUMN `price` double NOT NULL DEFAULT 0 AFTER `listing_id`;
+
+UPDATE `transactions`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `transactions`.`currency`
+SET
+  `transactions`.`price` = `transactions`.`price_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100);
+
+ALTER TABLE `transactions`
+  DROP COLUMN `price_minor`;
+
+ALTER TABLE `payments`
+  ADD COLUMN `amount` double NOT NULL DEFAULT 0 AFTER `payee_id`,
+  ADD COLUMN `fee` double NOT NULL DEFAULT 0 AFTER `amount`,
+  ADD COLUMN `released` double NOT NULL DEFAULT 0 AFTER `fee`;
+
+UPDATE `payments`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `payments`.`currency`
+SET
+  `payments`.`amount` = `payments`.`amount_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100),
+  `payments`.`fee` = `payments`.`fee_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100),
+  `payments`.`released` = `payments`.`released_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100);
+
+ALTER TABLE `payments`
+  DROP COLUMN `amount_minor`,
+  DROP COLUMN `fee_minor`,
+  DROP COLUMN `released_minor`;
+
+ALTER TABLE `ledger_entries`
+  ADD COLUMN `amount` double NOT NULL DEFAULT 0 AFTER `account`;
+
+UPDATE `ledger_entries`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `ledger_entries`.`currency`
+SET
+  `ledger_entries`.`amount` = `ledger_entries`.`amount_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100);
+
+ALTER TABLE `ledger_entries`
+  DROP COLUMN `amount_minor`;
+
+ALTER TABLE `milestones`
+  ADD COLUMN `amount` double NOT NULL DEFAULT 0 AFTER `description`;
+
+UPDATE `milestones`
+  JOIN `transactions` ON `transactions`.`transaction_id` = `milestones`.`transaction_id`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `transactions`.`currency`
+SET
+  `milestones`.`amount` = `milestones`.`amount_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100);
+
+ALTER TABLE `milestones`
+  DROP COLUMN `amount_minor`;
+
+ALTER TABLE `invoices`
+  ADD COLUMN `subtotal` double NOT NULL DEFAULT 0 AFTER `currency`,
+  ADD COLUMN `tax` double NOT NULL DEFAULT 0 AFTER `subtotal`,
+  ADD COLUMN `total` double NOT NULL DEFAULT 0 AFTER `tax`,
+  ADD COLUMN `platform_fee` double NOT NULL DEFAULT 0 AFTER `total`,
+  ADD COLUMN `payout` double NOT NULL DEFAULT 0 AFTER `platform_fee`;
+
+UPDATE `invoices`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `invoices`.`currency`
+SET
+  `invoices`.`subtotal` = `invoices`.`subtotal_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100),
+  `invoices`.`tax` = `invoices`.`tax_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100),
+  `invoices`.`total` = `invoices`.`total_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100),
+  `invoices`.`platform_fee` = `invoices`.`platform_fee_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100),
+  `invoices`.`payout` = `invoices`.`payout_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100);
+
+ALTER TABLE `invoices`
+  DROP COLUMN `subtotal_minor`,
+  DROP COLUMN `tax_minor`,
+  DROP COLUMN `total_minor`,
+  DROP COLUMN `platform_fee_minor`,
+  DROP COLUMN `payout_minor`;
+
+ALTER TABLE `invoice_items`
+  ADD COLUMN `amount` double NOT NULL DEFAULT 0 AFTER `description`;
+
+UPDATE `invoice_items`
+  JOIN `invoices` ON `invoices`.`invoice_id` = `invoice_items`.`invoice_id`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `invoices`.`currency`
+SET
+  `invoice_items`.`amount` = `invoice_items`.`amount_minor` * 1.0 / COALESCE(`currency_factors`.`factor`, 100);
+
+ALTER TABLE `invoice_items`
+  DROP COLUMN `amount_minor`;
+
+DROP TABLE IF EXISTS `currency_factors`;
@@ -0,0 +1,154 @@
+-- Money is stored in the minor units of its ISO 4217 currency, cents for USD and piastres
+-- for LBP, so amounts add up exactly. Currency codes are upper-cased, blank ones meaning
+-- USD as before. Users may prefer a currency to see amounts in, and the exchange rates
+-- set by admins or quoted by the provider are recorded on each transaction when it is
+-- accepted. Listing prices become money too, those set so far having been meant
+-- as USD, while NULL still means the listing does not say.
+
+UPDATE `transactions` SET `currency` = UPPER(TRIM(`currency`));
+UPDATE `transactions` SET `currency` = 'USD' WHERE `currency` = '';
+
+UPDATE `payments` SET `currency` = UPPER(TRIM(`currency`));
+UPDATE `payments` SET `currency` = 'USD' WHERE `currency` = '';
+
+UPDATE `ledger_entries` SET `currency` = UPPER(TRIM(`currency`));
+UPDATE `ledger_entries` SET `currency` = 'USD' WHERE `currency` = '';
+
+UPDATE `invoices` SET `currency` = UPPER(TRIM(`currency`));
+UPDATE `invoices` SET `currency` = 'USD' WHERE `currency` = '';
+
+-- The minor units in a major unit of the currencies that do not have 100 of them. The
+-- conversions below join it and it is dropped once they are done.
+CREATE TABLE IF NOT EXISTS `currency_factors` (
+  `currency` varchar(3) NOT NULL,
+  `factor` int NOT NULL,
+  PRIMARY KEY (`currency`)
+);
+
+INSERT IGNORE INTO `currency_factors` (`currency`, `factor`) VALUES
+  ('BIF', 1), ('CLP', 1), ('DJF', 1), ('GNF', 1), ('ISK', 1), ('JPY', 1), ('KMF', 1), ('KRW', 1),
+  ('PYG', 1), ('RWF', 1), ('UGX', 1), ('VND', 1), ('VUV', 1), ('XAF', 1), ('XOF', 1), ('XPF', 1),
+  ('BHD', 1000), ('IQD', 1000), ('JOD', 1000), ('KWD', 1000), ('LYD', 1000), ('OMR', 1000), ('TND', 1000);
+
+ALTER TABLE `transactions`
+  ADD COLUMN `price_minor` bigint NOT NULL DEFAULT 0 AFTER `listing_id`;
+
+UPDATE `transactions`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `transactions`.`currency`
+SET
+  `transactions`.`price_minor` = ROUND(`transactions`.`price` * COALESCE(`currency_factors`.`factor`, 100));
+
+ALTER TABLE `transactions`
+  DROP COLUMN `price`;
+
+ALTER TABLE `payments`
+  ADD COLUMN `amount_minor` bigint NOT NULL DEFAULT 0 AFTER `payee_id`,
+  ADD COLUMN `fee_minor` bigint NOT NULL DEFAULT 0 AFTER `amount_minor`,
+  ADD COLUMN `released_minor` bigint NOT NULL DEFAULT 0 AFTER `fee_minor`;
+
+UPDATE `payments`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `payments`.`currency`
+SET
+  `payments`.`amount_minor` = ROUND(`payments`.`amount` * COALESCE(`currency_factors`.`factor`, 100)),
+  `payments`.`fee_minor` = ROUND(`payments`.`fee` * COALESCE(`currency_factors`.`factor`, 100)),
+  `payments`.`released_minor` = ROUND(`payments`.`released` * COALESCE(`currency_factors`.`factor`, 100));
+
+ALTER TABLE `payments`
+  DROP COLUMN `amount`,
+  DROP COLUMN `fee`,
+  DROP COLUMN `released`;
+
+ALTER TABLE `ledger_entries`
+  ADD COLUMN `amount_minor` bigint NOT NULL DEFAULT 0 AFTER `account`;
+
+UPDATE `ledger_entries`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `ledger_entries`.`currency`
+SET
+  `ledger_entries`.`amount_minor` = ROUND(`ledger_entries`.`amount` * COALESCE(`currency_factors`.`factor`, 100));
+
+ALTER TABLE `ledger_entries`
+  DROP COLUMN `amount`;
+
+ALTER TABLE `milestones`
+  ADD COLUMN `amount_minor` bigint NOT NULL DEFAULT 0 AFTER `description`;
+
+UPDATE `milestones`
+  JOIN `transactions` ON `transactions`.`transaction_id` = `milestones`.`transaction_id`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `transactions`.`currency`
+SET
+  `milestones`.`amount_minor` = ROUND(`milestones`.`amount` * COALESCE(`currency_factors`.`factor`, 100));
+
+ALTER TABLE `milestones`
+  DROP COLUMN `amount`;
+
+ALTER TABLE `invoices`
+  ADD COLUMN `subtotal_minor` bigint NOT NULL DEFAULT 0 AFTER `currency`,
+  ADD COLUMN `tax_minor` bigint NOT NULL DEFAULT 0 AFTER `subtotal_minor`,
+  ADD COLUMN `total_minor` bigint NOT NULL DEFAULT 0 AFTER `tax_minor`,
+  ADD COLUMN `platform_fee_minor` bigint NOT NULL DEFAULT 0 AFTER `total_minor`,
+  ADD COLUMN `payout_minor` bigint NOT NULL DEFAULT 0 AFTER `platform_fee_minor`;
+
+UPDATE `invoices`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `invoices`.`currency`
+SET
+  `invoices`.`subtotal_minor` = ROUND(`invoices`.`subtotal` * COALESCE(`currency_factors`.`factor`, 100)),
+  `invoices`.`tax_minor` = ROUND(`invoices`.`tax` * COALESCE(`currency_factors`.`factor`, 100)),
+  `invoices`.`total_minor` = ROUND(`invoices`.`total` * COALESCE(`currency_factors`.`factor`, 100)),
+  `invoices`.`platform_fee_minor` = ROUND(`invoices`.`platform_fee` * COALESCE(`currency_factors`.`factor`, 100)),
+  `invoices`.`payout_minor` = ROUND(`invoices`.`payout` * COALESCE(`currency_factors`.`factor`, 100));
+
+ALTER TABLE `invoices`
+  DROP COLUMN `subtotal`,
+  DROP COLUMN `tax`,
+  DROP COLUMN `total`,
+  DROP COLUMN `platform_fee`,
+  DROP COLUMN `payout`;
+
+ALTER TABLE `invoice_items`
+  ADD COLUMN `amount_minor` bigint NOT NULL DEFAULT 0 AFTER `description`;
+
+UPDATE `invoice_items`
+  JOIN `invoices` ON `invoices`.`invoice_id` = `invoice_items`.`invoice_id`
+  LEFT JOIN `currency_factors` ON `currency_factors`.`currency` = `invoices`.`currency`
+SET
+  `invoice_items`.`amount_minor` = ROUND(`invoice_items`.`amount` * COALESCE(`currency_factors`.`factor`, 100));
+
+ALTER TABLE `invoice_items`
+  DROP COLUMN `amount`;
+
+DROP TABLE IF EXISTS `currency_factors`;
+
+ALTER TABLE `users` ADD COLUMN `preferred_currency` varchar(3) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `exchange_rates` (
+  `currency_from` varchar(3) NOT NULL,
+  `currency_to` varchar(3) NOT NULL,
+  `rate` double NOT NULL,
+  `set_by` int NOT NULL,
+  `date_set` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`currency_from`, `currency_to`),
+  KEY `set_by` (`set_by`),
+  CONSTRAINT `exchange_rates_ibfk_1` FOREIGN KEY (`set_by`) REFERENCES `users` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `transaction_rates` (
+  `transaction_id` int NOT NULL,
+  `currency_from` varchar(3) NOT NULL,
+  `currency_to` varchar(3) NOT NULL,
+  `rate` double NOT NULL,
+  `source` varchar(50) NOT NULL,
+  `date_quoted` timestamp NOT NULL,
+  PRIMARY KEY (`transaction_id`, `currency_to`),
+  CONSTRAINT `transaction_rates_ibfk_1` FOREIGN KEY (`transaction_id`) REFERENCES `transactions` (`transaction_id`)
+);
+
+-- Listing prices, in USD until now
+
+ALTER TABLE `listings`
+  ADD COLUMN `price_minor` bigint DEFAULT NULL AFTER `category`,
+  ADD COLUMN `currency` varchar(3) NOT NULL DEFAULT 'USD' AFTER `price_minor`;
+
+UPDATE `listings` SET `price_minor` = ROUND(`price` * 100) WHERE `price` IS NOT NULL;
+
+ALTER TABLE `listings`
+  DROP COLUMN `price`;
@@ -0,0 +1,27 @@
+-- Users without a row are on the free plan. Paid plans are charged for each period in
+-- advance, and a cheaper next_plan, possibly free, takes over when the period ends.
+-- subscription_charges keeps what was charged through the payment provider.
+
+CREATE TABLE IF NOT EXISTS `subscriptions` (
+  `user_id` int NOT NULL,
+  `plan` varchar(20) NOT NULL,
+  `next_plan` varchar(20) NOT NULL DEFAULT '',
+  `period_start` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `period_end` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`user_id`),
+  CONSTRAINT `subscriptions_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `subscription_charges` (
+  `charge_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `plan` varchar(20) NOT NULL,
+  `amount_minor` bigint NOT NULL,
+  `currency` varchar(3) NOT NULL,
+  `provider` varchar(50) NOT NULL,
+  `reference` varchar(100) NOT NULL DEFAULT '',
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`charge_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `subscription_charges_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
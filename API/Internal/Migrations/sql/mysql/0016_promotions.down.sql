@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `promotion_days`;
+
+DROP TABLE IF EXISTS `promotions`;
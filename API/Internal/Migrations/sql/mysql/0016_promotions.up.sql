@@ -0,0 +1,41 @@
+-- Promotions pay for a listing to be shown in promoted slots of search results,
+-- optionally only in a region or for a category. The whole budget is held through
+-- the payment provider when a promotion is bought; when it ends or is cancelled,
+-- what it spent goes to the platform and the rest is refunded. promotion_days
+-- counts the impressions, clicks and spend of each day a promotion was shown.
+-- Promotions are kept when their listing is purged.
+
+CREATE TABLE IF NOT EXISTS `promotions` (
+  `promotion_id` int NOT NULL AUTO_INCREMENT,
+  `listing_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `region_id` int DEFAULT NULL,
+  `category` varchar(50) NOT NULL DEFAULT '',
+  `start_date` date NOT NULL,
+  `end_date` date NOT NULL,
+  `daily_budget_minor` bigint NOT NULL,
+  `budget_minor` bigint NOT NULL,
+  `currency` varchar(3) NOT NULL,
+  `status` enum('active','cancelled','ended') NOT NULL DEFAULT 'active',
+  `provider` varchar(50) NOT NULL,
+  `reference` varchar(100) NOT NULL DEFAULT '',
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `date_settled` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`promotion_id`),
+  KEY `listing_id` (`listing_id`),
+  KEY `user_id` (`user_id`),
+  KEY `region_id` (`region_id`),
+  KEY `status` (`status`),
+  CONSTRAINT `promotions_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`),
+  CONSTRAINT `promotions_ibfk_2` FOREIGN KEY (`region_id`) REFERENCES `regions` (`region_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `promotion_days` (
+  `promotion_id` int NOT NULL,
+  `day` date NOT NULL,
+  `impressions` int NOT NULL DEFAULT 0,
+  `clicks` int NOT NULL DEFAULT 0,
+  `spent_minor` bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (`promotion_id`, `day`),
+  CONSTRAINT `promotion_days_ibfk_1` FOREIGN KEY (`promotion_id`) REFERENCES `promotions` (`promotion_id`)
+);
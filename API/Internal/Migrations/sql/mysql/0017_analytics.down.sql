@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `analytics_daily`;
+
+DROP TABLE IF EXISTS `analytics_events`;
@@ -0,0 +1,23 @@
+-- Analytics events, such as listing views and search impressions, are buffered by the
+-- API and written in batches. A daily job counts the events of past days into
+-- analytics_daily and deletes them. listing_id is 0 for events on a profile, and
+-- both tables are kept when listings are purged.
+
+CREATE TABLE IF NOT EXISTS `analytics_events` (
+  `event_id` int NOT NULL AUTO_INCREMENT,
+  `kind` varchar(20) NOT NULL,
+  `user_id` int NOT NULL,
+  `listing_id` int NOT NULL DEFAULT 0,
+  `day` date NOT NULL,
+  PRIMARY KEY (`event_id`),
+  KEY `user_id` (`user_id`, `day`)
+);
+
+CREATE TABLE IF NOT EXISTS `analytics_daily` (
+  `user_id` int NOT NULL,
+  `listing_id` int NOT NULL DEFAULT 0,
+  `day` date NOT NULL,
+  `kind` varchar(20) NOT NULL,
+  `count` int NOT NULL,
+  PRIMARY KEY (`user_id`, `day`, `listing_id`, `kind`)
+);
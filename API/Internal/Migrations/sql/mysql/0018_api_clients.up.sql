@@ -0,0 +1,31 @@
+-- API clients let third parties call the public read-only API with a key instead of a
+-- user token. Only a SHA-256 hash of each key is stored, with a short prefix to tell
+-- keys apart; the key itself is shown once when it is issued. scopes lists the parts
+-- of the public API a client may call, comma separated. api_usage meters the requests
+-- of each client by day, those served and those refused over its daily quota.
+
+CREATE TABLE IF NOT EXISTS `api_clients` (
+  `client_id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(100) NOT NULL,
+  `scopes` varchar(255) NOT NULL,
+  `key_prefix` varchar(16) NOT NULL,
+  `key_hash` char(64) NOT NULL,
+  `rate_limit` int NOT NULL,
+  `daily_quota` int NOT NULL,
+  `date_created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `revoked_at` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`client_id`),
+  UNIQUE KEY `key_hash` (`key_hash`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `api_clients_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`user_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `api_usage` (
+  `client_id` int NOT NULL,
+  `day` date NOT NULL,
+  `requests` int NOT NULL DEFAULT 0,
+  `rejected` int NOT NULL DEFAULT 0,
+  PRIMARY KEY (`client_id`, `day`),
+  CONSTRAINT `api_usage_ibfk_1` FOREIGN KEY (`client_id`) REFERENCES `api_clients` (`client_id`)
+);
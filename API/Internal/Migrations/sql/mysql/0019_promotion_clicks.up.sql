@@ -0,0 +1,13 @@
+-- Clicks on promoted listings need a single-use token handed out with the impression.
+-- Tokens are signed, so only their nonce is kept once used, with the day the listing
+-- was shown. Tokens only work on that day, so the rows of past days are deleted when
+-- promotions are settled.
+
+CREATE TABLE IF NOT EXISTS `promotion_clicks` (
+  `nonce` char(32) NOT NULL,
+  `promotion_id` int NOT NULL,
+  `day` date NOT NULL,
+  PRIMARY KEY (`nonce`),
+  KEY `day` (`day`),
+  CONSTRAINT `promotion_clicks_ibfk_1` FOREIGN KEY (`promotion_id`) REFERENCES `promotions` (`promotion_id`)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS images;
+DROP TABLE IF EXISTS listings;
+DROP TABLE IF EXISTS users;
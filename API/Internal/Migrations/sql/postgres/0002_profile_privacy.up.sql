@@ -0,0 +1,9 @@
+-- Per-field profile visibility and ratings left on completed transactions.
+
+ALTER TABLE users
+  ADD COLUMN phone_visibility varchar(15) NOT NULL DEFAULT 'counterparties' CHECK (phone_visibility IN ('counterparties', 'private')),
+  ADD COLUMN birth_date_visibility varchar(15) NOT NULL DEFAULT 'private' CHECK (birth_date_visibility IN ('public', 'counterparties', 'private')),
+  ADD COLUMN location_visibility varchar(15) NOT NULL DEFAULT 'counterparties' CHECK (location_visibility IN ('counterparties', 'private'));
+
+ALTER TABLE transactions
+  ADD COLUMN rating smallint CHECK (rating BETWEEN 1 AND 5);
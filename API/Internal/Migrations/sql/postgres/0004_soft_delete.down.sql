@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN role;
+
+ALTER TABLE transactions DROP COLUMN deleted_at;
+
+ALTER TABLE listings DROP COLUMN deleted_at;
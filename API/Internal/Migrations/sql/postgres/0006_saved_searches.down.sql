@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS saved_search_matches;
+DROP TABLE IF EXISTS saved_searches;
+
+ALTER TABLE listings
+  DROP COLUMN matched_revision,
+  DROP COLUMN revision,
+  DROP COLUMN category;
@@ -0,0 +1,24 @@
+-- Favourites and named shortlists. A row holds either a listing or a user; rows
+-- without a shortlist are the user's favourites. Rows outlive the listings they
+-- point at, so shortlists can tell the user what happened to them.
+
+CREATE TABLE IF NOT EXISTS shortlists (
+  shortlist_id serial PRIMARY KEY,
+  user_id int NOT NULL REFERENCES users (user_id),
+  name varchar(100) NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS shortlists_user_id_idx ON shortlists (user_id);
+
+CREATE TABLE IF NOT EXISTS favourites (
+  favourite_id serial PRIMARY KEY,
+  user_id int NOT NULL REFERENCES users (user_id),
+  shortlist_id int REFERENCES shortlists (shortlist_id) ON DELETE CASCADE,
+  listing_id int,
+  target_user_id int,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS favourites_user_id_idx ON favourites (user_id);
+CREATE INDEX IF NOT EXISTS favourites_listing_id_idx ON favourites (listing_id);
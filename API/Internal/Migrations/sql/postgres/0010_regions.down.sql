@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN region_id;
+
+ALTER TABLE listings DROP COLUMN region_id;
+
+DROP TABLE IF EXISTS regions;
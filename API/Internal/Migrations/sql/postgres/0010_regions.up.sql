@@ -0,0 +1,22 @@
+-- The gazetteer: countries, governorates, districts and cities with English and
+-- Arabic names and boundary polygons, each inside its parent. Listings and users
+-- carry the most specific region containing their location.
+
+CREATE TABLE IF NOT EXISTS regions (
+  region_id serial PRIMARY KEY,
+  parent_id int REFERENCES regions (region_id),
+  level varchar(12) NOT NULL CHECK (level IN ('country', 'governorate', 'district', 'city')),
+  code varchar(50) NOT NULL UNIQUE,
+  name_en varchar(100) NOT NULL,
+  name_ar varchar(100) NOT NULL,
+  boundary geometry(Polygon, 4326) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS regions_parent_id_idx ON regions (parent_id);
+CREATE INDEX IF NOT EXISTS regions_boundary_idx ON regions USING GIST (boundary);
+
+ALTER TABLE listings ADD COLUMN region_id int;
+CREATE INDEX IF NOT EXISTS listings_region_id_idx ON listings (region_id);
+
+ALTER TABLE users ADD COLUMN region_id int;
+CREATE INDEX IF NOT EXISTS users_region_id_idx ON users (region_id);
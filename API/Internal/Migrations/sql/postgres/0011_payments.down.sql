@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS ledger_entries;
+
+DROP TABLE IF EXISTS payments;
+
+-- The old schema has no status for cancelled transactions, so they are deleted
+UPDATE transactions SET status = 'Pending', deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP) WHERE status = 'Cancelled';
+
+ALTER TABLE transactions
+  DROP CONSTRAINT IF EXISTS transactions_status_check,
+  ADD CONSTRAINT transactions_status_check CHECK (status IN ('Pending', 'Accepted', 'Completed'));
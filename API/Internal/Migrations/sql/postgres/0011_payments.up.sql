@@ -0,0 +1,40 @@
+-- Payments hold a transaction's price in escrow from acceptance until the job is
+-- completed, when it is released to the tradesman less the platform fee, or the
+-- transaction is cancelled, when it is refunded. Every movement of money is
+-- recorded in the ledger as entries that sum to zero. Payments and the ledger
+-- are kept when their transaction is purged.
+
+ALTER TABLE transactions
+  DROP CONSTRAINT IF EXISTS transactions_status_check,
+  ADD CONSTRAINT transactions_status_check CHECK (status IN ('Pending', 'Accepted', 'Completed', 'Cancelled'));
+
+CREATE TABLE IF NOT EXISTS payments (
+  payment_id serial PRIMARY KEY,
+  transaction_id int NOT NULL UNIQUE,
+  payer_id int NOT NULL REFERENCES users (user_id),
+  payee_id int NOT NULL REFERENCES users (user_id),
+  amount double precision NOT NULL,
+  fee double precision NOT NULL,
+  currency varchar(10) NOT NULL,
+  status varchar(10) NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'released', 'refunded')),
+  provider varchar(50) NOT NULL,
+  reference varchar(100) NOT NULL DEFAULT '',
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  date_settled timestamp
+);
+
+CREATE INDEX IF NOT EXISTS payments_payer_id_idx ON payments (payer_id);
+CREATE INDEX IF NOT EXISTS payments_payee_id_idx ON payments (payee_id);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  entry_id serial PRIMARY KEY,
+  payment_id int NOT NULL REFERENCES payments (payment_id),
+  movement varchar(10) NOT NULL CHECK (movement IN ('hold', 'release', 'refund')),
+  account varchar(50) NOT NULL,
+  amount double precision NOT NULL,
+  currency varchar(10) NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_payment_id_idx ON ledger_entries (payment_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_account_idx ON ledger_entries (account);
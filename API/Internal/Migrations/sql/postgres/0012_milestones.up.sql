@@ -0,0 +1,30 @@
+-- Milestones split a transaction's price into parts with their own due dates. The
+-- tradesman marks each done with photos as evidence, and the client's approval releases
+-- its amount from escrow. Payments track how much has been released so far.
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS released double precision NOT NULL DEFAULT 0;
+
+UPDATE payments SET released = amount WHERE status = 'released';
+
+CREATE TABLE IF NOT EXISTS milestones (
+  milestone_id serial PRIMARY KEY,
+  transaction_id int NOT NULL REFERENCES transactions (transaction_id),
+  position int NOT NULL,
+  description varchar(500) NOT NULL,
+  amount double precision NOT NULL,
+  due_date date NOT NULL,
+  status varchar(10) NOT NULL DEFAULT 'Pending' CHECK (status IN ('Pending', 'Done', 'Approved')),
+  date_done timestamp,
+  date_approved timestamp
+);
+
+CREATE INDEX IF NOT EXISTS milestones_transaction_id_idx ON milestones (transaction_id);
+
+CREATE TABLE IF NOT EXISTS milestone_evidence (
+  evidence_id serial PRIMARY KEY,
+  milestone_id int NOT NULL REFERENCES milestones (milestone_id),
+  url varchar(255) NOT NULL UNIQUE,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS milestone_evidence_milestone_id_idx ON milestone_evidence (milestone_id);
@@ -0,0 +1,103 @@
+-- Blank currency codes are left as USD, which they meant
+
+ALTER TABLE listings
+  ADD COLUMN price double precision;
+
+UPDATE listings SET
+  price = CAST(price_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END
+  WHERE price_minor IS NOT NULL;
+
+ALTER TABLE listings
+  DROP COLUMN currency,
+  DROP COLUMN price_minor;
+
+DROP TABLE IF EXISTS transaction_rates;
+
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE users DROP COLUMN preferred_currency;
+
+ALTER TABLE transactions
+  ADD COLUMN price double precision NOT NULL DEFAULT 0;
+
+UPDATE transactions SET
+  price = CAST(price_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE transactions
+  DROP COLUMN price_minor;
+
+ALTER TABLE payments
+  ADD COLUMN amount double precision NOT NULL DEFAULT 0,
+  ADD COLUMN fee double precision NOT NULL DEFAULT 0,
+  ADD COLUMN released double precision NOT NULL DEFAULT 0;
+
+UPDATE payments SET
+  amount = CAST(amount_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  fee = CAST(fee_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  released = CAST(released_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE payments
+  DROP COLUMN amount_minor,
+  DROP COLUMN fee_minor,
+  DROP COLUMN released_minor;
+
+ALTER TABLE ledger_entries
+  ADD COLUMN amount double precision NOT NULL DEFAULT 0;
+
+UPDATE ledger_entries SET
+  amount = CAST(amount_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE ledger_entries
+  DROP COLUMN amount_minor;
+
+ALTER TABLE milestones
+  ADD COLUMN amount double precision NOT NULL DEFAULT 0;
+
+UPDATE milestones SET
+  amount = CAST(amount_minor AS double precision) / CASE WHEN (SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN (SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE milestones
+  DROP COLUMN amount_minor;
+
+ALTER TABLE invoices
+  ADD COLUMN subtotal double precision NOT NULL DEFAULT 0,
+  ADD COLUMN tax double precision NOT NULL DEFAULT 0,
+  ADD COLUMN total double precision NOT NULL DEFAULT 0,
+  ADD COLUMN platform_fee double precision NOT NULL DEFAULT 0,
+  ADD COLUMN payout double precision NOT NULL DEFAULT 0;
+
+UPDATE invoices SET
+  subtotal = CAST(subtotal_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  tax = CAST(tax_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  total = CAST(total_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  platform_fee = CAST(platform_fee_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  payout = CAST(payout_minor AS double precision) / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE invoices
+  DROP COLUMN subtotal_minor,
+  DROP COLUMN tax_minor,
+  DROP COLUMN total_minor,
+  DROP COLUMN platform_fee_minor,
+  DROP COLUMN payout_minor;
+
+ALTER TABLE invoice_items
+  ADD COLUMN amount double precision NOT NULL DEFAULT 0;
+
+UPDATE invoice_items SET
+  amount = CAST(amount_minor AS double precision) / CASE WHEN (SELECT currency FROM invoices WHERE invoices.invoice_id = invoice_items.invoice_id) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN (SELECT currency FROM invoices WHERE invoices.invoice_id = invoice_items.invoice_id) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE invoice_items
+  DROP COLUMN amount_minor;
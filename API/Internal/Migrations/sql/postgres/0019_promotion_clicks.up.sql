@@ -0,0 +1,12 @@
+-- Clicks on promoted listings need a single-use token handed out with the impression.
+-- Tokens are signed, so only their nonce is kept once used, with the day the listing
+-- was shown. Tokens only work on that day, so the rows of past days are deleted when
+-- promotions are settled.
+
+CREATE TABLE IF NOT EXISTS promotion_clicks (
+  nonce char(32) PRIMARY KEY,
+  promotion_id int NOT NULL REFERENCES promotions (promotion_id),
+  day date NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS promotion_clicks_day_idx ON promotion_clicks (day);
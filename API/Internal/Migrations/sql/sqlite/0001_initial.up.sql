@@ -0,0 +1,63 @@
+-- Initial schema for SQLite. Points are stored as WKB blobs and
+-- enums as CHECK constraints; distances are computed by the API.
+
+CREATE TABLE IF NOT EXISTS users (
+  user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  first_name varchar(50) NOT NULL,
+  last_name varchar(50) NOT NULL,
+  phone_number varchar(20) NOT NULL,
+  date_of_birth date NOT NULL,
+  profession varchar(100) NOT NULL,
+  location blob NOT NULL,
+  password varchar(255) NOT NULL,
+  city varchar(25) NOT NULL,
+  country varchar(25) NOT NULL,
+  profile_image int NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS users_profile_image_idx ON users (profile_image);
+
+CREATE TABLE IF NOT EXISTS listings (
+  listing_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  type varchar(10) NOT NULL CHECK (type IN ('Request', 'Offer')),
+  location blob NOT NULL,
+  user_id int NOT NULL REFERENCES users (user_id),
+  title varchar(255) NOT NULL,
+  description text NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  active boolean NOT NULL DEFAULT 1,
+  city varchar(255) NOT NULL,
+  country varchar(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS listings_user_id_idx ON listings (user_id);
+
+CREATE TABLE IF NOT EXISTS images (
+  image_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  url varchar(255) NOT NULL UNIQUE,
+  user_id int NOT NULL REFERENCES users (user_id),
+  listing_id int NOT NULL DEFAULT 0,
+  show_on_profile boolean DEFAULT 0,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS images_user_id_idx ON images (user_id);
+
+CREATE TABLE IF NOT EXISTS transactions (
+  transaction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_offered_id int NOT NULL REFERENCES users (user_id),
+  user_offering_id int NOT NULL REFERENCES users (user_id),
+  listing_id int NOT NULL REFERENCES listings (listing_id),
+  price double NOT NULL,
+  date_created timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  job_start_date date NOT NULL,
+  job_end_date date NOT NULL,
+  details_from_offered varchar(1000) NOT NULL,
+  details_from_offering varchar(1000) NOT NULL DEFAULT '',
+  currency varchar(10) NOT NULL DEFAULT 'USD',
+  status varchar(10) NOT NULL DEFAULT 'Pending' CHECK (status IN ('Pending', 'Accepted', 'Completed'))
+);
+
+CREATE INDEX IF NOT EXISTS transactions_user_offered_id_idx ON transactions (user_offered_id);
+CREATE INDEX IF NOT EXISTS transactions_user_offering_id_idx ON transactions (user_offering_id);
+CREATE INDEX IF NOT EXISTS transactions_listing_id_idx ON transactions (listing_id);
@@ -0,0 +1,5 @@
+ALTER TABLE transactions DROP COLUMN rating;
+
+ALTER TABLE users DROP COLUMN location_visibility;
+ALTER TABLE users DROP COLUMN birth_date_visibility;
+ALTER TABLE users DROP COLUMN phone_visibility;
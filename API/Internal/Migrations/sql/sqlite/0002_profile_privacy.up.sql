@@ -0,0 +1,8 @@
+-- Per-field profile visibility and ratings left on completed transactions.
+-- SQLite adds one column per statement.
+
+ALTER TABLE users ADD COLUMN phone_visibility text NOT NULL DEFAULT 'counterparties';
+ALTER TABLE users ADD COLUMN birth_date_visibility text NOT NULL DEFAULT 'private';
+ALTER TABLE users ADD COLUMN location_visibility text NOT NULL DEFAULT 'counterparties';
+
+ALTER TABLE transactions ADD COLUMN rating integer;
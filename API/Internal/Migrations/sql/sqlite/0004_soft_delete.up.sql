@@ -0,0 +1,9 @@
+-- Deleted listings and transactions keep their row until the purge job removes
+-- them, so owners can restore them and listings with transactions can be deleted.
+-- Admins, who may list deleted rows, are marked by role.
+
+ALTER TABLE listings ADD COLUMN deleted_at datetime;
+
+ALTER TABLE transactions ADD COLUMN deleted_at datetime;
+
+ALTER TABLE users ADD COLUMN role text NOT NULL DEFAULT 'user';
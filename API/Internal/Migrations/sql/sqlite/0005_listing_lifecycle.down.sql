@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS notifications;
+
+ALTER TABLE listings DROP COLUMN reminded_at;
+ALTER TABLE listings DROP COLUMN expires_at;
+ALTER TABLE listings DROP COLUMN status;
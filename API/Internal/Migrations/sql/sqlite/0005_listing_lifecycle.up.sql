@@ -0,0 +1,22 @@
+-- Listings move through draft, published, paused, expired and closed. Published
+-- listings expire at expires_at; reminded_at records the reminder sent before that.
+-- active is kept in step with the status for older clients.
+
+ALTER TABLE listings ADD COLUMN status text NOT NULL DEFAULT 'published';
+ALTER TABLE listings ADD COLUMN expires_at datetime;
+ALTER TABLE listings ADD COLUMN reminded_at datetime;
+
+UPDATE listings SET status = 'closed' WHERE NOT active;
+UPDATE listings SET expires_at = datetime(date_created, '+30 days') WHERE status = 'published';
+
+CREATE TABLE IF NOT EXISTS notifications (
+  notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (user_id),
+  kind varchar(50) NOT NULL,
+  message varchar(500) NOT NULL,
+  listing_id int,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  read_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id);
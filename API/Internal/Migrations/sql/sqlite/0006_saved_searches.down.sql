@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS saved_search_matches;
+DROP TABLE IF EXISTS saved_searches;
+
+ALTER TABLE listings DROP COLUMN matched_revision;
+ALTER TABLE listings DROP COLUMN revision;
+ALTER TABLE listings DROP COLUMN category;
@@ -0,0 +1,37 @@
+-- Listings gain a category. revision is bumped whenever a listing is edited and
+-- matched_revision records the revision the saved search matcher last looked at,
+-- so the matcher only evaluates new and updated listings.
+
+ALTER TABLE listings ADD COLUMN category varchar(50) NOT NULL DEFAULT '';
+ALTER TABLE listings ADD COLUMN revision int NOT NULL DEFAULT 1;
+ALTER TABLE listings ADD COLUMN matched_revision int NOT NULL DEFAULT 0;
+
+UPDATE listings SET matched_revision = revision;
+
+CREATE TABLE IF NOT EXISTS saved_searches (
+  search_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (user_id),
+  name varchar(100) NOT NULL,
+  type varchar(10) NOT NULL DEFAULT '',
+  query varchar(255) NOT NULL DEFAULT '',
+  category varchar(50) NOT NULL DEFAULT '',
+  longitude double,
+  latitude double,
+  max_distance double NOT NULL DEFAULT 0,
+  frequency text NOT NULL DEFAULT 'instant',
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_digest_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS saved_searches_user_id_idx ON saved_searches (user_id);
+
+-- Each listing matches a saved search at most once; notified_at is set once the owner was told
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+  search_id int NOT NULL REFERENCES saved_searches (search_id) ON DELETE CASCADE,
+  listing_id int NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  notified_at datetime,
+  PRIMARY KEY (search_id, listing_id)
+);
+
+CREATE INDEX IF NOT EXISTS saved_search_matches_listing_id_idx ON saved_search_matches (listing_id);
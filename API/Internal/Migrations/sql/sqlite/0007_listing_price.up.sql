@@ -0,0 +1,4 @@
+-- The price a listing asks for (offers) or is willing to pay (requests), used to
+-- rank matches. NULL when the listing does not say.
+
+ALTER TABLE listings ADD COLUMN price double;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS favourites;
+DROP TABLE IF EXISTS shortlists;
@@ -0,0 +1,15 @@
+-- Service areas are the polygons a user works in, drawn by hand or copied from a
+-- named district. Radius searches also return the offers of users whose area
+-- contains the searched point. SQLite keeps the polygon as a WKB blob and the
+-- containment test runs in Go.
+
+CREATE TABLE IF NOT EXISTS service_areas (
+  area_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (user_id),
+  name varchar(100) NOT NULL,
+  district varchar(50) NOT NULL DEFAULT '',
+  area blob NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS service_areas_user_id_idx ON service_areas (user_id);
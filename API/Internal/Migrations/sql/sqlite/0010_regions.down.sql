@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS users_region_id_idx;
+ALTER TABLE users DROP COLUMN region_id;
+
+DROP INDEX IF EXISTS listings_region_id_idx;
+ALTER TABLE listings DROP COLUMN region_id;
+
+DROP TABLE IF EXISTS regions;
@@ -0,0 +1,22 @@
+-- The gazetteer: countries, governorates, districts and cities with English and
+-- Arabic names and boundary polygons, each inside its parent. Listings and users
+-- carry the most specific region containing their location. SQLite keeps the
+-- boundaries as WKB blobs and the containment test runs in Go.
+
+CREATE TABLE IF NOT EXISTS regions (
+  region_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  parent_id int REFERENCES regions (region_id),
+  level text NOT NULL,
+  code varchar(50) NOT NULL UNIQUE,
+  name_en varchar(100) NOT NULL,
+  name_ar varchar(100) NOT NULL,
+  boundary blob NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS regions_parent_id_idx ON regions (parent_id);
+
+ALTER TABLE listings ADD COLUMN region_id int;
+CREATE INDEX IF NOT EXISTS listings_region_id_idx ON listings (region_id);
+
+ALTER TABLE users ADD COLUMN region_id int;
+CREATE INDEX IF NOT EXISTS users_region_id_idx ON users (region_id);
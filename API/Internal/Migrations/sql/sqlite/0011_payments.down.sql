@@ -0,0 +1,37 @@
+DROP TABLE IF EXISTS ledger_entries;
+
+DROP TABLE IF EXISTS payments;
+
+-- The old schema has no status for cancelled transactions, so they are deleted
+UPDATE transactions SET status = 'Pending', deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP) WHERE status = 'Cancelled';
+
+CREATE TABLE transactions_rebuilt (
+  transaction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_offered_id int NOT NULL REFERENCES users (user_id),
+  user_offering_id int NOT NULL REFERENCES users (user_id),
+  listing_id int NOT NULL REFERENCES listings (listing_id),
+  price double NOT NULL,
+  date_created timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  job_start_date date NOT NULL,
+  job_end_date date NOT NULL,
+  details_from_offered varchar(1000) NOT NULL,
+  details_from_offering varchar(1000) NOT NULL DEFAULT '',
+  currency varchar(10) NOT NULL DEFAULT 'USD',
+  status varchar(10) NOT NULL DEFAULT 'Pending' CHECK (status IN ('Pending', 'Accepted', 'Completed')),
+  rating integer,
+  deleted_at datetime
+);
+
+INSERT INTO transactions_rebuilt (transaction_id, user_offered_id, user_offering_id, listing_id, price, date_created,
+  job_start_date, job_end_date, details_from_offered, details_from_offering, currency, status, rating, deleted_at)
+SELECT transaction_id, user_offered_id, user_offering_id, listing_id, price, date_created,
+  job_start_date, job_end_date, details_from_offered, details_from_offering, currency, status, rating, deleted_at
+FROM transactions;
+
+DROP TABLE transactions;
+
+ALTER TABLE transactions_rebuilt RENAME TO transactions;
+
+CREATE INDEX IF NOT EXISTS transactions_user_offered_id_idx ON transactions (user_offered_id);
+CREATE INDEX IF NOT EXISTS transactions_user_offering_id_idx ON transactions (user_offering_id);
+CREATE INDEX IF NOT EXISTS transactions_listing_id_idx ON transactions (listing_id);
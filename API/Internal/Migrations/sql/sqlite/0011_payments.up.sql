@@ -0,0 +1,68 @@
+-- Payments hold a transaction's price in escrow from acceptance until the job is
+-- completed, when it is released to the tradesman less the platform fee, or the
+-- transaction is cancelled, when it is refunded. Every movement of money is
+-- recorded in the ledger as entries that sum to zero. Payments and the ledger
+-- are kept when their transaction is purged.
+-- SQLite cannot alter a CHECK constraint, so transactions is rebuilt to allow Cancelled.
+
+CREATE TABLE transactions_rebuilt (
+  transaction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_offered_id int NOT NULL REFERENCES users (user_id),
+  user_offering_id int NOT NULL REFERENCES users (user_id),
+  listing_id int NOT NULL REFERENCES listings (listing_id),
+  price double NOT NULL,
+  date_created timestamp NULL DEFAULT CURRENT_TIMESTAMP,
+  job_start_date date NOT NULL,
+  job_end_date date NOT NULL,
+  details_from_offered varchar(1000) NOT NULL,
+  details_from_offering varchar(1000) NOT NULL DEFAULT '',
+  currency varchar(10) NOT NULL DEFAULT 'USD',
+  status varchar(10) NOT NULL DEFAULT 'Pending' CHECK (status IN ('Pending', 'Accepted', 'Completed', 'Cancelled')),
+  rating integer,
+  deleted_at datetime
+);
+
+INSERT INTO transactions_rebuilt (transaction_id, user_offered_id, user_offering_id, listing_id, price, date_created,
+  job_start_date, job_end_date, details_from_offered, details_from_offering, currency, status, rating, deleted_at)
+SELECT transaction_id, user_offered_id, user_offering_id, listing_id, price, date_created,
+  job_start_date, job_end_date, details_from_offered, details_from_offering, currency, status, rating, deleted_at
+FROM transactions;
+
+DROP TABLE transactions;
+
+ALTER TABLE transactions_rebuilt RENAME TO transactions;
+
+CREATE INDEX IF NOT EXISTS transactions_user_offered_id_idx ON transactions (user_offered_id);
+CREATE INDEX IF NOT EXISTS transactions_user_offering_id_idx ON transactions (user_offering_id);
+CREATE INDEX IF NOT EXISTS transactions_listing_id_idx ON transactions (listing_id);
+
+CREATE TABLE IF NOT EXISTS payments (
+  payment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  transaction_id int NOT NULL UNIQUE,
+  payer_id int NOT NULL REFERENCES users (user_id),
+  payee_id int NOT NULL REFERENCES users (user_id),
+  amount double NOT NULL,
+  fee double NOT NULL,
+  currency varchar(10) NOT NULL,
+  status varchar(10) NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'released', 'refunded')),
+  provider varchar(50) NOT NULL,
+  reference varchar(100) NOT NULL DEFAULT '',
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  date_settled datetime
+);
+
+CREATE INDEX IF NOT EXISTS payments_payer_id_idx ON payments (payer_id);
+CREATE INDEX IF NOT EXISTS payments_payee_id_idx ON payments (payee_id);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+  entry_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  payment_id int NOT NULL REFERENCES payments (payment_id),
+  movement varchar(10) NOT NULL CHECK (movement IN ('hold', 'release', 'refund')),
+  account varchar(50) NOT NULL,
+  amount double NOT NULL,
+  currency varchar(10) NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_payment_id_idx ON ledger_entries (payment_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_account_idx ON ledger_entries (account);
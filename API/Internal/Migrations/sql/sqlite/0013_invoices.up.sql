@@ -0,0 +1,36 @@
+-- Invoices are issued for Completed transactions and numbered per tradesman. They copy
+-- the names, items and amounts they print, and are kept when their transaction is purged.
+
+CREATE TABLE IF NOT EXISTS invoices (
+  invoice_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  transaction_id int NOT NULL UNIQUE,
+  tradesman_id int NOT NULL REFERENCES users (user_id),
+  client_id int NOT NULL REFERENCES users (user_id),
+  number int NOT NULL,
+  tradesman_name varchar(255) NOT NULL,
+  client_name varchar(255) NOT NULL,
+  listing_title varchar(255) NOT NULL,
+  currency varchar(10) NOT NULL,
+  subtotal double NOT NULL,
+  tax_country varchar(100) NOT NULL DEFAULT '',
+  tax_rate double NOT NULL DEFAULT 0,
+  tax double NOT NULL DEFAULT 0,
+  total double NOT NULL,
+  platform_fee double NOT NULL DEFAULT 0,
+  payout double NOT NULL,
+  date_paid datetime,
+  date_issued timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (tradesman_id, number)
+);
+
+CREATE INDEX IF NOT EXISTS invoices_client_id_idx ON invoices (client_id);
+
+CREATE TABLE IF NOT EXISTS invoice_items (
+  item_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  invoice_id int NOT NULL REFERENCES invoices (invoice_id),
+  position int NOT NULL,
+  description varchar(500) NOT NULL,
+  amount double NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS invoice_items_invoice_id_idx ON invoice_items (invoice_id);
@@ -0,0 +1,102 @@
+-- Blank currency codes are left as USD, which they meant
+
+ALTER TABLE listings ADD COLUMN price double;
+
+UPDATE listings SET
+  price = price_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END
+  WHERE price_minor IS NOT NULL;
+
+ALTER TABLE listings DROP COLUMN currency;
+
+ALTER TABLE listings DROP COLUMN price_minor;
+
+DROP TABLE IF EXISTS transaction_rates;
+
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE users DROP COLUMN preferred_currency;
+
+ALTER TABLE transactions ADD COLUMN price double NOT NULL DEFAULT 0;
+
+UPDATE transactions SET
+  price = price_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE transactions DROP COLUMN price_minor;
+
+ALTER TABLE payments ADD COLUMN amount double NOT NULL DEFAULT 0;
+
+ALTER TABLE payments ADD COLUMN fee double NOT NULL DEFAULT 0;
+
+ALTER TABLE payments ADD COLUMN released double NOT NULL DEFAULT 0;
+
+UPDATE payments SET
+  amount = amount_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  fee = fee_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  released = released_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE payments DROP COLUMN amount_minor;
+
+ALTER TABLE payments DROP COLUMN fee_minor;
+
+ALTER TABLE payments DROP COLUMN released_minor;
+
+ALTER TABLE ledger_entries ADD COLUMN amount double NOT NULL DEFAULT 0;
+
+UPDATE ledger_entries SET
+  amount = amount_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE ledger_entries DROP COLUMN amount_minor;
+
+ALTER TABLE milestones ADD COLUMN amount double NOT NULL DEFAULT 0;
+
+UPDATE milestones SET
+  amount = amount_minor * 1.0 / CASE WHEN (SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN (SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE milestones DROP COLUMN amount_minor;
+
+ALTER TABLE invoices ADD COLUMN subtotal double NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN tax double NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN total double NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN platform_fee double NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN payout double NOT NULL DEFAULT 0;
+
+UPDATE invoices SET
+  subtotal = subtotal_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  tax = tax_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  total = total_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  platform_fee = platform_fee_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END,
+  payout = payout_minor * 1.0 / CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE invoices DROP COLUMN subtotal_minor;
+
+ALTER TABLE invoices DROP COLUMN tax_minor;
+
+ALTER TABLE invoices DROP COLUMN total_minor;
+
+ALTER TABLE invoices DROP COLUMN platform_fee_minor;
+
+ALTER TABLE invoices DROP COLUMN payout_minor;
+
+ALTER TABLE invoice_items ADD COLUMN amount double NOT NULL DEFAULT 0;
+
+UPDATE invoice_items SET
+  amount = amount_minor * 1.0 / CASE WHEN (SELECT currency FROM invoices WHERE invoices.invoice_id = invoice_items.invoice_id) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN (SELECT currency FROM invoices WHERE invoices.invoice_id = invoice_items.invoice_id) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END;
+
+ALTER TABLE invoice_items DROP COLUMN amount_minor;
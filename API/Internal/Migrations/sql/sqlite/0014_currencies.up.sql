@@ -0,0 +1,133 @@
+-- Money is stored in the minor units of its ISO 4217 currency, cents for USD and piastres
+-- for LBP, so amounts add up exactly. Currency codes are upper-cased, blank ones meaning
+-- USD as before. Users may prefer a currency to see amounts in, and the exchange rates
+-- set by admins or quoted by the provider are recorded on each transaction when it is
+-- accepted. Listing prices become money too, those set so far having been meant
+-- as USD, while NULL still means the listing does not say.
+
+UPDATE transactions SET currency = UPPER(TRIM(currency));
+UPDATE transactions SET currency = 'USD' WHERE currency = '';
+
+UPDATE payments SET currency = UPPER(TRIM(currency));
+UPDATE payments SET currency = 'USD' WHERE currency = '';
+
+UPDATE ledger_entries SET currency = UPPER(TRIM(currency));
+UPDATE ledger_entries SET currency = 'USD' WHERE currency = '';
+
+UPDATE invoices SET currency = UPPER(TRIM(currency));
+UPDATE invoices SET currency = 'USD' WHERE currency = '';
+
+ALTER TABLE transactions ADD COLUMN price_minor bigint NOT NULL DEFAULT 0;
+
+UPDATE transactions SET
+  price_minor = CAST(ROUND(price * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER);
+
+ALTER TABLE transactions DROP COLUMN price;
+
+ALTER TABLE payments ADD COLUMN amount_minor bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE payments ADD COLUMN fee_minor bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE payments ADD COLUMN released_minor bigint NOT NULL DEFAULT 0;
+
+UPDATE payments SET
+  amount_minor = CAST(ROUND(amount * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER),
+  fee_minor = CAST(ROUND(fee * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER),
+  released_minor = CAST(ROUND(released * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER);
+
+ALTER TABLE payments DROP COLUMN amount;
+
+ALTER TABLE payments DROP COLUMN fee;
+
+ALTER TABLE payments DROP COLUMN released;
+
+ALTER TABLE ledger_entries ADD COLUMN amount_minor bigint NOT NULL DEFAULT 0;
+
+UPDATE ledger_entries SET
+  amount_minor = CAST(ROUND(amount * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER);
+
+ALTER TABLE ledger_entries DROP COLUMN amount;
+
+ALTER TABLE milestones ADD COLUMN amount_minor bigint NOT NULL DEFAULT 0;
+
+UPDATE milestones SET
+  amount_minor = CAST(ROUND(amount * CASE WHEN (SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN (SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER);
+
+ALTER TABLE milestones DROP COLUMN amount;
+
+ALTER TABLE invoices ADD COLUMN subtotal_minor bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN tax_minor bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN total_minor bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN platform_fee_minor bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN payout_minor bigint NOT NULL DEFAULT 0;
+
+UPDATE invoices SET
+  subtotal_minor = CAST(ROUND(subtotal * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER),
+  tax_minor = CAST(ROUND(tax * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER),
+  total_minor = CAST(ROUND(total * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER),
+  platform_fee_minor = CAST(ROUND(platform_fee * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER),
+  payout_minor = CAST(ROUND(payout * CASE WHEN currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER);
+
+ALTER TABLE invoices DROP COLUMN subtotal;
+
+ALTER TABLE invoices DROP COLUMN tax;
+
+ALTER TABLE invoices DROP COLUMN total;
+
+ALTER TABLE invoices DROP COLUMN platform_fee;
+
+ALTER TABLE invoices DROP COLUMN payout;
+
+ALTER TABLE invoice_items ADD COLUMN amount_minor bigint NOT NULL DEFAULT 0;
+
+UPDATE invoice_items SET
+  amount_minor = CAST(ROUND(amount * CASE WHEN (SELECT currency FROM invoices WHERE invoices.invoice_id = invoice_items.invoice_id) IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+    WHEN (SELECT currency FROM invoices WHERE invoices.invoice_id = invoice_items.invoice_id) IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000 ELSE 100 END) AS INTEGER);
+
+ALTER TABLE invoice_items DROP COLUMN amount;
+
+ALTER TABLE users ADD COLUMN preferred_currency varchar(3) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+  currency_from varchar(3) NOT NULL,
+  currency_to varchar(3) NOT NULL,
+  rate double NOT NULL,
+  set_by int NOT NULL REFERENCES users (user_id),
+  date_set timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (currency_from, currency_to)
+);
+
+CREATE TABLE IF NOT EXISTS transaction_rates (
+  transaction_id int NOT NULL REFERENCES transactions (transaction_id),
+  currency_from varchar(3) NOT NULL,
+  currency_to varchar(3) NOT NULL,
+  rate double NOT NULL,
+  source varchar(50) NOT NULL,
+  date_quoted timestamp NOT NULL,
+  PRIMARY KEY (transaction_id, currency_to)
+);
+
+-- Listing prices, in USD until now
+
+ALTER TABLE listings ADD COLUMN price_minor bigint;
+
+ALTER TABLE listings ADD COLUMN currency varchar(3) NOT NULL DEFAULT 'USD';
+
+UPDATE listings SET price_minor = CAST(ROUND(price * 100) AS INTEGER) WHERE price IS NOT NULL;
+
+ALTER TABLE listings DROP COLUMN price;
@@ -0,0 +1,24 @@
+-- Users without a row are on the free plan. Paid plans are charged for each period in
+-- advance, and a cheaper next_plan, possibly free, takes over when the period ends.
+-- subscription_charges keeps what was charged through the payment provider.
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+  user_id int PRIMARY KEY REFERENCES users (user_id),
+  plan varchar(20) NOT NULL,
+  next_plan varchar(20) NOT NULL DEFAULT '',
+  period_start timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  period_end datetime NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS subscription_charges (
+  charge_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (user_id),
+  plan varchar(20) NOT NULL,
+  amount_minor bigint NOT NULL,
+  currency varchar(3) NOT NULL,
+  provider varchar(50) NOT NULL,
+  reference varchar(100) NOT NULL DEFAULT '',
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS subscription_charges_user_id_idx ON subscription_charges (user_id);
@@ -0,0 +1,37 @@
+-- Promotions pay for a listing to be shown in promoted slots of search results,
+-- optionally only in a region or for a category. The whole budget is held through
+-- the payment provider when a promotion is bought; when it ends or is cancelled,
+-- what it spent goes to the platform and the rest is refunded. promotion_days
+-- counts the impressions, clicks and spend of each day a promotion was shown.
+-- Promotions are kept when their listing is purged.
+
+CREATE TABLE IF NOT EXISTS promotions (
+  promotion_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  listing_id int NOT NULL,
+  user_id int NOT NULL REFERENCES users (user_id),
+  region_id int REFERENCES regions (region_id),
+  category varchar(50) NOT NULL DEFAULT '',
+  start_date date NOT NULL,
+  end_date date NOT NULL,
+  daily_budget_minor bigint NOT NULL,
+  budget_minor bigint NOT NULL,
+  currency varchar(3) NOT NULL,
+  status varchar(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled', 'ended')),
+  provider varchar(50) NOT NULL,
+  reference varchar(100) NOT NULL DEFAULT '',
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  date_settled datetime
+);
+
+CREATE INDEX IF NOT EXISTS promotions_listing_id_idx ON promotions (listing_id);
+CREATE INDEX IF NOT EXISTS promotions_user_id_idx ON promotions (user_id);
+CREATE INDEX IF NOT EXISTS promotions_status_idx ON promotions (status);
+
+CREATE TABLE IF NOT EXISTS promotion_days (
+  promotion_id int NOT NULL REFERENCES promotions (promotion_id),
+  day date NOT NULL,
+  impressions int NOT NULL DEFAULT 0,
+  clicks int NOT NULL DEFAULT 0,
+  spent_minor bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (promotion_id, day)
+);
@@ -0,0 +1,28 @@
+-- API clients let third parties call the public read-only API with a key instead of a
+-- user token. Only a SHA-256 hash of each key is stored, with a short prefix to tell
+-- keys apart; the key itself is shown once when it is issued. scopes lists the parts
+-- of the public API a client may call, comma separated. api_usage meters the requests
+-- of each client by day, those served and those refused over its daily quota.
+
+CREATE TABLE IF NOT EXISTS api_clients (
+  client_id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (user_id),
+  name varchar(100) NOT NULL,
+  scopes varchar(255) NOT NULL,
+  key_prefix varchar(16) NOT NULL,
+  key_hash char(64) NOT NULL UNIQUE,
+  rate_limit int NOT NULL,
+  daily_quota int NOT NULL,
+  date_created timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  revoked_at datetime
+);
+
+CREATE INDEX IF NOT EXISTS api_clients_user_id_idx ON api_clients (user_id);
+
+CREATE TABLE IF NOT EXISTS api_usage (
+  client_id int NOT NULL REFERENCES api_clients (client_id),
+  day date NOT NULL,
+  requests int NOT NULL DEFAULT 0,
+  rejected int NOT NULL DEFAULT 0,
+  PRIMARY KEY (client_id, day)
+);
@@ -0,0 +1,124 @@
+// Package PDF writes simple text documents as PDF without any dependency: A4 pages of
+// left aligned lines in the standard Helvetica fonts, which every PDF reader embeds.
+package PDF
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Page layout in points, on A4 paper
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	margin       = 56
+	lineHeight   = 16
+	fontSize     = 10
+	headingSize  = 16
+	linesPerPage = (pageHeight - 2*margin) / lineHeight
+)
+
+// line is a line of text and whether it is a heading
+type line struct {
+	text    string
+	heading bool
+}
+
+// Document is a text document built line by line. Lines run onto new pages as needed.
+type Document struct {
+	lines []line
+}
+
+// Heading adds a line of large bold text
+func (d *Document) Heading(text string) {
+	d.lines = append(d.lines, line{text: text, heading: true})
+}
+
+// Line adds a line of text. Long lines are not wrapped.
+func (d *Document) Line(text string) {
+	d.lines = append(d.lines, line{text: text})
+}
+
+// Blank adds an empty line
+func (d *Document) Blank() {
+	d.Line("")
+}
+
+// Bytes returns the document as a PDF file
+func (d *Document) Bytes() []byte {
+	var pages [][]line
+	for start := 0; start < len(d.lines) || start == 0; start += linesPerPage {
+		end := start + linesPerPage
+		if end > len(d.lines) {
+			end = len(d.lines)
+		}
+		pages = append(pages, d.lines[start:end])
+	}
+
+	// Objects 1 and 2 are the catalog and the page tree, 3 and 4 the fonts, then a page and its contents per page
+	objects := []string{"", "", "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>"}
+	var kids []string
+	for _, page := range pages {
+		pageID, contentsID := len(objects)+1, len(objects)+2
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+		contents := pageContents(page)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, contentsID),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(contents), contents))
+	}
+	objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pageContents draws the lines of a page from the top margin down
+func pageContents(lines []line) string {
+	var contents strings.Builder
+	for i, l := range lines {
+		if l.text == "" {
+			continue
+		}
+		font, size := "F1", fontSize
+		if l.heading {
+			font, size = "F2", headingSize
+		}
+		fmt.Fprintf(&contents, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, margin, pageHeight-margin-i*lineHeight, escape(l.text))
+	}
+	return contents.String()
+}
+
+// escape encodes text for a PDF string in WinAnsi. Characters it cannot show, such as Arabic, become '?'.
+func escape(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			escaped.WriteByte('\\')
+			escaped.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			escaped.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&escaped, "\\%03o", r)
+		default:
+			escaped.WriteByte('?')
+		}
+	}
+	return escaped.String()
+}
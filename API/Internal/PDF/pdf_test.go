@@ -0,0 +1,45 @@
+package PDF
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDocumentIsWellFormed(t *testing.T) {
+	var doc Document
+	doc.Heading("Invoice INV-2-000001")
+	doc.Line("Kitchen (floor) 150.50 USD")
+	doc.Line("Client: نادين")
+	for i := 0; i < linesPerPage; i++ {
+		doc.Line("Line " + strconv.Itoa(i))
+	}
+	out := doc.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("missing header or trailer:\n%s", out)
+	}
+	if !bytes.Contains(out, []byte(`(Kitchen \(floor\) 150.50 USD) Tj`)) || !bytes.Contains(out, []byte("(Client: ?????) Tj")) {
+		t.Fatalf("text not escaped:\n%s", out)
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Fatalf("expected the lines to run onto a second page:\n%s", out)
+	}
+
+	// Every cross-reference entry points at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	entries := strings.Split(string(out[xref:]), "\n")[3:]
+	for i, entry := range entries {
+		if !strings.HasSuffix(entry, " n ") {
+			break
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if !bytes.HasPrefix(out[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Fatalf("xref entry %d points at %q", i+1, out[offset:offset+10])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package Payments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// Fake is a Provider that moves no money. It keeps the balance of every user so
+// tests can check who paid whom, and declines everything while Decline is set.
+type Fake struct {
+	mu       sync.Mutex
+	next     int
+	charges  map[string]*fakeCharge
+	balances map[int]float64
+	fees     float64
+
+	// Decline makes every call fail with ErrDeclined
+	Decline bool
+}
+
+// fakeCharge is a held charge and how much of it is left to pay out or refund
+type fakeCharge struct {
+	payerID   int
+	currency  string
+	remaining float64
+}
+
+// NewFake returns a Fake with no charges
+func NewFake() *Fake {
+	return &Fake{charges: map[string]*fakeCharge{}, balances: map[int]float64{}}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Charge holds the amount, taking it from the payer's balance
+func (f *Fake) Charge(ctx context.Context, charge Charge) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Decline {
+		return "", fmt.Errorf("charge of %.2f %s: %w", charge.Amount, charge.Currency, ErrDeclined)
+	}
+	if charge.Amount <= 0 {
+		return "", fmt.Errorf("charge amount must be positive, got %.2f", charge.Amount)
+	}
+	f.next++
+	reference := "fake_" + strconv.Itoa(f.next)
+	f.charges[reference] = &fakeCharge{payerID: charge.PayerID, currency: charge.Currency, remaining: charge.Amount}
+	f.balances[charge.PayerID] -= charge.Amount
+	return reference, nil
+}
+
+// Payout adds part of a held charge to the payee's balance and keeps the fee
+func (f *Fake) Payout(ctx context.Context, payout Payout) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if held, ok := f.charges[payout.Reference]; ok && held.currency != payout.Currency {
+		return fmt.Errorf("charge %s is in %s, not %s", payout.Reference, held.currency, payout.Currency)
+	}
+	if _, err := f.take(payout.Reference, payout.Amount+payout.Fee); err != nil {
+		return err
+	}
+	f.balances[payout.PayeeID] += payout.Amount
+	f.fees += payout.Fee
+	return nil
+}
+
+// Refund gives part of a held charge back to its payer
+func (f *Fake) Refund(ctx context.Context, reference string, amount float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	held, err := f.take(reference, amount)
+	if err != nil {
+		return err
+	}
+	f.balances[held.payerID] += amount
+	return nil
+}
+
+// take removes amount from what is left of a charge. The caller holds the lock.
+func (f *Fake) take(reference string, amount float64) (*fakeCharge, error) {
+	if f.Decline {
+		return nil, fmt.Errorf("charge %s: %w", reference, ErrDeclined)
+	}
+	held, ok := f.charges[reference]
+	if !ok {
+		return nil, fmt.Errorf("unknown charge %s", reference)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %.2f", amount)
+	}
+	// Compare in cents, so fees rounded to the cent add up
+	if math.Round(amount*100) > math.Round(held.remaining*100) {
+		return nil, fmt.Errorf("charge %s has %.2f left, cannot move %.2f", reference, held.remaining, amount)
+	}
+	held.remaining -= amount
+	return held, nil
+}
+
+// Balance is what a user has received less what they paid
+func (f *Fake) Balance(userID int) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return math.Round(f.balances[userID]*100) / 100
+}
+
+// Held is the money charged and not yet paid out or refunded, across all charges
+func (f *Fake) Held() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	held := 0.0
+	for _, charge := range f.charges {
+		held += charge.remaining
+	}
+	return math.Round(held*100) / 100
+}
+
+// Fees is what the platform kept from payouts
+func (f *Fake) Fees() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return math.Round(f.fees*100) / 100
+}
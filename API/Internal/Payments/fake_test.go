@@ -0,0 +1,61 @@
+package Payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeMovesHeldMoney(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+
+	reference, err := fake.Charge(ctx, Charge{PayerID: 1, Amount: 100, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.Balance(1) != -100 || fake.Held() != 100 {
+		t.Fatalf("expected 100 held from the payer, got balance %.2f held %.2f", fake.Balance(1), fake.Held())
+	}
+
+	if err := fake.Payout(ctx, Payout{Reference: reference, PayeeID: 2, Amount: 95, Fee: 5, Currency: "LBP"}); err == nil {
+		t.Fatal("expected a payout in another currency to fail")
+	}
+	if err := fake.Payout(ctx, Payout{Reference: reference, PayeeID: 2, Amount: 95, Fee: 5.01, Currency: "USD"}); err == nil {
+		t.Fatal("expected a payout of more than is held to fail")
+	}
+	if err := fake.Payout(ctx, Payout{Reference: reference, PayeeID: 2, Amount: 95, Fee: 5, Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Balance(2) != 95 || fake.Fees() != 5 || fake.Held() != 0 {
+		t.Fatalf("expected 95 paid out and 5 kept, got balance %.2f fees %.2f held %.2f", fake.Balance(2), fake.Fees(), fake.Held())
+	}
+	if err := fake.Refund(ctx, reference, 1); err == nil {
+		t.Fatal("expected nothing left to refund")
+	}
+}
+
+func TestFakeDeclines(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake()
+
+	reference, err := fake.Charge(ctx, Charge{PayerID: 1, Amount: 40, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Decline = true
+	if _, err := fake.Charge(ctx, Charge{PayerID: 1, Amount: 10, Currency: "USD"}); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("expected a declined charge, got %v", err)
+	}
+	if err := fake.Refund(ctx, reference, 40); !errors.Is(err, ErrDeclined) {
+		t.Fatalf("expected a declined refund, got %v", err)
+	}
+
+	fake.Decline = false
+	if err := fake.Refund(ctx, reference, 40); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Balance(1) != 0 || fake.Held() != 0 {
+		t.Fatalf("expected the refund to even out, got balance %.2f held %.2f", fake.Balance(1), fake.Held())
+	}
+}
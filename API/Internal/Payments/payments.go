@@ -0,0 +1,37 @@
+package Payments
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrDeclined is returned (wrapped) by providers when the processor refuses a payment
+var ErrDeclined = errors.New("payment declined")
+
+// Charge takes money from a payer and keeps it on the platform's account until it is paid out or refunded
+type Charge struct {
+	PayerID     int
+	Amount      float64
+	Currency    string
+	Description string
+}
+
+// Payout sends part of a held charge to a payee, and Fee of it to the platform
+type Payout struct {
+	Reference string
+	PayeeID   int
+	Amount    float64
+	Fee       float64
+	Currency  string
+}
+
+// Provider moves money through a payment processor. Amounts are in major units of the currency.
+type Provider interface {
+	// Name identifies the provider on stored payments
+	Name() string
+	// Charge returns the processor's reference for the held money
+	Charge(ctx context.Context, charge Charge) (string, error)
+	Payout(ctx context.Context, payout Payout) error
+	// Refund returns amount of a held charge to its payer
+	Refund(ctx context.Context, reference string, amount float64) error
+}
@@ -0,0 +1,104 @@
+package Rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// File quotes the rates of a JSON file, such as one fetched daily from a central bank:
+//
+//	{"base": "USD", "date": "2025-01-10", "rates": {"LBP": 89500, "EUR": 0.92}}
+//
+// Each rate is what one unit of base buys, and pairs without base are crossed through it.
+// The file is read again whenever it changes, so it can be replaced while the API runs.
+type File struct {
+	path string
+
+	mu       sync.Mutex
+	modified time.Time
+	table    fileTable
+}
+
+// fileTable is the content of a rates file
+type fileTable struct {
+	Base  string             `json:"base"`
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// NewFile returns a File reading path, which must already hold valid rates
+func NewFile(path string) (*File, error) {
+	f := &File{path: path}
+	if _, err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Name() string {
+	return "file"
+}
+
+// Quote returns the rate from one currency to another as of the file's date
+func (f *File) Quote(ctx context.Context, from, to string) (Quote, error) {
+	table, err := f.load()
+	if err != nil {
+		return Quote{}, err
+	}
+
+	// The base buys one of itself
+	rate := func(currency string) (float64, bool) {
+		if currency == table.Base {
+			return 1, true
+		}
+		rate, ok := table.Rates[currency]
+		return rate, ok
+	}
+	fromRate, fromOK := rate(from)
+	toRate, toOK := rate(to)
+	if !fromOK || !toOK {
+		return Quote{}, fmt.Errorf("%w from %s to %s in %s", ErrNoRate, from, to, f.path)
+	}
+	return Quote{From: from, To: to, Rate: toRate / fromRate, AsOf: table.Date + " 00:00:00"}, nil
+}
+
+// load returns the rates of the file, reading it again when it changed since the last read
+func (f *File) load() (fileTable, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fileTable{}, fmt.Errorf("could not read exchange rates: %w", err)
+	}
+	if !info.ModTime().After(f.modified) && f.table.Base != "" {
+		return f.table, nil
+	}
+
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return fileTable{}, fmt.Errorf("could not read exchange rates: %w", err)
+	}
+	var table fileTable
+	if err := json.Unmarshal(content, &table); err != nil {
+		return fileTable{}, fmt.Errorf("could not parse exchange rates in %s: %w", f.path, err)
+	}
+	if table.Base == "" {
+		return fileTable{}, fmt.Errorf("exchange rates in %s have no base currency", f.path)
+	}
+	if _, err := time.Parse("2006-01-02", table.Date); err != nil {
+		return fileTable{}, fmt.Errorf("exchange rates in %s need a date formatted YYYY-MM-DD", f.path)
+	}
+	for currency, rate := range table.Rates {
+		if rate <= 0 {
+			return fileTable{}, fmt.Errorf("exchange rate of %s in %s must be positive", currency, f.path)
+		}
+	}
+
+	f.table, f.modified = table, info.ModTime()
+	return table, nil
+}
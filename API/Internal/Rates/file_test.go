@@ -0,0 +1,73 @@
+package Rates
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeRates(t *testing.T, path, content string, modified time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileQuotes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rates.json")
+	writeRates(t, path, `{"base": "USD", "date": "2025-01-10", "rates": {"LBP": 89500, "EUR": 0.8}}`, time.Now().Add(-time.Hour))
+
+	rates, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []Quote{
+		{From: "USD", To: "LBP", Rate: 89500},
+		{From: "LBP", To: "USD", Rate: 1.0 / 89500},
+		{From: "EUR", To: "LBP", Rate: 111875},
+	} {
+		quote, err := rates.Quote(ctx, want.From, want.To)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(quote.Rate-want.Rate) > 1e-9*want.Rate || quote.AsOf != "2025-01-10 00:00:00" {
+			t.Fatalf("expected %s to %s at %v, got %+v", want.From, want.To, want.Rate, quote)
+		}
+	}
+	if _, err := rates.Quote(ctx, "USD", "JPY"); !errors.Is(err, ErrNoRate) {
+		t.Fatalf("expected no rate to JPY, got %v", err)
+	}
+
+	// A replaced file is read again
+	writeRates(t, path, `{"base": "USD", "date": "2025-01-11", "rates": {"LBP": 90000}}`, time.Now())
+	if quote, err := rates.Quote(ctx, "USD", "LBP"); err != nil || quote.Rate != 90000 || quote.AsOf != "2025-01-11 00:00:00" {
+		t.Fatalf("expected the new rate, got %+v %v", quote, err)
+	}
+}
+
+func TestFileRejectsBadRates(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"garbage":  `rates`,
+		"no base":  `{"date": "2025-01-10", "rates": {"LBP": 89500}}`,
+		"no date":  `{"base": "USD", "rates": {"LBP": 89500}}`,
+		"negative": `{"base": "USD", "date": "2025-01-10", "rates": {"LBP": -1}}`,
+	} {
+		path := filepath.Join(dir, name+".json")
+		writeRates(t, path, content, time.Now())
+		if _, err := NewFile(path); err == nil {
+			t.Errorf("expected %s to be refused", name)
+		}
+	}
+	if _, err := NewFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected a missing file to be refused")
+	}
+}
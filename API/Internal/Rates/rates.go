@@ -0,0 +1,25 @@
+package Rates
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoRate is returned (wrapped) by providers that cannot quote a pair of currencies
+var ErrNoRate = errors.New("no exchange rate")
+
+// Quote is the rate between two currencies: an amount in From times Rate is its worth in To
+type Quote struct {
+	From string
+	To   string
+	Rate float64
+	// AsOf is when the rate was published, formatted "2006-01-02 15:04:05"
+	AsOf string
+}
+
+// Provider quotes exchange rates from a source outside the platform. Currencies are ISO 4217 codes.
+type Provider interface {
+	// Name identifies the provider on recorded rates
+	Name() string
+	Quote(ctx context.Context, from, to string) (Quote, error)
+}
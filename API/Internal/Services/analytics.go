@@ -0,0 +1,234 @@
+package Services
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Kinds of analytics events
+const (
+	EventListingView      = "listing_view"
+	EventSearchImpression = "search_impression"
+	EventProfileVisit     = "profile_visit"
+	EventFavourite        = "favourite"
+	EventInquiry          = "inquiry"
+)
+
+// AnalyticsEvent is something that happened to a user's listing or profile. Events are
+// counted for the day they happened on, first as they are and then rolled up by day.
+type AnalyticsEvent struct {
+	Kind string
+	// UserID is the user whose analytics the event counts in, the owner of the listing
+	UserID int
+	// ListingID is 0 for events on the profile itself
+	ListingID int
+	At        time.Time
+}
+
+// AnalyticsDay counts the events of a user's listings and profile on one day
+type AnalyticsDay struct {
+	// Format: "2006-01-02"
+	// @example "2025-01-10"
+	Date string `json:"date"`
+
+	// ListingViews counts the times someone other than the owner opened one of the listings
+	// @example 42
+	ListingViews int `json:"listing_views"`
+
+	// SearchImpressions counts the times one of the listings was shown in search results
+	// @example 310
+	SearchImpressions int `json:"search_impressions"`
+
+	// ProfileVisits counts the times someone else opened the profile
+	// @example 7
+	ProfileVisits int `json:"profile_visits"`
+
+	// Favourites counts the times the profile or one of the listings was added to a shortlist
+	// @example 3
+	Favourites int `json:"favourites"`
+
+	// Inquiries counts the transactions others proposed on the listings
+	// @example 2
+	Inquiries int `json:"inquiries"`
+}
+
+// ListingAnalytics counts the events of one listing over a period
+type ListingAnalytics struct {
+	// @example 42
+	ListingID int `json:"listing_id"`
+
+	// @example "Bathroom tiling"
+	Title string `json:"title"`
+
+	// @example 120
+	ListingViews int `json:"listing_views"`
+
+	// @example 980
+	SearchImpressions int `json:"search_impressions"`
+
+	// @example 6
+	Favourites int `json:"favourites"`
+
+	// @example 4
+	Inquiries int `json:"inquiries"`
+}
+
+// Funnel follows a tradesman's transactions from offer to completion over a period
+type Funnel struct {
+	// Offers are the transactions proposed, whatever became of them
+	// @example 20
+	Offers int `json:"offers"`
+
+	// Accepted are the offers that were accepted, including those cancelled afterwards
+	// @example 12
+	Accepted int `json:"accepted"`
+
+	// @example 9
+	Completed int `json:"completed"`
+
+	// @example 5
+	Cancelled int `json:"cancelled"`
+
+	// AcceptanceRate is the share of offers accepted, from 0 to 1
+	// @example 0.6
+	AcceptanceRate float64 `json:"acceptance_rate"`
+
+	// CompletionRate is the share of accepted offers completed, from 0 to 1
+	// @example 0.75
+	CompletionRate float64 `json:"completion_rate"`
+}
+
+// MonthlyRevenue is what a tradesman was paid out of escrow in a month, in one currency, after the platform fee
+type MonthlyRevenue struct {
+	// Format: "2006-01"
+	// @example "2025-01"
+	Month string `json:"month"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// @example 1520.40
+	Amount float64 `json:"amount"`
+
+	// Payouts counts the releases, a transaction paid by milestones having one for each
+	// @example 6
+	Payouts int `json:"payouts"`
+}
+
+// analyticsCount is how many events of a kind a listing, or the profile for 0, had on a day
+type analyticsCount struct {
+	listingID int
+	day       string
+	kind      string
+	count     int
+}
+
+// add counts n events of kind on the day
+func (d *AnalyticsDay) add(kind string, n int) {
+	switch kind {
+	case EventListingView:
+		d.ListingViews += n
+	case EventSearchImpression:
+		d.SearchImpressions += n
+	case EventProfileVisit:
+		d.ProfileVisits += n
+	case EventFavourite:
+		d.Favourites += n
+	case EventInquiry:
+		d.Inquiries += n
+	}
+}
+
+// analyticsDays totals counts by day, in date order
+func analyticsDays(counts []analyticsCount) []AnalyticsDay {
+	byDay := map[string]*AnalyticsDay{}
+	for _, count := range counts {
+		day, ok := byDay[count.day]
+		if !ok {
+			day = &AnalyticsDay{Date: count.day}
+			byDay[count.day] = day
+		}
+		day.add(count.kind, count.count)
+	}
+
+	days := make([]AnalyticsDay, 0, len(byDay))
+	for _, day := range byDay {
+		days = append(days, *day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// analyticsListings totals counts by listing, the most viewed first, leaving out profile events
+func analyticsListings(counts []analyticsCount) []ListingAnalytics {
+	byListing := map[int]*ListingAnalytics{}
+	for _, count := range counts {
+		if count.listingID == 0 {
+			continue
+		}
+		listing, ok := byListing[count.listingID]
+		if !ok {
+			listing = &ListingAnalytics{ListingID: count.listingID}
+			byListing[count.listingID] = listing
+		}
+		switch count.kind {
+		case EventListingView:
+			listing.ListingViews += count.count
+		case EventSearchImpression:
+			listing.SearchImpressions += count.count
+		case EventFavourite:
+			listing.Favourites += count.count
+		case EventInquiry:
+			listing.Inquiries += count.count
+		}
+	}
+
+	listings := make([]ListingAnalytics, 0, len(byListing))
+	for _, listing := range byListing {
+		listings = append(listings, *listing)
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		if listings[i].ListingViews != listings[j].ListingViews {
+			return listings[i].ListingViews > listings[j].ListingViews
+		}
+		return listings[i].ListingID < listings[j].ListingID
+	})
+	return listings
+}
+
+// newFunnel fills in the rates of a funnel from its counts
+func newFunnel(offers, accepted, completed, cancelled int) Funnel {
+	rate := func(part, whole int) float64 {
+		if whole == 0 {
+			return 0
+		}
+		return math.Round(float64(part)/float64(whole)*10000) / 10000
+	}
+	return Funnel{Offers: offers, Accepted: accepted, Completed: completed, Cancelled: cancelled,
+		AcceptanceRate: rate(accepted, offers), CompletionRate: rate(completed, accepted)}
+}
+
+// monthlyRevenue totals release entries to a user's account by month and currency
+func monthlyRevenue(entries []LedgerEntry) []MonthlyRevenue {
+	type key struct{ month, currency string }
+	minor := map[key]int64{}
+	payouts := map[key]int{}
+	for _, entry := range entries {
+		k := key{entry.DateCreated[:min(len(entry.DateCreated), 7)], entry.Currency}
+		minor[k] += minorUnits(entry.Amount, entry.Currency)
+		payouts[k]++
+	}
+
+	revenue := make([]MonthlyRevenue, 0, len(minor))
+	for k, amount := range minor {
+		revenue = append(revenue, MonthlyRevenue{Month: k.month, Currency: k.currency, Amount: majorUnits(amount, k.currency), Payouts: payouts[k]})
+	}
+	sort.Slice(revenue, func(i, j int) bool {
+		if revenue[i].Month != revenue[j].Month {
+			return revenue[i].Month < revenue[j].Month
+		}
+		return revenue[i].Currency < revenue[j].Currency
+	})
+	return revenue
+}
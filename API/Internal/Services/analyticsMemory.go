@@ -0,0 +1,145 @@
+package Services
+
+import (
+	"context"
+	"time"
+)
+
+// analyticsKey identifies a rolled up count of the memory backend
+type analyticsKey struct {
+	userID    int
+	listingID int
+	day       string
+	kind      string
+}
+
+// AnalyticsMemory is the in-memory implementation of the Analytics interface
+type AnalyticsMemory struct {
+	store *memoryStore
+}
+
+// Record stores events as they are, for the rollup to count
+func (s *AnalyticsMemory) Record(ctx context.Context, events []AnalyticsEvent) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	s.store.analyticsEvents = append(s.store.analyticsEvents, events...)
+	return nil
+}
+
+// Rollup counts the events of the days before before's into the daily totals and
+// forgets them, returning how many it rolled up
+func (s *AnalyticsMemory) Rollup(ctx context.Context, before time.Time) (int, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	day := before.Format("2006-01-02")
+	kept := []AnalyticsEvent{}
+	rolled := 0
+	for _, event := range s.store.analyticsEvents {
+		eventDay := event.At.Format("2006-01-02")
+		if eventDay >= day {
+			kept = append(kept, event)
+			continue
+		}
+		s.store.analyticsDaily[analyticsKey{event.UserID, event.ListingID, eventDay, event.Kind}]++
+		rolled++
+	}
+	s.store.analyticsEvents = kept
+	return rolled, nil
+}
+
+// counts returns a user's rolled up and recent counts from one date to another. The caller holds the lock.
+func (s *AnalyticsMemory) counts(userID int, from, to string) []analyticsCount {
+	counts := []analyticsCount{}
+	for key, count := range s.store.analyticsDaily {
+		if key.userID == userID && key.day >= from && key.day <= to {
+			counts = append(counts, analyticsCount{listingID: key.listingID, day: key.day, kind: key.kind, count: count})
+		}
+	}
+	for _, event := range s.store.analyticsEvents {
+		day := event.At.Format("2006-01-02")
+		if event.UserID == userID && day >= from && day <= to {
+			counts = append(counts, analyticsCount{listingID: event.ListingID, day: day, kind: event.Kind, count: 1})
+		}
+	}
+	return counts
+}
+
+// GetDays returns a user's analytics for each day with events from one date to another, both included
+func (s *AnalyticsMemory) GetDays(ctx context.Context, userID int, from, to string) ([]AnalyticsDay, error) {
+	if _, err := issuedBetween(from, to); err != nil {
+		return nil, err
+	}
+
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	return analyticsDays(s.counts(userID, from, to)), nil
+}
+
+// GetListings returns the analytics of each of a user's listings with events from one date to another, both included
+func (s *AnalyticsMemory) GetListings(ctx context.Context, userID int, from, to string) ([]ListingAnalytics, error) {
+	if _, err := issuedBetween(from, to); err != nil {
+		return nil, err
+	}
+
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	listings := analyticsListings(s.counts(userID, from, to))
+	for i := range listings {
+		listings[i].Title = s.store.listings[listings[i].ListingID].Title
+	}
+	return listings, nil
+}
+
+// GetFunnel follows the transactions a tradesman was offered from one date to another, both included
+func (s *AnalyticsMemory) GetFunnel(ctx context.Context, userID int, from, to string) (Funnel, error) {
+	until, err := issuedBetween(from, to)
+	if err != nil {
+		return Funnel{}, err
+	}
+
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	offers, accepted, completed, cancelled := 0, 0, 0, 0
+	for _, transaction := range s.store.transactions {
+		if transaction.UserOfferingID != userID || transaction.DeletedAt != "" || transaction.DateCreated < from || transaction.DateCreated >= until {
+			continue
+		}
+		offers++
+		// A payment is only held on acceptance, so cancelled transactions with one were accepted first
+		_, paid := s.store.payments[transaction.TransactionID]
+		if transaction.Status == "Accepted" || transaction.Status == "Completed" || paid {
+			accepted++
+		}
+		switch transaction.Status {
+		case "Completed":
+			completed++
+		case "Cancelled":
+			cancelled++
+		}
+	}
+	return newFunnel(offers, accepted, completed, cancelled), nil
+}
+
+// GetRevenue returns what a tradesman was paid out of escrow by month from one date to another, both included
+func (s *AnalyticsMemory) GetRevenue(ctx context.Context, userID int, from, to string) ([]MonthlyRevenue, error) {
+	until, err := issuedBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	entries := []LedgerEntry{}
+	for _, entry := range s.store.ledger {
+		if entry.Account == UserAccount(userID) && entry.Movement == MovementRelease && entry.DateCreated >= from && entry.DateCreated < until {
+			entries = append(entries, entry)
+		}
+	}
+	return monthlyRevenue(entries), nil
+}
@@ -0,0 +1,219 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"time"
+)
+
+type AnalyticsService struct {
+	db *Database.DB
+}
+
+// Record stores events as they are, for the rollup to count
+func (s *AnalyticsService) Record(ctx context.Context, events []AnalyticsEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, event := range events {
+		_, err := tx.ExecContext(ctx, `INSERT INTO analytics_events (kind, user_id, listing_id, day) VALUES (?, ?, ?, ?)`,
+			event.Kind, event.UserID, event.ListingID, event.At.Format("2006-01-02"))
+		if err != nil {
+			return fmt.Errorf("could not record analytics event: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Rollup counts the events of the days before before's into analytics_daily and deletes
+// them, returning how many it rolled up. Events recorded meanwhile wait for the next rollup.
+func (s *AnalyticsService) Rollup(ctx context.Context, before time.Time) (int, error) {
+	day := before.Format("2006-01-02")
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var last int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(event_id), 0) FROM analytics_events`).Scan(&last); err != nil {
+		return 0, fmt.Errorf("could not find the last analytics event: %w", err)
+	}
+
+	type group struct {
+		userID int
+		count  analyticsCount
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, listing_id, `+s.db.Dialect.Date("day")+`, kind, COUNT(*) FROM analytics_events
+	          WHERE event_id <= ? AND day < ? GROUP BY user_id, listing_id, day, kind`, last, day)
+	if err != nil {
+		return 0, fmt.Errorf("could not count analytics events: %w", err)
+	}
+	groups := []group{}
+	for rows.Next() {
+		var g group
+		if err := rows.Scan(&g.userID, &g.count.listingID, &g.count.day, &g.count.kind, &g.count.count); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan analytics count: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rolled := 0
+	for _, g := range groups {
+		// Events can arrive for a day already rolled up, they are added to its count
+		result, err := tx.ExecContext(ctx, `UPDATE analytics_daily SET count = count + ? WHERE user_id = ? AND listing_id = ? AND day = ? AND kind = ?`,
+			g.count.count, g.userID, g.count.listingID, g.count.day, g.count.kind)
+		if err != nil {
+			return 0, fmt.Errorf("could not roll up analytics: %w", err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			_, err = tx.ExecContext(ctx, `INSERT INTO analytics_daily (user_id, listing_id, day, kind, count) VALUES (?, ?, ?, ?, ?)`,
+				g.userID, g.count.listingID, g.count.day, g.count.kind, g.count.count)
+			if err != nil {
+				return 0, fmt.Errorf("could not roll up analytics: %w", err)
+			}
+		}
+		rolled += g.count.count
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM analytics_events WHERE event_id <= ? AND day < ?`, last, day); err != nil {
+		return 0, fmt.Errorf("could not delete rolled up analytics events: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return rolled, nil
+}
+
+// counts returns a user's rolled up and recent counts from one date to another
+func (s *AnalyticsService) counts(ctx context.Context, userID int, from, to string) ([]analyticsCount, error) {
+	day := s.db.Dialect.Date("day")
+	rows, err := s.db.QueryContext(ctx, `SELECT listing_id, `+day+`, kind, count FROM analytics_daily
+	          WHERE user_id = ? AND day >= ? AND day <= ?
+	          UNION ALL
+	          SELECT listing_id, `+day+`, kind, COUNT(*) FROM analytics_events
+	          WHERE user_id = ? AND day >= ? AND day <= ? GROUP BY listing_id, day, kind`, userID, from, to, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve analytics: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []analyticsCount{}
+	for rows.Next() {
+		var count analyticsCount
+		if err := rows.Scan(&count.listingID, &count.day, &count.kind, &count.count); err != nil {
+			return nil, fmt.Errorf("could not scan analytics count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// GetDays returns a user's analytics for each day with events from one date to another, both included
+func (s *AnalyticsService) GetDays(ctx context.Context, userID int, from, to string) ([]AnalyticsDay, error) {
+	if _, err := issuedBetween(from, to); err != nil {
+		return nil, err
+	}
+	counts, err := s.counts(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return analyticsDays(counts), nil
+}
+
+// GetListings returns the analytics of each of a user's listings with events from one date to another, both included
+func (s *AnalyticsService) GetListings(ctx context.Context, userID int, from, to string) ([]ListingAnalytics, error) {
+	if _, err := issuedBetween(from, to); err != nil {
+		return nil, err
+	}
+	counts, err := s.counts(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	listings := analyticsListings(counts)
+
+	// Deleted and purged listings keep their analytics, under the title they had if it is still known
+	rows, err := s.db.QueryContext(ctx, `SELECT listing_id, title FROM listings WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve listing titles: %w", err)
+	}
+	defer rows.Close()
+	titles := map[int]string{}
+	for rows.Next() {
+		var listingID int
+		var title string
+		if err := rows.Scan(&listingID, &title); err != nil {
+			return nil, fmt.Errorf("could not scan listing title: %w", err)
+		}
+		titles[listingID] = title
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range listings {
+		listings[i].Title = titles[listings[i].ListingID]
+	}
+	return listings, nil
+}
+
+// GetFunnel follows the transactions a tradesman was offered from one date to another, both included
+func (s *AnalyticsService) GetFunnel(ctx context.Context, userID int, from, to string) (Funnel, error) {
+	until, err := issuedBetween(from, to)
+	if err != nil {
+		return Funnel{}, err
+	}
+
+	// A payment is only held on acceptance, so cancelled transactions with one were accepted first
+	var offers, accepted, completed, cancelled int
+	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*),
+	          COALESCE(SUM(CASE WHEN status IN ('Accepted', 'Completed') OR EXISTS (SELECT 1 FROM payments p WHERE p.transaction_id = t.transaction_id) THEN 1 ELSE 0 END), 0),
+	          COALESCE(SUM(CASE WHEN status = 'Completed' THEN 1 ELSE 0 END), 0),
+	          COALESCE(SUM(CASE WHEN status = 'Cancelled' THEN 1 ELSE 0 END), 0)
+	          FROM transactions t WHERE user_offering_id = ? AND deleted_at IS NULL AND date_created >= ? AND date_created < ?`,
+		userID, from, until).Scan(&offers, &accepted, &completed, &cancelled)
+	if err != nil {
+		return Funnel{}, fmt.Errorf("could not count transactions: %w", err)
+	}
+	return newFunnel(offers, accepted, completed, cancelled), nil
+}
+
+// GetRevenue returns what a tradesman was paid out of escrow by month from one date to another, both included
+func (s *AnalyticsService) GetRevenue(ctx context.Context, userID int, from, to string) ([]MonthlyRevenue, error) {
+	until, err := issuedBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT amount_minor, currency, `+s.db.Dialect.Timestamp("date_created")+` FROM ledger_entries
+	          WHERE account = ? AND movement = ? AND date_created >= ? AND date_created < ?`, UserAccount(userID), MovementRelease, from, until)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve payouts: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var entry LedgerEntry
+		var amount int64
+		if err := rows.Scan(&amount, &entry.Currency, &entry.DateCreated); err != nil {
+			return nil, fmt.Errorf("could not scan payout: %w", err)
+		}
+		entry.Amount = majorUnits(amount, entry.Currency)
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return monthlyRevenue(entries), nil
+}
@@ -0,0 +1,201 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// APIClientMemory is the in-memory implementation of the APIClients interface
+type APIClientMemory struct {
+	store *memoryStore
+}
+
+// Create registers a client and issues its key
+func (s *APIClientMemory) Create(ctx context.Context, client APIClient) (APIClient, error) {
+	if err := client.check(); err != nil {
+		return APIClient{}, err
+	}
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not issue API key: %w", err)
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	s.store.nextAPIClientID++
+	client.ClientID = s.store.nextAPIClientID
+	client.KeyPrefix = prefix
+	client.DateCreated = now()
+	client.RevokedAt = ""
+	client.Key = ""
+	s.store.apiClients[client.ClientID] = client
+	s.store.apiKeys[hash] = client.ClientID
+
+	client.Key = key
+	return client, nil
+}
+
+// GetByID returns a single client, without its key
+func (s *APIClientMemory) GetByID(ctx context.Context, clientID int) (APIClient, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	client, ok := s.store.apiClients[clientID]
+	if !ok {
+		return APIClient{}, fmt.Errorf("API client %w", ErrNotFound)
+	}
+	return client, nil
+}
+
+// GetByUser returns the clients a user registered, oldest first
+func (s *APIClientMemory) GetByUser(ctx context.Context, userID int) ([]APIClient, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	clients := []APIClient{}
+	for _, id := range sortedKeys(s.store.apiClients) {
+		if client := s.store.apiClients[id]; client.UserID == userID {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+// GetAll returns every client, oldest first
+func (s *APIClientMemory) GetAll(ctx context.Context) ([]APIClient, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	clients := []APIClient{}
+	for _, id := range sortedKeys(s.store.apiClients) {
+		clients = append(clients, s.store.apiClients[id])
+	}
+	return clients, nil
+}
+
+// Rotate issues a new key for a client. The previous key stops working at once.
+func (s *APIClientMemory) Rotate(ctx context.Context, clientID int) (APIClient, error) {
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not issue API key: %w", err)
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	client, ok := s.store.apiClients[clientID]
+	if !ok {
+		return APIClient{}, fmt.Errorf("API client %w", ErrNotFound)
+	}
+	if client.RevokedAt != "" {
+		return APIClient{}, fmt.Errorf("API client was revoked: %w", ErrConflict)
+	}
+	s.forgetKey(clientID)
+	client.KeyPrefix = prefix
+	s.store.apiClients[clientID] = client
+	s.store.apiKeys[hash] = clientID
+
+	client.Key = key
+	return client, nil
+}
+
+// Revoke stops a client's key from working. Its usage is kept.
+func (s *APIClientMemory) Revoke(ctx context.Context, clientID int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	client, ok := s.store.apiClients[clientID]
+	if !ok {
+		return fmt.Errorf("API client %w", ErrNotFound)
+	}
+	if client.RevokedAt != "" {
+		return fmt.Errorf("API client was already revoked: %w", ErrConflict)
+	}
+	s.forgetKey(clientID)
+	client.RevokedAt = now()
+	s.store.apiClients[clientID] = client
+	return nil
+}
+
+// forgetKey removes the hash of a client's key. The caller holds the lock.
+func (s *APIClientMemory) forgetKey(clientID int) {
+	for hash, id := range s.store.apiKeys {
+		if id == clientID {
+			delete(s.store.apiKeys, hash)
+		}
+	}
+}
+
+// SetLimits changes a client's rate limit and daily quota
+func (s *APIClientMemory) SetLimits(ctx context.Context, clientID int, limits APILimits) (APIClient, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	client, ok := s.store.apiClients[clientID]
+	if !ok {
+		return APIClient{}, fmt.Errorf("API client %w", ErrNotFound)
+	}
+	client.RateLimit, client.DailyQuota = limits.RateLimit, limits.DailyQuota
+	s.store.apiClients[clientID] = client
+	return client, nil
+}
+
+// Authenticate returns the client of a key, refusing revoked keys and the keys of closed accounts
+func (s *APIClientMemory) Authenticate(ctx context.Context, key string) (APIClient, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	clientID, ok := s.store.apiKeys[hashAPIKey(key)]
+	if !ok {
+		return APIClient{}, fmt.Errorf("invalid API key: %w", ErrUnauthorized)
+	}
+	client := s.store.apiClients[clientID]
+	if owner, ok := s.store.users[client.UserID]; !ok || owner.DeletedAt != "" {
+		return APIClient{}, fmt.Errorf("invalid API key: %w", ErrUnauthorized)
+	}
+	return client, nil
+}
+
+// Meter counts a request of a client on a day, reporting whether it was within the
+// daily quota (0 for none). Requests over the quota are counted as rejected.
+func (s *APIClientMemory) Meter(ctx context.Context, clientID int, day string, quota int) (bool, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	days, ok := s.store.apiUsage[clientID]
+	if !ok {
+		days = map[string]APIUsage{}
+		s.store.apiUsage[clientID] = days
+	}
+	usage := days[day]
+	usage.Date = day
+	allowed := quota == 0 || usage.Requests < quota
+	if allowed {
+		usage.Requests++
+	} else {
+		usage.Rejected++
+	}
+	days[day] = usage
+	return allowed, nil
+}
+
+// GetUsage returns a client's usage for each day it was used from one date to another, both included
+func (s *APIClientMemory) GetUsage(ctx context.Context, clientID int, from, to string) ([]APIUsage, error) {
+	if _, err := issuedBetween(from, to); err != nil {
+		return nil, err
+	}
+
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	usage := []APIUsage{}
+	for day, used := range s.store.apiUsage[clientID] {
+		if day >= from && day <= to {
+			usage = append(usage, used)
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Date < usage[j].Date })
+	return usage, nil
+}
@@ -0,0 +1,217 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"strings"
+)
+
+type APIClientService struct {
+	db *Database.DB
+}
+
+// apiClientColumns selects a client for scanAPIClient
+func apiClientColumns(d Database.Dialect) string {
+	return `client_id, user_id, name, scopes, key_prefix, rate_limit, daily_quota, ` + d.Timestamp("date_created") + `, COALESCE(` + d.Timestamp("revoked_at") + `, '')`
+}
+
+// scanAPIClient reads a row selected with apiClientColumns
+func scanAPIClient(row interface{ Scan(...interface{}) error }) (APIClient, error) {
+	var client APIClient
+	var scopes string
+	err := row.Scan(&client.ClientID, &client.UserID, &client.Name, &scopes, &client.KeyPrefix, &client.RateLimit, &client.DailyQuota, &client.DateCreated, &client.RevokedAt)
+	client.Scopes = splitScopes(scopes)
+	return client, err
+}
+
+// Create registers a client and issues its key
+func (s *APIClientService) Create(ctx context.Context, client APIClient) (APIClient, error) {
+	if err := client.check(); err != nil {
+		return APIClient{}, err
+	}
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not issue API key: %w", err)
+	}
+
+	id, err := s.db.InsertID(ctx, `INSERT INTO api_clients (user_id, name, scopes, key_prefix, key_hash, rate_limit, daily_quota) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"client_id", client.UserID, client.Name, strings.Join(client.Scopes, ","), prefix, hash, client.RateLimit, client.DailyQuota)
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not create API client: %w", err)
+	}
+
+	created, err := s.GetByID(ctx, int(id))
+	if err != nil {
+		return APIClient{}, err
+	}
+	created.Key = key
+	return created, nil
+}
+
+// GetByID returns a single client, without its key
+func (s *APIClientService) GetByID(ctx context.Context, clientID int) (APIClient, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiClientColumns(s.db.Dialect)+` FROM api_clients WHERE client_id = ?`, clientID)
+	client, err := scanAPIClient(row)
+	if err == sql.ErrNoRows {
+		return APIClient{}, fmt.Errorf("API client %w", ErrNotFound)
+	}
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not retrieve API client: %w", err)
+	}
+	return client, nil
+}
+
+// GetByUser returns the clients a user registered, oldest first
+func (s *APIClientService) GetByUser(ctx context.Context, userID int) ([]APIClient, error) {
+	return s.query(ctx, `SELECT `+apiClientColumns(s.db.Dialect)+` FROM api_clients WHERE user_id = ? ORDER BY client_id`, userID)
+}
+
+// GetAll returns every client, oldest first
+func (s *APIClientService) GetAll(ctx context.Context) ([]APIClient, error) {
+	return s.query(ctx, `SELECT `+apiClientColumns(s.db.Dialect)+` FROM api_clients ORDER BY client_id`)
+}
+
+// query returns the clients selected with apiClientColumns
+func (s *APIClientService) query(ctx context.Context, query string, args ...interface{}) ([]APIClient, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve API clients: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []APIClient{}
+	for rows.Next() {
+		client, err := scanAPIClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan API client: %w", err)
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// Rotate issues a new key for a client. The previous key stops working at once.
+func (s *APIClientService) Rotate(ctx context.Context, clientID int) (APIClient, error) {
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not issue API key: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE api_clients SET key_prefix = ?, key_hash = ? WHERE client_id = ? AND revoked_at IS NULL`, prefix, hash, clientID)
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not rotate API key: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		if _, err := s.GetByID(ctx, clientID); err != nil {
+			return APIClient{}, err
+		}
+		return APIClient{}, fmt.Errorf("API client was revoked: %w", ErrConflict)
+	}
+
+	client, err := s.GetByID(ctx, clientID)
+	if err != nil {
+		return APIClient{}, err
+	}
+	client.Key = key
+	return client, nil
+}
+
+// Revoke stops a client's key from working. Its usage is kept.
+func (s *APIClientService) Revoke(ctx context.Context, clientID int) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE api_clients SET revoked_at = CURRENT_TIMESTAMP WHERE client_id = ? AND revoked_at IS NULL`, clientID)
+	if err != nil {
+		return fmt.Errorf("could not revoke API client: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		if _, err := s.GetByID(ctx, clientID); err != nil {
+			return err
+		}
+		return fmt.Errorf("API client was already revoked: %w", ErrConflict)
+	}
+	return nil
+}
+
+// SetLimits changes a client's rate limit and daily quota
+func (s *APIClientService) SetLimits(ctx context.Context, clientID int, limits APILimits) (APIClient, error) {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_clients SET rate_limit = ?, daily_quota = ? WHERE client_id = ?`, limits.RateLimit, limits.DailyQuota, clientID)
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not change API client limits: %w", err)
+	}
+	return s.GetByID(ctx, clientID)
+}
+
+// Authenticate returns the client of a key, refusing revoked keys and the keys of closed accounts
+func (s *APIClientService) Authenticate(ctx context.Context, key string) (APIClient, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiClientColumns(s.db.Dialect)+` FROM api_clients
+	          WHERE key_hash = ? AND revoked_at IS NULL AND user_id IN (SELECT user_id FROM users WHERE deleted_at IS NULL)`, hashAPIKey(key))
+	client, err := scanAPIClient(row)
+	if err == sql.ErrNoRows {
+		return APIClient{}, fmt.Errorf("invalid API key: %w", ErrUnauthorized)
+	}
+	if err != nil {
+		return APIClient{}, fmt.Errorf("could not authenticate API key: %w", err)
+	}
+	return client, nil
+}
+
+// Meter counts a request of a client on a day, reporting whether it was within the
+// daily quota (0 for none). Requests over the quota are counted as rejected.
+func (s *APIClientService) Meter(ctx context.Context, clientID int, day string, quota int) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The first request of the day creates the row; concurrent ones find it there instead of clashing
+	_, err = tx.ExecContext(ctx, `INSERT INTO api_usage (client_id, day, requests) VALUES (?, ?, 0) `+s.db.Dialect.IgnoreConflict("client_id", "day"),
+		clientID, day)
+	if err != nil {
+		return false, fmt.Errorf("could not meter API request: %w", err)
+	}
+
+	// The quota is checked by the update itself, so concurrent requests cannot overshoot it
+	query, args := `UPDATE api_usage SET requests = requests + 1 WHERE client_id = ? AND day = ?`, []interface{}{clientID, day}
+	if quota > 0 {
+		query, args = query+` AND requests < ?`, append(args, quota)
+	}
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("could not meter API request: %w", err)
+	}
+	allowed := true
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		allowed = false
+		_, err = tx.ExecContext(ctx, `UPDATE api_usage SET rejected = rejected + 1 WHERE client_id = ? AND day = ?`, clientID, day)
+		if err != nil {
+			return false, fmt.Errorf("could not meter API request: %w", err)
+		}
+	}
+	return allowed, tx.Commit()
+}
+
+// GetUsage returns a client's usage for each day it was used from one date to another, both included
+func (s *APIClientService) GetUsage(ctx context.Context, clientID int, from, to string) ([]APIUsage, error) {
+	if _, err := issuedBetween(from, to); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+s.db.Dialect.Date("day")+`, requests, rejected FROM api_usage
+	          WHERE client_id = ? AND day >= ? AND day <= ? ORDER BY day`, clientID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve API usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []APIUsage{}
+	for rows.Next() {
+		var used APIUsage
+		if err := rows.Scan(&used.Date, &used.Requests, &used.Rejected); err != nil {
+			return nil, fmt.Errorf("could not scan API usage: %w", err)
+		}
+		usage = append(usage, used)
+	}
+	return usage, rows.Err()
+}
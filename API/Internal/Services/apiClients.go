@@ -0,0 +1,137 @@
+package Services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Scopes of API clients, each opening a part of the public read-only API
+const (
+	ScopeListings = "listings:read"
+	ScopeRegions  = "regions:read"
+	ScopeAreas    = "areas:read"
+)
+
+// APIScopes are the scopes clients can be granted
+var APIScopes = []string{ScopeListings, ScopeRegions, ScopeAreas}
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise
+const apiKeyPrefix = "mbk_"
+
+// APIClient is a third party calling the public API with a key. The key is only
+// returned when it is issued; afterwards KeyPrefix tells the client's keys apart.
+type APIClient struct {
+	// @example 1
+	ClientID int `json:"client_id"`
+
+	// UserID is the user who registered the client and manages its key
+	// @example 2
+	UserID int `json:"user_id"`
+
+	// @example "Beirut property portal"
+	Name string `json:"name" validate:"required,max=100"`
+
+	// Scopes are the parts of the public API the client may call
+	// @example ["listings:read", "regions:read"]
+	Scopes []string `json:"scopes"`
+
+	// Key is sent in the X-API-Key header. It is only shown when the client is created or its key rotated.
+	// @example "mbk_3f9a1c0e5b7d2a4c6e8f0a1b3c5d7e9f1a2b3c4d"
+	Key string `json:"key,omitempty"`
+
+	// @example "mbk_3f9a1c0e"
+	KeyPrefix string `json:"key_prefix"`
+
+	// RateLimit is how many requests the client may make per minute
+	// @example 60
+	RateLimit int `json:"rate_limit"`
+
+	// DailyQuota is how many requests the client may make per day, 0 for no quota
+	// @example 10000
+	DailyQuota int `json:"daily_quota"`
+
+	// @example "2025-01-10 09:00:00"
+	DateCreated string `json:"date_created"`
+
+	// RevokedAt is set once the client's key no longer works
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+// APIUsage counts a client's requests on one day
+type APIUsage struct {
+	// Format: "2006-01-02"
+	// @example "2025-01-10"
+	Date string `json:"date"`
+
+	// Requests counts the requests served
+	// @example 1250
+	Requests int `json:"requests"`
+
+	// Rejected counts the requests refused once the daily quota was used up
+	// @example 12
+	Rejected int `json:"rejected"`
+}
+
+// APILimits are the rate limit and daily quota an admin sets for a client
+type APILimits struct {
+	// @example 120
+	RateLimit int `json:"rate_limit" validate:"min=1"`
+
+	// @example 50000
+	DailyQuota int `json:"daily_quota" validate:"min=0"`
+}
+
+// HasScope reports whether the client was granted scope
+func (c APIClient) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// check sorts the scopes of a new client and refuses unknown ones
+func (c *APIClient) check() error {
+	if len(c.Scopes) == 0 {
+		return Invalid("scopes", "must not be empty")
+	}
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, scope := range c.Scopes {
+		if !slices.Contains(APIScopes, scope) {
+			return Invalid("scopes", "must be among "+strings.Join(APIScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	c.Scopes = scopes
+	return nil
+}
+
+// newAPIKey returns a random key with the prefix and hash stored in its place
+func newAPIKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(secret)
+	return key, key[:len(apiKeyPrefix)+8], hashAPIKey(key), nil
+}
+
+// hashAPIKey is what is stored of a key. Keys are long and random, so unlike
+// passwords a fast hash is enough, and it lets keys be looked up by their hash.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitScopes reads scopes stored comma separated
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
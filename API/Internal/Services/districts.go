@@ -0,0 +1,70 @@
+package Services
+
+import "strings"
+
+// District is a named area a service area can be copied from instead of drawing a polygon
+type District struct {
+	// @example "Metn"
+	Name string `json:"name"`
+
+	// @example "المتن"
+	NameAr string `json:"name_ar"`
+
+	// @example "Mount Lebanon"
+	Governorate string `json:"governorate"`
+
+	Polygon Polygon `json:"polygon"`
+}
+
+// box is the closed ring of a rectangle
+func box(minLng, minLat, maxLng, maxLat float64) Polygon {
+	return Polygon{{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat}}
+}
+
+// Districts are the districts of Lebanon. Their boundaries are rough rectangles around each
+// district, good enough to say where a tradesman works; draw a polygon for anything finer.
+var Districts = []District{
+	{"Beirut", "بيروت", "Beirut", box(35.46, 33.86, 35.54, 33.91)},
+
+	{"Baabda", "بعبدا", "Mount Lebanon", box(35.48, 33.76, 35.72, 33.86)},
+	{"Metn", "المتن", "Mount Lebanon", box(35.54, 33.86, 35.82, 33.98)},
+	{"Keserwan", "كسروان", "Mount Lebanon", box(35.60, 33.98, 35.92, 34.10)},
+	{"Jbeil", "جبيل", "Mount Lebanon", box(35.62, 34.10, 36.02, 34.20)},
+	{"Aley", "عاليه", "Mount Lebanon", box(35.48, 33.66, 35.72, 33.76)},
+	{"Chouf", "الشوف", "Mount Lebanon", box(35.38, 33.52, 35.72, 33.66)},
+
+	{"Tripoli", "طرابلس", "North", box(35.78, 34.38, 35.88, 34.48)},
+	{"Zgharta", "زغرتا", "North", box(35.90, 34.22, 36.05, 34.42)},
+	{"Koura", "الكورة", "North", box(35.75, 34.30, 35.90, 34.38)},
+	{"Batroun", "البترون", "North", box(35.63, 34.20, 35.90, 34.30)},
+	{"Bsharri", "بشري", "North", box(35.90, 34.16, 36.15, 34.30)},
+	{"Minieh-Danniyeh", "المنية-الضنية", "North", box(35.85, 34.40, 36.15, 34.52)},
+
+	{"Akkar", "عكار", "Akkar", box(35.95, 34.52, 36.45, 34.70)},
+
+	{"Sidon", "صيدا", "South", box(35.30, 33.45, 35.50, 33.60)},
+	{"Jezzine", "جزين", "South", box(35.50, 33.45, 35.70, 33.60)},
+	{"Tyre", "صور", "South", box(35.10, 33.05, 35.40, 33.35)},
+
+	{"Nabatieh", "النبطية", "Nabatieh", box(35.40, 33.30, 35.60, 33.45)},
+	{"Marjeyoun", "مرجعيون", "Nabatieh", box(35.55, 33.25, 35.70, 33.40)},
+	{"Hasbaya", "حاصبيا", "Nabatieh", box(35.65, 33.30, 35.85, 33.45)},
+	{"Bint Jbeil", "بنت جبيل", "Nabatieh", box(35.30, 33.05, 35.55, 33.25)},
+
+	{"Zahle", "زحلة", "Bekaa", box(35.80, 33.75, 36.05, 33.95)},
+	{"West Bekaa", "البقاع الغربي", "Bekaa", box(35.60, 33.45, 35.90, 33.70)},
+	{"Rashaya", "راشيا", "Bekaa", box(35.75, 33.40, 36.00, 33.60)},
+
+	{"Baalbek", "بعلبك", "Baalbek-Hermel", box(36.00, 33.90, 36.45, 34.25)},
+	{"Hermel", "الهرمل", "Baalbek-Hermel", box(36.25, 34.25, 36.60, 34.65)},
+}
+
+// DistrictByName looks up a district, ignoring case
+func DistrictByName(name string) (District, bool) {
+	for _, district := range Districts {
+		if strings.EqualFold(district.Name, strings.TrimSpace(name)) {
+			return district, true
+		}
+	}
+	return District{}, false
+}
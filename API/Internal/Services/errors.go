@@ -0,0 +1,44 @@
+package Services
+
+import (
+	"errors"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"strings"
+)
+
+// Sentinel errors returned (wrapped) by every Service implementation.
+// Controllers match them with errors.Is to choose the HTTP status,
+// e.g. fmt.Errorf("listing %w", ErrNotFound) reads "listing not found".
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrValidation   = errors.New("validation failed")
+	// ErrPaymentFailed is returned when the payment provider refuses or fails to move money
+	ErrPaymentFailed = errors.New("payment failed")
+	// ErrPlanLimit is returned when the user's plan does not allow what they asked for
+	ErrPlanLimit = errors.New("plan limit reached")
+)
+
+// ValidationError lists every invalid field of a request. It matches ErrValidation.
+type ValidationError struct {
+	Fields []Utils.FieldError
+}
+
+// Invalid returns a ValidationError for a single field
+func Invalid(field, message string) *ValidationError {
+	return &ValidationError{Fields: []Utils.FieldError{{Field: field, Message: message}}}
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, ", ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
@@ -0,0 +1,91 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+	"sort"
+)
+
+// ExchangeRateMemory is the in-memory implementation of the ExchangeRates interface
+type ExchangeRateMemory struct {
+	store    *memoryStore
+	provider Rates.Provider
+}
+
+// Set stores an admin's rate from one currency to another, replacing the one set before
+func (s *ExchangeRateMemory) Set(ctx context.Context, rate ExchangeRate) (ExchangeRate, error) {
+	rate, err := checkRate(rate)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	rate.Date = now()
+	s.store.exchangeRates[[2]string{rate.From, rate.To}] = rate
+	return rate, nil
+}
+
+// GetAll returns the rates set by admins, by currency pair
+func (s *ExchangeRateMemory) GetAll(ctx context.Context) ([]ExchangeRate, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	rates := []ExchangeRate{}
+	for _, rate := range s.store.exchangeRates {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].From != rates[j].From {
+			return rates[i].From < rates[j].From
+		}
+		return rates[i].To < rates[j].To
+	})
+	return rates, nil
+}
+
+// Delete removes an admin's rate, so the provider quotes the pair again
+func (s *ExchangeRateMemory) Delete(ctx context.Context, from, to string) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	key := [2]string{NormaliseCurrency(from), NormaliseCurrency(to)}
+	if _, ok := s.store.exchangeRates[key]; !ok {
+		return fmt.Errorf("exchange rate %w", ErrNotFound)
+	}
+	delete(s.store.exchangeRates, key)
+	return nil
+}
+
+// Quote returns the current rate from one currency to another
+func (s *ExchangeRateMemory) Quote(ctx context.Context, from, to string) (ExchangeRate, error) {
+	return quoteRate(ctx, from, to, func(from, to string) (ExchangeRate, bool, error) {
+		s.store.mu.RLock()
+		defer s.store.mu.RUnlock()
+		rate, ok := s.store.exchangeRates[[2]string{from, to}]
+		return rate, ok, nil
+	}, s.provider)
+}
+
+// Record keeps the rates of a transaction as they were when it was accepted. They are
+// recorded once, so the rates already recorded are returned instead of the new ones.
+func (s *ExchangeRateMemory) Record(ctx context.Context, transactionID int, rates []ExchangeRate) ([]ExchangeRate, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if recorded, ok := s.store.transactionRates[transactionID]; ok || len(rates) == 0 {
+		return append([]ExchangeRate{}, recorded...), nil
+	}
+	s.store.transactionRates[transactionID] = append([]ExchangeRate{}, rates...)
+	return append([]ExchangeRate{}, rates...), nil
+}
+
+// GetRecorded returns the rates recorded when a transaction was accepted, none before
+func (s *ExchangeRateMemory) GetRecorded(ctx context.Context, transactionID int) ([]ExchangeRate, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	return append([]ExchangeRate{}, s.store.transactionRates[transactionID]...), nil
+}
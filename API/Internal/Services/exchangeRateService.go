@@ -0,0 +1,151 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+)
+
+type ExchangeRateService struct {
+	db       *Database.DB
+	provider Rates.Provider
+}
+
+// Set stores an admin's rate from one currency to another, replacing the one set before
+func (s *ExchangeRateService) Set(ctx context.Context, rate ExchangeRate) (ExchangeRate, error) {
+	rate, err := checkRate(rate)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM exchange_rates WHERE currency_from = ? AND currency_to = ?`, rate.From, rate.To); err != nil {
+		return ExchangeRate{}, fmt.Errorf("could not replace exchange rate: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO exchange_rates (currency_from, currency_to, rate, set_by) VALUES (?, ?, ?, ?)`,
+		rate.From, rate.To, rate.Rate, rate.SetBy)
+	if err != nil {
+		return ExchangeRate{}, fmt.Errorf("could not set exchange rate: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return ExchangeRate{}, err
+	}
+
+	stored, _, err := s.manual(ctx, rate.From, rate.To)
+	return stored, err
+}
+
+// GetAll returns the rates set by admins, by currency pair
+func (s *ExchangeRateService) GetAll(ctx context.Context) ([]ExchangeRate, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT currency_from, currency_to, rate, set_by, `+s.db.Dialect.Timestamp("date_set")+`
+	          FROM exchange_rates ORDER BY currency_from, currency_to`)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		rate := ExchangeRate{Source: RateManual}
+		if err := rows.Scan(&rate.From, &rate.To, &rate.Rate, &rate.SetBy, &rate.Date); err != nil {
+			return nil, fmt.Errorf("could not scan exchange rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// Delete removes an admin's rate, so the provider quotes the pair again
+func (s *ExchangeRateService) Delete(ctx context.Context, from, to string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM exchange_rates WHERE currency_from = ? AND currency_to = ?`,
+		NormaliseCurrency(from), NormaliseCurrency(to))
+	if err != nil {
+		return fmt.Errorf("could not delete exchange rate: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("exchange rate %w", ErrNotFound)
+	}
+	return nil
+}
+
+// manual returns the rate an admin set from one currency to another, if any
+func (s *ExchangeRateService) manual(ctx context.Context, from, to string) (ExchangeRate, bool, error) {
+	rate := ExchangeRate{From: from, To: to, Source: RateManual}
+	err := s.db.QueryRowContext(ctx, `SELECT rate, set_by, `+s.db.Dialect.Timestamp("date_set")+` FROM exchange_rates
+	          WHERE currency_from = ? AND currency_to = ?`, from, to).Scan(&rate.Rate, &rate.SetBy, &rate.Date)
+	if err == sql.ErrNoRows {
+		return ExchangeRate{}, false, nil
+	}
+	if err != nil {
+		return ExchangeRate{}, false, fmt.Errorf("could not retrieve exchange rate: %w", err)
+	}
+	return rate, true, nil
+}
+
+// Quote returns the current rate from one currency to another
+func (s *ExchangeRateService) Quote(ctx context.Context, from, to string) (ExchangeRate, error) {
+	return quoteRate(ctx, from, to, func(from, to string) (ExchangeRate, bool, error) {
+		return s.manual(ctx, from, to)
+	}, s.provider)
+}
+
+// Record keeps the rates of a transaction as they were when it was accepted. They are
+// recorded once, so the rates already recorded are returned instead of the new ones.
+func (s *ExchangeRateService) Record(ctx context.Context, transactionID int, rates []ExchangeRate) ([]ExchangeRate, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var recorded int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM transaction_rates WHERE transaction_id = ?`, transactionID).Scan(&recorded)
+	if err != nil {
+		return nil, fmt.Errorf("could not check exchange rates: %w", err)
+	}
+	if recorded > 0 {
+		// SQLite has a single connection, which the transaction holds
+		tx.Rollback()
+		return s.GetRecorded(ctx, transactionID)
+	}
+	for _, rate := range rates {
+		_, err := tx.ExecContext(ctx, `INSERT INTO transaction_rates (transaction_id, currency_from, currency_to, rate, source, date_quoted)
+		          VALUES (?, ?, ?, ?, ?, ?)`, transactionID, rate.From, rate.To, rate.Rate, rate.Source, rate.Date)
+		if err != nil {
+			return nil, fmt.Errorf("could not record exchange rate: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetRecorded(ctx, transactionID)
+}
+
+// GetRecorded returns the rates recorded when a transaction was accepted, none before
+func (s *ExchangeRateService) GetRecorded(ctx context.Context, transactionID int) ([]ExchangeRate, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT currency_from, currency_to, rate, source, `+s.db.Dialect.Timestamp("date_quoted")+`
+	          FROM transaction_rates WHERE transaction_id = ? ORDER BY currency_to`, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.From, &rate.To, &rate.Rate, &rate.Source, &rate.Date); err != nil {
+			return nil, fmt.Errorf("could not scan exchange rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
@@ -0,0 +1,130 @@
+package Services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+)
+
+// RateManual is the source of rates set by admins, which take precedence over the provider's
+const RateManual = "manual"
+
+// ExchangeRate is the rate between two currencies: an amount in From times Rate is its worth in To
+type ExchangeRate struct {
+	// @example "USD"
+	From string `json:"currency_from" validate:"required,currency"`
+
+	// @example "LBP"
+	To string `json:"currency_to" validate:"required,currency"`
+
+	// @example 89500
+	Rate float64 `json:"rate" validate:"required"`
+
+	// Source is manual for rates set by admins, otherwise the provider the rate was quoted from
+	// @example "manual"
+	Source string `json:"source"`
+
+	// Date is when the rate was set or published
+	// @example "2025-01-10 00:00:00"
+	Date string `json:"date"`
+
+	// SetBy is the admin who set a manual rate
+	// @example 1
+	SetBy int `json:"set_by,omitempty"`
+}
+
+// ConvertedAmount is an amount shown in another currency than its own, for information only
+type ConvertedAmount struct {
+	// @example 13469750
+	Amount float64 `json:"amount"`
+
+	// @example "LBP"
+	Currency string `json:"currency"`
+
+	// @example 89500
+	Rate float64 `json:"rate"`
+
+	// @example "manual"
+	Source string `json:"source"`
+
+	// @example "2025-01-10 00:00:00"
+	RateDate string `json:"rate_date"`
+
+	// Recorded tells whether the rate is the one recorded when the transaction was accepted,
+	// rather than the current one
+	Recorded bool `json:"recorded"`
+}
+
+// Convert returns amount at the rate, rounded to the minor unit of the target currency
+func (r ExchangeRate) Convert(amount float64) ConvertedAmount {
+	return ConvertedAmount{Amount: roundMoney(amount*r.Rate, r.To), Currency: r.To, Rate: r.Rate, Source: r.Source, RateDate: r.Date}
+}
+
+// checkRate normalises a manual rate and checks it can be stored
+func checkRate(rate ExchangeRate) (ExchangeRate, error) {
+	rate.From, rate.To = NormaliseCurrency(rate.From), NormaliseCurrency(rate.To)
+	if rate.From == rate.To {
+		return ExchangeRate{}, Invalid("currency_to", "must differ from currency_from")
+	}
+	if rate.Rate <= 0 {
+		return ExchangeRate{}, Invalid("rate", "must be positive")
+	}
+	rate.Source = RateManual
+	return rate, nil
+}
+
+// quoteRate looks a pair of currencies up among the manual rates, as set or inverted, and
+// asks the provider for those the admins did not set. It wraps Rates.ErrNoRate when
+// nobody has a rate.
+func quoteRate(ctx context.Context, from, to string, manual func(from, to string) (ExchangeRate, bool, error), provider Rates.Provider) (ExchangeRate, error) {
+	from, to = NormaliseCurrency(from), NormaliseCurrency(to)
+	if from == to {
+		return ExchangeRate{From: from, To: to, Rate: 1, Source: RateManual}, nil
+	}
+
+	rate, ok, err := manual(from, to)
+	if err != nil || ok {
+		return rate, err
+	}
+	rate, ok, err = manual(to, from)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	if ok {
+		return ExchangeRate{From: from, To: to, Rate: 1 / rate.Rate, Source: RateManual, Date: rate.Date, SetBy: rate.SetBy}, nil
+	}
+
+	if provider == nil {
+		return ExchangeRate{}, fmt.Errorf("%w from %s to %s", Rates.ErrNoRate, from, to)
+	}
+	quote, err := provider.Quote(ctx, from, to)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	return ExchangeRate{From: from, To: to, Rate: quote.Rate, Source: provider.Name(), Date: quote.AsOf}, nil
+}
+
+// QuoteEach quotes the rates from one currency to each of the others, skipping itself,
+// duplicates and the currencies nobody has a rate for
+func QuoteEach(ctx context.Context, quote func(ctx context.Context, from, to string) (ExchangeRate, error), from string, to []string) ([]ExchangeRate, error) {
+	quoted := []ExchangeRate{}
+	seen := map[string]bool{NormaliseCurrency(from): true}
+	for _, currency := range to {
+		currency = NormaliseCurrency(currency)
+		if currency == "" || seen[currency] {
+			continue
+		}
+		seen[currency] = true
+
+		rate, err := quote(ctx, from, currency)
+		if errors.Is(err, Rates.ErrNoRate) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		quoted = append(quoted, rate)
+	}
+	return quoted, nil
+}
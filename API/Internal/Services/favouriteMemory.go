@@ -0,0 +1,191 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// favourite is a stored row of a user's favourites (shortlistID 0) or one of their shortlists
+type favourite struct {
+	id          int
+	userID      int
+	shortlistID int
+	item        ShortlistItem
+}
+
+// FavouriteMemory is the in-memory implementation of the Favourites interface
+type FavouriteMemory struct {
+	store *memoryStore
+}
+
+// find returns the ID of a stored favourite, or 0. The caller holds the lock.
+func (f *FavouriteMemory) find(userID, shortlistID int, kind string, targetID int) int {
+	for id, stored := range f.store.favourites {
+		if stored.userID != userID || stored.shortlistID != shortlistID || stored.item.Kind != kind {
+			continue
+		}
+		if (kind == FavouriteListing && stored.item.ListingID == targetID) || (kind == FavouriteUser && stored.item.UserID == targetID) {
+			return id
+		}
+	}
+	return 0
+}
+
+// Add puts a listing or user in a user's favourites (shortlistID 0) or one of their shortlists.
+// Adding an item twice keeps the first.
+func (f *FavouriteMemory) Add(ctx context.Context, userID, shortlistID int, kind string, targetID int) error {
+	if _, err := favouriteColumn(kind); err != nil {
+		return err
+	}
+
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+
+	if f.find(userID, shortlistID, kind, targetID) != 0 {
+		return nil
+	}
+	item := ShortlistItem{Kind: kind, DateAdded: now()}
+	if kind == FavouriteListing {
+		item.ListingID = targetID
+	} else {
+		item.UserID = targetID
+	}
+	f.store.nextFavouriteID++
+	f.store.favourites[f.store.nextFavouriteID] = favourite{id: f.store.nextFavouriteID, userID: userID, shortlistID: shortlistID, item: item}
+	return nil
+}
+
+// Remove takes a listing or user out of a user's favourites (shortlistID 0) or one of their shortlists
+func (f *FavouriteMemory) Remove(ctx context.Context, userID, shortlistID int, kind string, targetID int) error {
+	if _, err := favouriteColumn(kind); err != nil {
+		return err
+	}
+
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+
+	id := f.find(userID, shortlistID, kind, targetID)
+	if id == 0 {
+		return fmt.Errorf("favourite %w", ErrNotFound)
+	}
+	delete(f.store.favourites, id)
+	return nil
+}
+
+// Items returns the listings and users in a user's favourites (shortlistID 0) or one of their shortlists,
+// most recently added first. Only the IDs are filled in.
+func (f *FavouriteMemory) Items(ctx context.Context, userID, shortlistID int) ([]ShortlistItem, error) {
+	f.store.mu.RLock()
+	defer f.store.mu.RUnlock()
+
+	ids := sortedKeys(f.store.favourites)
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+
+	items := []ShortlistItem{}
+	for _, id := range ids {
+		if stored := f.store.favourites[id]; stored.userID == userID && stored.shortlistID == shortlistID {
+			items = append(items, stored.item)
+		}
+	}
+	return items, nil
+}
+
+// ListingCounts returns how many users favourited or shortlisted each of an owner's listings, by listing ID.
+// Listings nobody saved are left out.
+func (f *FavouriteMemory) ListingCounts(ctx context.Context, ownerID int) (map[int]int, error) {
+	f.store.mu.RLock()
+	defer f.store.mu.RUnlock()
+
+	savers := map[int]map[int]bool{}
+	for _, stored := range f.store.favourites {
+		listing, ok := f.store.listings[stored.item.ListingID]
+		if stored.item.Kind != FavouriteListing || !ok || listing.UserID != ownerID {
+			continue
+		}
+		if savers[listing.ListingID] == nil {
+			savers[listing.ListingID] = map[int]bool{}
+		}
+		savers[listing.ListingID][stored.userID] = true
+	}
+
+	counts := map[int]int{}
+	for listingID, users := range savers {
+		counts[listingID] = len(users)
+	}
+	return counts, nil
+}
+
+// CreateShortlist stores a new, empty shortlist
+func (f *FavouriteMemory) CreateShortlist(ctx context.Context, shortlist *Shortlist) (Shortlist, error) {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+
+	f.store.nextShortlistID++
+	created := Shortlist{
+		ShortlistID: f.store.nextShortlistID,
+		UserID:      shortlist.UserID,
+		Name:        shortlist.Name,
+		DateCreated: now(),
+		Items:       []ShortlistItem{},
+	}
+	f.store.shortlists[created.ShortlistID] = created
+	return created, nil
+}
+
+// GetShortlist returns a single shortlist, without its items
+func (f *FavouriteMemory) GetShortlist(ctx context.Context, shortlistID int) (Shortlist, error) {
+	f.store.mu.RLock()
+	defer f.store.mu.RUnlock()
+
+	shortlist, ok := f.store.shortlists[shortlistID]
+	if !ok {
+		return Shortlist{}, fmt.Errorf("shortlist %w", ErrNotFound)
+	}
+	return shortlist, nil
+}
+
+// GetShortlists returns a user's shortlists, oldest first and without their items
+func (f *FavouriteMemory) GetShortlists(ctx context.Context, userID int) ([]Shortlist, error) {
+	f.store.mu.RLock()
+	defer f.store.mu.RUnlock()
+
+	shortlists := []Shortlist{}
+	for _, id := range sortedKeys(f.store.shortlists) {
+		if shortlist := f.store.shortlists[id]; shortlist.UserID == userID {
+			shortlists = append(shortlists, shortlist)
+		}
+	}
+	return shortlists, nil
+}
+
+// RenameShortlist changes the name of a shortlist
+func (f *FavouriteMemory) RenameShortlist(ctx context.Context, shortlistID int, name string) error {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+
+	shortlist, ok := f.store.shortlists[shortlistID]
+	if !ok {
+		return fmt.Errorf("shortlist %w", ErrNotFound)
+	}
+	shortlist.Name = name
+	f.store.shortlists[shortlistID] = shortlist
+	return nil
+}
+
+// DeleteShortlist removes a shortlist and its items
+func (f *FavouriteMemory) DeleteShortlist(ctx context.Context, shortlistID int) error {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+
+	if _, ok := f.store.shortlists[shortlistID]; !ok {
+		return fmt.Errorf("shortlist %w", ErrNotFound)
+	}
+	delete(f.store.shortlists, shortlistID)
+	for id, stored := range f.store.favourites {
+		if stored.shortlistID == shortlistID {
+			delete(f.store.favourites, id)
+		}
+	}
+	return nil
+}
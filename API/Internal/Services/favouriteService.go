@@ -0,0 +1,252 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+)
+
+// Kinds of things that can be favourited and shortlisted
+const (
+	FavouriteListing = "listing"
+	FavouriteUser    = "user"
+)
+
+// ShortlistItem is a listing or a tradesman in a user's favourites or one of their shortlists
+type ShortlistItem struct {
+	// Kind is listing or user
+	// @example "listing"
+	Kind string `json:"kind"`
+
+	// @example 101
+	ListingID int `json:"listing_id,omitempty"`
+
+	// UserID is the favourited user, for items of kind user
+	// @example 2
+	UserID int `json:"user_id,omitempty"`
+
+	// @example "2024-12-16 14:30:00"
+	DateAdded string `json:"date_added"`
+
+	// Listing or User is the item as the viewer may currently see it
+	Listing *Listing `json:"listing,omitempty"`
+	User    *Profile `json:"user,omitempty"`
+
+	// Notice explains why an item is no longer available, instead of dropping it silently
+	// @example "This listing has expired"
+	Notice string `json:"notice,omitempty"`
+}
+
+// Shortlist is a named list of listings and tradesmen, e.g. for one project
+type Shortlist struct {
+	// @example 1
+	ShortlistID int `json:"shortlist_id"`
+
+	// @example 1
+	UserID int `json:"user_id"`
+
+	// @example "Kitchen renovation"
+	Name string `json:"name" validate:"required,max=100"`
+
+	// @example "2024-12-16 14:30:00"
+	DateCreated string `json:"date_created"`
+
+	Items []ShortlistItem `json:"items"`
+}
+
+// favouriteColumn is the column holding the target of a kind of favourite
+func favouriteColumn(kind string) (string, error) {
+	switch kind {
+	case FavouriteListing:
+		return "listing_id", nil
+	case FavouriteUser:
+		return "target_user_id", nil
+	}
+	return "", Invalid("kind", "must be one of listing, user")
+}
+
+// inShortlist is the condition selecting the favourites (shortlistID 0) or a shortlist
+func inShortlist(shortlistID int) (string, []interface{}) {
+	if shortlistID == 0 {
+		return `shortlist_id IS NULL`, nil
+	}
+	return `shortlist_id = ?`, []interface{}{shortlistID}
+}
+
+type FavouriteService struct {
+	db *Database.DB
+}
+
+// Add puts a listing or user in a user's favourites (shortlistID 0) or one of their shortlists.
+// Adding an item twice keeps the first.
+func (f *FavouriteService) Add(ctx context.Context, userID, shortlistID int, kind string, targetID int) error {
+	column, err := favouriteColumn(kind)
+	if err != nil {
+		return err
+	}
+	condition, args := inShortlist(shortlistID)
+	args = append([]interface{}{userID, targetID}, args...)
+
+	var exists int
+	err = f.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM favourites WHERE user_id = ? AND `+column+` = ? AND `+condition, args...).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("could not check favourite: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	_, err = f.db.ExecContext(ctx, `INSERT INTO favourites (user_id, shortlist_id, `+column+`) VALUES (?, ?, ?)`,
+		userID, sql.NullInt64{Int64: int64(shortlistID), Valid: shortlistID != 0}, targetID)
+	if err != nil {
+		return fmt.Errorf("could not add favourite: %w", err)
+	}
+	return nil
+}
+
+// Remove takes a listing or user out of a user's favourites (shortlistID 0) or one of their shortlists
+func (f *FavouriteService) Remove(ctx context.Context, userID, shortlistID int, kind string, targetID int) error {
+	column, err := favouriteColumn(kind)
+	if err != nil {
+		return err
+	}
+	condition, args := inShortlist(shortlistID)
+	args = append([]interface{}{userID, targetID}, args...)
+
+	result, err := f.db.ExecContext(ctx, `DELETE FROM favourites WHERE user_id = ? AND `+column+` = ? AND `+condition, args...)
+	if err != nil {
+		return fmt.Errorf("could not remove favourite: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("favourite %w", ErrNotFound)
+	}
+	return nil
+}
+
+// Items returns the listings and users in a user's favourites (shortlistID 0) or one of their shortlists,
+// most recently added first. Only the IDs are filled in.
+func (f *FavouriteService) Items(ctx context.Context, userID, shortlistID int) ([]ShortlistItem, error) {
+	condition, args := inShortlist(shortlistID)
+	query := `SELECT COALESCE(listing_id, 0), COALESCE(target_user_id, 0), ` + f.db.Dialect.Timestamp("date_created") + `
+	          FROM favourites WHERE user_id = ? AND ` + condition + ` ORDER BY date_created DESC, favourite_id DESC`
+	rows, err := f.db.QueryContext(ctx, query, append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve favourites: %w", err)
+	}
+	defer rows.Close()
+
+	items := []ShortlistItem{}
+	for rows.Next() {
+		var item ShortlistItem
+		if err := rows.Scan(&item.ListingID, &item.UserID, &item.DateAdded); err != nil {
+			return nil, fmt.Errorf("could not scan favourite: %w", err)
+		}
+		item.Kind = FavouriteListing
+		if item.ListingID == 0 {
+			item.Kind = FavouriteUser
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// ListingCounts returns how many users favourited or shortlisted each of an owner's listings, by listing ID.
+// Listings nobody saved are left out.
+func (f *FavouriteService) ListingCounts(ctx context.Context, ownerID int) (map[int]int, error) {
+	query := `SELECT f.listing_id, COUNT(DISTINCT f.user_id) FROM favourites f
+	          JOIN listings l ON l.listing_id = f.listing_id
+	          WHERE l.user_id = ? GROUP BY f.listing_id`
+	rows, err := f.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("could not count favourites: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var listingID, count int
+		if err := rows.Scan(&listingID, &count); err != nil {
+			return nil, fmt.Errorf("could not scan favourite count: %w", err)
+		}
+		counts[listingID] = count
+	}
+	return counts, rows.Err()
+}
+
+// CreateShortlist stores a new, empty shortlist
+func (f *FavouriteService) CreateShortlist(ctx context.Context, shortlist *Shortlist) (Shortlist, error) {
+	id, err := f.db.InsertID(ctx, `INSERT INTO shortlists (user_id, name) VALUES (?, ?)`, "shortlist_id", shortlist.UserID, shortlist.Name)
+	if err != nil {
+		return Shortlist{}, fmt.Errorf("could not create shortlist: %w", err)
+	}
+	return f.GetShortlist(ctx, int(id))
+}
+
+// queryShortlists runs a query selecting shortlist_id, user_id, name and date_created
+func (f *FavouriteService) queryShortlists(ctx context.Context, query string, args ...interface{}) ([]Shortlist, error) {
+	rows, err := f.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve shortlists: %w", err)
+	}
+	defer rows.Close()
+
+	shortlists := []Shortlist{}
+	for rows.Next() {
+		shortlist := Shortlist{Items: []ShortlistItem{}}
+		if err := rows.Scan(&shortlist.ShortlistID, &shortlist.UserID, &shortlist.Name, &shortlist.DateCreated); err != nil {
+			return nil, fmt.Errorf("could not scan shortlist: %w", err)
+		}
+		shortlists = append(shortlists, shortlist)
+	}
+	return shortlists, rows.Err()
+}
+
+// GetShortlist returns a single shortlist, without its items
+func (f *FavouriteService) GetShortlist(ctx context.Context, shortlistID int) (Shortlist, error) {
+	query := `SELECT shortlist_id, user_id, name, ` + f.db.Dialect.Timestamp("date_created") + ` FROM shortlists WHERE shortlist_id = ?`
+	shortlists, err := f.queryShortlists(ctx, query, shortlistID)
+	if err != nil {
+		return Shortlist{}, err
+	}
+	if len(shortlists) == 0 {
+		return Shortlist{}, fmt.Errorf("shortlist %w", ErrNotFound)
+	}
+	return shortlists[0], nil
+}
+
+// GetShortlists returns a user's shortlists, oldest first and without their items
+func (f *FavouriteService) GetShortlists(ctx context.Context, userID int) ([]Shortlist, error) {
+	query := `SELECT shortlist_id, user_id, name, ` + f.db.Dialect.Timestamp("date_created") + ` FROM shortlists WHERE user_id = ? ORDER BY shortlist_id`
+	return f.queryShortlists(ctx, query, userID)
+}
+
+// RenameShortlist changes the name of a shortlist
+func (f *FavouriteService) RenameShortlist(ctx context.Context, shortlistID int, name string) error {
+	result, err := f.db.ExecContext(ctx, `UPDATE shortlists SET name = ? WHERE shortlist_id = ?`, name, shortlistID)
+	if err != nil {
+		return fmt.Errorf("could not rename shortlist: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("shortlist %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteShortlist removes a shortlist and its items
+func (f *FavouriteService) DeleteShortlist(ctx context.Context, shortlistID int) error {
+	result, err := f.db.ExecContext(ctx, `DELETE FROM shortlists WHERE shortlist_id = ?`, shortlistID)
+	if err != nil {
+		return fmt.Errorf("could not delete shortlist: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("shortlist %w", ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package Services
+
+import (
+	"encoding/json"
+	"fmt"
+	geojson "github.com/paulmach/go.geojson"
+	"reflect"
+	"strings"
+)
+
+// DefaultListingProperties are the listing fields GeoJSON features carry when none are asked for
+var DefaultListingProperties = []string{"listing_id", "type", "title", "category", "price", "currency_code", "city", "country", "status", "date_created"}
+
+// listingProperties are the JSON names of the listing fields that can be GeoJSON properties.
+// The location is the geometry, so it is not one of them.
+var listingProperties = func() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(Listing{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" && name != "location" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// CheckListingProperties rejects property names that are not listing fields
+func CheckListingProperties(names []string) error {
+	for _, name := range names {
+		if !listingProperties[name] {
+			return Invalid("properties", fmt.Sprintf("unknown listing property %q", name))
+		}
+	}
+	return nil
+}
+
+// ListingFeature returns a listing as a GeoJSON point feature carrying the given properties.
+// The point is used as given, so fuzz the listing first unless the caller may see it exactly.
+func ListingFeature(listing Listing, properties []string) (*geojson.Feature, error) {
+	location := listing.Location
+	var feature *geojson.Feature
+	if location != nil {
+		feature = geojson.NewPointFeature([]float64{location.Lng(), location.Lat()})
+	} else {
+		feature = geojson.NewFeature(nil)
+	}
+	feature.ID = listing.ListingID
+
+	// Go through the JSON encoding so properties are named and formatted like the JSON responses
+	encoded, err := json.Marshal(listing)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range properties {
+		// Fields left out when empty become null rather than disappearing
+		feature.SetProperty(name, fields[name])
+	}
+	// Promoted listings stay labelled whatever properties were asked for
+	if listing.Promotion != nil {
+		feature.SetProperty("promotion", fields["promotion"])
+	}
+	return feature, nil
+}
+
+// ListingCollection returns listings as a GeoJSON FeatureCollection
+func ListingCollection(listings []Listing, properties []string) (*geojson.FeatureCollection, error) {
+	collection := geojson.NewFeatureCollection()
+	for _, listing := range listings {
+		feature, err := ListingFeature(listing, properties)
+		if err != nil {
+			return nil, err
+		}
+		collection.AddFeature(feature)
+	}
+	return collection, nil
+}
+
+// MapViewCollection returns a map view as a GeoJSON FeatureCollection. Clusters are point features at
+// their centroid with cluster and count properties and their bounds as the bbox.
+func MapViewCollection(view MapView, properties []string) (*geojson.FeatureCollection, error) {
+	collection, err := ListingCollection(view.Listings, properties)
+	if err != nil {
+		return nil, err
+	}
+	for _, cluster := range view.Clusters {
+		feature := geojson.NewPointFeature([]float64{cluster.Location.Lng(), cluster.Location.Lat()})
+		feature.BoundingBox = cluster.Bounds[:]
+		feature.SetProperty("cluster", true)
+		feature.SetProperty("count", cluster.Count)
+		collection.AddFeature(feature)
+	}
+	return collection, nil
+}
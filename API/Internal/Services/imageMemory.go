@@ -0,0 +1,138 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ImageMemory is the in-memory implementation of the Images interface.
+// Image files still live on disk under SRV_DIR, only the records are in memory.
+type ImageMemory struct {
+	store *memoryStore
+}
+
+func (s *ImageMemory) filter(keep func(Image) bool) []Image {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	var images []Image
+	for _, id := range sortedKeys(s.store.images) {
+		image := s.store.images[id]
+		if keep(image) {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// AddImage records an uploaded image, shown on the profile by default. A listing's images
+// are counted against the uploader's plan under the same lock that stores the new one.
+func (s *ImageMemory) AddImage(ctx context.Context, url string, userID int, listingID int) (int, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	for _, image := range s.store.images {
+		if image.URL == url {
+			return 0, fmt.Errorf("could not insert image: duplicate url %q", url)
+		}
+	}
+	if listingID != 0 {
+		images := 0
+		for _, image := range s.store.images {
+			if image.ListingID == listingID {
+				images++
+			}
+		}
+		if err := checkImageCount(s.store.planOf(userID), images); err != nil {
+			return 0, err
+		}
+	}
+
+	s.store.nextImageID++
+	image := Image{
+		ImageID:       s.store.nextImageID,
+		URL:           url,
+		UserID:        userID,
+		ListingID:     listingID,
+		ShowOnProfile: true,
+		DateCreated:   now(),
+	}
+	s.store.images[image.ImageID] = image
+	return image.ImageID, nil
+}
+
+// GetImageByID returns a single image record.
+func (s *ImageMemory) GetImageByID(ctx context.Context, imageID int) (Image, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	image, ok := s.store.images[imageID]
+	if !ok {
+		return Image{}, fmt.Errorf("image %w", ErrNotFound)
+	}
+	return image, nil
+}
+
+// GetImagesByListingID returns the images attached to a listing.
+func (s *ImageMemory) GetImagesByListingID(ctx context.Context, listingID int) ([]Image, error) {
+	return s.filter(func(i Image) bool { return i.ListingID == listingID }), nil
+}
+
+// GetImagesByUserID returns every image uploaded by a user.
+func (s *ImageMemory) GetImagesByUserID(ctx context.Context, userID int) ([]Image, error) {
+	return s.filter(func(i Image) bool { return i.UserID == userID }), nil
+}
+
+// GetImagesByUserProfile returns a user's images that are shown on their profile.
+func (s *ImageMemory) GetImagesByUserProfile(ctx context.Context, userID int) ([]Image, error) {
+	return s.filter(func(i Image) bool { return i.UserID == userID && i.ShowOnProfile }), nil
+}
+
+// UpdateImageProfilePictureStatus makes the image the user's profile picture.
+func (s *ImageMemory) UpdateImageProfilePictureStatus(ctx context.Context, imageID int, user_id int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	dbUser, ok := s.store.users[user_id]
+	if !ok {
+		return nil
+	}
+	dbUser.ImageId = strconv.Itoa(imageID)
+	s.store.users[user_id] = dbUser
+	return nil
+}
+
+// UpdateImageProfileStatus toggles whether an image is shown on the profile.
+func (s *ImageMemory) UpdateImageProfileStatus(ctx context.Context, imageID int, showOnProfile bool) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	image, ok := s.store.images[imageID]
+	if !ok {
+		return nil
+	}
+	image.ShowOnProfile = showOnProfile
+	s.store.images[imageID] = image
+	return nil
+}
+
+// DeleteImage removes the image file from disk and then its record.
+func (s *ImageMemory) DeleteImage(ctx context.Context, imageID int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	image, ok := s.store.images[imageID]
+	if !ok {
+		return fmt.Errorf("image %w", ErrNotFound)
+	}
+
+	if err := os.Remove(filepath.Join(imagesDir(), image.URL)); err != nil {
+		return fmt.Errorf("could not delete image file: %v", err)
+	}
+
+	delete(s.store.images, imageID)
+	return nil
+}
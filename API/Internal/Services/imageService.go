@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
 	"os"
 	"path/filepath"
@@ -41,64 +42,86 @@ type Image struct {
 	DateCreated string `json:"-"` // Exclude from JSON output
 }
 
-var imagesDIR string = Env.GetString("SRV_DIR", "") + "/ServerImages"
+// imagesDir resolves the image storage directory at call time so it follows SRV_DIR
+func imagesDir() string {
+	return Env.GetString("SRV_DIR", "") + "/ServerImages"
+}
+
+// removeImageFiles deletes stored image files, ignoring those already gone
+func removeImageFiles(urls []string) error {
+	for _, url := range urls {
+		if err := os.Remove(filepath.Join(imagesDir(), url)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not delete image file: %v", err)
+		}
+	}
+	return nil
+}
+
+// imageColumns is the column list the image queries select, in the order they scan them
+func imageColumns(d Database.Dialect) string {
+	return `image_id, url, user_id, listing_id, show_on_profile, ` + d.Timestamp("date_created")
+}
 
 type ImageService struct {
-	db *sql.DB
+	db *Database.DB
 }
 
+// AddImage records an uploaded image, shown on the profile by default. A listing's images
+// are counted against the uploader's plan in the same transaction that inserts the new one.
 func (s *ImageService) AddImage(ctx context.Context, url string, userID int, listingID int) (int, error) {
-	var query string
-	var imageID int
-
-	if listingID != 0 {
-		// Insert with ListingID if it's provided
-		query = `
-			INSERT INTO images (url, user_id, listing_id, show_on_profile)
-			VALUES (?, ?, ?, ?)
-		`
-		result, err := s.db.ExecContext(ctx, query, url, userID, listingID, true) // Assuming show_on_profile is true by default
-		if err != nil {
-			return 0, fmt.Errorf("could not insert image: %v", err)
-		}
-
-		// Get the last inserted ID
-		imageID64, err := result.LastInsertId()
-		if err != nil {
-			return 0, fmt.Errorf("could not get last insert ID: %v", err)
-		}
-		imageID = int(imageID64)
-	} else {
-		// Insert without ListingID if it's 0
-		query = `
+	if listingID == 0 {
+		imageID, err := s.db.InsertID(ctx, `
 			INSERT INTO images (url, user_id, show_on_profile)
-			VALUES (?, ?, ?)
-		`
-		result, err := s.db.ExecContext(ctx, query, url, userID, true)
+			VALUES (?, ?, ?)`, "image_id", url, userID, true)
 		if err != nil {
 			return 0, fmt.Errorf("could not insert image: %v", err)
 		}
+		return int(imageID), nil
+	}
 
-		// Get the last inserted ID
-		imageID64, err := result.LastInsertId()
-		if err != nil {
-			return 0, fmt.Errorf("could not get last insert ID: %v", err)
-		}
-		imageID = int(imageID64)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Touching the listing row locks it, so concurrent uploads for it count one after another
+	if _, err := tx.ExecContext(ctx, `UPDATE listings SET listing_id = listing_id WHERE listing_id = ?`, listingID); err != nil {
+		return 0, fmt.Errorf("could not lock listing: %v", err)
+	}
+	var name string
+	err = tx.QueryRowContext(ctx, `SELECT plan FROM subscriptions WHERE user_id = ?`, userID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("could not retrieve plan: %w", err)
 	}
+	plan, _ := PlanByName(name)
 
-	return imageID, nil
+	var images int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM images WHERE listing_id = ?`, listingID).Scan(&images); err != nil {
+		return 0, fmt.Errorf("could not count images: %w", err)
+	}
+	if err := checkImageCount(plan, images); err != nil {
+		return 0, err
+	}
+
+	imageID, err := tx.InsertID(ctx, `
+		INSERT INTO images (url, user_id, listing_id, show_on_profile)
+		VALUES (?, ?, ?, ?)`, "image_id", url, userID, listingID, true)
+	if err != nil {
+		return 0, fmt.Errorf("could not insert image: %v", err)
+	}
+	return int(imageID), tx.Commit()
 }
 
 func (s *ImageService) GetImageByID(ctx context.Context, imageID int) (Image, error) {
-	query := `SELECT image_id, url, user_id, listing_id, show_on_profile, date_created 
+	query := `SELECT ` + imageColumns(s.db.Dialect) + `
 	          FROM images WHERE image_id = ?`
 
 	var image Image
 	err := s.db.QueryRowContext(ctx, query, imageID).Scan(&image.ImageID, &image.URL, &image.UserID, &image.ListingID, &image.ShowOnProfile, &image.DateCreated)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return Image{}, fmt.Errorf("image not found")
+			return Image{}, fmt.Errorf("image %w", ErrNotFound)
 		}
 		return Image{}, fmt.Errorf("could not get image: %v", err)
 	}
@@ -106,7 +129,7 @@ func (s *ImageService) GetImageByID(ctx context.Context, imageID int) (Image, er
 }
 
 func (s *ImageService) GetImagesByListingID(ctx context.Context, listingID int) ([]Image, error) {
-	query := `SELECT image_id, url, user_id, listing_id, show_on_profile, date_created 
+	query := `SELECT ` + imageColumns(s.db.Dialect) + `
 	          FROM images WHERE listing_id = ?`
 
 	rows, err := s.db.QueryContext(ctx, query, listingID)
@@ -132,7 +155,7 @@ func (s *ImageService) GetImagesByListingID(ctx context.Context, listingID int)
 }
 
 func (s *ImageService) GetImagesByUserID(ctx context.Context, userID int) ([]Image, error) {
-	query := `SELECT image_id, url, user_id, listing_id, show_on_profile, date_created 
+	query := `SELECT ` + imageColumns(s.db.Dialect) + `
 	          FROM images WHERE user_id = ?`
 
 	rows, err := s.db.QueryContext(ctx, query, userID)
@@ -158,10 +181,10 @@ func (s *ImageService) GetImagesByUserID(ctx context.Context, userID int) ([]Ima
 }
 
 func (s *ImageService) GetImagesByUserProfile(ctx context.Context, userID int) ([]Image, error) {
-	query := `SELECT image_id, url, user_id, listing_id, show_on_profile, date_created 
-	          FROM images WHERE user_id = ? AND show_on_profile = 1`
+	query := `SELECT ` + imageColumns(s.db.Dialect) + `
+	          FROM images WHERE user_id = ? AND show_on_profile = ?`
 
-	rows, err := s.db.QueryContext(ctx, query, userID)
+	rows, err := s.db.QueryContext(ctx, query, userID, true)
 	if err != nil {
 		return nil, fmt.Errorf("could not get images by user profile: %v", err)
 	}
@@ -187,7 +210,7 @@ func (s *ImageService) UpdateImageProfilePictureStatus(ctx context.Context, imag
 	query := `
 		UPDATE users 
 		SET profile_image = ? 
-		WHERE user_id = ?;`
+		WHERE user_id = ?`
 
 	_, err := s.db.ExecContext(ctx, query, imageID, user_id)
 	if err != nil {
@@ -214,12 +237,15 @@ func (s *ImageService) DeleteImage(ctx context.Context, imageID int) error {
 	var url string
 	query := `SELECT url FROM images WHERE image_id = ?`
 	err := s.db.QueryRowContext(ctx, query, imageID).Scan(&url)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("image %w", ErrNotFound)
+	}
 	if err != nil {
 		return fmt.Errorf("could not find image: %v", err)
 	}
 
 	// Optionally, delete the image file from the server (assuming file path is the full URL)
-	err = os.Remove(filepath.Join(imagesDIR, url))
+	err = os.Remove(filepath.Join(imagesDir(), url))
 	if err != nil {
 		return fmt.Errorf("could not delete image file: %v", err)
 	}
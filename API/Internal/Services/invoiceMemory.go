@@ -0,0 +1,83 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// InvoiceMemory is the in-memory implementation of the Invoices interface
+type InvoiceMemory struct {
+	store *memoryStore
+}
+
+// Issue numbers and stores a drafted invoice. A transaction is invoiced once, so issuing
+// it again returns the invoice it already has.
+func (s *InvoiceMemory) Issue(ctx context.Context, invoice Invoice) (Invoice, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	last := 0
+	for _, issued := range s.store.invoices {
+		if issued.TransactionID == invoice.TransactionID {
+			return issued, nil
+		}
+		if issued.TradesmanID == invoice.TradesmanID && issued.Number > last {
+			last = issued.Number
+		}
+	}
+
+	s.store.nextInvoiceID++
+	invoice.InvoiceID = s.store.nextInvoiceID
+	invoice.Number = last + 1
+	invoice.Reference = invoiceReference(invoice.TradesmanID, invoice.Number)
+	invoice.Items = append([]InvoiceItem{}, invoice.Items...)
+	invoice.DateIssued = now()
+	s.store.invoices[invoice.InvoiceID] = invoice
+	return invoice, nil
+}
+
+// GetByID returns an invoice with its items
+func (s *InvoiceMemory) GetByID(ctx context.Context, invoiceID int) (Invoice, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	invoice, ok := s.store.invoices[invoiceID]
+	if !ok {
+		return Invoice{}, fmt.Errorf("invoice %w", ErrNotFound)
+	}
+	return invoice, nil
+}
+
+// GetByTransaction returns the invoice of a transaction
+func (s *InvoiceMemory) GetByTransaction(ctx context.Context, transactionID int) (Invoice, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	for _, invoice := range s.store.invoices {
+		if invoice.TransactionID == transactionID {
+			return invoice, nil
+		}
+	}
+	return Invoice{}, fmt.Errorf("invoice %w", ErrNotFound)
+}
+
+// GetByTradesman returns the invoices a tradesman issued from one date to another, both included, in number order
+func (s *InvoiceMemory) GetByTradesman(ctx context.Context, tradesmanID int, from, to string) ([]Invoice, error) {
+	until, err := issuedBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	invoices := []Invoice{}
+	for _, invoice := range s.store.invoices {
+		if invoice.TradesmanID == tradesmanID && invoice.DateIssued >= from && invoice.DateIssued < until {
+			invoices = append(invoices, invoice)
+		}
+	}
+	sort.Slice(invoices, func(i, j int) bool { return invoices[i].Number < invoices[j].Number })
+	return invoices, nil
+}
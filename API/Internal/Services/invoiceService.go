@@ -0,0 +1,147 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+)
+
+// invoiceColumns is the column list every invoice query selects, in the order queryInvoices scans them
+func invoiceColumns(d Database.Dialect) string {
+	return `invoice_id, transaction_id, tradesman_id, client_id, number, tradesman_name, client_name, listing_title, currency,
+	subtotal_minor, tax_country, tax_rate, tax_minor, total_minor, platform_fee_minor, payout_minor, COALESCE(` + d.Timestamp("date_paid") + `, ''), ` + d.Timestamp("date_issued")
+}
+
+type InvoiceService struct {
+	db *Database.DB
+}
+
+// queryInvoices runs a query selecting invoiceColumns and attaches the items of each invoice
+func (s *InvoiceService) queryInvoices(ctx context.Context, query string, args ...interface{}) ([]Invoice, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve invoices: %w", err)
+	}
+
+	invoices := []Invoice{}
+	for rows.Next() {
+		var invoice Invoice
+		var subtotal, tax, total, fee, payout int64
+		if err := rows.Scan(&invoice.InvoiceID, &invoice.TransactionID, &invoice.TradesmanID, &invoice.ClientID, &invoice.Number,
+			&invoice.TradesmanName, &invoice.ClientName, &invoice.ListingTitle, &invoice.Currency, &subtotal, &invoice.TaxCountry,
+			&invoice.TaxRate, &tax, &total, &fee, &payout, &invoice.DatePaid, &invoice.DateIssued); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("could not scan invoice: %w", err)
+		}
+		invoice.Subtotal = majorUnits(subtotal, invoice.Currency)
+		invoice.Tax = majorUnits(tax, invoice.Currency)
+		invoice.Total = majorUnits(total, invoice.Currency)
+		invoice.PlatformFee = majorUnits(fee, invoice.Currency)
+		invoice.Payout = majorUnits(payout, invoice.Currency)
+		invoice.Reference = invoiceReference(invoice.TradesmanID, invoice.Number)
+		invoices = append(invoices, invoice)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate over invoices: %w", err)
+	}
+
+	// The invoices are read in full first, as SQLite has a single connection
+	for i := range invoices {
+		items, err := s.db.QueryContext(ctx, `SELECT position, description, amount_minor FROM invoice_items WHERE invoice_id = ? ORDER BY position`, invoices[i].InvoiceID)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve invoice items: %w", err)
+		}
+		invoices[i].Items = []InvoiceItem{}
+		for items.Next() {
+			var item InvoiceItem
+			var amount int64
+			if err := items.Scan(&item.Position, &item.Description, &amount); err != nil {
+				items.Close()
+				return nil, fmt.Errorf("could not scan invoice item: %w", err)
+			}
+			item.Amount = majorUnits(amount, invoices[i].Currency)
+			invoices[i].Items = append(invoices[i].Items, item)
+		}
+		items.Close()
+	}
+	return invoices, nil
+}
+
+// Issue numbers and stores a drafted invoice. A transaction is invoiced once, so issuing
+// it again returns the invoice it already has.
+func (s *InvoiceService) Issue(ctx context.Context, invoice Invoice) (Invoice, error) {
+	if issued, err := s.GetByTransaction(ctx, invoice.TransactionID); err == nil {
+		return issued, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer tx.Rollback()
+
+	// The unique tradesman and number pair turns a concurrent issue into an error instead of a gap or a duplicate
+	var last int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(number), 0) FROM invoices WHERE tradesman_id = ?`, invoice.TradesmanID).Scan(&last)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("could not number invoice: %w", err)
+	}
+
+	var datePaid interface{}
+	if invoice.DatePaid != "" {
+		datePaid = invoice.DatePaid
+	}
+	id, err := tx.InsertID(ctx, `INSERT INTO invoices (transaction_id, tradesman_id, client_id, number, tradesman_name, client_name, listing_title,
+	          currency, subtotal_minor, tax_country, tax_rate, tax_minor, total_minor, platform_fee_minor, payout_minor, date_paid)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "invoice_id",
+		invoice.TransactionID, invoice.TradesmanID, invoice.ClientID, last+1, invoice.TradesmanName, invoice.ClientName, invoice.ListingTitle,
+		invoice.Currency, minorUnits(invoice.Subtotal, invoice.Currency), invoice.TaxCountry, invoice.TaxRate, minorUnits(invoice.Tax, invoice.Currency),
+		minorUnits(invoice.Total, invoice.Currency), minorUnits(invoice.PlatformFee, invoice.Currency), minorUnits(invoice.Payout, invoice.Currency), datePaid)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("could not issue invoice: %w", err)
+	}
+	for _, item := range invoice.Items {
+		_, err := tx.ExecContext(ctx, `INSERT INTO invoice_items (invoice_id, position, description, amount_minor) VALUES (?, ?, ?, ?)`,
+			id, item.Position, item.Description, minorUnits(item.Amount, invoice.Currency))
+		if err != nil {
+			return Invoice{}, fmt.Errorf("could not add invoice item: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Invoice{}, err
+	}
+	return s.GetByID(ctx, int(id))
+}
+
+// GetByID returns an invoice with its items
+func (s *InvoiceService) GetByID(ctx context.Context, invoiceID int) (Invoice, error) {
+	return s.one(ctx, `SELECT `+invoiceColumns(s.db.Dialect)+` FROM invoices WHERE invoice_id = ?`, invoiceID)
+}
+
+// GetByTransaction returns the invoice of a transaction
+func (s *InvoiceService) GetByTransaction(ctx context.Context, transactionID int) (Invoice, error) {
+	return s.one(ctx, `SELECT `+invoiceColumns(s.db.Dialect)+` FROM invoices WHERE transaction_id = ?`, transactionID)
+}
+
+// one runs a query selecting a single invoice
+func (s *InvoiceService) one(ctx context.Context, query string, args ...interface{}) (Invoice, error) {
+	invoices, err := s.queryInvoices(ctx, query, args...)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if len(invoices) == 0 {
+		return Invoice{}, fmt.Errorf("invoice %w", ErrNotFound)
+	}
+	return invoices[0], nil
+}
+
+// GetByTradesman returns the invoices a tradesman issued from one date to another, both included, in number order
+func (s *InvoiceService) GetByTradesman(ctx context.Context, tradesmanID int, from, to string) ([]Invoice, error) {
+	until, err := issuedBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryInvoices(ctx, `SELECT `+invoiceColumns(s.db.Dialect)+` FROM invoices
+	          WHERE tradesman_id = ? AND date_issued >= ? AND date_issued < ? ORDER BY number`, tradesmanID, from, until)
+}
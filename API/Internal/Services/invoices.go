@@ -0,0 +1,182 @@
+package Services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Invoice is the bill of a Completed transaction, issued by the tradesman to the client.
+// Prices include tax, so the total is what the client paid. Names and titles are copied
+// when the invoice is issued, so it reads the same after profiles change.
+type Invoice struct {
+	// @example 4
+	InvoiceID int `json:"invoice_id"`
+
+	// @example 12345
+	TransactionID int `json:"transaction_id"`
+
+	// @example 2
+	TradesmanID int `json:"tradesman_id"`
+
+	// @example 1
+	ClientID int `json:"client_id"`
+
+	// Number counts the tradesman's invoices from 1, without gaps
+	// @example 17
+	Number int `json:"number"`
+
+	// Reference is the invoice number as printed, INV-{tradesman_id}-{number}
+	// @example "INV-2-000017"
+	Reference string `json:"reference"`
+
+	// @example "Karim Haddad"
+	TradesmanName string `json:"tradesman_name"`
+
+	// @example "Nadine Khoury"
+	ClientName string `json:"client_name"`
+
+	// @example "King of Ceramic"
+	ListingTitle string `json:"listing_title"`
+
+	// Items are the milestones of the job, or the whole job when it had none
+	Items []InvoiceItem `json:"items"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// Subtotal is the total before tax
+	// @example 135.59
+	Subtotal float64 `json:"subtotal"`
+
+	// TaxCountry is the country of the job, whose tax rate applies
+	// @example "Lebanon"
+	TaxCountry string `json:"tax_country,omitempty"`
+
+	// TaxRate is a percentage, 0 where no rate is configured for the country
+	// @example 11
+	TaxRate float64 `json:"tax_rate"`
+
+	// @example 14.91
+	Tax float64 `json:"tax"`
+
+	// Total is what the client paid, tax included
+	// @example 150.50
+	Total float64 `json:"total"`
+
+	// PlatformFee is what the platform kept of the total
+	// @example 7.53
+	PlatformFee float64 `json:"platform_fee"`
+
+	// Payout is what the tradesman received, the total less the platform fee
+	// @example 142.97
+	Payout float64 `json:"payout"`
+
+	// DatePaid is when the deposit was released, empty for jobs without a price
+	// @example "2025-01-20 18:00:00"
+	DatePaid string `json:"date_paid,omitempty"`
+
+	// @example "2025-01-20 18:00:00"
+	DateIssued string `json:"date_issued"`
+}
+
+// InvoiceItem is a line of an invoice, tax included
+type InvoiceItem struct {
+	// @example 1
+	Position int `json:"position"`
+
+	// @example "Remove the old tiles"
+	Description string `json:"description"`
+
+	// @example 50.50
+	Amount float64 `json:"amount"`
+}
+
+// InvoiceSource is what an invoice is drawn up from
+type InvoiceSource struct {
+	Transaction Transaction
+	Milestones  []Milestone
+	// Payment is nil for transactions that moved no money
+	Payment   *Payment
+	Tradesman User
+	Client    User
+	Listing   Listing
+}
+
+// invoiceReference formats a tradesman's invoice number as printed on the invoice
+func invoiceReference(tradesmanID, number int) string {
+	return fmt.Sprintf("INV-%d-%06d", tradesmanID, number)
+}
+
+// TaxRate returns the tax percentage of a country, matched case-insensitively
+func TaxRate(rates map[string]float64, country string) float64 {
+	for name, rate := range rates {
+		if strings.EqualFold(name, country) {
+			return rate
+		}
+	}
+	return 0
+}
+
+// DraftInvoice draws up the unnumbered invoice of a Completed transaction. The tax is
+// taken out of the total at the rate of the country the job was done in.
+func DraftInvoice(source InvoiceSource, taxRates map[string]float64) (Invoice, error) {
+	transaction := source.Transaction
+	if transaction.Status != "Completed" {
+		return Invoice{}, fmt.Errorf("only Completed transactions are invoiced: %w", ErrConflict)
+	}
+
+	invoice := Invoice{
+		TransactionID: transaction.TransactionID,
+		TradesmanID:   transaction.UserOfferingID,
+		ClientID:      transaction.UserOfferedID,
+		TradesmanName: strings.TrimSpace(source.Tradesman.FirstName + " " + source.Tradesman.LastName),
+		ClientName:    strings.TrimSpace(source.Client.FirstName + " " + source.Client.LastName),
+		ListingTitle:  source.Listing.Title,
+		Currency:      transaction.CurrencyCode,
+		TaxCountry:    source.Listing.Country,
+	}
+	if invoice.TaxCountry == "" {
+		invoice.TaxCountry = source.Tradesman.LocDetails.Country
+	}
+
+	for _, milestone := range source.Milestones {
+		invoice.Items = append(invoice.Items, InvoiceItem{Position: milestone.Position, Description: milestone.Description, Amount: milestone.Amount})
+	}
+	if len(invoice.Items) == 0 {
+		invoice.Items = []InvoiceItem{{Position: 1, Description: source.Listing.Title, Amount: roundMoney(transaction.Price, invoice.Currency)}}
+	}
+	var total int64
+	for _, item := range invoice.Items {
+		total += minorUnits(item.Amount, invoice.Currency)
+	}
+	invoice.Total = majorUnits(total, invoice.Currency)
+
+	invoice.TaxRate = TaxRate(taxRates, invoice.TaxCountry)
+	invoice.Tax = roundMoney(invoice.Total*invoice.TaxRate/(100+invoice.TaxRate), invoice.Currency)
+	invoice.Subtotal = roundMoney(invoice.Total-invoice.Tax, invoice.Currency)
+
+	if source.Payment != nil {
+		invoice.PlatformFee = source.Payment.Fee
+		invoice.DatePaid = source.Payment.DateSettled
+	}
+	invoice.Payout = roundMoney(invoice.Total-invoice.PlatformFee, invoice.Currency)
+	return invoice, nil
+}
+
+// issuedBetween checks a date range of issued invoices and returns the day after to,
+// so the range includes the whole of its last day
+func issuedBetween(from, to string) (string, error) {
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return "", Invalid("from", "must be a date formatted YYYY-MM-DD")
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return "", Invalid("to", "must be a date formatted YYYY-MM-DD")
+	}
+	if end.Before(start) {
+		return "", Invalid("to", "must not be before from")
+	}
+	return end.AddDate(0, 0, 1).Format("2006-01-02"), nil
+}
@@ -0,0 +1,45 @@
+package Services
+
+import (
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
+	"time"
+)
+
+// Listing statuses. Only published listings show up in browsing and search.
+const (
+	ListingDraft     = "draft"
+	ListingPublished = "published"
+	ListingPaused    = "paused"
+	ListingExpired   = "expired"
+	ListingClosed    = "closed"
+)
+
+// listingTransitions lists the statuses each status may move to. Publishing a
+// published or expired listing renews it; closed listings are final.
+var listingTransitions = map[string][]string{
+	ListingDraft:     {ListingPublished, ListingClosed},
+	ListingPublished: {ListingPublished, ListingPaused, ListingClosed},
+	ListingPaused:    {ListingPublished, ListingClosed},
+	ListingExpired:   {ListingPublished, ListingClosed},
+}
+
+// checkTransition returns ErrConflict unless a listing may move from one status to the other
+func checkTransition(from, to string) error {
+	for _, allowed := range listingTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("a %s listing cannot become %s: %w", from, to, ErrConflict)
+}
+
+// ListingLifetime is how long a listing of the given type stays published before it
+// expires, set in days by LISTING_OFFER_DAYS and LISTING_REQUEST_DAYS
+func ListingLifetime(listingType string) time.Duration {
+	days := Env.GetInt("LISTING_OFFER_DAYS", 60)
+	if listingType == "Request" {
+		days = Env.GetInt("LISTING_REQUEST_DAYS", 30)
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
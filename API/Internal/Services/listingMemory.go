@@ -0,0 +1,363 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	geo "github.com/paulmach/go.geo"
+	"sort"
+	"time"
+)
+
+// ListingMemory is the in-memory implementation of the Listings interface
+type ListingMemory struct {
+	store *memoryStore
+}
+
+// filter returns the listings that are not deleted and match keep, in ID order
+func (s *ListingMemory) filter(keep func(Listing) bool) []Listing {
+	return s.filterAll(func(l Listing) bool { return l.DeletedAt == "" && keep(l) })
+}
+
+// filterAll is filter including deleted listings
+func (s *ListingMemory) filterAll(keep func(Listing) bool) []Listing {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	listings := []Listing{}
+	for _, id := range sortedKeys(s.store.listings) {
+		listing := s.store.listings[id]
+		if keep(listing) {
+			listings = append(listings, listing)
+		}
+	}
+	return listings
+}
+
+// isListed mirrors the listed condition: only published listings are browsable
+func isListed(listing Listing) bool {
+	return listing.Status == ListingPublished
+}
+
+// matchesType applies the optional Request/Offer filter used by every listing query
+func matchesType(listing Listing, listingType string) bool {
+	if listingType == "Request" || listingType == "Offer" {
+		return listing.Type == listingType
+	}
+	return true
+}
+
+// matchesSearch mirrors the title/description LIKE filter
+func matchesSearch(listing Listing, searchTerm string) bool {
+	return containsFold(listing.Title, searchTerm) || containsFold(listing.Description, searchTerm)
+}
+
+// withinDistance mirrors ST_Distance_Sphere, with maxDistance in kilometres
+func withinDistance(listing Listing, latitude, longitude, maxDistance float64) bool {
+	if listing.Location == nil {
+		return false
+	}
+	return listing.Location.GeoDistanceFrom(geo.NewPoint(longitude, latitude), true) < maxDistance*1000
+}
+
+// newestFirst orders listings by creation date, most recent first
+func newestFirst(listings []Listing) []Listing {
+	sort.SliceStable(listings, func(i, j int) bool {
+		if listings[i].DateCreated == listings[j].DateCreated {
+			return listings[i].ListingID > listings[j].ListingID
+		}
+		return listings[i].DateCreated > listings[j].DateCreated
+	})
+	return listings
+}
+
+// Create stores a new listing, published unless it is a draft.
+func (s *ListingMemory) Create(ctx context.Context, listing *Listing) (Listing, error) {
+	city, country, err := s.store.reverseGeocode(listing.Location.Lat(), listing.Location.Lng(), listing.City, listing.Country)
+	if err != nil {
+		return Listing{}, fmt.Errorf("could not validate coordinates: %w", err)
+	}
+	listing.City = city
+	listing.Country = country
+	listing.RegionID = s.store.locateRegion(listing.Location)
+	listing.CurrencyCode = CurrencyOrDefault(listing.CurrencyCode)
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if listing.Status != ListingDraft {
+		if err := s.store.checkPublishing(listing.UserID); err != nil {
+			return Listing{}, err
+		}
+	}
+	s.store.nextListingID++
+	listing.ListingID = s.store.nextListingID
+	listing.DateCreated = now()
+	listing.ExpiresAt = ""
+	if listing.Status != ListingDraft {
+		listing.Status = ListingPublished
+		listing.ExpiresAt = fromNow(ListingLifetime(listing.Type))
+	}
+	listing.Active = listing.Status == ListingPublished
+	s.store.listings[listing.ListingID] = *listing
+	s.store.unmatchedListings[listing.ListingID] = true
+
+	return *listing, nil
+}
+
+// Update replaces the editable fields of a listing.
+func (s *ListingMemory) Update(ctx context.Context, listing *Listing, listingID int) error {
+	city, country, err := s.store.reverseGeocode(listing.Location.Lat(), listing.Location.Lng(), listing.City, listing.Country)
+	if err != nil {
+		return fmt.Errorf("error validating coordinates: %w", err)
+	}
+	regionID := s.store.locateRegion(listing.Location)
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.listings[listingID]
+	if !ok || stored.DeletedAt != "" {
+		return nil
+	}
+	stored.Title = listing.Title
+	stored.Description = listing.Description
+	stored.Location = listing.Location
+	stored.Type = listing.Type
+	stored.City = city
+	stored.Country = country
+	stored.RegionID = regionID
+	stored.Category = listing.Category
+	stored.Price = listing.Price
+	stored.CurrencyCode = CurrencyOrDefault(listing.CurrencyCode)
+	s.store.listings[listingID] = stored
+	s.store.unmatchedListings[listingID] = true
+	return nil
+}
+
+// Delete hides a listing until it is restored or purged.
+func (s *ListingMemory) Delete(ctx context.Context, listingID int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.listings[listingID]
+	if !ok || stored.DeletedAt != "" {
+		return fmt.Errorf("listing %w", ErrNotFound)
+	}
+	stored.DeletedAt = now()
+	s.store.listings[listingID] = stored
+	return nil
+}
+
+// Restore undoes the deletion of a listing by its owner within the grace period.
+func (s *ListingMemory) Restore(ctx context.Context, listingID, userID int, within time.Duration) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.listings[listingID]
+	if !ok || stored.UserID != userID || stored.DeletedAt == "" || age(stored.DeletedAt) >= within {
+		return fmt.Errorf("deleted listing %w", ErrNotFound)
+	}
+	stored.DeletedAt = ""
+	s.store.listings[listingID] = stored
+	return nil
+}
+
+// GetDeleted returns the deleted listings, most recently deleted first.
+func (s *ListingMemory) GetDeleted(ctx context.Context) ([]Listing, error) {
+	listings := s.filterAll(func(l Listing) bool { return l.DeletedAt != "" })
+	sort.SliceStable(listings, func(i, j int) bool {
+		if listings[i].DeletedAt == listings[j].DeletedAt {
+			return listings[i].ListingID > listings[j].ListingID
+		}
+		return listings[i].DeletedAt > listings[j].DeletedAt
+	})
+	return listings, nil
+}
+
+// Purge removes the listings deleted more than olderThan ago that no transaction refers to, with their images.
+func (s *ListingMemory) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	referenced := map[int]bool{}
+	for _, transaction := range s.store.transactions {
+		referenced[transaction.ListingID] = true
+	}
+
+	var purged int64
+	var urls []string
+	for id, listing := range s.store.listings {
+		if listing.DeletedAt == "" || age(listing.DeletedAt) < olderThan || referenced[id] {
+			continue
+		}
+		for imageID, image := range s.store.images {
+			if image.ListingID == id {
+				urls = append(urls, image.URL)
+				delete(s.store.images, imageID)
+			}
+		}
+		for _, matches := range s.store.searchMatches {
+			delete(matches, id)
+		}
+		delete(s.store.unmatchedListings, id)
+		delete(s.store.listings, id)
+		purged++
+	}
+	return purged, removeImageFiles(urls)
+}
+
+// GetAll returns every published listing, optionally filtered by type.
+func (s *ListingMemory) GetAll(ctx context.Context, listingType string) ([]Listing, error) {
+	return s.filter(func(l Listing) bool { return isListed(l) && matchesType(l, listingType) }), nil
+}
+
+// GetByUserID returns the listings created by a user, in every status.
+func (s *ListingMemory) GetByUserID(ctx context.Context, userID int, listingType string) ([]Listing, error) {
+	return s.filter(func(l Listing) bool { return l.UserID == userID && matchesType(l, listingType) }), nil
+}
+
+// GetByID returns a single listing.
+func (s *ListingMemory) GetByID(ctx context.Context, listingID int) (Listing, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	listing, ok := s.store.listings[listingID]
+	if !ok || listing.DeletedAt != "" {
+		return Listing{}, fmt.Errorf("listing %w", ErrNotFound)
+	}
+	return listing, nil
+}
+
+// GetBySearch returns listings whose title or description contains the search term.
+func (s *ListingMemory) GetBySearch(ctx context.Context, searchTerm, listingType string) ([]Listing, error) {
+	return s.filter(func(l Listing) bool {
+		return isListed(l) && matchesSearch(l, searchTerm) && matchesType(l, listingType)
+	}), nil
+}
+
+// GetByDistance returns listings within maxDistance kilometres of the given point,
+// and the offers of users whose service area contains it.
+func (s *ListingMemory) GetByDistance(ctx context.Context, latitude, longitude, maxDistance float64, listingType string) ([]Listing, error) {
+	serving := s.store.usersServing(latitude, longitude)
+	return s.filter(func(l Listing) bool {
+		return isListed(l) && (withinDistance(l, latitude, longitude, maxDistance) || servesPoint(l, serving)) && matchesType(l, listingType)
+	}), nil
+}
+
+// GetByDistanceAndSearch combines the distance and search filters.
+func (s *ListingMemory) GetByDistanceAndSearch(ctx context.Context, latitude, longitude, maxDistance float64, listingType string, searchQuery string) ([]Listing, error) {
+	serving := s.store.usersServing(latitude, longitude)
+	return s.filter(func(l Listing) bool {
+		return isListed(l) && (withinDistance(l, latitude, longitude, maxDistance) || servesPoint(l, serving)) && matchesType(l, listingType) && matchesSearch(l, searchQuery)
+	}), nil
+}
+
+// GetByRegion returns the published listings in a region or any region inside it.
+func (s *ListingMemory) GetByRegion(ctx context.Context, regionID int, listingType string) ([]Listing, error) {
+	inRegion := map[int]bool{}
+	for _, id := range descendants(s.store.regionParents(), regionID) {
+		inRegion[id] = true
+	}
+	return s.filter(func(l Listing) bool {
+		return isListed(l) && inRegion[l.RegionID] && matchesType(l, listingType)
+	}), nil
+}
+
+// EachListed calls fn with every published listing of a type, in ID order.
+// The listings are copied first so fn may be slow without holding the lock.
+func (s *ListingMemory) EachListed(ctx context.Context, listingType string, fn func(Listing) error) error {
+	for _, listing := range s.filter(func(l Listing) bool { return isListed(l) && matchesType(l, listingType) }) {
+		if err := fn(listing); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMapView returns the published listings inside a map viewport, optionally filtered by type and a
+// search query, newest first and clustered when zoomed out.
+func (s *ListingMemory) GetMapView(ctx context.Context, query MapQuery) (MapView, error) {
+	if err := query.check(); err != nil {
+		return MapView{}, err
+	}
+	listings := newestFirst(s.filter(func(l Listing) bool {
+		return isListed(l) && query.Box.Contains(l.Location) && matchesType(l, query.Type) && matchesSearch(l, query.Search)
+	}))
+	return ClusterListings(listings, query), nil
+}
+
+// GetByDateCreatedDescending returns listings newest first.
+func (s *ListingMemory) GetByDateCreatedDescending(ctx context.Context, listingType string) ([]Listing, error) {
+	return newestFirst(s.filter(func(l Listing) bool { return isListed(l) && matchesType(l, listingType) })), nil
+}
+
+// GetByDateCreatedAndSearchDescending returns matching listings newest first.
+func (s *ListingMemory) GetByDateCreatedAndSearchDescending(ctx context.Context, searchTerm, listingType string) ([]Listing, error) {
+	return newestFirst(s.filter(func(l Listing) bool {
+		return isListed(l) && matchesSearch(l, searchTerm) && matchesType(l, listingType)
+	})), nil
+}
+
+// SetStatus moves a listing to another status, starting a new lifetime when it is published.
+func (s *ListingMemory) SetStatus(ctx context.Context, listingID int, status string) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.listings[listingID]
+	if !ok || stored.DeletedAt != "" {
+		return fmt.Errorf("listing %w", ErrNotFound)
+	}
+	if err := checkTransition(stored.Status, status); err != nil {
+		return err
+	}
+	if status == ListingPublished && stored.Status != ListingPublished {
+		if err := s.store.checkPublishing(stored.UserID); err != nil {
+			return err
+		}
+	}
+	stored.Status = status
+	stored.Active = status == ListingPublished
+	if status == ListingPublished {
+		stored.ExpiresAt = fromNow(ListingLifetime(stored.Type))
+	}
+	s.store.listings[listingID] = stored
+	delete(s.store.remindedListings, listingID)
+	return nil
+}
+
+// Expire marks the published listings past their expiry date as expired and returns them.
+func (s *ListingMemory) Expire(ctx context.Context) ([]Listing, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	expired := []Listing{}
+	for _, id := range sortedKeys(s.store.listings) {
+		listing := s.store.listings[id]
+		if listing.DeletedAt != "" || !isListed(listing) || listing.ExpiresAt == "" || age(listing.ExpiresAt) < 0 {
+			continue
+		}
+		listing.Status = ListingExpired
+		listing.Active = false
+		s.store.listings[id] = listing
+		expired = append(expired, listing)
+	}
+	return expired, nil
+}
+
+// ExpiryReminders returns the published listings expiring within the given time whose
+// owners have not been reminded yet, and records that they now have been.
+func (s *ListingMemory) ExpiryReminders(ctx context.Context, within time.Duration) ([]Listing, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	reminders := []Listing{}
+	for _, id := range sortedKeys(s.store.listings) {
+		listing := s.store.listings[id]
+		if listing.DeletedAt != "" || !isListed(listing) || listing.ExpiresAt == "" || s.store.remindedListings[id] || age(listing.ExpiresAt) < -within {
+			continue
+		}
+		s.store.remindedListings[id] = true
+		reminders = append(reminders, listing)
+	}
+	return reminders, nil
+}
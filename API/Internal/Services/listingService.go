@@ -4,8 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
 	geo "github.com/paulmach/go.geo"
+	"time"
 )
 
 // Listing represents a listing in the marketplace
@@ -18,12 +19,12 @@ type Listing struct {
 	// Type specifies whether the listing is a request or offer
 	// Enum: 'Request', 'Offer'
 	// @example "Offer"
-	Type string `json:"type"`
+	Type string `json:"type" validate:"required,oneof=Request Offer"`
 
 	// Location is the geographical location of the listing
 	// Custom handling may be needed for geo.Point type
 	// @example {"lat": 34.0522, "lng": -118.2437}
-	Location *geo.Point `json:"location"`
+	Location *geo.Point `json:"location" validate:"coordinates"`
 
 	// UserID is the ID of the user who created the listing
 	// @example 1
@@ -31,11 +32,11 @@ type Listing struct {
 
 	// Title is the title of the listing
 	// @example "Looking for a plumber"
-	Title string `json:"title"`
+	Title string `json:"title" validate:"required,max=255"`
 
 	// Description is the detailed description of the listing
 	// @example "Need a plumber for a quick job fixing a leaky pipe."
-	Description string `json:"description"`
+	Description string `json:"description" validate:"required,max=5000"`
 
 	// DateCreated is the date when the listing was created
 	// Format: "2006-01-02 15:04:05"
@@ -53,16 +54,81 @@ type Listing struct {
 	// Country is the country where the listing is located
 	// @example "USA"
 	Country string `json:"country"`
+
+	// DeletedAt is only set on deleted listings, which are hidden until restored or purged
+	// @example "2024-12-16 14:30:00"
+	DeletedAt string `json:"deleted_at,omitempty"`
+
+	// Status is where the listing is in its lifecycle. New listings are published unless
+	// created as drafts; other changes go through the status and renew endpoints.
+	// @example "published"
+	Status string `json:"status" validate:"omitempty,oneof=draft published paused expired closed"`
+
+	// ExpiresAt is when a published listing expires unless it is renewed
+	// @example "2025-02-14 14:30:00"
+	ExpiresAt string `json:"expires_at,omitempty"`
+
+	// Category is the trade the listing is about, used by saved searches
+	// @example "plumbing"
+	Category string `json:"category,omitempty" validate:"omitempty,oneof=plumbing electrical carpentry painting tiling masonry roofing cleaning gardening moving hvac other"`
+
+	// Price is what an offer asks for or a request is willing to pay, 0 when unspecified. It is
+	// in major units of its currency, with no more decimals than the currency has.
+	// @example 150
+	Price float64 `json:"price,omitempty" validate:"min=0,money=currency_code"`
+
+	// CurrencyCode is the ISO 4217 code of the price's currency, USD when omitted
+	// @example "USD"
+	CurrencyCode string `json:"currency_code,omitempty" validate:"omitempty,currency"`
+
+	// FavouriteCount is how many users favourited or shortlisted the listing, only shown to its owner
+	// @example 4
+	FavouriteCount int `json:"favourite_count,omitempty"`
+
+	// RegionID is the most specific gazetteer region containing the location, 0 when outside every region
+	// @example 12
+	RegionID int `json:"region_id,omitempty"`
+
+	// Promotion labels a listing shown in a promoted slot of search results
+	Promotion *PromotionLabel `json:"promotion,omitempty"`
+}
+
+// listingColumns is the column list every listing query selects, in the order queryListings scans them
+func listingColumns(d Database.Dialect) string {
+	return `listing_id, type, ` + d.Point("location") + `, user_id, title, description, ` + d.Timestamp("date_created") + `, active, city, country,
+	COALESCE(` + d.Timestamp("deleted_at") + `, ''), status, COALESCE(` + d.Timestamp("expires_at") + `, ''), category, COALESCE(price_minor, 0), currency, COALESCE(region_id, 0)`
+}
+
+// listed is the condition for listings shown when browsing: published and not deleted
+const listed = `deleted_at IS NULL AND status = 'published'`
+
+// priceArg stores an unspecified (zero) listing price as NULL, and others in minor units
+func priceArg(listing Listing) sql.NullInt64 {
+	return sql.NullInt64{Int64: minorUnits(listing.Price, listing.CurrencyCode), Valid: listing.Price != 0}
+}
+
+// scanListing reads a row of listingColumns
+func scanListing(rows *sql.Rows) (Listing, error) {
+	var listing Listing
+	var price int64
+	if err := rows.Scan(&listing.ListingID, &listing.Type, &listing.Location, &listing.UserID,
+		&listing.Title, &listing.Description, &listing.DateCreated, &listing.Active, &listing.City, &listing.Country,
+		&listing.DeletedAt, &listing.Status, &listing.ExpiresAt, &listing.Category, &price, &listing.CurrencyCode, &listing.RegionID); err != nil {
+		return Listing{}, fmt.Errorf("could not scan listing: %v", err)
+	}
+	listing.Price = majorUnits(price, listing.CurrencyCode)
+	return listing, nil
 }
 
 // ListingService is the service layer for listing-related operations
 type ListingService struct {
-	db *sql.DB
+	db      *Database.DB
+	geocode GeocodeFunc
 }
 
 // ValidateCoordinates validates longitude and latitude, returning city and country
 func (s *ListingService) ValidateCoordinates(ctx context.Context, lat, lon float64) (string, string, error) {
-	city, country, err := Utils.ReverseGeocode(lat, lon)
+	city, country, err := s.geocode(lat, lon)
 	if err != nil {
 		return "", "", fmt.Errorf("error validating coordinates: %w", err)
 	}
@@ -71,63 +137,86 @@ func (s *ListingService) ValidateCoordinates(ctx context.Context, lat, lon float
 
 // Reusable function to query listings based on different conditions
 func (s *ListingService) queryListings(ctx context.Context, query string, args ...interface{}) ([]Listing, error) {
+	listings := []Listing{}
+	err := s.eachListing(ctx, query, func(listing Listing) error {
+		listings = append(listings, listing)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+// eachListing calls fn with every listing a query returns as it is read, stopping at the first error
+func (s *ListingService) eachListing(ctx context.Context, query string, fn func(Listing) error, args ...interface{}) error {
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("could not retrieve listings: %v", err)
+		return fmt.Errorf("could not retrieve listings: %v", err)
 	}
 	defer rows.Close()
 
-	var listings []Listing
 	for rows.Next() {
-		var listing Listing
-		if err := rows.Scan(&listing.ListingID, &listing.Type, &listing.Location, &listing.UserID,
-			&listing.Title, &listing.Description, &listing.DateCreated, &listing.Active,
-			&listing.City, &listing.Country); err != nil {
-			return nil, fmt.Errorf("could not scan listing: %v", err)
+		listing, err := scanListing(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(listing); err != nil {
+			return err
 		}
-		listings = append(listings, listing)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("could not iterate over listings: %v", err)
+		return fmt.Errorf("could not iterate over listings: %v", err)
 	}
+	return nil
+}
 
-	// Ensure an empty slice is returned if no rows were found
-	if len(listings) == 0 {
-		return []Listing{}, nil
+// EachListed calls fn with every published listing of a type, in ID order, without loading them all at once
+func (s *ListingService) EachListed(ctx context.Context, listingType string, fn func(Listing) error) error {
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed
+	if listingType == "Request" || listingType == "Offer" {
+		return s.eachListing(ctx, query+` AND type = ? ORDER BY listing_id`, fn, listingType)
 	}
-
-	return listings, nil
+	return s.eachListing(ctx, query+` ORDER BY listing_id`, fn)
 }
 
 // Create a new listing
 func (s *ListingService) Create(ctx context.Context, listing *Listing) (Listing, error) {
-	city, country, err := Utils.ReverseGeocode(listing.Location.Lat(), listing.Location.Lng())
+	city, country, err := s.geocode(listing.Location.Lat(), listing.Location.Lng())
 	if err != nil {
 		return Listing{}, fmt.Errorf("could not validate coordinates: %w", err)
 	}
 
 	listing.City = city
 	listing.Country = country
+	if listing.RegionID, err = locateRegion(ctx, s.db, listing.Location); err != nil {
+		return Listing{}, err
+	}
 
-	// Convert the location to WKT format
-	locationWKT := listing.Location.ToWKT()
+	// Drafts only start expiring once they are published
+	expiresAt := "NULL"
+	args := []interface{}{listing.Type, s.db.Dialect.PointArg(listing.Location), listing.UserID, listing.Title, listing.Description, listing.City, listing.Country, regionArg(listing.RegionID)}
+	if listing.Status != ListingDraft {
+		if err := checkPublishing(ctx, s.db, listing.UserID); err != nil {
+			return Listing{}, err
+		}
+		listing.Status = ListingPublished
+		expiresAt = s.db.Dialect.FromNow()
+	}
+	args = append(args, listing.Category, priceArg(*listing), CurrencyOrDefault(listing.CurrencyCode), listing.Status, listing.Status == ListingPublished)
+	if listing.Status == ListingPublished {
+		args = append(args, int64(ListingLifetime(listing.Type).Seconds()))
+	}
 
 	query := `
-        INSERT INTO listings (type, location, user_id, title, description, city, country)
-        VALUES (?, ST_GeomFromText(?), ?, ?, ?, ?, ?)
-    `
-	result, err := s.db.ExecContext(ctx, query, listing.Type, locationWKT, listing.UserID, listing.Title, listing.Description, listing.City, listing.Country)
+        INSERT INTO listings (type, location, user_id, title, description, city, country, region_id, category, price_minor, currency, status, active, expires_at)
+        VALUES (?, ` + s.db.Dialect.PointValue() + `, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ` + expiresAt + `)`
+	listingID, err := s.db.InsertID(ctx, query, "listing_id", args...)
 	if err != nil {
 		return Listing{}, fmt.Errorf("could not create listing: %v", err)
 	}
 
-	// Get the ID of the newly inserted listing
-	listingID, err := result.LastInsertId()
-	if err != nil {
-		return Listing{}, fmt.Errorf("could not retrieve last insert ID: %v", err)
-	}
-
 	// Retrieve the full listing by its ID
 	createdListing, err := s.GetByID(ctx, int(listingID))
 	if err != nil {
@@ -143,15 +232,18 @@ func (s *ListingService) Update(ctx context.Context, listing *Listing, listingID
 	if err != nil {
 		return err
 	}
+	regionID, err := locateRegion(ctx, s.db, listing.Location)
+	if err != nil {
+		return err
+	}
 
-	locationWKT := listing.Location.ToWKT()
-
+	// A new revision makes the saved search matcher look at the listing again
 	query := `
 		UPDATE listings
-		SET title = ?, description = ?, location = ST_GeomFromText(?), type = ?, city = ?, country = ?
-		WHERE listing_id = ?
+		SET title = ?, description = ?, location = ` + s.db.Dialect.PointValue() + `, type = ?, city = ?, country = ?, region_id = ?, category = ?, price_minor = ?, currency = ?, revision = revision + 1
+		WHERE listing_id = ? AND deleted_at IS NULL
 	`
-	_, err = s.db.ExecContext(ctx, query, listing.Title, listing.Description, locationWKT, listing.Type, city, country, listingID)
+	_, err = s.db.ExecContext(ctx, query, listing.Title, listing.Description, s.db.Dialect.PointArg(listing.Location), listing.Type, city, country, regionArg(regionID), listing.Category, priceArg(*listing), CurrencyOrDefault(listing.CurrencyCode), listingID)
 	if err != nil {
 		return fmt.Errorf("could not update listing: %v", err)
 	}
@@ -159,9 +251,10 @@ func (s *ListingService) Update(ctx context.Context, listing *Listing, listingID
 	return nil
 }
 
-// Delete a listing
+// Delete hides a listing until its owner restores it or the purge job removes it.
+// Its transactions are kept, so a listing can be deleted once it has been transacted on.
 func (s *ListingService) Delete(ctx context.Context, listingID int) error {
-	query := `DELETE FROM listings WHERE listing_id = ?`
+	query := `UPDATE listings SET deleted_at = CURRENT_TIMESTAMP WHERE listing_id = ? AND deleted_at IS NULL`
 	result, err := s.db.ExecContext(ctx, query, listingID)
 	if err != nil {
 		return fmt.Errorf("could not delete listing: %v", err)
@@ -172,31 +265,38 @@ func (s *ListingService) Delete(ctx context.Context, listingID int) error {
 		return fmt.Errorf("could not check affected rows: %v", err)
 	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("listing not found")
+		return fmt.Errorf("listing %w", ErrNotFound)
 	}
 
 	return nil
 }
 
-// TODO rpleace with query by city
-// Get listings by location within a radius (QueryByLocation)
-/*func (s *ListingService) QueryByLocation(ctx context.Context, lat, lon, radius float64, listingType string) ([]Listing, error) {
+// GetByRegion returns the published listings in a region or any region inside it
+func (s *ListingService) GetByRegion(ctx context.Context, regionID int, listingType string) ([]Listing, error) {
+	parents, err := regionParents(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	ids := descendants(parents, regionID)
+	args := make([]interface{}, 0, len(ids)+1)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND region_id IN (` + placeholders(len(ids)) + `)`
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE ST_Distance(location, ST_GeomFromText('POINT(?, ?)')) < ? AND type = ?`
-		return s.queryListings(ctx, query, lon, lat, radius, listingType)
-	} else {
-		query := `SELECT * FROM listings WHERE ST_Distance(location, ST_GeomFromText('POINT(?, ?)')) < ?`
-		return s.queryListings(ctx, query, lon, lat, radius)
+		return s.queryListings(ctx, query+` AND type = ?`, append(args, listingType)...)
 	}
-}*/
+	return s.queryListings(ctx, query, args...)
+}
 
 // Get listings ordered by date created, descending (GetByDateCreatedDescending)
 func (s *ListingService) GetByDateCreatedDescending(ctx context.Context, listingType string) ([]Listing, error) {
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE type = ? ORDER BY date_created DESC`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND type = ? ORDER BY date_created DESC, listing_id DESC`
 		return s.queryListings(ctx, query, listingType)
 	} else {
-		query := `SELECT * FROM listings ORDER BY date_created DESC`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` ORDER BY date_created DESC, listing_id DESC`
 		return s.queryListings(ctx, query)
 	}
 }
@@ -204,10 +304,10 @@ func (s *ListingService) GetByDateCreatedDescending(ctx context.Context, listing
 // Get listings ordered by date created and search term (GetByDateCreatedAndSearchDescending)
 func (s *ListingService) GetByDateCreatedAndSearchDescending(ctx context.Context, searchTerm, listingType string) ([]Listing, error) {
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE (title LIKE ? OR description LIKE ?) AND type = ? ORDER BY date_created DESC`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND (title ` + s.db.Dialect.Like() + ` ? OR description ` + s.db.Dialect.Like() + ` ?) AND type = ? ORDER BY date_created DESC, listing_id DESC`
 		return s.queryListings(ctx, query, "%"+searchTerm+"%", "%"+searchTerm+"%", listingType)
 	} else {
-		query := `SELECT * FROM listings WHERE (title LIKE ? OR description LIKE ?) ORDER BY date_created DESC`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND (title ` + s.db.Dialect.Like() + ` ? OR description ` + s.db.Dialect.Like() + ` ?) ORDER BY date_created DESC, listing_id DESC`
 		return s.queryListings(ctx, query, "%"+searchTerm+"%", "%"+searchTerm+"%")
 	}
 }
@@ -215,74 +315,169 @@ func (s *ListingService) GetByDateCreatedAndSearchDescending(ctx context.Context
 // Get listings by a search query in title or description (GetBySearch)
 func (s *ListingService) GetBySearch(ctx context.Context, searchTerm, listingType string) ([]Listing, error) {
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE (title LIKE ? OR description LIKE ?) AND type = ?`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND (title ` + s.db.Dialect.Like() + ` ? OR description ` + s.db.Dialect.Like() + ` ?) AND type = ?`
 		return s.queryListings(ctx, query, "%"+searchTerm+"%", "%"+searchTerm+"%", listingType)
 	} else {
-		query := `SELECT * FROM listings WHERE (title LIKE ? OR description LIKE ?)`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND (title ` + s.db.Dialect.Like() + ` ? OR description ` + s.db.Dialect.Like() + ` ?)`
 		return s.queryListings(ctx, query, "%"+searchTerm+"%", "%"+searchTerm+"%")
 	}
 }
 
+// queryNearby returns the listings matching the condition that lie within maxDistance kilometres of a point,
+// and the matching offers of users whose service area contains the point.
+// Dialects without spatial functions select the matching listings and filter them in Go.
+func (s *ListingService) queryNearby(ctx context.Context, latitude, longitude, maxDistance float64, condition string, args ...interface{}) ([]Listing, error) {
+	d := s.db.Dialect
+	query := `SELECT ` + listingColumns(d) + ` FROM listings WHERE ` + listed + ` AND ` + condition
+
+	distance, distanceOK := d.Distance("location")
+	contains, containsOK := d.Contains("area")
+	if !distanceOK || !containsOK {
+		serving, err := usersServing(ctx, s.db, latitude, longitude)
+		if err != nil {
+			return nil, err
+		}
+		listings, err := s.queryListings(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		nearby := []Listing{}
+		for _, listing := range listings {
+			if withinDistance(listing, latitude, longitude, maxDistance) || servesPoint(listing, serving) {
+				nearby = append(nearby, listing)
+			}
+		}
+		return nearby, nil
+	}
+
+	point := d.PointArg(geo.NewPoint(longitude, latitude))
+	query += ` AND (` + distance + ` < ? OR (type = 'Offer' AND user_id IN (SELECT user_id FROM service_areas WHERE ` + contains + `)))`
+	args = append(args, point, maxDistance*1000, point)
+	return s.queryListings(ctx, query, args...)
+}
+
 // Get listings by distance from a specific latitude and longitude (GetByDistance)
 func (s *ListingService) GetByDistance(ctx context.Context, latitude, longitude, maxDistance float64, listingType string) ([]Listing, error) {
-
-	maxDistance *= 1000
-	fmt.Println(longitude, latitude, maxDistance)
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE ST_Distance_Sphere(location, ST_GeomFromText(CONCAT('POINT(', ?, ' ', ?, ')'))) < ? AND type = ?`
-		return s.queryListings(ctx, query, longitude, latitude, maxDistance, listingType)
+		return s.queryNearby(ctx, latitude, longitude, maxDistance, `type = ?`, listingType)
 	} else {
-		query := `SELECT * FROM listings WHERE ST_Distance_Sphere(location, ST_GeomFromText(CONCAT('POINT(', ?, ' ', ?, ')'))) < ?`
-		return s.queryListings(ctx, query, longitude, latitude, maxDistance)
+		return s.queryNearby(ctx, latitude, longitude, maxDistance, `1 = 1`)
 	}
 }
 
 func (s *ListingService) GetByDistanceAndSearch(ctx context.Context, latitude, longitude, maxDistance float64, listingType string, searchQuery string) ([]Listing, error) {
-	// Sanitize or escape the search query to prevent SQL injection (optional but recommended)
-	maxDistance *= 1000
-	fmt.Println(longitude, latitude, maxDistance, searchQuery)
+	search := `(title ` + s.db.Dialect.Like() + ` ? OR description ` + s.db.Dialect.Like() + ` ?)`
+	pattern := "%" + searchQuery + "%"
 	// Check if listingType is valid and apply the relevant filter
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings 
-                 WHERE ST_Distance_Sphere(location, ST_GeomFromText(CONCAT('POINT(', ?, ' ', ?, ')'))) < ? 
-                 AND type = ? 
-                 AND (title LIKE ? OR description LIKE ?)`
-		// Execute the query with the appropriate parameters, including the search query
-		return s.queryListings(ctx, query, longitude, latitude, maxDistance, listingType, "%"+searchQuery+"%", "%"+searchQuery+"%")
+		return s.queryNearby(ctx, latitude, longitude, maxDistance, `type = ? AND `+search, listingType, pattern, pattern)
 	} else {
-		query := `SELECT * FROM listings 
-                 WHERE ST_Distance_Sphere(location, ST_GeomFromText(CONCAT('POINT(', ?, ' ', ?, ')'))) < ? 
-                 AND (title LIKE ? OR description LIKE ?)`
-		// Execute the query with the search filter
-		return s.queryListings(ctx, query, longitude, latitude, maxDistance, "%"+searchQuery+"%", "%"+searchQuery+"%")
+		return s.queryNearby(ctx, latitude, longitude, maxDistance, search, pattern, pattern)
 	}
 }
 
+// GetMapView returns the published listings inside a map viewport, optionally filtered by type and a
+// search query, newest first. Zoomed out, the listings are grouped into grid cells by the database
+// and only the listings alone in their cell are read.
+func (s *ListingService) GetMapView(ctx context.Context, q MapQuery) (MapView, error) {
+	if err := q.check(); err != nil {
+		return MapView{}, err
+	}
+
+	d := s.db.Dialect
+	condition := listed + ` AND ` + d.Within("location")
+	args := q.Box.args()
+	if q.Type == "Request" || q.Type == "Offer" {
+		condition += ` AND type = ?`
+		args = append(args, q.Type)
+	}
+	if q.Search != "" {
+		pattern := "%" + q.Search + "%"
+		condition += ` AND (title ` + d.Like() + ` ? OR description ` + d.Like() + ` ?)`
+		args = append(args, pattern, pattern)
+	}
+	// One row past the limit tells whether the view was cut short
+	limit, limitArgs := "", []interface{}{}
+	if q.Limit > 0 {
+		limit, limitArgs = ` LIMIT ?`, []interface{}{q.Limit + 1}
+	}
+
+	view := MapView{Zoom: q.Zoom, Clusters: []Cluster{}, Listings: []Listing{}}
+	if q.Zoom >= q.ClusterBelow {
+		listings, err := s.queryListings(ctx, `SELECT `+listingColumns(d)+` FROM listings WHERE `+condition+` ORDER BY date_created DESC, listing_id DESC`+limit, append(args, limitArgs...)...)
+		if err != nil {
+			return MapView{}, err
+		}
+		view.Listings = listings
+		return view.capped(q.Limit), nil
+	}
+
+	x, y := d.X("location"), d.Y("location")
+	cell := q.cellSize()
+	rows, err := s.db.QueryContext(ctx, `SELECT COUNT(*), MAX(listing_id), AVG(`+x+`), AVG(`+y+`), MIN(`+x+`), MIN(`+y+`), MAX(`+x+`), MAX(`+y+`)
+	          FROM listings WHERE `+condition+`
+	          GROUP BY FLOOR(`+x+` / ?), FLOOR(`+y+` / ?)
+	          ORDER BY COUNT(*) DESC, MAX(listing_id) DESC`+limit, append(append(args, cell, cell), limitArgs...)...)
+	if err != nil {
+		return MapView{}, fmt.Errorf("could not cluster listings: %v", err)
+	}
+	defer rows.Close()
+
+	var alone []interface{}
+	for rows.Next() {
+		var cluster Cluster
+		var listingID int
+		var lng, lat float64
+		b := &cluster.Bounds
+		if err := rows.Scan(&cluster.Count, &listingID, &lng, &lat, &b[0], &b[1], &b[2], &b[3]); err != nil {
+			return MapView{}, fmt.Errorf("could not scan cluster: %v", err)
+		}
+		if cluster.Count == 1 {
+			alone = append(alone, listingID)
+			continue
+		}
+		cluster.Location = geo.NewPoint(lng, lat)
+		view.Clusters = append(view.Clusters, cluster)
+	}
+	if err := rows.Err(); err != nil {
+		return MapView{}, err
+	}
+	rows.Close()
+
+	if len(alone) > 0 {
+		query := `SELECT ` + listingColumns(d) + ` FROM listings WHERE listing_id IN (` + placeholders(len(alone)) + `) ORDER BY date_created DESC, listing_id DESC`
+		if view.Listings, err = s.queryListings(ctx, query, alone...); err != nil {
+			return MapView{}, err
+		}
+	}
+	return view.capped(q.Limit), nil
+}
+
 // Get all listings (GetAll)
 func (s *ListingService) GetAll(ctx context.Context, listingType string) ([]Listing, error) {
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE type = ?`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND type = ?`
 		return s.queryListings(ctx, query, listingType)
 	} else {
-		query := `SELECT * FROM listings`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed
 		return s.queryListings(ctx, query)
 	}
 }
 
-// Get listings by user ID (GetByUserID)
+// Get listings by user ID in every status, for the owner to manage (GetByUserID)
 func (s *ListingService) GetByUserID(ctx context.Context, userID int, listingType string) ([]Listing, error) {
 	if listingType == "Request" || listingType == "Offer" {
-		query := `SELECT * FROM listings WHERE user_id = ? AND type = ?`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE deleted_at IS NULL AND user_id = ? AND type = ?`
 		return s.queryListings(ctx, query, userID, listingType)
 	} else {
-		query := `SELECT * FROM listings WHERE user_id = ?`
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE deleted_at IS NULL AND user_id = ?`
 		return s.queryListings(ctx, query, userID)
 	}
 }
 
 // Get a listing by its ID (GetByID)
 func (s *ListingService) GetByID(ctx context.Context, listingID int) (Listing, error) {
-	query := `SELECT * FROM listings WHERE listing_id = ?`
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE deleted_at IS NULL AND listing_id = ?`
 	rows, err := s.db.QueryContext(ctx, query, listingID)
 	if err != nil {
 		return Listing{}, fmt.Errorf("could not retrieve listing: %v", err)
@@ -290,11 +485,170 @@ func (s *ListingService) GetByID(ctx context.Context, listingID int) (Listing, e
 	defer rows.Close()
 
 	if rows.Next() {
-		var listing Listing
-		if err := rows.Scan(&listing.ListingID, &listing.Type, &listing.Location, &listing.UserID, &listing.Title, &listing.Description, &listing.DateCreated, &listing.Active, &listing.City, &listing.Country); err != nil {
-			return Listing{}, fmt.Errorf("could not scan listing: %v", err)
+		return scanListing(rows)
+	}
+	return Listing{}, fmt.Errorf("listing %w", ErrNotFound)
+}
+
+// Restore undoes the deletion of a listing by its owner, provided it was deleted less than within ago.
+// Listings of other users, or deleted too long ago, are reported as not found.
+func (s *ListingService) Restore(ctx context.Context, listingID, userID int, within time.Duration) error {
+	query := `UPDATE listings SET deleted_at = NULL
+	          WHERE listing_id = ? AND user_id = ? AND deleted_at IS NOT NULL AND ` + s.db.Dialect.Age("deleted_at") + ` < ?`
+	result, err := s.db.ExecContext(ctx, query, listingID, userID, within.Seconds())
+	if err != nil {
+		return fmt.Errorf("could not restore listing: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("deleted listing %w", ErrNotFound)
+	}
+	return nil
+}
+
+// GetDeleted returns the deleted listings that have not been purged yet, most recently deleted first
+func (s *ListingService) GetDeleted(ctx context.Context) ([]Listing, error) {
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, listing_id DESC`
+	return s.queryListings(ctx, query)
+}
+
+// Purge permanently removes the listings deleted more than olderThan ago, with their images.
+// Listings still referenced by a transaction are kept until that transaction is purged.
+func (s *ListingService) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	due := `deleted_at IS NOT NULL AND ` + s.db.Dialect.Age("deleted_at") + ` >= ?
+	            AND NOT EXISTS (SELECT 1 FROM transactions t WHERE t.listing_id = listings.listing_id)`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT url FROM images WHERE listing_id IN (SELECT listing_id FROM listings WHERE `+due+`)`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("could not list images: %w", err)
+	}
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan image: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM images WHERE listing_id IN (SELECT listing_id FROM listings WHERE `+due+`)`, olderThan.Seconds()); err != nil {
+		return 0, fmt.Errorf("could not delete images: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM saved_search_matches WHERE listing_id IN (SELECT listing_id FROM listings WHERE `+due+`)`, olderThan.Seconds()); err != nil {
+		return 0, fmt.Errorf("could not delete saved search matches: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM listings WHERE `+due, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("could not purge listings: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return purged, removeImageFiles(urls)
+}
+
+// SetStatus moves a listing to another status. Publishing starts a new lifetime, so it
+// also renews published and expired listings. Disallowed moves return ErrConflict.
+func (s *ListingService) SetStatus(ctx context.Context, listingID int, status string) error {
+	listing, err := s.GetByID(ctx, listingID)
+	if err != nil {
+		return err
+	}
+	if err := checkTransition(listing.Status, status); err != nil {
+		return err
+	}
+	if status == ListingPublished && listing.Status != ListingPublished {
+		if err := checkPublishing(ctx, s.db, listing.UserID); err != nil {
+			return err
+		}
+	}
+
+	expiresAt := "expires_at"
+	args := []interface{}{status, status == ListingPublished}
+	if status == ListingPublished {
+		expiresAt = s.db.Dialect.FromNow()
+		args = append(args, int64(ListingLifetime(listing.Type).Seconds()))
+	}
+	args = append(args, listingID, listing.Status)
+
+	// The status guard turns a concurrent change into a conflict instead of overwriting it
+	query := `UPDATE listings SET status = ?, active = ?, expires_at = ` + expiresAt + `, reminded_at = NULL
+	          WHERE listing_id = ? AND status = ? AND deleted_at IS NULL`
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not set listing status: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("listing changed while setting its status: %w", ErrConflict)
+	}
+	return nil
+}
+
+// Expire marks the published listings past their expiry date as expired and returns them
+func (s *ListingService) Expire(ctx context.Context) ([]Listing, error) {
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings WHERE ` + listed + ` AND ` + s.db.Dialect.Age("expires_at") + ` >= 0`
+	due, err := s.queryListings(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := []Listing{}
+	for _, listing := range due {
+		result, err := s.db.ExecContext(ctx, `UPDATE listings SET status = ?, active = ? WHERE listing_id = ? AND status = ?`,
+			ListingExpired, false, listing.ListingID, ListingPublished)
+		if err != nil {
+			return expired, fmt.Errorf("could not expire listing: %w", err)
+		}
+		// Listings renewed or paused since the select are left alone
+		if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 1 {
+			listing.Status = ListingExpired
+			listing.Active = false
+			expired = append(expired, listing)
+		}
+	}
+	return expired, nil
+}
+
+// ExpiryReminders returns the published listings expiring within the given time whose
+// owners have not been reminded yet, and records that they now have been
+func (s *ListingService) ExpiryReminders(ctx context.Context, within time.Duration) ([]Listing, error) {
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings
+	          WHERE ` + listed + ` AND reminded_at IS NULL AND ` + s.db.Dialect.Age("expires_at") + ` >= ?`
+	due, err := s.queryListings(ctx, query, -within.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	reminders := []Listing{}
+	for _, listing := range due {
+		result, err := s.db.ExecContext(ctx, `UPDATE listings SET reminded_at = CURRENT_TIMESTAMP WHERE listing_id = ? AND reminded_at IS NULL`, listing.ListingID)
+		if err != nil {
+			return reminders, fmt.Errorf("could not record reminder: %w", err)
+		}
+		if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 1 {
+			reminders = append(reminders, listing)
 		}
-		return listing, nil
 	}
-	return Listing{}, fmt.Errorf("listing not found")
+	return reminders, nil
 }
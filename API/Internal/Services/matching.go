@@ -0,0 +1,359 @@
+package Services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MatchWeights sets how much each factor counts towards a match score.
+// Weights are relative to each other; a zero weight ignores the factor.
+type MatchWeights struct {
+	Distance     float64
+	Text         float64
+	Category     float64
+	Price        float64
+	Availability float64
+	Rating       float64
+}
+
+// DefaultMatchWeights favours nearby offers for the same kind of work
+func DefaultMatchWeights() MatchWeights {
+	return MatchWeights{Distance: 3, Text: 2, Category: 2, Price: 1, Availability: 1, Rating: 1}
+}
+
+// MatchOptions tunes a matching run
+type MatchOptions struct {
+	Weights MatchWeights
+	// Radius is how far apart, in kilometres, a request and an offer may be
+	Radius float64
+	// Limit caps the number of suggestions, 0 for no limit
+	Limit int
+}
+
+// MatchReason explains how one factor contributed to a match score
+type MatchReason struct {
+	// Factor is distance, text, category, price, availability or rating
+	// @example "distance"
+	Factor string `json:"factor"`
+
+	// Score is how well the factor matched, between 0 and 1
+	// @example 0.87
+	Score float64 `json:"score"`
+
+	// @example 3
+	Weight float64 `json:"weight"`
+
+	// @example "3.2 km away"
+	Detail string `json:"detail"`
+}
+
+// Suggestion is a ranked match: an offer suggested for a request, or a request suggested to a tradesman
+type Suggestion struct {
+	// Listing is the suggested offer or request
+	Listing Listing `json:"listing"`
+
+	// MatchedListing is the request or offer it was matched against
+	MatchedListing Listing `json:"matched_listing"`
+
+	// Score is the weighted average of the reasons, between 0 and 1
+	// @example 0.78
+	Score float64 `json:"score"`
+
+	Reasons []MatchReason `json:"reasons"`
+}
+
+// MatchingService ranks offers against requests. It only reads other services,
+// so it works the same on every backend.
+type MatchingService struct {
+	listings interface {
+		GetByID(ctx context.Context, listingID int) (Listing, error)
+		GetByUserID(ctx context.Context, userID int, listingType string) ([]Listing, error)
+		GetByDistance(ctx context.Context, latitude, longitude, maxDistance float64, listingType string) ([]Listing, error)
+	}
+	transactions interface {
+		GetByOfferingUserAndStatus(ctx context.Context, offeringUserID int, status string) ([]Transaction, error)
+		Rating(ctx context.Context, userID int) (Rating, error)
+	}
+	rates interface {
+		Quote(ctx context.Context, from, to string) (ExchangeRate, error)
+	}
+}
+
+// tradesmanStats are the per-tradesman inputs of a score
+type tradesmanStats struct {
+	rating Rating
+	// ongoing is the number of accepted jobs that have not ended yet
+	ongoing int
+}
+
+// stats looks up a tradesman's rating and workload, caching them for the rest of the run
+func (m *MatchingService) stats(ctx context.Context, cache map[int]tradesmanStats, userID int) (tradesmanStats, error) {
+	if stats, ok := cache[userID]; ok {
+		return stats, nil
+	}
+
+	var stats tradesmanStats
+	var err error
+	if stats.rating, err = m.transactions.Rating(ctx, userID); err != nil {
+		return stats, err
+	}
+	accepted, err := m.transactions.GetByOfferingUserAndStatus(ctx, userID, "Accepted")
+	if err != nil {
+		return stats, err
+	}
+	today := time.Now().Format("2006-01-02")
+	for _, transaction := range accepted {
+		if transaction.JobEndDate >= today {
+			stats.ongoing++
+		}
+	}
+	cache[userID] = stats
+	return stats, nil
+}
+
+// inCurrency converts an offer's price to currency so it can be compared with a request's,
+// caching the rates for the rest of the run. An offer nobody has a rate for keeps its own
+// currency and its price is not compared.
+func (m *MatchingService) inCurrency(ctx context.Context, cache map[[2]string]ExchangeRate, offer Listing, currency string) (Listing, error) {
+	if offer.Price == 0 || currency == "" || offer.CurrencyCode == currency {
+		return offer, nil
+	}
+	key := [2]string{offer.CurrencyCode, currency}
+	rate, ok := cache[key]
+	if !ok {
+		quoted, err := m.rates.Quote(ctx, offer.CurrencyCode, currency)
+		if errors.Is(err, Rates.ErrNoRate) {
+			return offer, nil
+		}
+		if err != nil {
+			return offer, err
+		}
+		rate = quoted
+		cache[key] = rate
+	}
+	offer.Price, offer.CurrencyCode = rate.Convert(offer.Price).Amount, currency
+	return offer, nil
+}
+
+// SuggestTradesmen ranks the tradesmen whose offers are near a request, each with their best matching offer.
+func (m *MatchingService) SuggestTradesmen(ctx context.Context, requestID int, options MatchOptions) ([]Suggestion, error) {
+	request, err := m.listings.GetByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Type != "Request" {
+		return nil, Invalid("listing_id", "must be a request")
+	}
+
+	offers, err := m.listings.GetByDistance(ctx, request.Location.Lat(), request.Location.Lng(), options.Radius, "Offer")
+	if err != nil {
+		return nil, err
+	}
+
+	cache := map[int]tradesmanStats{}
+	rates := map[[2]string]ExchangeRate{}
+	best := map[int]Suggestion{}
+	for _, offer := range offers {
+		if offer.UserID == request.UserID {
+			continue
+		}
+		stats, err := m.stats(ctx, cache, offer.UserID)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := m.inCurrency(ctx, rates, offer, request.CurrencyCode)
+		if err != nil {
+			return nil, err
+		}
+		suggestion := score(request, converted, stats, options)
+		suggestion.Listing, suggestion.MatchedListing = offer, request
+		if current, ok := best[offer.UserID]; !ok || suggestion.Score > current.Score {
+			best[offer.UserID] = suggestion
+		}
+	}
+	return rank(best, options.Limit), nil
+}
+
+// JobsFor ranks the requests near any of a tradesman's published offers, each matched against their best offer for it.
+func (m *MatchingService) JobsFor(ctx context.Context, userID int, options MatchOptions) ([]Suggestion, error) {
+	offers, err := m.listings.GetByUserID(ctx, userID, "Offer")
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := m.stats(ctx, map[int]tradesmanStats{}, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := map[[2]string]ExchangeRate{}
+	best := map[int]Suggestion{}
+	for _, offer := range offers {
+		if offer.Status != ListingPublished {
+			continue
+		}
+		requests, err := m.listings.GetByDistance(ctx, offer.Location.Lat(), offer.Location.Lng(), options.Radius, "Request")
+		if err != nil {
+			return nil, err
+		}
+		for _, request := range requests {
+			if request.UserID == userID {
+				continue
+			}
+			converted, err := m.inCurrency(ctx, rates, offer, request.CurrencyCode)
+			if err != nil {
+				return nil, err
+			}
+			suggestion := score(request, converted, stats, options)
+			suggestion.Listing, suggestion.MatchedListing = request, offer
+			if current, ok := best[request.ListingID]; !ok || suggestion.Score > current.Score {
+				best[request.ListingID] = suggestion
+			}
+		}
+	}
+	return rank(best, options.Limit), nil
+}
+
+// rank orders suggestions by score, best first, breaking ties by the newest listing
+func rank(suggestions map[int]Suggestion, limit int) []Suggestion {
+	ranked := make([]Suggestion, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		ranked = append(ranked, suggestion)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Listing.ListingID > ranked[j].Listing.ListingID
+	})
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// score rates how well an offer, and the tradesman behind it, fits a request
+func score(request, offer Listing, stats tradesmanStats, options MatchOptions) Suggestion {
+	w := options.Weights
+	reasons := []MatchReason{
+		distanceReason(request, offer, options.Radius, w.Distance),
+		textReason(request, offer, w.Text),
+		categoryReason(request, offer, w.Category),
+		priceReason(request, offer, w.Price),
+		availabilityReason(stats, w.Availability),
+		ratingReason(stats, w.Rating),
+	}
+
+	var total, weights float64
+	for _, reason := range reasons {
+		total += reason.Score * reason.Weight
+		weights += reason.Weight
+	}
+	suggestion := Suggestion{Reasons: reasons}
+	if weights > 0 {
+		suggestion.Score = total / weights
+	}
+	return suggestion
+}
+
+func distanceReason(request, offer Listing, radius, weight float64) MatchReason {
+	km := request.Location.GeoDistanceFrom(offer.Location, true) / 1000
+	reason := MatchReason{Factor: "distance", Weight: weight, Detail: fmt.Sprintf("%.1f km away", km)}
+	if radius > 0 && km < radius {
+		reason.Score = 1 - km/radius
+	}
+	return reason
+}
+
+func textReason(request, offer Listing, weight float64) MatchReason {
+	requestWords := words(request.Title + " " + request.Description)
+	offerWords := words(offer.Title + " " + offer.Description)
+
+	var shared []string
+	for word := range requestWords {
+		if offerWords[word] {
+			shared = append(shared, word)
+		}
+	}
+	sort.Strings(shared)
+
+	reason := MatchReason{Factor: "text", Weight: weight, Detail: "no words in common"}
+	if len(shared) > 0 {
+		// Overlap against the shorter text, so a terse offer can still match a long request
+		reason.Score = float64(len(shared)) / float64(min(len(requestWords), len(offerWords)))
+		if len(shared) > 5 {
+			shared = shared[:5]
+		}
+		reason.Detail = "shares the words " + strings.Join(shared, ", ")
+	}
+	return reason
+}
+
+func categoryReason(request, offer Listing, weight float64) MatchReason {
+	reason := MatchReason{Factor: "category", Weight: weight}
+	switch {
+	case request.Category == "" || offer.Category == "":
+		reason.Score, reason.Detail = 0.5, "category not given"
+	case request.Category == offer.Category:
+		reason.Score, reason.Detail = 1, "both are "+offer.Category
+	default:
+		reason.Detail = fmt.Sprintf("offer is %s, request is %s", offer.Category, request.Category)
+	}
+	return reason
+}
+
+func priceReason(request, offer Listing, weight float64) MatchReason {
+	reason := MatchReason{Factor: "price", Weight: weight}
+	switch {
+	case request.Price == 0 || offer.Price == 0:
+		reason.Score, reason.Detail = 0.5, "price not given"
+	case request.CurrencyCode != offer.CurrencyCode:
+		reason.Score, reason.Detail = 0.5, fmt.Sprintf("asks in %s, no rate to %s", offer.CurrencyCode, request.CurrencyCode)
+	case offer.Price <= request.Price:
+		reason.Score, reason.Detail = 1, fmt.Sprintf("asks %.2f %s, within the budget of %.2f", offer.Price, offer.CurrencyCode, request.Price)
+	default:
+		reason.Score, reason.Detail = request.Price/offer.Price, fmt.Sprintf("asks %.2f %s, over the budget of %.2f", offer.Price, offer.CurrencyCode, request.Price)
+	}
+	return reason
+}
+
+func availabilityReason(stats tradesmanStats, weight float64) MatchReason {
+	reason := MatchReason{Factor: "availability", Weight: weight, Score: 1 / float64(1+stats.ongoing), Detail: "no ongoing jobs"}
+	if stats.ongoing > 0 {
+		reason.Detail = fmt.Sprintf("%d ongoing jobs", stats.ongoing)
+	}
+	return reason
+}
+
+func ratingReason(stats tradesmanStats, weight float64) MatchReason {
+	if stats.rating.Count == 0 {
+		return MatchReason{Factor: "rating", Weight: weight, Score: 0.5, Detail: "not rated yet"}
+	}
+	return MatchReason{Factor: "rating", Weight: weight, Score: stats.rating.Average / 5,
+		Detail: fmt.Sprintf("rated %.1f from %d jobs", stats.rating.Average, stats.rating.Count)}
+}
+
+// stopWords are left out of text similarity
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "need": true, "looking": true, "from": true,
+	"are": true, "you": true, "your": true, "our": true, "this": true, "that": true, "can": true,
+}
+
+// words returns the distinct lower case words of at least three letters in text
+func words(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) >= 3 && !stopWords[word] {
+			set[word] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,194 @@
+package Services
+
+import (
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeocodeFunc resolves a latitude/longitude pair to a city and country
+type GeocodeFunc func(lat, lon float64) (string, string, error)
+
+// memoryStore holds every table of the in-memory backend behind one lock,
+// so operations that touch several entities (e.g. setting a profile picture) stay consistent.
+type memoryStore struct {
+	mu      sync.RWMutex
+	geocode GeocodeFunc
+
+	users         map[int]DBUser
+	listings      map[int]Listing
+	images        map[int]Image
+	transactions  map[int]Transaction
+	notifications map[int]Notification
+
+	// remindedListings holds the listings whose owners were reminded of the coming expiry
+	remindedListings map[int]bool
+	// unmatchedListings holds the listings created or updated since the saved search matcher last ran
+	unmatchedListings map[int]bool
+
+	savedSearches map[int]SavedSearch
+	// searchMatches records, per saved search, each matched listing and whether its owner was notified
+	searchMatches map[int]map[int]bool
+	// searchDigests holds when each daily saved search was last summarised
+	searchDigests map[int]string
+
+	shortlists map[int]Shortlist
+	favourites map[int]favourite
+
+	serviceAreas map[int]ServiceArea
+	regions      map[int]Region
+
+	// payments are keyed by transaction, which has at most one
+	payments map[int]Payment
+	ledger   []LedgerEntry
+
+	milestones map[int]Milestone
+	invoices   map[int]Invoice
+
+	// exchangeRates are the rates set by admins, keyed by currency pair
+	exchangeRates map[[2]string]ExchangeRate
+	// transactionRates are the rates recorded when each transaction was accepted
+	transactionRates map[int][]ExchangeRate
+
+	// subscriptions are keyed by user, who has at most one; users without one are on the free plan
+	subscriptions       map[int]Subscription
+	subscriptionCharges []SubscriptionCharge
+
+	promotions map[int]Promotion
+	// promotionDays are the impressions, clicks and spend of each promotion, by day
+	promotionDays map[int]map[string]PromotionDay
+	// promotionClicks are the nonces of used click tokens, with the day they were issued for
+	promotionClicks map[string]string
+
+	// analyticsEvents are recorded events not rolled up yet, and analyticsDaily the rolled up counts
+	analyticsEvents []AnalyticsEvent
+	analyticsDaily  map[analyticsKey]int
+
+	// apiKeys finds the client of each key hash, and apiUsage meters clients by day
+	apiClients map[int]APIClient
+	apiKeys    map[string]int
+	apiUsage   map[int]map[string]APIUsage
+
+	nextUserID         int
+	nextListingID      int
+	nextImageID        int
+	nextTransactionID  int
+	nextNotificationID int
+	nextSearchID       int
+	nextShortlistID    int
+	nextFavouriteID    int
+	nextServiceAreaID  int
+	nextRegionID       int
+	nextPaymentID      int
+	nextLedgerEntryID  int
+	nextMilestoneID    int
+	nextInvoiceID      int
+	nextChargeID       int
+	nextPromotionID    int
+	nextAPIClientID    int
+}
+
+// ServiceMemory returns a Service backed entirely by process memory.
+// It is meant for tests and for running the API without MySQL.
+// A nil geocode leaves city and country as sent by the client, and nil rates only
+// quote the exchange rates set by admins.
+func ServiceMemory(geocode GeocodeFunc, payments Payments.Provider, rates Rates.Provider) Service {
+	store := &memoryStore{
+		geocode:           geocode,
+		users:             map[int]DBUser{},
+		listings:          map[int]Listing{},
+		images:            map[int]Image{},
+		transactions:      map[int]Transaction{},
+		notifications:     map[int]Notification{},
+		remindedListings:  map[int]bool{},
+		unmatchedListings: map[int]bool{},
+		savedSearches:     map[int]SavedSearch{},
+		searchMatches:     map[int]map[int]bool{},
+		searchDigests:     map[int]string{},
+		shortlists:        map[int]Shortlist{},
+		favourites:        map[int]favourite{},
+		serviceAreas:      map[int]ServiceArea{},
+		regions:           map[int]Region{},
+		payments:          map[int]Payment{},
+		milestones:        map[int]Milestone{},
+		invoices:          map[int]Invoice{},
+		exchangeRates:     map[[2]string]ExchangeRate{},
+		transactionRates:  map[int][]ExchangeRate{},
+		subscriptions:     map[int]Subscription{},
+		promotions:        map[int]Promotion{},
+		promotionDays:     map[int]map[string]PromotionDay{},
+		promotionClicks:   map[string]string{},
+		analyticsDaily:    map[analyticsKey]int{},
+		apiClients:        map[int]APIClient{},
+		apiKeys:           map[string]int{},
+		apiUsage:          map[int]map[string]APIUsage{},
+	}
+
+	escrow := &PaymentMemory{store: store, provider: payments}
+	service := Service{
+		Users:         &UserMemory{store: store},
+		Listings:      &ListingMemory{store: store},
+		Images:        &ImageMemory{store: store},
+		Transactions:  &TransactionMemory{store: store, payments: escrow},
+		Notifications: &NotificationMemory{store: store},
+		SavedSearches: &SavedSearchMemory{store: store},
+		Favourites:    &FavouriteMemory{store: store},
+		ServiceAreas:  &ServiceAreaMemory{store: store},
+		Regions:       &RegionMemory{store: store},
+		Payments:      escrow,
+		Milestones:    &MilestoneMemory{store: store, payments: escrow},
+		Invoices:      &InvoiceMemory{store: store},
+		ExchangeRates: &ExchangeRateMemory{store: store, provider: rates},
+		Subscriptions: &SubscriptionMemory{store: store, provider: payments},
+		Promotions:    &PromotionMemory{store: store, provider: payments},
+		Analytics:     &AnalyticsMemory{store: store},
+		APIClients:    &APIClientMemory{store: store},
+	}
+	service.Matching = &MatchingService{listings: service.Listings, transactions: service.Transactions, rates: service.ExchangeRates}
+	return service
+}
+
+// reverseGeocode applies the configured geocoder, keeping the given values when there is none
+func (m *memoryStore) reverseGeocode(lat, lon float64, city, country string) (string, string, error) {
+	if m.geocode == nil {
+		return city, country, nil
+	}
+	return m.geocode(lat, lon)
+}
+
+// now formats the current time the way MySQL returns timestamps
+func now() string {
+	return time.Now().Format("2006-01-02 15:04:05")
+}
+
+// fromNow formats the time d from now like now()
+func fromNow(d time.Duration) string {
+	return time.Now().Add(d).Format("2006-01-02 15:04:05")
+}
+
+// age returns how long ago a timestamp written by now() was
+func age(timestamp string) time.Duration {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", timestamp, time.Local)
+	if err != nil {
+		return 0
+	}
+	return time.Since(t)
+}
+
+// containsFold reports whether substr is within s, ignoring case like the default MySQL collation
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// sortedKeys returns map keys in ascending order, mirroring primary key order in SQL results
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
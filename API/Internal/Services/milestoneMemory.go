@@ -0,0 +1,115 @@
+package Services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// MilestoneMemory is the in-memory implementation of the Milestones interface
+type MilestoneMemory struct {
+	store    *memoryStore
+	payments *PaymentMemory
+}
+
+// byTransaction returns the milestones of a transaction in order. The caller holds the lock.
+func (m *MilestoneMemory) byTransaction(transactionID int) []Milestone {
+	milestones := []Milestone{}
+	for _, milestone := range m.store.milestones {
+		if milestone.TransactionID == transactionID {
+			milestone.Evidence = append([]string{}, milestone.Evidence...)
+			milestones = append(milestones, milestone)
+		}
+	}
+	sort.Slice(milestones, func(i, j int) bool { return milestones[i].Position < milestones[j].Position })
+	return milestones
+}
+
+// Set replaces the milestones of a transaction, as long as none of them has been started.
+// An empty list goes back to paying for the whole job at once.
+func (m *MilestoneMemory) Set(ctx context.Context, transaction Transaction, milestones []Milestone) ([]Milestone, error) {
+	planned, err := planMilestones(transaction, milestones)
+	if err != nil {
+		return nil, err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current := m.byTransaction(transaction.TransactionID)
+	if err := replanable(current); err != nil {
+		return nil, err
+	}
+	for _, milestone := range current {
+		delete(m.store.milestones, milestone.MilestoneID)
+	}
+	for i := range planned {
+		m.store.nextMilestoneID++
+		planned[i].MilestoneID = m.store.nextMilestoneID
+		m.store.milestones[planned[i].MilestoneID] = planned[i]
+	}
+	return m.byTransaction(transaction.TransactionID), nil
+}
+
+// GetByTransaction returns the milestones of a transaction in order
+func (m *MilestoneMemory) GetByTransaction(ctx context.Context, transactionID int) ([]Milestone, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	return m.byTransaction(transactionID), nil
+}
+
+// GetByID returns a milestone with its evidence
+func (m *MilestoneMemory) GetByID(ctx context.Context, milestoneID int) (Milestone, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	milestone, ok := m.store.milestones[milestoneID]
+	if !ok {
+		return Milestone{}, fmt.Errorf("milestone %w", ErrNotFound)
+	}
+	milestone.Evidence = append([]string{}, milestone.Evidence...)
+	return milestone, nil
+}
+
+// MarkDone records the tradesman's photos of a finished milestone for the client to approve
+func (m *MilestoneMemory) MarkDone(ctx context.Context, milestoneID int, evidence []string) (Milestone, error) {
+	return m.advance(milestoneID, MilestoneDone, func(milestone *Milestone) error {
+		milestone.Evidence = append(milestone.Evidence, evidence...)
+		milestone.DateDone = now()
+		return nil
+	})
+}
+
+// Approve accepts a milestone the tradesman marked done and releases its amount from escrow, when
+// the transaction was paid for. The milestone stays done when the payout fails.
+func (m *MilestoneMemory) Approve(ctx context.Context, milestoneID int) (Milestone, error) {
+	return m.advance(milestoneID, MilestoneApproved, func(milestone *Milestone) error {
+		_, err := m.payments.settleLocked(milestone.TransactionID, MovementRelease, milestone.Amount, m.payments.payout(ctx))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		milestone.DateApproved = now()
+		return nil
+	})
+}
+
+// advance moves a milestone to its next status and applies change, leaving it as it was when change fails
+func (m *MilestoneMemory) advance(milestoneID int, status string, change func(*Milestone) error) (Milestone, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	milestone, ok := m.store.milestones[milestoneID]
+	if !ok {
+		return Milestone{}, fmt.Errorf("milestone %w", ErrNotFound)
+	}
+	if err := advance(milestone, status); err != nil {
+		return Milestone{}, err
+	}
+	milestone.Status = status
+	if err := change(&milestone); err != nil {
+		return Milestone{}, err
+	}
+	m.store.milestones[milestoneID] = milestone
+	return milestone, nil
+}
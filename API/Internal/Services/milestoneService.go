@@ -0,0 +1,188 @@
+package Services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+)
+
+// milestoneColumns is the column list every milestone query selects, in the order queryMilestones scans them
+func milestoneColumns(d Database.Dialect) string {
+	return `milestone_id, transaction_id, position, description, amount_minor, ` + d.Date("due_date") + `, status,
+	COALESCE(` + d.Timestamp("date_done") + `, ''), COALESCE(` + d.Timestamp("date_approved") + `, ''),
+	(SELECT currency FROM transactions WHERE transactions.transaction_id = milestones.transaction_id)`
+}
+
+type MilestoneService struct {
+	db       *Database.DB
+	payments *PaymentService
+}
+
+// queryMilestones runs a query selecting milestoneColumns and attaches the evidence of each milestone
+func (m *MilestoneService) queryMilestones(ctx context.Context, query string, args ...interface{}) ([]Milestone, error) {
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve milestones: %w", err)
+	}
+
+	milestones := []Milestone{}
+	for rows.Next() {
+		milestone := Milestone{Evidence: []string{}}
+		var amount int64
+		var currency string
+		if err := rows.Scan(&milestone.MilestoneID, &milestone.TransactionID, &milestone.Position, &milestone.Description,
+			&amount, &milestone.DueDate, &milestone.Status, &milestone.DateDone, &milestone.DateApproved, &currency); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("could not scan milestone: %w", err)
+		}
+		milestone.Amount = majorUnits(amount, currency)
+		milestones = append(milestones, milestone)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate over milestones: %w", err)
+	}
+
+	// The milestones are read in full first, as SQLite has a single connection
+	for i := range milestones {
+		evidence, err := m.db.QueryContext(ctx, `SELECT url FROM milestone_evidence WHERE milestone_id = ? ORDER BY evidence_id`, milestones[i].MilestoneID)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve milestone evidence: %w", err)
+		}
+		for evidence.Next() {
+			var url string
+			if err := evidence.Scan(&url); err != nil {
+				evidence.Close()
+				return nil, fmt.Errorf("could not scan milestone evidence: %w", err)
+			}
+			milestones[i].Evidence = append(milestones[i].Evidence, url)
+		}
+		evidence.Close()
+	}
+	return milestones, nil
+}
+
+// Set replaces the milestones of a transaction, as long as none of them has been started.
+// An empty list goes back to paying for the whole job at once.
+func (m *MilestoneService) Set(ctx context.Context, transaction Transaction, milestones []Milestone) ([]Milestone, error) {
+	planned, err := planMilestones(transaction, milestones)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var started int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM milestones WHERE transaction_id = ? AND status <> ?`,
+		transaction.TransactionID, MilestonePending).Scan(&started)
+	if err != nil {
+		return nil, fmt.Errorf("could not check milestones: %w", err)
+	}
+	if started > 0 {
+		return nil, fmt.Errorf("milestones were already started: %w", ErrConflict)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM milestones WHERE transaction_id = ?`, transaction.TransactionID); err != nil {
+		return nil, fmt.Errorf("could not replace milestones: %w", err)
+	}
+	for _, milestone := range planned {
+		_, err := tx.ExecContext(ctx, `INSERT INTO milestones (transaction_id, position, description, amount_minor, due_date) VALUES (?, ?, ?, ?, ?)`,
+			milestone.TransactionID, milestone.Position, milestone.Description, minorUnits(milestone.Amount, transaction.CurrencyCode), milestone.DueDate)
+		if err != nil {
+			return nil, fmt.Errorf("could not create milestone: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return m.GetByTransaction(ctx, transaction.TransactionID)
+}
+
+// GetByTransaction returns the milestones of a transaction in order
+func (m *MilestoneService) GetByTransaction(ctx context.Context, transactionID int) ([]Milestone, error) {
+	return m.queryMilestones(ctx, `SELECT `+milestoneColumns(m.db.Dialect)+` FROM milestones WHERE transaction_id = ? ORDER BY position`, transactionID)
+}
+
+// GetByID returns a milestone with its evidence
+func (m *MilestoneService) GetByID(ctx context.Context, milestoneID int) (Milestone, error) {
+	milestones, err := m.queryMilestones(ctx, `SELECT `+milestoneColumns(m.db.Dialect)+` FROM milestones WHERE milestone_id = ?`, milestoneID)
+	if err != nil {
+		return Milestone{}, err
+	}
+	if len(milestones) == 0 {
+		return Milestone{}, fmt.Errorf("milestone %w", ErrNotFound)
+	}
+	return milestones[0], nil
+}
+
+// MarkDone records the tradesman's photos of a finished milestone for the client to approve
+func (m *MilestoneService) MarkDone(ctx context.Context, milestoneID int, evidence []string) (Milestone, error) {
+	return m.advance(ctx, milestoneID, MilestoneDone, "date_done", func(tx *Database.Tx) error {
+		for _, url := range evidence {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO milestone_evidence (milestone_id, url) VALUES (?, ?)`, milestoneID, url); err != nil {
+				return fmt.Errorf("could not record milestone evidence: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Approve accepts a milestone the tradesman marked done and releases its amount from escrow, when
+// the transaction was paid for. Both happen in one transaction, so the milestone is only approved
+// once and stays done when the payout fails.
+func (m *MilestoneService) Approve(ctx context.Context, milestoneID int) (Milestone, error) {
+	milestone, err := m.GetByID(ctx, milestoneID)
+	if err != nil {
+		return Milestone{}, err
+	}
+	release, err := m.payments.plan(ctx, milestone.TransactionID, MovementRelease, milestone.Amount, m.payments.payout(ctx))
+	unpaid := errors.Is(err, ErrNotFound)
+	if err != nil && !unpaid {
+		return Milestone{}, err
+	}
+	return m.advance(ctx, milestoneID, MilestoneApproved, "date_approved", func(tx *Database.Tx) error {
+		if unpaid {
+			return nil
+		}
+		return m.payments.apply(ctx, tx, release)
+	})
+}
+
+// advance moves a milestone to its next status, stamping dateColumn, and runs also in the same transaction
+func (m *MilestoneService) advance(ctx context.Context, milestoneID int, status, dateColumn string, also func(*Database.Tx) error) (Milestone, error) {
+	milestone, err := m.GetByID(ctx, milestoneID)
+	if err != nil {
+		return Milestone{}, err
+	}
+	if err := advance(milestone, status); err != nil {
+		return Milestone{}, err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Milestone{}, err
+	}
+	defer tx.Rollback()
+
+	// The status guard turns a concurrent change into a conflict instead of repeating it
+	result, err := tx.ExecContext(ctx, `UPDATE milestones SET status = ?, `+dateColumn+` = CURRENT_TIMESTAMP WHERE milestone_id = ? AND status = ?`,
+		status, milestoneID, milestone.Status)
+	if err != nil {
+		return Milestone{}, fmt.Errorf("could not update milestone: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return Milestone{}, fmt.Errorf("milestone changed while updating it: %w", ErrConflict)
+	}
+	if err := also(tx); err != nil {
+		return Milestone{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Milestone{}, err
+	}
+	return m.GetByID(ctx, milestoneID)
+}
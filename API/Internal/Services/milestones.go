@@ -0,0 +1,128 @@
+package Services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Statuses of a milestone
+const (
+	MilestonePending  = "Pending"
+	MilestoneDone     = "Done"
+	MilestoneApproved = "Approved"
+)
+
+// maxMilestones keeps a transaction's plan short enough to fit in its contract
+const maxMilestones = 20
+
+// Milestone is one part of a transaction's job, paid for out of escrow once the client approves it
+type Milestone struct {
+	// @example 3
+	MilestoneID int `json:"milestone_id"`
+
+	// @example 12345
+	TransactionID int `json:"transaction_id"`
+
+	// Position orders the milestones of a transaction, from 1
+	// @example 1
+	Position int `json:"position"`
+
+	// @example "Remove the old tiles and level the floor"
+	Description string `json:"description" validate:"required,max=500"`
+
+	// Amount is the part of the transaction price paid for this milestone, in its currency
+	// @example 40.00
+	Amount float64 `json:"amount" validate:"required,min=0.01"`
+
+	// DueDate falls between the job's start and end dates
+	// Format: "2006-01-02"
+	// @example "2024-12-22"
+	DueDate string `json:"due_date" validate:"required,date"`
+
+	// Status is Pending, Done once the tradesman marks it with evidence, or Approved by the client
+	// @example "Pending"
+	Status string `json:"status"`
+
+	// Evidence are the photos the tradesman uploaded, served by /image/image/{image_id}
+	// @example ["0b7e3c3a-5b1f-4d2e-9a55-6f0f2d1c9e41.jpg"]
+	Evidence []string `json:"evidence"`
+
+	// @example "2024-12-22 17:45:00"
+	DateDone string `json:"date_done,omitempty"`
+
+	// @example "2024-12-23 09:10:00"
+	DateApproved string `json:"date_approved,omitempty"`
+}
+
+// planMilestones checks that milestones split the transaction's price and fall within its
+// job dates, and returns them numbered in order as unsaved Pending milestones
+func planMilestones(transaction Transaction, milestones []Milestone) ([]Milestone, error) {
+	if len(milestones) > maxMilestones {
+		return nil, Invalid("milestones", fmt.Sprintf("must be at most %d", maxMilestones))
+	}
+
+	planned := make([]Milestone, 0, len(milestones))
+	for i, milestone := range milestones {
+		if strings.TrimSpace(milestone.Description) == "" {
+			return nil, Invalid("milestones", fmt.Sprintf("milestone %d needs a description", i+1))
+		}
+		if minorUnits(milestone.Amount, transaction.CurrencyCode) <= 0 {
+			return nil, Invalid("milestones", fmt.Sprintf("milestone %d needs a positive amount", i+1))
+		}
+		if _, err := time.Parse("2006-01-02", milestone.DueDate); err != nil {
+			return nil, Invalid("milestones", fmt.Sprintf("milestone %d needs a due date formatted YYYY-MM-DD", i+1))
+		}
+		// Dates formatted YYYY-MM-DD compare as strings
+		if milestone.DueDate < transaction.JobStartDate || milestone.DueDate > transaction.JobEndDate {
+			return nil, Invalid("milestones", fmt.Sprintf("milestone %d is due outside the job, from %s to %s",
+				i+1, transaction.JobStartDate, transaction.JobEndDate))
+		}
+		planned = append(planned, Milestone{
+			TransactionID: transaction.TransactionID,
+			Position:      i + 1,
+			Description:   strings.TrimSpace(milestone.Description),
+			Amount:        roundMoney(milestone.Amount, transaction.CurrencyCode),
+			DueDate:       milestone.DueDate,
+			Status:        MilestonePending,
+			Evidence:      []string{},
+		})
+	}
+	if len(planned) > 0 {
+		if err := MilestonesCoverPrice(transaction, planned); err != nil {
+			return nil, err
+		}
+	}
+	return planned, nil
+}
+
+// MilestonesCoverPrice checks that the milestones of a transaction add up to its price, to the minor unit
+func MilestonesCoverPrice(transaction Transaction, milestones []Milestone) error {
+	var total int64
+	for _, milestone := range milestones {
+		total += minorUnits(milestone.Amount, transaction.CurrencyCode)
+	}
+	if total != minorUnits(transaction.Price, transaction.CurrencyCode) {
+		return Invalid("milestones", fmt.Sprintf("must add up to the price of %v, not %v", transaction.Price, majorUnits(total, transaction.CurrencyCode)))
+	}
+	return nil
+}
+
+// replanable checks that none of a transaction's milestones has been started, so the plan can still change
+func replanable(milestones []Milestone) error {
+	for _, milestone := range milestones {
+		if milestone.Status != MilestonePending {
+			return fmt.Errorf("milestone %d is already %s: %w", milestone.Position, milestone.Status, ErrConflict)
+		}
+	}
+	return nil
+}
+
+// advance checks that a milestone can move to status, from Pending to Done to Approved
+func advance(milestone Milestone, status string) error {
+	from := map[string]string{MilestoneDone: MilestonePending, MilestoneApproved: MilestoneDone}[status]
+	if milestone.Status != from {
+		return fmt.Errorf("milestone is %s, not %s: %w", milestone.Status, from, ErrConflict)
+	}
+	return nil
+}
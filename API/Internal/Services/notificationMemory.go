@@ -0,0 +1,56 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+)
+
+// NotificationMemory is the in-memory implementation of the Notifications interface
+type NotificationMemory struct {
+	store *memoryStore
+}
+
+// Create stores a notification for its user.
+func (n *NotificationMemory) Create(ctx context.Context, notification *Notification) error {
+	n.store.mu.Lock()
+	defer n.store.mu.Unlock()
+
+	n.store.nextNotificationID++
+	notification.NotificationID = n.store.nextNotificationID
+	notification.DateCreated = now()
+	notification.ReadAt = ""
+	n.store.notifications[notification.NotificationID] = *notification
+	return nil
+}
+
+// GetByUser returns a user's notifications, newest first.
+func (n *NotificationMemory) GetByUser(ctx context.Context, userID int, unreadOnly bool) ([]Notification, error) {
+	n.store.mu.RLock()
+	defer n.store.mu.RUnlock()
+
+	notifications := []Notification{}
+	ids := sortedKeys(n.store.notifications)
+	for i := len(ids) - 1; i >= 0; i-- {
+		notification := n.store.notifications[ids[i]]
+		if notification.UserID == userID && (!unreadOnly || notification.ReadAt == "") {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications, nil
+}
+
+// MarkRead marks one of a user's notifications as read.
+func (n *NotificationMemory) MarkRead(ctx context.Context, notificationID, userID int) error {
+	n.store.mu.Lock()
+	defer n.store.mu.Unlock()
+
+	notification, ok := n.store.notifications[notificationID]
+	if !ok || notification.UserID != userID {
+		return fmt.Errorf("notification %w", ErrNotFound)
+	}
+	if notification.ReadAt == "" {
+		notification.ReadAt = now()
+		n.store.notifications[notificationID] = notification
+	}
+	return nil
+}
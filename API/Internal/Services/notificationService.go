@@ -0,0 +1,120 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+)
+
+// Notification kinds
+const (
+	NotifyListingExpiring = "listing_expiring"
+	NotifyListingExpired  = "listing_expired"
+	NotifySearchMatch     = "search_match"
+	NotifySearchDigest    = "search_digest"
+	NotifyListingPaused   = "listing_paused"
+	NotifyPlanRenewed     = "plan_renewed"
+	NotifyPlanEnded       = "plan_ended"
+	NotifyPromotionEnded  = "promotion_ended"
+)
+
+// Notification is a message for a user, shown in their in-app feed
+type Notification struct {
+	// @example 1
+	NotificationID int `json:"notification_id"`
+
+	// UserID is the user the notification is for
+	// @example 2
+	UserID int `json:"user_id"`
+
+	// Kind identifies what happened, e.g. "listing_expiring"
+	// @example "listing_expiring"
+	Kind string `json:"kind"`
+
+	// @example "Your listing \"Tiling work\" expires on 2025-02-14 14:30:00. Renew it to keep it visible."
+	Message string `json:"message"`
+
+	// ListingID is the listing the notification is about, if any
+	// @example 101
+	ListingID int `json:"listing_id,omitempty"`
+
+	// @example "2024-12-16 14:30:00"
+	DateCreated string `json:"date_created"`
+
+	// ReadAt is set once the user has marked the notification as read
+	// @example "2024-12-16 15:00:00"
+	ReadAt string `json:"read_at,omitempty"`
+}
+
+// notificationColumns is the column list the notification queries select, in the order they scan them
+func notificationColumns(d Database.Dialect) string {
+	return `notification_id, user_id, kind, message, COALESCE(listing_id, 0), ` + d.Timestamp("date_created") + `, COALESCE(` + d.Timestamp("read_at") + `, '')`
+}
+
+type NotificationService struct {
+	db *Database.DB
+}
+
+// Create stores a notification for its user
+func (n *NotificationService) Create(ctx context.Context, notification *Notification) error {
+	query := `INSERT INTO notifications (user_id, kind, message, listing_id) VALUES (?, ?, ?, ?)`
+	id, err := n.db.InsertID(ctx, query, "notification_id", notification.UserID, notification.Kind, notification.Message,
+		sql.NullInt64{Int64: int64(notification.ListingID), Valid: notification.ListingID != 0})
+	if err != nil {
+		return fmt.Errorf("could not create notification: %w", err)
+	}
+	notification.NotificationID = int(id)
+	return nil
+}
+
+// GetByUser returns a user's notifications, newest first
+func (n *NotificationService) GetByUser(ctx context.Context, userID int, unreadOnly bool) ([]Notification, error) {
+	query := `SELECT ` + notificationColumns(n.db.Dialect) + ` FROM notifications WHERE user_id = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY date_created DESC, notification_id DESC`
+
+	rows, err := n.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		if err := rows.Scan(&notification.NotificationID, &notification.UserID, &notification.Kind, &notification.Message,
+			&notification.ListingID, &notification.DateCreated, &notification.ReadAt); err != nil {
+			return nil, fmt.Errorf("could not scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkRead marks one of a user's notifications as read. Other users' notifications are not found.
+func (n *NotificationService) MarkRead(ctx context.Context, notificationID, userID int) error {
+	query := `UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE notification_id = ? AND user_id = ? AND read_at IS NULL`
+	result, err := n.db.ExecContext(ctx, query, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("could not mark notification as read: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// Marking an already read notification again is not an error
+		var exists int
+		err := n.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE notification_id = ? AND user_id = ?`, notificationID, userID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("notification %w", ErrNotFound)
+		}
+	}
+	return nil
+}
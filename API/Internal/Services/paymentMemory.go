@@ -0,0 +1,184 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"sort"
+	"strconv"
+)
+
+// PaymentMemory is the in-memory implementation of the Payments interface.
+// The provider is called under the store's lock, so settlements cannot race.
+type PaymentMemory struct {
+	store    *memoryStore
+	provider Payments.Provider
+}
+
+// recordEntries appends the entries of a movement to the ledger. The caller holds the lock.
+func (p *PaymentMemory) recordEntries(entries []LedgerEntry) {
+	for _, entry := range entries {
+		p.store.nextLedgerEntryID++
+		entry.EntryID = p.store.nextLedgerEntryID
+		entry.DateCreated = now()
+		p.store.ledger = append(p.store.ledger, entry)
+	}
+}
+
+// withEntries returns a payment with its ledger entries. The caller holds the lock.
+func (p *PaymentMemory) withEntries(payment Payment) Payment {
+	payment.Entries = []LedgerEntry{}
+	for _, entry := range p.store.ledger {
+		if entry.PaymentID == payment.PaymentID {
+			payment.Entries = append(payment.Entries, entry)
+		}
+	}
+	return payment
+}
+
+// Hold charges the client the transaction's price and keeps it in escrow. A transaction is paid for once.
+func (p *PaymentMemory) Hold(ctx context.Context, transaction Transaction, feePercent float64) (Payment, error) {
+	payment, err := newPayment(transaction, feePercent)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+
+	return p.holdLocked(ctx, payment)
+}
+
+// holdLocked charges the client for a payment and records it. The caller holds the lock.
+func (p *PaymentMemory) holdLocked(ctx context.Context, payment Payment) (Payment, error) {
+	if _, ok := p.store.payments[payment.TransactionID]; ok {
+		return Payment{}, fmt.Errorf("payment for this transaction %w", ErrConflict)
+	}
+	reference, err := p.provider.Charge(ctx, Payments.Charge{PayerID: payment.PayerID, Amount: payment.Amount, Currency: payment.Currency,
+		Description: "Deposit for transaction " + strconv.Itoa(payment.TransactionID)})
+	if err != nil {
+		return Payment{}, paymentFailed(err)
+	}
+
+	p.store.nextPaymentID++
+	payment.PaymentID = p.store.nextPaymentID
+	payment.Provider = p.provider.Name()
+	payment.Reference = reference
+	payment.DateCreated = now()
+	p.store.payments[payment.TransactionID] = payment
+	p.recordEntries(movementEntries(payment, MovementHold, payment.Amount, 0))
+
+	return p.withEntries(payment), nil
+}
+
+// settle moves part or all of what is left of a held payment out of escrow, either to the
+// tradesman and the platform or back to the client
+func (p *PaymentMemory) settle(transactionID int, movement string, amount float64, move func(Payment, part) error) (Payment, error) {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+
+	return p.settleLocked(transactionID, movement, amount, move)
+}
+
+// settleLocked is settle for a caller that holds the lock
+func (p *PaymentMemory) settleLocked(transactionID int, movement string, amount float64, move func(Payment, part) error) (Payment, error) {
+	payment, ok := p.store.payments[transactionID]
+	if !ok {
+		return Payment{}, fmt.Errorf("payment %w", ErrNotFound)
+	}
+	if err := settleable(payment); err != nil {
+		return Payment{}, err
+	}
+	taken, err := portion(p.withEntries(payment), movement, amount)
+	if err != nil {
+		return Payment{}, err
+	}
+	if err := move(payment, taken); err != nil {
+		return Payment{}, paymentFailed(err)
+	}
+
+	if movement == MovementRelease {
+		payment.Released = roundMoney(payment.Released+taken.amount, payment.Currency)
+	}
+	if taken.last {
+		payment.Status = settledStatus(movement)
+		payment.DateSettled = now()
+	}
+	p.store.payments[transactionID] = payment
+	p.recordEntries(movementEntries(payment, movement, taken.amount, taken.fee))
+
+	return p.withEntries(payment), nil
+}
+
+// payout pays the tradesman their part of a release, less its fee
+func (p *PaymentMemory) payout(ctx context.Context) func(Payment, part) error {
+	return func(payment Payment, taken part) error {
+		return p.provider.Payout(ctx, Payments.Payout{Reference: payment.Reference, PayeeID: payment.PayeeID,
+			Amount: roundMoney(taken.amount-taken.fee, payment.Currency), Fee: taken.fee, Currency: payment.Currency})
+	}
+}
+
+// Release pays what is left of a held deposit to the tradesman, less the platform fee
+func (p *PaymentMemory) Release(ctx context.Context, transactionID int) (Payment, error) {
+	return p.ReleasePart(ctx, transactionID, 0)
+}
+
+// ReleasePart pays amount of a held deposit to the tradesman, less its share of the platform
+// fee. The deposit stays held until all of it is released.
+func (p *PaymentMemory) ReleasePart(ctx context.Context, transactionID int, amount float64) (Payment, error) {
+	return p.settle(transactionID, MovementRelease, amount, p.payout(ctx))
+}
+
+// refund gives the client their part of a refund back
+func (p *PaymentMemory) refund(ctx context.Context) func(Payment, part) error {
+	return func(payment Payment, taken part) error {
+		return p.provider.Refund(ctx, payment.Reference, taken.amount)
+	}
+}
+
+// mover returns how the money of a movement out of escrow is moved
+func (p *PaymentMemory) mover(ctx context.Context, movement string) func(Payment, part) error {
+	if movement == MovementRefund {
+		return p.refund(ctx)
+	}
+	return p.payout(ctx)
+}
+
+// Refund gives what is left of a held deposit back to the client
+func (p *PaymentMemory) Refund(ctx context.Context, transactionID int) (Payment, error) {
+	return p.settle(transactionID, MovementRefund, 0, p.refund(ctx))
+}
+
+// GetByTransaction returns the payment of a transaction with its ledger entries
+func (p *PaymentMemory) GetByTransaction(ctx context.Context, transactionID int) (Payment, error) {
+	p.store.mu.RLock()
+	defer p.store.mu.RUnlock()
+
+	payment, ok := p.store.payments[transactionID]
+	if !ok {
+		return Payment{}, fmt.Errorf("payment %w", ErrNotFound)
+	}
+	return p.withEntries(payment), nil
+}
+
+// Balances sums the ledger by account and currency. Escrow holds the deposits not settled yet.
+func (p *PaymentMemory) Balances(ctx context.Context) ([]LedgerBalance, error) {
+	p.store.mu.RLock()
+	defer p.store.mu.RUnlock()
+
+	sums := map[[2]string]float64{}
+	for _, entry := range p.store.ledger {
+		sums[[2]string{entry.Account, entry.Currency}] += entry.Amount
+	}
+	balances := []LedgerBalance{}
+	for key, sum := range sums {
+		balances = append(balances, LedgerBalance{Account: key[0], Currency: key[1], Balance: roundMoney(sum, key[1])})
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Account != balances[j].Account {
+			return balances[i].Account < balances[j].Account
+		}
+		return balances[i].Currency < balances[j].Currency
+	})
+	return balances, nil
+}
@@ -0,0 +1,284 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"log"
+	"strconv"
+)
+
+// paymentColumns is the column list the payment queries select, in the order GetByTransaction scans them
+func paymentColumns(d Database.Dialect) string {
+	return `payment_id, transaction_id, payer_id, payee_id, amount_minor, fee_minor, released_minor, currency, status, provider, reference,
+	` + d.Timestamp("date_created") + `, COALESCE(` + d.Timestamp("date_settled") + `, '')`
+}
+
+type PaymentService struct {
+	db       *Database.DB
+	provider Payments.Provider
+}
+
+// recordEntries writes the entries of a movement to the ledger
+func recordEntries(ctx context.Context, tx *Database.Tx, entries []LedgerEntry) error {
+	for _, entry := range entries {
+		_, err := tx.ExecContext(ctx, `INSERT INTO ledger_entries (payment_id, movement, account, amount_minor, currency) VALUES (?, ?, ?, ?, ?)`,
+			entry.PaymentID, entry.Movement, entry.Account, minorUnits(entry.Amount, entry.Currency), entry.Currency)
+		if err != nil {
+			return fmt.Errorf("could not record ledger entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// Hold charges the client the transaction's price and keeps it in escrow. A transaction is paid for once.
+func (p *PaymentService) Hold(ctx context.Context, transaction Transaction, feePercent float64) (Payment, error) {
+	payment, err := newPayment(transaction, feePercent)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Payment{}, err
+	}
+	defer tx.Rollback()
+
+	if err := p.hold(ctx, tx, payment); err != nil {
+		return Payment{}, err
+	}
+	return p.GetByTransaction(ctx, payment.TransactionID)
+}
+
+// hold records a payment in tx, charges the client for it and commits tx. Once the charge went
+// through, failing to record it gives the money back rather than lose track of it.
+func (p *PaymentService) hold(ctx context.Context, tx *Database.Tx, payment Payment) error {
+	var exists int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM payments WHERE transaction_id = ?`, payment.TransactionID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("could not check payment: %w", err)
+	}
+	if exists > 0 {
+		return fmt.Errorf("payment for this transaction %w", ErrConflict)
+	}
+
+	// The row claims the transaction before any money moves, and is rolled back if the charge fails
+	id, err := tx.InsertID(ctx, `INSERT INTO payments (transaction_id, payer_id, payee_id, amount_minor, fee_minor, currency, provider) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		"payment_id", payment.TransactionID, payment.PayerID, payment.PayeeID, minorUnits(payment.Amount, payment.Currency),
+		minorUnits(payment.Fee, payment.Currency), payment.Currency, p.provider.Name())
+	if err != nil {
+		return fmt.Errorf("could not create payment: %w", err)
+	}
+	payment.PaymentID = int(id)
+	if err := recordEntries(ctx, tx, movementEntries(payment, MovementHold, payment.Amount, 0)); err != nil {
+		return err
+	}
+
+	reference, err := p.provider.Charge(ctx, Payments.Charge{PayerID: payment.PayerID, Amount: payment.Amount, Currency: payment.Currency,
+		Description: "Deposit for transaction " + strconv.Itoa(payment.TransactionID)})
+	if err != nil {
+		return paymentFailed(err)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE payments SET reference = ? WHERE payment_id = ?`, reference, payment.PaymentID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		if refundErr := p.provider.Refund(ctx, reference, payment.Amount); refundErr != nil {
+			return fmt.Errorf("could not record charge %s, which could not be refunded either (%v): %w", reference, refundErr, err)
+		}
+		return fmt.Errorf("could not record charge: %w", err)
+	}
+	return nil
+}
+
+// settlement is a movement out of escrow worked out from a payment as it was read
+type settlement struct {
+	payment  Payment
+	movement string
+	taken    part
+	move     func(Payment, part) error
+}
+
+// plan works out how to move part or all of what is left of a held payment out of escrow,
+// either to the tradesman and the platform or back to the client
+func (p *PaymentService) plan(ctx context.Context, transactionID int, movement string, amount float64, move func(Payment, part) error) (settlement, error) {
+	payment, err := p.GetByTransaction(ctx, transactionID)
+	if err != nil {
+		return settlement{}, err
+	}
+	if err := settleable(payment); err != nil {
+		return settlement{}, err
+	}
+	taken, err := portion(payment, movement, amount)
+	if err != nil {
+		return settlement{}, err
+	}
+	return settlement{payment: payment, movement: movement, taken: taken, move: move}, nil
+}
+
+// apply writes a settlement in tx and then moves its money with the provider, so nothing is
+// recorded when the provider refuses. tx must be rolled back when it fails, and committed with
+// commitSettlement when it does not.
+func (p *PaymentService) apply(ctx context.Context, tx *Database.Tx, s settlement) error {
+	payment, taken := s.payment, s.taken
+	released, status, settled := payment.Released, PaymentHeld, "date_settled"
+	if s.movement == MovementRelease {
+		released = roundMoney(released+taken.amount, payment.Currency)
+	}
+	if taken.last {
+		status, settled = settledStatus(s.movement), "CURRENT_TIMESTAMP"
+	}
+
+	// Only one settlement can claim what is left in escrow
+	result, err := tx.ExecContext(ctx, `UPDATE payments SET status = ?, released_minor = ?, date_settled = `+settled+`
+	          WHERE payment_id = ? AND status = ? AND released_minor = ?`, status, minorUnits(released, payment.Currency),
+		payment.PaymentID, PaymentHeld, minorUnits(payment.Released, payment.Currency))
+	if err != nil {
+		return fmt.Errorf("could not settle payment: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("payment changed while settling it: %w", ErrConflict)
+	}
+	if err := recordEntries(ctx, tx, movementEntries(payment, s.movement, taken.amount, taken.fee)); err != nil {
+		return err
+	}
+
+	if err := s.move(payment, taken); err != nil {
+		return paymentFailed(err)
+	}
+	return nil
+}
+
+// settle moves part or all of what is left of a held payment out of escrow, either to the
+// tradesman and the platform or back to the client
+func (p *PaymentService) settle(ctx context.Context, transactionID int, movement string, amount float64, move func(Payment, part) error) (Payment, error) {
+	s, err := p.plan(ctx, transactionID, movement, amount, move)
+	if err != nil {
+		return Payment{}, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Payment{}, err
+	}
+	defer tx.Rollback()
+
+	if err := p.apply(ctx, tx, s); err != nil {
+		return Payment{}, err
+	}
+	if err := commitSettlement(tx, s); err != nil {
+		return Payment{}, err
+	}
+	return p.GetByTransaction(ctx, transactionID)
+}
+
+// commitSettlement commits a settlement applied in tx. The provider has no way to take a payout or
+// refund back, so a failed commit is reported with the charge for it to be reconciled by hand.
+func commitSettlement(tx *Database.Tx, s settlement) error {
+	if err := tx.Commit(); err != nil {
+		log.Printf("payment %d: %s of %.2f %s on charge %s went through but could not be recorded: %v",
+			s.payment.PaymentID, s.movement, s.taken.amount, s.payment.Currency, s.payment.Reference, err)
+		return fmt.Errorf("could not record the %s of payment %d: %w", s.movement, s.payment.PaymentID, err)
+	}
+	return nil
+}
+
+// payout pays the tradesman their part of a release, less its fee
+func (p *PaymentService) payout(ctx context.Context) func(Payment, part) error {
+	return func(payment Payment, taken part) error {
+		return p.provider.Payout(ctx, Payments.Payout{Reference: payment.Reference, PayeeID: payment.PayeeID,
+			Amount: roundMoney(taken.amount-taken.fee, payment.Currency), Fee: taken.fee, Currency: payment.Currency})
+	}
+}
+
+// Release pays what is left of a held deposit to the tradesman, less the platform fee
+func (p *PaymentService) Release(ctx context.Context, transactionID int) (Payment, error) {
+	return p.ReleasePart(ctx, transactionID, 0)
+}
+
+// ReleasePart pays amount of a held deposit to the tradesman, less its share of the platform
+// fee. The deposit stays held until all of it is released.
+func (p *PaymentService) ReleasePart(ctx context.Context, transactionID int, amount float64) (Payment, error) {
+	return p.settle(ctx, transactionID, MovementRelease, amount, p.payout(ctx))
+}
+
+// refund gives the client their part of a refund back
+func (p *PaymentService) refund(ctx context.Context) func(Payment, part) error {
+	return func(payment Payment, taken part) error {
+		return p.provider.Refund(ctx, payment.Reference, taken.amount)
+	}
+}
+
+// mover returns how the money of a movement out of escrow is moved
+func (p *PaymentService) mover(ctx context.Context, movement string) func(Payment, part) error {
+	if movement == MovementRefund {
+		return p.refund(ctx)
+	}
+	return p.payout(ctx)
+}
+
+// Refund gives what is left of a held deposit back to the client
+func (p *PaymentService) Refund(ctx context.Context, transactionID int) (Payment, error) {
+	return p.settle(ctx, transactionID, MovementRefund, 0, p.refund(ctx))
+}
+
+// GetByTransaction returns the payment of a transaction with its ledger entries
+func (p *PaymentService) GetByTransaction(ctx context.Context, transactionID int) (Payment, error) {
+	var payment Payment
+	var amount, fee, released int64
+	err := p.db.QueryRowContext(ctx, `SELECT `+paymentColumns(p.db.Dialect)+` FROM payments WHERE transaction_id = ?`, transactionID).Scan(
+		&payment.PaymentID, &payment.TransactionID, &payment.PayerID, &payment.PayeeID, &amount, &fee, &released, &payment.Currency,
+		&payment.Status, &payment.Provider, &payment.Reference, &payment.DateCreated, &payment.DateSettled)
+	if err == sql.ErrNoRows {
+		return Payment{}, fmt.Errorf("payment %w", ErrNotFound)
+	}
+	if err != nil {
+		return Payment{}, fmt.Errorf("could not retrieve payment: %w", err)
+	}
+	payment.Amount = majorUnits(amount, payment.Currency)
+	payment.Fee = majorUnits(fee, payment.Currency)
+	payment.Released = majorUnits(released, payment.Currency)
+
+	rows, err := p.db.QueryContext(ctx, `SELECT entry_id, payment_id, movement, account, amount_minor, currency, `+p.db.Dialect.Timestamp("date_created")+`
+	          FROM ledger_entries WHERE payment_id = ? ORDER BY entry_id`, payment.PaymentID)
+	if err != nil {
+		return Payment{}, fmt.Errorf("could not retrieve ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	payment.Entries = []LedgerEntry{}
+	for rows.Next() {
+		var entry LedgerEntry
+		var amount int64
+		if err := rows.Scan(&entry.EntryID, &entry.PaymentID, &entry.Movement, &entry.Account, &amount, &entry.Currency, &entry.DateCreated); err != nil {
+			return Payment{}, fmt.Errorf("could not scan ledger entry: %w", err)
+		}
+		entry.Amount = majorUnits(amount, entry.Currency)
+		payment.Entries = append(payment.Entries, entry)
+	}
+	return payment, rows.Err()
+}
+
+// Balances sums the ledger by account and currency. Escrow holds the deposits not settled yet.
+func (p *PaymentService) Balances(ctx context.Context) ([]LedgerBalance, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT account, currency, SUM(amount_minor) FROM ledger_entries GROUP BY account, currency ORDER BY account, currency`)
+	if err != nil {
+		return nil, fmt.Errorf("could not sum the ledger: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []LedgerBalance{}
+	for rows.Next() {
+		var balance LedgerBalance
+		var sum int64
+		if err := rows.Scan(&balance.Account, &balance.Currency, &sum); err != nil {
+			return nil, fmt.Errorf("could not scan balance: %w", err)
+		}
+		balance.Balance = majorUnits(sum, balance.Currency)
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
@@ -0,0 +1,234 @@
+package Services
+
+import (
+	"fmt"
+	"log"
+	"math"
+)
+
+// Statuses of a payment
+const (
+	PaymentHeld     = "held"
+	PaymentReleased = "released"
+	PaymentRefunded = "refunded"
+)
+
+// Movements of money recorded in the ledger
+const (
+	MovementHold    = "hold"
+	MovementRelease = "release"
+	MovementRefund  = "refund"
+)
+
+// Ledger accounts besides each user's own
+const (
+	// AccountEscrow holds deposits between acceptance and completion or cancellation
+	AccountEscrow = "escrow"
+	// AccountFees collects the platform fee of every released payment
+	AccountFees = "platform_fees"
+)
+
+// UserAccount is the ledger account of a user
+func UserAccount(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// Payment is the deposit of a transaction, held in escrow once it is Accepted
+type Payment struct {
+	// @example 7
+	PaymentID int `json:"payment_id"`
+
+	// @example 12345
+	TransactionID int `json:"transaction_id"`
+
+	// PayerID is the client, the user offered the transaction
+	// @example 1
+	PayerID int `json:"payer_id"`
+
+	// PayeeID is the tradesman, the user offering the transaction
+	// @example 2
+	PayeeID int `json:"payee_id"`
+
+	// Amount is the transaction price, all of which is held
+	// @example 100.50
+	Amount float64 `json:"amount"`
+
+	// Fee is the platform's share, deducted from the amount on release
+	// @example 5.03
+	Fee float64 `json:"fee"`
+
+	// Released is how much of the amount has left escrow for the tradesman, all at once
+	// on completion or milestone by milestone
+	// @example 40.00
+	Released float64 `json:"released"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// Status is held, released or refunded
+	// @example "held"
+	Status string `json:"status"`
+
+	// Provider and Reference identify the charge at the payment processor
+	// @example "fake"
+	Provider string `json:"provider"`
+
+	// @example "fake_1"
+	Reference string `json:"reference"`
+
+	// @example "2024-12-16 14:30:00"
+	DateCreated string `json:"date_created"`
+
+	// DateSettled is when the payment was released or refunded
+	// @example "2024-12-25 18:00:00"
+	DateSettled string `json:"date_settled,omitempty"`
+
+	// Entries are the ledger entries of the payment, oldest first
+	Entries []LedgerEntry `json:"entries"`
+}
+
+// LedgerEntry is one side of a movement of money. Amounts are signed from the account's
+// point of view, money in is positive, and the entries of a movement sum to zero.
+type LedgerEntry struct {
+	// @example 21
+	EntryID int `json:"entry_id"`
+
+	// @example 7
+	PaymentID int `json:"payment_id"`
+
+	// Movement is hold, release or refund
+	// @example "release"
+	Movement string `json:"movement"`
+
+	// Account is escrow, platform_fees or user:{user_id}
+	// @example "user:2"
+	Account string `json:"account"`
+
+	// @example 95.47
+	Amount float64 `json:"amount"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// @example "2024-12-25 18:00:00"
+	DateCreated string `json:"date_created"`
+}
+
+// LedgerBalance is the sum of an account's entries in one currency
+type LedgerBalance struct {
+	// @example "platform_fees"
+	Account string `json:"account"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// @example 250.75
+	Balance float64 `json:"balance"`
+}
+
+// newPayment checks that a transaction can be paid for and returns its unsaved payment,
+// with the platform fee worked out at feePercent of the price
+func newPayment(transaction Transaction, feePercent float64) (Payment, error) {
+	if transaction.Price <= 0 {
+		return Payment{}, Invalid("price_with_currency", "must be positive to hold a deposit")
+	}
+	if transaction.CurrencyCode == "" {
+		return Payment{}, Invalid("currency_code", "is required to hold a deposit")
+	}
+	if feePercent < 0 || feePercent >= 100 {
+		return Payment{}, fmt.Errorf("platform fee must be at least 0%% and under 100%%, got %v%%", feePercent)
+	}
+	return Payment{
+		TransactionID: transaction.TransactionID,
+		PayerID:       transaction.UserOfferedID,
+		PayeeID:       transaction.UserOfferingID,
+		Amount:        roundMoney(transaction.Price, transaction.CurrencyCode),
+		Fee:           roundMoney(transaction.Price*feePercent/100, transaction.CurrencyCode),
+		Currency:      transaction.CurrencyCode,
+		Status:        PaymentHeld,
+	}, nil
+}
+
+// movementEntries returns the balanced ledger entries moving amount of a payment's money,
+// fee of which is kept by the platform on release
+func movementEntries(payment Payment, movement string, amount, fee float64) []LedgerEntry {
+	entry := func(account string, amount float64) LedgerEntry {
+		return LedgerEntry{PaymentID: payment.PaymentID, Movement: movement, Account: account, Amount: amount, Currency: payment.Currency}
+	}
+	switch movement {
+	case MovementHold:
+		return []LedgerEntry{entry(UserAccount(payment.PayerID), -amount), entry(AccountEscrow, amount)}
+	case MovementRelease:
+		return []LedgerEntry{
+			entry(AccountEscrow, -amount),
+			entry(UserAccount(payment.PayeeID), roundMoney(amount-fee, payment.Currency)),
+			entry(AccountFees, fee),
+		}
+	case MovementRefund:
+		return []LedgerEntry{entry(AccountEscrow, -amount), entry(UserAccount(payment.PayerID), amount)}
+	}
+	return nil
+}
+
+// part is what one release or refund takes out of escrow
+type part struct {
+	amount float64
+	fee    float64
+	// last is set when the part empties escrow, which settles the payment
+	last bool
+}
+
+// portion works out the part of a held payment a movement takes, all that is left when
+// amount is zero. Releases carry their share of the fee, and the last one whatever is
+// left of it, so the fees kept add up to the payment's. The sums are done in minor units
+// so the parts add up exactly.
+func portion(payment Payment, movement string, amount float64) (part, error) {
+	currency := payment.Currency
+	left := minorUnits(payment.Amount, currency) - minorUnits(payment.Released, currency)
+	moved := minorUnits(amount, currency)
+	if amount == 0 {
+		moved = left
+	}
+	if moved <= 0 || moved > left {
+		return part{}, fmt.Errorf("cannot move %v when %v is left in escrow: %w", majorUnits(moved, currency), majorUnits(left, currency), ErrConflict)
+	}
+
+	p := part{amount: majorUnits(moved, currency), last: moved == left}
+	if movement == MovementRelease {
+		fee := minorUnits(payment.Fee, currency)
+		share := int64(math.Round(float64(fee) * float64(moved) / float64(minorUnits(payment.Amount, currency))))
+		if p.last {
+			share = fee
+			for _, entry := range payment.Entries {
+				if entry.Account == AccountFees {
+					share -= minorUnits(entry.Amount, currency)
+				}
+			}
+		}
+		p.fee = majorUnits(share, currency)
+	}
+	return p, nil
+}
+
+// settledStatus is the status a payment takes once a movement empties its escrow
+func settledStatus(movement string) string {
+	if movement == MovementRefund {
+		return PaymentRefunded
+	}
+	return PaymentReleased
+}
+
+// settleable checks that a payment is still held, so it can be released or refunded
+func settleable(payment Payment) error {
+	if payment.Status != PaymentHeld {
+		return fmt.Errorf("payment was %s: %w", payment.Status, ErrConflict)
+	}
+	return nil
+}
+
+// paymentFailed logs an error of the payment provider and hides it from the client, whose
+// details are the provider's to keep
+func paymentFailed(err error) error {
+	log.Printf("payment provider failed: %v", err)
+	return fmt.Errorf("provider refused the payment: %w", ErrPaymentFailed)
+}
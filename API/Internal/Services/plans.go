@@ -0,0 +1,210 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"time"
+)
+
+// The plans users can subscribe to. Everyone without a subscription is on PlanFree.
+const (
+	PlanFree     = "free"
+	PlanPro      = "pro"
+	PlanBusiness = "business"
+)
+
+// Entitlements are what a plan allows its subscribers
+type Entitlements struct {
+	// MaxActiveListings is how many listings can be published at once, 0 for no limit
+	// @example 20
+	MaxActiveListings int `json:"max_active_listings"`
+
+	// MaxImagesPerListing is how many images each listing can have
+	// @example 15
+	MaxImagesPerListing int `json:"max_images_per_listing"`
+
+	// SearchBoost ranks the subscriber's listings above those of lower plans in search results
+	// @example 1
+	SearchBoost int `json:"search_boost"`
+
+	// Analytics gives access to the statistics of the subscriber's listings
+	// @example true
+	Analytics bool `json:"analytics"`
+}
+
+// Plan is a subscription tier, paid for each period in advance
+type Plan struct {
+	// @example "pro"
+	Name string `json:"name"`
+
+	// Price is charged at the start of every period, 0 for the free plan
+	// @example 9.99
+	Price float64 `json:"price"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// @example 30
+	PeriodDays int `json:"period_days"`
+
+	Entitlements Entitlements `json:"entitlements"`
+}
+
+// Plans lists the plans from the cheapest to the dearest. Paid plans are charged every
+// PLAN_PERIOD_DAYS (default 30) in the same currency, so moving between them can be
+// prorated. Their prices are set by PLAN_PRO_PRICE and PLAN_BUSINESS_PRICE, and
+// PLAN_FREE_LISTINGS (default 3) sets how many listings free users can publish.
+func Plans() []Plan {
+	period := Env.GetInt("PLAN_PERIOD_DAYS", 30)
+	return []Plan{
+		{Name: PlanFree, Currency: DefaultCurrency,
+			Entitlements: Entitlements{MaxActiveListings: Env.GetInt("PLAN_FREE_LISTINGS", 3), MaxImagesPerListing: 5}},
+		{Name: PlanPro, Price: Env.GetFloat("PLAN_PRO_PRICE", 9.99), Currency: DefaultCurrency, PeriodDays: period,
+			Entitlements: Entitlements{MaxActiveListings: 20, MaxImagesPerListing: 15, SearchBoost: 1, Analytics: true}},
+		{Name: PlanBusiness, Price: Env.GetFloat("PLAN_BUSINESS_PRICE", 29.99), Currency: DefaultCurrency, PeriodDays: period,
+			Entitlements: Entitlements{MaxImagesPerListing: 30, SearchBoost: 2, Analytics: true}},
+	}
+}
+
+// PlanByName returns the plan called name, the free plan when there is none
+func PlanByName(name string) (Plan, bool) {
+	plans := Plans()
+	for _, plan := range plans {
+		if plan.Name == name {
+			return plan, true
+		}
+	}
+	return plans[0], false
+}
+
+// Subscription is a user's plan for the current period
+type Subscription struct {
+	// @example 2
+	UserID int `json:"user_id"`
+
+	// Plan is free for users who never subscribed or whose plan ended
+	// @example "pro"
+	Plan string `json:"plan"`
+
+	// NextPlan is the cheaper plan, or free, that the subscription moves to when the period ends
+	// @example "free"
+	NextPlan string `json:"next_plan,omitempty"`
+
+	// @example "2025-01-10 09:00:00"
+	PeriodStart string `json:"period_start,omitempty"`
+
+	// PeriodEnd is when the plan is charged again for another period, or ends
+	// @example "2025-02-09 09:00:00"
+	PeriodEnd string `json:"period_end,omitempty"`
+
+	Entitlements Entitlements `json:"entitlements"`
+}
+
+// SubscriptionCharge is what a user paid for a plan, at subscription, upgrade or renewal
+type SubscriptionCharge struct {
+	// @example 1
+	ChargeID int `json:"charge_id"`
+
+	// @example 2
+	UserID int `json:"user_id"`
+
+	// @example "pro"
+	Plan string `json:"plan"`
+
+	// @example 9.99
+	Amount float64 `json:"amount"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// @example "fake"
+	Provider string `json:"provider"`
+
+	// @example "fake_1"
+	Reference string `json:"reference"`
+
+	// @example "2025-01-10 09:00:00"
+	DateCreated string `json:"date_created"`
+}
+
+// freeSubscription is the subscription of users who have none
+func freeSubscription(userID int) Subscription {
+	return Subscription{UserID: userID, Plan: PlanFree}.withEntitlements()
+}
+
+// withEntitlements fills in what the subscription's plan allows
+func (s Subscription) withEntitlements() Subscription {
+	plan, _ := PlanByName(s.Plan)
+	s.Entitlements = plan.Entitlements
+	return s
+}
+
+// periodLength is how long a paid plan lasts before it is charged again
+func periodLength(plan Plan) time.Duration {
+	return time.Duration(plan.PeriodDays) * 24 * time.Hour
+}
+
+// planChange is what moving a subscription to another plan does
+type planChange struct {
+	// charge is what is taken now, 0 when nothing is
+	charge float64
+	// now tells whether the plan changes straight away or when the period ends
+	now bool
+	// renew starts a new period, when the user had no paid plan yet
+	renew bool
+}
+
+// changePlan decides how a subscription on current, with remaining of its period left,
+// moves to target. A first paid plan is charged in full for a new period. Upgrades apply
+// at once and are charged the difference in price for the rest of the period. Downgrades,
+// including back to free, wait for the end of the period.
+func changePlan(current, target Plan, remaining time.Duration) planChange {
+	switch {
+	case current.Price == 0:
+		return planChange{charge: target.Price, now: true, renew: target.Price > 0}
+	case target.Price > current.Price:
+		share := 0.0
+		if period := periodLength(target); period > 0 {
+			share = min(max(remaining.Seconds()/period.Seconds(), 0), 1)
+		}
+		return planChange{charge: roundMoney((target.Price-current.Price)*share, target.Currency), now: true}
+	}
+	return planChange{}
+}
+
+// checkPublished refuses to publish another listing when the owner's plan has no room left
+func checkPublished(plan Plan, published int) error {
+	limit := plan.Entitlements.MaxActiveListings
+	if limit > 0 && published >= limit {
+		return fmt.Errorf("the %s plan allows %d published listings, pause one or upgrade: %w", plan.Name, limit, ErrPlanLimit)
+	}
+	return nil
+}
+
+// checkImageCount refuses another image for a listing that already has as many as the owner's plan allows
+func checkImageCount(plan Plan, images int) error {
+	limit := plan.Entitlements.MaxImagesPerListing
+	if images >= limit {
+		return fmt.Errorf("the %s plan allows %d images per listing and this one has %d: %w", plan.Name, limit, images, ErrPlanLimit)
+	}
+	return nil
+}
+
+// chargePlan takes amount for a plan from the user through the provider. Nothing is held
+// for plans, so the whole charge is paid out to the platform straight away.
+func chargePlan(ctx context.Context, provider Payments.Provider, userID int, plan Plan, amount float64) (string, error) {
+	reference, err := provider.Charge(ctx, Payments.Charge{PayerID: userID, Amount: amount, Currency: plan.Currency,
+		Description: "Subscription to the " + plan.Name + " plan"})
+	if err != nil {
+		return "", paymentFailed(err)
+	}
+	if err := provider.Payout(ctx, Payments.Payout{Reference: reference, Fee: amount, Currency: plan.Currency}); err != nil {
+		if refundErr := provider.Refund(ctx, reference, amount); refundErr != nil {
+			return "", fmt.Errorf("could not collect charge %s, which could not be refunded either (%v): %w", reference, refundErr, err)
+		}
+		return "", paymentFailed(err)
+	}
+	return reference, nil
+}
@@ -0,0 +1,189 @@
+package Services
+
+import (
+	geo "github.com/paulmach/go.geo"
+	"math"
+)
+
+// Visibility levels of the Privacy fields
+const (
+	VisibilityPublic         = "public"
+	VisibilityCounterparties = "counterparties"
+	VisibilityPrivate        = "private"
+)
+
+// Privacy holds who may see a user's sensitive fields besides the user themselves.
+// Counterparties are users sharing an Accepted transaction with them. Phone numbers
+// and exact locations are never public; empty fields take the defaults below.
+type Privacy struct {
+	// @example "counterparties"
+	PhoneNumber string `json:"phone_number" validate:"omitempty,oneof=counterparties private"`
+
+	// @example "private"
+	DateOfBirth string `json:"date_of_birth" validate:"omitempty,oneof=public counterparties private"`
+
+	// Location controls the exact point; everyone else sees it fuzzed to the neighbourhood
+	// @example "counterparties"
+	Location string `json:"location" validate:"omitempty,oneof=counterparties private"`
+}
+
+// withDefaults fills the fields a client left empty
+func (p Privacy) withDefaults() Privacy {
+	if p.PhoneNumber == "" {
+		p.PhoneNumber = VisibilityCounterparties
+	}
+	if p.DateOfBirth == "" {
+		p.DateOfBirth = VisibilityPrivate
+	}
+	if p.Location == "" {
+		p.Location = VisibilityCounterparties
+	}
+	return p
+}
+
+// Relationship is how the viewer of a profile relates to its owner
+type Relationship int
+
+const (
+	Stranger Relationship = iota
+	Counterparty
+	Self
+)
+
+// Rating summarises the ratings a user received as the offering side of completed transactions
+type Rating struct {
+	// Average is between 1 and 5, or 0 when Count is 0
+	// @example 4.5
+	Average float64 `json:"average"`
+
+	// @example 12
+	Count int `json:"count"`
+}
+
+// Profile is a user as shown to other users. Fields the viewer may not see are
+// left empty, and Location is fuzzed unless PreciseLocation is set.
+type Profile struct {
+	UserID      int        `json:"user_id"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	Profession  string     `json:"profession"`
+	LocDetails  Address    `json:"loc_details"`
+	ImageId     string     `json:"image_id"`
+	Rating      Rating     `json:"rating"`
+	Portfolio   []Image    `json:"portfolio"`
+	PhoneNumber string     `json:"phone_number,omitempty"`
+	DateOfBirth string     `json:"date_of_birth,omitempty"`
+	Location    *geo.Point `json:"location"`
+
+	// PreciseLocation reports whether Location is the exact point
+	PreciseLocation bool `json:"precise_location"`
+
+	// Privacy is only shown to the user themselves
+	Privacy *Privacy `json:"privacy,omitempty"`
+
+	// PreferredCurrency is only shown to the user themselves
+	PreferredCurrency string `json:"preferred_currency,omitempty"`
+
+	// DeletedAt is set when the account was closed; such profiles only keep the tombstone name
+	DeletedAt string `json:"deleted_at,omitempty"`
+}
+
+// Profile returns the view of the user that a viewer with the given relationship may see.
+// Rating and Portfolio are left for the caller to fill in.
+func (u User) Profile(relationship Relationship) Profile {
+	if u.DeletedAt != "" {
+		return Profile{UserID: u.UserID, FirstName: u.FirstName, LastName: u.LastName, Portfolio: []Image{}, DeletedAt: u.DeletedAt}
+	}
+
+	privacy := u.Privacy.withDefaults()
+	profile := Profile{
+		UserID:     u.UserID,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		Profession: u.Profession,
+		LocDetails: u.LocDetails,
+		ImageId:    u.ImageId,
+		Portfolio:  []Image{},
+		Location:   FuzzLocation(u.Location),
+	}
+
+	if visibleTo(privacy.PhoneNumber, relationship) {
+		profile.PhoneNumber = u.PhoneNumber
+	}
+	if visibleTo(privacy.DateOfBirth, relationship) {
+		profile.DateOfBirth = u.DateOfBirth
+	}
+	if visibleTo(privacy.Location, relationship) {
+		profile.Location = u.Location
+		profile.PreciseLocation = true
+	}
+	if relationship == Self {
+		profile.Privacy = &privacy
+		profile.PreferredCurrency = u.PreferredCurrency
+	}
+	return profile
+}
+
+func visibleTo(visibility string, relationship Relationship) bool {
+	switch visibility {
+	case VisibilityPublic:
+		return true
+	case VisibilityCounterparties:
+		return relationship >= Counterparty
+	default:
+		return relationship == Self
+	}
+}
+
+// fuzzGrid is the cell size, in degrees, public locations are snapped to (about 1 km)
+const fuzzGrid = 0.01
+
+// FuzzLocation snaps a point to the centre of its grid cell. Snapping rather than
+// adding noise means repeated requests cannot be averaged back to the exact point.
+func FuzzLocation(p *geo.Point) *geo.Point {
+	if p == nil {
+		return nil
+	}
+	snap := func(v float64) float64 {
+		return math.Round((math.Floor(v/fuzzGrid)+0.5)*fuzzGrid*1e6) / 1e6
+	}
+	return geo.NewPoint(snap(p.Lng()), snap(p.Lat()))
+}
+
+// FuzzListings returns the listings with their points fuzzed, except those precise reports.
+// The listings passed in are left as they are.
+func FuzzListings(listings []Listing, precise func(Listing) bool) []Listing {
+	if listings == nil {
+		return nil
+	}
+	fuzzed := make([]Listing, len(listings))
+	for i, listing := range listings {
+		if !precise(listing) {
+			listing.Location = FuzzLocation(listing.Location)
+		}
+		fuzzed[i] = listing
+	}
+	return fuzzed
+}
+
+// FuzzMapView returns a map view with its listings fuzzed like FuzzListings and its clusters at their
+// fuzzed centroid, inside bounds widened to the fuzzing grid so the edges do not give away the outermost points
+func FuzzMapView(view MapView, precise func(Listing) bool) MapView {
+	view.Listings = FuzzListings(view.Listings, precise)
+	clusters := append([]Cluster(nil), view.Clusters...)
+	for i := range clusters {
+		clusters[i].Location = FuzzLocation(clusters[i].Location)
+		clusters[i].Bounds = fuzzBounds(clusters[i].Bounds)
+	}
+	if view.Clusters != nil {
+		view.Clusters = clusters
+	}
+	return view
+}
+
+// fuzzBounds widens a box to the fuzzing grid
+func fuzzBounds(b [4]float64) [4]float64 {
+	down := func(v float64) float64 { return math.Round(math.Floor(v/fuzzGrid)*fuzzGrid*1e6) / 1e6 }
+	up := func(v float64) float64 { return math.Round(math.Ceil(v/fuzzGrid)*fuzzGrid*1e6) / 1e6 }
+	return [4]float64{down(b[0]), down(b[1]), up(b[2]), up(b[3])}
+}
@@ -0,0 +1,226 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// PromotionMemory is the in-memory implementation of the Promotions interface
+type PromotionMemory struct {
+	store    *memoryStore
+	provider Payments.Provider
+}
+
+// Create holds the budget of a new promotion with the provider and stores it
+func (s *PromotionMemory) Create(ctx context.Context, promotion Promotion) (Promotion, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	listing, ok := s.store.listings[promotion.ListingID]
+	if !ok || listing.DeletedAt != "" {
+		return Promotion{}, fmt.Errorf("listing %w", ErrNotFound)
+	}
+	promotion, err := checkPromotion(promotion, listing, time.Now())
+	if err != nil {
+		return Promotion{}, err
+	}
+	if _, ok := s.store.regions[promotion.RegionID]; promotion.RegionID != 0 && !ok {
+		return Promotion{}, Invalid("region_id", "must be a region of the gazetteer")
+	}
+
+	reference, err := s.provider.Charge(ctx, Payments.Charge{PayerID: promotion.UserID, Amount: promotion.Budget, Currency: promotion.Currency,
+		Description: "Promotion of listing " + strconv.Itoa(promotion.ListingID)})
+	if err != nil {
+		return Promotion{}, paymentFailed(err)
+	}
+
+	s.store.nextPromotionID++
+	promotion.PromotionID = s.store.nextPromotionID
+	promotion.Provider = s.provider.Name()
+	promotion.Reference = reference
+	promotion.DateCreated = now()
+	s.store.promotions[promotion.PromotionID] = promotion
+	return promotion, nil
+}
+
+// GetByID returns a promotion
+func (s *PromotionMemory) GetByID(ctx context.Context, promotionID int) (Promotion, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	promotion, ok := s.store.promotions[promotionID]
+	if !ok {
+		return Promotion{}, fmt.Errorf("promotion %w", ErrNotFound)
+	}
+	return promotion, nil
+}
+
+// GetByUser returns the promotions a user bought, newest first
+func (s *PromotionMemory) GetByUser(ctx context.Context, userID int) ([]Promotion, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	promotions := []Promotion{}
+	ids := sortedKeys(s.store.promotions)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if promotion := s.store.promotions[ids[i]]; promotion.UserID == userID {
+			promotions = append(promotions, promotion)
+		}
+	}
+	return promotions, nil
+}
+
+// GetDays returns the impressions, clicks and spend of a promotion for each day it was shown
+func (s *PromotionMemory) GetDays(ctx context.Context, promotionID int) ([]PromotionDay, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	days := []PromotionDay{}
+	for _, day := range s.store.promotionDays[promotionID] {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
+
+// settle ends an active promotion with status, paying what it spent to the platform and
+// refunding the rest. The caller holds the lock.
+func (s *PromotionMemory) settle(ctx context.Context, promotionID int, status string) (Promotion, error) {
+	promotion, ok := s.store.promotions[promotionID]
+	if !ok {
+		return Promotion{}, fmt.Errorf("promotion %w", ErrNotFound)
+	}
+	if promotion.Status != PromotionActive {
+		return Promotion{}, fmt.Errorf("promotion is already %s: %w", promotion.Status, ErrConflict)
+	}
+	if err := settlePromotion(ctx, s.provider, promotion); err != nil {
+		return Promotion{}, err
+	}
+	promotion.Status = status
+	promotion.DateSettled = now()
+	s.store.promotions[promotionID] = promotion
+	return promotion, nil
+}
+
+// Cancel stops a promotion straight away and refunds what it did not spend
+func (s *PromotionMemory) Cancel(ctx context.Context, promotionID int) (Promotion, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	return s.settle(ctx, promotionID, PromotionCancelled)
+}
+
+// Settle ends the promotions whose last day is before at's and returns them
+func (s *PromotionMemory) Settle(ctx context.Context, at time.Time) ([]Promotion, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	// Click tokens only work on the day they were issued for
+	for nonce, day := range s.store.promotionClicks {
+		if day < promotionDay(at) {
+			delete(s.store.promotionClicks, nonce)
+		}
+	}
+
+	ended := []Promotion{}
+	for _, id := range sortedKeys(s.store.promotions) {
+		promotion := s.store.promotions[id]
+		if promotion.Status != PromotionActive || promotion.EndDate >= promotionDay(at) {
+			continue
+		}
+		promotion, err := s.settle(ctx, id, PromotionEnded)
+		if err != nil {
+			return ended, err
+		}
+		ended = append(ended, promotion)
+	}
+	return ended, nil
+}
+
+// spend adds an impression or a click, and what it cost, to a promotion's day. The caller holds the lock.
+func (s *PromotionMemory) spend(promotion Promotion, day string, impressions, clicks int, cost int64) {
+	days, ok := s.store.promotionDays[promotion.PromotionID]
+	if !ok {
+		days = map[string]PromotionDay{}
+		s.store.promotionDays[promotion.PromotionID] = days
+	}
+	stats := days[day]
+	stats.Date = day
+	stats.Impressions += impressions
+	stats.Clicks += clicks
+	stats.Spent = majorUnits(minorUnits(stats.Spent, promotion.Currency)+cost, promotion.Currency)
+	days[day] = stats
+
+	promotion.Impressions += impressions
+	promotion.Clicks += clicks
+	promotion.Spent = majorUnits(minorUnits(promotion.Spent, promotion.Currency)+cost, promotion.Currency)
+	s.store.promotions[promotion.PromotionID] = promotion
+}
+
+// Serve picks the promoted listings to show for search at at, up to slots of them, and
+// spends an impression on each
+func (s *PromotionMemory) Serve(ctx context.Context, search PromotionSearch, rules PromotionRules, slots int, at time.Time) ([]Listing, error) {
+	if slots <= 0 {
+		return []Listing{}, nil
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	day := promotionDay(at)
+	candidates := []promotionCandidate{}
+	for _, id := range sortedKeys(s.store.promotions) {
+		promotion := s.store.promotions[id]
+		listing, ok := s.store.listings[promotion.ListingID]
+		if promotion.Status != PromotionActive || !ok || listing.DeletedAt != "" {
+			continue
+		}
+		spent := minorUnits(s.store.promotionDays[id][day].Spent, promotion.Currency)
+		candidates = append(candidates, promotionCandidate{promotion: promotion, listing: listing, spent: spent})
+	}
+
+	promoted := []Listing{}
+	for _, picked := range pickPromotions(candidates, search, rules, at, slots) {
+		s.spend(picked.promotion, day, 1, 0, minorUnits(rules.ImpressionPrice, picked.promotion.Currency))
+		token, err := clickToken(rules, picked.promotion.PromotionID, day)
+		if err != nil {
+			return nil, err
+		}
+		listing := picked.listing
+		listing.Promotion = &PromotionLabel{PromotionID: picked.promotion.PromotionID, Label: PromotedLabel, ClickToken: token}
+		promoted = append(promoted, listing)
+	}
+	return promoted, nil
+}
+
+// Click spends a click on a promotion shown on at's day, using up the token it was shown
+// with. Clicks beyond the day's impressions, or on promotions no longer active, are not counted.
+func (s *PromotionMemory) Click(ctx context.Context, promotionID int, token string, rules PromotionRules, at time.Time) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	promotion, ok := s.store.promotions[promotionID]
+	if !ok {
+		return fmt.Errorf("promotion %w", ErrNotFound)
+	}
+	day := promotionDay(at)
+	nonce, err := checkClickToken(rules, promotionID, day, token)
+	if err != nil {
+		return err
+	}
+	if _, used := s.store.promotionClicks[nonce]; used {
+		return fmt.Errorf("click token was already used: %w", ErrConflict)
+	}
+	s.store.promotionClicks[nonce] = day
+
+	stats := s.store.promotionDays[promotionID][day]
+	if promotion.Status != PromotionActive || stats.Clicks >= stats.Impressions {
+		return nil
+	}
+	s.spend(promotion, day, 0, 1, clickCost(promotion, minorUnits(stats.Spent, promotion.Currency), rules, at))
+	return nil
+}
@@ -0,0 +1,350 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"strconv"
+	"time"
+)
+
+type PromotionService struct {
+	db       *Database.DB
+	provider Payments.Provider
+	listings *ListingService
+}
+
+// promotionColumns is the column list the promotion queries select, in the order scanPromotion
+// reads them. The totals are summed over the promotion's days.
+func promotionColumns(d Database.Dialect) string {
+	total := func(column string) string {
+		return `COALESCE((SELECT SUM(` + column + `) FROM promotion_days WHERE promotion_days.promotion_id = promotions.promotion_id), 0)`
+	}
+	return `promotion_id, listing_id, user_id, COALESCE(region_id, 0), category, ` + d.Date("start_date") + `, ` + d.Date("end_date") + `,
+	daily_budget_minor, budget_minor, currency, status, provider, reference, ` + d.Timestamp("date_created") + `,
+	COALESCE(` + d.Timestamp("date_settled") + `, ''), ` + total("impressions") + `, ` + total("clicks") + `, ` + total("spent_minor")
+}
+
+// scanPromotion reads a row selected with promotionColumns
+func scanPromotion(row interface{ Scan(...interface{}) error }) (Promotion, error) {
+	var promotion Promotion
+	var daily, budget, spent int64
+	err := row.Scan(&promotion.PromotionID, &promotion.ListingID, &promotion.UserID, &promotion.RegionID, &promotion.Category,
+		&promotion.StartDate, &promotion.EndDate, &daily, &budget, &promotion.Currency, &promotion.Status, &promotion.Provider,
+		&promotion.Reference, &promotion.DateCreated, &promotion.DateSettled, &promotion.Impressions, &promotion.Clicks, &spent)
+	promotion.DailyBudget = majorUnits(daily, promotion.Currency)
+	promotion.Budget = majorUnits(budget, promotion.Currency)
+	promotion.Spent = majorUnits(spent, promotion.Currency)
+	return promotion, err
+}
+
+// query returns the promotions selected with promotionColumns
+func (s *PromotionService) query(ctx context.Context, query string, args ...interface{}) ([]Promotion, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve promotions: %w", err)
+	}
+	defer rows.Close()
+
+	promotions := []Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan promotion: %w", err)
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+// Create holds the budget of a new promotion with the provider and stores it
+func (s *PromotionService) Create(ctx context.Context, promotion Promotion) (Promotion, error) {
+	listing, err := s.listings.GetByID(ctx, promotion.ListingID)
+	if err != nil {
+		return Promotion{}, err
+	}
+	promotion, err = checkPromotion(promotion, listing, time.Now())
+	if err != nil {
+		return Promotion{}, err
+	}
+	if promotion.RegionID != 0 {
+		var exists int
+		err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM regions WHERE region_id = ?`, promotion.RegionID).Scan(&exists)
+		if err != nil {
+			return Promotion{}, fmt.Errorf("could not check region: %w", err)
+		}
+		if exists == 0 {
+			return Promotion{}, Invalid("region_id", "must be a region of the gazetteer")
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Promotion{}, err
+	}
+	defer tx.Rollback()
+
+	// The row is written before any money moves, and is rolled back if the charge fails
+	id, err := tx.InsertID(ctx, `INSERT INTO promotions (listing_id, user_id, region_id, category, start_date, end_date, daily_budget_minor, budget_minor, currency, provider)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, "promotion_id", promotion.ListingID, promotion.UserID, regionArg(promotion.RegionID),
+		promotion.Category, promotion.StartDate, promotion.EndDate, minorUnits(promotion.DailyBudget, promotion.Currency),
+		minorUnits(promotion.Budget, promotion.Currency), promotion.Currency, s.provider.Name())
+	if err != nil {
+		return Promotion{}, fmt.Errorf("could not create promotion: %w", err)
+	}
+
+	reference, err := s.provider.Charge(ctx, Payments.Charge{PayerID: promotion.UserID, Amount: promotion.Budget, Currency: promotion.Currency,
+		Description: "Promotion of listing " + strconv.Itoa(promotion.ListingID)})
+	if err != nil {
+		return Promotion{}, paymentFailed(err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE promotions SET reference = ? WHERE promotion_id = ?`, reference, id); err != nil {
+		// The charge went through, give it back rather than lose track of it
+		if refundErr := s.provider.Refund(ctx, reference, promotion.Budget); refundErr != nil {
+			return Promotion{}, fmt.Errorf("could not record charge %s, which could not be refunded either (%v): %w", reference, refundErr, err)
+		}
+		return Promotion{}, fmt.Errorf("could not record charge: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Promotion{}, err
+	}
+	return s.GetByID(ctx, int(id))
+}
+
+// GetByID returns a promotion
+func (s *PromotionService) GetByID(ctx context.Context, promotionID int) (Promotion, error) {
+	promotion, err := scanPromotion(s.db.QueryRowContext(ctx, `SELECT `+promotionColumns(s.db.Dialect)+`
+	          FROM promotions WHERE promotion_id = ?`, promotionID))
+	if err == sql.ErrNoRows {
+		return Promotion{}, fmt.Errorf("promotion %w", ErrNotFound)
+	}
+	if err != nil {
+		return Promotion{}, fmt.Errorf("could not retrieve promotion: %w", err)
+	}
+	return promotion, nil
+}
+
+// GetByUser returns the promotions a user bought, newest first
+func (s *PromotionService) GetByUser(ctx context.Context, userID int) ([]Promotion, error) {
+	return s.query(ctx, `SELECT `+promotionColumns(s.db.Dialect)+` FROM promotions WHERE user_id = ? ORDER BY promotion_id DESC`, userID)
+}
+
+// GetDays returns the impressions, clicks and spend of a promotion for each day it was shown
+func (s *PromotionService) GetDays(ctx context.Context, promotionID int) ([]PromotionDay, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+s.db.Dialect.Date("day")+`, impressions, clicks, spent_minor, currency
+	          FROM promotion_days JOIN promotions USING (promotion_id) WHERE promotion_id = ? ORDER BY day`, promotionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve promotion days: %w", err)
+	}
+	defer rows.Close()
+
+	days := []PromotionDay{}
+	for rows.Next() {
+		var day PromotionDay
+		var spent int64
+		var currency string
+		if err := rows.Scan(&day.Date, &day.Impressions, &day.Clicks, &spent, &currency); err != nil {
+			return nil, fmt.Errorf("could not scan promotion day: %w", err)
+		}
+		day.Spent = majorUnits(spent, currency)
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// settle ends an active promotion with status, paying what it spent to the platform and refunding the rest
+func (s *PromotionService) settle(ctx context.Context, promotion Promotion, status string) (Promotion, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Promotion{}, err
+	}
+	defer tx.Rollback()
+
+	// Only one settlement can claim the held budget
+	result, err := tx.ExecContext(ctx, `UPDATE promotions SET status = ?, date_settled = CURRENT_TIMESTAMP
+	          WHERE promotion_id = ? AND status = ?`, status, promotion.PromotionID, PromotionActive)
+	if err != nil {
+		return Promotion{}, fmt.Errorf("could not settle promotion: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return Promotion{}, fmt.Errorf("promotion changed while settling it: %w", ErrConflict)
+	}
+
+	if err := settlePromotion(ctx, s.provider, promotion); err != nil {
+		return Promotion{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Promotion{}, err
+	}
+	return s.GetByID(ctx, promotion.PromotionID)
+}
+
+// Cancel stops a promotion straight away and refunds what it did not spend
+func (s *PromotionService) Cancel(ctx context.Context, promotionID int) (Promotion, error) {
+	promotion, err := s.GetByID(ctx, promotionID)
+	if err != nil {
+		return Promotion{}, err
+	}
+	if promotion.Status != PromotionActive {
+		return Promotion{}, fmt.Errorf("promotion is already %s: %w", promotion.Status, ErrConflict)
+	}
+	return s.settle(ctx, promotion, PromotionCancelled)
+}
+
+// Settle ends the promotions whose last day is before at's and returns them
+func (s *PromotionService) Settle(ctx context.Context, at time.Time) ([]Promotion, error) {
+	active, err := s.query(ctx, `SELECT `+promotionColumns(s.db.Dialect)+` FROM promotions WHERE status = ? ORDER BY promotion_id`, PromotionActive)
+	if err != nil {
+		return nil, err
+	}
+
+	// Click tokens only work on the day they were issued for
+	_, err = s.db.ExecContext(ctx, `DELETE FROM promotion_clicks WHERE day < ?`, promotionDay(at))
+	if err != nil {
+		return nil, fmt.Errorf("could not delete used click tokens: %w", err)
+	}
+
+	ended := []Promotion{}
+	for _, promotion := range active {
+		if promotion.EndDate >= promotionDay(at) {
+			continue
+		}
+		promotion, err := s.settle(ctx, promotion, PromotionEnded)
+		if err != nil {
+			return ended, err
+		}
+		ended = append(ended, promotion)
+	}
+	return ended, nil
+}
+
+// spend adds impressions or clicks, and what they cost, to a promotion's day
+func (s *PromotionService) spend(ctx context.Context, promotionID int, day string, impressions, clicks int, cost int64) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE promotion_days SET impressions = impressions + ?, clicks = clicks + ?, spent_minor = spent_minor + ?
+	          WHERE promotion_id = ? AND day = ?`, impressions, clicks, cost, promotionID, day)
+	if err != nil {
+		return fmt.Errorf("could not record promotion spend: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+		return nil
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO promotion_days (promotion_id, day, impressions, clicks, spent_minor) VALUES (?, ?, ?, ?, ?)`,
+		promotionID, day, impressions, clicks, cost)
+	if err != nil {
+		return fmt.Errorf("could not record promotion spend: %w", err)
+	}
+	return nil
+}
+
+// Serve picks the promoted listings to show for search at at, up to slots of them, and
+// spends an impression on each
+func (s *PromotionService) Serve(ctx context.Context, search PromotionSearch, rules PromotionRules, slots int, at time.Time) ([]Listing, error) {
+	if slots <= 0 {
+		return []Listing{}, nil
+	}
+
+	day := promotionDay(at)
+	active, err := s.query(ctx, `SELECT `+promotionColumns(s.db.Dialect)+` FROM promotions WHERE status = ? ORDER BY promotion_id`, PromotionActive)
+	if err != nil {
+		return nil, err
+	}
+	promoted, err := s.listings.queryListings(ctx, `SELECT `+listingColumns(s.db.Dialect)+` FROM listings
+	          WHERE deleted_at IS NULL AND listing_id IN (SELECT listing_id FROM promotions WHERE status = ?)`, PromotionActive)
+	if err != nil {
+		return nil, err
+	}
+	listings := map[int]Listing{}
+	for _, listing := range promoted {
+		listings[listing.ListingID] = listing
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT promotion_id, spent_minor FROM promotion_days WHERE day = ?`, day)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve promotion spend: %w", err)
+	}
+	defer rows.Close()
+	spent := map[int]int64{}
+	for rows.Next() {
+		var promotionID int
+		var amount int64
+		if err := rows.Scan(&promotionID, &amount); err != nil {
+			return nil, fmt.Errorf("could not scan promotion spend: %w", err)
+		}
+		spent[promotionID] = amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	candidates := []promotionCandidate{}
+	for _, promotion := range active {
+		if listing, ok := listings[promotion.ListingID]; ok {
+			candidates = append(candidates, promotionCandidate{promotion: promotion, listing: listing, spent: spent[promotion.PromotionID]})
+		}
+	}
+
+	shown := []Listing{}
+	for _, picked := range pickPromotions(candidates, search, rules, at, slots) {
+		err := s.spend(ctx, picked.promotion.PromotionID, day, 1, 0, minorUnits(rules.ImpressionPrice, picked.promotion.Currency))
+		if err != nil {
+			return nil, err
+		}
+		token, err := clickToken(rules, picked.promotion.PromotionID, day)
+		if err != nil {
+			return nil, err
+		}
+		listing := picked.listing
+		listing.Promotion = &PromotionLabel{PromotionID: picked.promotion.PromotionID, Label: PromotedLabel, ClickToken: token}
+		shown = append(shown, listing)
+	}
+	return shown, nil
+}
+
+// Click spends a click on a promotion shown on at's day, using up the token it was shown
+// with. Clicks beyond the day's impressions, or on promotions no longer active, are not counted.
+func (s *PromotionService) Click(ctx context.Context, promotionID int, token string, rules PromotionRules, at time.Time) error {
+	promotion, err := s.GetByID(ctx, promotionID)
+	if err != nil {
+		return err
+	}
+	day := promotionDay(at)
+	nonce, err := checkClickToken(rules, promotionID, day, token)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var used int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM promotion_clicks WHERE nonce = ?`, nonce).Scan(&used)
+	if err != nil {
+		return fmt.Errorf("could not check click token: %w", err)
+	}
+	if used > 0 {
+		return fmt.Errorf("click token was already used: %w", ErrConflict)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO promotion_clicks (nonce, promotion_id, day) VALUES (?, ?, ?)`, nonce, promotionID, day)
+	if err != nil {
+		return fmt.Errorf("could not use click token: %w", err)
+	}
+
+	// The conditions keep clicks from outnumbering impressions, and the spend within the
+	// budget paced to the hour, when they race
+	if promotion.Status == PromotionActive {
+		price, paced := minorUnits(rules.ClickPrice, promotion.Currency), pacedBudget(promotion.DailyBudget, at, promotion.Currency)
+		_, err = tx.ExecContext(ctx, `UPDATE promotion_days SET clicks = clicks + 1,
+		          spent_minor = CASE WHEN spent_minor + ? <= ? THEN spent_minor + ? WHEN spent_minor < ? THEN ? ELSE spent_minor END
+		          WHERE promotion_id = ? AND day = ? AND clicks < impressions`, price, paced, price, paced, paced, promotionID, day)
+		if err != nil {
+			return fmt.Errorf("could not record promotion click: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,374 @@
+package Services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statuses of a promotion
+const (
+	PromotionActive    = "active"
+	PromotionCancelled = "cancelled"
+	PromotionEnded     = "ended"
+)
+
+// PromotedLabel marks the listings shown in promoted slots, so they are never mistaken for search results
+const PromotedLabel = "Promoted"
+
+// maxPromotionDays keeps the budget held for a promotion within reason
+const maxPromotionDays = 90
+
+// Promotion pays for a listing to be shown in promoted slots of search results. Its whole
+// budget is held when it is bought; what was not spent is refunded when it ends.
+type Promotion struct {
+	// @example 4
+	PromotionID int `json:"promotion_id"`
+
+	// @example 42
+	ListingID int `json:"listing_id" validate:"required"`
+
+	// UserID is the owner of the listing, who pays for the promotion
+	// @example 2
+	UserID int `json:"user_id"`
+
+	// RegionID restricts the promotion to searches in a region or any region inside it, 0 for everywhere
+	// @example 12
+	RegionID int `json:"region_id,omitempty"`
+
+	// Category restricts the promotion to searches for a trade, empty for every search
+	// @example "plumbing"
+	Category string `json:"category,omitempty" validate:"omitempty,oneof=plumbing electrical carpentry painting tiling masonry roofing cleaning gardening moving hvac other"`
+
+	// Format: "2006-01-02"
+	// @example "2025-01-10"
+	StartDate string `json:"start_date" validate:"required,date"`
+
+	// EndDate is the last day the promotion is shown
+	// Format: "2006-01-02"
+	// @example "2025-01-16"
+	EndDate string `json:"end_date" validate:"required,notbefore=start_date"`
+
+	// DailyBudget is the most spent on a day, spread over its hours
+	// @example 5.00
+	DailyBudget float64 `json:"daily_budget" validate:"required,min=0.01"`
+
+	// Budget is the daily budget for every day of the promotion, held when it is bought
+	// @example 35.00
+	Budget float64 `json:"budget"`
+
+	// Spent is what impressions and clicks cost so far
+	// @example 12.40
+	Spent float64 `json:"spent"`
+
+	// @example "USD"
+	Currency string `json:"currency"`
+
+	// Status is active, cancelled by the owner, or ended after its last day
+	// @example "active"
+	Status string `json:"status"`
+
+	// @example 1240
+	Impressions int `json:"impressions"`
+
+	// @example 31
+	Clicks int `json:"clicks"`
+
+	// Provider and Reference identify the charge holding the budget
+	// @example "fake"
+	Provider string `json:"provider"`
+
+	// @example "fake_3"
+	Reference string `json:"reference"`
+
+	// @example "2025-01-09 18:20:00"
+	DateCreated string `json:"date_created"`
+
+	// DateSettled is when the spend was paid to the platform and the rest refunded
+	// @example "2025-01-17 00:10:00"
+	DateSettled string `json:"date_settled,omitempty"`
+}
+
+// PromotionDay is how a promotion did on one day
+type PromotionDay struct {
+	// Format: "2006-01-02"
+	// @example "2025-01-10"
+	Date string `json:"date"`
+
+	// @example 180
+	Impressions int `json:"impressions"`
+
+	// @example 4
+	Clicks int `json:"clicks"`
+
+	// @example 2.60
+	Spent float64 `json:"spent"`
+}
+
+// PromotionLabel is set on a listing shown in a promoted slot
+type PromotionLabel struct {
+	// PromotionID is the promotion to report clicks on
+	// @example 4
+	PromotionID int `json:"promotion_id"`
+
+	// @example "Promoted"
+	Label string `json:"label"`
+
+	// ClickToken is sent back, once, when the promoted listing is opened on the day it was shown
+	// @example "4.2025-01-10.6f1c2a9d0b7e4c3f8a5d2e1b0c9f8e7d.9e1f6a3c0d2b4e8f7a5c1d9b3e6f0a2c4d8b7e1f5a9c3d0e6b2f4a8c1d7e5b9f3a"
+	ClickToken string `json:"click_token"`
+}
+
+// PromotionClick reports that a promoted listing was opened
+type PromotionClick struct {
+	// ClickToken is the token the listing was labelled with
+	// @example "4.2025-01-10.6f1c2a9d0b7e4c3f8a5d2e1b0c9f8e7d.9e1f6a3c0d2b4e8f7a5c1d9b3e6f0a2c4d8b7e1f5a9c3d0e6b2f4a8c1d7e5b9f3a"
+	ClickToken string `json:"click_token" validate:"required"`
+}
+
+// PromotionRules set where promoted listings go in search results and what showing them costs
+type PromotionRules struct {
+	// Slots are the positions, from 1, taken by promoted listings. Slots past the end of
+	// the results are left out, so short result lists are not padded with promotions.
+	Slots []int
+	// ImpressionPrice is spent each time a promoted listing is shown
+	ImpressionPrice float64
+	// ClickPrice is spent each time a shown promoted listing is opened
+	ClickPrice float64
+	// ClickKey signs the click tokens handed out with promoted listings
+	ClickKey []byte
+}
+
+// DefaultPromotionRules puts promoted listings first and sixth, at a cent per impression and 20 cents
+// per click. Click tokens are signed with a random key, so they only work on the instance that issued them.
+func DefaultPromotionRules() PromotionRules {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return PromotionRules{Slots: []int{1, 6}, ImpressionPrice: 0.01, ClickPrice: 0.20, ClickKey: key}
+}
+
+// PromotionSearch is what a search was for, to pick the promotions targeting it
+type PromotionSearch struct {
+	// Type and Query are those of the search, which promoted listings have to match as well
+	Type  string
+	Query string
+	// RegionIDs are the regions the search is located in, from a point or a region filter, with the regions around them
+	RegionIDs []int
+	// Category is the trade the search is for, if any
+	Category string
+}
+
+// promotionDay is the day at formats to, as promotion dates are
+func promotionDay(at time.Time) string {
+	return at.Format("2006-01-02")
+}
+
+// pacedBudget is how much of a daily budget can be spent by the end of at's hour. Each hour
+// gets an even share, so a budget lasts the whole day instead of going in the first hour.
+func pacedBudget(daily float64, at time.Time, currency string) int64 {
+	return minorUnits(daily*float64(at.Hour()+1)/24, currency)
+}
+
+// checkPromotion validates a new promotion for listing and fills in its budget
+func checkPromotion(promotion Promotion, listing Listing, now time.Time) (Promotion, error) {
+	start, err := time.Parse("2006-01-02", promotion.StartDate)
+	if err != nil {
+		return Promotion{}, Invalid("start_date", "must be a date formatted 2006-01-02")
+	}
+	end, err := time.Parse("2006-01-02", promotion.EndDate)
+	if err != nil || end.Before(start) {
+		return Promotion{}, Invalid("end_date", "must be a date on or after start_date")
+	}
+	if promotion.StartDate < promotionDay(now) {
+		return Promotion{}, Invalid("start_date", "cannot be in the past")
+	}
+	days := int(end.Sub(start).Hours()/24) + 1
+	if days > maxPromotionDays {
+		return Promotion{}, Invalid("end_date", "must be at most "+strconv.Itoa(maxPromotionDays)+" days after start_date")
+	}
+	if listing.Status == ListingClosed {
+		return Promotion{}, fmt.Errorf("closed listings cannot be promoted: %w", ErrConflict)
+	}
+
+	promotion.Currency = DefaultCurrency
+	if minorUnits(promotion.DailyBudget, promotion.Currency) <= 0 {
+		return Promotion{}, Invalid("daily_budget", "must be at least 0.01")
+	}
+	promotion.DailyBudget = roundMoney(promotion.DailyBudget, promotion.Currency)
+	promotion.Budget = majorUnits(minorUnits(promotion.DailyBudget, promotion.Currency)*int64(days), promotion.Currency)
+	promotion.UserID = listing.UserID
+	promotion.Status = PromotionActive
+	promotion.Spent, promotion.Impressions, promotion.Clicks = 0, 0, 0
+	return promotion, nil
+}
+
+// targets tells whether promotion, of listing, is for search on day
+func targets(promotion Promotion, listing Listing, search PromotionSearch, day string) bool {
+	if promotion.Status != PromotionActive || day < promotion.StartDate || day > promotion.EndDate {
+		return false
+	}
+	if !isListed(listing) || !matchesType(listing, search.Type) || (search.Query != "" && !matchesSearch(listing, search.Query)) {
+		return false
+	}
+	if promotion.Category != "" && promotion.Category != search.Category {
+		return false
+	}
+	if promotion.RegionID == 0 {
+		return true
+	}
+	for _, regionID := range search.RegionIDs {
+		if regionID == promotion.RegionID {
+			return true
+		}
+	}
+	return false
+}
+
+// promotionCandidate is a promotion that could be shown, with what it spent on the day
+type promotionCandidate struct {
+	promotion Promotion
+	listing   Listing
+	spent     int64
+}
+
+// pickPromotions chooses up to n candidates for search that can afford an impression at
+// at, those furthest behind their paced budget first. A listing is promoted once.
+func pickPromotions(candidates []promotionCandidate, search PromotionSearch, rules PromotionRules, at time.Time, n int) []promotionCandidate {
+	day := promotionDay(at)
+	affordable := []promotionCandidate{}
+	for _, candidate := range candidates {
+		currency := candidate.promotion.Currency
+		paced := pacedBudget(candidate.promotion.DailyBudget, at, currency)
+		if targets(candidate.promotion, candidate.listing, search, day) && candidate.spent+minorUnits(rules.ImpressionPrice, currency) <= paced {
+			affordable = append(affordable, candidate)
+		}
+	}
+
+	// Spending the smallest share of its paced budget so far puts a promotion first
+	share := func(c promotionCandidate) float64 {
+		return float64(c.spent) / float64(max(pacedBudget(c.promotion.DailyBudget, at, c.promotion.Currency), 1))
+	}
+	sort.SliceStable(affordable, func(i, j int) bool {
+		if share(affordable[i]) != share(affordable[j]) {
+			return share(affordable[i]) < share(affordable[j])
+		}
+		return affordable[i].promotion.PromotionID < affordable[j].promotion.PromotionID
+	})
+
+	picked := []promotionCandidate{}
+	seen := map[int]bool{}
+	for _, candidate := range affordable {
+		if len(picked) == n {
+			break
+		}
+		if !seen[candidate.listing.ListingID] {
+			seen[candidate.listing.ListingID] = true
+			picked = append(picked, candidate)
+		}
+	}
+	return picked
+}
+
+// clickCost is what a click at at spends, capped by what is left of the budget paced to that hour
+func clickCost(promotion Promotion, spent int64, rules PromotionRules, at time.Time) int64 {
+	left := pacedBudget(promotion.DailyBudget, at, promotion.Currency) - spent
+	return max(min(minorUnits(rules.ClickPrice, promotion.Currency), left), 0)
+}
+
+// clickToken issues a single-use token for a click on a promotion shown on day. The token
+// carries the promotion, the day and a random nonce, signed with the rules' click key.
+func clickToken(rules PromotionRules, promotionID int, day string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("could not issue click token: %w", err)
+	}
+	payload := strconv.Itoa(promotionID) + "." + day + "." + hex.EncodeToString(nonce)
+	return payload + "." + signClick(rules.ClickKey, payload), nil
+}
+
+// signClick is the HMAC-SHA256 of a click token's payload
+func signClick(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkClickToken returns the nonce of token if it was issued for a click on promotionID shown on day
+func checkClickToken(rules PromotionRules, promotionID int, day, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != strconv.Itoa(promotionID) || parts[1] != day ||
+		!hmac.Equal([]byte(parts[3]), []byte(signClick(rules.ClickKey, strings.Join(parts[:3], ".")))) {
+		return "", Invalid("click_token", "must be the token the promotion was shown with today")
+	}
+	return parts[2], nil
+}
+
+// PromotedSlots is how many of slots fall within results listings, which is how many promoted listings to show with them
+func PromotedSlots(slots []int, results int) int {
+	n := 0
+	for _, position := range slots {
+		if position >= 1 && position <= results {
+			n++
+		}
+	}
+	return n
+}
+
+// BlendPromoted puts promoted listings into results at the rules' slots, dropping their
+// own place in the results so each listing appears once
+func BlendPromoted(results, promoted []Listing, slots []int) []Listing {
+	shown := map[int]bool{}
+	for _, listing := range promoted {
+		shown[listing.ListingID] = true
+	}
+	organic := []Listing{}
+	for _, listing := range results {
+		if !shown[listing.ListingID] {
+			organic = append(organic, listing)
+		}
+	}
+
+	positions := append([]int{}, slots...)
+	sort.Ints(positions)
+	blended := []Listing{}
+	next := 0
+	for _, position := range positions {
+		if next == len(promoted) || position < 1 {
+			continue
+		}
+		for len(blended) < position-1 && len(organic) > 0 {
+			blended, organic = append(blended, organic[0]), organic[1:]
+		}
+		if len(blended) < position-1 {
+			break
+		}
+		blended = append(blended, promoted[next])
+		next++
+	}
+	return append(blended, organic...)
+}
+
+// settlePromotion pays what a promotion spent to the platform and gives the rest of its
+// budget back to the owner
+func settlePromotion(ctx context.Context, provider Payments.Provider, promotion Promotion) error {
+	if promotion.Spent > 0 {
+		err := provider.Payout(ctx, Payments.Payout{Reference: promotion.Reference, Fee: promotion.Spent, Currency: promotion.Currency})
+		if err != nil {
+			return paymentFailed(err)
+		}
+	}
+	if left := roundMoney(promotion.Budget-promotion.Spent, promotion.Currency); left > 0 {
+		if err := provider.Refund(ctx, promotion.Reference, left); err != nil {
+			return paymentFailed(err)
+		}
+	}
+	return nil
+}
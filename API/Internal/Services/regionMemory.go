@@ -0,0 +1,200 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	geo "github.com/paulmach/go.geo"
+	"sort"
+)
+
+// RegionMemory is the in-memory implementation of the Regions interface
+type RegionMemory struct {
+	store *memoryStore
+}
+
+// locateRegion returns the most specific region containing a point, or 0
+func (m *memoryStore) locateRegion(p *geo.Point) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.locateRegionLocked(p)
+}
+
+// locateRegionLocked is locateRegion for callers holding the lock
+func (m *memoryStore) locateRegionLocked(p *geo.Point) int {
+	containing := []Region{}
+	for _, region := range m.regions {
+		if region.Boundary.Contains(p) {
+			containing = append(containing, region)
+		}
+	}
+	return mostSpecific(containing)
+}
+
+// regionParents returns the parent of every region, 0 for countries
+func (m *memoryStore) regionParents() map[int]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.regionParentsLocked()
+}
+
+// regionParentsLocked is regionParents for callers holding the lock
+func (m *memoryStore) regionParentsLocked() map[int]int {
+	parents := make(map[int]int, len(m.regions))
+	for id, region := range m.regions {
+		parents[id] = region.ParentID
+	}
+	return parents
+}
+
+// counted fills in the listing and user counts of regions, dropping their boundaries unless asked to keep them.
+// The caller holds the lock.
+func (r *RegionMemory) counted(regions []Region, boundary bool) []Region {
+	listings, users := map[int]int{}, map[int]int{}
+	for _, listing := range r.store.listings {
+		if listing.DeletedAt == "" && isListed(listing) && listing.RegionID != 0 {
+			listings[listing.RegionID]++
+		}
+	}
+	for _, user := range r.store.users {
+		if user.DeletedAt == "" && user.RegionID != 0 {
+			users[user.RegionID]++
+		}
+	}
+	if !boundary {
+		for i := range regions {
+			regions[i].Boundary = nil
+		}
+	}
+	return withCounts(regions, r.store.regionParentsLocked(), listings, users)
+}
+
+// byName orders regions by English name, like the SQL queries
+func byName(regions []Region) []Region {
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].NameEn < regions[j].NameEn })
+	return regions
+}
+
+// Seed adds the gazetteer entries whose code is not stored yet. Parents must come before their children.
+func (r *RegionMemory) Seed(ctx context.Context, entries []GazetteerEntry) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	ids := map[string]int{}
+	for id, region := range r.store.regions {
+		ids[region.Code] = id
+	}
+	// Check every entry first, so a bad gazetteer adds nothing
+	var regions []Region
+	for _, entry := range entries {
+		if _, ok := ids[entry.Code]; ok {
+			continue
+		}
+		if err := checkRegionLevel(entry.Level); err != nil {
+			return 0, err
+		}
+		parentID, ok := ids[entry.Parent]
+		if entry.Parent != "" && !ok {
+			return 0, fmt.Errorf("region %s comes before its parent %s", entry.Code, entry.Parent)
+		}
+		boundary := append(Polygon{}, entry.Boundary...)
+		if err := boundary.normalize(); err != nil {
+			return 0, fmt.Errorf("region %s: %w", entry.Code, err)
+		}
+		ids[entry.Code] = r.store.nextRegionID + len(regions) + 1
+		regions = append(regions, Region{RegionID: ids[entry.Code], ParentID: parentID, Level: entry.Level, Code: entry.Code,
+			NameEn: entry.NameEn, NameAr: entry.NameAr, Boundary: boundary})
+	}
+	for _, region := range regions {
+		r.store.regions[region.RegionID] = region
+	}
+	r.store.nextRegionID += len(regions)
+	return len(regions), nil
+}
+
+// GetByID returns a region with its boundary
+func (r *RegionMemory) GetByID(ctx context.Context, regionID int) (Region, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	region, ok := r.store.regions[regionID]
+	if !ok {
+		return Region{}, fmt.Errorf("region %w", ErrNotFound)
+	}
+	return r.counted([]Region{region}, true)[0], nil
+}
+
+// GetByLevel returns every region of a level by name, without boundaries
+func (r *RegionMemory) GetByLevel(ctx context.Context, level string) ([]Region, error) {
+	if err := checkRegionLevel(level); err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	regions := []Region{}
+	for _, id := range sortedKeys(r.store.regions) {
+		if region := r.store.regions[id]; region.Level == level {
+			regions = append(regions, region)
+		}
+	}
+	return r.counted(byName(regions), false), nil
+}
+
+// GetChildren returns the regions directly inside a region by name, without boundaries
+func (r *RegionMemory) GetChildren(ctx context.Context, regionID int) ([]Region, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	regions := []Region{}
+	for _, id := range sortedKeys(r.store.regions) {
+		if region := r.store.regions[id]; region.ParentID == regionID {
+			regions = append(regions, region)
+		}
+	}
+	return r.counted(byName(regions), false), nil
+}
+
+// Locate returns the regions containing a point, from its country down to the most specific, without boundaries
+func (r *RegionMemory) Locate(ctx context.Context, latitude, longitude float64) ([]Region, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	regionID := r.store.locateRegionLocked(geo.NewPoint(longitude, latitude))
+	if regionID == 0 {
+		return []Region{}, nil
+	}
+	ids := ancestry(r.store.regionParentsLocked(), regionID)
+	regions := make([]Region, len(ids))
+	for i, id := range ids {
+		// ancestry starts at the most specific region
+		regions[len(ids)-1-i] = r.store.regions[id]
+	}
+	return r.counted(regions, false), nil
+}
+
+// AssignMissing places the listings and users that have no region yet. It returns how many were placed.
+func (r *RegionMemory) AssignMissing(ctx context.Context) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var assigned int64
+	for id, listing := range r.store.listings {
+		if listing.RegionID != 0 || listing.Location == nil {
+			continue
+		}
+		if listing.RegionID = r.store.locateRegionLocked(listing.Location); listing.RegionID != 0 {
+			r.store.listings[id] = listing
+			assigned++
+		}
+	}
+	for id, user := range r.store.users {
+		if user.RegionID != 0 || user.Location == nil || user.DeletedAt != "" {
+			continue
+		}
+		if user.RegionID = r.store.locateRegionLocked(user.Location); user.RegionID != 0 {
+			r.store.users[id] = user
+			assigned++
+		}
+	}
+	return assigned, nil
+}
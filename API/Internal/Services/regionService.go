@@ -0,0 +1,312 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	geo "github.com/paulmach/go.geo"
+	"sort"
+	"strings"
+)
+
+// regionColumns is the column list the region queries select, in the order scanRegions reads them
+func regionColumns(d Database.Dialect, boundary bool) string {
+	columns := `region_id, COALESCE(parent_id, 0), level, code, name_en, name_ar`
+	if boundary {
+		columns += `, ` + d.Polygon("boundary")
+	}
+	return columns
+}
+
+// regionArg stores a missing (zero) region as NULL
+func regionArg(regionID int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(regionID), Valid: regionID != 0}
+}
+
+// placeholders returns n comma-separated placeholders for an IN list
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// scanRegions runs a query selecting regionColumns
+func scanRegions(ctx context.Context, db *Database.DB, boundary bool, query string, args ...interface{}) ([]Region, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve regions: %w", err)
+	}
+	defer rows.Close()
+
+	regions := []Region{}
+	for rows.Next() {
+		var region Region
+		fields := []interface{}{&region.RegionID, &region.ParentID, &region.Level, &region.Code, &region.NameEn, &region.NameAr}
+		if boundary {
+			fields = append(fields, &region.Boundary)
+		}
+		if err := rows.Scan(fields...); err != nil {
+			return nil, fmt.Errorf("could not scan region: %w", err)
+		}
+		regions = append(regions, region)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate over regions: %w", err)
+	}
+	return regions, nil
+}
+
+// regionParents returns the parent of every region, 0 for countries
+func regionParents(ctx context.Context, db *Database.DB) (map[int]int, error) {
+	regions, err := scanRegions(ctx, db, false, `SELECT `+regionColumns(db.Dialect, false)+` FROM regions`)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[int]int, len(regions))
+	for _, region := range regions {
+		parents[region.RegionID] = region.ParentID
+	}
+	return parents, nil
+}
+
+// countByRegion runs a query selecting region IDs and counts
+func countByRegion(ctx context.Context, db *Database.DB, query string) (map[int]int, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("could not count by region: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var regionID, count int
+		if err := rows.Scan(&regionID, &count); err != nil {
+			return nil, fmt.Errorf("could not scan region count: %w", err)
+		}
+		counts[regionID] = count
+	}
+	return counts, rows.Err()
+}
+
+// regionLocator returns a function finding the most specific region containing a point.
+// Dialects without spatial functions load every boundary once and test them in Go.
+func regionLocator(ctx context.Context, db *Database.DB) (func(p *geo.Point) (int, error), error) {
+	contains, ok := db.Dialect.Contains("boundary")
+	if !ok {
+		regions, err := scanRegions(ctx, db, true, `SELECT `+regionColumns(db.Dialect, true)+` FROM regions`)
+		if err != nil {
+			return nil, err
+		}
+		return func(p *geo.Point) (int, error) {
+			containing := []Region{}
+			for _, region := range regions {
+				if region.Boundary.Contains(p) {
+					containing = append(containing, region)
+				}
+			}
+			return mostSpecific(containing), nil
+		}, nil
+	}
+
+	return func(p *geo.Point) (int, error) {
+		if p == nil {
+			return 0, nil
+		}
+		containing, err := scanRegions(ctx, db, true, `SELECT `+regionColumns(db.Dialect, true)+` FROM regions WHERE `+contains, db.Dialect.PointArg(p))
+		if err != nil {
+			return 0, err
+		}
+		return mostSpecific(containing), nil
+	}, nil
+}
+
+// locateRegion returns the most specific region containing a point, or 0
+func locateRegion(ctx context.Context, db *Database.DB, p *geo.Point) (int, error) {
+	locate, err := regionLocator(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	return locate(p)
+}
+
+type RegionService struct {
+	db *Database.DB
+}
+
+// counted fills in the listing and user counts of regions
+func (s *RegionService) counted(ctx context.Context, regions []Region) ([]Region, error) {
+	parents, err := regionParents(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	listings, err := countByRegion(ctx, s.db, `SELECT region_id, COUNT(*) FROM listings WHERE `+listed+` AND region_id IS NOT NULL GROUP BY region_id`)
+	if err != nil {
+		return nil, err
+	}
+	users, err := countByRegion(ctx, s.db, `SELECT region_id, COUNT(*) FROM users WHERE deleted_at IS NULL AND region_id IS NOT NULL GROUP BY region_id`)
+	if err != nil {
+		return nil, err
+	}
+	return withCounts(regions, parents, listings, users), nil
+}
+
+// Seed adds the gazetteer entries whose code is not stored yet, so a grown gazetteer can be
+// seeded again. Parents must come before their children. It returns how many were added.
+func (s *RegionService) Seed(ctx context.Context, entries []GazetteerEntry) (int, error) {
+	stored, err := scanRegions(ctx, s.db, false, `SELECT `+regionColumns(s.db.Dialect, false)+` FROM regions`)
+	if err != nil {
+		return 0, err
+	}
+	ids := map[string]int{}
+	for _, region := range stored {
+		ids[region.Code] = region.RegionID
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	added := 0
+	for _, entry := range entries {
+		if _, ok := ids[entry.Code]; ok {
+			continue
+		}
+		if err := checkRegionLevel(entry.Level); err != nil {
+			return 0, err
+		}
+		parentID, ok := ids[entry.Parent]
+		if entry.Parent != "" && !ok {
+			return 0, fmt.Errorf("region %s comes before its parent %s", entry.Code, entry.Parent)
+		}
+		boundary := append(Polygon{}, entry.Boundary...)
+		if err := boundary.normalize(); err != nil {
+			return 0, fmt.Errorf("region %s: %w", entry.Code, err)
+		}
+
+		id, err := tx.InsertID(ctx, `INSERT INTO regions (parent_id, level, code, name_en, name_ar, boundary) VALUES (?, ?, ?, ?, ?, `+s.db.Dialect.PolygonValue()+`)`,
+			"region_id", regionArg(parentID), entry.Level, entry.Code, entry.NameEn, entry.NameAr, Database.PolygonWKB(boundary))
+		if err != nil {
+			return 0, fmt.Errorf("could not seed region %s: %w", entry.Code, err)
+		}
+		ids[entry.Code] = int(id)
+		added++
+	}
+	return added, tx.Commit()
+}
+
+// GetByID returns a region with its boundary
+func (s *RegionService) GetByID(ctx context.Context, regionID int) (Region, error) {
+	regions, err := scanRegions(ctx, s.db, true, `SELECT `+regionColumns(s.db.Dialect, true)+` FROM regions WHERE region_id = ?`, regionID)
+	if err != nil {
+		return Region{}, err
+	}
+	if len(regions) == 0 {
+		return Region{}, fmt.Errorf("region %w", ErrNotFound)
+	}
+	regions, err = s.counted(ctx, regions)
+	if err != nil {
+		return Region{}, err
+	}
+	return regions[0], nil
+}
+
+// GetByLevel returns every region of a level by name, without boundaries
+func (s *RegionService) GetByLevel(ctx context.Context, level string) ([]Region, error) {
+	if err := checkRegionLevel(level); err != nil {
+		return nil, err
+	}
+	regions, err := scanRegions(ctx, s.db, false, `SELECT `+regionColumns(s.db.Dialect, false)+` FROM regions WHERE level = ? ORDER BY name_en`, level)
+	if err != nil {
+		return nil, err
+	}
+	return s.counted(ctx, regions)
+}
+
+// GetChildren returns the regions directly inside a region by name, without boundaries
+func (s *RegionService) GetChildren(ctx context.Context, regionID int) ([]Region, error) {
+	regions, err := scanRegions(ctx, s.db, false, `SELECT `+regionColumns(s.db.Dialect, false)+` FROM regions WHERE parent_id = ? ORDER BY name_en`, regionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.counted(ctx, regions)
+}
+
+// Locate returns the regions containing a point, from its country down to the most specific, without boundaries
+func (s *RegionService) Locate(ctx context.Context, latitude, longitude float64) ([]Region, error) {
+	regionID, err := locateRegion(ctx, s.db, geo.NewPoint(longitude, latitude))
+	if err != nil || regionID == 0 {
+		return []Region{}, err
+	}
+	parents, err := regionParents(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	ids := ancestry(parents, regionID)
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	regions, err := scanRegions(ctx, s.db, false, `SELECT `+regionColumns(s.db.Dialect, false)+` FROM regions WHERE region_id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(regions, func(i, j int) bool { return regionDepth[regions[i].Level] < regionDepth[regions[j].Level] })
+	return s.counted(ctx, regions)
+}
+
+// located is a row waiting for its region
+type located struct {
+	id       int
+	location *geo.Point
+}
+
+// AssignMissing places the listings and users that have no region yet, e.g. those created before
+// the gazetteer was seeded. Rows outside every region stay without one. It returns how many were placed.
+func (s *RegionService) AssignMissing(ctx context.Context) (int64, error) {
+	locate, err := regionLocator(ctx, s.db)
+	if err != nil {
+		return 0, err
+	}
+
+	var assigned int64
+	for _, table := range []struct{ name, id, condition string }{
+		{"listings", "listing_id", "1 = 1"},
+		{"users", "user_id", "deleted_at IS NULL"},
+	} {
+		rows, err := s.db.QueryContext(ctx, `SELECT `+table.id+`, `+s.db.Dialect.Point("location")+` FROM `+table.name+
+			` WHERE region_id IS NULL AND location IS NOT NULL AND `+table.condition)
+		if err != nil {
+			return assigned, fmt.Errorf("could not retrieve %s without a region: %w", table.name, err)
+		}
+		// Read every row before updating, SQLite has a single connection
+		var pending []located
+		for rows.Next() {
+			var row located
+			if err := rows.Scan(&row.id, &row.location); err != nil {
+				rows.Close()
+				return assigned, fmt.Errorf("could not scan %s: %w", table.name, err)
+			}
+			pending = append(pending, row)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return assigned, err
+		}
+
+		for _, row := range pending {
+			regionID, err := locate(row.location)
+			if err != nil {
+				return assigned, err
+			}
+			if regionID == 0 {
+				continue
+			}
+			if _, err := s.db.ExecContext(ctx, `UPDATE `+table.name+` SET region_id = ? WHERE `+table.id+` = ?`, regionID, row.id); err != nil {
+				return assigned, fmt.Errorf("could not assign a region: %w", err)
+			}
+			assigned++
+		}
+	}
+	return assigned, nil
+}
@@ -0,0 +1,220 @@
+package Services
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Levels of the region hierarchy, from the largest to the most specific
+const (
+	RegionCountry     = "country"
+	RegionGovernorate = "governorate"
+	RegionDistrict    = "district"
+	RegionCity        = "city"
+)
+
+// regionDepth orders the levels, so the most specific region containing a point can be picked
+var regionDepth = map[string]int{RegionCountry: 0, RegionGovernorate: 1, RegionDistrict: 2, RegionCity: 3}
+
+// Region is a country, governorate, district or city of the gazetteer
+type Region struct {
+	// @example 12
+	RegionID int `json:"region_id"`
+
+	// ParentID is the region this one lies in, 0 for countries
+	// @example 3
+	ParentID int `json:"parent_id,omitempty"`
+
+	// @example "district"
+	Level string `json:"level"`
+
+	// Code is stable across databases, unlike RegionID
+	// @example "LB-JL-METN"
+	Code string `json:"code"`
+
+	// @example "Metn"
+	NameEn string `json:"name_en"`
+
+	// @example "المتن"
+	NameAr string `json:"name_ar"`
+
+	// Boundary is only returned for a single region
+	Boundary Polygon `json:"boundary,omitempty"`
+
+	// ListingCount is the number of published listings in the region or any region inside it
+	// @example 42
+	ListingCount int `json:"listing_count"`
+
+	// UserCount is the number of users living in the region or any region inside it
+	// @example 17
+	UserCount int `json:"user_count"`
+}
+
+// GazetteerEntry is a region to seed, with its parent given by code so entries can be written before any IDs exist
+type GazetteerEntry struct {
+	Code     string
+	Parent   string
+	Level    string
+	NameEn   string
+	NameAr   string
+	Boundary Polygon
+}
+
+// checkRegionLevel rejects unknown levels
+func checkRegionLevel(level string) error {
+	if _, ok := regionDepth[level]; !ok {
+		return Invalid("level", "must be one of country, governorate, district, city")
+	}
+	return nil
+}
+
+// area is the planar area of the polygon in square degrees, by the shoelace formula
+func (p Polygon) area() float64 {
+	sum := 0.0
+	for i := 0; i+1 < len(p); i++ {
+		sum += p[i][0]*p[i+1][1] - p[i+1][0]*p[i][1]
+	}
+	return math.Abs(sum) / 2
+}
+
+// mostSpecific picks the region a point belongs to out of those containing it: the deepest level,
+// then the smallest boundary where rough boundaries overlap. It returns 0 when there are none.
+func mostSpecific(regions []Region) int {
+	best := -1
+	for i, region := range regions {
+		if best == -1 {
+			best = i
+			continue
+		}
+		depth, bestDepth := regionDepth[region.Level], regionDepth[regions[best].Level]
+		if depth > bestDepth || (depth == bestDepth && region.Boundary.area() < regions[best].Boundary.area()) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return 0
+	}
+	return regions[best].RegionID
+}
+
+// descendants returns a region and every region inside it, given each region's parent
+func descendants(parents map[int]int, regionID int) []int {
+	children := map[int][]int{}
+	for id, parent := range parents {
+		children[parent] = append(children[parent], id)
+	}
+	ids := []int{}
+	queue := []int{regionID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		ids = append(ids, id)
+		queue = append(queue, children[id]...)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// ancestry returns a region followed by its parent, grandparent and so on up to its country
+func ancestry(parents map[int]int, regionID int) []int {
+	ids := []int{}
+	for id := regionID; id != 0 && len(ids) <= len(regionDepth); id = parents[id] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// withCounts fills in the listing and user counts of regions from the counts of the regions
+// listings and users are assigned to, adding each to every region above it
+func withCounts(regions []Region, parents map[int]int, listings, users map[int]int) []Region {
+	rolledListings, rolledUsers := map[int]int{}, map[int]int{}
+	for regionID, count := range listings {
+		for _, id := range ancestry(parents, regionID) {
+			rolledListings[id] += count
+		}
+	}
+	for regionID, count := range users {
+		for _, id := range ancestry(parents, regionID) {
+			rolledUsers[id] += count
+		}
+	}
+	for i := range regions {
+		regions[i].ListingCount = rolledListings[regions[i].RegionID]
+		regions[i].UserCount = rolledUsers[regions[i].RegionID]
+	}
+	return regions
+}
+
+// governorates are the governorates of Lebanon with their ISO 3166-2 codes
+var governorates = []struct{ code, nameEn, nameAr string }{
+	{"LB-BA", "Beirut", "بيروت"},
+	{"LB-JL", "Mount Lebanon", "جبل لبنان"},
+	{"LB-AS", "North", "الشمال"},
+	{"LB-AK", "Akkar", "عكار"},
+	{"LB-JA", "South", "الجنوب"},
+	{"LB-NA", "Nabatieh", "النبطية"},
+	{"LB-BI", "Bekaa", "البقاع"},
+	{"LB-BH", "Baalbek-Hermel", "بعلبك الهرمل"},
+}
+
+// cities are the main cities with the district they lie in and their centre as longitude, latitude
+var cities = []struct {
+	nameEn, nameAr, district string
+	lng, lat                 float64
+}{
+	{"Beirut", "بيروت", "Beirut", 35.5018, 33.8938},
+	{"Jounieh", "جونية", "Keserwan", 35.6178, 33.9808},
+	{"Byblos", "جبيل", "Jbeil", 35.6480, 34.1230},
+	{"Tripoli", "طرابلس", "Tripoli", 35.8498, 34.4346},
+	{"Batroun", "البترون", "Batroun", 35.6589, 34.2553},
+	{"Sidon", "صيدا", "Sidon", 35.3710, 33.5630},
+	{"Tyre", "صور", "Tyre", 35.2038, 33.2705},
+	{"Nabatieh", "النبطية", "Nabatieh", 35.4836, 33.3772},
+	{"Zahle", "زحلة", "Zahle", 35.9019, 33.8463},
+	{"Baalbek", "بعلبك", "Baalbek", 36.2110, 34.0047},
+}
+
+// cityRadius is half the side of the box drawn around a city centre, in degrees (about 2 km)
+const cityRadius = 0.02
+
+// regionCode turns a name into the upper-case, dash-separated part of a region code
+func regionCode(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, " ", "-"))
+}
+
+// Gazetteer returns the built-in regions of Lebanon, parents before children. Districts reuse the
+// rough rectangles of the service area districts, governorates are the box around their districts
+// and cities a small box around their centre.
+func Gazetteer() []GazetteerEntry {
+	entries := []GazetteerEntry{{Code: "LB", Level: RegionCountry, NameEn: "Lebanon", NameAr: "لبنان", Boundary: box(35.10, 33.05, 36.62, 34.70)}}
+
+	districtCodes := map[string]string{}
+	var districts []GazetteerEntry
+	for _, governorate := range governorates {
+		bounds := [4]float64{180, 90, -180, -90}
+		for _, district := range Districts {
+			if district.Governorate != governorate.nameEn {
+				continue
+			}
+			for _, point := range district.Polygon {
+				bounds[0], bounds[1] = math.Min(bounds[0], point[0]), math.Min(bounds[1], point[1])
+				bounds[2], bounds[3] = math.Max(bounds[2], point[0]), math.Max(bounds[3], point[1])
+			}
+			code := governorate.code + "-" + regionCode(district.Name)
+			districtCodes[district.Name] = code
+			districts = append(districts, GazetteerEntry{Code: code, Parent: governorate.code, Level: RegionDistrict,
+				NameEn: district.Name, NameAr: district.NameAr, Boundary: district.Polygon})
+		}
+		entries = append(entries, GazetteerEntry{Code: governorate.code, Parent: "LB", Level: RegionGovernorate,
+			NameEn: governorate.nameEn, NameAr: governorate.nameAr, Boundary: box(bounds[0], bounds[1], bounds[2], bounds[3])})
+	}
+	entries = append(entries, districts...)
+
+	for _, city := range cities {
+		parent := districtCodes[city.district]
+		entries = append(entries, GazetteerEntry{Code: parent + "-CITY-" + regionCode(city.nameEn), Parent: parent, Level: RegionCity,
+			NameEn: city.nameEn, NameAr: city.nameAr, Boundary: box(city.lng-cityRadius, city.lat-cityRadius, city.lng+cityRadius, city.lat+cityRadius)})
+	}
+	return entries
+}
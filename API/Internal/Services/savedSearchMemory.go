@@ -0,0 +1,176 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SavedSearchMemory is the in-memory implementation of the SavedSearches interface
+type SavedSearchMemory struct {
+	store *memoryStore
+}
+
+// Create saves a search. Only listings created or updated from now on are matched against it.
+func (s *SavedSearchMemory) Create(ctx context.Context, search *SavedSearch) (SavedSearch, error) {
+	if err := search.check(); err != nil {
+		return SavedSearch{}, err
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	s.store.nextSearchID++
+	created := *search
+	created.SearchID = s.store.nextSearchID
+	created.DateCreated = now()
+	s.store.savedSearches[created.SearchID] = created
+	s.store.searchMatches[created.SearchID] = map[int]bool{}
+	return created, nil
+}
+
+// GetByID returns a single saved search.
+func (s *SavedSearchMemory) GetByID(ctx context.Context, searchID int) (SavedSearch, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	search, ok := s.store.savedSearches[searchID]
+	if !ok {
+		return SavedSearch{}, fmt.Errorf("saved search %w", ErrNotFound)
+	}
+	return search, nil
+}
+
+// GetByUser returns a user's saved searches, oldest first.
+func (s *SavedSearchMemory) GetByUser(ctx context.Context, userID int) ([]SavedSearch, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	searches := []SavedSearch{}
+	for _, id := range sortedKeys(s.store.savedSearches) {
+		if search := s.store.savedSearches[id]; search.UserID == userID {
+			searches = append(searches, search)
+		}
+	}
+	return searches, nil
+}
+
+// Update replaces the name, filters and frequency of a saved search.
+func (s *SavedSearchMemory) Update(ctx context.Context, search *SavedSearch) error {
+	if err := search.check(); err != nil {
+		return err
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.savedSearches[search.SearchID]
+	if !ok {
+		return fmt.Errorf("saved search %w", ErrNotFound)
+	}
+	stored.Name = search.Name
+	stored.Type = search.Type
+	stored.Query = search.Query
+	stored.Category = search.Category
+	stored.Location = search.Location
+	stored.MaxDistance = search.MaxDistance
+	stored.Frequency = search.Frequency
+	s.store.savedSearches[search.SearchID] = stored
+	return nil
+}
+
+// Delete removes a saved search and its matches.
+func (s *SavedSearchMemory) Delete(ctx context.Context, searchID int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if _, ok := s.store.savedSearches[searchID]; !ok {
+		return fmt.Errorf("saved search %w", ErrNotFound)
+	}
+	delete(s.store.savedSearches, searchID)
+	delete(s.store.searchMatches, searchID)
+	delete(s.store.searchDigests, searchID)
+	return nil
+}
+
+// matchedListings returns the published listings among the matches of a search that keep passes, newest first.
+// The caller holds the lock.
+func (s *SavedSearchMemory) matchedListings(searchID int, keep func(notified bool) bool) []Listing {
+	listings := []Listing{}
+	for listingID, notified := range s.store.searchMatches[searchID] {
+		listing, ok := s.store.listings[listingID]
+		if ok && listing.DeletedAt == "" && isListed(listing) && keep(notified) {
+			listings = append(listings, listing)
+		}
+	}
+	return newestFirst(listings)
+}
+
+// GetMatches returns the listings that matched a saved search and are still published, newest first.
+func (s *SavedSearchMemory) GetMatches(ctx context.Context, searchID int) ([]Listing, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	return s.matchedListings(searchID, func(bool) bool { return true }), nil
+}
+
+// Match evaluates the listings published, created or updated since the last run against every
+// saved search and records the new matches, returning those of instant searches.
+func (s *SavedSearchMemory) Match(ctx context.Context) ([]SearchMatch, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	instant := []SearchMatch{}
+	for _, listingID := range sortedKeys(s.store.unmatchedListings) {
+		listing, ok := s.store.listings[listingID]
+		if !ok || listing.DeletedAt != "" || !isListed(listing) {
+			continue
+		}
+		for _, searchID := range sortedKeys(s.store.savedSearches) {
+			search := s.store.savedSearches[searchID]
+			if _, matched := s.store.searchMatches[searchID][listingID]; matched || !search.Matches(listing) {
+				continue
+			}
+			s.store.searchMatches[searchID][listingID] = search.Frequency == AlertInstant
+			if search.Frequency == AlertInstant {
+				instant = append(instant, SearchMatch{Search: search, Listing: listing})
+			}
+		}
+		delete(s.store.unmatchedListings, listingID)
+	}
+	return instant, nil
+}
+
+// Digests returns, for each daily saved search last summarised (or created) at least every ago,
+// the still published listings that matched since, and records them as notified.
+func (s *SavedSearchMemory) Digests(ctx context.Context, every time.Duration) ([]SearchDigest, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	digests := []SearchDigest{}
+	for _, searchID := range sortedKeys(s.store.savedSearches) {
+		search := s.store.savedSearches[searchID]
+		last, ok := s.store.searchDigests[searchID]
+		if !ok {
+			last = search.DateCreated
+		}
+		pending := false
+		for _, notified := range s.store.searchMatches[searchID] {
+			pending = pending || !notified
+		}
+		if search.Frequency != AlertDaily || !pending || age(last) < every {
+			continue
+		}
+
+		listings := s.matchedListings(searchID, func(notified bool) bool { return !notified })
+		for listingID := range s.store.searchMatches[searchID] {
+			s.store.searchMatches[searchID][listingID] = true
+		}
+		s.store.searchDigests[searchID] = now()
+
+		if len(listings) > 0 {
+			digests = append(digests, SearchDigest{Search: search, Listings: listings})
+		}
+	}
+	return digests, nil
+}
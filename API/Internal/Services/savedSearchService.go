@@ -0,0 +1,336 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	geo "github.com/paulmach/go.geo"
+	"time"
+)
+
+// Alert frequencies of saved searches
+const (
+	AlertInstant = "instant"
+	AlertDaily   = "daily"
+)
+
+// SavedSearch is a listing search a user wants to be alerted about. Empty filters match everything.
+type SavedSearch struct {
+	// @example 1
+	SearchID int `json:"search_id"`
+
+	// UserID is the user who saved the search and receives its alerts
+	// @example 2
+	UserID int `json:"user_id"`
+
+	// @example "Plumbers near home"
+	Name string `json:"name" validate:"required,max=100"`
+
+	// Type restricts matches to Request or Offer listings
+	// @example "Offer"
+	Type string `json:"type,omitempty" validate:"omitempty,oneof=Request Offer"`
+
+	// Query is searched for in listing titles and descriptions
+	// @example "leak"
+	Query string `json:"query,omitempty" validate:"max=255"`
+
+	// @example "plumbing"
+	Category string `json:"category,omitempty" validate:"omitempty,oneof=plumbing electrical carpentry painting tiling masonry roofing cleaning gardening moving hvac other"`
+
+	// Location and MaxDistance restrict matches to an area; MaxDistance is in kilometres
+	// @example [35.5018, 33.8938]
+	Location *geo.Point `json:"location,omitempty" validate:"omitempty,coordinates"`
+
+	// @example 10
+	MaxDistance float64 `json:"max_distance,omitempty" validate:"min=0"`
+
+	// Frequency is instant for one notification per match, or daily for a digest
+	// @example "instant"
+	Frequency string `json:"frequency" validate:"required,oneof=instant daily"`
+
+	// @example "2024-12-16 14:30:00"
+	DateCreated string `json:"date_created"`
+}
+
+// SearchMatch is a listing newly matching a saved search
+type SearchMatch struct {
+	Search  SavedSearch
+	Listing Listing
+}
+
+// SearchDigest collects the listings that matched a daily saved search since its last digest
+type SearchDigest struct {
+	Search   SavedSearch
+	Listings []Listing
+}
+
+// check applies the rules spanning several fields
+func (s SavedSearch) check() error {
+	if s.Location != nil && s.MaxDistance <= 0 {
+		return Invalid("max_distance", "must be positive when a location is set")
+	}
+	return nil
+}
+
+// Matches reports whether a listing of another user passes every filter of the search,
+// applying them the way the listing queries do
+func (s SavedSearch) Matches(listing Listing) bool {
+	return listing.UserID != s.UserID && matchesType(listing, s.Type) && matchesSearch(listing, s.Query) &&
+		(s.Category == "" || listing.Category == s.Category) &&
+		(s.Location == nil || withinDistance(listing, s.Location.Lat(), s.Location.Lng(), s.MaxDistance))
+}
+
+// savedSearchColumns is the column list the saved search queries select, in the order scanSavedSearch reads them
+func savedSearchColumns(d Database.Dialect) string {
+	return `search_id, user_id, name, type, query, category, longitude, latitude, max_distance, frequency, ` + d.Timestamp("date_created")
+}
+
+type SavedSearchService struct {
+	db       *Database.DB
+	listings *ListingService
+}
+
+// scanSavedSearch reads a row selected with savedSearchColumns
+func scanSavedSearch(rows *sql.Rows) (SavedSearch, error) {
+	var search SavedSearch
+	var longitude, latitude sql.NullFloat64
+	if err := rows.Scan(&search.SearchID, &search.UserID, &search.Name, &search.Type, &search.Query, &search.Category,
+		&longitude, &latitude, &search.MaxDistance, &search.Frequency, &search.DateCreated); err != nil {
+		return SavedSearch{}, fmt.Errorf("could not scan saved search: %w", err)
+	}
+	if longitude.Valid && latitude.Valid {
+		search.Location = geo.NewPoint(longitude.Float64, latitude.Float64)
+	}
+	return search, nil
+}
+
+// querySavedSearches runs a query selecting savedSearchColumns
+func (s *SavedSearchService) querySavedSearches(ctx context.Context, query string, args ...interface{}) ([]SavedSearch, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	searches := []SavedSearch{}
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, search)
+	}
+	return searches, rows.Err()
+}
+
+// locationArgs returns the longitude and latitude columns of a search, NULL without a location
+func locationArgs(search *SavedSearch) (sql.NullFloat64, sql.NullFloat64) {
+	if search.Location == nil {
+		return sql.NullFloat64{}, sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: search.Location.Lng(), Valid: true}, sql.NullFloat64{Float64: search.Location.Lat(), Valid: true}
+}
+
+// Create saves a search. Only listings created or updated from now on are matched against it.
+func (s *SavedSearchService) Create(ctx context.Context, search *SavedSearch) (SavedSearch, error) {
+	if err := search.check(); err != nil {
+		return SavedSearch{}, err
+	}
+
+	longitude, latitude := locationArgs(search)
+	query := `INSERT INTO saved_searches (user_id, name, type, query, category, longitude, latitude, max_distance, frequency)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	searchID, err := s.db.InsertID(ctx, query, "search_id", search.UserID, search.Name, search.Type, search.Query, search.Category,
+		longitude, latitude, search.MaxDistance, search.Frequency)
+	if err != nil {
+		return SavedSearch{}, fmt.Errorf("could not create saved search: %w", err)
+	}
+	return s.GetByID(ctx, int(searchID))
+}
+
+// GetByID returns a single saved search
+func (s *SavedSearchService) GetByID(ctx context.Context, searchID int) (SavedSearch, error) {
+	searches, err := s.querySavedSearches(ctx, `SELECT `+savedSearchColumns(s.db.Dialect)+` FROM saved_searches WHERE search_id = ?`, searchID)
+	if err != nil {
+		return SavedSearch{}, err
+	}
+	if len(searches) == 0 {
+		return SavedSearch{}, fmt.Errorf("saved search %w", ErrNotFound)
+	}
+	return searches[0], nil
+}
+
+// GetByUser returns a user's saved searches, oldest first
+func (s *SavedSearchService) GetByUser(ctx context.Context, userID int) ([]SavedSearch, error) {
+	return s.querySavedSearches(ctx, `SELECT `+savedSearchColumns(s.db.Dialect)+` FROM saved_searches WHERE user_id = ? ORDER BY search_id`, userID)
+}
+
+// Update replaces the name, filters and frequency of a saved search. Past matches are kept.
+func (s *SavedSearchService) Update(ctx context.Context, search *SavedSearch) error {
+	if err := search.check(); err != nil {
+		return err
+	}
+
+	longitude, latitude := locationArgs(search)
+	query := `UPDATE saved_searches
+	          SET name = ?, type = ?, query = ?, category = ?, longitude = ?, latitude = ?, max_distance = ?, frequency = ?
+	          WHERE search_id = ?`
+	result, err := s.db.ExecContext(ctx, query, search.Name, search.Type, search.Query, search.Category,
+		longitude, latitude, search.MaxDistance, search.Frequency, search.SearchID)
+	if err != nil {
+		return fmt.Errorf("could not update saved search: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("saved search %w", ErrNotFound)
+	}
+	return nil
+}
+
+// Delete removes a saved search and its matches
+func (s *SavedSearchService) Delete(ctx context.Context, searchID int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM saved_searches WHERE search_id = ?`, searchID)
+	if err != nil {
+		return fmt.Errorf("could not delete saved search: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("saved search %w", ErrNotFound)
+	}
+	return nil
+}
+
+// GetMatches returns the listings that matched a saved search and are still published, newest first
+func (s *SavedSearchService) GetMatches(ctx context.Context, searchID int) ([]Listing, error) {
+	query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings
+	          WHERE ` + listed + ` AND listing_id IN (SELECT listing_id FROM saved_search_matches WHERE search_id = ?)
+	          ORDER BY date_created DESC, listing_id DESC`
+	return s.listings.queryListings(ctx, query, searchID)
+}
+
+// Match evaluates the listings published, created or updated since the last run against every
+// saved search and records the new matches. A listing matches each search at most once.
+// The matches of instant searches are returned, and recorded as notified.
+func (s *SavedSearchService) Match(ctx context.Context) ([]SearchMatch, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT listing_id, revision FROM listings WHERE `+listed+` AND matched_revision < revision ORDER BY listing_id`)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve unmatched listings: %w", err)
+	}
+	revisions := map[int]int{}
+	var pending []int
+	for rows.Next() {
+		var listingID, revision int
+		if err := rows.Scan(&listingID, &revision); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("could not scan listing: %w", err)
+		}
+		revisions[listingID] = revision
+		pending = append(pending, listingID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return []SearchMatch{}, nil
+	}
+
+	searches, err := s.querySavedSearches(ctx, `SELECT `+savedSearchColumns(s.db.Dialect)+` FROM saved_searches ORDER BY search_id`)
+	if err != nil {
+		return nil, err
+	}
+
+	instant := []SearchMatch{}
+	for _, listingID := range pending {
+		listing, err := s.listings.GetByID(ctx, listingID)
+		if err != nil {
+			return instant, err
+		}
+		for _, search := range searches {
+			if !search.Matches(listing) {
+				continue
+			}
+			recorded, err := s.recordMatch(ctx, search, listingID)
+			if err != nil {
+				return instant, err
+			}
+			if recorded && search.Frequency == AlertInstant {
+				instant = append(instant, SearchMatch{Search: search, Listing: listing})
+			}
+		}
+
+		// An edit made while matching raised the revision again, so the listing is looked at on the next run
+		_, err = s.db.ExecContext(ctx, `UPDATE listings SET matched_revision = ? WHERE listing_id = ?`, revisions[listingID], listingID)
+		if err != nil {
+			return instant, fmt.Errorf("could not record matched listing: %w", err)
+		}
+	}
+	return instant, nil
+}
+
+// recordMatch stores a match unless the listing already matched the search, and reports whether it was new.
+// Matches of instant searches are stored as notified.
+func (s *SavedSearchService) recordMatch(ctx context.Context, search SavedSearch, listingID int) (bool, error) {
+	var exists int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM saved_search_matches WHERE search_id = ? AND listing_id = ?`,
+		search.SearchID, listingID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("could not check saved search match: %w", err)
+	}
+	if exists > 0 {
+		return false, nil
+	}
+
+	notifiedAt := "NULL"
+	if search.Frequency == AlertInstant {
+		notifiedAt = "CURRENT_TIMESTAMP"
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO saved_search_matches (search_id, listing_id, notified_at) VALUES (?, ?, `+notifiedAt+`)`,
+		search.SearchID, listingID)
+	if err != nil {
+		return false, fmt.Errorf("could not record saved search match: %w", err)
+	}
+	return true, nil
+}
+
+// Digests returns, for each daily saved search whose last digest (or creation) is at least every ago,
+// the still published listings that matched since, and records them as notified.
+func (s *SavedSearchService) Digests(ctx context.Context, every time.Duration) ([]SearchDigest, error) {
+	query := `SELECT ` + savedSearchColumns(s.db.Dialect) + ` FROM saved_searches
+	          WHERE frequency = ? AND ` + s.db.Dialect.Age("COALESCE(last_digest_at, date_created)") + ` >= ?
+	          AND EXISTS (SELECT 1 FROM saved_search_matches m WHERE m.search_id = saved_searches.search_id AND m.notified_at IS NULL)
+	          ORDER BY search_id`
+	searches, err := s.querySavedSearches(ctx, query, AlertDaily, every.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []SearchDigest{}
+	for _, search := range searches {
+		query := `SELECT ` + listingColumns(s.db.Dialect) + ` FROM listings
+		          WHERE ` + listed + ` AND listing_id IN (SELECT listing_id FROM saved_search_matches WHERE search_id = ? AND notified_at IS NULL)
+		          ORDER BY date_created DESC, listing_id DESC`
+		listings, err := s.listings.queryListings(ctx, query, search.SearchID)
+		if err != nil {
+			return digests, err
+		}
+
+		_, err = s.db.ExecContext(ctx, `UPDATE saved_search_matches SET notified_at = CURRENT_TIMESTAMP WHERE search_id = ? AND notified_at IS NULL`, search.SearchID)
+		if err != nil {
+			return digests, fmt.Errorf("could not record digest: %w", err)
+		}
+		_, err = s.db.ExecContext(ctx, `UPDATE saved_searches SET last_digest_at = CURRENT_TIMESTAMP WHERE search_id = ?`, search.SearchID)
+		if err != nil {
+			return digests, fmt.Errorf("could not record digest: %w", err)
+		}
+
+		// Matches that were unpublished since are dropped without a digest
+		if len(listings) > 0 {
+			digests = append(digests, SearchDigest{Search: search, Listings: listings})
+		}
+	}
+	return digests, nil
+}
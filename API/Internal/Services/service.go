@@ -2,7 +2,10 @@ package Services
 
 import (
 	"context"
-	"database/sql"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+	"time"
 )
 
 type Service struct {
@@ -12,7 +15,8 @@ type Service struct {
 		GetByName(ctx context.Context, name string) ([]User, error)
 		Create(context.Context, *User) error
 		Update(context.Context, *User) error
-		Delete(context.Context, int) (bool, error)
+		Close(ctx context.Context, userID int) error
+		SetRole(ctx context.Context, userID int, role string) error
 		Auth(context.Context, string, string) (string, User, error)
 		GetByPhoneNumber(context.Context, string) (User, error)
 	}
@@ -20,13 +24,21 @@ type Service struct {
 		Create(context.Context, *Listing) (Listing, error)
 		Update(context.Context, *Listing, int) error
 		Delete(ctx context.Context, listingID int) error
+		Restore(ctx context.Context, listingID, userID int, within time.Duration) error
+		GetDeleted(ctx context.Context) ([]Listing, error)
+		Purge(ctx context.Context, olderThan time.Duration) (int64, error)
+		SetStatus(ctx context.Context, listingID int, status string) error
+		Expire(ctx context.Context) ([]Listing, error)
+		ExpiryReminders(ctx context.Context, within time.Duration) ([]Listing, error)
 		GetAll(ctx context.Context, listingType string) ([]Listing, error)
+		EachListed(ctx context.Context, listingType string, fn func(Listing) error) error
 		GetByUserID(ctx context.Context, userID int, listingType string) ([]Listing, error)
 		GetByID(ctx context.Context, listingID int) (Listing, error)
 		GetBySearch(ctx context.Context, query string, listingType string) ([]Listing, error)
 		GetByDistance(ctx context.Context, latitude, longitude, maxDistance float64, listingType string) ([]Listing, error)
 		GetByDistanceAndSearch(ctx context.Context, latitude, longitude, maxDistance float64, listingType string, searchQuery string) ([]Listing, error)
-		//QueryByLocation(ctx context.Context, latitude, longitude, maxRange float64, listingType string) ([]Listing, error)
+		GetMapView(ctx context.Context, query MapQuery) (MapView, error)
+		GetByRegion(ctx context.Context, regionID int, listingType string) ([]Listing, error)
 		GetByDateCreatedDescending(ctx context.Context, listingType string) ([]Listing, error)
 		GetByDateCreatedAndSearchDescending(ctx context.Context, query string, listingType string) ([]Listing, error)
 	}
@@ -47,15 +59,153 @@ type Service struct {
 		GetByOfferingUserAndStatus(ctx context.Context, offeringUserID int, status string) ([]Transaction, error)
 		GetByListingAndStatus(ctx context.Context, listingID int, status string) ([]Transaction, error)
 		Update(ctx context.Context, id int, transaction Transaction) error
+		Advance(ctx context.Context, stored, updated Transaction, movement string, feePercent float64) error
 		Delete(ctx context.Context, transactionID int) error
+		Restore(ctx context.Context, transactionID, userID int, within time.Duration) error
+		GetDeleted(ctx context.Context) ([]Transaction, error)
+		Purge(ctx context.Context, olderThan time.Duration) (int64, error)
+		Counterparties(ctx context.Context, userID int) ([]int, error)
+		Rating(ctx context.Context, userID int) (Rating, error)
+	}
+	Notifications interface {
+		Create(ctx context.Context, notification *Notification) error
+		GetByUser(ctx context.Context, userID int, unreadOnly bool) ([]Notification, error)
+		MarkRead(ctx context.Context, notificationID, userID int) error
+	}
+	SavedSearches interface {
+		Create(ctx context.Context, search *SavedSearch) (SavedSearch, error)
+		GetByID(ctx context.Context, searchID int) (SavedSearch, error)
+		GetByUser(ctx context.Context, userID int) ([]SavedSearch, error)
+		Update(ctx context.Context, search *SavedSearch) error
+		Delete(ctx context.Context, searchID int) error
+		GetMatches(ctx context.Context, searchID int) ([]Listing, error)
+		Match(ctx context.Context) ([]SearchMatch, error)
+		Digests(ctx context.Context, every time.Duration) ([]SearchDigest, error)
+	}
+	Favourites interface {
+		Add(ctx context.Context, userID, shortlistID int, kind string, targetID int) error
+		Remove(ctx context.Context, userID, shortlistID int, kind string, targetID int) error
+		Items(ctx context.Context, userID, shortlistID int) ([]ShortlistItem, error)
+		ListingCounts(ctx context.Context, ownerID int) (map[int]int, error)
+		CreateShortlist(ctx context.Context, shortlist *Shortlist) (Shortlist, error)
+		GetShortlist(ctx context.Context, shortlistID int) (Shortlist, error)
+		GetShortlists(ctx context.Context, userID int) ([]Shortlist, error)
+		RenameShortlist(ctx context.Context, shortlistID int, name string) error
+		DeleteShortlist(ctx context.Context, shortlistID int) error
+	}
+	ServiceAreas interface {
+		Create(ctx context.Context, area *ServiceArea) (ServiceArea, error)
+		GetByID(ctx context.Context, areaID int) (ServiceArea, error)
+		GetByUser(ctx context.Context, userID int) ([]ServiceArea, error)
+		Delete(ctx context.Context, areaID int) error
+		UsersServing(ctx context.Context, latitude, longitude float64) ([]int, error)
+	}
+	Regions interface {
+		Seed(ctx context.Context, entries []GazetteerEntry) (int, error)
+		GetByID(ctx context.Context, regionID int) (Region, error)
+		GetByLevel(ctx context.Context, level string) ([]Region, error)
+		GetChildren(ctx context.Context, regionID int) ([]Region, error)
+		Locate(ctx context.Context, latitude, longitude float64) ([]Region, error)
+		AssignMissing(ctx context.Context) (int64, error)
+	}
+	Payments interface {
+		Hold(ctx context.Context, transaction Transaction, feePercent float64) (Payment, error)
+		Release(ctx context.Context, transactionID int) (Payment, error)
+		ReleasePart(ctx context.Context, transactionID int, amount float64) (Payment, error)
+		Refund(ctx context.Context, transactionID int) (Payment, error)
+		GetByTransaction(ctx context.Context, transactionID int) (Payment, error)
+		Balances(ctx context.Context) ([]LedgerBalance, error)
+	}
+	Milestones interface {
+		Set(ctx context.Context, transaction Transaction, milestones []Milestone) ([]Milestone, error)
+		GetByTransaction(ctx context.Context, transactionID int) ([]Milestone, error)
+		GetByID(ctx context.Context, milestoneID int) (Milestone, error)
+		MarkDone(ctx context.Context, milestoneID int, evidence []string) (Milestone, error)
+		Approve(ctx context.Context, milestoneID int) (Milestone, error)
+	}
+	ExchangeRates interface {
+		Set(ctx context.Context, rate ExchangeRate) (ExchangeRate, error)
+		GetAll(ctx context.Context) ([]ExchangeRate, error)
+		Delete(ctx context.Context, from, to string) error
+		Quote(ctx context.Context, from, to string) (ExchangeRate, error)
+		Record(ctx context.Context, transactionID int, rates []ExchangeRate) ([]ExchangeRate, error)
+		GetRecorded(ctx context.Context, transactionID int) ([]ExchangeRate, error)
+	}
+	Invoices interface {
+		Issue(ctx context.Context, invoice Invoice) (Invoice, error)
+		GetByID(ctx context.Context, invoiceID int) (Invoice, error)
+		GetByTransaction(ctx context.Context, transactionID int) (Invoice, error)
+		GetByTradesman(ctx context.Context, tradesmanID int, from, to string) ([]Invoice, error)
+	}
+	Subscriptions interface {
+		Get(ctx context.Context, userID int) (Subscription, error)
+		GetAll(ctx context.Context) ([]Subscription, error)
+		Change(ctx context.Context, userID int, plan string) (Subscription, error)
+		Renew(ctx context.Context) (renewed, ended []Subscription, err error)
+		GetCharges(ctx context.Context, userID int) ([]SubscriptionCharge, error)
+	}
+	Promotions interface {
+		Create(ctx context.Context, promotion Promotion) (Promotion, error)
+		GetByID(ctx context.Context, promotionID int) (Promotion, error)
+		GetByUser(ctx context.Context, userID int) ([]Promotion, error)
+		GetDays(ctx context.Context, promotionID int) ([]PromotionDay, error)
+		Cancel(ctx context.Context, promotionID int) (Promotion, error)
+		Serve(ctx context.Context, search PromotionSearch, rules PromotionRules, slots int, at time.Time) ([]Listing, error)
+		Click(ctx context.Context, promotionID int, token string, rules PromotionRules, at time.Time) error
+		Settle(ctx context.Context, at time.Time) ([]Promotion, error)
+	}
+	Analytics interface {
+		Record(ctx context.Context, events []AnalyticsEvent) error
+		Rollup(ctx context.Context, before time.Time) (int, error)
+		GetDays(ctx context.Context, userID int, from, to string) ([]AnalyticsDay, error)
+		GetListings(ctx context.Context, userID int, from, to string) ([]ListingAnalytics, error)
+		GetFunnel(ctx context.Context, userID int, from, to string) (Funnel, error)
+		GetRevenue(ctx context.Context, userID int, from, to string) ([]MonthlyRevenue, error)
+	}
+	APIClients interface {
+		Create(ctx context.Context, client APIClient) (APIClient, error)
+		GetByID(ctx context.Context, clientID int) (APIClient, error)
+		GetByUser(ctx context.Context, userID int) ([]APIClient, error)
+		GetAll(ctx context.Context) ([]APIClient, error)
+		Rotate(ctx context.Context, clientID int) (APIClient, error)
+		Revoke(ctx context.Context, clientID int) error
+		SetLimits(ctx context.Context, clientID int, limits APILimits) (APIClient, error)
+		Authenticate(ctx context.Context, key string) (APIClient, error)
+		Meter(ctx context.Context, clientID int, day string, quota int) (bool, error)
+		GetUsage(ctx context.Context, clientID int, from, to string) ([]APIUsage, error)
+	}
+	Matching interface {
+		SuggestTradesmen(ctx context.Context, requestID int, options MatchOptions) ([]Suggestion, error)
+		JobsFor(ctx context.Context, userID int, options MatchOptions) ([]Suggestion, error)
 	}
 }
 
-func ServiceDB(db *sql.DB) Service {
-	return Service{
-		Users:        &UserService{db: db},
-		Listings:     &ListingService{db: db},
-		Images:       &ImageService{db: db},
-		Transactions: &TransactionService{db: db},
+// ServiceDB returns a Service backed by a SQL database of any supported dialect.
+// geocode resolves the city and country stored with users and listings, payments
+// moves the money of transactions and plans, and rates quotes the exchange rates
+// not set by admins, or none when nil.
+func ServiceDB(db *Database.DB, geocode GeocodeFunc, payments Payments.Provider, rates Rates.Provider) Service {
+	listings := &ListingService{db: db, geocode: geocode}
+	escrow := &PaymentService{db: db, provider: payments}
+	service := Service{
+		Users:         &UserService{db: db, geocode: geocode},
+		Listings:      listings,
+		Images:        &ImageService{db: db},
+		Transactions:  &TransactionService{db: db, payments: escrow},
+		Notifications: &NotificationService{db: db},
+		SavedSearches: &SavedSearchService{db: db, listings: listings},
+		Favourites:    &FavouriteService{db: db},
+		ServiceAreas:  &ServiceAreaService{db: db},
+		Regions:       &RegionService{db: db},
+		Payments:      escrow,
+		Milestones:    &MilestoneService{db: db, payments: escrow},
+		Invoices:      &InvoiceService{db: db},
+		ExchangeRates: &ExchangeRateService{db: db, provider: rates},
+		Subscriptions: &SubscriptionService{db: db, provider: payments},
+		Promotions:    &PromotionService{db: db, provider: payments, listings: listings},
+		Analytics:     &AnalyticsService{db: db},
+		APIClients:    &APIClientService{db: db},
 	}
+	service.Matching = &MatchingService{listings: service.Listings, transactions: service.Transactions, rates: service.ExchangeRates}
+	return service
 }
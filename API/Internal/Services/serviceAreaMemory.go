@@ -0,0 +1,98 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	geo "github.com/paulmach/go.geo"
+)
+
+// ServiceAreaMemory is the in-memory implementation of the ServiceAreas interface
+type ServiceAreaMemory struct {
+	store *memoryStore
+}
+
+// Create stores a service area drawn as a polygon or copied from a named district
+func (s *ServiceAreaMemory) Create(ctx context.Context, area *ServiceArea) (ServiceArea, error) {
+	if err := area.prepare(); err != nil {
+		return ServiceArea{}, err
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	count := 0
+	for _, stored := range s.store.serviceAreas {
+		if stored.UserID == area.UserID {
+			count++
+		}
+	}
+	if count >= maxServiceAreas {
+		return ServiceArea{}, Invalid("service_area", fmt.Sprintf("a user may have at most %d service areas", maxServiceAreas))
+	}
+
+	s.store.nextServiceAreaID++
+	created := *area
+	created.AreaID = s.store.nextServiceAreaID
+	created.Polygon = append(Polygon{}, area.Polygon...)
+	created.DateCreated = now()
+	s.store.serviceAreas[created.AreaID] = created
+	return created, nil
+}
+
+// GetByID returns a service area
+func (s *ServiceAreaMemory) GetByID(ctx context.Context, areaID int) (ServiceArea, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	area, ok := s.store.serviceAreas[areaID]
+	if !ok {
+		return ServiceArea{}, fmt.Errorf("service area %w", ErrNotFound)
+	}
+	return area, nil
+}
+
+// GetByUser returns a user's service areas in the order they were created
+func (s *ServiceAreaMemory) GetByUser(ctx context.Context, userID int) ([]ServiceArea, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	areas := []ServiceArea{}
+	for _, id := range sortedKeys(s.store.serviceAreas) {
+		if area := s.store.serviceAreas[id]; area.UserID == userID {
+			areas = append(areas, area)
+		}
+	}
+	return areas, nil
+}
+
+// Delete removes a service area
+func (s *ServiceAreaMemory) Delete(ctx context.Context, areaID int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if _, ok := s.store.serviceAreas[areaID]; !ok {
+		return fmt.Errorf("service area %w", ErrNotFound)
+	}
+	delete(s.store.serviceAreas, areaID)
+	return nil
+}
+
+// UsersServing returns, in ID order, the users with a service area containing a point
+func (s *ServiceAreaMemory) UsersServing(ctx context.Context, latitude, longitude float64) ([]int, error) {
+	return sortedKeys(s.store.usersServing(latitude, longitude)), nil
+}
+
+// usersServing returns the users with a service area containing a point
+func (m *memoryStore) usersServing(latitude, longitude float64) map[int]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	point := geo.NewPoint(longitude, latitude)
+	serving := map[int]bool{}
+	for _, area := range m.serviceAreas {
+		if area.Polygon.Contains(point) {
+			serving[area.UserID] = true
+		}
+	}
+	return serving
+}
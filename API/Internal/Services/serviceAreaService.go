@@ -0,0 +1,249 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	geo "github.com/paulmach/go.geo"
+	"strings"
+)
+
+// Limits on service areas, keeping the containment checks of every radius search cheap
+const (
+	maxServiceAreas  = 20
+	maxPolygonPoints = 500
+	minPolygonPoints = 4
+)
+
+// Polygon is a simple polygon given by its outer ring of [longitude, latitude] points.
+// The ring is closed automatically when its last point differs from the first.
+type Polygon [][2]float64
+
+// normalize closes the ring and rejects polygons that are too small, too detailed or off the map
+func (p *Polygon) normalize() error {
+	ring := *p
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+	if len(ring) < minPolygonPoints {
+		return Invalid("polygon", "needs at least 3 distinct points")
+	}
+	if len(ring) > maxPolygonPoints {
+		return Invalid("polygon", fmt.Sprintf("must have at most %d points", maxPolygonPoints))
+	}
+	for _, point := range ring {
+		if point[0] < -180 || point[0] > 180 || point[1] < -90 || point[1] > 90 {
+			return Invalid("polygon", "points must be [longitude, latitude] within -180..180 and -90..90")
+		}
+	}
+	*p = ring
+	return nil
+}
+
+// Contains reports whether a point lies inside the polygon, by casting a ray eastwards
+// and counting the edges it crosses. Points exactly on an edge may fall either way.
+func (p Polygon) Contains(point *geo.Point) bool {
+	if point == nil {
+		return false
+	}
+	x, y := point.Lng(), point.Lat()
+	inside := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		a, b := p[i], p[j]
+		if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Scan reads a polygon selected with Dialect.Polygon
+func (p *Polygon) Scan(value interface{}) error {
+	data, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into a polygon", value)
+	}
+	ring, err := Database.ParsePolygonWKB(data)
+	if err != nil {
+		return err
+	}
+	*p = ring
+	return nil
+}
+
+// ServiceArea is an area a tradesman works in. Radius searches also return the offers of
+// users whose service area contains the searched point, however far away the offer itself is.
+type ServiceArea struct {
+	// @example 1
+	AreaID int `json:"area_id"`
+
+	// @example 1
+	UserID int `json:"user_id"`
+
+	// Name defaults to the district name for areas created from a district
+	// @example "Greater Beirut"
+	Name string `json:"name" validate:"max=100"`
+
+	// District is the named district the polygon was copied from, if any
+	// @example "Metn"
+	District string `json:"district,omitempty"`
+
+	// Polygon is the outer ring of the area as [longitude, latitude] points
+	// @example [[35.47, 33.86], [35.54, 33.86], [35.54, 33.91], [35.47, 33.91], [35.47, 33.86]]
+	Polygon Polygon `json:"polygon"`
+
+	// @example "2024-12-16 14:30:00"
+	DateCreated string `json:"date_created"`
+}
+
+// prepare fills in an area created from a district and checks its polygon
+func (a *ServiceArea) prepare() error {
+	if a.District != "" {
+		district, ok := DistrictByName(a.District)
+		if !ok {
+			return Invalid("district", fmt.Sprintf("unknown district %q", a.District))
+		}
+		a.District = district.Name
+		a.Polygon = append(Polygon{}, district.Polygon...)
+		if a.Name == "" {
+			a.Name = district.Name
+		}
+	}
+	if strings.TrimSpace(a.Name) == "" {
+		return Invalid("name", "is required")
+	}
+	return a.Polygon.normalize()
+}
+
+// servesPoint reports whether a listing belongs to a user whose service area contains the searched point.
+// Only offers count: a tradesman's area says where they work, not where they want work done.
+func servesPoint(listing Listing, serving map[int]bool) bool {
+	return listing.Type == "Offer" && serving[listing.UserID]
+}
+
+// serviceAreaColumns is the column list every service area query selects, in the order scanServiceAreas reads them
+func serviceAreaColumns(d Database.Dialect) string {
+	return `area_id, user_id, name, district, ` + d.Polygon("area") + `, ` + d.Timestamp("date_created")
+}
+
+// usersServing returns the users with a service area containing a point
+func usersServing(ctx context.Context, db *Database.DB, latitude, longitude float64) (map[int]bool, error) {
+	point := geo.NewPoint(longitude, latitude)
+	serving := map[int]bool{}
+
+	contains, ok := db.Dialect.Contains("area")
+	if !ok {
+		areas, err := scanServiceAreas(ctx, db, `SELECT `+serviceAreaColumns(db.Dialect)+` FROM service_areas`)
+		if err != nil {
+			return nil, err
+		}
+		for _, area := range areas {
+			if area.Polygon.Contains(point) {
+				serving[area.UserID] = true
+			}
+		}
+		return serving, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT user_id FROM service_areas WHERE `+contains, db.Dialect.PointArg(point))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve service areas: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("could not scan service area: %w", err)
+		}
+		serving[userID] = true
+	}
+	return serving, rows.Err()
+}
+
+// scanServiceAreas runs a query selecting serviceAreaColumns
+func scanServiceAreas(ctx context.Context, db *Database.DB, query string, args ...interface{}) ([]ServiceArea, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve service areas: %w", err)
+	}
+	defer rows.Close()
+
+	areas := []ServiceArea{}
+	for rows.Next() {
+		var area ServiceArea
+		if err := rows.Scan(&area.AreaID, &area.UserID, &area.Name, &area.District, &area.Polygon, &area.DateCreated); err != nil {
+			return nil, fmt.Errorf("could not scan service area: %w", err)
+		}
+		areas = append(areas, area)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate over service areas: %w", err)
+	}
+	return areas, nil
+}
+
+type ServiceAreaService struct {
+	db *Database.DB
+}
+
+// Create stores a service area drawn as a polygon or copied from a named district
+func (s *ServiceAreaService) Create(ctx context.Context, area *ServiceArea) (ServiceArea, error) {
+	if err := area.prepare(); err != nil {
+		return ServiceArea{}, err
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM service_areas WHERE user_id = ?`, area.UserID).Scan(&count); err != nil {
+		return ServiceArea{}, fmt.Errorf("could not count service areas: %w", err)
+	}
+	if count >= maxServiceAreas {
+		return ServiceArea{}, Invalid("service_area", fmt.Sprintf("a user may have at most %d service areas", maxServiceAreas))
+	}
+
+	id, err := s.db.InsertID(ctx, `INSERT INTO service_areas (user_id, name, district, area) VALUES (?, ?, ?, `+s.db.Dialect.PolygonValue()+`)`,
+		"area_id", area.UserID, area.Name, area.District, Database.PolygonWKB(area.Polygon))
+	if err != nil {
+		return ServiceArea{}, fmt.Errorf("could not create service area: %w", err)
+	}
+	return s.GetByID(ctx, int(id))
+}
+
+// GetByID returns a service area
+func (s *ServiceAreaService) GetByID(ctx context.Context, areaID int) (ServiceArea, error) {
+	areas, err := scanServiceAreas(ctx, s.db, `SELECT `+serviceAreaColumns(s.db.Dialect)+` FROM service_areas WHERE area_id = ?`, areaID)
+	if err != nil {
+		return ServiceArea{}, err
+	}
+	if len(areas) == 0 {
+		return ServiceArea{}, fmt.Errorf("service area %w", ErrNotFound)
+	}
+	return areas[0], nil
+}
+
+// GetByUser returns a user's service areas in the order they were created
+func (s *ServiceAreaService) GetByUser(ctx context.Context, userID int) ([]ServiceArea, error) {
+	return scanServiceAreas(ctx, s.db, `SELECT `+serviceAreaColumns(s.db.Dialect)+` FROM service_areas WHERE user_id = ? ORDER BY area_id`, userID)
+}
+
+// Delete removes a service area
+func (s *ServiceAreaService) Delete(ctx context.Context, areaID int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM service_areas WHERE area_id = ?`, areaID)
+	if err != nil {
+		return fmt.Errorf("could not delete service area: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("service area %w", ErrNotFound)
+	}
+	return nil
+}
+
+// UsersServing returns, in ID order, the users with a service area containing a point
+func (s *ServiceAreaService) UsersServing(ctx context.Context, latitude, longitude float64) ([]int, error) {
+	serving, err := usersServing(ctx, s.db, latitude, longitude)
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(serving), nil
+}
@@ -0,0 +1,159 @@
+package Services
+
+import (
+	"context"
+	"errors"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+)
+
+// SubscriptionMemory is the in-memory implementation of the Subscriptions interface
+type SubscriptionMemory struct {
+	store    *memoryStore
+	provider Payments.Provider
+}
+
+// planOf returns the plan a user is on, free when they have no subscription. The caller holds the lock.
+func (m *memoryStore) planOf(userID int) Plan {
+	plan, _ := PlanByName(m.subscriptions[userID].Plan)
+	return plan
+}
+
+// checkPublishing refuses to publish another of a user's listings when their plan has no room left.
+// The caller holds the lock.
+func (m *memoryStore) checkPublishing(userID int) error {
+	published := 0
+	for _, listing := range m.listings {
+		if listing.UserID == userID && listing.DeletedAt == "" && isListed(listing) {
+			published++
+		}
+	}
+	return checkPublished(m.planOf(userID), published)
+}
+
+// recordCharge keeps what a user paid for a plan. The caller holds the lock.
+func (s *SubscriptionMemory) recordCharge(userID int, plan Plan, amount float64, reference string) {
+	s.store.nextChargeID++
+	s.store.subscriptionCharges = append(s.store.subscriptionCharges, SubscriptionCharge{
+		ChargeID: s.store.nextChargeID, UserID: userID, Plan: plan.Name, Amount: amount, Currency: plan.Currency,
+		Provider: s.provider.Name(), Reference: reference, DateCreated: now(),
+	})
+}
+
+// Get returns a user's subscription, the free plan when they have none
+func (s *SubscriptionMemory) Get(ctx context.Context, userID int) (Subscription, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	if subscription, ok := s.store.subscriptions[userID]; ok {
+		return subscription.withEntitlements(), nil
+	}
+	return freeSubscription(userID), nil
+}
+
+// GetAll returns the subscriptions to paid plans, by user
+func (s *SubscriptionMemory) GetAll(ctx context.Context) ([]Subscription, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	subscriptions := []Subscription{}
+	for _, userID := range sortedKeys(s.store.subscriptions) {
+		subscriptions = append(subscriptions, s.store.subscriptions[userID].withEntitlements())
+	}
+	return subscriptions, nil
+}
+
+// Change moves a user to another plan. Upgrades are charged and apply at once, downgrades
+// wait for the end of the period, and choosing the current plan again cancels a downgrade.
+func (s *SubscriptionMemory) Change(ctx context.Context, userID int, name string) (Subscription, error) {
+	target, ok := PlanByName(name)
+	if !ok {
+		return Subscription{}, Invalid("plan", "must be one of free, pro, business")
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, subscribed := s.store.subscriptions[userID]
+	if !subscribed {
+		stored = freeSubscription(userID)
+	}
+	current := s.store.planOf(userID)
+	if target.Name == current.Name {
+		stored.NextPlan = ""
+		if subscribed {
+			s.store.subscriptions[userID] = stored
+		}
+		return stored.withEntitlements(), nil
+	}
+
+	change := changePlan(current, target, -age(stored.PeriodEnd))
+	if !change.now {
+		stored.NextPlan = target.Name
+		s.store.subscriptions[userID] = stored
+		return stored.withEntitlements(), nil
+	}
+	if change.charge > 0 {
+		reference, err := chargePlan(ctx, s.provider, userID, target, change.charge)
+		if err != nil {
+			return Subscription{}, err
+		}
+		s.recordCharge(userID, target, change.charge, reference)
+	}
+	if change.renew {
+		stored.PeriodStart, stored.PeriodEnd = now(), fromNow(periodLength(target))
+	}
+	stored.Plan, stored.NextPlan = target.Name, ""
+	s.store.subscriptions[userID] = stored
+	return stored.withEntitlements(), nil
+}
+
+// Renew charges the subscriptions whose period is over for another one, on their next plan
+// if they chose one. Those moving to the free plan, or whose charge is declined, end.
+// It returns the renewed subscriptions as they are now and the ended ones as they were.
+func (s *SubscriptionMemory) Renew(ctx context.Context) ([]Subscription, []Subscription, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	renewed, ended := []Subscription{}, []Subscription{}
+	for _, userID := range sortedKeys(s.store.subscriptions) {
+		stored := s.store.subscriptions[userID]
+		if age(stored.PeriodEnd) < 0 {
+			continue
+		}
+
+		next, _ := PlanByName(stored.Plan)
+		if stored.NextPlan != "" {
+			next, _ = PlanByName(stored.NextPlan)
+		}
+		if next.Price > 0 {
+			reference, err := chargePlan(ctx, s.provider, userID, next, next.Price)
+			if err == nil {
+				s.recordCharge(userID, next, next.Price, reference)
+				stored = Subscription{UserID: userID, Plan: next.Name, PeriodStart: now(), PeriodEnd: fromNow(periodLength(next))}
+				s.store.subscriptions[userID] = stored
+				renewed = append(renewed, stored.withEntitlements())
+				continue
+			}
+			if !errors.Is(err, ErrPaymentFailed) {
+				return renewed, ended, err
+			}
+		}
+		delete(s.store.subscriptions, userID)
+		ended = append(ended, stored.withEntitlements())
+	}
+	return renewed, ended, nil
+}
+
+// GetCharges returns what a user paid for plans, most recent first
+func (s *SubscriptionMemory) GetCharges(ctx context.Context, userID int) ([]SubscriptionCharge, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	charges := []SubscriptionCharge{}
+	for i := len(s.store.subscriptionCharges) - 1; i >= 0; i-- {
+		if charge := s.store.subscriptionCharges[i]; charge.UserID == userID {
+			charges = append(charges, charge)
+		}
+	}
+	return charges, nil
+}
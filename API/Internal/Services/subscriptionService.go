@@ -0,0 +1,243 @@
+package Services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"time"
+)
+
+type SubscriptionService struct {
+	db       *Database.DB
+	provider Payments.Provider
+}
+
+// subscriptionColumns is the column list the subscription queries select, in the order scanSubscription reads them
+func subscriptionColumns(d Database.Dialect) string {
+	return `user_id, plan, next_plan, ` + d.Timestamp("period_start") + `, ` + d.Timestamp("period_end")
+}
+
+// scanSubscription reads a row selected with subscriptionColumns
+func scanSubscription(row interface{ Scan(...interface{}) error }) (Subscription, error) {
+	var subscription Subscription
+	err := row.Scan(&subscription.UserID, &subscription.Plan, &subscription.NextPlan, &subscription.PeriodStart, &subscription.PeriodEnd)
+	return subscription.withEntitlements(), err
+}
+
+// checkPublishing refuses to publish another of a user's listings when their plan has no room left
+func checkPublishing(ctx context.Context, db *Database.DB, userID int) error {
+	var name string
+	err := db.QueryRowContext(ctx, `SELECT plan FROM subscriptions WHERE user_id = ?`, userID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("could not retrieve plan: %w", err)
+	}
+	plan, _ := PlanByName(name)
+
+	var published int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM listings WHERE user_id = ? AND `+listed, userID).Scan(&published)
+	if err != nil {
+		return fmt.Errorf("could not count published listings: %w", err)
+	}
+	return checkPublished(plan, published)
+}
+
+// charge takes amount for a plan from the user and records it in tx. The row is written
+// before any money moves, so a failed charge is rolled back with the rest of tx.
+func (s *SubscriptionService) charge(ctx context.Context, tx *Database.Tx, userID int, plan Plan, amount float64) error {
+	id, err := tx.InsertID(ctx, `INSERT INTO subscription_charges (user_id, plan, amount_minor, currency, provider) VALUES (?, ?, ?, ?, ?)`,
+		"charge_id", userID, plan.Name, minorUnits(amount, plan.Currency), plan.Currency, s.provider.Name())
+	if err != nil {
+		return fmt.Errorf("could not record subscription charge: %w", err)
+	}
+
+	reference, err := chargePlan(ctx, s.provider, userID, plan, amount)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE subscription_charges SET reference = ? WHERE charge_id = ?`, reference, id); err != nil {
+		// The charge went through, give it back rather than lose track of it
+		if refundErr := s.provider.Refund(ctx, reference, amount); refundErr != nil {
+			return fmt.Errorf("could not record charge %s, which could not be refunded either (%v): %w", reference, refundErr, err)
+		}
+		return fmt.Errorf("could not record charge: %w", err)
+	}
+	return nil
+}
+
+// Get returns a user's subscription, the free plan when they have none
+func (s *SubscriptionService) Get(ctx context.Context, userID int) (Subscription, error) {
+	subscription, err := scanSubscription(s.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns(s.db.Dialect)+`
+	          FROM subscriptions WHERE user_id = ?`, userID))
+	if err == sql.ErrNoRows {
+		return freeSubscription(userID), nil
+	}
+	if err != nil {
+		return Subscription{}, fmt.Errorf("could not retrieve subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+// GetAll returns the subscriptions to paid plans, by user
+func (s *SubscriptionService) GetAll(ctx context.Context) ([]Subscription, error) {
+	return s.query(ctx, `SELECT `+subscriptionColumns(s.db.Dialect)+` FROM subscriptions ORDER BY user_id`)
+}
+
+// query returns the subscriptions selected with subscriptionColumns
+func (s *SubscriptionService) query(ctx context.Context, query string, args ...interface{}) ([]Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []Subscription{}
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan subscription: %w", err)
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// Change moves a user to another plan. Upgrades are charged and apply at once, downgrades
+// wait for the end of the period, and choosing the current plan again cancels a downgrade.
+func (s *SubscriptionService) Change(ctx context.Context, userID int, name string) (Subscription, error) {
+	target, ok := PlanByName(name)
+	if !ok {
+		return Subscription{}, Invalid("plan", "must be one of free, pro, business")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Subscription{}, err
+	}
+	defer tx.Rollback()
+
+	var stored string
+	var remaining float64
+	err = tx.QueryRowContext(ctx, `SELECT plan, `+s.db.Dialect.Age("period_end")+` FROM subscriptions WHERE user_id = ?`, userID).
+		Scan(&stored, &remaining)
+	if err != nil && err != sql.ErrNoRows {
+		return Subscription{}, fmt.Errorf("could not retrieve subscription: %w", err)
+	}
+	current, _ := PlanByName(stored)
+
+	change := changePlan(current, target, -time.Duration(remaining*float64(time.Second)))
+	switch {
+	case target.Name == current.Name:
+		_, err = tx.ExecContext(ctx, `UPDATE subscriptions SET next_plan = '' WHERE user_id = ?`, userID)
+	case !change.now:
+		_, err = tx.ExecContext(ctx, `UPDATE subscriptions SET next_plan = ? WHERE user_id = ?`, target.Name, userID)
+	case change.renew:
+		if _, err = tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = ?`, userID); err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO subscriptions (user_id, plan, period_end) VALUES (?, ?, `+s.db.Dialect.FromNow()+`)`,
+				userID, target.Name, int64(periodLength(target).Seconds()))
+		}
+	default:
+		_, err = tx.ExecContext(ctx, `UPDATE subscriptions SET plan = ?, next_plan = '' WHERE user_id = ?`, target.Name, userID)
+	}
+	if err != nil {
+		return Subscription{}, fmt.Errorf("could not change plan: %w", err)
+	}
+
+	if target.Name != current.Name && change.charge > 0 {
+		if err := s.charge(ctx, tx, userID, target, change.charge); err != nil {
+			return Subscription{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Subscription{}, err
+	}
+	return s.Get(ctx, userID)
+}
+
+// Renew charges the subscriptions whose period is over for another one, on their next plan
+// if they chose one. Those moving to the free plan, or whose charge is declined, end.
+// It returns the renewed subscriptions as they are now and the ended ones as they were.
+func (s *SubscriptionService) Renew(ctx context.Context) ([]Subscription, []Subscription, error) {
+	due, err := s.query(ctx, `SELECT `+subscriptionColumns(s.db.Dialect)+` FROM subscriptions
+	          WHERE `+s.db.Dialect.Age("period_end")+` >= 0 ORDER BY user_id`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	renewed, ended := []Subscription{}, []Subscription{}
+	for _, subscription := range due {
+		next, _ := PlanByName(subscription.Plan)
+		if subscription.NextPlan != "" {
+			next, _ = PlanByName(subscription.NextPlan)
+		}
+		if next.Price > 0 {
+			err := s.renew(ctx, subscription.UserID, next)
+			if err == nil {
+				current, err := s.Get(ctx, subscription.UserID)
+				if err != nil {
+					return renewed, ended, err
+				}
+				renewed = append(renewed, current)
+				continue
+			}
+			if errors.Is(err, ErrConflict) {
+				continue
+			}
+			if !errors.Is(err, ErrPaymentFailed) {
+				return renewed, ended, err
+			}
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = ?`, subscription.UserID); err != nil {
+			return renewed, ended, fmt.Errorf("could not end subscription: %w", err)
+		}
+		ended = append(ended, subscription)
+	}
+	return renewed, ended, nil
+}
+
+// renew charges a user for another period on plan
+func (s *SubscriptionService) renew(ctx context.Context, userID int, plan Plan) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The period guard keeps two renewals from charging the same period twice
+	result, err := tx.ExecContext(ctx, `UPDATE subscriptions SET plan = ?, next_plan = '', period_start = CURRENT_TIMESTAMP, period_end = `+s.db.Dialect.FromNow()+`
+	          WHERE user_id = ? AND `+s.db.Dialect.Age("period_end")+` >= 0`, plan.Name, int64(periodLength(plan).Seconds()), userID)
+	if err != nil {
+		return fmt.Errorf("could not renew subscription: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("subscription changed while renewing it: %w", ErrConflict)
+	}
+	if err := s.charge(ctx, tx, userID, plan, plan.Price); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetCharges returns what a user paid for plans, most recent first
+func (s *SubscriptionService) GetCharges(ctx context.Context, userID int) ([]SubscriptionCharge, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT charge_id, user_id, plan, amount_minor, currency, provider, reference, `+s.db.Dialect.Timestamp("date_created")+`
+	          FROM subscription_charges WHERE user_id = ? ORDER BY charge_id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve subscription charges: %w", err)
+	}
+	defer rows.Close()
+
+	charges := []SubscriptionCharge{}
+	for rows.Next() {
+		var charge SubscriptionCharge
+		var amount int64
+		if err := rows.Scan(&charge.ChargeID, &charge.UserID, &charge.Plan, &amount, &charge.Currency, &charge.Provider, &charge.Reference, &charge.DateCreated); err != nil {
+			return nil, fmt.Errorf("could not scan subscription charge: %w", err)
+		}
+		charge.Amount = majorUnits(amount, charge.Currency)
+		charges = append(charges, charge)
+	}
+	return charges, rows.Err()
+}
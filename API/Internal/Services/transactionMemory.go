@@ -0,0 +1,246 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TransactionMemory is the in-memory implementation of the Transactions interface
+type TransactionMemory struct {
+	store    *memoryStore
+	payments *PaymentMemory
+}
+
+// matchesStatus applies the optional Pending/Accepted/Completed/Cancelled filter
+func matchesStatus(transaction Transaction, status string) bool {
+	if status == "Pending" || status == "Accepted" || status == "Completed" || status == "Cancelled" {
+		return transaction.Status == status
+	}
+	return true
+}
+
+// filter returns the transactions that are not deleted and match keep, in ID order
+func (t *TransactionMemory) filter(keep func(Transaction) bool) []Transaction {
+	return t.filterAll(func(tr Transaction) bool { return tr.DeletedAt == "" && keep(tr) })
+}
+
+// filterAll is filter including deleted transactions
+func (t *TransactionMemory) filterAll(keep func(Transaction) bool) []Transaction {
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+
+	transactions := []Transaction{}
+	for _, id := range sortedKeys(t.store.transactions) {
+		transaction := t.store.transactions[id]
+		if keep(transaction) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions
+}
+
+// Create stores a new pending transaction.
+func (t *TransactionMemory) Create(ctx context.Context, transaction *Transaction) (Transaction, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	t.store.nextTransactionID++
+	created := *transaction
+	created.TransactionID = t.store.nextTransactionID
+	created.DateCreated = now()
+	created.DetailsFromOffering = ""
+	created.Status = "Pending"
+	created.CurrencyCode = CurrencyOrDefault(created.CurrencyCode)
+	t.store.transactions[created.TransactionID] = created
+
+	return created, nil
+}
+
+// GetByID returns a single transaction.
+func (t *TransactionMemory) GetByID(ctx context.Context, transactionID int) (Transaction, error) {
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+
+	transaction, ok := t.store.transactions[transactionID]
+	if !ok || transaction.DeletedAt != "" {
+		return Transaction{}, fmt.Errorf("transaction %w", ErrNotFound)
+	}
+	return transaction, nil
+}
+
+// GetByOfferedUserAndStatus returns the transactions offered to a user.
+func (t *TransactionMemory) GetByOfferedUserAndStatus(ctx context.Context, offeredUserID int, status string) ([]Transaction, error) {
+	return t.filter(func(tr Transaction) bool { return tr.UserOfferedID == offeredUserID && matchesStatus(tr, status) }), nil
+}
+
+// GetByOfferingUserAndStatus returns the transactions a user is offering.
+func (t *TransactionMemory) GetByOfferingUserAndStatus(ctx context.Context, offeringUserID int, status string) ([]Transaction, error) {
+	return t.filter(func(tr Transaction) bool { return tr.UserOfferingID == offeringUserID && matchesStatus(tr, status) }), nil
+}
+
+// GetByListingAndStatus returns the transactions on a listing.
+func (t *TransactionMemory) GetByListingAndStatus(ctx context.Context, listingID int, status string) ([]Transaction, error) {
+	return t.filter(func(tr Transaction) bool { return tr.ListingID == listingID && matchesStatus(tr, status) }), nil
+}
+
+// Update replaces a transaction's editable fields.
+func (t *TransactionMemory) Update(ctx context.Context, id int, transaction Transaction) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	stored, ok := t.store.transactions[id]
+	if !ok || stored.DeletedAt != "" {
+		return nil
+	}
+	stored.UserOfferedID = transaction.UserOfferedID
+	stored.UserOfferingID = transaction.UserOfferingID
+	stored.ListingID = transaction.ListingID
+	stored.Price = transaction.Price
+	stored.CurrencyCode = transaction.CurrencyCode
+	stored.JobStartDate = transaction.JobStartDate
+	stored.JobEndDate = transaction.JobEndDate
+	stored.DetailsFromOffered = transaction.DetailsFromOffered
+	stored.DetailsFromOffering = transaction.DetailsFromOffering
+	stored.Status = transaction.Status
+	stored.Rating = transaction.Rating
+	t.store.transactions[id] = stored
+	return nil
+}
+
+// Advance moves a transaction from the status and rating it was read with to those of updated, and
+// moves its deposit under the same lock. A transaction changed since it was read is a conflict.
+func (t *TransactionMemory) Advance(ctx context.Context, stored, updated Transaction, movement string, feePercent float64) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	current, ok := t.store.transactions[stored.TransactionID]
+	if !ok || current.DeletedAt != "" || current.Status != stored.Status || current.Rating != stored.Rating {
+		return fmt.Errorf("transaction changed while updating it: %w", ErrConflict)
+	}
+
+	var err error
+	switch movement {
+	case MovementHold:
+		var deposit Payment
+		if deposit, err = newPayment(stored, feePercent); err == nil {
+			_, err = t.payments.holdLocked(ctx, deposit)
+		}
+	case MovementRelease, MovementRefund:
+		_, err = t.payments.settleLocked(stored.TransactionID, movement, 0, t.payments.mover(ctx, movement))
+	}
+	if err != nil {
+		return err
+	}
+
+	current.Status = updated.Status
+	current.Rating = updated.Rating
+	t.store.transactions[stored.TransactionID] = current
+	return nil
+}
+
+// Delete hides a transaction until it is restored or purged.
+func (t *TransactionMemory) Delete(ctx context.Context, transactionID int) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	stored, ok := t.store.transactions[transactionID]
+	if !ok || stored.DeletedAt != "" {
+		return fmt.Errorf("transaction %w", ErrNotFound)
+	}
+	stored.DeletedAt = now()
+	t.store.transactions[transactionID] = stored
+	return nil
+}
+
+// Restore undoes the deletion of a transaction by one of its parties within the grace period.
+func (t *TransactionMemory) Restore(ctx context.Context, transactionID, userID int, within time.Duration) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	stored, ok := t.store.transactions[transactionID]
+	if !ok || (stored.UserOfferedID != userID && stored.UserOfferingID != userID) || stored.DeletedAt == "" || age(stored.DeletedAt) >= within {
+		return fmt.Errorf("deleted transaction %w", ErrNotFound)
+	}
+	stored.DeletedAt = ""
+	t.store.transactions[transactionID] = stored
+	return nil
+}
+
+// GetDeleted returns the deleted transactions, most recently deleted first.
+func (t *TransactionMemory) GetDeleted(ctx context.Context) ([]Transaction, error) {
+	transactions := t.filterAll(func(tr Transaction) bool { return tr.DeletedAt != "" })
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if transactions[i].DeletedAt == transactions[j].DeletedAt {
+			return transactions[i].TransactionID > transactions[j].TransactionID
+		}
+		return transactions[i].DeletedAt > transactions[j].DeletedAt
+	})
+	return transactions, nil
+}
+
+// Purge removes the transactions deleted more than olderThan ago.
+func (t *TransactionMemory) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	var purged int64
+	var urls []string
+	for id, transaction := range t.store.transactions {
+		if transaction.DeletedAt != "" && age(transaction.DeletedAt) >= olderThan {
+			delete(t.store.transactions, id)
+			purged++
+		}
+	}
+	// Milestones go with their transaction, and so do the photos of their evidence
+	for id, milestone := range t.store.milestones {
+		if _, ok := t.store.transactions[milestone.TransactionID]; !ok {
+			urls = append(urls, milestone.Evidence...)
+			delete(t.store.milestones, id)
+		}
+	}
+	for id := range t.store.transactionRates {
+		if _, ok := t.store.transactions[id]; !ok {
+			delete(t.store.transactionRates, id)
+		}
+	}
+	return purged, removeImageFiles(urls)
+}
+
+// Counterparties returns the IDs of the users sharing an Accepted transaction with userID.
+// Only the tradesman accepts the client's offer, so both of them agreed to it.
+func (t *TransactionMemory) Counterparties(ctx context.Context, userID int) ([]int, error) {
+	seen := map[int]bool{}
+	var ids []int
+	for _, transaction := range t.filter(func(transaction Transaction) bool { return transaction.Status == "Accepted" }) {
+		other := 0
+		switch userID {
+		case transaction.UserOfferedID:
+			other = transaction.UserOfferingID
+		case transaction.UserOfferingID:
+			other = transaction.UserOfferedID
+		}
+		if other != 0 && !seen[other] {
+			seen[other] = true
+			ids = append(ids, other)
+		}
+	}
+	return ids, nil
+}
+
+// Rating averages the ratings userID received on completed transactions.
+func (t *TransactionMemory) Rating(ctx context.Context, userID int) (Rating, error) {
+	var rating Rating
+	total := 0
+	for _, transaction := range t.filter(func(transaction Transaction) bool {
+		return transaction.UserOfferingID == userID && transaction.Status == "Completed" && transaction.Rating != 0
+	}) {
+		total += transaction.Rating
+		rating.Count++
+	}
+	if rating.Count > 0 {
+		rating.Average = float64(total) / float64(rating.Count)
+	}
+	return rating, nil
+}
@@ -3,8 +3,10 @@ package Services
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"slices"
+	"time"
 )
 
 // Transaction represents a transaction between users for a listing
@@ -16,23 +18,24 @@ type Transaction struct {
 
 	// UserOfferedID is the user ID of the person offering the transaction
 	// @example 1
-	UserOfferedID int `json:"user_offered_id"`
+	UserOfferedID int `json:"user_offered_id" validate:"required"`
 
 	// UserOfferingID is the user ID of the person requesting the transaction
 	// @example 2
-	UserOfferingID int `json:"user_offering_id"`
+	UserOfferingID int `json:"user_offering_id" validate:"required"`
 
 	// ListingID is the ID of the listing associated with the transaction
 	// @example 101
-	ListingID int `json:"listing_id"`
+	ListingID int `json:"listing_id" validate:"required"`
 
-	// Price is the price of the transaction, in the specified currency
+	// Price is the price of the transaction in major units of its currency, with no more
+	// decimals than the currency has. It is stored in minor units, e.g. cents.
 	// @example 100.50
-	Price float64 `json:"price_with_currency"`
+	Price float64 `json:"price_with_currency" validate:"min=0,money=currency_code"`
 
-	// CurrencyCode is the currency code used for the transaction
+	// CurrencyCode is the ISO 4217 code of the transaction's currency, USD when omitted
 	// @example "USD"
-	CurrencyCode string `json:"currency_code"`
+	CurrencyCode string `json:"currency_code" validate:"omitempty,currency"`
 
 	// DateCreated is the date when the transaction was created
 	// Format: "2006-01-02 15:04:05"
@@ -42,28 +45,64 @@ type Transaction struct {
 	// JobStartDate is the date when the job is scheduled to start
 	// Format: "2006-01-02"
 	// @example "2024-12-20"
-	JobStartDate string `json:"job_start_date"`
+	JobStartDate string `json:"job_start_date" validate:"required,date"`
 
 	// JobEndDate is the date when the job is scheduled to end
 	// Format: "2006-01-02"
 	// @example "2024-12-25"
-	JobEndDate string `json:"job_end_date"`
+	JobEndDate string `json:"job_end_date" validate:"required,notbefore=job_start_date"`
 
 	// DetailsFromOffered are the details provided by the user offering the transaction
 	// @example "The work will be completed in two phases."
-	DetailsFromOffered string `json:"details_from_offered"`
+	DetailsFromOffered string `json:"details_from_offered" validate:"max=1000"`
 
 	// DetailsFromOffering are the details provided by the user requesting the transaction
 	// @example "Please ensure to finish the job before the end of the week."
-	DetailsFromOffering string `json:"details_from_offering"`
+	DetailsFromOffering string `json:"details_from_offering" validate:"max=1000"`
 
-	// Status is the current status of the transaction (e.g., pending, completed, etc.)
-	// @example "pending"
-	Status string `json:"status"`
+	// Status is the current status of the transaction: Pending, Accepted, Completed or Cancelled.
+	// Accepting holds the price in escrow, completing releases it and cancelling refunds it.
+	// @example "Pending"
+	Status string `json:"status" validate:"omitempty,oneof=Pending Accepted Completed Cancelled"`
+
+	// Rating is the offered user's 1 to 5 rating of the offering user, given once the job is Completed
+	// @example 5
+	Rating int `json:"rating,omitempty" validate:"omitempty,min=1,max=5"`
+
+	// DeletedAt is only set on deleted transactions, which are hidden until restored or purged
+	// @example "2024-12-16 14:30:00"
+	DeletedAt string `json:"deleted_at,omitempty"`
+
+	// Display is the price in the viewer's currency, asked with ?currency= or preferred on
+	// their profile, at the rate recorded on acceptance when there is one. It is not stored.
+	Display *ConvertedAmount `json:"display,omitempty"`
+}
+
+// transactionTransitions lists the statuses a transaction may move to from each status.
+// Completed and Cancelled are final. Setting the current status again is always allowed.
+var transactionTransitions = map[string][]string{
+	"Pending":  {"Accepted", "Cancelled"},
+	"Accepted": {"Completed", "Cancelled"},
+}
+
+// CheckTransition returns ErrConflict unless a transaction may move from one status to another
+func CheckTransition(from, to string) error {
+	if from == to || slices.Contains(transactionTransitions[from], to) {
+		return nil
+	}
+	return fmt.Errorf("a %s transaction cannot become %s: %w", from, to, ErrConflict)
+}
+
+// transactionColumns is the column list every transaction query selects, in the order queryTransaction scans them
+func transactionColumns(d Database.Dialect) string {
+	return `transaction_id, user_offered_id, user_offering_id, listing_id, price_minor, ` + d.Timestamp("date_created") + `,
+	` + d.Date("job_start_date") + `, ` + d.Date("job_end_date") + `, details_from_offered, details_from_offering, currency, status, COALESCE(rating, 0),
+	COALESCE(` + d.Timestamp("deleted_at") + `, '')`
 }
 
 type TransactionService struct {
-	db *sql.DB
+	db       *Database.DB
+	payments *PaymentService
 }
 
 // Reusable function to query transactions based on different conditions
@@ -78,12 +117,14 @@ func (t *TransactionService) queryTransaction(ctx context.Context, query string,
 
 	for rows.Next() {
 		var transaction Transaction
+		var price int64
 		if err := rows.Scan(&transaction.TransactionID, &transaction.UserOfferedID, &transaction.UserOfferingID,
-			&transaction.ListingID, &transaction.Price, &transaction.DateCreated, &transaction.JobStartDate,
+			&transaction.ListingID, &price, &transaction.DateCreated, &transaction.JobStartDate,
 			&transaction.JobEndDate, &transaction.DetailsFromOffered, &transaction.DetailsFromOffering,
-			&transaction.CurrencyCode, &transaction.Status); err != nil {
+			&transaction.CurrencyCode, &transaction.Status, &transaction.Rating, &transaction.DeletedAt); err != nil {
 			return nil, fmt.Errorf("could not scan transaction: %v", err)
 		}
+		transaction.Price = majorUnits(price, transaction.CurrencyCode)
 		transactions = append(transactions, transaction)
 	}
 	if err := rows.Err(); err != nil {
@@ -98,48 +139,44 @@ func (t *TransactionService) queryTransaction(ctx context.Context, query string,
 func (t *TransactionService) Create(ctx context.Context, transaction *Transaction) (Transaction, error) {
 
 	query := `INSERT INTO transactions (user_offered_id, user_offering_id, listing_id, 
-                          price, job_start_date, job_end_date, details_from_offered, 
+                          price_minor, job_start_date, job_end_date, details_from_offered, 
                           currency) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-	result, err := t.db.ExecContext(ctx, query, transaction.UserOfferedID, transaction.UserOfferingID,
-		transaction.ListingID, transaction.Price, transaction.JobStartDate, transaction.JobEndDate,
+	transactionID, err := t.db.InsertID(ctx, query, "transaction_id", transaction.UserOfferedID, transaction.UserOfferingID,
+		transaction.ListingID, minorUnits(transaction.Price, transaction.CurrencyCode), transaction.JobStartDate, transaction.JobEndDate,
 		transaction.DetailsFromOffered, transaction.CurrencyCode)
 
 	if err != nil {
 		return Transaction{}, fmt.Errorf("could not create transaction: %w", err)
 	}
 
-	_, err = result.LastInsertId()
-	if err != nil {
-		return Transaction{}, fmt.Errorf("could not get last insert ID: %w", err)
-	}
-
-	return Transaction{}, nil
+	// Return the stored row so callers see defaults such as status and date_created
+	return t.GetByID(ctx, int(transactionID))
 }
 
 func (t *TransactionService) GetByID(ctx context.Context, transactionID int) (Transaction, error) {
-	query := `SELECT * FROM transactions WHERE transaction_id = ?`
+	query := `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND transaction_id = ?`
 
 	transactions, err := t.queryTransaction(ctx, query, transactionID)
 	if err != nil {
 		return Transaction{}, fmt.Errorf("could not retrieve transaction by ID: %w", err)
 	}
 	if len(transactions) == 0 {
-		return Transaction{}, errors.New("transaction not found")
+		return Transaction{}, fmt.Errorf("transaction %w", ErrNotFound)
 	}
 	return transactions[0], nil
 }
 
 func (t *TransactionService) GetByOfferedUserAndStatus(ctx context.Context, offeredUserID int, status string) ([]Transaction, error) {
-	// Valid statuses: "Pending", "Accepted", "Completed"
+	// Valid statuses: "Pending", "Accepted", "Completed", "Cancelled"
 	var query string
 	var transactions []Transaction
 	var err error
-	if status == "Pending" || status == "Accepted" || status == "Completed" {
-		query = `SELECT * FROM transactions WHERE user_offered_id = ? AND status = ?`
+	if status == "Pending" || status == "Accepted" || status == "Completed" || status == "Cancelled" {
+		query = `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND user_offered_id = ? AND status = ?`
 
 		transactions, err = t.queryTransaction(ctx, query, offeredUserID, status)
 	} else {
-		query = `SELECT * FROM transactions WHERE user_offered_id = ?`
+		query = `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND user_offered_id = ?`
 		transactions, err = t.queryTransaction(ctx, query, offeredUserID)
 	}
 
@@ -150,16 +187,16 @@ func (t *TransactionService) GetByOfferedUserAndStatus(ctx context.Context, offe
 }
 
 func (t *TransactionService) GetByOfferingUserAndStatus(ctx context.Context, offeringUserID int, status string) ([]Transaction, error) {
-	// Valid statuses: "Pending", "Accepted", "Completed"
+	// Valid statuses: "Pending", "Accepted", "Completed", "Cancelled"
 	var query string
 	var transactions []Transaction
 	var err error
-	if status == "Pending" || status == "Accepted" || status == "Completed" {
-		query = `SELECT * FROM transactions WHERE user_offering_id = ? AND status = ?`
+	if status == "Pending" || status == "Accepted" || status == "Completed" || status == "Cancelled" {
+		query = `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND user_offering_id = ? AND status = ?`
 
 		transactions, err = t.queryTransaction(ctx, query, offeringUserID, status)
 	} else {
-		query = `SELECT * FROM transactions WHERE user_offering_id = ?`
+		query = `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND user_offering_id = ?`
 
 		transactions, err = t.queryTransaction(ctx, query, offeringUserID)
 	}
@@ -170,16 +207,16 @@ func (t *TransactionService) GetByOfferingUserAndStatus(ctx context.Context, off
 }
 
 func (t *TransactionService) GetByListingAndStatus(ctx context.Context, listingID int, status string) ([]Transaction, error) {
-	// Valid statuses: "Pending", "Accepted", "Completed"
+	// Valid statuses: "Pending", "Accepted", "Completed", "Cancelled"
 	var query string
 	var transactions []Transaction
 	var err error
-	if status == "Pending" || status == "Accepted" || status == "Completed" {
-		query = `SELECT * FROM transactions WHERE listing_id = ? AND status = ?`
+	if status == "Pending" || status == "Accepted" || status == "Completed" || status == "Cancelled" {
+		query = `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND listing_id = ? AND status = ?`
 
 		transactions, err = t.queryTransaction(ctx, query, listingID, status)
 	} else {
-		query = `SELECT * FROM transactions WHERE listing_id = ?`
+		query = `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NULL AND listing_id = ?`
 
 		transactions, err = t.queryTransaction(ctx, query, listingID)
 	}
@@ -190,8 +227,9 @@ func (t *TransactionService) GetByListingAndStatus(ctx context.Context, listingI
 	return transactions, nil
 }
 
+// Delete hides a transaction until one of its parties restores it or the purge job removes it
 func (t *TransactionService) Delete(ctx context.Context, transactionID int) error {
-	query := "DELETE FROM transactions WHERE transaction_id = ?"
+	query := `UPDATE transactions SET deleted_at = CURRENT_TIMESTAMP WHERE transaction_id = ? AND deleted_at IS NULL`
 
 	result, err := t.db.ExecContext(ctx, query, transactionID)
 	if err != nil {
@@ -203,7 +241,7 @@ func (t *TransactionService) Delete(ctx context.Context, transactionID int) erro
 		return fmt.Errorf("could not check rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return errors.New("no transaction found to delete")
+		return fmt.Errorf("transaction %w", ErrNotFound)
 	}
 
 	return nil
@@ -214,26 +252,28 @@ func (t *TransactionService) Update(ctx context.Context, id int, transaction Tra
               SET user_offered_id = ?, 
                   user_offering_id = ?, 
                   listing_id = ?, 
-                  price = ?, 
+                  price_minor = ?, 
                   currency = ?, 
                   job_start_date = ?, 
                   job_end_date = ?, 
                   details_from_offered = ?, 
                   details_from_offering = ?, 
-                  status = ?
-              WHERE transaction_id = ?`
+                  status = ?,
+                  rating = ?
+              WHERE transaction_id = ? AND deleted_at IS NULL`
 
 	_, err := t.db.ExecContext(ctx, query,
 		transaction.UserOfferedID,
 		transaction.UserOfferingID,
 		transaction.ListingID,
-		transaction.Price,
+		minorUnits(transaction.Price, transaction.CurrencyCode),
 		transaction.CurrencyCode,
 		transaction.JobStartDate,
 		transaction.JobEndDate,
 		transaction.DetailsFromOffered,
 		transaction.DetailsFromOffering,
 		transaction.Status,
+		sql.NullInt64{Int64: int64(transaction.Rating), Valid: transaction.Rating != 0},
 		id,
 	)
 
@@ -242,3 +282,166 @@ func (t *TransactionService) Update(ctx context.Context, id int, transaction Tra
 	}
 	return nil
 }
+
+// Advance moves a transaction from the status and rating it was read with to those of updated, and
+// moves its deposit in the same step: MovementHold charges the client, MovementRelease pays the
+// tradesman and MovementRefund pays the client back, while no movement leaves the money alone.
+// The guard on the stored status and rating turns a concurrent change into a conflict, so money
+// only moves once, and the provider is called last so a refused payment changes nothing.
+func (t *TransactionService) Advance(ctx context.Context, stored, updated Transaction, movement string, feePercent float64) error {
+	// Work the movement out before the transaction, which holds the only connection on SQLite
+	var deposit Payment
+	var release settlement
+	var err error
+	switch movement {
+	case MovementHold:
+		deposit, err = newPayment(stored, feePercent)
+	case MovementRelease, MovementRefund:
+		release, err = t.payments.plan(ctx, stored.TransactionID, movement, 0, t.payments.mover(ctx, movement))
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE transactions SET status = ?, rating = ?
+	          WHERE transaction_id = ? AND deleted_at IS NULL AND status = ? AND COALESCE(rating, 0) = ?`,
+		updated.Status, sql.NullInt64{Int64: int64(updated.Rating), Valid: updated.Rating != 0},
+		stored.TransactionID, stored.Status, stored.Rating)
+	if err != nil {
+		return fmt.Errorf("could not update transaction with ID %d: %w", stored.TransactionID, err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return fmt.Errorf("transaction changed while updating it: %w", ErrConflict)
+	}
+
+	switch movement {
+	case MovementHold:
+		return t.payments.hold(ctx, tx, deposit)
+	case MovementRelease, MovementRefund:
+		if err := t.payments.apply(ctx, tx, release); err != nil {
+			return err
+		}
+		return commitSettlement(tx, release)
+	}
+	return tx.Commit()
+}
+
+// Counterparties returns the IDs of the users sharing an Accepted transaction with userID.
+// Only the tradesman accepts the client's offer, so both of them agreed to it.
+func (t *TransactionService) Counterparties(ctx context.Context, userID int) ([]int, error) {
+	query := `SELECT user_offering_id FROM transactions WHERE deleted_at IS NULL AND user_offered_id = ? AND status = 'Accepted'
+	          UNION
+	          SELECT user_offered_id FROM transactions WHERE deleted_at IS NULL AND user_offering_id = ? AND status = 'Accepted'`
+
+	rows, err := t.db.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve counterparties: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("could not scan counterparty: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Rating averages the ratings userID received on completed transactions
+func (t *TransactionService) Rating(ctx context.Context, userID int) (Rating, error) {
+	query := `SELECT COALESCE(AVG(rating), 0), COUNT(rating) FROM transactions
+	          WHERE deleted_at IS NULL AND user_offering_id = ? AND status = 'Completed' AND rating IS NOT NULL`
+
+	var rating Rating
+	if err := t.db.QueryRowContext(ctx, query, userID).Scan(&rating.Average, &rating.Count); err != nil {
+		return Rating{}, fmt.Errorf("could not compute rating for user ID %d: %w", userID, err)
+	}
+	return rating, nil
+}
+
+// Restore undoes the deletion of a transaction by one of its parties, provided it was deleted less than within ago.
+// Transactions of other users, or deleted too long ago, are reported as not found.
+func (t *TransactionService) Restore(ctx context.Context, transactionID, userID int, within time.Duration) error {
+	query := `UPDATE transactions SET deleted_at = NULL
+	          WHERE transaction_id = ? AND (user_offered_id = ? OR user_offering_id = ?)
+	          AND deleted_at IS NOT NULL AND ` + t.db.Dialect.Age("deleted_at") + ` < ?`
+	result, err := t.db.ExecContext(ctx, query, transactionID, userID, userID, within.Seconds())
+	if err != nil {
+		return fmt.Errorf("could not restore transaction: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("deleted transaction %w", ErrNotFound)
+	}
+	return nil
+}
+
+// GetDeleted returns the deleted transactions that have not been purged yet, most recently deleted first
+func (t *TransactionService) GetDeleted(ctx context.Context) ([]Transaction, error) {
+	query := `SELECT ` + transactionColumns(t.db.Dialect) + ` FROM transactions WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, transaction_id DESC`
+	return t.queryTransaction(ctx, query)
+}
+
+// Purge permanently removes the transactions deleted more than olderThan ago, with their
+// milestones, the photos of their evidence and the exchange rates recorded for them
+func (t *TransactionService) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	due := `deleted_at IS NOT NULL AND ` + t.db.Dialect.Age("deleted_at") + ` >= ?`
+	milestones := `SELECT milestone_id FROM milestones WHERE transaction_id IN (SELECT transaction_id FROM transactions WHERE ` + due + `)`
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT url FROM milestone_evidence WHERE milestone_id IN (`+milestones+`)`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("could not list milestone evidence: %w", err)
+	}
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not scan milestone evidence: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	rows.Close()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM milestone_evidence WHERE milestone_id IN (`+milestones+`)`, olderThan.Seconds()); err != nil {
+		return 0, fmt.Errorf("could not delete milestone evidence: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM milestones WHERE transaction_id IN (SELECT transaction_id FROM transactions WHERE `+due+`)`, olderThan.Seconds()); err != nil {
+		return 0, fmt.Errorf("could not delete milestones: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM transaction_rates WHERE transaction_id IN (SELECT transaction_id FROM transactions WHERE `+due+`)`, olderThan.Seconds()); err != nil {
+		return 0, fmt.Errorf("could not delete exchange rates: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM transactions WHERE `+due, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("could not purge transactions: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return purged, removeImageFiles(urls)
+}
@@ -0,0 +1,236 @@
+package Services
+
+import (
+	"context"
+	"fmt"
+	auth "github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserMemory is the in-memory implementation of the Users interface
+type UserMemory struct {
+	store *memoryStore
+}
+
+// GetAll returns every open account in ID order.
+func (s *UserMemory) GetAll(ctx context.Context) ([]User, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	users := []User{}
+	for _, id := range sortedKeys(s.store.users) {
+		if dbUser := s.store.users[id]; dbUser.DeletedAt == "" {
+			users = append(users, mapDBUserToUser(dbUser))
+		}
+	}
+	return users, nil
+}
+
+// GetById returns the user with the given ID.
+func (s *UserMemory) GetById(ctx context.Context, id int) (User, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	dbUser, ok := s.store.users[id]
+	if !ok {
+		return User{}, fmt.Errorf("user %w", ErrNotFound)
+	}
+	return mapDBUserToUser(dbUser), nil
+}
+
+// GetByName returns users whose first or last name contains the given text.
+func (s *UserMemory) GetByName(ctx context.Context, name string) ([]User, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	var users []User
+	for _, id := range sortedKeys(s.store.users) {
+		dbUser := s.store.users[id]
+		if dbUser.DeletedAt == "" && (containsFold(dbUser.FirstName, name) || containsFold(dbUser.LastName, name)) {
+			users = append(users, mapDBUserToUser(dbUser))
+		}
+	}
+	return users, nil
+}
+
+// Create stores a new user with a hashed password and a unique phone number.
+func (s *UserMemory) Create(ctx context.Context, user *User) error {
+	city, country, err := s.store.reverseGeocode(user.Location.Lat(), user.Location.Lng(), user.LocDetails.City, user.LocDetails.Country)
+	if err != nil {
+		return err
+	}
+	user.LocDetails.City = city
+	user.LocDetails.Country = country
+	user.LocDetails.RegionID = s.store.locateRegion(user.Location)
+
+	hashedPassword, err := auth.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	for _, existing := range s.store.users {
+		if existing.PhoneNumber == user.PhoneNumber {
+			return fmt.Errorf("phone number %w", ErrConflict)
+		}
+	}
+
+	s.store.nextUserID++
+	user.UserID = s.store.nextUserID
+	if user.ImageId == "" {
+		user.ImageId = "0"
+	}
+
+	dbUser := mapUserToDBUser(*user)
+	dbUser.Password = hashedPassword
+	dbUser.Role = RoleUser
+	s.store.users[dbUser.UserID] = dbUser
+
+	*user = mapDBUserToUser(dbUser)
+	return nil
+}
+
+// Update replaces a user's stored information.
+func (s *UserMemory) Update(ctx context.Context, user *User) error {
+	city, country, err := s.store.reverseGeocode(user.Location.Lat(), user.Location.Lng(), user.LocDetails.City, user.LocDetails.Country)
+	if err != nil {
+		return err
+	}
+	user.LocDetails.City = city
+	user.LocDetails.Country = country
+	user.LocDetails.RegionID = s.store.locateRegion(user.Location)
+
+	hashedPassword, err := auth.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.users[user.UserID]
+	if !ok || stored.DeletedAt != "" {
+		return nil
+	}
+
+	dbUser := mapUserToDBUser(*user)
+	dbUser.Password = hashedPassword
+	dbUser.Role = stored.Role
+	s.store.users[user.UserID] = dbUser
+	return nil
+}
+
+// Close anonymises an account, closes its listings and deletes its images.
+func (s *UserMemory) Close(ctx context.Context, userID int) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if stored, ok := s.store.users[userID]; !ok || stored.DeletedAt != "" {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	tombstone := closedUser(userID)
+	tombstone.DeletedAt = now()
+	s.store.users[userID] = tombstone
+
+	for id, listing := range s.store.listings {
+		if listing.UserID == userID {
+			listing.Active = false
+			listing.Status = ListingClosed
+			s.store.listings[id] = listing
+		}
+	}
+
+	for id, search := range s.store.savedSearches {
+		if search.UserID == userID {
+			delete(s.store.savedSearches, id)
+			delete(s.store.searchMatches, id)
+			delete(s.store.searchDigests, id)
+		}
+	}
+
+	for id, favourite := range s.store.favourites {
+		if favourite.userID == userID {
+			delete(s.store.favourites, id)
+		}
+	}
+	for id, shortlist := range s.store.shortlists {
+		if shortlist.UserID == userID {
+			delete(s.store.shortlists, id)
+		}
+	}
+	for id, area := range s.store.serviceAreas {
+		if area.UserID == userID {
+			delete(s.store.serviceAreas, id)
+		}
+	}
+	delete(s.store.subscriptions, userID)
+
+	var urls []string
+	for id, image := range s.store.images {
+		if image.UserID == userID {
+			urls = append(urls, image.URL)
+			delete(s.store.images, id)
+		}
+	}
+	return removeImageFiles(urls)
+}
+
+// SetRole grants or revokes admin rights.
+func (s *UserMemory) SetRole(ctx context.Context, userID int, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return Invalid("role", "must be one of user, admin")
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	stored, ok := s.store.users[userID]
+	if !ok || stored.DeletedAt != "" {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	stored.Role = role
+	s.store.users[userID] = stored
+	return nil
+}
+
+// Auth checks the phone number and password and returns a signed JWT for the user.
+func (s *UserMemory) Auth(ctx context.Context, phoneNumber, password string) (string, User, error) {
+	dbUser, ok := s.findByPhoneNumber(phoneNumber)
+	if !ok {
+		return "", User{}, fmt.Errorf("incorrect phone number or password: %w", ErrUnauthorized)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(password)); err != nil {
+		return "", User{}, fmt.Errorf("incorrect phone number or password: %w", ErrUnauthorized)
+	}
+
+	token, err := newToken(dbUser.UserID, phoneNumber, dbUser.Role)
+	if err != nil {
+		return "", User{}, err
+	}
+	return token, mapDBUserToUser(dbUser), nil
+}
+
+// GetByPhoneNumber returns the user registered with the given phone number.
+func (s *UserMemory) GetByPhoneNumber(ctx context.Context, phoneNumber string) (User, error) {
+	dbUser, ok := s.findByPhoneNumber(phoneNumber)
+	if !ok {
+		return User{}, fmt.Errorf("user %w", ErrNotFound)
+	}
+	return mapDBUserToUser(dbUser), nil
+}
+
+func (s *UserMemory) findByPhoneNumber(phoneNumber string) (DBUser, bool) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	for _, dbUser := range s.store.users {
+		if dbUser.PhoneNumber == phoneNumber && dbUser.DeletedAt == "" {
+			return dbUser, true
+		}
+	}
+	return DBUser{}, false
+}
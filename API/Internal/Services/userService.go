@@ -3,10 +3,10 @@ package Services
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"fmt"
 	auth "github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Auth"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
-	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/paulmach/go.geo"
 	"golang.org/x/crypto/bcrypt"
@@ -23,43 +23,67 @@ type User struct {
 
 	// FirstName is the user's first name
 	// @example "John"
-	FirstName string `json:"first_name"`
+	FirstName string `json:"first_name" validate:"required,max=50"`
 
 	// LastName is the user's last name
 	// @example "Doe"
-	LastName string `json:"last_name"`
+	LastName string `json:"last_name" validate:"required,max=50"`
 
 	// PhoneNumber is the user's phone number
 	// @example "+1234567890"
-	PhoneNumber string `json:"phone_number"`
+	PhoneNumber string `json:"phone_number" validate:"required,phone"`
 
 	// DateOfBirth is the user's date of birth
 	// @example "1990-01-01"
-	DateOfBirth string `json:"date_of_birth"`
+	DateOfBirth string `json:"date_of_birth" validate:"required,date"`
 
 	// Profession is the user's profession
 	// @example "Software Developer"
-	Profession string `json:"profession"`
+	Profession string `json:"profession" validate:"max=100"`
 
 	// Location is the user's geographical location represented as longitude and latitude
 	// @example {"latitude": 34.0522, "longitude": -118.2437}
-	Location *geo.Point `json:"location"`
+	Location *geo.Point `json:"location" validate:"coordinates"`
 
 	// LocDetails contains additional address information for the user's location
 	LocDetails Address `json:"loc_details"`
 
 	// Password is the user's password (ensure it is encrypted or hashed when stored)
 	// @example "secretpassword"
-	Password string `json:"password"`
+	Password string `json:"password" validate:"required,min=6,max=72"`
 
 	// ImageId is the ID of the user's profile image
 	// @example "image_12345"
 	ImageId string `json:"image_id"`
+
+	// Privacy controls who else sees the phone number, date of birth and exact location
+	Privacy Privacy `json:"privacy"`
+
+	// PreferredCurrency is the ISO 4217 currency amounts are also shown in, when they are in another one
+	// @example "LBP"
+	PreferredCurrency string `json:"preferred_currency,omitempty" validate:"omitempty,currency"`
+
+	// DeletedAt is set once the account is closed and its personal data anonymised
+	// @example "2024-12-16 14:30:00"
+	DeletedAt string `json:"deleted_at,omitempty"`
+
+	// Role is RoleUser or RoleAdmin. It is only changed from the command line, never through the API
+	// @example "user"
+	Role string `json:"role,omitempty"`
 }
 
+// Roles a user can hold; admins may see deleted listings and transactions
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Address struct {
 	City    string `json:"city"`
 	Country string `json:"country"`
+
+	// RegionID is the most specific gazetteer region containing the user's location
+	RegionID int `json:"region_id,omitempty"`
 }
 
 type DBUser struct {
@@ -74,17 +98,30 @@ type DBUser struct {
 	City        string
 	Country     string
 	ImageId     string
+	Privacy     Privacy
+	DeletedAt   string
+	Role        string
+	RegionID    int
+	Currency    string
+}
+
+// userColumns is the column list the user queries select, in the order they scan them
+func userColumns(d Database.Dialect) string {
+	return `user_id, first_name, last_name, phone_number, ` + d.Date("date_of_birth") + `, profession, ` + d.Point("location") + `, city, country, password,
+	phone_visibility, birth_date_visibility, location_visibility, COALESCE(` + d.Timestamp("deleted_at") + `, ''), role, COALESCE(region_id, 0),
+	preferred_currency`
 }
 
 // UserService provides methods to interact with user data.
 type UserService struct {
-	db *sql.DB
+	db      *Database.DB
+	geocode GeocodeFunc
 }
 
 // GetAll retrieves all users from the database, including city and country.
 func (s *UserService) GetAll(ctx context.Context) ([]User, error) {
 	// SQL query to fetch all users, including city and country
-	rows, err := s.db.QueryContext(ctx, "SELECT user_id, first_name, last_name, phone_number, date_of_birth, profession, location, city, country, password, profile_image FROM users")
+	rows, err := s.db.QueryContext(ctx, "SELECT "+userColumns(s.db.Dialect)+", profile_image FROM users WHERE deleted_at IS NULL")
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +133,7 @@ func (s *UserService) GetAll(ctx context.Context) ([]User, error) {
 	for rows.Next() {
 		var dbUser DBUser
 		// Scan the row data into the DBUser struct
-		if err := rows.Scan(&dbUser.UserID, &dbUser.FirstName, &dbUser.LastName, &dbUser.PhoneNumber, &dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.ImageId); err != nil {
+		if err := rows.Scan(&dbUser.UserID, &dbUser.FirstName, &dbUser.LastName, &dbUser.PhoneNumber, &dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.Privacy.PhoneNumber, &dbUser.Privacy.DateOfBirth, &dbUser.Privacy.Location, &dbUser.DeletedAt, &dbUser.Role, &dbUser.RegionID, &dbUser.Currency, &dbUser.ImageId); err != nil {
 			return nil, err
 		}
 
@@ -118,7 +155,7 @@ func (s *UserService) GetAll(ctx context.Context) ([]User, error) {
 // GetById retrieves a user by their ID, including city and country.
 func (s *UserService) GetById(ctx context.Context, id int) (User, error) {
 	// Prepare the query to fetch the user by ID
-	query := `SELECT user_id, first_name, last_name, phone_number, date_of_birth, profession, location, city, country, password, profile_image
+	query := `SELECT ` + userColumns(s.db.Dialect) + `, profile_image
               FROM users WHERE user_id = ?`
 
 	// Execute the query
@@ -129,11 +166,10 @@ func (s *UserService) GetById(ctx context.Context, id int) (User, error) {
 
 	// Scan the result into the dbUser struct
 	err := row.Scan(&dbUser.UserID, &dbUser.FirstName, &dbUser.LastName, &dbUser.PhoneNumber,
-		&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.ImageId)
+		&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.Privacy.PhoneNumber, &dbUser.Privacy.DateOfBirth, &dbUser.Privacy.Location, &dbUser.DeletedAt, &dbUser.Role, &dbUser.RegionID, &dbUser.Currency, &dbUser.ImageId)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// Return a User with zero values if the user doesn't exist
-			return User{}, nil
+			return User{}, fmt.Errorf("user %w", ErrNotFound)
 		}
 		// Return any other errors
 		return User{}, err
@@ -149,9 +185,9 @@ func (s *UserService) GetById(ctx context.Context, id int) (User, error) {
 // GetByName retrieves users by their first or last name, including city and country.
 func (s *UserService) GetByName(ctx context.Context, name string) ([]User, error) {
 	query := `
-        SELECT user_id, first_name, last_name, phone_number, date_of_birth, profession, location, city, country, password, profile_image
+        SELECT ` + userColumns(s.db.Dialect) + `, profile_image
         FROM users
-        WHERE first_name LIKE ? OR last_name LIKE ?`
+        WHERE (first_name ` + s.db.Dialect.Like() + ` ? OR last_name ` + s.db.Dialect.Like() + ` ?) AND deleted_at IS NULL`
 
 	// Use wildcard '%' for partial matching with LIKE
 	namePattern := "%" + name + "%"
@@ -168,7 +204,7 @@ func (s *UserService) GetByName(ctx context.Context, name string) ([]User, error
 	for rows.Next() {
 		var dbUser DBUser
 		err := rows.Scan(&dbUser.UserID, &dbUser.FirstName, &dbUser.LastName, &dbUser.PhoneNumber,
-			&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.ImageId)
+			&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.Privacy.PhoneNumber, &dbUser.Privacy.DateOfBirth, &dbUser.Privacy.Location, &dbUser.DeletedAt, &dbUser.Role, &dbUser.RegionID, &dbUser.Currency, &dbUser.ImageId)
 		if err != nil {
 			return nil, err // Return error if scanning fails
 		}
@@ -189,7 +225,7 @@ func (s *UserService) GetByName(ctx context.Context, name string) ([]User, error
 // Create adds a new user to the database, including city and country.
 func (s *UserService) Create(ctx context.Context, user *User) error {
 	// Perform reverse geocoding to get city and country from the location
-	city, country, err := Utils.ReverseGeocode(user.Location.Lat(), user.Location.Lng())
+	city, country, err := s.geocode(user.Location.Lat(), user.Location.Lng())
 	if err != nil {
 		return err // Return if reverse geocoding fails
 	}
@@ -197,6 +233,9 @@ func (s *UserService) Create(ctx context.Context, user *User) error {
 	// Set the location details in the user struct
 	user.LocDetails.City = city
 	user.LocDetails.Country = country
+	if user.LocDetails.RegionID, err = locateRegion(ctx, s.db, user.Location); err != nil {
+		return err
+	}
 
 	// Hash the user's password before storing it
 	hashedPassword, err := auth.HashPassword(user.Password)
@@ -212,51 +251,135 @@ func (s *UserService) Create(ctx context.Context, user *User) error {
 
 	// Prepare the SQL query to insert a new user, including city and country
 	query := `
-		INSERT INTO users (first_name, last_name, phone_number, date_of_birth, profession, location, city, country, password)
-		VALUES (?, ?, ?, ?, ?, ST_GeomFromText(?), ?, ?, ?)
-	`
-
-	// Convert the location to WKT format
-	locationWKT := user.Location.ToWKT()
+		INSERT INTO users (first_name, last_name, phone_number, date_of_birth, profession, location, city, country, region_id, password,
+		                   phone_visibility, birth_date_visibility, location_visibility, preferred_currency)
+		VALUES (?, ?, ?, ?, ?, ` + s.db.Dialect.PointValue() + `, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	userPn, err := s.GetByPhoneNumber(ctx, user.PhoneNumber)
 
 	if userPn.UserID != 0 {
-		return errors.New("Phone number already exists")
+		return fmt.Errorf("phone number %w", ErrConflict)
 	}
 
 	// Execute the query
-	_, err = s.db.ExecContext(ctx, query, dbUser.FirstName, dbUser.LastName, dbUser.PhoneNumber, dbUser.DateOfBirth, dbUser.Profession, locationWKT, user.LocDetails.City, user.LocDetails.Country, user.Password)
+	userID, err := s.db.InsertID(ctx, query, "user_id", dbUser.FirstName, dbUser.LastName, dbUser.PhoneNumber, dbUser.DateOfBirth, dbUser.Profession, s.db.Dialect.PointArg(user.Location), user.LocDetails.City, user.LocDetails.Country, regionArg(user.LocDetails.RegionID), user.Password,
+		dbUser.Privacy.PhoneNumber, dbUser.Privacy.DateOfBirth, dbUser.Privacy.Location, dbUser.Currency)
 	if err != nil {
 		return err
 	}
 
+	user.UserID = int(userID)
 	var user1 = mapUserToDBUser(*user)
+	user1.Role = RoleUser
 
 	*user = mapDBUserToUser(user1)
 
 	return nil
 }
 
-// Delete removes a user from the database by their ID and returns a boolean to indicate if a user was deleted.
-func (s *UserService) Delete(ctx context.Context, userID int) (bool, error) {
-	// SQL query to delete a user by ID
-	query := `DELETE FROM users WHERE user_id = ?`
+// Close closes an account. The user row is kept so transactions still refer to it,
+// but its personal data is replaced with a tombstone and its password cleared so
+// nobody can sign in. Their listings are closed and their images deleted,
+// records first and files once the changes are committed.
+func (s *UserService) Close(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT url FROM images WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("could not list images: %w", err)
+	}
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return fmt.Errorf("could not scan image: %w", err)
+		}
+		urls = append(urls, url)
+	}
+	rows.Close()
 
-	// Execute the query and get the result
-	result, err := s.db.ExecContext(ctx, query, userID)
+	tombstone := closedUser(userID)
+	query := `
+        UPDATE users
+        SET first_name = ?, last_name = ?, phone_number = ?, date_of_birth = ?, profession = ?, location = ` + s.db.Dialect.PointValue() + `,
+            city = ?, country = ?, region_id = NULL, password = ?, profile_image = ?,
+            phone_visibility = ?, birth_date_visibility = ?, location_visibility = ?, preferred_currency = '', role = ?, deleted_at = CURRENT_TIMESTAMP
+        WHERE user_id = ? AND deleted_at IS NULL`
+	result, err := tx.ExecContext(ctx, query, tombstone.FirstName, tombstone.LastName, tombstone.PhoneNumber, tombstone.DateOfBirth,
+		tombstone.Profession, s.db.Dialect.PointArg(tombstone.Location), tombstone.City, tombstone.Country, tombstone.Password,
+		tombstone.ImageId, tombstone.Privacy.PhoneNumber, tombstone.Privacy.DateOfBirth, tombstone.Privacy.Location, tombstone.Role, userID)
 	if err != nil {
-		return false, err // Return any error that occurs
+		return fmt.Errorf("could not anonymise user: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE listings SET active = ?, status = ? WHERE user_id = ?`, false, ListingClosed, userID); err != nil {
+		return fmt.Errorf("could not close listings: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM images WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("could not delete images: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM saved_searches WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("could not delete saved searches: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM favourites WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("could not delete favourites: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM shortlists WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("could not delete shortlists: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM service_areas WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("could not delete service areas: %w", err)
 	}
+	// Closed accounts are not charged for their plan again
+	if _, err := tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("could not end subscription: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return removeImageFiles(urls)
+}
 
-	// Check the number of rows affected
-	rowsAffected, err := result.RowsAffected()
+// SetRole grants or revokes admin rights. Tokens already issued keep their role until they expire.
+func (s *UserService) SetRole(ctx context.Context, userID int, role string) error {
+	if role != RoleUser && role != RoleAdmin {
+		return Invalid("role", "must be one of user, admin")
+	}
+	result, err := s.db.ExecContext(ctx, `UPDATE users SET role = ? WHERE user_id = ? AND deleted_at IS NULL`, role, userID)
 	if err != nil {
-		return false, err
+		return fmt.Errorf("could not set role: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
 	}
+	return nil
+}
 
-	// Return true if a row was deleted, false otherwise
-	return rowsAffected > 0, nil
+// closedUser is the tombstone that replaces the personal data of a closed account
+func closedUser(userID int) DBUser {
+	return DBUser{
+		UserID:      userID,
+		FirstName:   "Deleted",
+		LastName:    "user",
+		DateOfBirth: "1900-01-01",
+		Location:    geo.NewPoint(0, 0),
+		ImageId:     "0",
+		Privacy:     Privacy{PhoneNumber: VisibilityPrivate, DateOfBirth: VisibilityPrivate, Location: VisibilityPrivate},
+		Role:        RoleUser,
+	}
 }
 
 // Converts DBUser to User, adding location details and hiding the password.
@@ -270,11 +393,17 @@ func mapDBUserToUser(dbUser DBUser) User {
 		Profession:  dbUser.Profession,
 		Location:    dbUser.Location,
 		LocDetails: Address{
-			City:    dbUser.City,
-			Country: dbUser.Country,
+			City:     dbUser.City,
+			Country:  dbUser.Country,
+			RegionID: dbUser.RegionID,
 		},
-		Password: "", // Password should not be exposed when mapping to User
-		ImageId:  dbUser.ImageId,
+		Password:  "", // Password should not be exposed when mapping to User
+		ImageId:   dbUser.ImageId,
+		Privacy:   dbUser.Privacy,
+		DeletedAt: dbUser.DeletedAt,
+		Role:      dbUser.Role,
+
+		PreferredCurrency: dbUser.Currency,
 	}
 }
 
@@ -290,14 +419,17 @@ func mapUserToDBUser(user User) DBUser {
 		Location:    user.Location,
 		City:        user.LocDetails.City,
 		Country:     user.LocDetails.Country,
+		RegionID:    user.LocDetails.RegionID,
 		ImageId:     user.ImageId,
+		Privacy:     user.Privacy.withDefaults(),
+		Currency:    NormaliseCurrency(user.PreferredCurrency),
 	}
 }
 
 // Update modifies an existing user's information in the database.
 func (s *UserService) Update(ctx context.Context, user *User) error {
 	// Reverse geocode the new location to get city and country
-	city, country, err := Utils.ReverseGeocode(user.Location.Lat(), user.Location.Lng())
+	city, country, err := s.geocode(user.Location.Lat(), user.Location.Lng())
 	if err != nil {
 		return err // Return the error if geocoding fails
 	}
@@ -305,6 +437,9 @@ func (s *UserService) Update(ctx context.Context, user *User) error {
 	// Set the retrieved city and country in the user struct
 	user.LocDetails.City = city
 	user.LocDetails.Country = country
+	if user.LocDetails.RegionID, err = locateRegion(ctx, s.db, user.Location); err != nil {
+		return err
+	}
 
 	// Hash the user's password before storing it
 	hashedPassword, err := auth.HashPassword(user.Password)
@@ -321,15 +456,14 @@ func (s *UserService) Update(ctx context.Context, user *User) error {
 	// Prepare the SQL query to update the user's information
 	query := `
         UPDATE users
-        SET first_name = ?, last_name = ?, phone_number = ?, date_of_birth = ?, profession = ?, location = ST_GeomFromText(?), city = ?, country = ?, password = ?, profile_image = ?
-        WHERE user_id = ?
+        SET first_name = ?, last_name = ?, phone_number = ?, date_of_birth = ?, profession = ?, location = ` + s.db.Dialect.PointValue() + `, city = ?, country = ?, region_id = ?, password = ?, profile_image = ?,
+            phone_visibility = ?, birth_date_visibility = ?, location_visibility = ?, preferred_currency = ?
+        WHERE user_id = ? AND deleted_at IS NULL
     `
 
-	// Convert the location to WKT format
-	locationWKT := user.Location.ToWKT()
-
 	// Execute the query
-	_, err = s.db.ExecContext(ctx, query, dbUser.FirstName, dbUser.LastName, dbUser.PhoneNumber, dbUser.DateOfBirth, dbUser.Profession, locationWKT, user.LocDetails.City, user.LocDetails.Country, user.Password, dbUser.ImageId, dbUser.UserID)
+	_, err = s.db.ExecContext(ctx, query, dbUser.FirstName, dbUser.LastName, dbUser.PhoneNumber, dbUser.DateOfBirth, dbUser.Profession, s.db.Dialect.PointArg(user.Location), user.LocDetails.City, user.LocDetails.Country, regionArg(user.LocDetails.RegionID), user.Password, dbUser.ImageId,
+		dbUser.Privacy.PhoneNumber, dbUser.Privacy.DateOfBirth, dbUser.Privacy.Location, dbUser.Currency, dbUser.UserID)
 	if err != nil {
 		return err
 	}
@@ -340,8 +474,9 @@ func (s *UserService) Update(ctx context.Context, user *User) error {
 var jwtKey = []byte(Env.GetString("JWT_KEY", "")) // Replace with your secret key
 
 type Claims struct {
-	UserID      int    `json:"user_id"`      // Add user_id to claims
-	PhoneNumber string `json:"phone_number"` // Keep phone number for authentication
+	UserID      int    `json:"user_id"`        // Add user_id to claims
+	PhoneNumber string `json:"phone_number"`   // Keep phone number for authentication
+	Role        string `json:"role,omitempty"` // Checked by Middleware.AdminOnly
 	jwt.RegisteredClaims
 }
 
@@ -349,8 +484,8 @@ type Claims struct {
 func (s *UserService) Auth(ctx context.Context, phoneNumber, password string) (string, User, error) {
 	// SQL query to retrieve the complete user details with the given phone number
 	query := `
-        SELECT user_id, first_name, last_name, phone_number, date_of_birth, profession, location, city, country, password, profile_image
-        FROM users WHERE phone_number = ?
+        SELECT ` + userColumns(s.db.Dialect) + `, profile_image
+        FROM users WHERE phone_number = ? AND deleted_at IS NULL
     `
 
 	// Prepare the query and scan the results into DBUser
@@ -358,12 +493,12 @@ func (s *UserService) Auth(ctx context.Context, phoneNumber, password string) (s
 	err := s.db.QueryRowContext(ctx, query, phoneNumber).Scan(
 		&dbUser.UserID, &dbUser.FirstName, &dbUser.LastName, &dbUser.PhoneNumber,
 		&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City,
-		&dbUser.Country, &dbUser.Password, &dbUser.ImageId,
+		&dbUser.Country, &dbUser.Password, &dbUser.Privacy.PhoneNumber, &dbUser.Privacy.DateOfBirth, &dbUser.Privacy.Location, &dbUser.DeletedAt, &dbUser.Role, &dbUser.RegionID, &dbUser.Currency, &dbUser.ImageId,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// User not found
-			return "", User{}, errors.New("user not found")
+			return "", User{}, fmt.Errorf("incorrect phone number or password: %w", ErrUnauthorized)
 		}
 		return "", User{}, err
 	}
@@ -372,16 +507,28 @@ func (s *UserService) Auth(ctx context.Context, phoneNumber, password string) (s
 	err = bcrypt.CompareHashAndPassword([]byte(dbUser.Password), []byte(password))
 	if err != nil {
 		// Password does not match
-		return "", User{}, errors.New("incorrect password")
+		return "", User{}, fmt.Errorf("incorrect phone number or password: %w", ErrUnauthorized)
 	}
 
 	// Map DBUser to User struct (excluding the password)
 	user := mapDBUserToUser(dbUser)
 
+	tokenString, err := newToken(dbUser.UserID, phoneNumber, dbUser.Role)
+	if err != nil {
+		return "", User{}, err
+	}
+
+	// Return the JWT token and the complete user struct
+	return tokenString, user, nil
+}
+
+// newToken signs a 24 hour JWT carrying the user's ID, phone number and role
+func newToken(userID int, phoneNumber, role string) (string, error) {
 	// Create JWT Claims with UserID
 	claims := &Claims{
-		UserID:      dbUser.UserID,
+		UserID:      userID,
 		PhoneNumber: phoneNumber,
+		Role:        role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token expiration (24 hours)
 			Issuer:    "MinBya3mili",                                      // Set the issuer (your app's name)
@@ -392,22 +539,19 @@ func (s *UserService) Auth(ctx context.Context, phoneNumber, password string) (s
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign the token with the secret key
-	tokenString, err := token.SignedString(jwtKey)
-	if err != nil {
-		return "", User{}, err
-	}
-
-	// Return the JWT token and the complete user struct
-	return tokenString, user, nil
+	return token.SignedString(jwtKey)
 }
 
 func (s *UserService) GetByPhoneNumber(ctx context.Context, phoneNumber string) (User, error) {
-	query := `SELECT user_id, first_name, last_name, phone_number, date_of_birth, profession, location, city, country, password FROM users WHERE phone_number = ?`
+	query := `SELECT ` + userColumns(s.db.Dialect) + ` FROM users WHERE phone_number = ? AND deleted_at IS NULL`
 	var dbUser DBUser
 	err := s.db.QueryRowContext(ctx, query, phoneNumber).Scan(
 		&dbUser.UserID, &dbUser.FirstName, &dbUser.LastName, &dbUser.PhoneNumber,
-		&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password,
+		&dbUser.DateOfBirth, &dbUser.Profession, &dbUser.Location, &dbUser.City, &dbUser.Country, &dbUser.Password, &dbUser.Privacy.PhoneNumber, &dbUser.Privacy.DateOfBirth, &dbUser.Privacy.Location, &dbUser.DeletedAt, &dbUser.Role, &dbUser.RegionID, &dbUser.Currency,
 	)
+	if err == sql.ErrNoRows {
+		return User{}, fmt.Errorf("user %w", ErrNotFound)
+	}
 	if err != nil {
 		return User{}, err
 	}
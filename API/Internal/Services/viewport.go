@@ -0,0 +1,170 @@
+package Services
+
+import (
+	"fmt"
+	geo "github.com/paulmach/go.geo"
+	"math"
+	"sort"
+)
+
+// MaxZoom is the deepest map zoom level accepted by viewport queries
+const MaxZoom = 22
+
+// clusterCellsPerTile is how many grid cells span a map tile, so a cluster covers roughly 64 of a tile's 256 pixels
+const clusterCellsPerTile = 4
+
+// BoundingBox is the visible area of a map, in degrees
+type BoundingBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// check rejects boxes outside the world or with their corners swapped.
+// Boxes crossing the antimeridian are not supported.
+func (b BoundingBox) check() error {
+	switch {
+	case b.MinLongitude < -180 || b.MaxLongitude > 180:
+		return Invalid("longitude", "must be between -180 and 180")
+	case b.MinLatitude < -90 || b.MaxLatitude > 90:
+		return Invalid("latitude", "must be between -90 and 90")
+	case b.MinLongitude > b.MaxLongitude:
+		return Invalid("max_longitude", "must not be less than min_longitude")
+	case b.MinLatitude > b.MaxLatitude:
+		return Invalid("max_latitude", "must not be less than min_latitude")
+	}
+	return nil
+}
+
+// Contains reports whether a point lies inside the box, edges included
+func (b BoundingBox) Contains(p *geo.Point) bool {
+	return p != nil && p.Lng() >= b.MinLongitude && p.Lng() <= b.MaxLongitude && p.Lat() >= b.MinLatitude && p.Lat() <= b.MaxLatitude
+}
+
+// args are the bound values of a Dialect.Within condition
+func (b BoundingBox) args() []interface{} {
+	return []interface{}{b.MinLongitude, b.MinLatitude, b.MaxLongitude, b.MaxLatitude}
+}
+
+// Cluster is a group of nearby listings shown as one marker
+type Cluster struct {
+	// @example 12
+	Count int `json:"count"`
+
+	// Location is the centroid of the clustered listings
+	Location *geo.Point `json:"location"`
+
+	// Bounds is the box around the clustered listings as min longitude, min latitude,
+	// max longitude, max latitude, for zooming into the cluster
+	// @example [35.48, 33.87, 35.53, 33.91]
+	Bounds [4]float64 `json:"bounds"`
+}
+
+// MapView is what a map shows of a viewport: clusters when zoomed out, listings once zoomed in.
+// Listings that are alone in their cell are returned as listings at every zoom.
+type MapView struct {
+	// @example 9
+	Zoom int `json:"zoom"`
+
+	Clusters []Cluster `json:"clusters"`
+	Listings []Listing `json:"listings"`
+
+	// Truncated is set when the viewport holds more markers than are returned. Zoomed out the
+	// smallest clusters are left out, zoomed in the oldest listings.
+	// @example false
+	Truncated bool `json:"truncated"`
+}
+
+// MapQuery is a map viewport and the listings to show in it
+type MapQuery struct {
+	Box  BoundingBox
+	Zoom int
+
+	// Type is Offer or Request, any other value showing both
+	Type   string
+	Search string
+
+	// ClusterBelow is the zoom level from which listings are returned instead of clusters
+	ClusterBelow int
+
+	// Limit caps the markers, clusters and listings together, that a view returns. 0 means no limit.
+	Limit int
+}
+
+// check rejects boxes outside the world and zoom levels maps do not have
+func (q MapQuery) check() error {
+	if q.Zoom < 0 || q.Zoom > MaxZoom {
+		return Invalid("zoom", fmt.Sprintf("must be between 0 and %d", MaxZoom))
+	}
+	return q.Box.check()
+}
+
+// cellSize is the edge in degrees of the grid cells listings are clustered in at the query's zoom
+func (q MapQuery) cellSize() float64 {
+	return 360 / math.Exp2(float64(q.Zoom)) / clusterCellsPerTile
+}
+
+// capped keeps the first limit markers of a view, clusters before listings
+func (v MapView) capped(limit int) MapView {
+	if limit <= 0 || len(v.Clusters)+len(v.Listings) <= limit {
+		return v
+	}
+	v.Truncated = true
+	if len(v.Clusters) >= limit {
+		v.Clusters, v.Listings = v.Clusters[:limit], []Listing{}
+		return v
+	}
+	v.Listings = v.Listings[:limit-len(v.Clusters)]
+	return v
+}
+
+// ClusterListings groups the listings of a map query into grid cells sized for its zoom level.
+// From ClusterBelow on, or when no two listings share a cell, the listings are returned individually.
+func ClusterListings(listings []Listing, q MapQuery) MapView {
+	view := MapView{Zoom: q.Zoom, Clusters: []Cluster{}, Listings: []Listing{}}
+	if q.Zoom >= q.ClusterBelow {
+		view.Listings = append(view.Listings, listings...)
+		return view.capped(q.Limit)
+	}
+
+	type cell struct{ x, y int }
+	cellSize := q.cellSize()
+	cells := map[cell][]Listing{}
+	var order []cell
+	for _, listing := range listings {
+		if listing.Location == nil {
+			continue
+		}
+		key := cell{int(math.Floor(listing.Location.Lng() / cellSize)), int(math.Floor(listing.Location.Lat() / cellSize))}
+		if _, ok := cells[key]; !ok {
+			order = append(order, key)
+		}
+		cells[key] = append(cells[key], listing)
+	}
+
+	for _, key := range order {
+		members := cells[key]
+		if len(members) == 1 {
+			view.Listings = append(view.Listings, members[0])
+			continue
+		}
+
+		var lng, lat float64
+		bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		for _, listing := range members {
+			lng += listing.Location.Lng()
+			lat += listing.Location.Lat()
+			bounds[0] = math.Min(bounds[0], listing.Location.Lng())
+			bounds[1] = math.Min(bounds[1], listing.Location.Lat())
+			bounds[2] = math.Max(bounds[2], listing.Location.Lng())
+			bounds[3] = math.Max(bounds[3], listing.Location.Lat())
+		}
+		n := float64(len(members))
+		view.Clusters = append(view.Clusters, Cluster{Count: len(members), Location: geo.NewPoint(lng/n, lat/n), Bounds: bounds})
+	}
+
+	// Largest clusters first, so clients that cap markers keep the busiest areas
+	sort.SliceStable(view.Clusters, func(i, j int) bool { return view.Clusters[i].Count > view.Clusters[j].Count })
+	return view.capped(q.Limit)
+}
@@ -0,0 +1,51 @@
+package Utils
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5/middleware"
+	"net/http"
+)
+
+// Problem is an RFC 7807 problem details body.
+// Code is a stable machine-readable identifier clients can switch on.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewProblem builds a problem for the request, carrying the chi request ID
+func NewProblem(r *http.Request, status int, code, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// WriteProblem writes a problem as application/problem+json
+func WriteProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// RespondProblem builds and writes a problem in one call
+func RespondProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, NewProblem(r, status, code, detail))
+}
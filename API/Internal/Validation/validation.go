@@ -0,0 +1,264 @@
+package Validation
+
+import (
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	geo "github.com/paulmach/go.geo"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Rules are declared on payload fields with a `validate` tag, for example
+//
+//	Title string `json:"title" validate:"required,max=255"`
+//
+// Available rules:
+//
+//	required        the field is not empty (non-blank string, non-nil pointer, non-zero number)
+//	omitempty       skip the remaining rules when the field is empty
+//	min=N, max=N    string length in characters, or numeric value
+//	oneof=A B C     the value is one of the space separated options
+//	phone           an international phone number such as +96170123456
+//	date            a date formatted 2006-01-02
+//	notbefore=F     a date that is not before the date in sibling field F (by JSON name)
+//	coordinates     a *geo.Point within longitude [-180, 180] and latitude [-90, 90]
+//	currency        an ISO 4217 currency code such as USD, in any case
+//	money=F         an amount with no more decimals than the currency in sibling field F allows (USD when empty)
+//
+// Fields are reported by their JSON names so clients can map errors onto inputs.
+
+const dateLayout = "2006-01-02"
+
+// PhonePattern is the format the phone rule accepts
+var PhonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// field is the value being checked together with its struct, for rules that compare siblings
+type field struct {
+	value  reflect.Value
+	parent reflect.Value
+}
+
+// rule returns a violation message, or "" when the field passes
+type rule func(f field, param string) string
+
+var rules map[string]rule
+
+func init() {
+	rules = map[string]rule{
+		"required":    required,
+		"min":         minimum,
+		"max":         maximum,
+		"oneof":       oneOf,
+		"phone":       phone,
+		"date":        date,
+		"notbefore":   notBefore,
+		"coordinates": coordinates,
+		"currency":    currency,
+		"money":       money,
+	}
+}
+
+// Struct checks every `validate` tag of v, a struct or pointer to one, and returns
+// all violations at once as a *Services.ValidationError, or nil when v is valid.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []Utils.FieldError
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		structField := valueType.Field(i)
+		tag := structField.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		f := field{value: value.Field(i), parent: value}
+		for _, declared := range strings.Split(tag, ",") {
+			name, param, _ := strings.Cut(declared, "=")
+			if name == "omitempty" {
+				if f.value.IsZero() {
+					break
+				}
+				continue
+			}
+
+			check, ok := rules[name]
+			if !ok {
+				panic(fmt.Sprintf("Validation: unknown rule %q on %s.%s", name, valueType.Name(), structField.Name))
+			}
+			// Report one violation per field, the first rule that fails
+			if message := check(f, param); message != "" {
+				fields = append(fields, Utils.FieldError{Field: jsonName(structField), Message: message})
+				break
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &Services.ValidationError{Fields: fields}
+}
+
+// jsonName returns the name a field has in request bodies
+func jsonName(structField reflect.StructField) string {
+	name, _, _ := strings.Cut(structField.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return structField.Name
+	}
+	return name
+}
+
+// sibling returns the field of the same struct with the given JSON name
+func (f field) sibling(name string) (reflect.Value, bool) {
+	parentType := f.parent.Type()
+	for i := 0; i < parentType.NumField(); i++ {
+		if jsonName(parentType.Field(i)) == name {
+			return f.parent.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func required(f field, _ string) string {
+	if f.value.Kind() == reflect.String && strings.TrimSpace(f.value.String()) == "" {
+		return "is required"
+	}
+	if f.value.IsZero() {
+		return "is required"
+	}
+	return ""
+}
+
+// number returns the field as a float for min/max, and whether it is numeric
+func number(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+func minimum(f field, param string) string {
+	limit, _ := strconv.ParseFloat(param, 64)
+	if f.value.Kind() == reflect.String {
+		if utf8.RuneCountInString(f.value.String()) < int(limit) {
+			return "must be at least " + param + " characters"
+		}
+		return ""
+	}
+	if n, ok := number(f.value); ok && n < limit {
+		return "must be at least " + param
+	}
+	return ""
+}
+
+func maximum(f field, param string) string {
+	limit, _ := strconv.ParseFloat(param, 64)
+	if f.value.Kind() == reflect.String {
+		if utf8.RuneCountInString(f.value.String()) > int(limit) {
+			return "must be at most " + param + " characters"
+		}
+		return ""
+	}
+	if n, ok := number(f.value); ok && n > limit {
+		return "must be at most " + param
+	}
+	return ""
+}
+
+func oneOf(f field, param string) string {
+	options := strings.Fields(param)
+	for _, option := range options {
+		if f.value.String() == option {
+			return ""
+		}
+	}
+	return "must be one of " + strings.Join(options, ", ")
+}
+
+func phone(f field, _ string) string {
+	if !PhonePattern.MatchString(f.value.String()) {
+		return "must be an international phone number such as +96170123456"
+	}
+	return ""
+}
+
+func date(f field, _ string) string {
+	if _, err := time.Parse(dateLayout, f.value.String()); err != nil {
+		return "must be a date formatted YYYY-MM-DD"
+	}
+	return ""
+}
+
+func notBefore(f field, param string) string {
+	other, ok := f.sibling(param)
+	if !ok {
+		panic("Validation: notbefore refers to unknown field " + param)
+	}
+
+	end, err := time.Parse(dateLayout, f.value.String())
+	if err != nil {
+		return "must be a date formatted YYYY-MM-DD"
+	}
+	start, err := time.Parse(dateLayout, other.String())
+	if err != nil {
+		// The other field reports its own format error
+		return ""
+	}
+	if end.Before(start) {
+		return "must not be before " + param
+	}
+	return ""
+}
+
+func currency(f field, _ string) string {
+	if !Services.IsCurrency(Services.NormaliseCurrency(f.value.String())) {
+		return "must be an ISO 4217 currency code such as USD or LBP"
+	}
+	return ""
+}
+
+func money(f field, param string) string {
+	other, ok := f.sibling(param)
+	if !ok {
+		panic("Validation: money refers to unknown field " + param)
+	}
+
+	code := Services.NormaliseCurrency(other.String())
+	if code == "" {
+		code = "USD"
+	}
+	digits, ok := Services.CurrencyDigits(code)
+	if !ok {
+		// The other field reports the unknown currency
+		return ""
+	}
+	scaled := f.value.Float() * math.Pow10(digits)
+	if math.Abs(scaled-math.Round(scaled)) > 1e-6 {
+		return fmt.Sprintf("must have at most %d decimals in %s", digits, code)
+	}
+	return ""
+}
+
+func coordinates(f field, _ string) string {
+	point, ok := f.value.Interface().(*geo.Point)
+	if !ok || point == nil {
+		return "is required"
+	}
+	if point.Lng() < -180 || point.Lng() > 180 || point.Lat() < -90 || point.Lat() > 90 {
+		return "must be [longitude, latitude] with longitude in [-180, 180] and latitude in [-90, 90]"
+	}
+	return ""
+}
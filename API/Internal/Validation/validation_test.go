@@ -0,0 +1,141 @@
+package Validation
+
+import (
+	"errors"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	geo "github.com/paulmach/go.geo"
+	"testing"
+)
+
+// violations returns the field -> message map reported for v
+func violations(t *testing.T, v interface{}) map[string]string {
+	t.Helper()
+	err := Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *Services.ValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, Services.ErrValidation) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	fields := map[string]string{}
+	for _, field := range validationErr.Fields {
+		fields[field.Field] = field.Message
+	}
+	return fields
+}
+
+func validTransaction() Services.Transaction {
+	return Services.Transaction{
+		UserOfferedID:  1,
+		UserOfferingID: 2,
+		ListingID:      3,
+		Price:          150,
+		CurrencyCode:   "USD",
+		JobStartDate:   "2025-01-10",
+		JobEndDate:     "2025-01-20",
+	}
+}
+
+func TestValidPayloadsPass(t *testing.T) {
+	user := Services.User{
+		FirstName:   "Adam",
+		LastName:    "Haddad",
+		PhoneNumber: "+96170123456",
+		DateOfBirth: "1990-05-15",
+		Location:    geo.NewPoint(35.5, 33.9),
+		Password:    "secret",
+	}
+	listing := Services.Listing{
+		Type:        "Offer",
+		Location:    geo.NewPoint(35.5, 33.9),
+		Title:       "Tiling",
+		Description: "Kitchen and bathroom tiling",
+	}
+	transaction := validTransaction()
+
+	for _, v := range []interface{}{&user, &listing, &transaction} {
+		if fields := violations(t, v); fields != nil {
+			t.Fatalf("expected %T to be valid, got %v", v, fields)
+		}
+	}
+}
+
+func TestEveryViolationIsReported(t *testing.T) {
+	fields := violations(t, &Services.User{
+		FirstName:   "  ",
+		PhoneNumber: "call me",
+		DateOfBirth: "15/05/1990",
+		Location:    geo.NewPoint(200, 33.9),
+		Password:    "abc",
+	})
+
+	expected := map[string]string{
+		"first_name":    "is required",
+		"last_name":     "is required",
+		"phone_number":  "must be an international phone number such as +96170123456",
+		"date_of_birth": "must be a date formatted YYYY-MM-DD",
+		"location":      "must be [longitude, latitude] with longitude in [-180, 180] and latitude in [-90, 90]",
+		"password":      "must be at least 6 characters",
+	}
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d violations, got %v", len(expected), fields)
+	}
+	for field, message := range expected {
+		if fields[field] != message {
+			t.Errorf("%s: expected %q, got %q", field, message, fields[field])
+		}
+	}
+}
+
+func TestListingRules(t *testing.T) {
+	fields := violations(t, &Services.Listing{Type: "Sale", Title: "Tiling", Description: "Tiling"})
+	if fields["type"] != "must be one of Request, Offer" || fields["location"] != "is required" || len(fields) != 2 {
+		t.Fatalf("unexpected violations %v", fields)
+	}
+}
+
+func TestTransactionRules(t *testing.T) {
+	transaction := validTransaction()
+	transaction.Price = -1
+	transaction.JobEndDate = "2025-01-09"
+	transaction.Status = "Disputed"
+
+	fields := violations(t, &transaction)
+	if fields["price_with_currency"] != "must be at least 0" ||
+		fields["job_end_date"] != "must not be before job_start_date" ||
+		fields["status"] != "must be one of Pending, Accepted, Completed, Cancelled" ||
+		len(fields) != 3 {
+		t.Fatalf("unexpected violations %v", fields)
+	}
+
+	transaction = validTransaction()
+	transaction.CurrencyCode = "Dollars"
+	if fields := violations(t, &transaction); fields["currency_code"] != "must be an ISO 4217 currency code such as USD or LBP" || len(fields) != 1 {
+		t.Fatalf("unexpected violations %v", fields)
+	}
+
+	// Amounts are limited to the minor unit of their currency
+	for currency, price := range map[string]float64{"USD": 150.505, "JPY": 1500.5, "": 10.001} {
+		transaction = validTransaction()
+		transaction.CurrencyCode, transaction.Price = currency, price
+		if fields := violations(t, &transaction); fields["price_with_currency"] == "" || len(fields) != 1 {
+			t.Fatalf("expected %v %s to be refused, got %v", price, currency, fields)
+		}
+	}
+	for currency, price := range map[string]float64{"usd": 150.5, "JPY": 1500, "KWD": 12.345, "LBP": 8950000} {
+		transaction = validTransaction()
+		transaction.CurrencyCode, transaction.Price = currency, price
+		if fields := violations(t, &transaction); fields != nil {
+			t.Fatalf("expected %v %s to pass, got %v", price, currency, fields)
+		}
+	}
+
+	// Optional fields are only checked when present
+	transaction = validTransaction()
+	transaction.CurrencyCode = ""
+	if fields := violations(t, &transaction); fields != nil {
+		t.Fatalf("expected omitted currency to pass, got %v", fields)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"log"
+	"net/http"
+	"time"
+)
+
+// getDeletedListings handles the admin request to list deleted listings that have not been purged yet.
+func (app *application) getDeletedListings(w http.ResponseWriter, r *http.Request) {
+	listings, err := app.Service.Listings.GetDeleted(r.Context())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(listings)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getDeletedTransactions handles the admin request to list deleted transactions that have not been purged yet.
+func (app *application) getDeletedTransactions(w http.ResponseWriter, r *http.Request) {
+	transactions, err := app.Service.Transactions.GetDeleted(r.Context())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(transactions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// purgeJob permanently removes the listings and transactions deleted longer ago than
+// the retention period. Transactions go first so the listings they held back follow
+// in the same run.
+func (app *application) purgeJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "purge",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			transactions, err := app.Service.Transactions.Purge(ctx, app.config.retention.purgeAfter)
+			if err != nil {
+				return err
+			}
+			listings, err := app.Service.Listings.Purge(ctx, app.config.retention.purgeAfter)
+			if err != nil {
+				return err
+			}
+			if transactions+listings > 0 {
+				log.Printf("purged %d deleted transactions and %d deleted listings", transactions, listings)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// signIn authenticates again, picking up role changes made since the last token
+func (s *testServer) signIn(phoneNumber string) string {
+	s.t.Helper()
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/user/auth", map[string]string{
+		"phone_number": phoneNumber,
+		"password":     "secret",
+	}, "")
+	expectStatus(s.t, rec, http.StatusOK)
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	decode(s.t, rec, &response)
+	return response.Token
+}
+
+func TestDeletedEntitiesForAdmins(t *testing.T) {
+	f := seedTransaction(t)
+	admin, adminToken := f.s.createUser("Admin", "+96170000009")
+
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/transaction/delete/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.tradesToken), http.StatusNoContent)
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/listing/delete/"+strconv.Itoa(f.listing.ListingID), nil, "", f.tradesToken), http.StatusNoContent)
+
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/admin/listings/deleted", nil, "", ""), http.StatusUnauthorized)
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/admin/listings/deleted", nil, "", adminToken), http.StatusForbidden)
+
+	if err := f.s.app.Service.Users.SetRole(context.Background(), admin.UserID, Services.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken = f.s.signIn("+96170000009")
+
+	rec := f.s.do(http.MethodGet, "/api/v1/admin/listings/deleted", nil, "", adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	listings := decodeListings(t, rec)
+	if len(listings) != 1 || listings[0].ListingID != f.listing.ListingID || listings[0].DeletedAt == "" {
+		t.Fatalf("unexpected deleted listings %+v", listings)
+	}
+
+	rec = f.s.do(http.MethodGet, "/api/v1/admin/transactions/deleted", nil, "", adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	transactions := decodeTransactions(t, rec)
+	if len(transactions) != 1 || transactions[0].TransactionID != f.transaction.TransactionID || transactions[0].DeletedAt == "" {
+		t.Fatalf("unexpected deleted transactions %+v", transactions)
+	}
+}
+
+func TestPurgeJob(t *testing.T) {
+	f := seedTransaction(t)
+	ctx := context.Background()
+	f.s.app.config.retention.purgeAfter = 0
+	purge := f.s.app.purgeJob()
+
+	// A deleted listing is kept while a transaction still refers to it
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/listing/delete/"+strconv.Itoa(f.listing.ListingID), nil, "", f.tradesToken), http.StatusNoContent)
+	if err := purge.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if listings, _ := f.s.app.Service.Listings.GetDeleted(ctx); len(listings) != 1 {
+		t.Fatalf("expected the listing to wait for its transaction, got %+v", listings)
+	}
+
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/transaction/delete/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.tradesToken), http.StatusNoContent)
+	if err := purge.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	listings, _ := f.s.app.Service.Listings.GetDeleted(ctx)
+	transactions, _ := f.s.app.Service.Transactions.GetDeleted(ctx)
+	if len(listings) != 0 || len(transactions) != 0 {
+		t.Fatalf("expected everything purged, got %+v and %+v", listings, transactions)
+	}
+
+	// Purged rows cannot be restored
+	expectStatus(t, f.s.do(http.MethodPost, "/api/v1/listing/restore/"+strconv.Itoa(f.listing.ListingID), nil, "", f.tradesToken), http.StatusNotFound)
+}
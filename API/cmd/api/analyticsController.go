@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Events"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"time"
+)
+
+// analyticsBatch is how many buffered events are written to storage at a time
+const analyticsBatch = 500
+
+// newEventCollector buffers analytics events for service to record when the analytics job flushes them
+func newEventCollector(service Services.Service, analytics analyticsConfig) *Events.Collector[Services.AnalyticsEvent] {
+	return Events.NewCollector(analytics.buffer, analyticsBatch, service.Analytics.Record)
+}
+
+// track buffers an analytics event for userID, and listingID if any. It never waits on
+// storage, so requests are not slowed down by it.
+func (app *application) track(kind string, userID, listingID int) {
+	app.events.Add(Services.AnalyticsEvent{Kind: kind, UserID: userID, ListingID: listingID, At: time.Now()})
+}
+
+// trackImpressions counts a search impression for each listing shown in search results
+func (app *application) trackImpressions(listings []Services.Listing) {
+	for _, listing := range listings {
+		app.track(Services.EventSearchImpression, listing.UserID, listing.ListingID)
+	}
+}
+
+// analyticsUser returns the caller if their plan includes analytics
+func (app *application) analyticsUser(r *http.Request) (int, error) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return 0, err
+	}
+	subscription, err := app.Service.Subscriptions.Get(r.Context(), tokenUserID)
+	if err != nil {
+		return 0, err
+	}
+	if !subscription.Entitlements.Analytics {
+		return 0, fmt.Errorf("the %s plan does not include analytics: %w", subscription.Plan, Services.ErrPlanLimit)
+	}
+	return tokenUserID, nil
+}
+
+// writeAnalytics responds with the caller's analytics from get, for the dates in the URL
+func writeAnalytics[T any](app *application, w http.ResponseWriter, r *http.Request, get func(ctx context.Context, userID int, from, to string) (T, error)) {
+	tokenUserID, err := app.analyticsUser(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	analytics, err := get(r.Context(), tokenUserID, chi.URLParam(r, "from"), chi.URLParam(r, "to"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(analytics)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getAnalyticsDays handles the request to get the views, impressions, visits, favourites and inquiries of the caller's listings and profile by day.
+func (app *application) getAnalyticsDays(w http.ResponseWriter, r *http.Request) {
+	writeAnalytics(app, w, r, app.Service.Analytics.GetDays)
+}
+
+// getAnalyticsListings handles the request to get the views, impressions, favourites and inquiries of each of the caller's listings.
+func (app *application) getAnalyticsListings(w http.ResponseWriter, r *http.Request) {
+	writeAnalytics(app, w, r, app.Service.Analytics.GetListings)
+}
+
+// getAnalyticsFunnel handles the request to follow the transactions the caller was offered from offer to completion.
+func (app *application) getAnalyticsFunnel(w http.ResponseWriter, r *http.Request) {
+	writeAnalytics(app, w, r, app.Service.Analytics.GetFunnel)
+}
+
+// getAnalyticsRevenue handles the request to get what the caller was paid out of escrow by month.
+func (app *application) getAnalyticsRevenue(w http.ResponseWriter, r *http.Request) {
+	writeAnalytics(app, w, r, app.Service.Analytics.GetRevenue)
+}
+
+// analyticsJob writes the buffered analytics events to storage
+func (app *application) analyticsJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "analytics",
+		Interval: app.config.analytics.flushEvery,
+		Run: func(ctx context.Context) error {
+			if dropped := app.events.Dropped(); dropped > 0 {
+				log.Printf("dropped %d analytics events with the buffer full", dropped)
+			}
+			_, err := app.events.Flush(ctx)
+			return err
+		},
+	}
+}
+
+// analyticsRollupJob counts the analytics events of past days into daily totals
+func (app *application) analyticsRollupJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "analytics rollup",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			rolled, err := app.Service.Analytics.Rollup(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+			if rolled > 0 {
+				log.Printf("rolled up %d analytics events", rolled)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// analyticsRange is the path suffix covering yesterday to tomorrow, whatever the clock of the backend
+func analyticsRange() string {
+	now := time.Now()
+	return "/" + now.AddDate(0, 0, -1).Format("2006-01-02") + "/" + now.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// flushEvents records the analytics events buffered so far
+func (s *testServer) flushEvents(t *testing.T) {
+	t.Helper()
+	if _, err := s.app.events.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// analyticsDays returns the caller's analytics by day
+func (s *testServer) analyticsDays(t *testing.T, token string) []Services.AnalyticsDay {
+	t.Helper()
+	rec := s.do(http.MethodGet, "/api/v1/analytics/days"+analyticsRange(), nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+
+	var days []Services.AnalyticsDay
+	decode(t, rec, &days)
+	return days
+}
+
+func TestAnalyticsEvents(t *testing.T) {
+	f := seedTransaction(t)
+	s := f.s
+	listingPath := "/api/v1/listing/listingId/" + strconv.Itoa(f.listing.ListingID)
+	profilePath := "/api/v1/user/userId/" + strconv.Itoa(f.tradesman.UserID)
+
+	// Analytics come with the paid plans
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/analytics/days"+analyticsRange(), nil, "", f.tradesToken), http.StatusForbidden)
+	s.changePlan(t, "pro", f.tradesToken)
+
+	// The owner looking at their own listing and profile is not counted
+	expectStatus(t, s.do(http.MethodGet, listingPath, nil, "", f.clientToken), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, listingPath, nil, "", ""), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, listingPath, nil, "", f.tradesToken), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, profilePath, nil, "", f.clientToken), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, profilePath, nil, "", f.tradesToken), http.StatusOK)
+	decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/date/Offer", nil, "", ""))
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/favourite/listing/"+strconv.Itoa(f.listing.ListingID), nil, "", f.clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/favourite/user/"+strconv.Itoa(f.tradesman.UserID), nil, "", f.clientToken), http.StatusNoContent)
+
+	// Nothing is counted until the buffered events are recorded
+	if days := s.analyticsDays(t, f.tradesToken); len(days) != 0 {
+		t.Fatalf("expected no analytics before the flush, got %+v", days)
+	}
+	s.flushEvents(t)
+
+	want := Services.AnalyticsDay{Date: time.Now().Format("2006-01-02"), ListingViews: 2, SearchImpressions: 1, ProfileVisits: 1, Favourites: 2, Inquiries: 1}
+	days := s.analyticsDays(t, f.tradesToken)
+	if len(days) != 1 || days[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, days)
+	}
+
+	rec := s.do(http.MethodGet, "/api/v1/analytics/listings"+analyticsRange(), nil, "", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	var listings []Services.ListingAnalytics
+	decode(t, rec, &listings)
+	if len(listings) != 1 || listings[0].Title != "Tiling" || listings[0].ListingViews != 2 || listings[0].SearchImpressions != 1 ||
+		listings[0].Favourites != 1 || listings[0].Inquiries != 1 {
+		t.Fatalf("unexpected listing analytics %+v", listings)
+	}
+
+	// Rolled up days keep their counts, and later events add to them
+	rolled, err := s.app.Service.Analytics.Rollup(context.Background(), time.Now().AddDate(0, 0, 1))
+	if err != nil || rolled != 7 {
+		t.Fatalf("expected 7 events rolled up, got %d (%v)", rolled, err)
+	}
+	expectStatus(t, s.do(http.MethodGet, listingPath, nil, "", f.clientToken), http.StatusOK)
+	s.flushEvents(t)
+	want.ListingViews = 3
+	if days := s.analyticsDays(t, f.tradesToken); len(days) != 1 || days[0] != want {
+		t.Fatalf("expected %+v after the rollup, got %+v", want, days)
+	}
+
+	// The client's analytics are their own, and their plan does not include them
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/analytics/days"+analyticsRange(), nil, "", f.clientToken), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/analytics/days/2025-02-01/2025-01-01", nil, "", f.tradesToken), http.StatusBadRequest)
+}
+
+func TestAnalyticsFunnelAndRevenue(t *testing.T) {
+	f := seedTransaction(t)
+	s := f.s
+	s.changePlan(t, "pro", f.tradesToken)
+
+	// A second offer is cancelled before the tradesman accepts it
+	rec := s.doJSON(http.MethodPost, "/api/v1/transaction/create", map[string]interface{}{
+		"user_offered_id":     f.client.UserID,
+		"user_offering_id":    f.tradesman.UserID,
+		"listing_id":          f.listing.ListingID,
+		"price_with_currency": 80,
+		"currency_code":       "USD",
+		"job_start_date":      "2025-02-10",
+		"job_end_date":        "2025-02-20",
+	}, f.clientToken)
+	expectStatus(t, rec, http.StatusCreated)
+	cancelled := transactionFixture{s, f.client, f.clientToken, f.tradesman, f.tradesToken, f.listing, Services.Transaction{}}
+	decode(t, rec, &cancelled.transaction)
+	expectStatus(t, cancelled.setStatus("Cancelled"), http.StatusNoContent)
+
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	expectStatus(t, f.setStatus("Completed"), http.StatusNoContent)
+
+	rec = s.do(http.MethodGet, "/api/v1/analytics/funnel"+analyticsRange(), nil, "", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	var funnel Services.Funnel
+	decode(t, rec, &funnel)
+	want := Services.Funnel{Offers: 2, Accepted: 1, Completed: 1, Cancelled: 1, AcceptanceRate: 0.5, CompletionRate: 1}
+	if funnel != want {
+		t.Fatalf("expected %+v, got %+v", want, funnel)
+	}
+
+	// The client made no offers to themselves
+	s.changePlan(t, "pro", f.clientToken)
+	rec = s.do(http.MethodGet, "/api/v1/analytics/funnel"+analyticsRange(), nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &funnel)
+	if funnel != (Services.Funnel{}) {
+		t.Fatalf("expected an empty funnel for the client, got %+v", funnel)
+	}
+
+	rec = s.do(http.MethodGet, "/api/v1/analytics/revenue"+analyticsRange(), nil, "", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	var revenue []Services.MonthlyRevenue
+	decode(t, rec, &revenue)
+	// The deposit less the platform's 5% fee
+	paid := 150.5 * 0.95
+	if len(revenue) != 1 || revenue[0].Month != time.Now().Format("2006-01") || revenue[0].Currency != "USD" ||
+		revenue[0].Payouts != 1 || revenue[0].Amount < paid-0.01 || revenue[0].Amount > paid+0.01 {
+		t.Fatalf("expected %.2f USD paid out this month, got %+v", paid, revenue)
+	}
+}
@@ -1,34 +1,116 @@
 package main
 
 import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Events"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Middleware"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/OpenAPI"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type application struct {
 	config  config
 	Service Services.Service
+	// events buffers analytics events until the analytics job records them
+	events *Events.Collector[Services.AnalyticsEvent]
 }
 
 type config struct {
-	address string
-	db      dbConfig
+	address    string
+	db         dbConfig
+	retention  retentionConfig
+	listings   listingConfig
+	searches   searchConfig
+	matching   Services.MatchOptions
+	promotions Services.PromotionRules
+	payments   paymentConfig
+	invoices   invoiceConfig
+	rates      rateConfig
+	analytics  analyticsConfig
+	apiKeys    apiKeyConfig
 }
 
 type dbConfig struct {
-	addr string
+	driver string
+	addr   string
+}
+
+// retentionConfig controls how long deleted listings and transactions are kept
+type retentionConfig struct {
+	// restoreWithin is the grace period in which owners may restore what they deleted
+	restoreWithin time.Duration
+	// purgeAfter is how long after deletion the purge job removes rows for good
+	purgeAfter time.Duration
+}
+
+// listingConfig controls the listing lifecycle job and the map view
+type listingConfig struct {
+	// reminderBefore is how long before expiry owners are notified
+	reminderBefore time.Duration
+	// clusterBelowZoom is the map zoom level from which viewports return listings instead of clusters
+	clusterBelowZoom int
+	// mapLimit caps the clusters and listings a map view returns together
+	mapLimit int
+	// geoJSONProperties are the listing fields GeoJSON features carry unless ?properties= says otherwise
+	geoJSONProperties []string
+}
+
+// searchConfig controls the saved search alerts
+type searchConfig struct {
+	// digestEvery is how often daily saved searches are summarised
+	digestEvery time.Duration
+}
+
+// paymentConfig controls the money moved for transactions
+type paymentConfig struct {
+	// feePercent is the platform's share of each released deposit
+	feePercent float64
+}
+
+type invoiceConfig struct {
+	// taxRates are the tax percentages included in prices, by country of the job
+	taxRates map[string]float64
+}
+
+// analyticsConfig controls the buffering of analytics events
+type analyticsConfig struct {
+	// buffer is how many events wait to be recorded before new ones are dropped
+	buffer int
+	// flushEvery is how often buffered events are recorded
+	flushEvery time.Duration
+}
+
+// apiKeyConfig controls the limits given to new API clients
+type apiKeyConfig struct {
+	// rateLimit is how many requests a client may make per minute
+	rateLimit int
+	// dailyQuota is how many requests a client may make per day, 0 for no quota
+	dailyQuota int
+}
+
+// rateConfig controls the exchange rates recorded for transactions
+type rateConfig struct {
+	// currencies are recorded against the transaction's currency when it is accepted,
+	// with the preferred currencies of both parties
+	currencies []string
 }
 
 func (app *application) mount() http.Handler {
 
 	r := chi.NewRouter()
 
+	// Unknown routes and methods answer with the same problem+json body as the handlers
+	r.NotFound(app.notFound)
+	r.MethodNotAllowed(app.methodNotAllowed)
+
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
@@ -46,30 +128,42 @@ func (app *application) mount() http.Handler {
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
+	// The document describes the finished router, so it is filled in once every route is mounted
+	doc := &OpenAPI.Document{}
+
 	r.Route("/api", func(v1Router chi.Router) {
 		v1Router.Route("/v1", func(mainRouter chi.Router) {
+			mainRouter.Get("/openapi.json", serveOpenAPI(doc))
+			mainRouter.Get("/docs", serveDocs)
+
 			mainRouter.Route("/user", func(userRouter chi.Router) {
-				userRouter.Get("/users", app.GetAllUsers)
-				userRouter.Get("/userId/{id}", app.GetUserById)
-				userRouter.Get("/userName/{name}", app.GetUserByName)
+				userRouter.With(Middleware.OptionalAuth).Get("/users", app.GetAllUsers)
+				userRouter.With(Middleware.OptionalAuth).Get("/userId/{id}", app.GetUserById)
+				userRouter.With(Middleware.OptionalAuth).Get("/userName/{name}", app.GetUserByName)
 				userRouter.Post("/create", app.CreateUser)
 				userRouter.With(Middleware.AuthMiddleware).Delete("/delete/{id}", app.DeleteUser)
 				userRouter.With(Middleware.AuthMiddleware).Put("/update/{id}", app.UpdateUser)
+				userRouter.With(Middleware.AuthMiddleware).Get("/export/{id}", app.ExportUser)
 				userRouter.Post("/auth", app.authUser)
 			})
 			mainRouter.Route("/listing", func(listingRouter chi.Router) {
 				listingRouter.Get("/listings/{type}", app.GetAllListings)
-				listingRouter.Get("/listingId/{id}", app.GetListingByID)
-				listingRouter.Get("/listings/user/{user_id}/{type}", app.GetListingsByUserID)
+				listingRouter.Get("/export/{type}", app.ExportListings)
+				listingRouter.With(Middleware.OptionalAuth).Get("/listingId/{id}", app.GetListingByID)
+				listingRouter.With(Middleware.OptionalAuth).Get("/listings/user/{user_id}/{type}", app.GetListingsByUserID)
 				listingRouter.Get("/search/{query}/{type}", app.GetListingsBySearch)
 				listingRouter.Get("/date/{type}", app.GetListingsByDate)
 				listingRouter.Get("/date/search/{query}/{type}", app.GetListingsByDateAndSearch)
 				listingRouter.Get("/distance/{longitude}/{latitude}/{max_distance}/{type}", app.GetListingsByDistance)
 				listingRouter.Get("/distance/{longitude}/{latitude}/{max_distance}/{type}/{query}", app.GetListingsByDistanceAndSearch)
-				//listingRouter.Get("/location/{longitude}/{latitude}/{max_range}/{type}", app.GetListingsByLocation)
+				listingRouter.Get("/viewport/{min_longitude}/{min_latitude}/{max_longitude}/{max_latitude}/{zoom}/{type}", app.GetListingsByViewport)
+				listingRouter.Get("/viewport/{min_longitude}/{min_latitude}/{max_longitude}/{max_latitude}/{zoom}/{type}/{query}", app.GetListingsByViewport)
 				listingRouter.With(Middleware.AuthMiddleware).Post("/create", app.CreateListing)
 				listingRouter.With(Middleware.AuthMiddleware).Put("/update/{id}", app.UpdateListing)
 				listingRouter.With(Middleware.AuthMiddleware).Delete("/delete/{id}", app.DeleteListing)
+				listingRouter.With(Middleware.AuthMiddleware).Post("/restore/{id}", app.RestoreListing)
+				listingRouter.With(Middleware.AuthMiddleware).Put("/status/{id}/{status}", app.SetListingStatus)
+				listingRouter.With(Middleware.AuthMiddleware).Put("/renew/{id}", app.RenewListing)
 			})
 
 			mainRouter.Route("/image", func(imageRouter chi.Router) {
@@ -91,12 +185,146 @@ func (app *application) mount() http.Handler {
 				transactionRouter.With(Middleware.AuthMiddleware).Get("/listing/{listing_id}/{status}", app.getTransactionsByListingAndStatus)
 				transactionRouter.With(Middleware.AuthMiddleware).Put("/update/{id}", app.updateTransaction)    // Update transaction
 				transactionRouter.With(Middleware.AuthMiddleware).Delete("/delete/{id}", app.deleteTransaction) // Delete transaction
+				transactionRouter.With(Middleware.AuthMiddleware).Post("/restore/{id}", app.restoreTransaction)
 				transactionRouter.With(Middleware.AuthMiddleware).Get("/contract/{id}", app.createTransactionContract)
+				transactionRouter.With(Middleware.AuthMiddleware).Get("/payment/{id}", app.getTransactionPayment)
+				transactionRouter.With(Middleware.AuthMiddleware).Get("/rates/{id}", app.getTransactionRates)
+				transactionRouter.With(Middleware.AuthMiddleware).Get("/milestones/{id}", app.getTransactionMilestones)
+				transactionRouter.With(Middleware.AuthMiddleware).Put("/milestones/{id}", app.setTransactionMilestones)
+				transactionRouter.With(Middleware.AuthMiddleware).Post("/milestone/done/{id}", app.markMilestoneDone)
+				transactionRouter.With(Middleware.AuthMiddleware).Post("/milestone/approve/{id}", app.approveMilestone)
 
 			})
+			mainRouter.Route("/invoice", func(invoiceRouter chi.Router) {
+				invoiceRouter.Use(Middleware.AuthMiddleware)
+				invoiceRouter.Post("/issue/{id}", app.createInvoice)
+				invoiceRouter.Get("/invoiceId/{id}", app.getInvoice)
+				invoiceRouter.Get("/receipt/{id}", app.getReceipt)
+				invoiceRouter.Get("/invoices/{from}/{to}", app.getInvoices)
+			})
+			mainRouter.Route("/subscription", func(subscriptionRouter chi.Router) {
+				subscriptionRouter.Get("/plans", app.getPlans)
+				subscriptionRouter.With(Middleware.AuthMiddleware).Get("/current", app.getSubscription)
+				subscriptionRouter.With(Middleware.AuthMiddleware).Put("/change", app.changeSubscription)
+				subscriptionRouter.With(Middleware.AuthMiddleware).Get("/charges", app.getSubscriptionCharges)
+			})
+			mainRouter.Route("/promotion", func(promotionRouter chi.Router) {
+				promotionRouter.Post("/click/{id}", app.clickPromotion)
+				promotionRouter.With(Middleware.AuthMiddleware).Post("/create", app.createPromotion)
+				promotionRouter.With(Middleware.AuthMiddleware).Get("/promotions", app.getPromotions)
+				promotionRouter.With(Middleware.AuthMiddleware).Get("/promotionId/{id}", app.getPromotion)
+				promotionRouter.With(Middleware.AuthMiddleware).Get("/days/{id}", app.getPromotionDays)
+				promotionRouter.With(Middleware.AuthMiddleware).Post("/cancel/{id}", app.cancelPromotion)
+			})
+			mainRouter.Route("/analytics", func(analyticsRouter chi.Router) {
+				analyticsRouter.Use(Middleware.AuthMiddleware)
+				analyticsRouter.Get("/days/{from}/{to}", app.getAnalyticsDays)
+				analyticsRouter.Get("/listings/{from}/{to}", app.getAnalyticsListings)
+				analyticsRouter.Get("/funnel/{from}/{to}", app.getAnalyticsFunnel)
+				analyticsRouter.Get("/revenue/{from}/{to}", app.getAnalyticsRevenue)
+			})
+			mainRouter.Route("/notification", func(notificationRouter chi.Router) {
+				notificationRouter.Use(Middleware.AuthMiddleware)
+				notificationRouter.Get("/notifications", app.getNotifications)
+				notificationRouter.Put("/read/{id}", app.markNotificationRead)
+			})
+			mainRouter.Route("/savedsearch", func(searchRouter chi.Router) {
+				searchRouter.Use(Middleware.AuthMiddleware)
+				searchRouter.Post("/create", app.createSavedSearch)
+				searchRouter.Get("/searches", app.getSavedSearches)
+				searchRouter.Put("/update/{id}", app.updateSavedSearch)
+				searchRouter.Delete("/delete/{id}", app.deleteSavedSearch)
+				searchRouter.Get("/matches/{id}", app.getSavedSearchMatches)
+			})
+			mainRouter.Route("/favourite", func(favouriteRouter chi.Router) {
+				favouriteRouter.Use(Middleware.AuthMiddleware)
+				favouriteRouter.Get("/favourites", app.getFavourites)
+				favouriteRouter.Put("/{kind}/{target_id}", app.favourite)
+				favouriteRouter.Delete("/{kind}/{target_id}", app.unfavourite)
+			})
+			mainRouter.Route("/shortlist", func(shortlistRouter chi.Router) {
+				shortlistRouter.Use(Middleware.AuthMiddleware)
+				shortlistRouter.Post("/create", app.createShortlist)
+				shortlistRouter.Get("/shortlists", app.getShortlists)
+				shortlistRouter.Get("/shortlistId/{id}", app.getShortlist)
+				shortlistRouter.Put("/update/{id}", app.updateShortlist)
+				shortlistRouter.Delete("/delete/{id}", app.deleteShortlist)
+				shortlistRouter.Put("/item/{id}/{kind}/{target_id}", app.addShortlistItem)
+				shortlistRouter.Delete("/item/{id}/{kind}/{target_id}", app.removeShortlistItem)
+			})
+			mainRouter.Route("/servicearea", func(areaRouter chi.Router) {
+				areaRouter.Get("/districts", app.getDistricts)
+				areaRouter.Get("/user/{user_id}", app.getServiceAreas)
+				areaRouter.With(Middleware.OptionalAuth).Get("/tradesmen/{longitude}/{latitude}", app.getTradesmenServing)
+				areaRouter.With(Middleware.AuthMiddleware).Post("/create", app.createServiceArea)
+				areaRouter.With(Middleware.AuthMiddleware).Delete("/delete/{id}", app.deleteServiceArea)
+			})
+			mainRouter.Route("/region", func(regionRouter chi.Router) {
+				regionRouter.Get("/regions/{level}", app.getRegionsByLevel)
+				regionRouter.Get("/regionId/{id}", app.getRegion)
+				regionRouter.Get("/children/{id}", app.getRegionChildren)
+				regionRouter.Get("/listings/{id}/{type}", app.GetListingsByRegion)
+				regionRouter.Get("/locate/{longitude}/{latitude}", app.locateRegion)
+			})
+			mainRouter.Route("/match", func(matchRouter chi.Router) {
+				matchRouter.Use(Middleware.AuthMiddleware)
+				matchRouter.Get("/tradesmen/{listing_id}", app.getSuggestedTradesmen)
+				matchRouter.Get("/jobs", app.getJobsForYou)
+			})
+			mainRouter.Route("/apiclient", func(clientRouter chi.Router) {
+				clientRouter.Use(Middleware.AuthMiddleware)
+				clientRouter.Post("/create", app.createAPIClient)
+				clientRouter.Get("/clients", app.getAPIClients)
+				clientRouter.Get("/clientId/{id}", app.getAPIClient)
+				clientRouter.Post("/rotate/{id}", app.rotateAPIKey)
+				clientRouter.Delete("/revoke/{id}", app.revokeAPIClient)
+				clientRouter.Get("/usage/{id}/{from}/{to}", app.getAPIUsage)
+			})
+			// The public API is read-only and called by third parties with an API key instead of a token
+			mainRouter.Route("/public", func(publicRouter chi.Router) {
+				publicRouter.Use(Middleware.APIKeyMiddleware(app.Service.APIClients))
+				publicRouter.Route("/listing", func(listingRouter chi.Router) {
+					listingRouter.Use(Middleware.RequireScope(Services.ScopeListings))
+					listingRouter.Get("/listingId/{id}", app.GetListingByID)
+					listingRouter.Get("/search/{query}/{type}", app.GetListingsBySearch)
+					listingRouter.Get("/date/{type}", app.GetListingsByDate)
+					listingRouter.Get("/distance/{longitude}/{latitude}/{max_distance}/{type}", app.GetListingsByDistance)
+				})
+				publicRouter.Route("/region", func(regionRouter chi.Router) {
+					regionRouter.Use(Middleware.RequireScope(Services.ScopeRegions))
+					regionRouter.Get("/regions/{level}", app.getRegionsByLevel)
+					regionRouter.Get("/regionId/{id}", app.getRegion)
+					regionRouter.Get("/children/{id}", app.getRegionChildren)
+					regionRouter.Get("/locate/{longitude}/{latitude}", app.locateRegion)
+					regionRouter.With(Middleware.RequireScope(Services.ScopeListings)).Get("/listings/{id}/{type}", app.GetListingsByRegion)
+				})
+				publicRouter.Route("/servicearea", func(areaRouter chi.Router) {
+					areaRouter.Use(Middleware.RequireScope(Services.ScopeAreas))
+					areaRouter.Get("/districts", app.getDistricts)
+					areaRouter.Get("/tradesmen/{longitude}/{latitude}", app.getTradesmenServing)
+				})
+			})
+			mainRouter.Route("/admin", func(adminRouter chi.Router) {
+				adminRouter.Use(Middleware.AuthMiddleware, Middleware.AdminOnly)
+				adminRouter.Get("/listings/deleted", app.getDeletedListings)
+				adminRouter.Get("/transactions/deleted", app.getDeletedTransactions)
+				adminRouter.Get("/ledger/balances", app.getLedgerBalances)
+				adminRouter.Get("/subscriptions", app.getSubscriptions)
+				adminRouter.Get("/apiclients", app.getAllAPIClients)
+				adminRouter.Put("/apiclients/limits/{id}", app.setAPIClientLimits)
+				adminRouter.Get("/rates", app.getExchangeRates)
+				adminRouter.Put("/rates", app.setExchangeRate)
+				adminRouter.Delete("/rates/{currency_from}/{currency_to}", app.deleteExchangeRate)
+			})
 		})
 	})
 
+	generated, undocumented := openAPIDocument(r)
+	if len(undocumented) > 0 {
+		log.Printf("routes missing from the OpenAPI document: %s", strings.Join(undocumented, ", "))
+	}
+	*doc = *generated
+
 	return r
 }
 
@@ -110,6 +338,8 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	Jobs.Start(context.Background(), app.purgeJob(), app.listingLifecycleJob(), app.savedSearchJob(), app.regionJob(), app.subscriptionJob(), app.promotionJob(), app.analyticsJob(), app.analyticsRollupJob())
+
 	log.Printf("starting server at %s", app.config.address)
 
 	return server.ListenAndServe()
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// createAPIClient handles the request to register an API client for the public API. The key is only returned here.
+func (app *application) createAPIClient(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var client Services.APIClient
+	if err := decodeJSON(r, &client); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	// New clients get the default limits, only admins change them
+	client.UserID = tokenUserID
+	client.RateLimit = app.config.apiKeys.rateLimit
+	client.DailyQuota = app.config.apiKeys.dailyQuota
+
+	created, err := app.Service.APIClients.Create(r.Context(), client)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getAPIClients handles the request to list the API clients the caller registered.
+func (app *application) getAPIClients(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	clients, err := app.Service.APIClients.GetByUser(r.Context(), tokenUserID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(clients)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// ownAPIClient returns the API client in the URL if the caller registered it
+func (app *application) ownAPIClient(r *http.Request) (Services.APIClient, error) {
+	clientID, err := intParam(r, "id")
+	if err != nil {
+		return Services.APIClient{}, err
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return Services.APIClient{}, err
+	}
+
+	client, err := app.Service.APIClients.GetByID(r.Context(), clientID)
+	if err != nil {
+		return Services.APIClient{}, err
+	}
+	if client.UserID != tokenUserID {
+		return Services.APIClient{}, fmt.Errorf("API client %w", Services.ErrNotFound)
+	}
+	return client, nil
+}
+
+// getAPIClient handles the request to get one of the caller's API clients.
+func (app *application) getAPIClient(w http.ResponseWriter, r *http.Request) {
+	client, err := app.ownAPIClient(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(client)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// rotateAPIKey handles the request to issue a new key for one of the caller's API clients, replacing the previous one.
+func (app *application) rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	client, err := app.ownAPIClient(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	rotated, err := app.Service.APIClients.Rotate(r.Context(), client.ClientID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(rotated)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// revokeAPIClient handles the request to stop the key of one of the caller's API clients from working.
+func (app *application) revokeAPIClient(w http.ResponseWriter, r *http.Request) {
+	client, err := app.ownAPIClient(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	if err := app.Service.APIClients.Revoke(r.Context(), client.ClientID); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getAPIUsage handles the request to get the requests of one of the caller's API clients by day.
+func (app *application) getAPIUsage(w http.ResponseWriter, r *http.Request) {
+	client, err := app.ownAPIClient(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	usage, err := app.Service.APIClients.GetUsage(r.Context(), client.ClientID, chi.URLParam(r, "from"), chi.URLParam(r, "to"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(usage)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getAllAPIClients handles the request of an admin to list every API client.
+func (app *application) getAllAPIClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := app.Service.APIClients.GetAll(r.Context())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(clients)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// setAPIClientLimits handles the request of an admin to change the rate limit and daily quota of an API client.
+func (app *application) setAPIClientLimits(w http.ResponseWriter, r *http.Request) {
+	clientID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var limits Services.APILimits
+	if err := decodeJSON(r, &limits); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	client, err := app.Service.APIClients.SetLimits(r.Context(), clientID, limits)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(client)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
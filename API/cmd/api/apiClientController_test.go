@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withKey sends a GET to the public API with an API key
+func (s *testServer) withKey(path, key string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	return s.serve(req)
+}
+
+// createAPIClient registers an API client with scopes for the caller
+func (s *testServer) createAPIClient(t *testing.T, token string, scopes ...string) Services.APIClient {
+	t.Helper()
+	rec := s.doJSON(http.MethodPost, "/api/v1/apiclient/create", map[string]interface{}{"name": "Portal", "scopes": scopes}, token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var client Services.APIClient
+	decode(t, rec, &client)
+	return client
+}
+
+func TestAPIClientKeys(t *testing.T) {
+	s := newTestServer(t)
+	owner, token := s.createUser("Owner", "+96170000001")
+	_, otherToken := s.createUser("Other", "+96170000002")
+
+	for _, scopes := range [][]string{{}, {"listings:write"}} {
+		rec := s.doJSON(http.MethodPost, "/api/v1/apiclient/create", map[string]interface{}{"name": "Portal", "scopes": scopes}, token)
+		if problem := decodeProblem(t, rec, http.StatusBadRequest); problem.Errors[0].Field != "scopes" {
+			t.Fatalf("expected scopes %v to be refused, got %+v", scopes, problem)
+		}
+	}
+
+	client := s.createAPIClient(t, token, Services.ScopeRegions, Services.ScopeListings, Services.ScopeListings)
+	if !strings.HasPrefix(client.Key, "mbk_") || !strings.HasPrefix(client.Key, client.KeyPrefix) || len(client.KeyPrefix) != 12 ||
+		client.UserID != owner.UserID || client.RateLimit != 60 || client.DailyQuota != 10000 {
+		t.Fatalf("unexpected client %+v", client)
+	}
+	if strings.Join(client.Scopes, ",") != "listings:read,regions:read" {
+		t.Fatalf("expected the scopes sorted without repeats, got %v", client.Scopes)
+	}
+
+	// The key is only shown once
+	var clients []Services.APIClient
+	rec := s.do(http.MethodGet, "/api/v1/apiclient/clients", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &clients)
+	if len(clients) != 1 || clients[0].Key != "" || clients[0].KeyPrefix != client.KeyPrefix {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+	clientPath := "/api/v1/apiclient/clientId/" + strconv.Itoa(client.ClientID)
+	expectStatus(t, s.do(http.MethodGet, clientPath, nil, "", token), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, clientPath, nil, "", otherToken), http.StatusNotFound)
+
+	public := "/api/v1/public/listing/date/Offer"
+	if problem := decodeProblem(t, s.withKey(public, ""), http.StatusUnauthorized); problem.Code != "unauthorized" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+	expectStatus(t, s.withKey(public, "mbk_0000"), http.StatusUnauthorized)
+	expectStatus(t, s.withKey(public, client.Key), http.StatusOK)
+	// A user token does not open the public API
+	expectStatus(t, s.do(http.MethodGet, public, nil, "", token), http.StatusUnauthorized)
+	if problem := decodeProblem(t, s.withKey("/api/v1/public/servicearea/districts", client.Key), http.StatusForbidden); !strings.Contains(problem.Detail, Services.ScopeAreas) {
+		t.Fatalf("expected the missing scope to be named, got %+v", problem)
+	}
+
+	// Rotating replaces the key at once
+	rotatePath := "/api/v1/apiclient/rotate/" + strconv.Itoa(client.ClientID)
+	expectStatus(t, s.do(http.MethodPost, rotatePath, nil, "", otherToken), http.StatusNotFound)
+	rec = s.do(http.MethodPost, rotatePath, nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var rotated Services.APIClient
+	decode(t, rec, &rotated)
+	if rotated.Key == "" || rotated.Key == client.Key || rotated.ClientID != client.ClientID {
+		t.Fatalf("unexpected rotated client %+v", rotated)
+	}
+	expectStatus(t, s.withKey(public, client.Key), http.StatusUnauthorized)
+	expectStatus(t, s.withKey(public, rotated.Key), http.StatusOK)
+
+	revokePath := "/api/v1/apiclient/revoke/" + strconv.Itoa(client.ClientID)
+	expectStatus(t, s.do(http.MethodDelete, revokePath, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, revokePath, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.withKey(public, rotated.Key), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodDelete, revokePath, nil, "", token), http.StatusConflict)
+	expectStatus(t, s.do(http.MethodPost, rotatePath, nil, "", token), http.StatusConflict)
+
+	// Closing the account stops its keys
+	other := s.createAPIClient(t, token, Services.ScopeListings)
+	expectStatus(t, s.withKey(public, other.Key), http.StatusOK)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/user/delete/"+strconv.Itoa(owner.UserID), nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.withKey(public, other.Key), http.StatusUnauthorized)
+}
+
+func TestAPIClientLimitsAndUsage(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.createUser("Owner", "+96170000001")
+	admin, adminToken := s.createUser("Admin", "+96170000009")
+	client := s.createAPIClient(t, token, Services.ScopeRegions)
+	limitsPath := "/api/v1/admin/apiclients/limits/" + strconv.Itoa(client.ClientID)
+
+	// Only admins change limits
+	expectStatus(t, s.doJSON(http.MethodPut, limitsPath, map[string]int{"rate_limit": 2, "daily_quota": 3}, token), http.StatusForbidden)
+	if err := s.app.Service.Users.SetRole(context.Background(), admin.UserID, Services.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken = s.signIn("+96170000009")
+	expectStatus(t, s.doJSON(http.MethodPut, limitsPath, map[string]int{"rate_limit": 0, "daily_quota": 3}, adminToken), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/admin/apiclients/limits/999999", map[string]int{"rate_limit": 2, "daily_quota": 3}, adminToken), http.StatusNotFound)
+	expectStatus(t, s.doJSON(http.MethodPut, limitsPath, map[string]int{"rate_limit": 2, "daily_quota": 3}, adminToken), http.StatusOK)
+
+	var clients []Services.APIClient
+	rec := s.do(http.MethodGet, "/api/v1/admin/apiclients", nil, "", adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &clients)
+	if len(clients) != 1 || clients[0].RateLimit != 2 || clients[0].DailyQuota != 3 || clients[0].Key != "" {
+		t.Fatalf("unexpected clients %+v", clients)
+	}
+
+	public := "/api/v1/public/region/regions/country"
+	for remaining := 1; remaining >= 0; remaining-- {
+		rec := s.withKey(public, client.Key)
+		expectStatus(t, rec, http.StatusOK)
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(remaining) {
+			t.Fatalf("expected %d requests left, got %q", remaining, got)
+		}
+	}
+	rec = s.withKey(public, client.Key)
+	if problem := decodeProblem(t, rec, http.StatusTooManyRequests); problem.Code != "rate_limited" || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the rate limit with a Retry-After, got %+v", problem)
+	}
+
+	// Requests refused by the rate limit are not metered, those over the quota are
+	expectStatus(t, s.doJSON(http.MethodPut, limitsPath, map[string]int{"rate_limit": 100, "daily_quota": 3}, adminToken), http.StatusOK)
+	expectStatus(t, s.withKey(public, client.Key), http.StatusOK)
+	if problem := decodeProblem(t, s.withKey(public, client.Key), http.StatusTooManyRequests); problem.Code != "quota_exceeded" {
+		t.Fatalf("expected the daily quota to be used up, got %+v", problem)
+	}
+
+	now := time.Now()
+	usagePath := "/api/v1/apiclient/usage/" + strconv.Itoa(client.ClientID) + "/" + now.AddDate(0, 0, -1).Format("2006-01-02") + "/" + now.AddDate(0, 0, 1).Format("2006-01-02")
+	var usage []Services.APIUsage
+	rec = s.do(http.MethodGet, usagePath, nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &usage)
+	want := Services.APIUsage{Date: now.Format("2006-01-02"), Requests: 3, Rejected: 1}
+	if len(usage) != 1 || usage[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, usage)
+	}
+	expectStatus(t, s.do(http.MethodGet, usagePath, nil, "", adminToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/apiclient/usage/"+strconv.Itoa(client.ClientID)+"/2025-02-01/2025-01-01", nil, "", token), http.StatusBadRequest)
+}
+
+func TestAPIUsageFirstRequestsAtOnce(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.createUser("Owner", "+96170000001")
+	client := s.createAPIClient(t, token, Services.ScopeRegions)
+
+	// The first requests of a day all start the day's count, and none of them fails for it
+	codes := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = s.withKey("/api/v1/public/region/regions/country", client.Key).Code
+		}()
+	}
+	wg.Wait()
+	for _, code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expected every request through, got %v", codes)
+		}
+	}
+
+	today := time.Now().Format("2006-01-02")
+	usage, err := s.app.Service.APIClients.GetUsage(context.Background(), client.ClientID, today, today)
+	if err != nil || len(usage) != 1 || usage[0].Requests != len(codes) {
+		t.Fatalf("expected %d requests counted, got %+v %v", len(codes), usage, err)
+	}
+}
+
+func TestPublicAPI(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Owner", "+96170000001")
+	if err := s.app.regionJob().Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	listing := s.createListing(user.UserID, "Offer", "Beirut plumbing", 35.5018, 33.8938)
+	key := s.createAPIClient(t, token, Services.APIScopes...).Key
+
+	get := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := s.withKey("/api/v1/public"+path, key)
+		expectStatus(t, rec, http.StatusOK)
+		return rec
+	}
+
+	var got Services.Listing
+	decode(t, get("/listing/listingId/"+strconv.Itoa(listing.ListingID)), &got)
+	if got.Title != "Beirut plumbing" {
+		t.Fatalf("unexpected listing %+v", got)
+	}
+	for _, path := range []string{
+		"/listing/search/plumb/Offer",
+		"/listing/date/Offer",
+		"/listing/distance/35.5018/33.8938/1000/Offer",
+	} {
+		if titles := listingTitles(decodeListings(t, get(path))); len(titles) != 1 || titles[0] != "Beirut plumbing" {
+			t.Fatalf("%s: unexpected listings %v", path, titles)
+		}
+	}
+
+	var countries, chain, children []Services.Region
+	decode(t, get("/region/regions/country"), &countries)
+	if len(countries) != 1 {
+		t.Fatalf("unexpected countries %+v", countries)
+	}
+	country := strconv.Itoa(countries[0].RegionID)
+	var region Services.Region
+	decode(t, get("/region/regionId/"+country), &region)
+	decode(t, get("/region/children/"+country), &children)
+	decode(t, get("/region/locate/35.5018/33.8938"), &chain)
+	if region.Code != "LB" || len(children) != 8 || len(chain) != 4 {
+		t.Fatalf("unexpected regions %+v, %d children, %d in the chain", region, len(children), len(chain))
+	}
+	if titles := listingTitles(decodeListings(t, get("/region/listings/"+country+"/Offer"))); len(titles) != 1 {
+		t.Fatalf("expected the listing in Lebanon, got %v", titles)
+	}
+
+	var districts []Services.District
+	decode(t, get("/servicearea/districts"), &districts)
+	if len(districts) == 0 {
+		t.Fatal("expected the districts")
+	}
+	var tradesmen []Services.Profile
+	decode(t, get("/servicearea/tradesmen/35.5018/33.8938"), &tradesmen)
+
+	// Listings in a region also need the listings scope
+	regionsOnly := s.createAPIClient(t, token, Services.ScopeRegions).Key
+	expectStatus(t, s.withKey("/api/v1/public/region/listings/"+country+"/Offer", regionsOnly), http.StatusForbidden)
+	expectStatus(t, s.withKey("/api/v1/public/region/regionId/"+country, regionsOnly), http.StatusOK)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Migrations"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	geo "github.com/paulmach/go.geo"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// coveredRoutes records every route pattern the tests have exercised
+var coveredRoutes = struct {
+	sync.Mutex
+	patterns map[string]bool
+}{patterns: map[string]bool{}}
+
+// backends are the storage drivers the whole suite runs against, in order
+var backends = []string{"memory", "sqlite"}
+
+// backend is the driver newTestServer uses for the current run
+var backend string
+
+func TestMain(m *testing.M) {
+	// Handlers read contract templates relative to the API root
+	if err := os.Chdir("../.."); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	code := 0
+	for _, backend = range backends {
+		fmt.Printf("=== backend %s\n", backend)
+		if code = m.Run(); code != 0 {
+			break
+		}
+	}
+
+	// Only a full run can tell whether every route was exercised
+	if code == 0 && flag.Lookup("test.run").Value.String() == "" {
+		if missing := uncoveredRoutes(); len(missing) > 0 {
+			fmt.Printf("routes without tests:\n  %s\n", strings.Join(missing, "\n  "))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// uncoveredRoutes walks the mounted router and lists routes no test has requested
+func uncoveredRoutes() []string {
+	app := &application{Service: Services.ServiceMemory(nil, nil, nil)}
+	router := app.mount().(chi.Routes)
+
+	var missing []string
+	coveredRoutes.Lock()
+	defer coveredRoutes.Unlock()
+	_ = chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if !coveredRoutes.patterns[method+" "+route] {
+			missing = append(missing, method+" "+route)
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing
+}
+
+// stubGeocode stands in for the reverse geocoding API
+func stubGeocode(lat, lon float64) (string, string, error) {
+	return "Beirut", "Lebanon", nil
+}
+
+type testServer struct {
+	t        *testing.T
+	app      *application
+	handler  http.Handler
+	payments *Payments.Fake
+}
+
+// newTestServer mounts the API on a fresh, empty instance of the current backend
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	t.Setenv("SRV_DIR", t.TempDir())
+	// Most tests publish more listings per user than the free plan allows
+	t.Setenv("PLAN_FREE_LISTINGS", "100")
+
+	payments := Payments.NewFake()
+	app := &application{
+		config: config{
+			retention:  retentionConfig{restoreWithin: time.Hour, purgeAfter: 24 * time.Hour},
+			listings:   listingConfig{reminderBefore: 72 * time.Hour, clusterBelowZoom: 13, mapLimit: 500, geoJSONProperties: Services.DefaultListingProperties},
+			searches:   searchConfig{digestEvery: 24 * time.Hour},
+			matching:   Services.MatchOptions{Weights: Services.DefaultMatchWeights(), Radius: 25, Limit: 20},
+			promotions: Services.DefaultPromotionRules(),
+			payments:   paymentConfig{feePercent: 5},
+			invoices:   invoiceConfig{taxRates: map[string]float64{"Lebanon": 11}},
+			rates:      rateConfig{currencies: []string{"USD", "LBP"}},
+			analytics:  analyticsConfig{buffer: 1000, flushEvery: time.Second},
+			apiKeys:    apiKeyConfig{rateLimit: 60, dailyQuota: 10000},
+		},
+		Service: newTestService(t, payments),
+	}
+	app.events = newEventCollector(app.Service, app.config.analytics)
+	return &testServer{t: t, app: app, handler: app.mount(), payments: payments}
+}
+
+// newTestService returns the services of the current backend. SQL backends get
+// a private in-memory database migrated to the latest schema.
+func newTestService(t *testing.T, payments *Payments.Fake) Services.Service {
+	t.Helper()
+	if backend == "memory" {
+		return Services.ServiceMemory(stubGeocode, payments, nil)
+	}
+
+	db, err := Database.DBConnection(backend, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := Migrations.Up(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return Services.ServiceDB(db, stubGeocode, payments, nil)
+}
+
+// do sends a request through the router, authenticated with token if any
+func (s *testServer) do(method, path string, body io.Reader, contentType, token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	req := httptest.NewRequest(method, path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return s.serve(req)
+}
+
+// serve sends a prepared request through the router and records which route pattern served it
+func (s *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	rctx := chi.NewRouteContext()
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		coveredRoutes.Lock()
+		coveredRoutes.patterns[req.Method+" "+pattern] = true
+		coveredRoutes.Unlock()
+	}
+	return rec
+}
+
+// doJSON sends payload encoded as JSON
+func (s *testServer) doJSON(method, path string, payload interface{}, token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+	return s.do(method, path, body, "application/json", token)
+}
+
+// createUser registers a user and logs them in, returning the stored user and a token
+func (s *testServer) createUser(firstName, phoneNumber string) (Services.User, string) {
+	s.t.Helper()
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/user/create", map[string]interface{}{
+		"first_name":    firstName,
+		"last_name":     "Haddad",
+		"phone_number":  phoneNumber,
+		"date_of_birth": "1990-05-15",
+		"profession":    "Plumber",
+		"location":      []float64{35.5018, 33.8938},
+		"password":      "secret",
+	}, "")
+	expectStatus(s.t, rec, http.StatusCreated)
+
+	rec = s.doJSON(http.MethodPost, "/api/v1/user/auth", map[string]string{
+		"phone_number": phoneNumber,
+		"password":     "secret",
+	}, "")
+	expectStatus(s.t, rec, http.StatusOK)
+
+	var response struct {
+		Token string        `json:"token"`
+		User  Services.User `json:"user"`
+	}
+	decode(s.t, rec, &response)
+	return response.User, response.Token
+}
+
+// createListing stores a listing directly through the service
+func (s *testServer) createListing(userID int, listingType, title string, lng, lat float64) Services.Listing {
+	s.t.Helper()
+
+	listing, err := s.app.Service.Listings.Create(context.Background(), &Services.Listing{
+		Type:        listingType,
+		Location:    geo.NewPoint(lng, lat),
+		UserID:      userID,
+		Title:       title,
+		Description: title + " description",
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return listing
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected status %d, got %d: %s", status, rec.Code, rec.Body.String())
+	}
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("could not decode response %q: %v", rec.Body.String(), err)
+	}
+}
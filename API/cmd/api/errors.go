@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Validation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// errNoTokenUser is returned when a handler behind AuthMiddleware finds no user in the context
+var errNoTokenUser = fmt.Errorf("user ID not found in token: %w", Services.ErrUnauthorized)
+
+// respondError answers a failed request with a problem+json body.
+// Service sentinel errors choose the status and their message becomes the detail;
+// anything else is logged and reported as a generic internal error, so SQL and
+// driver messages never reach the client.
+func (app *application) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	var validation *Services.ValidationError
+
+	switch {
+	case errors.As(err, &validation):
+		problem := Utils.NewProblem(r, http.StatusBadRequest, "validation_failed", "The request has invalid fields")
+		problem.Errors = validation.Fields
+		Utils.WriteProblem(w, problem)
+	case errors.Is(err, Services.ErrUnauthorized):
+		Utils.RespondProblem(w, r, http.StatusUnauthorized, "unauthorized", err.Error())
+	case errors.Is(err, Services.ErrPlanLimit):
+		Utils.RespondProblem(w, r, http.StatusForbidden, "plan_limit", err.Error())
+	case errors.Is(err, Services.ErrForbidden):
+		Utils.RespondProblem(w, r, http.StatusForbidden, "forbidden", err.Error())
+	case errors.Is(err, Services.ErrNotFound):
+		Utils.RespondProblem(w, r, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, Services.ErrConflict):
+		Utils.RespondProblem(w, r, http.StatusConflict, "conflict", err.Error())
+	case errors.Is(err, Services.ErrPaymentFailed):
+		Utils.RespondProblem(w, r, http.StatusPaymentRequired, "payment_failed", err.Error())
+	default:
+		log.Printf("request %s %s %s failed: %v", middleware.GetReqID(r.Context()), r.Method, r.URL.Path, err)
+		Utils.RespondProblem(w, r, http.StatusInternalServerError, "internal_error", "An internal error occurred")
+	}
+}
+
+// notFound and methodNotAllowed replace chi's plain-text defaults
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	Utils.RespondProblem(w, r, http.StatusNotFound, "route_not_found", "No route matches "+r.URL.Path)
+}
+
+func (app *application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Utils.RespondProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path)
+}
+
+// authUserID returns the ID of the user authenticated by AuthMiddleware
+func authUserID(r *http.Request) (int, error) {
+	userID, ok := r.Context().Value("token_user_id").(int)
+	if !ok {
+		return 0, errNoTokenUser
+	}
+	return userID, nil
+}
+
+// intParam parses an integer URL parameter
+func intParam(r *http.Request, name string) (int, error) {
+	value, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		return 0, Services.Invalid(name, "must be an integer")
+	}
+	return value, nil
+}
+
+// floatParam parses a decimal URL parameter
+func floatParam(r *http.Request, name string) (float64, error) {
+	value, err := strconv.ParseFloat(chi.URLParam(r, name), 64)
+	if err != nil {
+		return 0, Services.Invalid(name, "must be a number")
+	}
+	return value, nil
+}
+
+// decodeJSON reads the request body into v and checks its validation rules,
+// so handlers never pass an invalid payload on to the services
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return Services.Invalid("body", "must be valid JSON")
+	}
+	return Validation.Struct(v)
+}
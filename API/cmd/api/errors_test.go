@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder, status int) Utils.Problem {
+	t.Helper()
+	expectStatus(t, rec, status)
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("expected application/problem+json, got %q", contentType)
+	}
+
+	var problem Utils.Problem
+	decode(t, rec, &problem)
+	if problem.Status != status || problem.RequestID == "" {
+		t.Fatalf("unexpected problem %+v", problem)
+	}
+	return problem
+}
+
+func TestValidationProblem(t *testing.T) {
+	s := newTestServer(t)
+
+	problem := decodeProblem(t, s.do(http.MethodGet, "/api/v1/user/userId/abc", nil, "", ""), http.StatusBadRequest)
+	if problem.Code != "validation_failed" || len(problem.Errors) != 1 || problem.Errors[0].Field != "id" {
+		t.Fatalf("expected a field error for id, got %+v", problem)
+	}
+}
+
+func TestNotFoundAndUnauthorizedProblems(t *testing.T) {
+	s := newTestServer(t)
+
+	if problem := decodeProblem(t, s.do(http.MethodGet, "/api/v1/listing/listingId/42", nil, "", ""), http.StatusNotFound); problem.Code != "not_found" {
+		t.Fatalf("expected not_found, got %+v", problem)
+	}
+	if problem := decodeProblem(t, s.do(http.MethodDelete, "/api/v1/listing/delete/42", nil, "", ""), http.StatusUnauthorized); problem.Code != "unauthorized" {
+		t.Fatalf("expected unauthorized, got %+v", problem)
+	}
+	if problem := decodeProblem(t, s.do(http.MethodGet, "/api/v1/nowhere", nil, "", ""), http.StatusNotFound); problem.Code != "route_not_found" {
+		t.Fatalf("expected route_not_found, got %+v", problem)
+	}
+}
+
+func TestConflictProblem(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("Adam", "+96170000001")
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/user/create", map[string]interface{}{
+		"first_name":    "Other",
+		"last_name":     "Haddad",
+		"phone_number":  "+96170000001",
+		"date_of_birth": "1990-05-15",
+		"location":      []float64{35.5, 33.9},
+		"password":      "secret",
+	}, "")
+	if problem := decodeProblem(t, rec, http.StatusConflict); problem.Code != "conflict" {
+		t.Fatalf("expected conflict, got %+v", problem)
+	}
+}
+
+func TestInternalErrorsStayOutOfResponses(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/users", nil)
+	rec := httptest.NewRecorder()
+	s.app.respondError(rec, req, errors.New("Error 1064: You have an error in your SQL syntax"))
+
+	expectStatus(t, rec, http.StatusInternalServerError)
+	if strings.Contains(rec.Body.String(), "SQL") {
+		t.Fatalf("internal error leaked into response: %s", rec.Body.String())
+	}
+}
+
+func TestPayloadValidationProblem(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.createUser("Adam", "+96170000001")
+
+	// A listing without a location used to reach the service and panic
+	rec := s.doJSON(http.MethodPost, "/api/v1/listing/create", map[string]interface{}{
+		"type":  "Sale",
+		"title": "Electrician",
+	}, token)
+	problem := decodeProblem(t, rec, http.StatusBadRequest)
+
+	fields := map[string]string{}
+	for _, field := range problem.Errors {
+		fields[field.Field] = field.Message
+	}
+	if len(fields) != 3 || fields["type"] == "" || fields["location"] != "is required" || fields["description"] != "is required" {
+		t.Fatalf("expected every violation at once, got %+v", problem.Errors)
+	}
+}
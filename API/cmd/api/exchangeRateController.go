@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// viewerCurrency returns the currency the caller wants amounts shown in: the currency
+// query parameter, else the preferred currency of their profile, empty when neither is set
+func (app *application) viewerCurrency(r *http.Request) (string, error) {
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		currency = Services.NormaliseCurrency(currency)
+		if !Services.IsCurrency(currency) {
+			return "", Services.Invalid("currency", "must be an ISO 4217 currency code such as USD or LBP")
+		}
+		return currency, nil
+	}
+
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return "", err
+	}
+	user, err := app.Service.Users.GetById(r.Context(), tokenUserID)
+	if err != nil {
+		return "", err
+	}
+	return user.PreferredCurrency, nil
+}
+
+// displayPrices shows the price of each transaction in currency as well: at the rate
+// recorded when the transaction was accepted, else at the current one. Transactions
+// already in currency, or in one nobody has a rate for, are left as they are.
+func (app *application) displayPrices(ctx context.Context, currency string, transactions []Services.Transaction) error {
+	if currency == "" {
+		return nil
+	}
+	for i := range transactions {
+		transaction := &transactions[i]
+		if transaction.CurrencyCode == currency {
+			continue
+		}
+
+		recorded, err := app.Service.ExchangeRates.GetRecorded(ctx, transaction.TransactionID)
+		if err != nil {
+			return err
+		}
+		for _, rate := range recorded {
+			if rate.To == currency {
+				display := rate.Convert(transaction.Price)
+				display.Recorded = true
+				transaction.Display = &display
+			}
+		}
+		if transaction.Display != nil {
+			continue
+		}
+
+		rate, err := app.Service.ExchangeRates.Quote(ctx, transaction.CurrencyCode, currency)
+		if errors.Is(err, Rates.ErrNoRate) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		display := rate.Convert(transaction.Price)
+		transaction.Display = &display
+	}
+	return nil
+}
+
+// recordRates keeps the rates from an accepted transaction's currency to the configured
+// currencies and those both parties prefer, so its price can later be shown as it was
+// worth on the day. Currencies nobody has a rate for are skipped.
+func (app *application) recordRates(ctx context.Context, stored, accepted Services.Transaction) error {
+	currencies := append([]string{}, app.config.rates.currencies...)
+	for _, userID := range []int{stored.UserOfferedID, stored.UserOfferingID} {
+		user, err := app.Service.Users.GetById(ctx, userID)
+		if err != nil {
+			return err
+		}
+		currencies = append(currencies, user.PreferredCurrency)
+	}
+
+	rates, err := Services.QuoteEach(ctx, app.Service.ExchangeRates.Quote, accepted.CurrencyCode, currencies)
+	if err != nil {
+		return err
+	}
+	_, err = app.Service.ExchangeRates.Record(ctx, accepted.TransactionID, rates)
+	return err
+}
+
+// getTransactionRates handles the request to get the exchange rates recorded when a transaction was accepted.
+// Only the parties to the transaction see them; others are told it does not exist.
+func (app *application) getTransactionRates(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err == nil && transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
+		err = fmt.Errorf("transaction %w", Services.ErrNotFound)
+	}
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	rates, err := app.Service.ExchangeRates.GetRecorded(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(rates)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getExchangeRates handles the admin request to list the exchange rates set by admins.
+func (app *application) getExchangeRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := app.Service.ExchangeRates.GetAll(r.Context())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(rates)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// setExchangeRate handles the admin request to set the rate between two currencies, which overrides the provider's.
+func (app *application) setExchangeRate(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var rate Services.ExchangeRate
+	err = decodeJSON(r, &rate)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	rate.SetBy = tokenUserID
+
+	rate, err = app.Service.ExchangeRates.Set(r.Context(), rate)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(rate)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// deleteExchangeRate handles the admin request to remove a rate they set, so the provider quotes the pair again.
+func (app *application) deleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	err := app.Service.ExchangeRates.Delete(r.Context(), chi.URLParam(r, "currency_from"), chi.URLParam(r, "currency_to"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
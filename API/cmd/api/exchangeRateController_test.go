@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// setRate stores a manual exchange rate as an admin would
+func (f transactionFixture) setRate(t *testing.T, from, to string, rate float64) {
+	t.Helper()
+	_, err := f.s.app.Service.ExchangeRates.Set(context.Background(), Services.ExchangeRate{From: from, To: to, Rate: rate, SetBy: f.client.UserID})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// shownTransaction returns the fixture's transaction as the client sees it with query
+func (f transactionFixture) shownTransaction(t *testing.T, query string) Services.Transaction {
+	t.Helper()
+	rec := f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+strconv.Itoa(f.transaction.TransactionID)+query, nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	var transaction Services.Transaction
+	decode(t, rec, &transaction)
+	return transaction
+}
+
+func TestExchangeRatesForAdmins(t *testing.T) {
+	s := newTestServer(t)
+	admin, adminToken := s.createUser("Admin", "+96170000009")
+	rate := map[string]interface{}{"currency_from": "usd", "currency_to": "LBP", "rate": 89500}
+
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/admin/rates", rate, adminToken), http.StatusForbidden)
+	if err := s.app.Service.Users.SetRole(context.Background(), admin.UserID, Services.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken = s.signIn("+96170000009")
+
+	rec := s.doJSON(http.MethodPut, "/api/v1/admin/rates", rate, adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	var set Services.ExchangeRate
+	decode(t, rec, &set)
+	if set.From != "USD" || set.To != "LBP" || set.Rate != 89500 || set.Source != Services.RateManual || set.SetBy != admin.UserID || set.Date == "" {
+		t.Fatalf("unexpected rate %+v", set)
+	}
+
+	// Setting the pair again replaces the rate
+	rate["rate"] = 90000
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/admin/rates", rate, adminToken), http.StatusOK)
+
+	for _, bad := range []map[string]interface{}{
+		{"currency_from": "USD", "currency_to": "usd", "rate": 1},
+		{"currency_from": "USD", "currency_to": "LBX", "rate": 1},
+		{"currency_from": "USD", "currency_to": "EUR", "rate": -1},
+	} {
+		expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/admin/rates", bad, adminToken), http.StatusBadRequest)
+	}
+
+	rec = s.do(http.MethodGet, "/api/v1/admin/rates", nil, "", adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	var rates []Services.ExchangeRate
+	decode(t, rec, &rates)
+	if len(rates) != 1 || rates[0].Rate != 90000 {
+		t.Fatalf("expected the replaced rate only, got %+v", rates)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/admin/rates/USD/lbp", nil, "", adminToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/admin/rates/USD/LBP", nil, "", adminToken), http.StatusNotFound)
+}
+
+func TestRatesRecordedOnAcceptance(t *testing.T) {
+	f := seedTransaction(t)
+	f.setRate(t, "USD", "LBP", 89500)
+	path := "/api/v1/transaction/rates/" + strconv.Itoa(f.transaction.TransactionID)
+
+	rates := func() []Services.ExchangeRate {
+		rec := f.s.do(http.MethodGet, path, nil, "", f.tradesToken)
+		expectStatus(t, rec, http.StatusOK)
+		var rates []Services.ExchangeRate
+		decode(t, rec, &rates)
+		return rates
+	}
+	if got := rates(); len(got) != 0 {
+		t.Fatalf("expected no rates before acceptance, got %+v", got)
+	}
+
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	got := rates()
+	if len(got) != 1 || got[0].From != "USD" || got[0].To != "LBP" || got[0].Rate != 89500 || got[0].Source != Services.RateManual {
+		t.Fatalf("expected the rate to LBP to be recorded, got %+v", got)
+	}
+
+	// Later rates do not change the recorded ones, even when the transaction is accepted again
+	f.setRate(t, "USD", "LBP", 95000)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	if got := rates(); len(got) != 1 || got[0].Rate != 89500 {
+		t.Fatalf("expected the recorded rate to stay, got %+v", got)
+	}
+
+	_, strangerToken := f.s.createUser("Stranger", "+96170000003")
+	expectStatus(t, f.s.do(http.MethodGet, path, nil, "", strangerToken), http.StatusNotFound)
+}
+
+func TestTransactionDisplayedInViewerCurrency(t *testing.T) {
+	f := seedTransaction(t)
+	f.setRate(t, "USD", "LBP", 89500)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	f.setRate(t, "USD", "LBP", 95000)
+
+	if got := f.shownTransaction(t, ""); got.Display != nil {
+		t.Fatalf("expected no display without a currency, got %+v", got.Display)
+	}
+
+	// The rate recorded on acceptance is used rather than today's
+	got := f.shownTransaction(t, "?currency=lbp")
+	if got.Display == nil || got.Display.Amount != 13469750 || got.Display.Currency != "LBP" || !got.Display.Recorded {
+		t.Fatalf("expected the price at the recorded rate, got %+v", got.Display)
+	}
+
+	// Currencies without a recorded rate are quoted, inverting an admin's rate if needed
+	f.setRate(t, "EUR", "USD", 1.25)
+	got = f.shownTransaction(t, "?currency=EUR")
+	if got.Display == nil || got.Display.Amount != 120.4 || got.Display.Recorded {
+		t.Fatalf("expected the price at the current rate, got %+v", got.Display)
+	}
+	if got := f.shownTransaction(t, "?currency=JPY"); got.Display != nil {
+		t.Fatalf("expected no display without a rate, got %+v", got.Display)
+	}
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+strconv.Itoa(f.transaction.TransactionID)+"?currency=LBX", nil, "", f.clientToken), http.StatusBadRequest)
+
+	// Lists use the preferred currency of the viewer's profile
+	expectStatus(t, f.s.doJSON(http.MethodPut, "/api/v1/user/update/"+strconv.Itoa(f.client.UserID), map[string]interface{}{
+		"first_name":         "Client",
+		"last_name":          "Test",
+		"phone_number":       "+96170000001",
+		"date_of_birth":      "1990-05-15",
+		"profession":         "Engineer",
+		"location":           []float64{35.5, 33.9},
+		"password":           "secret",
+		"image_id":           "0",
+		"preferred_currency": "lbp",
+	}, f.clientToken), http.StatusOK)
+	offered := decodeTransactions(t, f.s.do(http.MethodGet, "/api/v1/transaction/offered/"+strconv.Itoa(f.client.UserID)+"/all", nil, "", f.clientToken))
+	if len(offered) != 1 || offered[0].Display == nil || offered[0].Display.Currency != "LBP" {
+		t.Fatalf("expected the price in the preferred currency, got %+v", offered)
+	}
+}
+
+func TestPriceDecimalsFollowCurrency(t *testing.T) {
+	f := seedTransaction(t)
+	offer := map[string]interface{}{
+		"user_offered_id":      f.client.UserID,
+		"user_offering_id":     f.tradesman.UserID,
+		"listing_id":           f.listing.ListingID,
+		"price_with_currency":  1500.5,
+		"currency_code":        "jpy",
+		"job_start_date":       "2025-01-10",
+		"job_end_date":         "2025-01-20",
+		"details_from_offered": "Bathroom floor",
+	}
+	expectStatus(t, f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", offer, f.clientToken), http.StatusBadRequest)
+
+	offer["price_with_currency"] = 1500
+	rec := f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", offer, f.clientToken)
+	expectStatus(t, rec, http.StatusCreated)
+	var created Services.Transaction
+	decode(t, rec, &created)
+	if created.CurrencyCode != "JPY" || created.Price != 1500 {
+		t.Fatalf("expected a normalised JPY price, got %+v", created)
+	}
+
+	offer["currency_code"] = "YEN"
+	expectStatus(t, f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", offer, f.clientToken), http.StatusBadRequest)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// withFavouriteCounts fills in how many users saved each of an owner's listings
+func (app *application) withFavouriteCounts(r *http.Request, ownerID int, listings []Services.Listing) ([]Services.Listing, error) {
+	counts, err := app.Service.Favourites.ListingCounts(r.Context(), ownerID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range listings {
+		listings[i].FavouriteCount = counts[listings[i].ListingID]
+	}
+	return listings, nil
+}
+
+// favouriteTarget returns the kind and target_id URL parameters
+func favouriteTarget(r *http.Request) (string, int, error) {
+	kind := chi.URLParam(r, "kind")
+	if kind != Services.FavouriteListing && kind != Services.FavouriteUser {
+		return "", 0, Services.Invalid("kind", "must be one of listing, user")
+	}
+	targetID, err := intParam(r, "target_id")
+	return kind, targetID, err
+}
+
+// addItem adds the listing or user in the URL to the caller's favourites (shortlistID 0) or one of their shortlists.
+// Only listings and users the caller can currently see may be added.
+func (app *application) addItem(r *http.Request, userID, shortlistID int) error {
+	kind, targetID, err := favouriteTarget(r)
+	if err != nil {
+		return err
+	}
+
+	// The favourite counts in the analytics of the listing's owner, or of the user favourited
+	ownerID, listingID := targetID, 0
+	if kind == Services.FavouriteListing {
+		listing, err := app.Service.Listings.GetByID(r.Context(), targetID)
+		if err != nil {
+			return err
+		}
+		if listing.Status == Services.ListingDraft && listing.UserID != userID {
+			return fmt.Errorf("listing %w", Services.ErrNotFound)
+		}
+		ownerID, listingID = listing.UserID, listing.ListingID
+	} else {
+		user, err := app.Service.Users.GetById(r.Context(), targetID)
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt != "" {
+			return fmt.Errorf("user %w", Services.ErrNotFound)
+		}
+	}
+
+	if err := app.Service.Favourites.Add(r.Context(), userID, shortlistID, kind, targetID); err != nil {
+		return err
+	}
+	if ownerID != userID {
+		app.track(Services.EventFavourite, ownerID, listingID)
+	}
+	return nil
+}
+
+// removeItem takes the listing or user in the URL out of the caller's favourites (shortlistID 0) or one of their shortlists
+func (app *application) removeItem(r *http.Request, userID, shortlistID int) error {
+	kind, targetID, err := favouriteTarget(r)
+	if err != nil {
+		return err
+	}
+	return app.Service.Favourites.Remove(r.Context(), userID, shortlistID, kind, targetID)
+}
+
+// resolveItems fills in the listings and users of saved items as the caller may see them now.
+// Items that are gone or no longer open keep their place with a notice.
+func (app *application) resolveItems(r *http.Request, items []Services.ShortlistItem) ([]Services.ShortlistItem, error) {
+	for i, item := range items {
+		if item.Kind == Services.FavouriteListing {
+			listing, err := app.Service.Listings.GetByID(r.Context(), item.ListingID)
+			if errors.Is(err, Services.ErrNotFound) {
+				items[i].Notice = "This listing is no longer available"
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch listing.Status {
+			case Services.ListingExpired:
+				items[i].Notice = "This listing has expired"
+			case Services.ListingPaused:
+				items[i].Notice = "This listing is paused"
+			case Services.ListingClosed:
+				items[i].Notice = "This listing is closed"
+			}
+			items[i].Listing = &listing
+			continue
+		}
+
+		user, err := app.Service.Users.GetById(r.Context(), item.UserID)
+		if errors.Is(err, Services.ErrNotFound) {
+			items[i].Notice = "This user no longer exists"
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		profiles, err := app.profiles(r, []Services.User{user})
+		if err != nil {
+			return nil, err
+		}
+		if user.DeletedAt != "" {
+			items[i].Notice = "This account has been closed"
+		}
+		items[i].User = &profiles[0]
+	}
+	return items, nil
+}
+
+// favourite handles the request to add a listing or user to the caller's favourites.
+func (app *application) favourite(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.addItem(r, tokenUserId, 0)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unfavourite handles the request to remove a listing or user from the caller's favourites.
+func (app *application) unfavourite(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.removeItem(r, tokenUserId, 0)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFavourites handles the request to list the caller's favourite listings and users, most recently added first.
+func (app *application) getFavourites(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	items, err := app.Service.Favourites.Items(r.Context(), tokenUserId, 0)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	items, err = app.resolveItems(r, items)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(items)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// createShortlist handles the request to create a named shortlist for the caller.
+func (app *application) createShortlist(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var shortlist Services.Shortlist
+	err = decodeJSON(r, &shortlist)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	shortlist.UserID = tokenUserId
+
+	created, err := app.Service.Favourites.CreateShortlist(r.Context(), &shortlist)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getShortlists handles the request to list the caller's shortlists with their items.
+func (app *application) getShortlists(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	shortlists, err := app.Service.Favourites.GetShortlists(r.Context(), tokenUserId)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	for i := range shortlists {
+		shortlists[i], err = app.withItems(r, shortlists[i])
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(shortlists)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// ownShortlist returns the shortlist in the id URL parameter if it belongs to the caller.
+// Other users' shortlists are reported as not found.
+func (app *application) ownShortlist(r *http.Request) (Services.Shortlist, error) {
+	shortlistID, err := intParam(r, "id")
+	if err != nil {
+		return Services.Shortlist{}, err
+	}
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		return Services.Shortlist{}, err
+	}
+
+	shortlist, err := app.Service.Favourites.GetShortlist(r.Context(), shortlistID)
+	if err != nil {
+		return Services.Shortlist{}, err
+	}
+	if shortlist.UserID != tokenUserId {
+		return Services.Shortlist{}, fmt.Errorf("shortlist %w", Services.ErrNotFound)
+	}
+	return shortlist, nil
+}
+
+// withItems fills in the resolved items of a shortlist
+func (app *application) withItems(r *http.Request, shortlist Services.Shortlist) (Services.Shortlist, error) {
+	items, err := app.Service.Favourites.Items(r.Context(), shortlist.UserID, shortlist.ShortlistID)
+	if err != nil {
+		return shortlist, err
+	}
+	shortlist.Items, err = app.resolveItems(r, items)
+	return shortlist, err
+}
+
+// getShortlist handles the request to get one of the caller's shortlists with its items.
+func (app *application) getShortlist(w http.ResponseWriter, r *http.Request) {
+	shortlist, err := app.ownShortlist(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	shortlist, err = app.withItems(r, shortlist)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(shortlist)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// updateShortlist handles the request to rename one of the caller's shortlists.
+func (app *application) updateShortlist(w http.ResponseWriter, r *http.Request) {
+	stored, err := app.ownShortlist(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var shortlist Services.Shortlist
+	err = decodeJSON(r, &shortlist)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.Service.Favourites.RenameShortlist(r.Context(), stored.ShortlistID, shortlist.Name)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	stored.Name = shortlist.Name
+
+	stored, err = app.withItems(r, stored)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(stored)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// deleteShortlist handles the request to delete one of the caller's shortlists and its items.
+func (app *application) deleteShortlist(w http.ResponseWriter, r *http.Request) {
+	shortlist, err := app.ownShortlist(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.Service.Favourites.DeleteShortlist(r.Context(), shortlist.ShortlistID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addShortlistItem handles the request to add a listing or user to one of the caller's shortlists.
+func (app *application) addShortlistItem(w http.ResponseWriter, r *http.Request) {
+	shortlist, err := app.ownShortlist(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.addItem(r, shortlist.UserID, shortlist.ShortlistID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeShortlistItem handles the request to remove a listing or user from one of the caller's shortlists.
+func (app *application) removeShortlistItem(w http.ResponseWriter, r *http.Request) {
+	shortlist, err := app.ownShortlist(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.removeItem(r, shortlist.UserID, shortlist.ShortlistID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
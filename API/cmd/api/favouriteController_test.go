@@ -0,0 +1,152 @@
+package main
+
+import (
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestFavourites(t *testing.T) {
+	s := newTestServer(t)
+	owner, ownerToken := s.createUser("Owner", "+96170000001")
+	tradesman, _ := s.createUser("Tradesman", "+96170000002")
+	_, clientToken := s.createUser("Client", "+96170000003")
+	_, otherToken := s.createUser("Other", "+96170000004")
+	listing := s.createListing(owner.UserID, "Offer", "Tiling", 35.5018, 33.8938)
+	listingPath := "/api/v1/favourite/listing/" + strconv.Itoa(listing.ListingID)
+	userPath := "/api/v1/favourite/user/" + strconv.Itoa(tradesman.UserID)
+
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/favourite/image/1", nil, "", clientToken), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/favourite/listing/9999", nil, "", clientToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodPut, listingPath, nil, "", ""), http.StatusUnauthorized)
+
+	// Favouriting twice keeps one entry
+	expectStatus(t, s.do(http.MethodPut, listingPath, nil, "", clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPut, listingPath, nil, "", clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPut, userPath, nil, "", clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPut, listingPath, nil, "", otherToken), http.StatusNoContent)
+
+	var items []Services.ShortlistItem
+	rec := s.do(http.MethodGet, "/api/v1/favourite/favourites", nil, "", clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &items)
+	if len(items) != 2 || items[0].Kind != Services.FavouriteUser || items[0].User == nil || items[0].User.UserID != tradesman.UserID ||
+		items[1].Listing == nil || items[1].Listing.Title != "Tiling" || items[1].Notice != "" {
+		t.Fatalf("unexpected favourites %+v", items)
+	}
+
+	// Only the owner sees how many users saved the listing
+	var seen Services.Listing
+	rec = s.do(http.MethodGet, "/api/v1/listing/listingId/"+strconv.Itoa(listing.ListingID), nil, "", ownerToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &seen)
+	if seen.FavouriteCount != 2 {
+		t.Fatalf("expected 2 favourites for the owner, got %+v", seen)
+	}
+	byUser := "/api/v1/listing/listings/user/" + strconv.Itoa(owner.UserID) + "/all"
+	if listings := decodeListings(t, s.do(http.MethodGet, byUser, nil, "", ownerToken)); len(listings) != 1 || listings[0].FavouriteCount != 2 {
+		t.Fatalf("expected 2 favourites in the owner's listings, got %+v", listings)
+	}
+	if listings := decodeListings(t, s.do(http.MethodGet, byUser, nil, "", clientToken)); len(listings) != 1 || listings[0].FavouriteCount != 0 {
+		t.Fatalf("favourite count leaks to other users: %+v", listings)
+	}
+
+	// Gone listings stay in the favourites with a notice
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/listing/status/"+strconv.Itoa(listing.ListingID)+"/paused", nil, "", ownerToken), http.StatusOK)
+	rec = s.do(http.MethodGet, "/api/v1/favourite/favourites", nil, "", clientToken)
+	items = nil
+	decode(t, rec, &items)
+	if items[1].Notice != "This listing is paused" || items[1].Listing == nil {
+		t.Fatalf("expected a paused notice, got %+v", items[1])
+	}
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/listing/delete/"+strconv.Itoa(listing.ListingID), nil, "", ownerToken), http.StatusNoContent)
+	rec = s.do(http.MethodGet, "/api/v1/favourite/favourites", nil, "", clientToken)
+	items = nil
+	decode(t, rec, &items)
+	if len(items) != 2 || items[1].Notice != "This listing is no longer available" || items[1].Listing != nil || items[1].ListingID != listing.ListingID {
+		t.Fatalf("expected a removed notice, got %+v", items[1])
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, listingPath, nil, "", clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, listingPath, nil, "", clientToken), http.StatusNotFound)
+	rec = s.do(http.MethodGet, "/api/v1/favourite/favourites", nil, "", clientToken)
+	items = nil
+	decode(t, rec, &items)
+	if len(items) != 1 || items[0].Kind != Services.FavouriteUser {
+		t.Fatalf("expected only the tradesman left, got %+v", items)
+	}
+}
+
+func TestShortlists(t *testing.T) {
+	s := newTestServer(t)
+	owner, ownerToken := s.createUser("Owner", "+96170000001")
+	tradesman, tradesmanToken := s.createUser("Tradesman", "+96170000002")
+	_, clientToken := s.createUser("Client", "+96170000003")
+	_, otherToken := s.createUser("Other", "+96170000004")
+	listing := s.createListing(owner.UserID, "Offer", "Kitchen tiling", 35.5018, 33.8938)
+
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/shortlist/create", map[string]interface{}{}, clientToken), http.StatusBadRequest)
+	rec := s.doJSON(http.MethodPost, "/api/v1/shortlist/create", map[string]interface{}{"name": "Kitchen renovation"}, clientToken)
+	expectStatus(t, rec, http.StatusCreated)
+	var shortlist Services.Shortlist
+	decode(t, rec, &shortlist)
+	if shortlist.ShortlistID == 0 || shortlist.Name != "Kitchen renovation" || len(shortlist.Items) != 0 {
+		t.Fatalf("unexpected shortlist %+v", shortlist)
+	}
+	id := strconv.Itoa(shortlist.ShortlistID)
+	listingItem := "/api/v1/shortlist/item/" + id + "/listing/" + strconv.Itoa(listing.ListingID)
+	userItem := "/api/v1/shortlist/item/" + id + "/user/" + strconv.Itoa(tradesman.UserID)
+
+	// Other users cannot see or change the shortlist
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/shortlist/shortlistId/"+id, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodPut, listingItem, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/shortlist/update/"+id, map[string]interface{}{"name": "Mine"}, otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/shortlist/delete/"+id, nil, "", otherToken), http.StatusNotFound)
+
+	expectStatus(t, s.do(http.MethodPut, listingItem, nil, "", clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPut, userItem, nil, "", clientToken), http.StatusNoContent)
+
+	// Shortlisted items are not favourites
+	var favourites []Services.ShortlistItem
+	rec = s.do(http.MethodGet, "/api/v1/favourite/favourites", nil, "", clientToken)
+	decode(t, rec, &favourites)
+	if len(favourites) != 0 {
+		t.Fatalf("shortlist items leak into favourites: %+v", favourites)
+	}
+
+	rec = s.doJSON(http.MethodPut, "/api/v1/shortlist/update/"+id, map[string]interface{}{"name": "Kitchen and bathroom"}, clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &shortlist)
+	if shortlist.Name != "Kitchen and bathroom" || len(shortlist.Items) != 2 {
+		t.Fatalf("unexpected renamed shortlist %+v", shortlist)
+	}
+
+	// Closed accounts and deleted listings keep their place with a notice
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/user/delete/"+strconv.Itoa(tradesman.UserID), nil, "", tradesmanToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/listing/delete/"+strconv.Itoa(listing.ListingID), nil, "", ownerToken), http.StatusNoContent)
+	rec = s.do(http.MethodGet, "/api/v1/shortlist/shortlistId/"+id, nil, "", clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	shortlist = Services.Shortlist{}
+	decode(t, rec, &shortlist)
+	if len(shortlist.Items) != 2 || shortlist.Items[0].Notice != "This account has been closed" || shortlist.Items[1].Notice != "This listing is no longer available" {
+		t.Fatalf("expected notices for gone items, got %+v", shortlist.Items)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, listingItem, nil, "", clientToken), http.StatusNoContent)
+	var shortlists []Services.Shortlist
+	rec = s.do(http.MethodGet, "/api/v1/shortlist/shortlists", nil, "", clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &shortlists)
+	if len(shortlists) != 1 || len(shortlists[0].Items) != 1 {
+		t.Fatalf("unexpected shortlists %+v", shortlists)
+	}
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/shortlist/delete/"+id, nil, "", clientToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, userItem, nil, "", clientToken), http.StatusNotFound)
+	rec = s.do(http.MethodGet, "/api/v1/shortlist/shortlists", nil, "", clientToken)
+	decode(t, rec, &shortlists)
+	if len(shortlists) != 0 {
+		t.Fatalf("expected no shortlists left, got %+v", shortlists)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Media types of the GeoJSON responses
+const (
+	geoJSONType    = "application/geo+json"
+	geoJSONSeqType = "application/x-ndjson"
+)
+
+// wantsGeoJSON reports whether the Accept header asks for GeoJSON
+func wantsGeoJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && mediaType == geoJSONType {
+			return true
+		}
+	}
+	return false
+}
+
+// featureProperties returns the listing properties asked for with ?properties=, or the configured ones
+func (app *application) featureProperties(r *http.Request) ([]string, error) {
+	value := r.URL.Query().Get("properties")
+	if value == "" {
+		return app.config.listings.geoJSONProperties, nil
+	}
+	properties := strings.Split(value, ",")
+	for i := range properties {
+		properties[i] = strings.TrimSpace(properties[i])
+	}
+	return properties, Services.CheckListingProperties(properties)
+}
+
+// preciseFor reports which listings the caller may see at their exact point: only their own.
+// Routes without OptionalAuth never have a caller, so every point is fuzzed.
+func preciseFor(r *http.Request) func(Services.Listing) bool {
+	viewerID, _ := authUserID(r)
+	return func(listing Services.Listing) bool {
+		return viewerID != 0 && listing.UserID == viewerID
+	}
+}
+
+// writeGeoJSON encodes a GeoJSON value, or reports err
+func (app *application) writeGeoJSON(w http.ResponseWriter, r *http.Request, v interface{}, err error) {
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", geoJSONType)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// writeListings responds with listings as JSON, or as a GeoJSON FeatureCollection when the client asks for it.
+// Either way only the caller's own listings keep their exact point.
+func (app *application) writeListings(w http.ResponseWriter, r *http.Request, listings []Services.Listing) {
+	listings = Services.FuzzListings(listings, preciseFor(r))
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		properties, err := app.featureProperties(r)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		collection, err := Services.ListingCollection(listings, properties)
+		app.writeGeoJSON(w, r, collection, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(listings)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// writeListing responds with a listing as JSON, or as a GeoJSON Feature when the client asks for it.
+// Either way only the caller's own listing keeps its exact point.
+func (app *application) writeListing(w http.ResponseWriter, r *http.Request, listing Services.Listing) {
+	listing = Services.FuzzListings([]Services.Listing{listing}, preciseFor(r))[0]
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		properties, err := app.featureProperties(r)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		feature, err := Services.ListingFeature(listing, properties)
+		app.writeGeoJSON(w, r, feature, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(listing)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// writeMapView responds with a map view as JSON, or as a GeoJSON FeatureCollection when the client asks for it.
+// Either way clusters and other users' listings are fuzzed.
+func (app *application) writeMapView(w http.ResponseWriter, r *http.Request, view Services.MapView) {
+	view = Services.FuzzMapView(view, preciseFor(r))
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		properties, err := app.featureProperties(r)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		collection, err := Services.MapViewCollection(view, properties)
+		app.writeGeoJSON(w, r, collection, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(view)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// ExportListings handles the request to stream every published listing as newline-delimited GeoJSON features.
+// Points are always fuzzed.
+func (app *application) ExportListings(w http.ResponseWriter, r *http.Request) {
+	properties, err := app.featureProperties(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	listingType := chi.URLParam(r, "type")
+
+	w.Header().Set("Content-Type", geoJSONSeqType)
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	flusher, _ := w.(http.Flusher)
+	written := 0
+	err = app.Service.Listings.EachListed(r.Context(), listingType, func(listing Services.Listing) error {
+		listing.Location = Services.FuzzLocation(listing.Location)
+		feature, err := Services.ListingFeature(listing, properties)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(feature); err != nil {
+			return err
+		}
+		// Push every few hundred features to the client rather than holding the export in memory
+		if written++; written%500 == 0 && flusher != nil {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && written == 0 {
+		w.Header().Del("Content-Type")
+		app.respondError(w, r, err)
+		return
+	}
+	if err != nil {
+		// The status line is gone; cutting the stream short is all that is left
+		log.Printf("listing export stopped after %d features: %v", written, err)
+		return
+	}
+	out.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// pngHeader is enough of a PNG file for content type detection
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+
+// upload posts a single multipart file to path
+func (s *testServer) upload(path, fileName, token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("images", fileName)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	part.Write(pngHeader)
+	writer.Close()
+
+	return s.do(http.MethodPost, path, &body, writer.FormDataContentType(), token)
+}
+
+// seedImages uploads one listing image and returns it
+func seedImages(t *testing.T) (*testServer, Services.User, string, Services.Image) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+	listing := s.createListing(user.UserID, "Offer", "Tiling", 35.5, 33.9)
+
+	expectStatus(t, s.upload("/api/v1/image/uploadForListing/"+strconv.Itoa(listing.ListingID), "tiles.png", token), http.StatusOK)
+
+	images, err := s.app.Service.Images.GetImagesByListingID(context.Background(), listing.ListingID)
+	if err != nil || len(images) != 1 {
+		t.Fatalf("expected one stored image, got %v %v", images, err)
+	}
+	return s, user, token, images[0]
+}
+
+func TestCreateListingImage(t *testing.T) {
+	s, _, token, image := seedImages(t)
+	if !image.ShowOnProfile {
+		t.Fatalf("expected listing image to show on profile, got %+v", image)
+	}
+
+	expectStatus(t, s.upload("/api/v1/image/uploadForListing/"+strconv.Itoa(image.ListingID), "notes.txt", token), http.StatusBadRequest)
+
+	_, otherToken := s.createUser("Rami", "+96170000002")
+	expectStatus(t, s.upload("/api/v1/image/uploadForListing/"+strconv.Itoa(image.ListingID), "tiles.png", otherToken), http.StatusForbidden)
+}
+
+func TestCreateProfileImage(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+
+	expectStatus(t, s.upload("/api/v1/image/uploadProfilePicture/"+strconv.Itoa(user.UserID), "me.png", token), http.StatusOK)
+
+	updated, _ := s.app.Service.Users.GetById(context.Background(), user.UserID)
+	if updated.ImageId == "" || updated.ImageId == "0" {
+		t.Fatalf("expected profile image to be set, got %+v", updated)
+	}
+}
+
+func TestGetImageByID(t *testing.T) {
+	s, _, _, image := seedImages(t)
+
+	rec := s.do(http.MethodGet, "/api/v1/image/imageId/"+strconv.Itoa(image.ImageID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected image/png, got %q", rec.Header().Get("Content-Type"))
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/image/imageId/abc", nil, "", ""), http.StatusBadRequest)
+}
+
+func TestGetImageByUUID(t *testing.T) {
+	s, _, _, image := seedImages(t)
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/image/image/"+image.URL, nil, "", ""), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/image/image/missing.png", nil, "", ""), http.StatusNotFound)
+}
+
+func TestGetImagesByListingID(t *testing.T) {
+	s, _, _, image := seedImages(t)
+
+	rec := s.do(http.MethodGet, "/api/v1/image/listing/"+strconv.Itoa(image.ListingID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var images []Services.Image
+	decode(t, rec, &images)
+	if len(images) != 1 || images[0].ImageID != image.ImageID {
+		t.Fatalf("unexpected images %+v", images)
+	}
+}
+
+func TestGetImagesByUserID(t *testing.T) {
+	s, user, token, _ := seedImages(t)
+
+	rec := s.do(http.MethodGet, "/api/v1/image/user/"+strconv.Itoa(user.UserID), nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+
+	var images []Services.Image
+	decode(t, rec, &images)
+	if len(images) != 1 {
+		t.Fatalf("expected 1 image, got %+v", images)
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/image/user/"+strconv.Itoa(user.UserID), nil, "", ""), http.StatusUnauthorized)
+}
+
+func TestUpdateImageAndProfileImages(t *testing.T) {
+	s, user, token, image := seedImages(t)
+	profilePath := "/api/v1/image/profile/" + strconv.Itoa(user.UserID)
+
+	var images []Services.Image
+	rec := s.do(http.MethodGet, profilePath, nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &images)
+	if len(images) != 1 {
+		t.Fatalf("expected image on profile, got %+v", images)
+	}
+
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/image/update/"+strconv.Itoa(image.ImageID)+"/2", nil, "", token), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/image/update/"+strconv.Itoa(image.ImageID)+"/0", nil, "", token), http.StatusOK)
+
+	images = nil
+	rec = s.do(http.MethodGet, profilePath, nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &images)
+	if len(images) != 0 {
+		t.Fatalf("expected no profile images, got %+v", images)
+	}
+}
+
+func TestDeleteImage(t *testing.T) {
+	s, _, token, image := seedImages(t)
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/image/delete/"+strconv.Itoa(image.ImageID), nil, "", token), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/image/image/"+image.URL, nil, "", ""), http.StatusNotFound)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/PDF"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"github.com/go-chi/chi/v5"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Formats invoices are served in besides JSON, picked with the Accept header
+const (
+	htmlType = "text/html"
+	pdfType  = "application/pdf"
+	csvType  = "text/csv"
+)
+
+// parseTaxRates reads tax percentages per country written as "Lebanon=11,France=20"
+func parseTaxRates(value string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		country, rate, ok := strings.Cut(pair, "=")
+		percent, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if !ok || err != nil || percent < 0 || strings.TrimSpace(country) == "" {
+			return nil, fmt.Errorf("tax rates must be written as Country=percent, got %q", pair)
+		}
+		rates[strings.TrimSpace(country)] = percent
+	}
+	return rates, nil
+}
+
+// accepted returns the first of the offered media types the client accepts, or "" for none
+func accepted(r *http.Request, offered ...string) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		for _, offer := range offered {
+			if mediaType == offer {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+// finishTransaction closes the listing a completed transaction was for, unless it is already
+// closed or gone, and invoices the transaction
+func (app *application) finishTransaction(ctx context.Context, transactionID, listingID int) error {
+	err := app.Service.Listings.SetStatus(ctx, listingID, Services.ListingClosed)
+	if err != nil && !errors.Is(err, Services.ErrConflict) && !errors.Is(err, Services.ErrNotFound) {
+		return err
+	}
+	_, err = app.issueInvoice(ctx, transactionID)
+	return err
+}
+
+// issueInvoice invoices a Completed transaction, unless it already has an invoice
+func (app *application) issueInvoice(ctx context.Context, transactionID int) (Services.Invoice, error) {
+	invoice, err := app.Service.Invoices.GetByTransaction(ctx, transactionID)
+	if !errors.Is(err, Services.ErrNotFound) {
+		return invoice, err
+	}
+
+	source := Services.InvoiceSource{}
+	source.Transaction, err = app.Service.Transactions.GetByID(ctx, transactionID)
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+	source.Milestones, err = app.Service.Milestones.GetByTransaction(ctx, transactionID)
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+	payment, err := app.Service.Payments.GetByTransaction(ctx, transactionID)
+	if err == nil {
+		source.Payment = &payment
+	} else if !errors.Is(err, Services.ErrNotFound) {
+		return Services.Invoice{}, err
+	}
+	source.Tradesman, err = app.Service.Users.GetById(ctx, source.Transaction.UserOfferingID)
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+	source.Client, err = app.Service.Users.GetById(ctx, source.Transaction.UserOfferedID)
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+	// A deleted listing still names the job
+	source.Listing, err = app.Service.Listings.GetByID(ctx, source.Transaction.ListingID)
+	if err != nil && !errors.Is(err, Services.ErrNotFound) {
+		return Services.Invoice{}, err
+	}
+
+	invoice, err = Services.DraftInvoice(source, app.config.invoices.taxRates)
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+	return app.Service.Invoices.Issue(ctx, invoice)
+}
+
+// partyInvoice returns an invoice when the caller is its tradesman or client; others are told it does not exist
+func (app *application) partyInvoice(r *http.Request) (Services.Invoice, error) {
+	invoiceID, err := intParam(r, "id")
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return Services.Invoice{}, err
+	}
+
+	invoice, err := app.Service.Invoices.GetByID(r.Context(), invoiceID)
+	if err == nil && invoice.TradesmanID != tokenUserID && invoice.ClientID != tokenUserID {
+		err = fmt.Errorf("invoice %w", Services.ErrNotFound)
+	}
+	return invoice, err
+}
+
+// invoicePDF lays an invoice or its receipt out as a PDF
+func invoicePDF(invoice Services.Invoice, receipt bool) []byte {
+	var doc PDF.Document
+	money := func(amount float64) string {
+		return fmt.Sprintf("%.2f %s", amount, invoice.Currency)
+	}
+
+	if receipt {
+		doc.Heading("Receipt for invoice " + invoice.Reference)
+	} else {
+		doc.Heading("Invoice " + invoice.Reference)
+	}
+	doc.Blank()
+	doc.Line("Issued on " + invoice.DateIssued)
+	doc.Line("From: " + invoice.TradesmanName)
+	doc.Line("To: " + invoice.ClientName)
+	doc.Line("Job: " + invoice.ListingTitle)
+	doc.Blank()
+	for _, item := range invoice.Items {
+		doc.Line(fmt.Sprintf("%d. %s: %s", item.Position, item.Description, money(item.Amount)))
+	}
+	doc.Blank()
+	doc.Line("Subtotal: " + money(invoice.Subtotal))
+	if invoice.TaxCountry != "" {
+		doc.Line(fmt.Sprintf("Tax (%s, %g%%): %s", invoice.TaxCountry, invoice.TaxRate, money(invoice.Tax)))
+	} else {
+		doc.Line("Tax: " + money(invoice.Tax))
+	}
+	doc.Line("Total: " + money(invoice.Total))
+	doc.Line("Platform fee: " + money(invoice.PlatformFee))
+	doc.Line("Paid to the tradesman: " + money(invoice.Payout))
+	doc.Blank()
+	if receipt {
+		doc.Line("Paid in full on " + invoice.DatePaid + ". Received from " + invoice.ClientName + " with thanks.")
+	} else {
+		doc.Line("Prices include tax.")
+	}
+	return doc.Bytes()
+}
+
+// writeInvoice responds with an invoice or its receipt as JSON, HTML or PDF, as the client asks with the Accept header
+func (app *application) writeInvoice(w http.ResponseWriter, r *http.Request, invoice Services.Invoice, receipt bool) {
+	w.Header().Add("Vary", "Accept")
+	name := invoice.Reference
+	if receipt {
+		name = "receipt-" + invoice.Reference
+	}
+
+	switch accepted(r, htmlType, pdfType) {
+	case pdfType:
+		w.Header().Set("Content-Type", pdfType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.pdf"`)
+		w.Write(invoicePDF(invoice, receipt))
+		return
+	case htmlType:
+		page, err := Utils.ReadFileAsString("./Texts/Invoice.html")
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		tmpl, err := template.New("invoice").Parse(page)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		var out bytes.Buffer
+		err = tmpl.Execute(&out, struct {
+			Invoice Services.Invoice
+			Receipt bool
+		}{invoice, receipt})
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", htmlType+"; charset=utf-8")
+		w.Write(out.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(invoice)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// createInvoice handles the request to invoice a Completed transaction the caller is part of.
+// Transactions are invoiced when they complete, so this returns their invoice, issuing it
+// only for transactions completed before invoicing existed.
+func (app *application) createInvoice(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err == nil && transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
+		err = fmt.Errorf("transaction %w", Services.ErrNotFound)
+	}
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	invoice, err := app.issueInvoice(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.writeInvoice(w, r, invoice, false)
+}
+
+// getInvoice handles the request to get an invoice the caller is party to, as JSON, HTML or PDF.
+func (app *application) getInvoice(w http.ResponseWriter, r *http.Request) {
+	invoice, err := app.partyInvoice(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.writeInvoice(w, r, invoice, false)
+}
+
+// getReceipt handles the request to get the receipt of a paid invoice the caller is party to, as JSON, HTML or PDF.
+func (app *application) getReceipt(w http.ResponseWriter, r *http.Request) {
+	invoice, err := app.partyInvoice(r)
+	if err == nil && invoice.DatePaid == "" {
+		err = fmt.Errorf("nothing was paid on this invoice: %w", Services.ErrNotFound)
+	}
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.writeInvoice(w, r, invoice, true)
+}
+
+// getInvoices handles the tradesman's request to list the invoices they issued between two dates, both included.
+// Accepting text/csv downloads them as a spreadsheet for bookkeeping, one row per invoice.
+func (app *application) getInvoices(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	invoices, err := app.Service.Invoices.GetByTradesman(r.Context(), tokenUserID, chi.URLParam(r, "from"), chi.URLParam(r, "to"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if accepted(r, csvType) == csvType {
+		w.Header().Set("Content-Type", csvType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="invoices-`+chi.URLParam(r, "from")+`-`+chi.URLParam(r, "to")+`.csv"`)
+		out := csv.NewWriter(w)
+		out.Write([]string{"reference", "date_issued", "date_paid", "client", "job", "currency", "subtotal", "tax_rate", "tax", "total", "platform_fee", "payout"})
+		for _, invoice := range invoices {
+			amount := func(value float64) string { return strconv.FormatFloat(value, 'f', 2, 64) }
+			out.Write([]string{invoice.Reference, invoice.DateIssued, invoice.DatePaid, invoice.ClientName, invoice.ListingTitle, invoice.Currency,
+				amount(invoice.Subtotal), strconv.FormatFloat(invoice.TaxRate, 'f', -1, 64), amount(invoice.Tax), amount(invoice.Total),
+				amount(invoice.PlatformFee), amount(invoice.Payout)})
+		}
+		out.Flush()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(invoices)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accepting sends a GET asking for one media type with the Accept header
+func (s *testServer) accepting(path, mediaType, token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept", mediaType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// complete accepts and completes the fixture's transaction, returning the invoice it was issued
+func (f transactionFixture) complete(t *testing.T) Services.Invoice {
+	t.Helper()
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	expectStatus(t, f.setStatus("Completed"), http.StatusNoContent)
+
+	rec := f.s.do(http.MethodPost, "/api/v1/invoice/issue/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	var invoice Services.Invoice
+	decode(t, rec, &invoice)
+	return invoice
+}
+
+func TestParseTaxRates(t *testing.T) {
+	rates, err := parseTaxRates(" Lebanon=11, France=20 ,")
+	if err != nil || rates["Lebanon"] != 11 || rates["France"] != 20 || len(rates) != 2 {
+		t.Fatalf("unexpected rates %v, %v", rates, err)
+	}
+	if rates, err := parseTaxRates(""); err != nil || len(rates) != 0 {
+		t.Fatalf("expected no rates, got %v, %v", rates, err)
+	}
+	for _, value := range []string{"Lebanon", "Lebanon=x", "Lebanon=-1", "=11"} {
+		if _, err := parseTaxRates(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestCompletingIssuesAnInvoice(t *testing.T) {
+	f := seedTransaction(t)
+	_, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	issue := "/api/v1/invoice/issue/" + strconv.Itoa(f.transaction.TransactionID)
+
+	// Only Completed transactions are invoiced, and only for their parties
+	expectStatus(t, f.s.do(http.MethodPost, issue, nil, "", f.clientToken), http.StatusConflict)
+	expectStatus(t, f.s.do(http.MethodPost, issue, nil, "", outsiderToken), http.StatusNotFound)
+
+	invoice := f.complete(t)
+	want := Services.Invoice{TransactionID: f.transaction.TransactionID, TradesmanID: f.tradesman.UserID, ClientID: f.client.UserID,
+		Number: 1, Reference: "INV-" + strconv.Itoa(f.tradesman.UserID) + "-000001", ListingTitle: "Tiling", Currency: "USD",
+		TaxCountry: "Lebanon", TaxRate: 11, Tax: 14.91, Subtotal: 135.59, Total: 150.5, PlatformFee: 7.53, Payout: 142.97}
+	if invoice.InvoiceID == 0 || invoice.Number != want.Number || invoice.Reference != want.Reference || invoice.TradesmanID != want.TradesmanID ||
+		invoice.ClientID != want.ClientID || invoice.ListingTitle != want.ListingTitle || invoice.Currency != want.Currency ||
+		invoice.TaxCountry != want.TaxCountry || invoice.TaxRate != want.TaxRate || invoice.DatePaid == "" || invoice.DateIssued == "" {
+		t.Fatalf("unexpected invoice %+v", invoice)
+	}
+	for name, pair := range map[string][2]float64{
+		"tax": {invoice.Tax, want.Tax}, "subtotal": {invoice.Subtotal, want.Subtotal}, "total": {invoice.Total, want.Total},
+		"platform fee": {invoice.PlatformFee, want.PlatformFee}, "payout": {invoice.Payout, want.Payout},
+	} {
+		if math.Abs(pair[0]-pair[1]) > 0.001 {
+			t.Errorf("expected a %s of %.2f, got %.2f", name, pair[1], pair[0])
+		}
+	}
+	if len(invoice.Items) != 1 || invoice.Items[0].Description != "Tiling" || invoice.Items[0].Amount != 150.5 {
+		t.Fatalf("expected the whole job as the only item, got %+v", invoice.Items)
+	}
+
+	// Issuing again returns the same invoice
+	rec := f.s.do(http.MethodPost, issue, nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	var again Services.Invoice
+	decode(t, rec, &again)
+	if again.InvoiceID != invoice.InvoiceID || again.Number != 1 {
+		t.Fatalf("expected the invoice already issued, got %+v", again)
+	}
+
+	path := "/api/v1/invoice/invoiceId/" + strconv.Itoa(invoice.InvoiceID)
+	expectStatus(t, f.s.do(http.MethodGet, path, nil, "", outsiderToken), http.StatusNotFound)
+	rec = f.s.do(http.MethodGet, path, nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	var stored Services.Invoice
+	decode(t, rec, &stored)
+	if stored.Reference != invoice.Reference || len(stored.Items) != 1 {
+		t.Fatalf("unexpected stored invoice %+v", stored)
+	}
+
+	rec = f.s.accepting(path, "text/html", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), invoice.Reference) ||
+		!strings.Contains(rec.Body.String(), "135.59") {
+		t.Fatalf("unexpected HTML invoice %q: %s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	rec = f.s.accepting(path, "application/pdf", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rec.Body.String(), "%PDF") ||
+		!strings.Contains(rec.Header().Get("Content-Disposition"), invoice.Reference+".pdf") {
+		t.Fatalf("unexpected PDF invoice %q %q", rec.Header().Get("Content-Type"), rec.Header().Get("Content-Disposition"))
+	}
+
+	receipt := "/api/v1/invoice/receipt/" + strconv.Itoa(invoice.InvoiceID)
+	expectStatus(t, f.s.do(http.MethodGet, receipt, nil, "", outsiderToken), http.StatusNotFound)
+	rec = f.s.accepting(receipt, "text/html", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), "Paid in full on "+invoice.DatePaid) {
+		t.Fatalf("expected the receipt to acknowledge the payment, got %s", rec.Body.String())
+	}
+}
+
+func TestInvoicesOfMilestones(t *testing.T) {
+	f := seedTransaction(t)
+	milestones := f.planMilestones(t)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	for _, milestone := range milestones {
+		expectStatus(t, f.finish(t, milestone), http.StatusOK)
+	}
+
+	// Approving the last milestone completes the job, which issues its invoice
+	invoice, err := f.s.app.Service.Invoices.GetByTransaction(context.Background(), f.transaction.TransactionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invoice.Items) != 2 || invoice.Items[0].Description != "Remove the old tiles" || invoice.Items[1].Amount != 100 ||
+		math.Abs(invoice.Total-150.5) > 0.001 {
+		t.Fatalf("expected the milestones as items, got %+v", invoice)
+	}
+}
+
+func TestListInvoices(t *testing.T) {
+	f := seedTransaction(t)
+	first := f.complete(t)
+
+	// A second job for the same tradesman takes the next number
+	listing := f.s.createListing(f.tradesman.UserID, "Offer", "Painting", 35.5, 33.9)
+	rec := f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", map[string]interface{}{
+		"user_offered_id":      f.client.UserID,
+		"user_offering_id":     f.tradesman.UserID,
+		"listing_id":           listing.ListingID,
+		"price_with_currency":  80,
+		"currency_code":        "USD",
+		"job_start_date":       "2025-02-01",
+		"job_end_date":         "2025-02-03",
+		"details_from_offered": "Living room walls",
+	}, f.clientToken)
+	expectStatus(t, rec, http.StatusCreated)
+	second := f
+	decode(t, rec, &second.transaction)
+	if invoice := second.complete(t); invoice.Number != 2 || invoice.Reference != "INV-"+strconv.Itoa(f.tradesman.UserID)+"-000002" {
+		t.Fatalf("expected the second invoice to be numbered 2, got %+v", invoice)
+	}
+
+	today := time.Now().UTC()
+	path := "/api/v1/invoice/invoices/" + today.AddDate(0, 0, -1).Format("2006-01-02") + "/" + today.AddDate(0, 0, 1).Format("2006-01-02")
+	rec = f.s.do(http.MethodGet, path, nil, "", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	var invoices []Services.Invoice
+	decode(t, rec, &invoices)
+	if len(invoices) != 2 || invoices[0].InvoiceID != first.InvoiceID || invoices[1].Number != 2 {
+		t.Fatalf("expected both invoices in number order, got %+v", invoices)
+	}
+
+	// The client issued no invoices
+	rec = f.s.do(http.MethodGet, path, nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &invoices)
+	if len(invoices) != 0 {
+		t.Fatalf("expected no invoices for the client, got %+v", invoices)
+	}
+
+	rec = f.s.accepting(path, "text/csv", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") || len(lines) != 3 || !strings.HasPrefix(lines[0], "reference,") ||
+		!strings.HasPrefix(lines[1], first.Reference+",") || !strings.Contains(lines[1], ",150.50,7.53,142.97") {
+		t.Fatalf("unexpected CSV %q:\n%s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/invoice/invoices/2025-13-01/2025-12-31", nil, "", f.tradesToken), http.StatusBadRequest)
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/invoice/invoices/2025-02-01/2025-01-01", nil, "", f.tradesToken), http.StatusBadRequest)
+}
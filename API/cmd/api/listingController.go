@@ -2,20 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
 	"github.com/go-chi/chi/v5"
 	"net/http"
-	"strconv"
+	"slices"
 )
 
 // GetAllListings handles the request to get all listings, optionally filtering by type.
-//	@Summary		Get all listings
-//	@Description	Retrieve a list of all listings, optionally filtered by type.
-//	@Tags			Listings
-//	@Param			type	query		string				false	"Listing type"	Enums(offer, request)
-//	@Success		200		{array}		Services.Listing	"List of listings"
-//	@Failure		500		{string}	string				"Internal Server Error"
-//	@Router			/listings [get]
 func (app *application) GetAllListings(w http.ResponseWriter, r *http.Request) {
 	// Extract optional 'type' query parameter
 	listingType := chi.URLParam(r, "type")
@@ -23,71 +17,59 @@ func (app *application) GetAllListings(w http.ResponseWriter, r *http.Request) {
 	// Call the service method to get all listings, optionally filtered by type
 	listings, err := app.Service.Listings.GetAll(r.Context(), listingType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := app.boostListings(r.Context(), listings); err != nil {
+		app.respondError(w, r, err)
+		return
 	}
+
+	app.writeListings(w, r, listings)
 }
 
 // GetListingByID handles the request to get a listing by its ID.
-//	@Summary		Get a listing by ID
-//	@Description	Retrieve a listing by its unique ID.
-//	@Tags			Listings
-//	@Param			id	path		int					true	"Listing ID"
-//	@Success		200	{object}	Services.Listing	"Detailed listing"
-//	@Failure		400	{string}	string				"Invalid listing ID"
-//	@Failure		404	{string}	string				"Listing not found"
-//	@Failure		500	{string}	string				"Internal Server Error"
-//	@Router			/listings/{id} [get]
 func (app *application) GetListingByID(w http.ResponseWriter, r *http.Request) {
 	// Extract listing ID from the URL
-	listingIDStr := chi.URLParam(r, "id")
-	listingID, err := strconv.Atoi(listingIDStr)
+	listingID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Call service to get the listing by ID
 	listing, err := app.Service.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
-	if listing.ListingID == 0 {
-		http.Error(w, "Listing not found", http.StatusNotFound)
+	// Drafts are only visible to their owner; the route is behind OptionalAuth
+	viewerID, _ := authUserID(r)
+	if listing.Status == Services.ListingDraft && listing.UserID != viewerID {
+		app.respondError(w, r, fmt.Errorf("listing %w", Services.ErrNotFound))
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listing)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if listing.UserID == viewerID {
+		listings, err := app.withFavouriteCounts(r, viewerID, []Services.Listing{listing})
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		listing = listings[0]
+	} else {
+		app.track(Services.EventListingView, listing.UserID, listing.ListingID)
 	}
+
+	app.writeListing(w, r, listing)
 }
 
 // GetListingsByUserID handles getting listings by user ID and type.
-//	@Summary		Get listings by user ID
-//	@Description	Retrieve listings created by a specific user, optionally filtered by type.
-//	@Tags			Listings
-//	@Param			user_id	path		int					true	"User ID"
-//	@Param			type	path		string				true	"Listing type"	Enums(offer, request)
-//	@Success		200		{array}		Services.Listing	"List of listings"
-//	@Failure		400		{string}	string				"Invalid user ID"
-//	@Failure		500		{string}	string				"Internal Server Error"
-//	@Router			/listings/user/{user_id}/{type} [get]
 func (app *application) GetListingsByUserID(w http.ResponseWriter, r *http.Request) {
 	// Extract userID and listingType from the URL
-	userIDStr := chi.URLParam(r, "user_id")
-	userID, err := strconv.Atoi(userIDStr)
+	userID, err := intParam(r, "user_id")
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 	listingType := chi.URLParam(r, "type")
@@ -95,111 +77,105 @@ func (app *application) GetListingsByUserID(w http.ResponseWriter, r *http.Reque
 	// Call the service to get listings by user ID
 	listings, err := app.Service.Listings.GetByUserID(r.Context(), userID, listingType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	// Owners manage listings in every status and see their favourite counts, everyone else only sees published ones
+	if viewerID, _ := authUserID(r); viewerID != userID {
+		published := []Services.Listing{}
+		for _, listing := range listings {
+			if listing.Status == Services.ListingPublished {
+				published = append(published, listing)
+			}
+		}
+		listings = published
+	} else {
+		listings, err = app.withFavouriteCounts(r, userID, listings)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+
+	app.writeListings(w, r, listings)
 }
 
 // CreateListing handles the request to create a new listing.
-//	@Summary		Create a new listing
-//	@Description	Create a new listing for the authenticated user.
-//	@Tags			Listings
-//	@Param			listing	body		Services.Listing	true	"Listing data"
-//	@Success		201		{object}	Services.Listing	"Created listing"
-//	@Failure		400		{string}	string				"Invalid input"
-//	@Failure		401		{string}	string				"Unauthorized"
-//	@Failure		500		{string}	string				"Internal Server Error"
-//	@Router			/listings [post]
 func (app *application) CreateListing(w http.ResponseWriter, r *http.Request) {
 	var listing Services.Listing
 
-	tokenUserId, ok := r.Context().Value("token_user_id").(int)
-
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
 	}
 
 	// Decode the JSON request body into the Listing struct
-	err := json.NewDecoder(r.Body).Decode(&listing)
+	err = decodeJSON(r, &listing)
 	if err != nil {
-		http.Error(w, string(err.Error()), http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	if tokenUserId != listing.UserID {
-		http.Error(w, "Cannot Create Listing For Another User", http.StatusUnauthorized)
+		app.respondError(w, r, fmt.Errorf("cannot create a listing for another user: %w", Services.ErrForbidden))
+		return
 	}
+	listing.CurrencyCode = Services.CurrencyOrDefault(listing.CurrencyCode)
 
 	// Call the service to create the listing
 	createdListing, err := app.Service.Listings.Create(r.Context(), &listing)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(createdListing)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+	json.NewEncoder(w).Encode(createdListing)
 }
 
 // UpdateListing handles the request to update an existing listing.
-//	@Summary		Update a listing
-//	@Description	Update an existing listing created by the authenticated user.
-//	@Tags			Listings
-//	@Param			id		path		int					true	"Listing ID"
-//	@Param			listing	body		Services.Listing	true	"Updated listing data"
-//	@Success		200		{string}	string				"Listing updated successfully"
-//	@Failure		400		{string}	string				"Invalid input"
-//	@Failure		401		{string}	string				"Unauthorized"
-//	@Failure		500		{string}	string				"Internal Server Error"
-//	@Router			/listings/{id} [put]
 func (app *application) UpdateListing(w http.ResponseWriter, r *http.Request) {
 	var listing Services.Listing
 
-	tokenUserId, ok := r.Context().Value("token_user_id").(int)
-
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
 	}
 
 	// Extract listing ID from the URL
-	listingIDStr := chi.URLParam(r, "id")
-	listingID, err := strconv.Atoi(listingIDStr)
+	listingID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	DbListing, err := app.Service.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	if DbListing.UserID != tokenUserId {
-		http.Error(w, "Cannot Delete Listing For Another User", http.StatusUnauthorized)
+		app.respondError(w, r, fmt.Errorf("cannot update another user's listing: %w", Services.ErrForbidden))
+		return
 	}
 
 	// Decode the JSON request body into the Listing struct
-	err = json.NewDecoder(r.Body).Decode(&listing)
+	err = decodeJSON(r, &listing)
 	if err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
+	listing.CurrencyCode = Services.CurrencyOrDefault(listing.CurrencyCode)
 
 	// Call the service to update the listing
 	err = app.Service.Listings.Update(r.Context(), &listing, listingID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -208,104 +184,184 @@ func (app *application) UpdateListing(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteListing handles the HTTP request to delete a listing by ID.
-//	@Summary		Delete a listing
-//	@Description	Delete a listing by its ID, only if the user is the creator.
-//	@Tags			Listings
-//	@Param			id	path		int		true	"Listing ID"
-//	@Success		204	{string}	string	"No content"
-//	@Failure		400	{string}	string	"Invalid listing ID"
-//	@Failure		401	{string}	string	"Unauthorized"
-//	@Failure		500	{string}	string	"Internal Server Error"
-//	@Router			/listings/{id} [delete]
 func (app *application) DeleteListing(w http.ResponseWriter, r *http.Request) {
 	// Extract listing ID from the URL
-	listingIDStr := chi.URLParam(r, "id")
-	listingID, err := strconv.Atoi(listingIDStr)
+	listingID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
-	tokenUserId, ok := r.Context().Value("token_user_id").(int)
-
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
 	}
 
 	DbListing, err := app.Service.Listings.GetByID(r.Context(), listingID)
 	if err != nil {
-		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	if DbListing.UserID != tokenUserId {
-		http.Error(w, "Cannot Delete Listing For Another User", http.StatusUnauthorized)
+		app.respondError(w, r, fmt.Errorf("cannot delete another user's listing: %w", Services.ErrForbidden))
+		return
 	}
 
 	// Call the service to delete the listing
 	err = app.Service.Listings.Delete(r.Context(), listingID)
 	if err != nil {
-		http.Error(w, "Failed to delete listing", http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent) // 204 No Content for successful deletion
 }
 
+// RestoreListing handles the request to undo the deletion of one of the caller's listings within the grace period.
+func (app *application) RestoreListing(w http.ResponseWriter, r *http.Request) {
+	listingID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	// Other users' listings are reported as not found, like listings deleted too long ago
+	err = app.Service.Listings.Restore(r.Context(), listingID, tokenUserId, app.config.retention.restoreWithin)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	listing, err := app.Service.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(listing)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// SetListingStatus handles the request to publish, pause or close one of the caller's listings.
+func (app *application) SetListingStatus(w http.ResponseWriter, r *http.Request) {
+	status := chi.URLParam(r, "status")
+	if status != Services.ListingPublished && status != Services.ListingPaused && status != Services.ListingClosed {
+		app.respondError(w, r, Services.Invalid("status", "must be one of published, paused, closed"))
+		return
+	}
+	app.changeListingStatus(w, r, status)
+}
+
+// RenewListing handles the request to restart the lifetime of a published or expired listing.
+func (app *application) RenewListing(w http.ResponseWriter, r *http.Request) {
+	app.changeListingStatus(w, r, Services.ListingPublished, Services.ListingPublished, Services.ListingExpired)
+}
+
+// changeListingStatus moves the caller's listing to status and responds with the updated listing.
+// When from is given the listing must currently be in one of those statuses.
+func (app *application) changeListingStatus(w http.ResponseWriter, r *http.Request, status string, from ...string) {
+	listingID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	listing, err := app.Service.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if listing.UserID != tokenUserId {
+		app.respondError(w, r, fmt.Errorf("cannot change another user's listing: %w", Services.ErrForbidden))
+		return
+	}
+	if len(from) > 0 && !slices.Contains(from, listing.Status) {
+		app.respondError(w, r, fmt.Errorf("listing is %s: %w", listing.Status, Services.ErrConflict))
+		return
+	}
+
+	err = app.Service.Listings.SetStatus(r.Context(), listingID, status)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	listing, err = app.Service.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(listing)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
 // GetListingsBySearch handles the HTTP request to get listings by search query and type.
-//	@Summary		Get listings by search query and type
-//	@Description	Retrieves a list of listings that match a search query and a specific listing type (e.g., offer or request).
-//	@Tags			Listings
-//	@Param			query	path		string	true	"Search query"
-//	@Param			type	path		string	true	"Type of the listing (e.g., offer or request)"
-//	@Success		200		{array}		Listing	"List of listings matching the search query"
-//	@Failure		400		{string}	string	"Invalid search query or listing type"
-//	@Failure		500		{string}	string	"Internal server error"
-//	@Router			/listings/search/{query}/{type} [get]
 func (app *application) GetListingsBySearch(w http.ResponseWriter, r *http.Request) {
 	query := chi.URLParam(r, "query")
 	listingType := chi.URLParam(r, "type")
 
+	search, err := app.promotionSearch(r, listingType, query)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
 	// Call the service to get listings by search
 	listings, err := app.Service.Listings.GetBySearch(r.Context(), query, listingType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
+	if err := app.boostListings(r.Context(), listings); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	listings, err = app.promote(r.Context(), listings, search)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
 	}
+
+	app.trackImpressions(listings)
+	app.writeListings(w, r, listings)
 }
 
 // GetListingsByDistance handles the HTTP request to get listings by location and distance.
-//	@Summary		Get listings by location and distance
-//	@Description	Retrieves a list of listings within a specified distance from a given location (latitude and longitude).
-//	@Tags			Listings
-//	@Param			latitude		path		float64	true	"Latitude of the location"
-//	@Param			longitude		path		float64	true	"Longitude of the location"
-//	@Param			max_distance	path		float64	true	"Maximum distance (in kilometers) to search listings within"
-//	@Param			type			path		string	true	"Type of the listing (e.g., offer or request)"
-//	@Success		200				{array}		Listing	"List of listings"
-//	@Failure		400				{string}	string	"Invalid parameters"
-//	@Failure		500				{string}	string	"Internal server error"
-//	@Router			/listings/distance/{latitude}/{longitude}/{max_distance}/{type} [get]
 func (app *application) GetListingsByDistance(w http.ResponseWriter, r *http.Request) {
-	latitude, err := strconv.ParseFloat(chi.URLParam(r, "latitude"), 64)
+	latitude, err := floatParam(r, "latitude")
 	if err != nil {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
-	longitude, err := strconv.ParseFloat(chi.URLParam(r, "longitude"), 64)
+	longitude, err := floatParam(r, "longitude")
 	if err != nil {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
-	maxDistance, err := strconv.ParseFloat(chi.URLParam(r, "max_distance"), 64)
+	maxDistance, err := floatParam(r, "max_distance")
 	if err != nil {
-		http.Error(w, "Invalid maxDistance", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 	listingType := chi.URLParam(r, "type")
@@ -313,113 +369,161 @@ func (app *application) GetListingsByDistance(w http.ResponseWriter, r *http.Req
 	// Call the service to get listings by distance
 	listings, err := app.Service.Listings.GetByDistance(r.Context(), latitude, longitude, maxDistance, listingType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
+	}
+	if err := app.boostListings(r.Context(), listings); err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
+	app.trackImpressions(listings)
+	app.writeListings(w, r, listings)
+}
+
+// GetListingsByViewport handles the request to get the listings inside a map viewport, optionally matching a search query.
+// Zoomed out, nearby listings are grouped into clusters with a count and centroid. At most mapLimit markers are returned.
+func (app *application) GetListingsByViewport(w http.ResponseWriter, r *http.Request) {
+	var box Services.BoundingBox
+	edges := []struct {
+		name  string
+		value *float64
+	}{
+		{"min_longitude", &box.MinLongitude},
+		{"min_latitude", &box.MinLatitude},
+		{"max_longitude", &box.MaxLongitude},
+		{"max_latitude", &box.MaxLatitude},
+	}
+	for _, edge := range edges {
+		value, err := floatParam(r, edge.name)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		*edge.value = value
+	}
+	zoom, err := intParam(r, "zoom")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	view, err := app.Service.Listings.GetMapView(r.Context(), Services.MapQuery{Box: box, Zoom: zoom, Type: chi.URLParam(r, "type"),
+		Search: chi.URLParam(r, "query"), ClusterBelow: app.config.listings.clusterBelowZoom, Limit: app.config.listings.mapLimit})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
 	}
+
+	// Listings grouped into clusters are not shown individually
+	app.trackImpressions(view.Listings)
+	app.writeMapView(w, r, view)
 }
 
 // GetListingsByDistanceAndSearch handles the HTTP request to get listings by location, distance, and search query.
-//	@Summary		Get listings by location, distance, and search query
-//	@Description	Retrieves a list of listings within a specified distance and matching a search query.
-//	@Tags			Listings
-//	@Param			latitude		path		float64	true	"Latitude of the location"
-//	@Param			longitude		path		float64	true	"Longitude of the location"
-//	@Param			max_distance	path		float64	true	"Maximum distance (in kilometers) to search listings within"
-//	@Param			type			path		string	true	"Type of the listing (e.g., offer or request)"
-//	@Param			query			path		string	true	"Search query"
-//	@Success		200				{array}		Listing	"List of listings matching the search query"
-//	@Failure		400				{string}	string	"Invalid parameters"
-//	@Failure		500				{string}	string	"Internal server error"
-//	@Router			/listings/distance-search/{latitude}/{longitude}/{max_distance}/{type}/{query} [get]
 func (app *application) GetListingsByDistanceAndSearch(w http.ResponseWriter, r *http.Request) {
-	latitude, err := strconv.ParseFloat(chi.URLParam(r, "latitude"), 64)
+	latitude, err := floatParam(r, "latitude")
 	if err != nil {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
-	longitude, err := strconv.ParseFloat(chi.URLParam(r, "longitude"), 64)
+	longitude, err := floatParam(r, "longitude")
 	if err != nil {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
-	maxDistance, err := strconv.ParseFloat(chi.URLParam(r, "max_distance"), 64)
+	maxDistance, err := floatParam(r, "max_distance")
 	if err != nil {
-		http.Error(w, "Invalid maxDistance", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 	listingType := chi.URLParam(r, "type")
 
 	query := chi.URLParam(r, "query")
 
+	search, err := app.promotionSearch(r, listingType, query)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	// Without a region filter, promotions target the regions around the point searched
+	if search.RegionIDs == nil {
+		regions, err := app.Service.Regions.Locate(r.Context(), latitude, longitude)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		for _, region := range regions {
+			search.RegionIDs = append(search.RegionIDs, region.RegionID)
+		}
+	}
+
 	// Call the service to get listings by distance
 	listings, err := app.Service.Listings.GetByDistanceAndSearch(r.Context(), latitude, longitude, maxDistance, listingType, query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
+	if err := app.boostListings(r.Context(), listings); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	listings, err = app.promote(r.Context(), listings, search)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
 	}
+
+	app.trackImpressions(listings)
+	app.writeListings(w, r, listings)
 }
 
 // GetListingsByDate handles the HTTP request to get listings by date created, sorted descending.
-//	@Summary		Get listings by date created, sorted descending
-//	@Description	Retrieves a list of listings sorted by creation date in descending order.
-//	@Tags			Listings
-//	@Param			type	path		string	true	"Type of the listing (e.g., offer or request)"
-//	@Success		200		{array}		Listing	"List of listings sorted by creation date"
-//	@Failure		500		{string}	string	"Internal server error"
-//	@Router			/listings/date/{type} [get]
 func (app *application) GetListingsByDate(w http.ResponseWriter, r *http.Request) {
 	listingType := chi.URLParam(r, "type")
 
 	// Call the service to get listings by date created descending
 	listings, err := app.Service.Listings.GetByDateCreatedDescending(r.Context(), listingType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := app.boostListings(r.Context(), listings); err != nil {
+		app.respondError(w, r, err)
+		return
 	}
+
+	app.trackImpressions(listings)
+	app.writeListings(w, r, listings)
 }
 
 // GetListingsByDateAndSearch handles the HTTP request to get listings by date and search query.
-//	@Summary		Get listings by date and search query
-//	@Description	Retrieves a list of listings sorted by creation date in descending order that match a search query.
-//	@Tags			Listings
-//	@Param			query	path		string	true	"Search query"
-//	@Param			type	path		string	true	"Type of the listing (e.g., offer or request)"
-//	@Success		200		{array}		Listing	"List of listings matching the search query"
-//	@Failure		400		{string}	string	"Invalid parameters"
-//	@Failure		500		{string}	string	"Internal server error"
-//	@Router			/listings/date-search/{query}/{type} [get]
 func (app *application) GetListingsByDateAndSearch(w http.ResponseWriter, r *http.Request) {
 	query := chi.URLParam(r, "query")
 	listingType := chi.URLParam(r, "type")
 
+	search, err := app.promotionSearch(r, listingType, query)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
 	// Call the service to get listings by date created and search query
 	listings, err := app.Service.Listings.GetByDateCreatedAndSearchDescending(r.Context(), query, listingType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(listings)
+	if err := app.boostListings(r.Context(), listings); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	listings, err = app.promote(r.Context(), listings, search)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
 	}
+
+	app.trackImpressions(listings)
+	app.writeListings(w, r, listings)
 }
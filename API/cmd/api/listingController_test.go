@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	geojson "github.com/paulmach/go.geojson"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func decodeListings(t *testing.T, rec *httptest.ResponseRecorder) []Services.Listing {
+	t.Helper()
+	expectStatus(t, rec, http.StatusOK)
+
+	var listings []Services.Listing
+	decode(t, rec, &listings)
+	return listings
+}
+
+func listingTitles(listings []Services.Listing) []string {
+	titles := make([]string, 0, len(listings))
+	for _, listing := range listings {
+		titles = append(titles, listing.Title)
+	}
+	return titles
+}
+
+// seedListings creates a user with listings in Beirut and Tripoli
+func seedListings(t *testing.T) (*testServer, Services.User, string) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+
+	s.createListing(user.UserID, "Offer", "Plumbing repairs", 35.5018, 33.8938)
+	s.createListing(user.UserID, "Request", "Need a plumber", 35.5100, 33.8900)
+	s.createListing(user.UserID, "Offer", "Tiling work", 35.8498, 34.4346)
+	return s, user, token
+}
+
+func TestCreateListing(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/listing/create", map[string]interface{}{
+		"type":          "Offer",
+		"location":      []float64{35.5018, 33.8938},
+		"user_id":       user.UserID,
+		"title":         "Electrician",
+		"description":   "Wiring and repairs",
+		"price":         120.5,
+		"currency_code": "eur",
+	}, token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var listing Services.Listing
+	decode(t, rec, &listing)
+	if listing.ListingID == 0 || !listing.Active || listing.City != "Beirut" || listing.Price != 120.5 || listing.CurrencyCode != "EUR" {
+		t.Fatalf("unexpected listing %+v", listing)
+	}
+
+	// Prices are money: no more decimals than the currency has
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/listing/create", map[string]interface{}{
+		"type": "Offer", "location": []float64{35.5018, 33.8938}, "user_id": user.UserID, "title": "Electrician",
+		"price": 1500.5, "currency_code": "JPY",
+	}, token), http.StatusBadRequest)
+
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/listing/create", map[string]interface{}{}, ""), http.StatusUnauthorized)
+}
+
+func TestGetAllListings(t *testing.T) {
+	s, _, _ := seedListings(t)
+
+	if got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/all", nil, "", "")); len(got) != 3 {
+		t.Fatalf("expected 3 listings, got %v", listingTitles(got))
+	}
+	if got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/Offer", nil, "", "")); len(got) != 2 {
+		t.Fatalf("expected 2 offers, got %v", listingTitles(got))
+	}
+}
+
+func TestGetListingByID(t *testing.T) {
+	s, user, _ := seedListings(t)
+	listing := s.createListing(user.UserID, "Offer", "Painting", 35.5, 33.9)
+
+	rec := s.do(http.MethodGet, "/api/v1/listing/listingId/"+strconv.Itoa(listing.ListingID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var got Services.Listing
+	decode(t, rec, &got)
+	if got.Title != "Painting" {
+		t.Fatalf("expected Painting, got %+v", got)
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/listingId/abc", nil, "", ""), http.StatusBadRequest)
+}
+
+func TestGetListingsByUserID(t *testing.T) {
+	s, user, _ := seedListings(t)
+	other, _ := s.createUser("Rami", "+96170000002")
+	s.createListing(other.UserID, "Request", "Other user", 35.5, 33.9)
+
+	got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/user/"+strconv.Itoa(user.UserID)+"/Request", nil, "", ""))
+	if len(got) != 1 || got[0].Title != "Need a plumber" {
+		t.Fatalf("unexpected listings %v", listingTitles(got))
+	}
+}
+
+func TestGetListingsBySearch(t *testing.T) {
+	s, _, _ := seedListings(t)
+
+	got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/search/plumb/all", nil, "", ""))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 plumbing listings, got %v", listingTitles(got))
+	}
+	got = decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/search/plumb/Request", nil, "", ""))
+	if len(got) != 1 {
+		t.Fatalf("expected 1 plumbing request, got %v", listingTitles(got))
+	}
+}
+
+func TestGetListingsByDate(t *testing.T) {
+	s, _, _ := seedListings(t)
+
+	got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/date/Offer", nil, "", ""))
+	if len(got) != 2 || got[0].Title != "Tiling work" {
+		t.Fatalf("expected newest offer first, got %v", listingTitles(got))
+	}
+}
+
+func TestGetListingsByDateAndSearch(t *testing.T) {
+	s, _, _ := seedListings(t)
+
+	got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/date/search/plumb/all", nil, "", ""))
+	if len(got) != 2 || got[0].Title != "Need a plumber" {
+		t.Fatalf("expected newest plumbing listing first, got %v", listingTitles(got))
+	}
+}
+
+func TestGetListingsByDistance(t *testing.T) {
+	s, _, _ := seedListings(t)
+
+	// Beirut to Tripoli is roughly 70km
+	got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/distance/35.5018/33.8938/10/all", nil, "", ""))
+	if len(got) != 2 {
+		t.Fatalf("expected the 2 Beirut listings, got %v", listingTitles(got))
+	}
+	got = decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/distance/35.5018/33.8938/100/Offer", nil, "", ""))
+	if len(got) != 2 {
+		t.Fatalf("expected both offers within 100km, got %v", listingTitles(got))
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/distance/x/33.8938/10/all", nil, "", ""), http.StatusBadRequest)
+}
+
+func TestGetListingsByDistanceAndSearch(t *testing.T) {
+	s, _, _ := seedListings(t)
+
+	got := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/distance/35.5018/33.8938/100/all/tiling", nil, "", ""))
+	if len(got) != 1 || got[0].Title != "Tiling work" {
+		t.Fatalf("expected tiling listing, got %v", listingTitles(got))
+	}
+}
+
+func TestUpdateListing(t *testing.T) {
+	s, user, token := seedListings(t)
+	listing := s.createListing(user.UserID, "Offer", "Painting", 35.5, 33.9)
+
+	rec := s.doJSON(http.MethodPut, "/api/v1/listing/update/"+strconv.Itoa(listing.ListingID), map[string]interface{}{
+		"type":          "Offer",
+		"location":      []float64{35.5, 33.9},
+		"title":         "Painting and plastering",
+		"description":   "Interior work",
+		"price":         20000,
+		"currency_code": "JPY",
+	}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	updated, _ := s.app.Service.Listings.GetByID(context.Background(), listing.ListingID)
+	if updated.Title != "Painting and plastering" || updated.Price != 20000 || updated.CurrencyCode != "JPY" {
+		t.Fatalf("expected title to be updated, got %+v", updated)
+	}
+}
+
+func TestDeleteListing(t *testing.T) {
+	s, user, token := seedListings(t)
+	listing := s.createListing(user.UserID, "Offer", "Painting", 35.5, 33.9)
+	path := "/api/v1/listing/delete/" + strconv.Itoa(listing.ListingID)
+
+	expectStatus(t, s.do(http.MethodDelete, path, nil, "", ""), http.StatusUnauthorized)
+	expectStatus(t, s.do(http.MethodDelete, path, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, path, nil, "", token), http.StatusNotFound)
+}
+
+func TestRestoreListing(t *testing.T) {
+	s, user, token := seedListings(t)
+	_, otherToken := s.createUser("Other", "+96170000002")
+	listing := s.createListing(user.UserID, "Offer", "Painting", 35.5, 33.9)
+	id := strconv.Itoa(listing.ListingID)
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/listing/delete/"+id, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/listingId/"+id, nil, "", ""), http.StatusNotFound)
+	rec := s.do(http.MethodGet, "/api/v1/listing/listings/user/"+strconv.Itoa(user.UserID)+"/all", nil, "", "")
+	if titles := listingTitles(decodeListings(t, rec)); len(titles) != 3 {
+		t.Fatalf("deleted listing is still listed: %v", titles)
+	}
+
+	path := "/api/v1/listing/restore/" + id
+	expectStatus(t, s.do(http.MethodPost, path, nil, "", otherToken), http.StatusNotFound)
+	rec = s.do(http.MethodPost, path, nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var restored Services.Listing
+	decode(t, rec, &restored)
+	if restored.ListingID != listing.ListingID || restored.DeletedAt != "" {
+		t.Fatalf("unexpected restored listing %+v", restored)
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/listingId/"+id, nil, "", ""), http.StatusOK)
+	expectStatus(t, s.do(http.MethodPost, path, nil, "", token), http.StatusNotFound)
+
+	// Past the grace period the listing stays deleted
+	s.app.config.retention.restoreWithin = 0
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/listing/delete/"+id, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPost, path, nil, "", token), http.StatusNotFound)
+}
+
+func TestListingLifecycle(t *testing.T) {
+	s, user, token := seedListings(t)
+	_, otherToken := s.createUser("Other", "+96170000002")
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/listing/create", map[string]interface{}{
+		"type":        "Offer",
+		"location":    []float64{35.5018, 33.8938},
+		"user_id":     user.UserID,
+		"title":       "Roofing",
+		"description": "Not ready yet",
+		"status":      "draft",
+	}, token)
+	expectStatus(t, rec, http.StatusCreated)
+	var draft Services.Listing
+	decode(t, rec, &draft)
+	if draft.Status != Services.ListingDraft || draft.Active || draft.ExpiresAt != "" {
+		t.Fatalf("unexpected draft %+v", draft)
+	}
+	id := strconv.Itoa(draft.ListingID)
+
+	// Drafts stay out of browsing and are only visible to their owner
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/all", nil, "", ""))); len(titles) != 3 {
+		t.Fatalf("draft is browsable: %v", titles)
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/listingId/"+id, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/listingId/"+id, nil, "", token), http.StatusOK)
+	byUser := "/api/v1/listing/listings/user/" + strconv.Itoa(user.UserID) + "/all"
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, byUser, nil, "", ""))); len(titles) != 3 {
+		t.Fatalf("draft is listed for other users: %v", titles)
+	}
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, byUser, nil, "", token))); len(titles) != 4 {
+		t.Fatalf("owner should see the draft: %v", titles)
+	}
+
+	status := func(to, token string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPut, "/api/v1/listing/status/"+id+"/"+to, nil, "", token)
+	}
+	expectStatus(t, status(Services.ListingExpired, token), http.StatusBadRequest)
+	expectStatus(t, status(Services.ListingPaused, token), http.StatusConflict)
+	expectStatus(t, status(Services.ListingPublished, otherToken), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/listing/renew/"+id, nil, "", token), http.StatusConflict)
+
+	rec = status(Services.ListingPublished, token)
+	expectStatus(t, rec, http.StatusOK)
+	var published Services.Listing
+	decode(t, rec, &published)
+	if published.Status != Services.ListingPublished || !published.Active || published.ExpiresAt == "" {
+		t.Fatalf("unexpected published listing %+v", published)
+	}
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/all", nil, "", ""))); len(titles) != 4 {
+		t.Fatalf("published listing is not browsable: %v", titles)
+	}
+
+	expectStatus(t, status(Services.ListingPaused, token), http.StatusOK)
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/all", nil, "", ""))); len(titles) != 3 {
+		t.Fatalf("paused listing is browsable: %v", titles)
+	}
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/listing/renew/"+id, nil, "", token), http.StatusConflict)
+	expectStatus(t, status(Services.ListingPublished, token), http.StatusOK)
+
+	rec = s.do(http.MethodPut, "/api/v1/listing/renew/"+id, nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var renewed Services.Listing
+	decode(t, rec, &renewed)
+	if renewed.Status != Services.ListingPublished || renewed.ExpiresAt < published.ExpiresAt {
+		t.Fatalf("unexpected renewed listing %+v", renewed)
+	}
+
+	// Closed listings are final
+	expectStatus(t, status(Services.ListingClosed, token), http.StatusOK)
+	expectStatus(t, status(Services.ListingPublished, token), http.StatusConflict)
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/listing/renew/"+id, nil, "", token), http.StatusConflict)
+}
+
+func TestGetListingsByViewport(t *testing.T) {
+	s, user, _ := seedListings(t)
+	s.createListing(user.UserID, "Request", "Need an electrician", 35.4950, 33.8900)
+	lebanon := "/api/v1/listing/viewport/35.0/33.0/36.7/34.7/"
+
+	decodeView := func(rec *httptest.ResponseRecorder) Services.MapView {
+		t.Helper()
+		expectStatus(t, rec, http.StatusOK)
+		var view Services.MapView
+		decode(t, rec, &view)
+		return view
+	}
+
+	// Zoomed out, listings sharing a grid cell are clustered and listings alone in theirs stay individual.
+	// At zoom 9 a cell edge runs at 35.508, between the plumbing listings.
+	view := decodeView(s.do(http.MethodGet, lebanon+"9/all", nil, "", ""))
+	if len(view.Clusters) != 1 || view.Clusters[0].Count != 2 || len(view.Listings) != 2 {
+		t.Fatalf("unexpected zoomed out view %+v", view)
+	}
+	// The centroid and bounds are fuzzed to the grid public locations are snapped to
+	centroid := view.Clusters[0].Location
+	if centroid == nil || centroid.Lng() != 35.495 || centroid.Lat() != 33.895 || view.Clusters[0].Bounds != [4]float64{35.49, 33.89, 35.51, 33.9} {
+		t.Fatalf("unexpected cluster %+v", view.Clusters[0])
+	}
+	for _, listing := range view.Listings {
+		if listing.Location.Lng() == 35.4950 {
+			t.Fatalf("expected fuzzed listings, got %+v", listing)
+		}
+	}
+
+	// Zoomed in, every listing comes back individually
+	view = decodeView(s.do(http.MethodGet, lebanon+"14/all", nil, "", ""))
+	if len(view.Clusters) != 0 || len(view.Listings) != 4 {
+		t.Fatalf("expected 4 listings zoomed in, got %+v", view)
+	}
+
+	// Type and search filters apply before clustering
+	view = decodeView(s.do(http.MethodGet, lebanon+"9/Offer", nil, "", ""))
+	if len(view.Clusters) != 0 || len(view.Listings) != 2 {
+		t.Fatalf("expected the 2 offers, got %+v", view)
+	}
+	view = decodeView(s.do(http.MethodGet, lebanon+"14/all/plumb", nil, "", ""))
+	if len(view.Listings) != 2 {
+		t.Fatalf("expected the 2 plumbing listings, got %v", listingTitles(view.Listings))
+	}
+
+	// Tripoli is north of a Beirut viewport
+	view = decodeView(s.do(http.MethodGet, "/api/v1/listing/viewport/35.4/33.8/35.6/34.0/14/all", nil, "", ""))
+	if len(view.Listings) != 3 {
+		t.Fatalf("expected the 3 Beirut listings, got %v", listingTitles(view.Listings))
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/viewport/36.7/33.0/35.0/34.7/8/all", nil, "", ""), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodGet, lebanon+"23/all", nil, "", ""), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/viewport/x/33.0/36.7/34.7/8/all", nil, "", ""), http.StatusBadRequest)
+
+	// Views are capped, keeping the biggest clusters and the newest listings
+	s.app.config.listings.mapLimit = 2
+	view = decodeView(s.do(http.MethodGet, lebanon+"14/all", nil, "", ""))
+	if !view.Truncated || len(view.Listings) != 2 || view.Listings[0].Title != "Need an electrician" {
+		t.Fatalf("expected the 2 newest listings, got %v", listingTitles(view.Listings))
+	}
+	view = decodeView(s.do(http.MethodGet, lebanon+"9/all", nil, "", ""))
+	if !view.Truncated || len(view.Clusters) != 1 || len(view.Listings) != 1 {
+		t.Fatalf("expected the cluster and one listing, got %+v", view)
+	}
+	s.app.config.listings.mapLimit = 3
+	if view = decodeView(s.do(http.MethodGet, lebanon+"9/all", nil, "", "")); view.Truncated {
+		t.Fatalf("expected the whole view within the limit, got %+v", view)
+	}
+}
+
+func TestListingsAsGeoJSON(t *testing.T) {
+	s, user, token := seedListings(t)
+
+	geoJSON := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/geo+json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var collection geojson.FeatureCollection
+	rec := geoJSON("/api/v1/listing/listings/Offer", "")
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "application/geo+json" {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	decode(t, rec, &collection)
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+		t.Fatalf("expected the 2 offers as features, got %+v", collection)
+	}
+	feature := collection.Features[0]
+	if feature.Properties["title"] != "Plumbing repairs" || feature.Properties["category"] != nil || feature.Properties["description"] != nil {
+		t.Fatalf("unexpected default properties %v", feature.Properties)
+	}
+	// Anonymous callers get the point fuzzed to the centre of its grid cell
+	if point := feature.Geometry.Point; len(point) != 2 || point[0] != 35.505 || point[1] != 33.895 {
+		t.Fatalf("expected a fuzzed point, got %v", point)
+	}
+
+	// Properties can be picked per request, and owners see their own listings exactly
+	rec = geoJSON("/api/v1/listing/listingId/1?properties=title,description", token)
+	expectStatus(t, rec, http.StatusOK)
+	var single geojson.Feature
+	decode(t, rec, &single)
+	if len(single.Properties) != 2 || single.Properties["description"] != "Plumbing repairs description" || single.Geometry.Point[0] != 35.5018 {
+		t.Fatalf("unexpected owner feature %+v", single)
+	}
+	byUser := "/api/v1/listing/listings/user/" + strconv.Itoa(user.UserID) + "/all"
+	decode(t, geoJSON(byUser, ""), &collection)
+	if len(collection.Features) != 3 || collection.Features[0].Geometry.Point[0] != 35.505 {
+		t.Fatalf("expected fuzzed points for other users, got %+v", collection.Features)
+	}
+	expectStatus(t, geoJSON("/api/v1/listing/listings/all?properties=title,password", ""), http.StatusBadRequest)
+
+	// Clusters become features of their own
+	decode(t, geoJSON("/api/v1/listing/viewport/35.0/33.0/36.7/34.7/7/all", ""), &collection)
+	if len(collection.Features) != 1 || collection.Features[0].Properties["count"] != float64(3) || len(collection.Features[0].BoundingBox) != 4 {
+		t.Fatalf("expected one cluster feature, got %+v", collection.Features)
+	}
+
+	// Plain JSON is fuzzed the same way
+	if listings := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/Offer", nil, "", "")); listings[0].Location.Lng() != 35.505 || listings[0].Location.Lat() != 33.895 {
+		t.Fatalf("expected a fuzzed point in plain JSON, got %+v", listings[0])
+	}
+	rec = s.do(http.MethodGet, "/api/v1/listing/listingId/1", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var own Services.Listing
+	decode(t, rec, &own)
+	if own.Location.Lng() != 35.5018 {
+		t.Fatalf("expected the owner to see the exact point, got %+v", own)
+	}
+}
+
+func TestExportListings(t *testing.T) {
+	s, user, token := seedListings(t)
+	s.createListing(user.UserID, "Offer", "Old offer", 35.5, 33.9)
+	expectStatus(t, s.do(http.MethodPut, "/api/v1/listing/status/4/paused", nil, "", token), http.StatusOK)
+
+	rec := s.do(http.MethodGet, "/api/v1/listing/export/all?properties=listing_id,title", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected the 3 published listings, one per line, got %q", rec.Body.String())
+	}
+	for i, line := range lines {
+		feature, err := geojson.UnmarshalFeature([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Exports are fuzzed even for the owner
+		if feature.Properties["listing_id"] != float64(i+1) || len(feature.Properties) != 2 || feature.Geometry.Point[0] == 35.5018 {
+			t.Fatalf("unexpected exported feature %+v", feature)
+		}
+	}
+
+	rec = s.do(http.MethodGet, "/api/v1/listing/export/Request", nil, "", "")
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 1 {
+		t.Fatalf("expected the one request, got %q", rec.Body.String())
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/export/all?properties=nope", nil, "", ""), http.StatusBadRequest)
+}
@@ -1,21 +1,125 @@
 package main
 
 import (
+	"context"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Database"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Migrations"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Payments"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Rates"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
 	"log"
+	"os"
+	"strings"
+	"time"
 )
 
 func main() {
 
+	weights := Services.DefaultMatchWeights()
+	promotions := Services.DefaultPromotionRules()
 	config := config{
 		address: Env.GetString("ADDR", ":"),
 		db: dbConfig{
-			addr: Env.GetString("DB_ADDR", "")},
+			driver: Env.GetString("DB_DRIVER", "mysql"),
+			addr:   Env.GetString("DB_ADDR", "")},
+		retention: retentionConfig{
+			restoreWithin: time.Duration(Env.GetInt("RESTORE_GRACE_DAYS", 30)) * 24 * time.Hour,
+			purgeAfter:    time.Duration(Env.GetInt("PURGE_AFTER_DAYS", 90)) * 24 * time.Hour,
+		},
+		listings: listingConfig{
+			reminderBefore:    time.Duration(Env.GetInt("LISTING_REMINDER_DAYS", 3)) * 24 * time.Hour,
+			clusterBelowZoom:  Env.GetInt("MAP_CLUSTER_BELOW_ZOOM", 13),
+			mapLimit:          Env.GetInt("MAP_LIMIT", 500),
+			geoJSONProperties: strings.Split(Env.GetString("GEOJSON_PROPERTIES", strings.Join(Services.DefaultListingProperties, ",")), ","),
+		},
+		searches: searchConfig{
+			digestEvery: time.Duration(Env.GetInt("SEARCH_DIGEST_HOURS", 24)) * time.Hour,
+		},
+		matching: Services.MatchOptions{
+			Weights: Services.MatchWeights{
+				Distance:     Env.GetFloat("MATCH_WEIGHT_DISTANCE", weights.Distance),
+				Text:         Env.GetFloat("MATCH_WEIGHT_TEXT", weights.Text),
+				Category:     Env.GetFloat("MATCH_WEIGHT_CATEGORY", weights.Category),
+				Price:        Env.GetFloat("MATCH_WEIGHT_PRICE", weights.Price),
+				Availability: Env.GetFloat("MATCH_WEIGHT_AVAILABILITY", weights.Availability),
+				Rating:       Env.GetFloat("MATCH_WEIGHT_RATING", weights.Rating),
+			},
+			Radius: Env.GetFloat("MATCH_RADIUS_KM", 25),
+			Limit:  20,
+		},
+		payments: paymentConfig{
+			feePercent: Env.GetFloat("PLATFORM_FEE_PERCENT", 5),
+		},
+		rates: rateConfig{
+			currencies: strings.Split(Env.GetString("EXCHANGE_RATE_CURRENCIES", "USD,LBP,EUR"), ","),
+		},
+		analytics: analyticsConfig{
+			buffer:     Env.GetInt("ANALYTICS_BUFFER", 10000),
+			flushEvery: time.Duration(Env.GetInt("ANALYTICS_FLUSH_SECONDS", 10)) * time.Second,
+		},
+		apiKeys: apiKeyConfig{
+			rateLimit:  Env.GetInt("API_KEY_RATE_LIMIT", 60),
+			dailyQuota: Env.GetInt("API_KEY_DAILY_QUOTA", 10000),
+		},
 	}
 
-	db, err := Database.DBConnection(config.db.addr)
+	if err := Services.CheckListingProperties(config.listings.geoJSONProperties); err != nil {
+		log.Fatal(err)
+	}
+	taxRates, err := parseTaxRates(Env.GetString("INVOICE_TAX_RATES", ""))
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.invoices = invoiceConfig{taxRates: taxRates}
+	slots, err := parsePromotionSlots(Env.GetString("PROMOTION_SLOTS", "1,6"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.promotions = Services.PromotionRules{
+		Slots:           slots,
+		ImpressionPrice: Env.GetFloat("PROMOTION_IMPRESSION_PRICE", promotions.ImpressionPrice),
+		ClickPrice:      Env.GetFloat("PROMOTION_CLICK_PRICE", promotions.ClickPrice),
+		ClickKey:        promotions.ClickKey,
+	}
+	// Instances behind a load balancer share a key, so a click can reach any of them
+	if key := Env.GetString("PROMOTION_CLICK_KEY", ""); key != "" {
+		config.promotions.ClickKey = []byte(key)
+	}
+
+	// No processor is integrated yet; the fake provider records payments without moving money
+	payments := Payments.NewFake()
+	log.Print("Payments use the fake provider, no money is moved \n")
+
+	// Without a rates file only the rates set by admins are quoted
+	var rates Rates.Provider
+	if path := Env.GetString("EXCHANGE_RATE_FILE", ""); path != "" {
+		file, err := Rates.NewFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rates = file
+	}
+
+	// The subcommands work on a database, so they are refused rather than starting the server
+	if config.db.driver == "memory" && len(os.Args) > 1 && (os.Args[1] == "migrate" || os.Args[1] == "role") {
+		log.Fatalf("api %s needs a database, but DB_DRIVER is memory", os.Args[1])
+	}
+
+	// The memory driver runs the whole API without a database, data is lost on exit
+	if config.db.driver == "memory" {
+		log.Print("Using in-memory storage \n")
+		Service := Services.ServiceMemory(Utils.ReverseGeocode, payments, rates)
+		app := &application{
+			config:  config,
+			Service: Service,
+			events:  newEventCollector(Service, config.analytics),
+		}
+		log.Fatal(app.run(app.mount()))
+	}
+
+	db, err := Database.DBConnection(config.db.driver, config.db.addr)
 
 	if err != nil {
 		log.Panic(err)
@@ -23,11 +127,33 @@ func main() {
 
 	defer db.Close()
 
-	Service := Services.ServiceDB(db)
+	// "api migrate ..." manages the schema instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), db, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Refuse to serve against a schema this build was not written for
+	if err := Migrations.Check(context.Background(), db); err != nil {
+		log.Panic(err)
+	}
+
+	Service := Services.ServiceDB(db, Utils.ReverseGeocode, payments, rates)
+
+	// "api role ..." grants or revokes admin rights instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if err := runRole(context.Background(), Service, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	app := &application{
 		config:  config,
 		Service: Service,
+		events:  newEventCollector(Service, config.analytics),
 	}
 
 	mux := app.mount()
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+)
+
+// matchOptions returns the configured matching options, with the limit taken from ?limit= when given
+func (app *application) matchOptions(r *http.Request) (Services.MatchOptions, error) {
+	options := app.config.matching
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return options, Services.Invalid("limit", "must be a positive integer")
+		}
+		options.Limit = limit
+	}
+	return options, nil
+}
+
+// getSuggestedTradesmen handles the request to rank the tradesmen matching one of the caller's requests.
+func (app *application) getSuggestedTradesmen(w http.ResponseWriter, r *http.Request) {
+	listingID, err := intParam(r, "listing_id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	options, err := app.matchOptions(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	listing, err := app.Service.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if listing.UserID != tokenUserId {
+		app.respondError(w, r, fmt.Errorf("cannot match another user's request: %w", Services.ErrForbidden))
+		return
+	}
+
+	suggestions, err := app.Service.Matching.SuggestTradesmen(r.Context(), listingID, options)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(suggestions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getJobsForYou handles the request to rank the requests matching the caller's offers.
+func (app *application) getJobsForYou(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	options, err := app.matchOptions(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	suggestions, err := app.Service.Matching.JobsFor(r.Context(), tokenUserId, options)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(suggestions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	geo "github.com/paulmach/go.geo"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func decodeSuggestions(t *testing.T, rec *httptest.ResponseRecorder) []Services.Suggestion {
+	t.Helper()
+	expectStatus(t, rec, http.StatusOK)
+
+	var suggestions []Services.Suggestion
+	decode(t, rec, &suggestions)
+	return suggestions
+}
+
+// createPricedListing stores a published listing with a category and price directly through the service
+func (s *testServer) createPricedListing(userID int, listingType, title, category string, price, lng, lat float64) Services.Listing {
+	s.t.Helper()
+
+	listing, err := s.app.Service.Listings.Create(context.Background(), &Services.Listing{
+		Type:        listingType,
+		Location:    geo.NewPoint(lng, lat),
+		UserID:      userID,
+		Title:       title,
+		Description: title,
+		Category:    category,
+		Price:       price,
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return listing
+}
+
+func TestMatching(t *testing.T) {
+	s := newTestServer(t)
+	client, clientToken := s.createUser("Client", "+96170000001")
+	tiler, tilerToken := s.createUser("Tiler", "+96170000002")
+	painter, _ := s.createUser("Painter", "+96170000003")
+	faraway, _ := s.createUser("Faraway", "+96170000004")
+
+	request := s.createPricedListing(client.UserID, "Request", "Kitchen floor tiling", "tiling", 200, 35.5018, 33.8938)
+	tiling := s.createPricedListing(tiler.UserID, "Offer", "Tiling kitchen and bathroom floors", "tiling", 150, 35.5100, 33.8900)
+	s.createPricedListing(tiler.UserID, "Offer", "Bathroom tiling", "tiling", 400, 35.5100, 33.8900)
+	s.createPricedListing(painter.UserID, "Offer", "Painting walls", "painting", 300, 35.5050, 33.8950)
+	s.createPricedListing(faraway.UserID, "Offer", "Kitchen floor tiling", "tiling", 100, 35.8498, 34.4346)
+
+	path := "/api/v1/match/tradesmen/" + strconv.Itoa(request.ListingID)
+	suggestions := decodeSuggestions(t, s.do(http.MethodGet, path, nil, "", clientToken))
+	if len(suggestions) != 2 {
+		t.Fatalf("expected the two nearby tradesmen, got %+v", suggestions)
+	}
+	best := suggestions[0]
+	if best.Listing.ListingID != tiling.ListingID || best.MatchedListing.ListingID != request.ListingID || best.Score <= suggestions[1].Score {
+		t.Fatalf("expected the cheaper tiling offer first, got %+v", suggestions)
+	}
+	reasons := map[string]Services.MatchReason{}
+	for _, reason := range best.Reasons {
+		reasons[reason.Factor] = reason
+	}
+	if len(reasons) != 6 || reasons["category"].Score != 1 || reasons["price"].Score != 1 || reasons["text"].Score == 0 || reasons["rating"].Detail != "not rated yet" {
+		t.Fatalf("unexpected reasons %+v", best.Reasons)
+	}
+
+	if limited := decodeSuggestions(t, s.do(http.MethodGet, path+"?limit=1", nil, "", clientToken)); len(limited) != 1 {
+		t.Fatalf("expected one suggestion, got %+v", limited)
+	}
+	expectStatus(t, s.do(http.MethodGet, path+"?limit=none", nil, "", clientToken), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodGet, path, nil, "", tilerToken), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/match/tradesmen/"+strconv.Itoa(tiling.ListingID), nil, "", tilerToken), http.StatusBadRequest)
+
+	// The tiler's feed holds the request once, matched against their best offer for it
+	jobs := decodeSuggestions(t, s.do(http.MethodGet, "/api/v1/match/jobs", nil, "", tilerToken))
+	if len(jobs) != 1 || jobs[0].Listing.ListingID != request.ListingID || jobs[0].MatchedListing.ListingID != tiling.ListingID {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+	if jobs := decodeSuggestions(t, s.do(http.MethodGet, "/api/v1/match/jobs", nil, "", clientToken)); len(jobs) != 0 {
+		t.Fatalf("a user without offers has no jobs, got %+v", jobs)
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/match/jobs", nil, "", ""), http.StatusUnauthorized)
+
+	// Weights are configurable: ranking on price alone puts the painter's over budget offer last
+	s.app.config.matching.Weights = Services.MatchWeights{Price: 1}
+	suggestions = decodeSuggestions(t, s.do(http.MethodGet, path, nil, "", clientToken))
+	if suggestions[0].Score != 1 || suggestions[1].Score >= 1 {
+		t.Fatalf("unexpected price only ranking %+v", suggestions)
+	}
+}
+
+func TestMatchingAcrossCurrencies(t *testing.T) {
+	s := newTestServer(t)
+	client, clientToken := s.createUser("Client", "+96170000001")
+	tiler, _ := s.createUser("Tiler", "+96170000002")
+	painter, _ := s.createUser("Painter", "+96170000003")
+	if _, err := s.app.Service.ExchangeRates.Set(context.Background(), Services.ExchangeRate{From: "EUR", To: "USD", Rate: 1.5, SetBy: client.UserID}); err != nil {
+		t.Fatal(err)
+	}
+
+	request := s.createPricedListing(client.UserID, "Request", "Kitchen floor tiling", "tiling", 200, 35.5018, 33.8938)
+	for _, offer := range []struct {
+		user     Services.User
+		price    float64
+		currency string
+	}{{tiler, 150, "EUR"}, {painter, 150, "GBP"}} {
+		if _, err := s.app.Service.Listings.Create(context.Background(), &Services.Listing{Type: "Offer", Location: geo.NewPoint(35.51, 33.89),
+			UserID: offer.user.UserID, Title: "Tiling", Description: "Tiling", Category: "tiling", Price: offer.price, CurrencyCode: offer.currency}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 150 EUR is 225 USD, over the budget; 150 GBP has no rate and is not compared
+	prices := map[int]Services.MatchReason{}
+	for _, suggestion := range decodeSuggestions(t, s.do(http.MethodGet, "/api/v1/match/tradesmen/"+strconv.Itoa(request.ListingID), nil, "", clientToken)) {
+		for _, reason := range suggestion.Reasons {
+			if reason.Factor == "price" {
+				prices[suggestion.Listing.UserID] = reason
+			}
+		}
+	}
+	if len(prices) != 2 || prices[tiler.UserID].Score >= 1 || prices[tiler.UserID].Detail != "asks 225.00 USD, over the budget of 200.00" ||
+		prices[painter.UserID].Score != 0.5 {
+		t.Fatalf("unexpected price reasons %+v", prices)
+	}
+}
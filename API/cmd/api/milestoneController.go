@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"github.com/google/uuid"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// milestonesRequest is the body of the request setting a transaction's milestones
+type milestonesRequest struct {
+	// Milestones replace those of the transaction, in order. Their amounts add up to its price.
+	Milestones []Services.Milestone `json:"milestones"`
+}
+
+// evidenceExtensions are the photo types accepted as evidence of a finished milestone
+var evidenceExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".bmp":  true,
+}
+
+// checkMilestones keeps a transaction's status in line with its milestones: it can only be
+// accepted while they add up to its price, and only completes once all of them are approved.
+func (app *application) checkMilestones(ctx context.Context, stored, updated Services.Transaction) error {
+	milestones, err := app.Service.Milestones.GetByTransaction(ctx, updated.TransactionID)
+	if err != nil || len(milestones) == 0 {
+		return err
+	}
+
+	if updated.Status == "Accepted" && stored.Status != "Accepted" {
+		return Services.MilestonesCoverPrice(updated, milestones)
+	}
+	if updated.Status == "Completed" && stored.Status != "Completed" {
+		for _, milestone := range milestones {
+			if milestone.Status != Services.MilestoneApproved {
+				return fmt.Errorf("the transaction completes once all of its milestones are approved: %w", Services.ErrConflict)
+			}
+		}
+	}
+	return nil
+}
+
+// milestoneTransaction returns a milestone with its transaction
+func (app *application) milestoneTransaction(ctx context.Context, milestoneID int) (Services.Milestone, Services.Transaction, error) {
+	milestone, err := app.Service.Milestones.GetByID(ctx, milestoneID)
+	if err != nil {
+		return Services.Milestone{}, Services.Transaction{}, err
+	}
+	transaction, err := app.Service.Transactions.GetByID(ctx, milestone.TransactionID)
+	if err != nil {
+		return Services.Milestone{}, Services.Transaction{}, err
+	}
+	return milestone, transaction, nil
+}
+
+// writeMilestones responds with a transaction's milestones
+func (app *application) writeMilestones(w http.ResponseWriter, r *http.Request, milestones []Services.Milestone) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(milestones)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// setTransactionMilestones handles the request to split a Pending transaction into milestones.
+// Either party may propose them; an empty list pays for the whole job at once again.
+func (app *application) setTransactionMilestones(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var request milestonesRequest
+	err = decodeJSON(r, &request)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
+		app.respondError(w, r, fmt.Errorf("cannot plan a transaction you are not part of: %w", Services.ErrForbidden))
+		return
+	}
+	// Once accepted, the deposit is held against the agreed plan
+	if transaction.Status != "Pending" {
+		app.respondError(w, r, fmt.Errorf("milestones can only change while the transaction is Pending: %w", Services.ErrConflict))
+		return
+	}
+
+	milestones, err := app.Service.Milestones.Set(r.Context(), transaction, request.Milestones)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.writeMilestones(w, r, milestones)
+}
+
+// getTransactionMilestones handles the request to get the milestones of a transaction with their evidence.
+// Only the parties to the transaction see them; others are told it does not exist.
+func (app *application) getTransactionMilestones(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err == nil && transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
+		err = fmt.Errorf("transaction %w", Services.ErrNotFound)
+	}
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	milestones, err := app.Service.Milestones.GetByTransaction(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	app.writeMilestones(w, r, milestones)
+}
+
+// markMilestoneDone handles the tradesman's request to mark a milestone of an Accepted transaction
+// as done, with at least one photo as evidence uploaded as a multipart form.
+func (app *application) markMilestoneDone(w http.ResponseWriter, r *http.Request) {
+	milestoneID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	milestone, transaction, err := app.milestoneTransaction(r.Context(), milestoneID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if transaction.UserOfferingID != tokenUserID {
+		app.respondError(w, r, fmt.Errorf("only the tradesman can mark a milestone done: %w", Services.ErrForbidden))
+		return
+	}
+	if transaction.Status != "Accepted" || milestone.Status != Services.MilestonePending {
+		app.respondError(w, r, fmt.Errorf("only Pending milestones of an Accepted transaction can be marked done: %w", Services.ErrConflict))
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		app.respondError(w, r, Services.Invalid("body", "must be a multipart form of at most 10MB"))
+		return
+	}
+	var photos int
+	for _, fileHeaders := range r.MultipartForm.File {
+		for _, fileHeader := range fileHeaders {
+			if !evidenceExtensions[strings.ToLower(filepath.Ext(fileHeader.Filename))] {
+				app.respondError(w, r, Services.Invalid("file", "has an unsupported file type: "+fileHeader.Filename))
+				return
+			}
+			photos++
+		}
+	}
+	if photos == 0 {
+		app.respondError(w, r, Services.Invalid("file", "at least one photo is required as evidence"))
+		return
+	}
+
+	var evidence []string
+	for _, fileHeaders := range r.MultipartForm.File {
+		for _, fileHeader := range fileHeaders {
+			file, err := fileHeader.Open()
+			if err != nil {
+				app.respondError(w, r, err)
+				return
+			}
+			newFileName := uuid.New().String() + strings.ToLower(filepath.Ext(fileHeader.Filename))
+			_, err = Utils.SaveFile(file, imagesDir(), newFileName)
+			file.Close()
+			if err != nil {
+				app.respondError(w, r, err)
+				return
+			}
+			evidence = append(evidence, newFileName)
+		}
+	}
+
+	milestone, err = app.Service.Milestones.MarkDone(r.Context(), milestoneID, evidence)
+	if err != nil {
+		// The photos are only kept as evidence of a milestone
+		for _, name := range evidence {
+			os.Remove(filepath.Join(imagesDir(), name))
+		}
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(milestone)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// approveMilestone handles the client's request to approve a milestone marked done. Its amount is
+// released from escrow to the tradesman, and approving the last one completes the transaction.
+func (app *application) approveMilestone(w http.ResponseWriter, r *http.Request) {
+	milestoneID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	milestone, transaction, err := app.milestoneTransaction(r.Context(), milestoneID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if transaction.UserOfferedID != tokenUserID {
+		app.respondError(w, r, fmt.Errorf("only the client can approve a milestone: %w", Services.ErrForbidden))
+		return
+	}
+	if transaction.Status != "Accepted" || milestone.Status != Services.MilestoneDone {
+		app.respondError(w, r, fmt.Errorf("only milestones marked done on an Accepted transaction can be approved: %w", Services.ErrConflict))
+		return
+	}
+
+	// Approving releases the milestone's amount in the same step, so it is only paid for once
+	milestone, err = app.Service.Milestones.Approve(r.Context(), milestoneID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	milestones, err := app.Service.Milestones.GetByTransaction(r.Context(), transaction.TransactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	completed := true
+	for _, other := range milestones {
+		completed = completed && other.Status == Services.MilestoneApproved
+	}
+	if completed {
+		// The last approval released the whole deposit, so no money moves with the status
+		finished := transaction
+		finished.Status = "Completed"
+		err = app.Service.Transactions.Advance(r.Context(), transaction, finished, "", 0)
+		if err == nil {
+			err = app.finishTransaction(r.Context(), transaction.TransactionID, transaction.ListingID)
+		}
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(milestone)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// planMilestones splits the fixture's 150.50 transaction into a 50.50 and a 100.00 milestone
+func (f transactionFixture) planMilestones(t *testing.T) []Services.Milestone {
+	t.Helper()
+	rec := f.s.doJSON(http.MethodPut, "/api/v1/transaction/milestones/"+strconv.Itoa(f.transaction.TransactionID), milestonesRequest{
+		Milestones: []Services.Milestone{
+			{Description: "Remove the old tiles", Amount: 50.5, DueDate: "2025-01-12"},
+			{Description: "Lay the new floor", Amount: 100, DueDate: "2025-01-20"},
+		},
+	}, f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	var milestones []Services.Milestone
+	decode(t, rec, &milestones)
+	if len(milestones) != 2 || milestones[1].Position != 2 || milestones[1].Status != Services.MilestonePending {
+		t.Fatalf("unexpected milestones %+v", milestones)
+	}
+	return milestones
+}
+
+// finish marks a milestone done with a photo and approves it, returning the approval
+func (f transactionFixture) finish(t *testing.T, milestone Services.Milestone) *httptest.ResponseRecorder {
+	t.Helper()
+	expectStatus(t, f.s.upload("/api/v1/transaction/milestone/done/"+strconv.Itoa(milestone.MilestoneID), "floor.png", f.tradesToken), http.StatusOK)
+	return f.s.do(http.MethodPost, "/api/v1/transaction/milestone/approve/"+strconv.Itoa(milestone.MilestoneID), nil, "", f.clientToken)
+}
+
+func TestPlanMilestones(t *testing.T) {
+	f := seedTransaction(t)
+	_, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	path := "/api/v1/transaction/milestones/" + strconv.Itoa(f.transaction.TransactionID)
+
+	short := milestonesRequest{Milestones: []Services.Milestone{{Description: "Everything", Amount: 100, DueDate: "2025-01-15"}}}
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, short, f.clientToken), http.StatusBadRequest)
+	late := milestonesRequest{Milestones: []Services.Milestone{{Description: "Everything", Amount: 150.5, DueDate: "2025-02-01"}}}
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, late, f.clientToken), http.StatusBadRequest)
+	whole := milestonesRequest{Milestones: []Services.Milestone{{Description: "Everything", Amount: 150.5, DueDate: "2025-01-20"}}}
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, whole, outsiderToken), http.StatusForbidden)
+
+	// Planning again replaces the earlier plan
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, whole, f.clientToken), http.StatusOK)
+	f.planMilestones(t)
+
+	var milestones []Services.Milestone
+	rec := f.s.do(http.MethodGet, path, nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &milestones)
+	if len(milestones) != 2 || milestones[0].Description != "Remove the old tiles" || milestones[0].Amount != 50.5 {
+		t.Fatalf("unexpected milestones %+v", milestones)
+	}
+	expectStatus(t, f.s.do(http.MethodGet, path, nil, "", outsiderToken), http.StatusNotFound)
+
+	// The contracts list the plan
+	rec = f.s.do(http.MethodGet, "/api/v1/transaction/contract/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	var contract contractResponse
+	decode(t, rec, &contract)
+	if !strings.Contains(contract.EnglishContract, "2. Lay the new floor: 100.00 USD, due 2025-01-20") ||
+		!strings.Contains(contract.ArabicContract, "1. Remove the old tiles: 50.50 USD") {
+		t.Fatalf("expected the milestones in the contracts, got %s", contract.EnglishContract)
+	}
+
+	// The price cannot be changed away from the plan, so accepting holds what was planned
+	repriced := f.transaction
+	repriced.Status, repriced.Price = "Accepted", 200
+	expectStatus(t, f.s.doJSON(http.MethodPut, "/api/v1/transaction/update/"+strconv.Itoa(f.transaction.TransactionID), repriced, f.tradesToken), http.StatusNoContent)
+	if payment := f.payment(t); payment.Amount != 150.5 {
+		t.Fatalf("expected the planned price in escrow, got %+v", payment)
+	}
+
+	// Once accepted the plan is fixed
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, whole, f.clientToken), http.StatusConflict)
+}
+
+func TestMilestonesReleaseThePayment(t *testing.T) {
+	f := seedTransaction(t)
+	milestones := f.planMilestones(t)
+	first, second := milestones[0], milestones[1]
+	donePath := "/api/v1/transaction/milestone/done/" + strconv.Itoa(first.MilestoneID)
+	approvePath := "/api/v1/transaction/milestone/approve/" + strconv.Itoa(first.MilestoneID)
+
+	// Nothing is done before the deposit is held
+	expectStatus(t, f.s.upload(donePath, "floor.png", f.tradesToken), http.StatusConflict)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+
+	expectStatus(t, f.s.upload(donePath, "floor.png", f.clientToken), http.StatusForbidden)
+	expectStatus(t, f.s.upload(donePath, "notes.txt", f.tradesToken), http.StatusBadRequest)
+	expectStatus(t, f.s.do(http.MethodPost, approvePath, nil, "", f.clientToken), http.StatusConflict)
+
+	rec := f.s.upload(donePath, "floor.png", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	var done Services.Milestone
+	decode(t, rec, &done)
+	if done.Status != Services.MilestoneDone || len(done.Evidence) != 1 || done.DateDone == "" {
+		t.Fatalf("unexpected milestone %+v", done)
+	}
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/image/image/"+done.Evidence[0], nil, "", ""), http.StatusOK)
+
+	// Approving pays the milestone's share, less its share of the fee
+	expectStatus(t, f.s.do(http.MethodPost, approvePath, nil, "", f.tradesToken), http.StatusForbidden)
+	expectStatus(t, f.s.do(http.MethodPost, approvePath, nil, "", f.clientToken), http.StatusOK)
+	expectStatus(t, f.s.do(http.MethodPost, approvePath, nil, "", f.clientToken), http.StatusConflict)
+	payment := f.payment(t)
+	if payment.Status != Services.PaymentHeld || payment.Released != 50.5 || f.s.payments.Balance(f.tradesman.UserID) != 47.97 || f.s.payments.Held() != 100 {
+		t.Fatalf("expected 50.50 released, got %+v and %.2f paid out", payment, f.s.payments.Balance(f.tradesman.UserID))
+	}
+	balanced(t, payment)
+
+	// The transaction only completes with the last approval
+	expectStatus(t, f.setStatus("Completed"), http.StatusConflict)
+	expectStatus(t, f.finish(t, second), http.StatusOK)
+
+	stored, _ := f.s.app.Service.Transactions.GetByID(context.Background(), f.transaction.TransactionID)
+	if stored.Status != "Completed" {
+		t.Fatalf("expected the transaction to complete, got %+v", stored)
+	}
+	payment = f.payment(t)
+	if payment.Status != Services.PaymentReleased || payment.Released != 150.5 {
+		t.Fatalf("unexpected released payment %+v", payment)
+	}
+	balanced(t, payment)
+	if f.s.payments.Balance(f.tradesman.UserID) != 142.97 || f.s.payments.Fees() != 7.53 || f.s.payments.Held() != 0 {
+		t.Fatalf("expected 142.97 paid out and 7.53 kept, got %.2f and %.2f", f.s.payments.Balance(f.tradesman.UserID), f.s.payments.Fees())
+	}
+
+	// The client can still rate the completed job
+	rated := stored
+	rated.Rating = 5
+	expectStatus(t, f.s.doJSON(http.MethodPut, "/api/v1/transaction/update/"+strconv.Itoa(f.transaction.TransactionID), rated, f.clientToken), http.StatusNoContent)
+}
+
+func TestMilestoneApprovedOnce(t *testing.T) {
+	f := seedTransaction(t)
+	first := f.planMilestones(t)[0]
+	approvePath := "/api/v1/transaction/milestone/approve/" + strconv.Itoa(first.MilestoneID)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	expectStatus(t, f.s.upload("/api/v1/transaction/milestone/done/"+strconv.Itoa(first.MilestoneID), "floor.png", f.tradesToken), http.StatusOK)
+
+	// A declined payout leaves the milestone waiting for approval
+	f.s.payments.Decline = true
+	expectStatus(t, f.s.do(http.MethodPost, approvePath, nil, "", f.clientToken), http.StatusPaymentRequired)
+	f.s.payments.Decline = false
+	stored, _ := f.s.app.Service.Milestones.GetByID(context.Background(), first.MilestoneID)
+	if stored.Status != Services.MilestoneDone || f.payment(t).Released != 0 {
+		t.Fatalf("expected the milestone to stay done and nothing released, got %+v", stored)
+	}
+
+	// Of approvals sent at once, only one pays the milestone
+	codes := make([]int, 5)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = f.s.do(http.MethodPost, approvePath, nil, "", f.clientToken).Code
+		}()
+	}
+	wg.Wait()
+	approved := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			approved++
+		} else if code != http.StatusConflict {
+			t.Fatalf("expected the other approvals to conflict, got %v", codes)
+		}
+	}
+	if approved != 1 || f.payment(t).Released != 50.5 || f.s.payments.Balance(f.tradesman.UserID) != 47.97 {
+		t.Fatalf("expected one approval releasing 50.50, got %v and %.2f paid out", codes, f.s.payments.Balance(f.tradesman.UserID))
+	}
+}
+
+func TestCancelRefundsUnapprovedMilestones(t *testing.T) {
+	f := seedTransaction(t)
+	milestones := f.planMilestones(t)
+
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	expectStatus(t, f.finish(t, milestones[0]), http.StatusOK)
+	expectStatus(t, f.setStatus("Cancelled"), http.StatusNoContent)
+
+	payment := f.payment(t)
+	if payment.Status != Services.PaymentRefunded || payment.Released != 50.5 {
+		t.Fatalf("unexpected refunded payment %+v", payment)
+	}
+	balanced(t, payment)
+	if f.s.payments.Balance(f.client.UserID) != -50.5 || f.s.payments.Held() != 0 {
+		t.Fatalf("expected the client to get the unapproved 100.00 back, got %.2f", f.s.payments.Balance(f.client.UserID))
+	}
+}
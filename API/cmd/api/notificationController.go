@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"log"
+	"net/http"
+	"time"
+)
+
+// getNotifications handles the request to list the caller's notifications, newest first.
+// ?unread=true restricts the list to notifications that were not marked as read.
+func (app *application) getNotifications(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := app.Service.Notifications.GetByUser(r.Context(), tokenUserId, unreadOnly)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(notifications)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// markNotificationRead handles the request to mark one of the caller's notifications as read.
+func (app *application) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	// Other users' notifications are reported as not found
+	err = app.Service.Notifications.MarkRead(r.Context(), notificationID, tokenUserId)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listingLifecycleJob expires the listings whose lifetime ran out and reminds owners
+// of listings about to expire, notifying them in both cases.
+func (app *application) listingLifecycleJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "listing lifecycle",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			expired, err := app.Service.Listings.Expire(ctx)
+			if err != nil {
+				return err
+			}
+			for _, listing := range expired {
+				err = app.notify(ctx, listing, Services.NotifyListingExpired,
+					fmt.Sprintf("Your listing %q has expired. Renew it to make it visible again.", listing.Title))
+				if err != nil {
+					return err
+				}
+			}
+
+			expiring, err := app.Service.Listings.ExpiryReminders(ctx, app.config.listings.reminderBefore)
+			if err != nil {
+				return err
+			}
+			for _, listing := range expiring {
+				err = app.notify(ctx, listing, Services.NotifyListingExpiring,
+					fmt.Sprintf("Your listing %q expires on %s. Renew it to keep it visible.", listing.Title, listing.ExpiresAt))
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(expired)+len(expiring) > 0 {
+				log.Printf("expired %d listings and sent %d expiry reminders", len(expired), len(expiring))
+			}
+			return nil
+		},
+	}
+}
+
+// notify sends the owner of listing a notification about it
+func (app *application) notify(ctx context.Context, listing Services.Listing, kind, message string) error {
+	return app.Service.Notifications.Create(ctx, &Services.Notification{
+		UserID:    listing.UserID,
+		Kind:      kind,
+		Message:   message,
+		ListingID: listing.ListingID,
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func decodeNotifications(t *testing.T, rec *httptest.ResponseRecorder) []Services.Notification {
+	t.Helper()
+	expectStatus(t, rec, http.StatusOK)
+
+	var notifications []Services.Notification
+	decode(t, rec, &notifications)
+	return notifications
+}
+
+func TestListingLifecycleJob(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	user, token := s.createUser("Adam", "+96170000001")
+	_, otherToken := s.createUser("Other", "+96170000002")
+	lifecycle := s.app.listingLifecycleJob()
+
+	// Requests expire after a year, well past the reminder window
+	t.Setenv("LISTING_REQUEST_DAYS", "365")
+	s.createListing(user.UserID, "Request", "Need a plumber", 35.5, 33.9)
+	if err := lifecycle.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if notifications := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", token)); len(notifications) != 0 {
+		t.Fatalf("expected no notifications yet, got %+v", notifications)
+	}
+
+	// Offers living two days are reminded about once, inside the three day window
+	t.Setenv("LISTING_OFFER_DAYS", "2")
+	expiring := s.createListing(user.UserID, "Offer", "Tiling work", 35.5, 33.9)
+	for i := 0; i < 2; i++ {
+		if err := lifecycle.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifications := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", token))
+	if len(notifications) != 1 || notifications[0].Kind != Services.NotifyListingExpiring || notifications[0].ListingID != expiring.ListingID {
+		t.Fatalf("expected one expiry reminder, got %+v", notifications)
+	}
+
+	// Offers without a lifetime expire on the next run
+	t.Setenv("LISTING_OFFER_DAYS", "0")
+	expired := s.createListing(user.UserID, "Offer", "Painting", 35.5, 33.9)
+	if err := lifecycle.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := s.app.Service.Listings.GetByID(ctx, expired.ListingID)
+	if stored.Status != Services.ListingExpired || stored.Active {
+		t.Fatalf("expected the listing to expire, got %+v", stored)
+	}
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/listings/Offer", nil, "", ""))); len(titles) != 1 {
+		t.Fatalf("expired listing is browsable: %v", titles)
+	}
+
+	notifications = decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications?unread=true", nil, "", token))
+	if len(notifications) != 2 || notifications[0].Kind != Services.NotifyListingExpired || notifications[0].ListingID != expired.ListingID {
+		t.Fatalf("expected the expiry notification first, got %+v", notifications)
+	}
+
+	// Renewing an expired listing publishes it again
+	t.Setenv("LISTING_OFFER_DAYS", "60")
+	rec := s.do(http.MethodPut, "/api/v1/listing/renew/"+strconv.Itoa(expired.ListingID), nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var renewed Services.Listing
+	decode(t, rec, &renewed)
+	if renewed.Status != Services.ListingPublished || !renewed.Active {
+		t.Fatalf("unexpected renewed listing %+v", renewed)
+	}
+
+	// Only the owner can mark a notification as read
+	path := "/api/v1/notification/read/" + strconv.Itoa(notifications[0].NotificationID)
+	expectStatus(t, s.do(http.MethodPut, path, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodPut, path, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodPut, path, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", ""), http.StatusUnauthorized)
+
+	if unread := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications?unread=true", nil, "", token)); len(unread) != 1 {
+		t.Fatalf("expected one unread notification, got %+v", unread)
+	}
+	if all := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", token)); len(all) != 2 || all[0].ReadAt == "" {
+		t.Fatalf("expected the read notification to keep its place, got %+v", all)
+	}
+}
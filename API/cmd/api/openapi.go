@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Middleware"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/OpenAPI"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed docs/index.html
+var docsPage []byte
+
+// swaggerUI is where the docs page loads Swagger UI from, pinned to the release it was written for
+const swaggerUI = "https://unpkg.com/swagger-ui-dist@5.17.14/"
+
+// docsPolicy lets the docs page load Swagger UI from swaggerUI only, and run no script
+// but its own inline one
+var docsPolicy = "default-src 'self'; script-src " + inlineScriptHash(docsPage) + " " + swaggerUI +
+	"; style-src 'unsafe-inline' " + swaggerUI + "; img-src 'self' data:; connect-src 'self'; object-src 'none'; base-uri 'none'"
+
+// inlineScriptHash returns the CSP source of the inline script of page, the last <script> without a src
+func inlineScriptHash(page []byte) string {
+	start := bytes.LastIndex(page, []byte("<script>"))
+	end := bytes.LastIndex(page, []byte("</script>"))
+	if start < 0 || end < start {
+		return "'none'"
+	}
+	sum := sha256.Sum256(page[start+len("<script>") : end])
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// operation documents one mounted route. The path, its parameters and whether
+// it needs a token are read from the router; the rest is declared here.
+type operation struct {
+	Summary string
+	Tag     string
+
+	// Request is a value of the JSON body type, nil when the route takes none
+	Request interface{}
+	// Upload marks routes that take image files as multipart/form-data
+	Upload bool
+
+	// Status is the success status, 200 when zero
+	Status int
+	// Response is a value of the JSON body type returned on success
+	Response interface{}
+	// ContentType is the success content type when the body is not JSON
+	ContentType string
+	// GeoJSON marks listing queries that answer Accept: application/geo+json, taking ?properties=
+	GeoJSON bool
+	// Alternatives are other content types the route answers when asked for them with the Accept header
+	Alternatives []string
+	// Scope marks routes of the public API, called with an API key granted this scope
+	Scope string
+}
+
+// operations documents every route of mount, keyed by "METHOD pattern"
+var operations = map[string]operation{
+	"GET /api/v1/openapi.json": {Summary: "Get this OpenAPI document", Tag: "Docs", ContentType: "application/json"},
+	"GET /api/v1/docs":         {Summary: "Browse the API documentation", Tag: "Docs", ContentType: "text/html"},
+
+	"GET /api/v1/user/users":           {Summary: "Get the profiles of all users", Tag: "Users", Response: []Services.Profile{}},
+	"GET /api/v1/user/userId/{id}":     {Summary: "Get a user's profile by ID", Tag: "Users", Response: Services.Profile{}},
+	"GET /api/v1/user/userName/{name}": {Summary: "Get user profiles by name", Tag: "Users", Response: []Services.Profile{}},
+	"POST /api/v1/user/create":         {Summary: "Create a new user", Tag: "Users", Request: Services.User{}, Status: http.StatusCreated, Response: Services.User{}},
+	"DELETE /api/v1/user/delete/{id}":  {Summary: "Close a user's account, anonymising their data", Tag: "Users", Status: http.StatusNoContent},
+	"PUT /api/v1/user/update/{id}":     {Summary: "Update a user", Tag: "Users", Request: Services.User{}, ContentType: "text/plain"},
+	"GET /api/v1/user/export/{id}":     {Summary: "Download a zip of everything stored about a user", Tag: "Users", ContentType: "application/zip"},
+	"POST /api/v1/user/auth":           {Summary: "Authenticate a user", Tag: "Users", Request: credentials{}, Response: authResponse{}},
+
+	"GET /api/v1/listing/export/{type}":                                                                                {Summary: "Stream every published listing as newline-delimited GeoJSON features with fuzzed points", Tag: "Listings", ContentType: geoJSONSeqType},
+	"GET /api/v1/listing/listings/{type}":                                                                              {Summary: "Get all listings", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/listingId/{id}":                                                                               {Summary: "Get a listing by ID, drafts only for their owner", Tag: "Listings", Response: Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/listings/user/{user_id}/{type}":                                                               {Summary: "Get listings by user ID, every status for the owner and published ones for others", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/search/{query}/{type}":                                                                        {Summary: "Get listings by search query and type, with labelled promoted listings targeting ?region_id= and ?category=", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/date/{type}":                                                                                  {Summary: "Get listings by date created, newest first", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/date/search/{query}/{type}":                                                                   {Summary: "Get listings by date and search query, with labelled promoted listings targeting ?region_id= and ?category=", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/distance/{longitude}/{latitude}/{max_distance}/{type}":                                        {Summary: "Get listings by location and distance", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/distance/{longitude}/{latitude}/{max_distance}/{type}/{query}":                                {Summary: "Get listings by location, distance and search query, with labelled promoted listings targeting ?region_id= and ?category=", Tag: "Listings", Response: []Services.Listing{}, GeoJSON: true},
+	"GET /api/v1/listing/viewport/{min_longitude}/{min_latitude}/{max_longitude}/{max_latitude}/{zoom}/{type}":         {Summary: "Get the listings in a map viewport, clustered when zoomed out", Tag: "Listings", Response: Services.MapView{}, GeoJSON: true},
+	"GET /api/v1/listing/viewport/{min_longitude}/{min_latitude}/{max_longitude}/{max_latitude}/{zoom}/{type}/{query}": {Summary: "Get the listings in a map viewport matching a search query, clustered when zoomed out", Tag: "Listings", Response: Services.MapView{}, GeoJSON: true},
+	"POST /api/v1/listing/create":                                                                                      {Summary: "Create a new listing", Tag: "Listings", Request: Services.Listing{}, Status: http.StatusCreated, Response: Services.Listing{}},
+	"PUT /api/v1/listing/update/{id}":                                                                                  {Summary: "Update a listing", Tag: "Listings", Request: Services.Listing{}, ContentType: "text/plain"},
+	"DELETE /api/v1/listing/delete/{id}":                                                                               {Summary: "Delete a listing, restorable during the grace period", Tag: "Listings", Status: http.StatusNoContent},
+	"POST /api/v1/listing/restore/{id}":                                                                                {Summary: "Restore one of your deleted listings", Tag: "Listings", Response: Services.Listing{}},
+	"PUT /api/v1/listing/status/{id}/{status}":                                                                         {Summary: "Publish, pause or close one of your listings", Tag: "Listings", Response: Services.Listing{}},
+	"PUT /api/v1/listing/renew/{id}":                                                                                   {Summary: "Renew one of your published or expired listings", Tag: "Listings", Response: Services.Listing{}},
+
+	"POST /api/v1/image/uploadForListing/{listing_id}":      {Summary: "Upload images for a listing", Tag: "Images", Upload: true, ContentType: "text/plain"},
+	"POST /api/v1/image/uploadProfilePicture/{user_id}":     {Summary: "Upload a profile image", Tag: "Images", Upload: true, ContentType: "text/plain"},
+	"GET /api/v1/image/imageId/{image_id}":                  {Summary: "Get an image file by ID", Tag: "Images", ContentType: "image/*"},
+	"GET /api/v1/image/image/{image_id}":                    {Summary: "Get an image file by UUID", Tag: "Images", ContentType: "image/*"},
+	"GET /api/v1/image/listing/{listing_id}":                {Summary: "Get all images for a listing", Tag: "Images", Response: []Services.Image{}},
+	"GET /api/v1/image/user/{user_id}":                      {Summary: "Get all images of a user", Tag: "Images", Response: []Services.Image{}},
+	"GET /api/v1/image/profile/{user_id}":                   {Summary: "Get the images a user shows on their profile", Tag: "Images", Response: []Services.Image{}},
+	"DELETE /api/v1/image/delete/{image_id}":                {Summary: "Delete an image", Tag: "Images", ContentType: "text/plain"},
+	"PUT /api/v1/image/update/{image_id}/{show_on_profile}": {Summary: "Set whether an image shows on the profile", Tag: "Images", ContentType: "text/plain"},
+
+	"POST /api/v1/transaction/create":                       {Summary: "Create a new transaction", Tag: "Transactions", Request: Services.Transaction{}, Status: http.StatusCreated, Response: Services.Transaction{}},
+	"GET /api/v1/transaction/transactionId/{id}":            {Summary: "Get a transaction by ID", Tag: "Transactions", Response: Services.Transaction{}},
+	"GET /api/v1/transaction/offered/{user_id}/{status}":    {Summary: "Get your transactions as the offered user, by status", Tag: "Transactions", Response: []Services.Transaction{}},
+	"GET /api/v1/transaction/offering/{user_id}/{status}":   {Summary: "Get your transactions as the offering user, by status", Tag: "Transactions", Response: []Services.Transaction{}},
+	"GET /api/v1/transaction/listing/{listing_id}/{status}": {Summary: "Get the transactions on one of your listings, by status", Tag: "Transactions", Response: []Services.Transaction{}},
+	"PUT /api/v1/transaction/update/{id}":                   {Summary: "Update a transaction", Tag: "Transactions", Request: transactionUpdate{}, Status: http.StatusNoContent},
+	"DELETE /api/v1/transaction/delete/{id}":                {Summary: "Delete a transaction, restorable during the grace period", Tag: "Transactions", Status: http.StatusNoContent},
+	"POST /api/v1/transaction/restore/{id}":                 {Summary: "Restore a deleted transaction you are part of", Tag: "Transactions", Response: Services.Transaction{}},
+	"GET /api/v1/transaction/contract/{id}":                 {Summary: "Generate the contracts of a transaction you are part of", Tag: "Transactions", Response: contractResponse{}},
+	"GET /api/v1/transaction/payment/{id}":                  {Summary: "Get the escrow payment of a transaction you are part of, with its ledger entries", Tag: "Transactions", Response: Services.Payment{}},
+	"GET /api/v1/transaction/rates/{id}":                    {Summary: "Get the exchange rates recorded when a transaction you are part of was accepted", Tag: "Transactions", Response: []Services.ExchangeRate{}},
+	"GET /api/v1/transaction/milestones/{id}":               {Summary: "Get the milestones of a transaction you are part of, with their evidence", Tag: "Transactions", Response: []Services.Milestone{}},
+	"PUT /api/v1/transaction/milestones/{id}":               {Summary: "Split a Pending transaction into milestones adding up to its price", Tag: "Transactions", Request: milestonesRequest{}, Response: []Services.Milestone{}},
+	"POST /api/v1/transaction/milestone/done/{id}":          {Summary: "Mark a milestone done with photos as evidence (tradesman)", Tag: "Transactions", Upload: true, Response: Services.Milestone{}},
+	"POST /api/v1/transaction/milestone/approve/{id}":       {Summary: "Approve a milestone, releasing its amount from escrow (client)", Tag: "Transactions", Response: Services.Milestone{}},
+
+	"POST /api/v1/invoice/issue/{id}":          {Summary: "Get the invoice of a Completed transaction you are part of, issuing it if needed", Tag: "Invoices", Response: Services.Invoice{}, Alternatives: []string{htmlType, pdfType}},
+	"GET /api/v1/invoice/invoiceId/{id}":       {Summary: "Get an invoice you are party to", Tag: "Invoices", Response: Services.Invoice{}, Alternatives: []string{htmlType, pdfType}},
+	"GET /api/v1/invoice/receipt/{id}":         {Summary: "Get the receipt of a paid invoice you are party to", Tag: "Invoices", Response: Services.Invoice{}, Alternatives: []string{htmlType, pdfType}},
+	"GET /api/v1/invoice/invoices/{from}/{to}": {Summary: "List the invoices you issued between two dates, both included", Tag: "Invoices", Response: []Services.Invoice{}, Alternatives: []string{csvType}},
+
+	"GET /api/v1/subscription/plans":   {Summary: "List the plans, their prices and what each of them allows", Tag: "Subscriptions", Response: []Services.Plan{}},
+	"GET /api/v1/subscription/current": {Summary: "Get your plan for the current period and what it allows", Tag: "Subscriptions", Response: Services.Subscription{}},
+	"PUT /api/v1/subscription/change":  {Summary: "Change plan: upgrades are charged pro rata at once, downgrades apply when the period ends", Tag: "Subscriptions", Request: subscriptionRequest{}, Response: Services.Subscription{}},
+	"GET /api/v1/subscription/charges": {Summary: "List what you paid for plans, most recent first", Tag: "Subscriptions", Response: []Services.SubscriptionCharge{}},
+
+	"POST /api/v1/promotion/create":          {Summary: "Promote one of your listings, holding its daily budget for every day", Tag: "Promotions", Request: Services.Promotion{}, Status: http.StatusCreated, Response: Services.Promotion{}},
+	"GET /api/v1/promotion/promotions":       {Summary: "List your promotions, newest first", Tag: "Promotions", Response: []Services.Promotion{}},
+	"GET /api/v1/promotion/promotionId/{id}": {Summary: "Get one of your promotions with its impressions, clicks and spend", Tag: "Promotions", Response: Services.Promotion{}},
+	"GET /api/v1/promotion/days/{id}":        {Summary: "Get the impressions, clicks and spend of one of your promotions by day", Tag: "Promotions", Response: []Services.PromotionDay{}},
+	"POST /api/v1/promotion/cancel/{id}":     {Summary: "Stop one of your promotions and refund what it did not spend", Tag: "Promotions", Response: Services.Promotion{}},
+	"POST /api/v1/promotion/click/{id}":      {Summary: "Record that a promoted listing shown in search results was opened, with its single-use click token", Tag: "Promotions", Request: Services.PromotionClick{}, Status: http.StatusNoContent},
+
+	"GET /api/v1/analytics/days/{from}/{to}":     {Summary: "Get the views, search impressions, profile visits, favourites and inquiries you had by day, between two dates (analytics plans only)", Tag: "Analytics", Response: []Services.AnalyticsDay{}},
+	"GET /api/v1/analytics/listings/{from}/{to}": {Summary: "Get the views, search impressions, favourites and inquiries of each of your listings between two dates, most viewed first (analytics plans only)", Tag: "Analytics", Response: []Services.ListingAnalytics{}},
+	"GET /api/v1/analytics/funnel/{from}/{to}":   {Summary: "Follow the transactions you were offered between two dates from offer to completion (analytics plans only)", Tag: "Analytics", Response: Services.Funnel{}},
+	"GET /api/v1/analytics/revenue/{from}/{to}":  {Summary: "Get what you were paid out of escrow by month and currency between two dates (analytics plans only)", Tag: "Analytics", Response: []Services.MonthlyRevenue{}},
+
+	"POST /api/v1/apiclient/create":                {Summary: "Register an API client for the public API, returning its key once", Tag: "API clients", Request: Services.APIClient{}, Status: http.StatusCreated, Response: Services.APIClient{}},
+	"GET /api/v1/apiclient/clients":                {Summary: "List the API clients you registered", Tag: "API clients", Response: []Services.APIClient{}},
+	"GET /api/v1/apiclient/clientId/{id}":          {Summary: "Get one of your API clients", Tag: "API clients", Response: Services.APIClient{}},
+	"POST /api/v1/apiclient/rotate/{id}":           {Summary: "Issue a new key for one of your API clients, the previous key stops working", Tag: "API clients", Response: Services.APIClient{}},
+	"DELETE /api/v1/apiclient/revoke/{id}":         {Summary: "Stop the key of one of your API clients from working", Tag: "API clients", Status: http.StatusNoContent},
+	"GET /api/v1/apiclient/usage/{id}/{from}/{to}": {Summary: "Get the requests of one of your API clients by day between two dates", Tag: "API clients", Response: []Services.APIUsage{}},
+	"GET /api/v1/admin/apiclients":                 {Summary: "List every API client (admins only)", Tag: "Admin", Response: []Services.APIClient{}},
+	"PUT /api/v1/admin/apiclients/limits/{id}":     {Summary: "Change the rate limit and daily quota of an API client (admins only)", Tag: "Admin", Request: Services.APILimits{}, Response: Services.APIClient{}},
+
+	"GET /api/v1/public/listing/listingId/{id}":                                        {Summary: "Get a published listing by ID", Tag: "Public API", Response: Services.Listing{}, GeoJSON: true, Scope: Services.ScopeListings},
+	"GET /api/v1/public/listing/search/{query}/{type}":                                 {Summary: "Get listings by search query and type", Tag: "Public API", Response: []Services.Listing{}, GeoJSON: true, Scope: Services.ScopeListings},
+	"GET /api/v1/public/listing/date/{type}":                                           {Summary: "Get listings by date created, newest first", Tag: "Public API", Response: []Services.Listing{}, GeoJSON: true, Scope: Services.ScopeListings},
+	"GET /api/v1/public/listing/distance/{longitude}/{latitude}/{max_distance}/{type}": {Summary: "Get listings by location and distance", Tag: "Public API", Response: []Services.Listing{}, GeoJSON: true, Scope: Services.ScopeListings},
+	"GET /api/v1/public/region/regions/{level}":                                        {Summary: "List the regions of a level with their listing and user counts", Tag: "Public API", Response: []Services.Region{}, Scope: Services.ScopeRegions},
+	"GET /api/v1/public/region/regionId/{id}":                                          {Summary: "Get a region with its boundary", Tag: "Public API", Response: Services.Region{}, Scope: Services.ScopeRegions},
+	"GET /api/v1/public/region/children/{id}":                                          {Summary: "List the regions directly inside a region", Tag: "Public API", Response: []Services.Region{}, Scope: Services.ScopeRegions},
+	"GET /api/v1/public/region/locate/{longitude}/{latitude}":                          {Summary: "List the regions containing a point, from the country down", Tag: "Public API", Response: []Services.Region{}, Scope: Services.ScopeRegions},
+	"GET /api/v1/public/region/listings/{id}/{type}":                                   {Summary: "List the published listings in a region or any region inside it (also needs listings:read)", Tag: "Public API", Response: []Services.Listing{}, Scope: Services.ScopeRegions},
+	"GET /api/v1/public/servicearea/districts":                                         {Summary: "List the named districts service areas are copied from", Tag: "Public API", Response: []Services.District{}, Scope: Services.ScopeAreas},
+	"GET /api/v1/public/servicearea/tradesmen/{longitude}/{latitude}":                  {Summary: "List the users whose service area contains a point", Tag: "Public API", Response: []Services.Profile{}, Scope: Services.ScopeAreas},
+
+	"GET /api/v1/notification/notifications": {Summary: "List your notifications, newest first (?unread=true for unread only)", Tag: "Notifications", Response: []Services.Notification{}},
+	"PUT /api/v1/notification/read/{id}":     {Summary: "Mark one of your notifications as read", Tag: "Notifications", Status: http.StatusNoContent},
+
+	"POST /api/v1/savedsearch/create":        {Summary: "Save a listing search to be alerted about new matches", Tag: "Saved searches", Request: Services.SavedSearch{}, Status: http.StatusCreated, Response: Services.SavedSearch{}},
+	"GET /api/v1/savedsearch/searches":       {Summary: "List your saved searches", Tag: "Saved searches", Response: []Services.SavedSearch{}},
+	"PUT /api/v1/savedsearch/update/{id}":    {Summary: "Change the filters or alert frequency of one of your saved searches", Tag: "Saved searches", Request: Services.SavedSearch{}, Response: Services.SavedSearch{}},
+	"DELETE /api/v1/savedsearch/delete/{id}": {Summary: "Delete one of your saved searches", Tag: "Saved searches", Status: http.StatusNoContent},
+	"GET /api/v1/savedsearch/matches/{id}":   {Summary: "List the published listings that matched one of your saved searches", Tag: "Saved searches", Response: []Services.Listing{}},
+
+	"GET /api/v1/match/tradesmen/{listing_id}": {Summary: "Rank the tradesmen matching one of your requests, with the reasons for each (?limit=)", Tag: "Matching", Response: []Services.Suggestion{}},
+	"GET /api/v1/match/jobs":                   {Summary: "Rank the requests matching your offers, with the reasons for each (?limit=)", Tag: "Matching", Response: []Services.Suggestion{}},
+
+	"PUT /api/v1/favourite/{kind}/{target_id}":    {Summary: "Add a listing or user to your favourites", Tag: "Favourites", Status: http.StatusNoContent},
+	"DELETE /api/v1/favourite/{kind}/{target_id}": {Summary: "Remove a listing or user from your favourites", Tag: "Favourites", Status: http.StatusNoContent},
+	"GET /api/v1/favourite/favourites":            {Summary: "List your favourite listings and users, with a notice on those no longer available", Tag: "Favourites", Response: []Services.ShortlistItem{}},
+
+	"POST /api/v1/shortlist/create":                         {Summary: "Create a named shortlist", Tag: "Favourites", Request: Services.Shortlist{}, Status: http.StatusCreated, Response: Services.Shortlist{}},
+	"GET /api/v1/shortlist/shortlists":                      {Summary: "List your shortlists with their items", Tag: "Favourites", Response: []Services.Shortlist{}},
+	"GET /api/v1/shortlist/shortlistId/{id}":                {Summary: "Get one of your shortlists with its items", Tag: "Favourites", Response: Services.Shortlist{}},
+	"PUT /api/v1/shortlist/update/{id}":                     {Summary: "Rename one of your shortlists", Tag: "Favourites", Request: Services.Shortlist{}, Response: Services.Shortlist{}},
+	"DELETE /api/v1/shortlist/delete/{id}":                  {Summary: "Delete one of your shortlists and its items", Tag: "Favourites", Status: http.StatusNoContent},
+	"PUT /api/v1/shortlist/item/{id}/{kind}/{target_id}":    {Summary: "Add a listing or user to one of your shortlists", Tag: "Favourites", Status: http.StatusNoContent},
+	"DELETE /api/v1/shortlist/item/{id}/{kind}/{target_id}": {Summary: "Remove a listing or user from one of your shortlists", Tag: "Favourites", Status: http.StatusNoContent},
+
+	"POST /api/v1/servicearea/create":                          {Summary: "Add a service area, drawn as a polygon or copied from a district", Tag: "Service areas", Request: Services.ServiceArea{}, Status: http.StatusCreated, Response: Services.ServiceArea{}},
+	"GET /api/v1/servicearea/user/{user_id}":                   {Summary: "List the service areas of a user", Tag: "Service areas", Response: []Services.ServiceArea{}},
+	"DELETE /api/v1/servicearea/delete/{id}":                   {Summary: "Delete one of your service areas", Tag: "Service areas", Status: http.StatusNoContent},
+	"GET /api/v1/servicearea/districts":                        {Summary: "List the named districts a service area can be copied from", Tag: "Service areas", Response: []Services.District{}},
+	"GET /api/v1/servicearea/tradesmen/{longitude}/{latitude}": {Summary: "List the users whose service area contains a point", Tag: "Service areas", Response: []Services.Profile{}},
+
+	"GET /api/v1/region/regions/{level}":               {Summary: "List the regions of a level with their listing and user counts", Tag: "Regions", Response: []Services.Region{}},
+	"GET /api/v1/region/regionId/{id}":                 {Summary: "Get a region with its boundary", Tag: "Regions", Response: Services.Region{}},
+	"GET /api/v1/region/children/{id}":                 {Summary: "List the regions directly inside a region", Tag: "Regions", Response: []Services.Region{}},
+	"GET /api/v1/region/listings/{id}/{type}":          {Summary: "List the published listings in a region or any region inside it", Tag: "Regions", Response: []Services.Listing{}},
+	"GET /api/v1/region/locate/{longitude}/{latitude}": {Summary: "List the regions containing a point, from the country down", Tag: "Regions", Response: []Services.Region{}},
+
+	"GET /api/v1/admin/listings/deleted":                       {Summary: "List deleted listings awaiting purge (admins only)", Tag: "Admin", Response: []Services.Listing{}},
+	"GET /api/v1/admin/transactions/deleted":                   {Summary: "List deleted transactions awaiting purge (admins only)", Tag: "Admin", Response: []Services.Transaction{}},
+	"GET /api/v1/admin/subscriptions":                          {Summary: "List the subscriptions to paid plans (admins only)", Tag: "Admin", Response: []Services.Subscription{}},
+	"GET /api/v1/admin/rates":                                  {Summary: "List the exchange rates set by admins (admins only)", Tag: "Admin", Response: []Services.ExchangeRate{}},
+	"PUT /api/v1/admin/rates":                                  {Summary: "Set the exchange rate between two currencies, overriding the provider's (admins only)", Tag: "Admin", Request: Services.ExchangeRate{}, Response: Services.ExchangeRate{}},
+	"DELETE /api/v1/admin/rates/{currency_from}/{currency_to}": {Summary: "Remove an exchange rate set by admins (admins only)", Tag: "Admin", Status: http.StatusNoContent},
+	"GET /api/v1/admin/ledger/balances":                        {Summary: "Sum the payment ledger by account and currency (admins only)", Tag: "Admin", Response: []Services.LedgerBalance{}},
+}
+
+// pathParameters describes path parameters by name, so each is declared once
+// for every route that uses it. Unlisted names are plain strings.
+var pathParameters = map[string]OpenAPI.Parameter{
+	"id":              {Description: "Numeric ID", Schema: &OpenAPI.Schema{Type: "integer"}},
+	"user_id":         {Description: "User ID", Schema: &OpenAPI.Schema{Type: "integer"}},
+	"listing_id":      {Description: "Listing ID", Schema: &OpenAPI.Schema{Type: "integer"}},
+	"image_id":        {Description: "Image ID, or the image UUID on /image/image", Schema: &OpenAPI.Schema{Type: "string"}},
+	"type":            {Description: "Listing type, Request or Offer; any other value returns both", Schema: &OpenAPI.Schema{Type: "string"}},
+	"status":          {Description: "Transaction status, Pending, Accepted, Completed or Cancelled (any other value returns all), or on /listing/status the new listing status, published, paused or closed", Schema: &OpenAPI.Schema{Type: "string"}},
+	"kind":            {Description: "What is saved, listing or user", Schema: &OpenAPI.Schema{Type: "string"}},
+	"target_id":       {Description: "ID of the saved listing or user", Schema: &OpenAPI.Schema{Type: "integer"}},
+	"longitude":       {Schema: &OpenAPI.Schema{Type: "number"}},
+	"latitude":        {Schema: &OpenAPI.Schema{Type: "number"}},
+	"max_distance":    {Description: "Maximum distance in metres", Schema: &OpenAPI.Schema{Type: "number"}},
+	"min_longitude":   {Description: "West edge of the viewport", Schema: &OpenAPI.Schema{Type: "number"}},
+	"min_latitude":    {Description: "South edge of the viewport", Schema: &OpenAPI.Schema{Type: "number"}},
+	"max_longitude":   {Description: "East edge of the viewport", Schema: &OpenAPI.Schema{Type: "number"}},
+	"max_latitude":    {Description: "North edge of the viewport", Schema: &OpenAPI.Schema{Type: "number"}},
+	"zoom":            {Description: "Map zoom level, 0 (whole world) to 22", Schema: &OpenAPI.Schema{Type: "integer"}},
+	"level":           {Description: "Region level, country, governorate, district or city", Schema: &OpenAPI.Schema{Type: "string"}},
+	"from":            {Description: "First day, formatted YYYY-MM-DD", Schema: &OpenAPI.Schema{Type: "string", Format: "date"}},
+	"to":              {Description: "Last day, formatted YYYY-MM-DD", Schema: &OpenAPI.Schema{Type: "string", Format: "date"}},
+	"currency_from":   {Description: "ISO 4217 code of the currency converted from", Schema: &OpenAPI.Schema{Type: "string"}},
+	"currency_to":     {Description: "ISO 4217 code of the currency converted to", Schema: &OpenAPI.Schema{Type: "string"}},
+	"show_on_profile": {Schema: &OpenAPI.Schema{Type: "boolean"}},
+}
+
+var pathParameterPattern = regexp.MustCompile(`\{([^}:]+)[^}]*\}`)
+
+// openAPIDocument describes every route mounted on routes. Routes missing from
+// operations are still listed, and returned so tests can insist they get documented.
+func openAPIDocument(routes chi.Routes) (*OpenAPI.Document, []string) {
+	doc := OpenAPI.New("MinBya3mili API", "1.0.0", "Local tradesman marketplace. Errors are returned as application/problem+json.")
+	doc.Components.SecuritySchemes["bearerAuth"] = OpenAPI.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	doc.Components.SecuritySchemes["apiKey"] = OpenAPI.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}
+	problem := doc.SchemaOf(Utils.Problem{})
+
+	var undocumented []string
+	_ = chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		key := method + " " + route
+		documented, ok := operations[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+		}
+
+		op := &OpenAPI.Operation{
+			OperationID: operationID(handler),
+			Summary:     documented.Summary,
+			Responses:   map[string]OpenAPI.Response{"default": problemResponse("Error", problem)},
+		}
+		if documented.Tag != "" {
+			op.Tags = []string{documented.Tag}
+		}
+
+		for _, match := range pathParameterPattern.FindAllStringSubmatch(route, -1) {
+			parameter := pathParameters[match[1]]
+			parameter.Name, parameter.In, parameter.Required = match[1], "path", true
+			if parameter.Schema == nil {
+				parameter.Schema = &OpenAPI.Schema{Type: "string"}
+			}
+			op.Parameters = append(op.Parameters, parameter)
+		}
+
+		switch {
+		case documented.Request != nil:
+			op.RequestBody = &OpenAPI.RequestBody{Required: true, Content: map[string]OpenAPI.MediaType{
+				"application/json": {Schema: doc.SchemaOf(documented.Request)},
+			}}
+			op.Responses["400"] = problemResponse("Invalid request, see errors", problem)
+		case documented.Upload:
+			op.RequestBody = &OpenAPI.RequestBody{Required: true, Content: map[string]OpenAPI.MediaType{
+				"multipart/form-data": {Schema: &OpenAPI.Schema{Type: "object", Properties: map[string]*OpenAPI.Schema{
+					"images": {Type: "array", Items: &OpenAPI.Schema{Type: "string", Format: "binary"}},
+				}}},
+			}}
+		}
+
+		switch authentication(middlewares) {
+		case authRequired:
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+			op.Responses["401"] = problemResponse("Missing or invalid token", problem)
+		case authOptional:
+			// An empty requirement lets clients call the route anonymously
+			op.Security = []map[string][]string{{"bearerAuth": {}}, {}}
+			op.Responses["401"] = problemResponse("Invalid token", problem)
+		}
+		if documented.Scope != "" {
+			op.Security = []map[string][]string{{"apiKey": {}}}
+			op.Description = "Needs an API key with the " + documented.Scope + " scope."
+			op.Responses["401"] = problemResponse("Missing, invalid or revoked API key", problem)
+			op.Responses["403"] = problemResponse("API key lacks the scope", problem)
+			op.Responses["429"] = problemResponse("Rate limit or daily quota exceeded", problem)
+		}
+
+		status := documented.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := OpenAPI.Response{Description: http.StatusText(status)}
+		switch {
+		case documented.Response != nil:
+			success.Content = map[string]OpenAPI.MediaType{"application/json": {Schema: doc.SchemaOf(documented.Response)}}
+		case documented.ContentType != "":
+			success.Content = map[string]OpenAPI.MediaType{documented.ContentType: {}}
+		}
+		if documented.GeoJSON {
+			success.Content[geoJSONType] = OpenAPI.MediaType{}
+		}
+		for _, alternative := range documented.Alternatives {
+			success.Content[alternative] = OpenAPI.MediaType{}
+		}
+		if documented.GeoJSON || documented.ContentType == geoJSONSeqType {
+			op.Parameters = append(op.Parameters, OpenAPI.Parameter{
+				Name: "properties", In: "query",
+				Description: "Comma-separated listing fields to carry as GeoJSON properties",
+				Schema:      &OpenAPI.Schema{Type: "string"},
+			})
+		}
+		op.Responses[strconv.Itoa(status)] = success
+
+		doc.AddOperation(pathParameterPattern.ReplaceAllString(route, "{$1}"), method, op)
+		return nil
+	})
+
+	sort.Strings(undocumented)
+	return doc, undocumented
+}
+
+func problemResponse(description string, problem *OpenAPI.Schema) OpenAPI.Response {
+	return OpenAPI.Response{Description: description, Content: map[string]OpenAPI.MediaType{
+		"application/problem+json": {Schema: problem},
+	}}
+}
+
+const (
+	authNone = iota
+	authOptional
+	authRequired
+)
+
+// authentication reports whether the route is wrapped in one of the JWT middlewares
+func authentication(middlewares []func(http.Handler) http.Handler) int {
+	required := reflect.ValueOf(Middleware.AuthMiddleware).Pointer()
+	optional := reflect.ValueOf(Middleware.OptionalAuth).Pointer()
+	for _, middleware := range middlewares {
+		switch reflect.ValueOf(middleware).Pointer() {
+		case required:
+			return authRequired
+		case optional:
+			return authOptional
+		}
+	}
+	return authNone
+}
+
+// operationID names an operation after its handler method, e.g. GetAllUsers
+func operationID(handler http.Handler) string {
+	handlerFunc, ok := handler.(http.HandlerFunc)
+	if !ok {
+		return ""
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(handlerFunc).Pointer()).Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// serveOpenAPI writes the document generated for the router
+func serveOpenAPI(doc *OpenAPI.Document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	}
+}
+
+// serveDocs renders the embedded documentation page for /api/v1/openapi.json
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", docsPolicy)
+	w.Write(docsPage)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/OpenAPI"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	app := &application{Service: Services.ServiceMemory(nil, nil, nil)}
+	routes := app.mount().(chi.Routes)
+
+	_, undocumented := openAPIDocument(routes)
+	if len(undocumented) > 0 {
+		t.Fatalf("routes missing from operations in openapi.go:\n  %s", strings.Join(undocumented, "\n  "))
+	}
+
+	// Entries for routes that were removed or renamed would document nothing
+	mounted := map[string]bool{}
+	_ = chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		mounted[method+" "+route] = true
+		return nil
+	})
+	for key := range operations {
+		if !mounted[key] {
+			t.Errorf("operations documents %q, which is not mounted", key)
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(http.MethodGet, "/api/v1/openapi.json", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var doc OpenAPI.Document
+	decode(t, rec, &doc)
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("unexpected document version %q", doc.OpenAPI)
+	}
+
+	create := (*doc.Paths["/api/v1/transaction/create"])["post"]
+	if create == nil || create.OperationID != "createTransaction" || len(create.Security) != 1 {
+		t.Fatalf("expected an authenticated createTransaction operation, got %+v", create)
+	}
+	byListing := (*doc.Paths["/api/v1/image/listing/{listing_id}"])["get"]
+	if byListing == nil || len(byListing.Parameters) != 1 || byListing.Parameters[0].Schema.Type != "integer" || byListing.Security != nil {
+		t.Fatalf("expected a public operation with an integer listing_id, got %+v", byListing)
+	}
+	profile := (*doc.Paths["/api/v1/user/userId/{id}"])["get"]
+	if profile == nil || len(profile.Security) != 2 || len(profile.Security[1]) != 0 {
+		t.Fatalf("expected optional authentication on profiles, got %+v", profile)
+	}
+
+	all := (*doc.Paths["/api/v1/listing/listings/{type}"])["get"]
+	if _, ok := all.Responses["200"].Content["application/geo+json"]; !ok || all.Parameters[len(all.Parameters)-1].Name != "properties" {
+		t.Fatalf("expected listings to document GeoJSON, got %+v", all)
+	}
+
+	// Validation rules carry over into the schemas
+	transaction := doc.Components.Schemas["Transaction"]
+	if transaction == nil || transaction.Properties["status"] == nil || len(transaction.Properties["status"].Enum) != 4 ||
+		transaction.Properties["job_end_date"].Format != "date" {
+		t.Fatalf("unexpected transaction schema %+v", transaction)
+	}
+
+	rec = s.do(http.MethodGet, "/api/v1/docs", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Fatalf("docs page does not load the document: %s", rec.Body.String())
+	}
+	// The page only loads the pinned Swagger UI release, which the policy allows
+	policy := rec.Header().Get("Content-Security-Policy")
+	if !strings.Contains(rec.Body.String(), swaggerUI+"swagger-ui-bundle.js") || !strings.Contains(policy, swaggerUI) ||
+		!strings.Contains(policy, "'sha256-") {
+		t.Fatalf("docs page is not pinned to %s, policy %q", swaggerUI, policy)
+	}
+}
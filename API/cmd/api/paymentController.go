@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+)
+
+// paymentMovement works out how a transaction's money moves with the status it is being updated to:
+// accepting holds the price in escrow, completing releases it to the tradesman less the platform
+// fee, and cancelling refunds it. Transactions without a price move no money, and neither does an
+// update keeping the status. Once money has moved, changes that would contradict it are refused.
+func (app *application) paymentMovement(ctx context.Context, stored, updated Services.Transaction) (string, error) {
+	payment, err := app.Service.Payments.GetByTransaction(ctx, updated.TransactionID)
+	if errors.Is(err, Services.ErrNotFound) {
+		if updated.Status == "Accepted" && updated.Price > 0 {
+			return Services.MovementHold, nil
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch payment.Status {
+	case Services.PaymentHeld:
+		switch updated.Status {
+		case "Completed":
+			return Services.MovementRelease, nil
+		case "Cancelled":
+			return Services.MovementRefund, nil
+		case "Accepted":
+			if updated.Price != payment.Amount || updated.CurrencyCode != payment.Currency || updated.UserOfferingID != payment.PayeeID {
+				return "", fmt.Errorf("cannot change the price or the tradesman while the deposit is held: %w", Services.ErrConflict)
+			}
+			return "", nil
+		}
+		return "", fmt.Errorf("cancel the transaction to refund its deposit instead: %w", Services.ErrConflict)
+	case Services.PaymentReleased:
+		if updated.Status != "Completed" {
+			return "", fmt.Errorf("the deposit was already released: %w", Services.ErrConflict)
+		}
+	case Services.PaymentRefunded:
+		if updated.Status != "Cancelled" {
+			return "", fmt.Errorf("the deposit was already refunded: %w", Services.ErrConflict)
+		}
+	}
+	return "", nil
+}
+
+// getTransactionPayment handles the request to get the payment of a transaction with its ledger entries.
+// Only the parties to the transaction see it; others are told it does not exist.
+func (app *application) getTransactionPayment(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err == nil && transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
+		err = fmt.Errorf("transaction %w", Services.ErrNotFound)
+	}
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	payment, err := app.Service.Payments.GetByTransaction(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(payment)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getLedgerBalances handles the admin request to sum the ledger by account, e.g. the fees earned and the deposits in escrow.
+func (app *application) getLedgerBalances(w http.ResponseWriter, r *http.Request) {
+	balances, err := app.Service.Payments.Balances(r.Context())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(balances)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// setStatus updates the fixture's transaction to a status as the tradesman when accepting
+// and as the client otherwise
+func (f transactionFixture) setStatus(status string) *httptest.ResponseRecorder {
+	updated := f.transaction
+	updated.Status = status
+	token := f.clientToken
+	if status == "Accepted" {
+		token = f.tradesToken
+	}
+	return f.s.doJSON(http.MethodPut, "/api/v1/transaction/update/"+strconv.Itoa(f.transaction.TransactionID), updated, token)
+}
+
+// payment returns the fixture's payment as the client sees it
+func (f transactionFixture) payment(t *testing.T) Services.Payment {
+	t.Helper()
+	rec := f.s.do(http.MethodGet, "/api/v1/transaction/payment/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	var payment Services.Payment
+	decode(t, rec, &payment)
+	return payment
+}
+
+// balanced checks that every movement of a payment sums to zero
+func balanced(t *testing.T, payment Services.Payment) {
+	t.Helper()
+	sums := map[string]float64{}
+	for _, entry := range payment.Entries {
+		sums[entry.Movement] += entry.Amount
+	}
+	for movement, sum := range sums {
+		if sum > 0.001 || sum < -0.001 {
+			t.Fatalf("%s entries sum to %.2f: %+v", movement, sum, payment.Entries)
+		}
+	}
+}
+
+func TestEscrowReleasedOnCompletion(t *testing.T) {
+	f := seedTransaction(t)
+	_, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	paymentPath := "/api/v1/transaction/payment/" + strconv.Itoa(f.transaction.TransactionID)
+
+	expectStatus(t, f.s.do(http.MethodGet, paymentPath, nil, "", f.clientToken), http.StatusNotFound)
+
+	// Accepting holds the whole price, taken from the client
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	payment := f.payment(t)
+	if payment.Status != Services.PaymentHeld || payment.Amount != 150.5 || payment.Fee != 7.53 || payment.PayeeID != f.tradesman.UserID || payment.Provider != "fake" {
+		t.Fatalf("unexpected held payment %+v", payment)
+	}
+	if len(payment.Entries) != 2 || f.s.payments.Balance(f.client.UserID) != -150.5 || f.s.payments.Held() != 150.5 {
+		t.Fatalf("expected 150.50 in escrow, got %+v", payment.Entries)
+	}
+	balanced(t, payment)
+
+	// Accepting again does not charge twice, and the held price cannot change
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	repriced := f.transaction
+	repriced.Status, repriced.Price, repriced.UserOfferingID = "Accepted", 10, f.client.UserID
+	expectStatus(t, f.s.doJSON(http.MethodPut, "/api/v1/transaction/update/"+strconv.Itoa(f.transaction.TransactionID), repriced, f.tradesToken), http.StatusNoContent)
+	if stored, _ := f.s.app.Service.Transactions.GetByID(context.Background(), f.transaction.TransactionID); stored.Price != 150.5 || stored.UserOfferingID != f.tradesman.UserID {
+		t.Fatalf("expected the agreed terms to stay, got %+v", stored)
+	}
+	if payment := f.payment(t); payment.Amount != 150.5 || len(payment.Entries) != 2 {
+		t.Fatalf("expected a single 150.50 hold, got %+v", payment)
+	}
+	expectStatus(t, f.setStatus("Pending"), http.StatusConflict)
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/transaction/delete/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken), http.StatusConflict)
+
+	// Only the parties see the payment
+	expectStatus(t, f.s.do(http.MethodGet, paymentPath, nil, "", outsiderToken), http.StatusNotFound)
+	expectStatus(t, f.s.do(http.MethodGet, paymentPath, nil, "", f.tradesToken), http.StatusOK)
+
+	// Completing pays the tradesman less the platform fee
+	expectStatus(t, f.setStatus("Completed"), http.StatusNoContent)
+	payment = f.payment(t)
+	if payment.Status != Services.PaymentReleased || payment.DateSettled == "" || len(payment.Entries) != 5 {
+		t.Fatalf("unexpected released payment %+v", payment)
+	}
+	balanced(t, payment)
+	if f.s.payments.Balance(f.tradesman.UserID) != 142.97 || f.s.payments.Fees() != 7.53 || f.s.payments.Held() != 0 {
+		t.Fatalf("expected 142.97 paid out and 7.53 kept, got %.2f and %.2f", f.s.payments.Balance(f.tradesman.UserID), f.s.payments.Fees())
+	}
+
+	// Rating keeps the status, so no money moves; going back is refused
+	rated := f.transaction
+	rated.Status, rated.Rating = "Completed", 5
+	expectStatus(t, f.s.doJSON(http.MethodPut, "/api/v1/transaction/update/"+strconv.Itoa(f.transaction.TransactionID), rated, f.clientToken), http.StatusNoContent)
+	expectStatus(t, f.setStatus("Cancelled"), http.StatusConflict)
+}
+
+func TestEscrowRefundedOnCancel(t *testing.T) {
+	f := seedTransaction(t)
+
+	// A declined charge leaves the transaction Pending
+	f.s.payments.Decline = true
+	expectStatus(t, f.setStatus("Accepted"), http.StatusPaymentRequired)
+	stored, _ := f.s.app.Service.Transactions.GetByID(context.Background(), f.transaction.TransactionID)
+	if stored.Status != "Pending" {
+		t.Fatalf("expected the transaction to stay Pending, got %+v", stored)
+	}
+	f.s.payments.Decline = false
+
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	expectStatus(t, f.setStatus("Cancelled"), http.StatusNoContent)
+	payment := f.payment(t)
+	if payment.Status != Services.PaymentRefunded || len(payment.Entries) != 4 {
+		t.Fatalf("unexpected refunded payment %+v", payment)
+	}
+	balanced(t, payment)
+	if f.s.payments.Balance(f.client.UserID) != 0 || f.s.payments.Fees() != 0 {
+		t.Fatalf("expected the client to get everything back, got %.2f", f.s.payments.Balance(f.client.UserID))
+	}
+
+	cancelled := decodeTransactions(t, f.s.do(http.MethodGet, "/api/v1/transaction/offered/"+strconv.Itoa(f.client.UserID)+"/Cancelled", nil, "", f.clientToken))
+	if len(cancelled) != 1 {
+		t.Fatalf("expected the cancelled transaction, got %+v", cancelled)
+	}
+	expectStatus(t, f.setStatus("Completed"), http.StatusConflict)
+
+	// With the deposit refunded the transaction can be deleted
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/transaction/delete/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken), http.StatusNoContent)
+}
+
+func TestConcurrentUpdatesSettleOnce(t *testing.T) {
+	f := seedTransaction(t)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+
+	// Of completions and cancellations sent at once, only the first moves the deposit. Repeating
+	// its status changes nothing and the other status is refused.
+	codes := make([]int, 6)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := []string{"Completed", "Cancelled"}[i%2]
+			codes[i] = f.s.doJSON(http.MethodPut, "/api/v1/transaction/update/"+strconv.Itoa(f.transaction.TransactionID),
+				transactionUpdate{Status: status}, f.clientToken).Code
+		}()
+	}
+	wg.Wait()
+	for _, code := range codes {
+		if code != http.StatusNoContent && code != http.StatusConflict {
+			t.Fatalf("unexpected responses %v", codes)
+		}
+	}
+
+	payment := f.payment(t)
+	stored, _ := f.s.app.Service.Transactions.GetByID(context.Background(), f.transaction.TransactionID)
+	switch {
+	case stored.Status == "Completed" && payment.Status == Services.PaymentReleased && len(payment.Entries) == 5:
+		if f.s.payments.Balance(f.tradesman.UserID) != 142.97 || f.s.payments.Balance(f.client.UserID) != -150.5 {
+			t.Fatalf("expected a single payout, got %.2f", f.s.payments.Balance(f.tradesman.UserID))
+		}
+	case stored.Status == "Cancelled" && payment.Status == Services.PaymentRefunded && len(payment.Entries) == 4:
+		if f.s.payments.Balance(f.tradesman.UserID) != 0 || f.s.payments.Balance(f.client.UserID) != 0 {
+			t.Fatalf("expected a single refund, got %.2f", f.s.payments.Balance(f.client.UserID))
+		}
+	default:
+		t.Fatalf("expected one settlement matching the status, got %s and %+v", stored.Status, payment)
+	}
+	balanced(t, payment)
+}
+
+func TestLedgerBalances(t *testing.T) {
+	f := seedTransaction(t)
+	admin, adminToken := f.s.createUser("Admin", "+96170000009")
+
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/admin/ledger/balances", nil, "", adminToken), http.StatusForbidden)
+	if err := f.s.app.Service.Users.SetRole(context.Background(), admin.UserID, Services.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken = f.s.signIn("+96170000009")
+
+	balances := func() map[string]float64 {
+		rec := f.s.do(http.MethodGet, "/api/v1/admin/ledger/balances", nil, "", adminToken)
+		expectStatus(t, rec, http.StatusOK)
+		var list []Services.LedgerBalance
+		decode(t, rec, &list)
+		byAccount := map[string]float64{}
+		for _, balance := range list {
+			byAccount[balance.Account+" "+balance.Currency] = balance.Balance
+		}
+		return byAccount
+	}
+	if got := balances(); got["escrow USD"] != 150.5 || got[Services.UserAccount(f.client.UserID)+" USD"] != -150.5 {
+		t.Fatalf("expected the deposit in escrow, got %v", got)
+	}
+
+	expectStatus(t, f.setStatus("Completed"), http.StatusNoContent)
+	got := balances()
+	if got["escrow USD"] != 0 || got["platform_fees USD"] != 7.53 || got[Services.UserAccount(f.tradesman.UserID)+" USD"] != 142.97 {
+		t.Fatalf("expected escrow emptied into the tradesman and fees, got %v", got)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parsePromotionSlots reads the positions of promoted listings in search results from a
+// comma-separated list such as "1,6"
+func parsePromotionSlots(value string) ([]int, error) {
+	slots := []int{}
+	for _, field := range strings.Split(value, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		position, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || position < 1 {
+			return nil, fmt.Errorf("promotion slots must be positions from 1, got %q", field)
+		}
+		slots = append(slots, position)
+	}
+	return slots, nil
+}
+
+// createPromotion handles the request to promote one of the caller's listings. The whole
+// budget is charged up front and what is not spent is refunded when the promotion ends.
+func (app *application) createPromotion(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var promotion Services.Promotion
+	err = decodeJSON(r, &promotion)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	listing, err := app.Service.Listings.GetByID(r.Context(), promotion.ListingID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if listing.UserID != tokenUserID {
+		app.respondError(w, r, fmt.Errorf("only the owner can promote a listing: %w", Services.ErrForbidden))
+		return
+	}
+
+	created, err := app.Service.Promotions.Create(r.Context(), promotion)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getPromotions handles the request to list the caller's promotions, newest first.
+func (app *application) getPromotions(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	promotions, err := app.Service.Promotions.GetByUser(r.Context(), tokenUserID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(promotions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// ownPromotion returns the promotion in the URL if the caller bought it
+func (app *application) ownPromotion(r *http.Request) (Services.Promotion, error) {
+	promotionID, err := intParam(r, "id")
+	if err != nil {
+		return Services.Promotion{}, err
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return Services.Promotion{}, err
+	}
+
+	promotion, err := app.Service.Promotions.GetByID(r.Context(), promotionID)
+	if err != nil {
+		return Services.Promotion{}, err
+	}
+	if promotion.UserID != tokenUserID {
+		return Services.Promotion{}, fmt.Errorf("promotion %w", Services.ErrNotFound)
+	}
+	return promotion, nil
+}
+
+// getPromotion handles the request to get one of the caller's promotions with its totals.
+func (app *application) getPromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, err := app.ownPromotion(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(promotion)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getPromotionDays handles the request to get the impressions, clicks and spend of one of the caller's promotions by day.
+func (app *application) getPromotionDays(w http.ResponseWriter, r *http.Request) {
+	promotion, err := app.ownPromotion(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	days, err := app.Service.Promotions.GetDays(r.Context(), promotion.PromotionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(days)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// cancelPromotion handles the request to stop one of the caller's promotions and refund what it did not spend.
+func (app *application) cancelPromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, err := app.ownPromotion(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	cancelled, err := app.Service.Promotions.Cancel(r.Context(), promotion.PromotionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(cancelled)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// clickPromotion handles the request to record that a promoted listing from search results was opened.
+// The click token the listing was shown with can only be used once, on the day it was shown.
+func (app *application) clickPromotion(w http.ResponseWriter, r *http.Request) {
+	promotionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	var click Services.PromotionClick
+	err = decodeJSON(r, &click)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.Service.Promotions.Click(r.Context(), promotionID, click.ClickToken, app.config.promotions, time.Now())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// promotionSearch describes a search to the promotions targeting it. The search is in the
+// region of the optional ?region_id= and every region containing it, and for the trade of
+// the optional ?category=.
+func (app *application) promotionSearch(r *http.Request, listingType, query string) (Services.PromotionSearch, error) {
+	search := Services.PromotionSearch{Type: listingType, Query: query, Category: r.URL.Query().Get("category")}
+
+	value := r.URL.Query().Get("region_id")
+	if value == "" {
+		return search, nil
+	}
+	regionID, err := strconv.Atoi(value)
+	if err != nil {
+		return search, Services.Invalid("region_id", "must be an integer")
+	}
+	for regionID != 0 {
+		region, err := app.Service.Regions.GetByID(r.Context(), regionID)
+		if errors.Is(err, Services.ErrNotFound) {
+			return search, Services.Invalid("region_id", "must be a region of the gazetteer")
+		}
+		if err != nil {
+			return search, err
+		}
+		search.RegionIDs = append(search.RegionIDs, region.RegionID)
+		regionID = region.ParentID
+	}
+	return search, nil
+}
+
+// promote blends the promoted listings targeting search into its results, at the slots
+// the rules set aside for them, and spends an impression on each one shown
+func (app *application) promote(ctx context.Context, listings []Services.Listing, search Services.PromotionSearch) ([]Services.Listing, error) {
+	rules := app.config.promotions
+	slots := Services.PromotedSlots(rules.Slots, len(listings))
+	if slots == 0 {
+		return listings, nil
+	}
+
+	promoted, err := app.Service.Promotions.Serve(ctx, search, rules, slots, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return Services.BlendPromoted(listings, promoted, rules.Slots), nil
+}
+
+// promotionJob settles the promotions past their last day, paying their spend to the
+// platform and refunding the rest, and tells their owners.
+func (app *application) promotionJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "promotions",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			ended, err := app.Service.Promotions.Settle(ctx, time.Now())
+			if err != nil {
+				return err
+			}
+
+			for _, promotion := range ended {
+				err = app.Service.Notifications.Create(ctx, &Services.Notification{
+					UserID:    promotion.UserID,
+					Kind:      Services.NotifyPromotionEnded,
+					ListingID: promotion.ListingID,
+					Message: fmt.Sprintf("Your promotion ended on %s after %d impressions and %d clicks. It spent %.2f %s and %.2f %s was refunded.",
+						promotion.EndDate, promotion.Impressions, promotion.Clicks, promotion.Spent, promotion.Currency,
+						promotion.Budget-promotion.Spent, promotion.Currency),
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(ended) > 0 {
+				log.Printf("settled %d ended promotions", len(ended))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// promote buys a promotion of listingID from today for days days and returns it
+func (s *testServer) promote(t *testing.T, listingID int, days int, dailyBudget float64, token string, targeting map[string]interface{}) Services.Promotion {
+	t.Helper()
+	body := map[string]interface{}{
+		"listing_id":   listingID,
+		"start_date":   time.Now().Format("2006-01-02"),
+		"end_date":     time.Now().AddDate(0, 0, days-1).Format("2006-01-02"),
+		"daily_budget": dailyBudget,
+	}
+	for key, value := range targeting {
+		body[key] = value
+	}
+	rec := s.doJSON(http.MethodPost, "/api/v1/promotion/create", body, token)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var promotion Services.Promotion
+	decode(t, rec, &promotion)
+	return promotion
+}
+
+// promotedIDs returns the promotion of each listing in search results, 0 for organic ones
+func promotedIDs(listings []Services.Listing) []int {
+	ids := make([]int, 0, len(listings))
+	for _, listing := range listings {
+		id := 0
+		if listing.Promotion != nil {
+			id = listing.Promotion.PromotionID
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestPromotionPurchase(t *testing.T) {
+	s := newTestServer(t)
+	owner, token := s.createUser("Adam", "+96170000001")
+	_, otherToken := s.createUser("Rami", "+96170000002")
+	listing := s.createListing(owner.UserID, "Offer", "Tiling", 35.5, 33.9)
+
+	// The daily budget is held for every day of the promotion
+	promotion := s.promote(t, listing.ListingID, 7, 5, token, nil)
+	if promotion.Status != Services.PromotionActive || promotion.Budget != 35 || promotion.UserID != owner.UserID || promotion.Reference == "" {
+		t.Fatalf("unexpected promotion %+v", promotion)
+	}
+	if s.payments.Held() != 35 || s.payments.Balance(owner.UserID) != -35 {
+		t.Fatalf("expected 35 held, got %.2f", s.payments.Held())
+	}
+
+	// Only the owner promotes a listing, from today on, for at most 90 days
+	today := time.Now().Format("2006-01-02")
+	body := map[string]interface{}{"listing_id": listing.ListingID, "start_date": today, "end_date": today, "daily_budget": 5}
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/promotion/create", body, otherToken), http.StatusForbidden)
+	body["start_date"] = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/promotion/create", body, token), http.StatusBadRequest)
+	body["start_date"], body["end_date"] = today, time.Now().AddDate(0, 0, 90).Format("2006-01-02")
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/promotion/create", body, token), http.StatusBadRequest)
+
+	rec := s.do(http.MethodGet, "/api/v1/promotion/promotions", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var promotions []Services.Promotion
+	decode(t, rec, &promotions)
+	if len(promotions) != 1 || promotions[0].PromotionID != promotion.PromotionID {
+		t.Fatalf("expected the promotion, got %+v", promotions)
+	}
+	path := "/api/v1/promotion/promotionId/" + strconv.Itoa(promotion.PromotionID)
+	expectStatus(t, s.do(http.MethodGet, path, nil, "", token), http.StatusOK)
+	expectStatus(t, s.do(http.MethodGet, path, nil, "", otherToken), http.StatusNotFound)
+
+	// Cancelling before anything was spent refunds the whole budget
+	cancel := "/api/v1/promotion/cancel/" + strconv.Itoa(promotion.PromotionID)
+	expectStatus(t, s.do(http.MethodPost, cancel, nil, "", otherToken), http.StatusNotFound)
+	rec = s.do(http.MethodPost, cancel, nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var cancelled Services.Promotion
+	decode(t, rec, &cancelled)
+	if cancelled.Status != Services.PromotionCancelled || cancelled.DateSettled == "" {
+		t.Fatalf("expected the promotion cancelled, got %+v", cancelled)
+	}
+	if s.payments.Held() != 0 || s.payments.Balance(owner.UserID) != 0 || s.payments.Fees() != 0 {
+		t.Fatalf("expected the budget refunded, got %.2f held and a balance of %.2f", s.payments.Held(), s.payments.Balance(owner.UserID))
+	}
+	expectStatus(t, s.do(http.MethodPost, cancel, nil, "", token), http.StatusConflict)
+}
+
+func TestPromotedSearchSlots(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.createUser("Adam", "+96170000001")
+	for i := 1; i <= 6; i++ {
+		s.createListing(user.UserID, "Offer", "Plumbing "+strconv.Itoa(i), 35.5, 33.9)
+	}
+	advertiser, token := s.createUser("Rami", "+96170000002")
+	first := s.createListing(advertiser.UserID, "Offer", "Plumbing promoted", 35.5, 33.9)
+	second := s.createListing(advertiser.UserID, "Offer", "Plumbing promoted again", 35.5, 33.9)
+	firstPromotion := s.promote(t, first.ListingID, 1, 24, token, nil)
+	secondPromotion := s.promote(t, second.ListingID, 1, 24, token, nil)
+
+	// Promoted listings take the first and sixth places, labelled, and are not repeated below
+	listings := decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/search/lumbing/Offer", nil, "", ""))
+	ids := promotedIDs(listings)
+	if len(listings) != 8 || ids[0] != firstPromotion.PromotionID || ids[5] != secondPromotion.PromotionID || listings[0].Promotion.Label != Services.PromotedLabel {
+		t.Fatalf("expected promotions in slots 1 and 6, got %v", ids)
+	}
+	shown := Services.PromotionClick{ClickToken: listings[0].Promotion.ClickToken}
+	for i, listing := range listings {
+		if (listing.ListingID == first.ListingID || listing.ListingID == second.ListingID) && ids[i] == 0 {
+			t.Fatalf("promoted listing %d also shown as a result", listing.ListingID)
+		}
+	}
+
+	// Results of other searches are left alone, and short results are not padded
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/search/Tiling/Offer", nil, "", ""))); len(titles) != 0 {
+		t.Fatalf("expected no results, got %v", titles)
+	}
+	listings = decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/date/search/promoted%20again/Offer", nil, "", ""))
+	if ids := promotedIDs(listings); len(listings) != 1 || ids[0] != secondPromotion.PromotionID {
+		t.Fatalf("expected the promoted listing alone, got %v", ids)
+	}
+
+	// A click needs the token the listing was shown with, once, and is charged at the click price
+	click := "/api/v1/promotion/click/" + strconv.Itoa(firstPromotion.PromotionID)
+	expectStatus(t, s.doJSON(http.MethodPost, click, Services.PromotionClick{}, ""), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPost, click, Services.PromotionClick{ClickToken: shown.ClickToken + "0"}, ""), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPost, click, Services.PromotionClick{ClickToken: listings[0].Promotion.ClickToken}, ""), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/promotion/click/999", shown, ""), http.StatusNotFound)
+	expectStatus(t, s.doJSON(http.MethodPost, click, shown, ""), http.StatusNoContent)
+	expectStatus(t, s.doJSON(http.MethodPost, click, shown, ""), http.StatusConflict)
+
+	rec := s.do(http.MethodGet, "/api/v1/promotion/days/"+strconv.Itoa(firstPromotion.PromotionID), nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var days []Services.PromotionDay
+	decode(t, rec, &days)
+	if len(days) != 1 || days[0].Impressions != 1 || days[0].Clicks != 1 || days[0].Spent != 0.21 {
+		t.Fatalf("expected an impression and a click, got %+v", days)
+	}
+	promotion, err := s.app.Service.Promotions.GetByID(context.Background(), firstPromotion.PromotionID)
+	if err != nil || promotion.Impressions != 1 || promotion.Clicks != 1 || promotion.Spent != 0.21 {
+		t.Fatalf("expected the totals of the day, got %+v (%v)", promotion, err)
+	}
+}
+
+func TestPromotionTargeting(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	if err := s.app.regionJob().Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	regions, err := s.app.Service.Regions.Locate(ctx, 33.8938, 35.5018)
+	if err != nil || len(regions) < 2 {
+		t.Fatalf("expected Beirut in the gazetteer, got %+v (%v)", regions, err)
+	}
+	country, city := regions[0], regions[len(regions)-1]
+
+	user, token := s.createUser("Adam", "+96170000001")
+	s.createListing(user.UserID, "Offer", "Plumbing Beirut", 35.5018, 33.8938)
+	s.createListing(user.UserID, "Offer", "Plumbing Tripoli", 35.8498, 34.4346)
+	promoted := s.createListing(user.UserID, "Offer", "Plumbing promoted", 35.5018, 33.8938)
+	promotion := s.promote(t, promoted.ListingID, 3, 24, token, map[string]interface{}{"region_id": city.RegionID, "category": "plumbing"})
+
+	shown := func(path string) bool {
+		t.Helper()
+		listings := decodeListings(t, s.do(http.MethodGet, path, nil, "", ""))
+		return len(listings) > 0 && listings[0].Promotion != nil && listings[0].Promotion.PromotionID == promotion.PromotionID
+	}
+
+	// Searches around a point are in the regions containing it
+	if !shown("/api/v1/listing/distance/35.5018/33.8938/5000/Offer/lumbing?category=plumbing") {
+		t.Fatal("expected the promotion in a plumbing search in Beirut")
+	}
+	if shown("/api/v1/listing/distance/35.5018/33.8938/5000/Offer/lumbing") {
+		t.Fatal("expected no promotion in a search for any trade")
+	}
+	if shown("/api/v1/listing/distance/35.8498/34.4346/5000/Offer/lumbing?category=plumbing") {
+		t.Fatal("expected no promotion in Tripoli")
+	}
+
+	// Other searches are in the region they filter on, if any
+	if !shown("/api/v1/listing/search/lumbing/Offer?category=plumbing&region_id=" + strconv.Itoa(city.RegionID)) {
+		t.Fatal("expected the promotion in a search in Beirut")
+	}
+	if shown("/api/v1/listing/search/lumbing/Offer?category=plumbing&region_id=" + strconv.Itoa(country.RegionID)) {
+		t.Fatal("expected no promotion in a search of the whole country")
+	}
+	if shown("/api/v1/listing/search/lumbing/Offer?category=plumbing") {
+		t.Fatal("expected no promotion in a search without a region")
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/listing/search/lumbing/Offer?region_id=999999", nil, "", ""), http.StatusBadRequest)
+
+	body := map[string]interface{}{"listing_id": promoted.ListingID, "start_date": time.Now().Format("2006-01-02"),
+		"end_date": time.Now().Format("2006-01-02"), "daily_budget": 5, "region_id": 999999}
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/promotion/create", body, token), http.StatusBadRequest)
+}
+
+func TestPromotionPacingAndSettlement(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	user, token := s.createUser("Adam", "+96170000001")
+	listing := s.createListing(user.UserID, "Offer", "Plumbing", 35.5, 33.9)
+	promotion := s.promote(t, listing.ListingID, 2, 0.48, token, nil)
+
+	rules := Services.PromotionRules{Slots: []int{1}, ImpressionPrice: 0.01, ClickPrice: 0.20, ClickKey: s.app.config.promotions.ClickKey}
+	search := Services.PromotionSearch{Type: "Offer", Query: "lumbing"}
+	year, month, day := time.Now().Date()
+	tokens := []string{}
+	serve := func(hour int) int {
+		t.Helper()
+		promoted, err := s.app.Service.Promotions.Serve(ctx, search, rules, 1, time.Date(year, month, day, hour, 30, 0, 0, time.Local))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, listing := range promoted {
+			tokens = append(tokens, listing.Promotion.ClickToken)
+		}
+		return len(promoted)
+	}
+	click := func(hour int, price float64) Services.Promotion {
+		t.Helper()
+		clicked := rules
+		clicked.ClickPrice = price
+		token := tokens[0]
+		tokens = tokens[1:]
+		if err := s.app.Service.Promotions.Click(ctx, promotion.PromotionID, token, clicked, time.Date(year, month, day, hour, 30, 0, 0, time.Local)); err != nil {
+			t.Fatal(err)
+		}
+		spent, err := s.app.Service.Promotions.GetByID(ctx, promotion.PromotionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return spent
+	}
+
+	// A 0.48 budget paces 0.02 an hour, two impressions by the end of the first hour
+	if serve(0) != 1 || serve(0) != 1 || serve(0) != 0 {
+		t.Fatal("expected two impressions in the first hour")
+	}
+	if serve(1) != 1 || serve(1) != 1 || serve(1) != 0 {
+		t.Fatal("expected two more impressions in the second hour")
+	}
+
+	// Clicks are paced too: the second hour's share is already spent, so a click there is free
+	if spent := click(1, 0.20); spent.Spent != 0.04 || spent.Clicks != 1 {
+		t.Fatalf("expected a click within the paced budget, got %+v", spent)
+	}
+
+	// A click cannot spend more than is left of the budget paced to its hour
+	if spent := click(23, 1); spent.Spent != 0.48 || spent.Clicks != 2 {
+		t.Fatalf("expected the day's budget spent, got %+v", spent)
+	}
+	if serve(23) != 0 {
+		t.Fatal("expected no impressions once the day's budget is spent")
+	}
+
+	// Promotions end after their last day, paying the spend to the platform and refunding the rest
+	ended, err := s.app.Service.Promotions.Settle(ctx, time.Now())
+	if err != nil || len(ended) != 0 {
+		t.Fatalf("expected the promotion to run on, got %+v (%v)", ended, err)
+	}
+	ended, err = s.app.Service.Promotions.Settle(ctx, time.Now().AddDate(0, 0, 2))
+	if err != nil || len(ended) != 1 || ended[0].Status != Services.PromotionEnded {
+		t.Fatalf("expected the promotion to end, got %+v (%v)", ended, err)
+	}
+	if s.payments.Fees() != 0.48 || s.payments.Held() != 0 || s.payments.Balance(user.UserID) != -0.48 {
+		t.Fatalf("expected 0.48 paid and 0.48 refunded, got %.2f fees and a balance of %.2f", s.payments.Fees(), s.payments.Balance(user.UserID))
+	}
+}
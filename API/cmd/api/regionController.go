@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"time"
+)
+
+// getRegionsByLevel handles the request to get every country, governorate, district or city with their counts.
+func (app *application) getRegionsByLevel(w http.ResponseWriter, r *http.Request) {
+	regions, err := app.Service.Regions.GetByLevel(r.Context(), chi.URLParam(r, "level"))
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(regions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getRegion handles the request to get a region with its boundary.
+func (app *application) getRegion(w http.ResponseWriter, r *http.Request) {
+	regionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	region, err := app.Service.Regions.GetByID(r.Context(), regionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(region)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getRegionChildren handles the request to get the regions directly inside a region.
+func (app *application) getRegionChildren(w http.ResponseWriter, r *http.Request) {
+	regionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	_, err = app.Service.Regions.GetByID(r.Context(), regionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	regions, err := app.Service.Regions.GetChildren(r.Context(), regionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(regions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// GetListingsByRegion handles the request to get the published listings in a region or any region inside it.
+func (app *application) GetListingsByRegion(w http.ResponseWriter, r *http.Request) {
+	regionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	listingType := chi.URLParam(r, "type")
+
+	_, err = app.Service.Regions.GetByID(r.Context(), regionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	listings, err := app.Service.Listings.GetByRegion(r.Context(), regionID, listingType)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	app.trackImpressions(listings)
+	app.writeListings(w, r, listings)
+}
+
+// locateRegion handles the request to get the regions containing a point, from the country down.
+func (app *application) locateRegion(w http.ResponseWriter, r *http.Request) {
+	latitude, err := floatParam(r, "latitude")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	longitude, err := floatParam(r, "longitude")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	regions, err := app.Service.Regions.Locate(r.Context(), latitude, longitude)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(regions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// regionJob seeds the built-in gazetteer and places listings and users that have no region yet,
+// such as those created before the gazetteer existed
+func (app *application) regionJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "regions",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			seeded, err := app.Service.Regions.Seed(ctx, Services.Gazetteer())
+			if err != nil {
+				return err
+			}
+			assigned, err := app.Service.Regions.AssignMissing(ctx)
+			if err != nil {
+				return err
+			}
+			if seeded+int(assigned) > 0 {
+				log.Printf("seeded %d regions and placed %d listings and users in regions", seeded, assigned)
+			}
+			return nil
+		},
+	}
+}
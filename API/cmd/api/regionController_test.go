@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// regionByCode finds a region in a list, failing the test when it is missing
+func regionByCode(t *testing.T, regions []Services.Region, code string) Services.Region {
+	t.Helper()
+	for _, region := range regions {
+		if region.Code == code {
+			return region
+		}
+	}
+	t.Fatalf("region %s missing from %+v", code, regions)
+	return Services.Region{}
+}
+
+func TestRegions(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.createUser("Nadim", "+96170000001")
+	// Created before the gazetteer exists, so only the job can place it
+	s.createListing(user.UserID, "Offer", "Beirut plumbing", 35.5018, 33.8938)
+
+	job := s.app.regionJob()
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Seeding again adds nothing
+	if added, err := s.app.Service.Regions.Seed(context.Background(), Services.Gazetteer()); err != nil || added != 0 {
+		t.Fatalf("expected a second seed to add nothing, added %d: %v", added, err)
+	}
+
+	s.createListing(user.UserID, "Request", "Tripoli tiling", 35.8498, 34.4346)
+	s.createListing(user.UserID, "Offer", "Metn painting", 35.70, 33.92)
+	s.createListing(user.UserID, "Offer", "Offshore repairs", 34.50, 33.90)
+
+	var chain []Services.Region
+	rec := s.do(http.MethodGet, "/api/v1/region/locate/35.5018/33.8938", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &chain)
+	if len(chain) != 4 || chain[0].Code != "LB" || chain[1].Code != "LB-BA" || chain[2].Code != "LB-BA-BEIRUT" || chain[3].Code != "LB-BA-BEIRUT-CITY-BEIRUT" {
+		t.Fatalf("unexpected region chain %+v", chain)
+	}
+	city := chain[3]
+	if city.NameAr != "بيروت" || city.Boundary != nil || city.ListingCount != 1 || city.UserCount != 1 {
+		t.Fatalf("expected the job to place the earlier listing and user in Beirut, got %+v", city)
+	}
+
+	// Counts roll up to every region above
+	var countries []Services.Region
+	rec = s.do(http.MethodGet, "/api/v1/region/regions/country", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &countries)
+	if len(countries) != 1 || countries[0].ListingCount != 3 || countries[0].UserCount != 1 {
+		t.Fatalf("unexpected countries %+v", countries)
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/region/regions/planet", nil, "", ""), http.StatusBadRequest)
+
+	var governorates []Services.Region
+	rec = s.do(http.MethodGet, "/api/v1/region/children/"+strconv.Itoa(countries[0].RegionID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &governorates)
+	if len(governorates) != 8 || governorates[0].NameEn != "Akkar" {
+		t.Fatalf("expected the governorates by name, got %+v", governorates)
+	}
+	mountLebanon := regionByCode(t, governorates, "LB-JL")
+	if mountLebanon.ListingCount != 1 {
+		t.Fatalf("expected one listing in Mount Lebanon, got %+v", mountLebanon)
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/region/children/999999", nil, "", ""), http.StatusNotFound)
+
+	var region Services.Region
+	rec = s.do(http.MethodGet, "/api/v1/region/regionId/"+strconv.Itoa(mountLebanon.RegionID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &region)
+	if region.Code != "LB-JL" || len(region.Boundary) != 5 || region.ListingCount != 1 {
+		t.Fatalf("unexpected region %+v", region)
+	}
+
+	// Listings in a region include those in the regions inside it
+	north := regionByCode(t, governorates, "LB-AS")
+	rec = s.do(http.MethodGet, "/api/v1/region/listings/"+strconv.Itoa(north.RegionID)+"/all", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if titles := listingTitles(decodeListings(t, rec)); len(titles) != 1 || titles[0] != "Tripoli tiling" {
+		t.Fatalf("expected the Tripoli listing in the North, got %v", titles)
+	}
+	rec = s.do(http.MethodGet, "/api/v1/region/listings/"+strconv.Itoa(countries[0].RegionID)+"/Offer", nil, "", "")
+	if titles := listingTitles(decodeListings(t, rec)); len(titles) != 2 {
+		t.Fatalf("expected the two offers in Lebanon, got %v", titles)
+	}
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/region/listings/999999/all", nil, "", ""), http.StatusNotFound)
+
+	// Points outside every region have no chain
+	chain = nil
+	decode(t, s.do(http.MethodGet, "/api/v1/region/locate/34.50/33.90", nil, "", ""), &chain)
+	if len(chain) != 0 {
+		t.Fatalf("expected no regions offshore, got %+v", chain)
+	}
+}
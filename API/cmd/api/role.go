@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"strconv"
+)
+
+const roleUsage = `usage: api role <user_id> <user|admin>
+
+Grants or revokes admin rights. The user must sign in again for the change to apply.`
+
+// runRole handles the "role" subcommand of the API binary
+func runRole(ctx context.Context, service Services.Service, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf(roleUsage)
+	}
+	userID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid user ID %q", args[0])
+	}
+	if err := service.Users.SetRole(ctx, userID, args[1]); err != nil {
+		return err
+	}
+	fmt.Printf("user %d is now %s\n", userID, args[1])
+	return nil
+}
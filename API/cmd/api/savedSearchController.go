@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"log"
+	"net/http"
+	"time"
+)
+
+// createSavedSearch handles the request to save a listing search for the caller.
+func (app *application) createSavedSearch(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var search Services.SavedSearch
+	err = decodeJSON(r, &search)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	search.UserID = tokenUserId
+
+	created, err := app.Service.SavedSearches.Create(r.Context(), &search)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getSavedSearches handles the request to list the caller's saved searches.
+func (app *application) getSavedSearches(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	searches, err := app.Service.SavedSearches.GetByUser(r.Context(), tokenUserId)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(searches)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// ownSavedSearch returns the saved search in the id URL parameter if it belongs to the caller.
+// Other users' searches are reported as not found.
+func (app *application) ownSavedSearch(r *http.Request) (Services.SavedSearch, error) {
+	searchID, err := intParam(r, "id")
+	if err != nil {
+		return Services.SavedSearch{}, err
+	}
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		return Services.SavedSearch{}, err
+	}
+
+	search, err := app.Service.SavedSearches.GetByID(r.Context(), searchID)
+	if err != nil {
+		return Services.SavedSearch{}, err
+	}
+	if search.UserID != tokenUserId {
+		return Services.SavedSearch{}, fmt.Errorf("saved search %w", Services.ErrNotFound)
+	}
+	return search, nil
+}
+
+// updateSavedSearch handles the request to change the filters or alert frequency of one of the caller's saved searches.
+func (app *application) updateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	stored, err := app.ownSavedSearch(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var search Services.SavedSearch
+	err = decodeJSON(r, &search)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	search.SearchID = stored.SearchID
+	search.UserID = stored.UserID
+
+	err = app.Service.SavedSearches.Update(r.Context(), &search)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	updated, err := app.Service.SavedSearches.GetByID(r.Context(), stored.SearchID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(updated)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// deleteSavedSearch handles the request to delete one of the caller's saved searches.
+func (app *application) deleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	search, err := app.ownSavedSearch(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	err = app.Service.SavedSearches.Delete(r.Context(), search.SearchID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getSavedSearchMatches handles the request to list the published listings that matched one of the caller's saved searches.
+func (app *application) getSavedSearchMatches(w http.ResponseWriter, r *http.Request) {
+	search, err := app.ownSavedSearch(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	listings, err := app.Service.SavedSearches.GetMatches(r.Context(), search.SearchID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(listings)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// savedSearchJob matches new and updated listings against saved searches. Instant searches
+// notify their owner of each match, daily searches get one digest per digest period.
+func (app *application) savedSearchJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "saved searches",
+		Interval: time.Minute,
+		Run: func(ctx context.Context) error {
+			matches, err := app.Service.SavedSearches.Match(ctx)
+			if err != nil {
+				return err
+			}
+			for _, match := range matches {
+				err = app.Service.Notifications.Create(ctx, &Services.Notification{
+					UserID:    match.Search.UserID,
+					Kind:      Services.NotifySearchMatch,
+					Message:   fmt.Sprintf("New listing %q matches your saved search %q.", match.Listing.Title, match.Search.Name),
+					ListingID: match.Listing.ListingID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			digests, err := app.Service.SavedSearches.Digests(ctx, app.config.searches.digestEvery)
+			if err != nil {
+				return err
+			}
+			for _, digest := range digests {
+				err = app.Service.Notifications.Create(ctx, &Services.Notification{
+					UserID:  digest.Search.UserID,
+					Kind:    Services.NotifySearchDigest,
+					Message: fmt.Sprintf("%d new listings match your saved search %q.", len(digest.Listings), digest.Search.Name),
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(matches)+len(digests) > 0 {
+				log.Printf("sent %d saved search alerts and %d digests", len(matches), len(digests))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	geo "github.com/paulmach/go.geo"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// createCategorisedListing stores a published listing with a category directly through the service
+func (s *testServer) createCategorisedListing(userID int, listingType, title, category string, lng, lat float64) Services.Listing {
+	s.t.Helper()
+
+	listing, err := s.app.Service.Listings.Create(context.Background(), &Services.Listing{
+		Type:        listingType,
+		Location:    geo.NewPoint(lng, lat),
+		UserID:      userID,
+		Title:       title,
+		Description: title + " description",
+		Category:    category,
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return listing
+}
+
+func TestSavedSearches(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.createUser("Client", "+96170000001")
+	_, otherToken := s.createUser("Other", "+96170000002")
+
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/savedsearch/create", map[string]interface{}{
+		"name": "Near home", "location": []float64{35.5018, 33.8938}, "frequency": "instant",
+	}, token), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/savedsearch/create", map[string]interface{}{
+		"name": "Hourly", "frequency": "hourly",
+	}, token), http.StatusBadRequest)
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/savedsearch/create", map[string]interface{}{
+		"name":         "Tilers near home",
+		"type":         "Offer",
+		"query":        "tiling",
+		"category":     "tiling",
+		"location":     []float64{35.5018, 33.8938},
+		"max_distance": 10,
+		"frequency":    "instant",
+	}, token)
+	expectStatus(t, rec, http.StatusCreated)
+	var search Services.SavedSearch
+	decode(t, rec, &search)
+	if search.SearchID == 0 || search.Location == nil || search.MaxDistance != 10 || search.Category != "tiling" {
+		t.Fatalf("unexpected saved search %+v", search)
+	}
+	id := strconv.Itoa(search.SearchID)
+
+	var searches []Services.SavedSearch
+	rec = s.do(http.MethodGet, "/api/v1/savedsearch/searches", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &searches)
+	if len(searches) != 1 {
+		t.Fatalf("expected one saved search, got %+v", searches)
+	}
+	rec = s.do(http.MethodGet, "/api/v1/savedsearch/searches", nil, "", otherToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &searches)
+	if len(searches) != 0 {
+		t.Fatalf("saved searches leak to other users: %+v", searches)
+	}
+
+	update := map[string]interface{}{"name": "Tilers anywhere", "type": "Offer", "frequency": "daily"}
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/savedsearch/update/"+id, update, otherToken), http.StatusNotFound)
+	rec = s.doJSON(http.MethodPut, "/api/v1/savedsearch/update/"+id, update, token)
+	expectStatus(t, rec, http.StatusOK)
+	var updated Services.SavedSearch
+	decode(t, rec, &updated)
+	if updated.Name != "Tilers anywhere" || updated.Location != nil || updated.Query != "" || updated.Frequency != Services.AlertDaily {
+		t.Fatalf("unexpected updated search %+v", updated)
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/savedsearch/matches/"+id, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/savedsearch/delete/"+id, nil, "", otherToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/savedsearch/delete/"+id, nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/savedsearch/matches/"+id, nil, "", token), http.StatusNotFound)
+}
+
+func TestSavedSearchAlerts(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	client, token := s.createUser("Client", "+96170000001")
+	tradesman, tradesToken := s.createUser("Tradesman", "+96170000002")
+	alerts := s.app.savedSearchJob()
+
+	instant, err := s.app.Service.SavedSearches.Create(ctx, &Services.SavedSearch{
+		UserID: client.UserID, Name: "Tilers near home", Type: "Offer", Query: "tiling", Category: "tiling",
+		Location: geo.NewPoint(35.5018, 33.8938), MaxDistance: 10, Frequency: Services.AlertInstant,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily, err := s.app.Service.SavedSearches.Create(ctx, &Services.SavedSearch{
+		UserID: client.UserID, Name: "Any offer", Type: "Offer", Frequency: Services.AlertDaily,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match := s.createCategorisedListing(tradesman.UserID, "Offer", "Tiling work", "tiling", 35.5100, 33.8900)
+	s.createCategorisedListing(tradesman.UserID, "Request", "Need tiling", "tiling", 35.5100, 33.8900)
+	s.createCategorisedListing(tradesman.UserID, "Offer", "Tiling in Tripoli", "tiling", 35.8498, 34.4346)
+	s.createCategorisedListing(tradesman.UserID, "Offer", "Tiling and plumbing", "plumbing", 35.5100, 33.8900)
+	s.createCategorisedListing(client.UserID, "Offer", "My own tiling", "tiling", 35.5100, 33.8900)
+
+	for i := 0; i < 2; i++ {
+		if err := alerts.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifications := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", token))
+	if len(notifications) != 1 || notifications[0].Kind != Services.NotifySearchMatch || notifications[0].ListingID != match.ListingID {
+		t.Fatalf("expected one alert for the matching listing, got %+v", notifications)
+	}
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/savedsearch/matches/"+strconv.Itoa(instant.SearchID), nil, "", token))); len(titles) != 1 {
+		t.Fatalf("expected one match, got %v", titles)
+	}
+
+	// Editing a listing gets it matched again, but each listing alerts a search only once
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/listing/update/"+strconv.Itoa(match.ListingID), map[string]interface{}{
+		"type": "Offer", "location": []float64{35.5100, 33.8900}, "title": "Tiling work, now with grout",
+		"description": "Floors and walls", "category": "tiling",
+	}, tradesToken), http.StatusOK)
+	if err := alerts.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if notifications := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", token)); len(notifications) != 1 {
+		t.Fatalf("expected no repeated alert, got %+v", notifications)
+	}
+
+	// The daily search collects its matches into one digest once the digest period has passed
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/savedsearch/matches/"+strconv.Itoa(daily.SearchID), nil, "", token))); len(titles) != 3 {
+		t.Fatalf("expected three offers of other users, got %v", titles)
+	}
+	s.app.config.searches.digestEvery = 0
+	for i := 0; i < 2; i++ {
+		if err := alerts.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notifications = decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", token))
+	if len(notifications) != 2 || notifications[0].Kind != Services.NotifySearchDigest {
+		t.Fatalf("expected one digest, got %+v", notifications)
+	}
+}
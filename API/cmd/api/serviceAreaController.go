@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+)
+
+// createServiceArea handles the request to add a service area for the caller, drawn as a polygon or copied from a district.
+func (app *application) createServiceArea(w http.ResponseWriter, r *http.Request) {
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var area Services.ServiceArea
+	err = decodeJSON(r, &area)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	area.UserID = tokenUserId
+
+	created, err := app.Service.ServiceAreas.Create(r.Context(), &area)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// getServiceAreas handles the request to get the service areas of a user.
+func (app *application) getServiceAreas(w http.ResponseWriter, r *http.Request) {
+	userID, err := intParam(r, "user_id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	areas, err := app.Service.ServiceAreas.GetByUser(r.Context(), userID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(areas)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// deleteServiceArea handles the request to delete one of the caller's service areas.
+// Other users' areas are reported as not found.
+func (app *application) deleteServiceArea(w http.ResponseWriter, r *http.Request) {
+	areaID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	area, err := app.Service.ServiceAreas.GetByID(r.Context(), areaID)
+	if err == nil && area.UserID != tokenUserId {
+		err = fmt.Errorf("service area %w", Services.ErrNotFound)
+	}
+	if err == nil {
+		err = app.Service.ServiceAreas.Delete(r.Context(), areaID)
+	}
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getDistricts handles the request to list the named districts a service area can be copied from.
+func (app *application) getDistricts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(Services.Districts)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getTradesmenServing handles the request to get the users whose service area contains a point.
+// Closed accounts are left out.
+func (app *application) getTradesmenServing(w http.ResponseWriter, r *http.Request) {
+	latitude, err := floatParam(r, "latitude")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	longitude, err := floatParam(r, "longitude")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	userIDs, err := app.Service.ServiceAreas.UsersServing(r.Context(), latitude, longitude)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	users := []Services.User{}
+	for _, userID := range userIDs {
+		user, err := app.Service.Users.GetById(r.Context(), userID)
+		if errors.Is(err, Services.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		if user.DeletedAt == "" {
+			users = append(users, user)
+		}
+	}
+
+	// Show each user as the caller may see them
+	profiles, err := app.profiles(r, users)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(profiles)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
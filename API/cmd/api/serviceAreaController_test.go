@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestServiceAreas(t *testing.T) {
+	s := newTestServer(t)
+	tradesman, tradesmanToken := s.createUser("Tradesman", "+96170000001")
+	_, clientToken := s.createUser("Client", "+96170000002")
+	s.createListing(tradesman.UserID, "Offer", "Electrical work", 35.8498, 34.4346)
+	s.createListing(tradesman.UserID, "Request", "Need a van", 35.8498, 34.4346)
+
+	// A point in Metn, far from Tripoli where the listings are
+	nearby := "/api/v1/listing/distance/35.60/33.90/5/all"
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, nearby, nil, "", ""))); len(titles) != 0 {
+		t.Fatalf("expected nothing nearby before the service area exists, got %v", titles)
+	}
+
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/servicearea/create", map[string]interface{}{"district": "Metn"}, ""), http.StatusUnauthorized)
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/servicearea/create", map[string]interface{}{"district": "Atlantis"}, tradesmanToken), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/servicearea/create", map[string]interface{}{"name": "Line", "polygon": [][2]float64{{35.5, 33.8}, {35.6, 33.9}}}, tradesmanToken), http.StatusBadRequest)
+	expectStatus(t, s.doJSON(http.MethodPost, "/api/v1/servicearea/create", map[string]interface{}{"polygon": [][2]float64{{35.5, 33.8}, {35.6, 33.8}, {35.6, 33.9}}}, tradesmanToken), http.StatusBadRequest)
+
+	var metn Services.ServiceArea
+	rec := s.doJSON(http.MethodPost, "/api/v1/servicearea/create", map[string]interface{}{"district": "metn"}, tradesmanToken)
+	expectStatus(t, rec, http.StatusCreated)
+	decode(t, rec, &metn)
+	if metn.Name != "Metn" || metn.District != "Metn" || metn.UserID != tradesman.UserID || len(metn.Polygon) != 5 {
+		t.Fatalf("unexpected district area %+v", metn)
+	}
+
+	// Rings are closed for the client
+	var drawn Services.ServiceArea
+	rec = s.doJSON(http.MethodPost, "/api/v1/servicearea/create", map[string]interface{}{
+		"name":    "Batroun coast",
+		"polygon": [][2]float64{{35.63, 34.20}, {35.70, 34.20}, {35.70, 34.30}, {35.63, 34.30}},
+	}, tradesmanToken)
+	expectStatus(t, rec, http.StatusCreated)
+	decode(t, rec, &drawn)
+	if len(drawn.Polygon) != 5 || drawn.Polygon[4] != drawn.Polygon[0] || drawn.District != "" {
+		t.Fatalf("unexpected drawn area %+v", drawn)
+	}
+
+	var areas []Services.ServiceArea
+	rec = s.do(http.MethodGet, "/api/v1/servicearea/user/"+strconv.Itoa(tradesman.UserID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &areas)
+	if len(areas) != 2 || areas[0].AreaID != metn.AreaID || areas[1].Name != "Batroun coast" {
+		t.Fatalf("unexpected service areas %+v", areas)
+	}
+
+	// The tradesman's offers now show up in radius searches around any point of their area, but their requests do not
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, nearby, nil, "", ""))); len(titles) != 1 || titles[0] != "Electrical work" {
+		t.Fatalf("expected the tradesman's offer, got %v", titles)
+	}
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, nearby+"/electrical", nil, "", ""))); len(titles) != 1 {
+		t.Fatalf("expected the tradesman's offer in a search, got %v", titles)
+	}
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, nearby+"/tiling", nil, "", ""))); len(titles) != 0 {
+		t.Fatalf("expected the search to still apply, got %v", titles)
+	}
+
+	var profiles []Services.Profile
+	rec = s.do(http.MethodGet, "/api/v1/servicearea/tradesmen/35.60/33.90", nil, "", clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &profiles)
+	if len(profiles) != 1 || profiles[0].UserID != tradesman.UserID {
+		t.Fatalf("expected the tradesman to serve Metn, got %+v", profiles)
+	}
+	profiles = nil
+	decode(t, s.do(http.MethodGet, "/api/v1/servicearea/tradesmen/35.50/33.89", nil, "", ""), &profiles)
+	if len(profiles) != 0 {
+		t.Fatalf("expected nobody to serve Beirut, got %+v", profiles)
+	}
+
+	// Only the owner can delete an area
+	metnPath := "/api/v1/servicearea/delete/" + strconv.Itoa(metn.AreaID)
+	expectStatus(t, s.do(http.MethodDelete, metnPath, nil, "", clientToken), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodDelete, metnPath, nil, "", tradesmanToken), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, metnPath, nil, "", tradesmanToken), http.StatusNotFound)
+	if titles := listingTitles(decodeListings(t, s.do(http.MethodGet, nearby, nil, "", ""))); len(titles) != 0 {
+		t.Fatalf("expected the offer to leave Metn with its area, got %v", titles)
+	}
+}
+
+func TestGetDistricts(t *testing.T) {
+	s := newTestServer(t)
+
+	var districts []Services.District
+	rec := s.do(http.MethodGet, "/api/v1/servicearea/districts", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	decode(t, rec, &districts)
+	if len(districts) != len(Services.Districts) || districts[0].Name != "Beirut" || len(districts[0].Polygon) != 5 {
+		t.Fatalf("unexpected districts %+v", districts)
+	}
+}
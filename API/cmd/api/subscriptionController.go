@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Jobs"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// subscriptionRequest is the body of a request to change plan
+type subscriptionRequest struct {
+	Plan string `json:"plan" validate:"required,oneof=free pro business"`
+}
+
+// getPlans handles the request to list the plans and what each of them allows.
+func (app *application) getPlans(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(Services.Plans())
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getSubscription handles the request to get the caller's plan for the current period.
+func (app *application) getSubscription(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	subscription, err := app.Service.Subscriptions.Get(r.Context(), tokenUserID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(subscription)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// changeSubscription handles the request to move the caller to another plan. Upgrades are
+// charged pro rata and apply at once; downgrades and cancellations apply when the period ends.
+func (app *application) changeSubscription(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	var request subscriptionRequest
+	err = decodeJSON(r, &request)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	subscription, err := app.Service.Subscriptions.Change(r.Context(), tokenUserID, request.Plan)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(subscription)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getSubscriptionCharges handles the request to list what the caller paid for plans, most recent first.
+func (app *application) getSubscriptionCharges(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	charges, err := app.Service.Subscriptions.GetCharges(r.Context(), tokenUserID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(charges)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// getSubscriptions handles the admin request to list the subscriptions to paid plans.
+func (app *application) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := app.Service.Subscriptions.GetAll(r.Context())
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(subscriptions)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
+
+// boostListings ranks browsed and searched listings by the search boost of their owners'
+// plans, keeping the order of the query within each plan
+func (app *application) boostListings(ctx context.Context, listings []Services.Listing) error {
+	boosts := map[int]int{}
+	for _, listing := range listings {
+		if _, ok := boosts[listing.UserID]; ok {
+			continue
+		}
+		subscription, err := app.Service.Subscriptions.Get(ctx, listing.UserID)
+		if err != nil {
+			return err
+		}
+		boosts[listing.UserID] = subscription.Entitlements.SearchBoost
+	}
+
+	sort.SliceStable(listings, func(i, j int) bool {
+		return boosts[listings[i].UserID] > boosts[listings[j].UserID]
+	})
+	return nil
+}
+
+// checkImageAllowance refuses an upload that would take the caller's listing past the
+// number of images their plan allows, before any file of it is saved. Uploads for no
+// listing, a missing one or someone else's are left for the upload handler to deal with.
+// Images.AddImage checks the limit again as each image is stored, so concurrent uploads
+// cannot go past it.
+func (app *application) checkImageAllowance(ctx context.Context, r *http.Request, tokenUserID int) error {
+	listingID, err := intParam(r, "listing_id")
+	if err != nil || listingID == 0 {
+		return nil
+	}
+	listing, err := app.Service.Listings.GetByID(ctx, listingID)
+	if errors.Is(err, Services.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if listing.UserID != tokenUserID {
+		return nil
+	}
+
+	subscription, err := app.Service.Subscriptions.Get(ctx, tokenUserID)
+	if err != nil {
+		return err
+	}
+	images, err := app.Service.Images.GetImagesByListingID(ctx, listingID)
+	if err != nil {
+		return err
+	}
+	uploaded := 0
+	for _, fileHeaders := range r.MultipartForm.File {
+		uploaded += len(fileHeaders)
+	}
+
+	limit := subscription.Entitlements.MaxImagesPerListing
+	if len(images)+uploaded > limit {
+		return fmt.Errorf("the %s plan allows %d images per listing and this one has %d: %w",
+			subscription.Plan, limit, len(images), Services.ErrPlanLimit)
+	}
+	return nil
+}
+
+// pauseOverLimit pauses the published listings of a subscriber beyond what their plan
+// allows, keeping the newest ones, and tells them which were paused
+func (app *application) pauseOverLimit(ctx context.Context, subscription Services.Subscription) (int, error) {
+	limit := subscription.Entitlements.MaxActiveListings
+	if limit == 0 {
+		return 0, nil
+	}
+
+	listings, err := app.Service.Listings.GetByUserID(ctx, subscription.UserID, "")
+	if err != nil {
+		return 0, err
+	}
+	published := []Services.Listing{}
+	for _, listing := range listings {
+		if listing.Status == Services.ListingPublished {
+			published = append(published, listing)
+		}
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].ListingID > published[j].ListingID })
+
+	paused := 0
+	for _, listing := range published[min(limit, len(published)):] {
+		if err := app.Service.Listings.SetStatus(ctx, listing.ListingID, Services.ListingPaused); err != nil {
+			return paused, err
+		}
+		paused++
+		err = app.notify(ctx, listing, Services.NotifyListingPaused,
+			fmt.Sprintf("Your listing %q was paused because the %s plan allows %d published listings.", listing.Title, subscription.Plan, limit))
+		if err != nil {
+			return paused, err
+		}
+	}
+	return paused, nil
+}
+
+// subscriptionJob renews the subscriptions whose period is over and ends those that moved
+// to the free plan or could not be charged. Listings over the new plan's limit are paused.
+func (app *application) subscriptionJob() Jobs.Job {
+	return Jobs.Job{
+		Name:     "subscriptions",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			renewed, ended, err := app.Service.Subscriptions.Renew(ctx)
+			if err != nil {
+				return err
+			}
+
+			paused := 0
+			for _, subscription := range renewed {
+				err = app.Service.Notifications.Create(ctx, &Services.Notification{
+					UserID:  subscription.UserID,
+					Kind:    Services.NotifyPlanRenewed,
+					Message: fmt.Sprintf("Your %s plan was renewed until %s.", subscription.Plan, subscription.PeriodEnd),
+				})
+				if err != nil {
+					return err
+				}
+				n, err := app.pauseOverLimit(ctx, subscription)
+				paused += n
+				if err != nil {
+					return err
+				}
+			}
+			for _, subscription := range ended {
+				err = app.Service.Notifications.Create(ctx, &Services.Notification{
+					UserID:  subscription.UserID,
+					Kind:    Services.NotifyPlanEnded,
+					Message: fmt.Sprintf("Your %s plan has ended and you are now on the free plan.", subscription.Plan),
+				})
+				if err != nil {
+					return err
+				}
+				free, err := app.Service.Subscriptions.Get(ctx, subscription.UserID)
+				if err != nil {
+					return err
+				}
+				n, err := app.pauseOverLimit(ctx, free)
+				paused += n
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(renewed)+len(ended) > 0 {
+				log.Printf("renewed %d subscriptions, ended %d and paused %d listings over their plan", len(renewed), len(ended), paused)
+			}
+			return nil
+		},
+	}
+}
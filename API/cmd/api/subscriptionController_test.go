@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// changePlan moves the caller to plan and returns their subscription
+func (s *testServer) changePlan(t *testing.T, plan, token string) Services.Subscription {
+	t.Helper()
+	rec := s.doJSON(http.MethodPut, "/api/v1/subscription/change", map[string]interface{}{"plan": plan}, token)
+	expectStatus(t, rec, http.StatusOK)
+
+	var subscription Services.Subscription
+	decode(t, rec, &subscription)
+	return subscription
+}
+
+// subscriptionCharges returns what the caller paid for plans
+func (s *testServer) subscriptionCharges(t *testing.T, token string) []Services.SubscriptionCharge {
+	t.Helper()
+	rec := s.do(http.MethodGet, "/api/v1/subscription/charges", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+
+	var charges []Services.SubscriptionCharge
+	decode(t, rec, &charges)
+	return charges
+}
+
+func TestPlanChanges(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+
+	rec := s.do(http.MethodGet, "/api/v1/subscription/plans", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	var plans []Services.Plan
+	decode(t, rec, &plans)
+	if len(plans) != 3 || plans[0].Name != Services.PlanFree || plans[1].Price != 9.99 || !plans[2].Entitlements.Analytics {
+		t.Fatalf("unexpected plans %+v", plans)
+	}
+
+	rec = s.do(http.MethodGet, "/api/v1/subscription/current", nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+	var current Services.Subscription
+	decode(t, rec, &current)
+	if current.Plan != Services.PlanFree || current.PeriodEnd != "" || current.Entitlements.MaxImagesPerListing != 5 {
+		t.Fatalf("expected the free plan, got %+v", current)
+	}
+
+	// A first paid plan is charged in full and paid to the platform
+	pro := s.changePlan(t, Services.PlanPro, token)
+	if pro.Plan != Services.PlanPro || pro.PeriodEnd == "" || pro.Entitlements.SearchBoost != 1 {
+		t.Fatalf("expected the pro plan, got %+v", pro)
+	}
+	if s.payments.Balance(user.UserID) != -9.99 || s.payments.Fees() != 9.99 || s.payments.Held() != 0 {
+		t.Fatalf("expected 9.99 paid to the platform, got %.2f and %.2f", s.payments.Balance(user.UserID), s.payments.Fees())
+	}
+
+	// Upgrading is charged the difference for what is left of the period, which is all of it
+	business := s.changePlan(t, Services.PlanBusiness, token)
+	if business.Plan != Services.PlanBusiness || business.PeriodEnd != pro.PeriodEnd {
+		t.Fatalf("expected business for the same period, got %+v", business)
+	}
+	charges := s.subscriptionCharges(t, token)
+	if len(charges) != 2 || charges[0].Plan != Services.PlanBusiness || charges[0].Amount != 20 || charges[0].Reference == "" || charges[1].Amount != 9.99 {
+		t.Fatalf("expected the prorated upgrade first, got %+v", charges)
+	}
+
+	// Downgrading waits for the end of the period, and can be called off
+	downgraded := s.changePlan(t, Services.PlanPro, token)
+	if downgraded.Plan != Services.PlanBusiness || downgraded.NextPlan != Services.PlanPro {
+		t.Fatalf("expected pro to follow business, got %+v", downgraded)
+	}
+	if kept := s.changePlan(t, Services.PlanBusiness, token); kept.NextPlan != "" {
+		t.Fatalf("expected the downgrade to be called off, got %+v", kept)
+	}
+	if charges := s.subscriptionCharges(t, token); len(charges) != 2 {
+		t.Fatalf("expected no charge for downgrades, got %+v", charges)
+	}
+
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/subscription/change", map[string]interface{}{"plan": "gold"}, token), http.StatusBadRequest)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/subscription/current", nil, "", ""), http.StatusUnauthorized)
+
+	// A declined charge leaves the user on their plan
+	_, otherToken := s.createUser("Other", "+96170000002")
+	s.payments.Decline = true
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/subscription/change", map[string]interface{}{"plan": "pro"}, otherToken), http.StatusPaymentRequired)
+	s.payments.Decline = false
+	if charges := s.subscriptionCharges(t, otherToken); len(charges) != 0 {
+		t.Fatalf("expected no charge, got %+v", charges)
+	}
+
+	admin, adminToken := s.createUser("Admin", "+96170000009")
+	if err := s.app.Service.Users.SetRole(context.Background(), admin.UserID, Services.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	adminToken = s.signIn("+96170000009")
+	rec = s.do(http.MethodGet, "/api/v1/admin/subscriptions", nil, "", adminToken)
+	expectStatus(t, rec, http.StatusOK)
+	var subscriptions []Services.Subscription
+	decode(t, rec, &subscriptions)
+	if len(subscriptions) != 1 || subscriptions[0].UserID != user.UserID {
+		t.Fatalf("expected the one paid subscription, got %+v", subscriptions)
+	}
+}
+
+func TestPublishedListingLimit(t *testing.T) {
+	s := newTestServer(t)
+	t.Setenv("PLAN_FREE_LISTINGS", "3")
+	user, token := s.createUser("Adam", "+96170000001")
+	create := func(status string) *httptest.ResponseRecorder {
+		listing := map[string]interface{}{
+			"type":        "Offer",
+			"location":    []float64{35.5018, 33.8938},
+			"user_id":     user.UserID,
+			"title":       "Electrician",
+			"description": "Wiring and repairs",
+		}
+		if status != "" {
+			listing["status"] = status
+		}
+		return s.doJSON(http.MethodPost, "/api/v1/listing/create", listing, token)
+	}
+	status := func(id int, to string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPut, "/api/v1/listing/status/"+strconv.Itoa(id)+"/"+to, nil, "", token)
+	}
+
+	for i := 0; i < 3; i++ {
+		expectStatus(t, create(""), http.StatusCreated)
+	}
+	rec := create("")
+	expectStatus(t, rec, http.StatusForbidden)
+	var problem map[string]interface{}
+	decode(t, rec, &problem)
+	if problem["code"] != "plan_limit" {
+		t.Fatalf("expected a plan_limit problem, got %+v", problem)
+	}
+
+	// Drafts do not count until they are published
+	expectStatus(t, create(Services.ListingDraft), http.StatusCreated)
+	expectStatus(t, status(4, Services.ListingPublished), http.StatusForbidden)
+
+	// Renewing a published listing does not take another place
+	expectStatus(t, status(1, Services.ListingPublished), http.StatusOK)
+	expectStatus(t, status(1, Services.ListingPaused), http.StatusOK)
+	expectStatus(t, status(4, Services.ListingPublished), http.StatusOK)
+
+	s.changePlan(t, Services.PlanPro, token)
+	expectStatus(t, status(1, Services.ListingPublished), http.StatusOK)
+	expectStatus(t, create(""), http.StatusCreated)
+}
+
+func TestListingImageLimit(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+	listing := s.createListing(user.UserID, "Offer", "Tiling", 35.5, 33.9)
+	path := "/api/v1/image/uploadForListing/" + strconv.Itoa(listing.ListingID)
+
+	for i := 0; i < 5; i++ {
+		expectStatus(t, s.upload(path, "tiles.png", token), http.StatusOK)
+	}
+	expectStatus(t, s.upload(path, "tiles.png", token), http.StatusForbidden)
+
+	s.changePlan(t, Services.PlanPro, token)
+	expectStatus(t, s.upload(path, "tiles.png", token), http.StatusOK)
+	images, err := s.app.Service.Images.GetImagesByListingID(context.Background(), listing.ListingID)
+	if err != nil || len(images) != 6 {
+		t.Fatalf("expected six images, got %d %v", len(images), err)
+	}
+}
+
+func TestSearchBoost(t *testing.T) {
+	s := newTestServer(t)
+	free, _ := s.createUser("Free", "+96170000001")
+	pro, proToken := s.createUser("Pro", "+96170000002")
+	business, businessToken := s.createUser("Business", "+96170000003")
+	s.createListing(free.UserID, "Offer", "Plumbing by Free", 35.5, 33.9)
+	s.createListing(pro.UserID, "Offer", "Plumbing by Pro", 35.5, 33.9)
+	s.createListing(business.UserID, "Offer", "Plumbing by Business", 35.5, 33.9)
+	s.createListing(free.UserID, "Offer", "More plumbing by Free", 35.5, 33.9)
+	s.changePlan(t, Services.PlanPro, proToken)
+	s.changePlan(t, Services.PlanBusiness, businessToken)
+
+	titles := listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/search/lumbing/Offer", nil, "", "")))
+	want := []string{"Plumbing by Business", "Plumbing by Pro", "Plumbing by Free", "More plumbing by Free"}
+	if len(titles) != len(want) {
+		t.Fatalf("expected %v, got %v", want, titles)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, titles)
+		}
+	}
+
+	titles = listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/distance/35.5/33.9/10/Offer/lumbing", nil, "", "")))
+	if len(titles) != 4 || titles[0] != "Plumbing by Business" {
+		t.Fatalf("expected the business listing first, got %v", titles)
+	}
+	titles = listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/date/search/lumbing/Offer", nil, "", "")))
+	if len(titles) != 4 || titles[0] != "Plumbing by Business" || titles[2] != "More plumbing by Free" {
+		t.Fatalf("expected plans first, then the newest, got %v", titles)
+	}
+
+	// Browsing without a query ranks the same way
+	for _, path := range []string{"/api/v1/listing/listings/Offer", "/api/v1/listing/distance/35.5/33.9/10/Offer", "/api/v1/listing/date/Offer"} {
+		titles = listingTitles(decodeListings(t, s.do(http.MethodGet, path, nil, "", "")))
+		if len(titles) != 4 || titles[0] != "Plumbing by Business" || titles[1] != "Plumbing by Pro" {
+			t.Fatalf("expected the paid plans first on %s, got %v", path, titles)
+		}
+	}
+	titles = listingTitles(decodeListings(t, s.do(http.MethodGet, "/api/v1/listing/date/Offer", nil, "", "")))
+	if titles[2] != "More plumbing by Free" {
+		t.Fatalf("expected the newest free listing next, got %v", titles)
+	}
+}
+
+func TestSubscriptionJob(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	t.Setenv("PLAN_FREE_LISTINGS", "3")
+	// Periods without a length are over straight away
+	t.Setenv("PLAN_PERIOD_DAYS", "0")
+	renewing, renewingToken := s.createUser("Renewing", "+96170000001")
+	leaving, leavingToken := s.createUser("Leaving", "+96170000002")
+	job := s.app.subscriptionJob()
+
+	s.changePlan(t, Services.PlanPro, renewingToken)
+	var listings []Services.Listing
+	for i := 0; i < 4; i++ {
+		listings = append(listings, s.createListing(renewing.UserID, "Offer", "Plumbing "+strconv.Itoa(i+1), 35.5, 33.9))
+	}
+	s.changePlan(t, Services.PlanBusiness, leavingToken)
+	s.changePlan(t, Services.PlanFree, leavingToken)
+
+	if err := job.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if charges := s.subscriptionCharges(t, renewingToken); len(charges) != 2 || charges[0].Amount != 9.99 {
+		t.Fatalf("expected the pro plan to be charged again, got %+v", charges)
+	}
+	notifications := decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", renewingToken))
+	if len(notifications) != 1 || notifications[0].Kind != Services.NotifyPlanRenewed {
+		t.Fatalf("expected a renewal notification, got %+v", notifications)
+	}
+	if current, _ := s.app.Service.Subscriptions.Get(ctx, leaving.UserID); current.Plan != Services.PlanFree {
+		t.Fatalf("expected the cancelled plan to end, got %+v", current)
+	}
+	notifications = decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications", nil, "", leavingToken))
+	if len(notifications) != 1 || notifications[0].Kind != Services.NotifyPlanEnded {
+		t.Fatalf("expected an end of plan notification, got %+v", notifications)
+	}
+
+	// A declined renewal ends the plan and pauses the oldest listings over the free limit
+	s.payments.Decline = true
+	if err := job.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.payments.Decline = false
+	if current, _ := s.app.Service.Subscriptions.Get(ctx, renewing.UserID); current.Plan != Services.PlanFree {
+		t.Fatalf("expected the unpaid plan to end, got %+v", current)
+	}
+	for i, listing := range listings {
+		stored, err := s.app.Service.Listings.GetByID(ctx, listing.ListingID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paused := stored.Status == Services.ListingPaused; paused != (i == 0) {
+			t.Fatalf("expected only the oldest listing to be paused, listing %d is %s", i+1, stored.Status)
+		}
+	}
+	notifications = decodeNotifications(t, s.do(http.MethodGet, "/api/v1/notification/notifications?unread=true", nil, "", renewingToken))
+	if len(notifications) != 3 || notifications[0].Kind != Services.NotifyListingPaused || notifications[0].ListingID != listings[0].ListingID ||
+		notifications[1].Kind != Services.NotifyPlanEnded {
+		t.Fatalf("expected the end of plan and paused listing notifications, got %+v", notifications)
+	}
+}
+
+func TestListingImageLimitConcurrent(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+	listing := s.createListing(user.UserID, "Offer", "Tiling", 35.5, 33.9)
+	path := "/api/v1/image/uploadForListing/" + strconv.Itoa(listing.ListingID)
+
+	for i := 0; i < 4; i++ {
+		expectStatus(t, s.upload(path, "tiles.png", token), http.StatusOK)
+	}
+
+	// Every upload passes the early check with four images stored, only one may be kept
+	codes := make([]int, 5)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = s.upload(path, "tiles.png", token).Code
+		}()
+	}
+	wg.Wait()
+	uploaded := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			uploaded++
+		case http.StatusForbidden:
+		default:
+			t.Fatalf("expected 200 or 403, got %d", code)
+		}
+	}
+	images, err := s.app.Service.Images.GetImagesByListingID(context.Background(), listing.ListingID)
+	if uploaded != 1 || err != nil || len(images) != 5 {
+		t.Fatalf("expected one more upload and five images, got %d and %d %v", uploaded, len(images), err)
+	}
+}
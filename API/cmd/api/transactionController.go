@@ -3,127 +3,201 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Utils"
 	"github.com/go-chi/chi/v5"
 	"net/http"
-	"strconv"
 	"text/template"
 )
 
-// @Summary		Create a new transaction
-// @Description	Create a new transaction between a user and a listing
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			transaction	body		Services.Transaction	true	"Transaction data"
-// @Success		201			{object}	Services.Transaction
-// @Failure		400			{object}	http.ResponseError
-// @Failure		401			{object}	http.ResponseError
-// @Failure		500			{object}	http.ResponseError
-// @Router			/transactions [post]
+// transactionUpdate is the body of the request updating a transaction. The parties, listing and
+// price stay as agreed, so only the status and the rating can change.
+type transactionUpdate struct {
+	// @example "Accepted"
+	Status string `json:"status" validate:"omitempty,oneof=Pending Accepted Completed Cancelled"`
+
+	// Rating is the client's 1 to 5 rating of the tradesman, given once the job is Completed
+	// @example 5
+	Rating int `json:"rating,omitempty" validate:"omitempty,min=1,max=5"`
+}
+
+// createTransaction handles the request to create a new transaction.
 func (app *application) createTransaction(w http.ResponseWriter, r *http.Request) {
 
 	var transaction Services.Transaction
 
 	//Token Valid
 
-	tokenUserId, ok := r.Context().Value("token_user_id").(int)
-
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	tokenUserId, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&transaction)
+	err = decodeJSON(r, &transaction)
 	if err != nil {
-		http.Error(w, string(err.Error()), http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	if transaction.UserOfferedID != tokenUserId {
-		http.Error(w, string("User offering ID not found in token"), http.StatusUnauthorized)
+		app.respondError(w, r, fmt.Errorf("cannot create a transaction for another user: %w", Services.ErrForbidden))
 		return
 	}
+	err = app.checkOfferedListing(r, transaction)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	transaction.CurrencyCode = Services.CurrencyOrDefault(transaction.CurrencyCode)
 
 	createdTransaction, err := app.Service.Transactions.Create(r.Context(), &transaction)
 	if err != nil {
-		http.Error(w, string(err.Error()), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
+	if createdTransaction.UserOfferingID != tokenUserId {
+		app.track(Services.EventInquiry, createdTransaction.UserOfferingID, createdTransaction.ListingID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(createdTransaction)
+	json.NewEncoder(w).Encode(createdTransaction)
+}
+
+// checkOfferedListing refuses an offer on a listing that does not exist, is not published
+// or is not the tradesman's, so that a transaction always names the owner of its listing
+func (app *application) checkOfferedListing(r *http.Request, transaction Services.Transaction) error {
+	if transaction.UserOfferingID == transaction.UserOfferedID {
+		return Services.Invalid("user_offering_id", "must be another user than user_offered_id")
+	}
+	listing, err := app.Service.Listings.GetByID(r.Context(), transaction.ListingID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	if listing.Status != Services.ListingPublished {
+		return Services.Invalid("listing_id", "must be a published listing")
 	}
+	if listing.UserID != transaction.UserOfferingID {
+		return Services.Invalid("user_offering_id", "must be the owner of the listing")
+	}
+	return nil
 }
 
-// @Summary		Get a transaction by ID
-// @Description	Get a specific transaction by its ID
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			id	path		int	true	"Transaction ID"
-// @Success		200	{object}	Services.Transaction
-// @Failure		400	{object}	http.ResponseError
-// @Failure		404	{object}	http.ResponseError
-// @Failure		500	{object}	http.ResponseError
-// @Router			/transactions/{id} [get]
-func (app *application) getTransactionByID(w http.ResponseWriter, r *http.Request) {
-	// Get transaction ID from URL parameter
-	transactionIDStr := chi.URLParam(r, "id")
-	transactionID, err := strconv.Atoi(transactionIDStr)
+// checkTransactionParty refuses a change that the caller's side of a transaction may not make.
+// The tradesman accepts the client's offer, the client completes and rates the job, and
+// either of them may cancel it.
+func checkTransactionParty(stored, updated Services.Transaction, userID int) error {
+	if userID != stored.UserOfferedID && userID != stored.UserOfferingID {
+		return fmt.Errorf("cannot update another user's transaction: %w", Services.ErrForbidden)
+	}
+	if updated.Status != stored.Status {
+		switch {
+		case updated.Status == "Accepted" && userID != stored.UserOfferingID:
+			return fmt.Errorf("only the tradesman can accept an offer: %w", Services.ErrForbidden)
+		case updated.Status == "Completed" && userID != stored.UserOfferedID:
+			return fmt.Errorf("only the client can complete a job: %w", Services.ErrForbidden)
+		}
+	}
+	if updated.Rating != stored.Rating && userID != stored.UserOfferedID {
+		return fmt.Errorf("only the client can rate a job: %w", Services.ErrForbidden)
+	}
+	return nil
+}
+
+// partyTransaction returns the transaction in the URL if the caller is one of its two parties
+func (app *application) partyTransaction(r *http.Request) (Services.Transaction, error) {
+	transactionID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
-		return
+		return Services.Transaction{}, err
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return Services.Transaction{}, err
 	}
 
-	// Retrieve the transaction by ID
 	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
 	if err != nil {
-		if err.Error() == "transaction not found" {
-			http.Error(w, "Transaction not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return Services.Transaction{}, err
+	}
+	if transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
+		return Services.Transaction{}, fmt.Errorf("cannot see a transaction you are not part of: %w", Services.ErrForbidden)
+	}
+	return transaction, nil
+}
+
+// ownUserParam checks that the user in the URL parameter is the caller
+func ownUserParam(r *http.Request, param string) (int, error) {
+	userID, err := intParam(r, param)
+	if err != nil {
+		return 0, err
+	}
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		return 0, err
+	}
+	if userID != tokenUserID {
+		return 0, fmt.Errorf("cannot see the transactions of another user: %w", Services.ErrForbidden)
+	}
+	return userID, nil
+}
+
+// getTransactionByID handles the request to get a transaction by ID. Only its two parties see it.
+func (app *application) getTransactionByID(w http.ResponseWriter, r *http.Request) {
+	transaction, err := app.partyTransaction(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	currency, err := app.viewerCurrency(r)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
+	shown := []Services.Transaction{transaction}
+	err = app.displayPrices(r.Context(), currency, shown)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	transaction = shown[0]
 
 	// Respond with the transaction
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(transaction)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 	}
 }
 
-// @Summary		Get transactions by offered user and status
-// @Description	Get all transactions for a given user and status
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			user_id	path		int		true	"User ID"
-// @Param			status	path		string	true	"Status of the transaction"
-// @Success		200		{array}		Services.Transaction
-// @Failure		400		{object}	http.ResponseError
-// @Failure		500		{object}	http.ResponseError
-// @Router			/transactions/offered/{user_id}/{status} [get]
+// getTransactionsByOfferedUserAndStatus handles the request to get transactions by offered user and status.
+// Users only list their own transactions.
 func (app *application) getTransactionsByOfferedUserAndStatus(w http.ResponseWriter, r *http.Request) {
 	// Get user ID and optional status from query parameters
-	userIDStr := chi.URLParam(r, "user_id")
 	status := chi.URLParam(r, "status")
 
-	userID, err := strconv.Atoi(userIDStr)
+	userID, err := ownUserParam(r, "user_id")
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Retrieve transactions by user and status
 	transactions, err := app.Service.Transactions.GetByOfferedUserAndStatus(r.Context(), userID, status)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
+	}
+	currency, err := app.viewerCurrency(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.displayPrices(r.Context(), currency, transactions)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -131,36 +205,36 @@ func (app *application) getTransactionsByOfferedUserAndStatus(w http.ResponseWri
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(transactions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 	}
 }
 
-// @Summary		Get transactions by offering user and status
-// @Description	Get all transactions where the user offered the service and status
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			user_id	path		int		true	"User ID"
-// @Param			status	path		string	true	"Status of the transaction"
-// @Success		200		{array}		Services.Transaction
-// @Failure		400		{object}	http.ResponseError
-// @Failure		500		{object}	http.ResponseError
-// @Router			/transactions/offering/{user_id}/{status} [get]
+// getTransactionsByOfferingUserAndStatus handles the request to get transactions by offering user and status.
+// Users only list their own transactions.
 func (app *application) getTransactionsByOfferingUserAndStatus(w http.ResponseWriter, r *http.Request) {
 	// Get user ID and optional status from query parameters
-	userIDStr := chi.URLParam(r, "user_id")
 	status := chi.URLParam(r, "status")
 
-	userID, err := strconv.Atoi(userIDStr)
+	userID, err := ownUserParam(r, "user_id")
 	if err != nil {
-		http.Error(w, "Invalid user ID "+err.Error(), http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Retrieve transactions by user and status
 	transactions, err := app.Service.Transactions.GetByOfferingUserAndStatus(r.Context(), userID, status)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
+	}
+	currency, err := app.viewerCurrency(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.displayPrices(r.Context(), currency, transactions)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -168,36 +242,50 @@ func (app *application) getTransactionsByOfferingUserAndStatus(w http.ResponseWr
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(transactions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 	}
 }
 
-// @Summary		Get transactions by listing ID and status
-// @Description	Get all transactions related to a specific listing and status
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			listing_id	path		int		true	"Listing ID"
-// @Param			status		path		string	true	"Status of the transaction"
-// @Success		200			{array}		Services.Transaction
-// @Failure		400			{object}	http.ResponseError
-// @Failure		500			{object}	http.ResponseError
-// @Router			/transactions/listing/{listing_id}/{status} [get]
+// getTransactionsByListingAndStatus handles the request to get transactions by listing ID and status.
+// Only the owner of the listing lists its transactions.
 func (app *application) getTransactionsByListingAndStatus(w http.ResponseWriter, r *http.Request) {
 	// Get listing ID and optional status from query parameters
-	listingIDStr := chi.URLParam(r, "listing_id")
 	status := chi.URLParam(r, "status")
 
-	listingID, err := strconv.Atoi(listingIDStr)
+	listingID, err := intParam(r, "listing_id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	tokenUserID, err := authUserID(r)
 	if err != nil {
-		http.Error(w, "Invalid listing ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
+		return
+	}
+	listing, err := app.Service.Listings.GetByID(r.Context(), listingID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if listing.UserID != tokenUserID {
+		app.respondError(w, r, fmt.Errorf("cannot see the transactions of another user's listing: %w", Services.ErrForbidden))
 		return
 	}
 
 	// Retrieve transactions by listing and status
 	transactions, err := app.Service.Transactions.GetByListingAndStatus(r.Context(), listingID, status)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
+	}
+	currency, err := app.viewerCurrency(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.displayPrices(r.Context(), currency, transactions)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -205,105 +293,150 @@ func (app *application) getTransactionsByListingAndStatus(w http.ResponseWriter,
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(transactions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 	}
 }
 
-// @Summary		Update an existing transaction
-// @Description	Update details of an existing transaction
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			id			path	int						true	"Transaction ID"
-// @Param			transaction	body	Services.Transaction	true	"Updated transaction data"
-// @Success		204
-// @Failure		400	{object}	http.ResponseError
-// @Failure		401	{object}	http.ResponseError
-// @Failure		500	{object}	http.ResponseError
-// @Router			/transactions/{id} [put]
+// updateTransaction handles the request to update an existing transaction.
 func (app *application) updateTransaction(w http.ResponseWriter, r *http.Request) {
 	// Get transaction ID from URL parameter
-	transactionIDStr := chi.URLParam(r, "id")
-	transactionID, err := strconv.Atoi(transactionIDStr)
+	transactionID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
-	// Decode the updated transaction details from the request body
-	var transaction Services.Transaction
-	err = json.NewDecoder(r.Body).Decode(&transaction)
+	// Decode the new status and rating from the request body
+	var body transactionUpdate
+	err = decodeJSON(r, &body)
 	if err != nil {
-		http.Error(w, "Failed to decode request body: "+err.Error(), http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
-	// Ensure the user is authorized
-	tokenUserID, ok := r.Context().Value("token_user_id").(int)
-	if !ok || transaction.UserOfferedID != tokenUserID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Ensure the user is authorized against the stored parties
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	stored, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction := stored
+	if body.Status != "" {
+		transaction.Status = body.Status
+	}
+	if body.Rating != 0 {
+		transaction.Rating = body.Rating
+	}
+	err = checkTransactionParty(stored, transaction, tokenUserID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	// The client rates the tradesman once the job is done, and only once
+	if body.Rating != 0 && transaction.Status != "Completed" {
+		app.respondError(w, r, Services.Invalid("rating", "can only be given on a Completed transaction"))
+		return
+	}
+	if body.Rating != 0 && stored.Rating != 0 {
+		app.respondError(w, r, fmt.Errorf("the job was already rated: %w", Services.ErrConflict))
+		return
+	}
+
+	err = Services.CheckTransition(stored.Status, transaction.Status)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	err = app.checkMilestones(r.Context(), stored, transaction)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	movement, err := app.paymentMovement(r.Context(), stored, transaction)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
-	// Update the transaction
-	err = app.Service.Transactions.Update(r.Context(), transactionID, transaction)
+	// The status only changes from the one read above, and the deposit moves with it, so a
+	// declined payment leaves the transaction as it was and concurrent updates move no money twice
+	err = app.Service.Transactions.Advance(r.Context(), stored, transaction, movement, app.config.payments.feePercent)
 	if err != nil {
-		http.Error(w, "Failed to update transaction: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
+	// The exchange rates of the day are kept with an accepted transaction
+	if transaction.Status == "Accepted" && stored.Status != "Accepted" {
+		err = app.recordRates(r.Context(), stored, transaction)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+
+	// A completed job fills the listing it was for and is invoiced
+	if transaction.Status == "Completed" {
+		err = app.finishTransaction(r.Context(), transactionID, stored.ListingID)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+
 	// Respond with success
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// @Summary		Delete a transaction
-// @Description	Delete a transaction by its ID
-// @Tags			transactions
-// @Accept			json
-// @Produce		json
-// @Param			id	path	int	true	"Transaction ID"
-// @Success		204
-// @Failure		400	{object}	http.ResponseError
-// @Failure		401	{object}	http.ResponseError
-// @Failure		404	{object}	http.ResponseError
-// @Failure		500	{object}	http.ResponseError
-// @Router			/transactions/{id} [delete]
+// deleteTransaction handles the request to delete a transaction.
 func (app *application) deleteTransaction(w http.ResponseWriter, r *http.Request) {
 	// Get transaction ID from URL parameter
-	transactionIDStr := chi.URLParam(r, "id")
-	transactionID, err := strconv.Atoi(transactionIDStr)
+	transactionID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Ensure the user is authorized
-	tokenUserID, ok := r.Context().Value("token_user_id").(int)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Retrieve the transaction to ensure ownership
 	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
 	if err != nil {
-		if err.Error() == "transaction not found" {
-			http.Error(w, "Transaction not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Failed to retrieve transaction: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	if transaction.UserOfferedID != tokenUserID && transaction.UserOfferingID != tokenUserID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		app.respondError(w, r, fmt.Errorf("cannot delete a transaction you are not part of: %w", Services.ErrForbidden))
+		return
+	}
+
+	// A deleted transaction could never be settled, so its deposit must be refunded first
+	payment, err := app.Service.Payments.GetByTransaction(r.Context(), transactionID)
+	if err == nil && payment.Status == Services.PaymentHeld {
+		err = fmt.Errorf("cancel the transaction to refund its deposit before deleting it: %w", Services.ErrConflict)
+	}
+	if err != nil && !errors.Is(err, Services.ErrNotFound) {
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Delete the transaction
 	err = app.Service.Transactions.Delete(r.Context(), transactionID)
 	if err != nil {
-		http.Error(w, "Failed to delete transaction: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -311,60 +444,114 @@ func (app *application) deleteTransaction(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (app *application) createTransactionContract(w http.ResponseWriter, r *http.Request) {
-	transactionIDStr := chi.URLParam(r, "id")
+// restoreTransaction handles the request to undo the deletion of a transaction the caller is part of, within the grace period.
+func (app *application) restoreTransaction(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	// Transactions of other users are reported as not found, like those deleted too long ago
+	err = app.Service.Transactions.Restore(r.Context(), transactionID, tokenUserID, app.config.retention.restoreWithin)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionID)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(transaction)
+	if err != nil {
+		app.respondError(w, r, err)
+	}
+}
 
-	transactionId, err := strconv.Atoi(transactionIDStr)
+// contractResponse carries a transaction's contract data and the generated contracts
+type contractResponse struct {
+	ContractData    ContractData `json:"contract_data"`
+	EnglishContract string       `json:"english_contract"`
+	ArabicContract  string       `json:"arabic_contract"`
+}
+
+// createTransactionContract handles the request to generate the contracts of a transaction for one of its
+// parties. Each party's phone number is only filled in if the privacy settings show it to the caller.
+func (app *application) createTransactionContract(w http.ResponseWriter, r *http.Request) {
+	transaction, err := app.partyTransaction(r)
 	if err != nil {
-		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
+	transactionId := transaction.TransactionID
 
 	// Read the contract templates
 	tempEng, err := Utils.ReadFileAsString("./Texts/EnglishContract.txt")
-	tempAr, err := Utils.ReadFileAsString("./Texts/ArabicContract.txt")
 	if err != nil {
-		http.Error(w, "Error reading contract templates: "+err.Error(), http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
-
-	// Retrieve the transaction, listing, and users
-	transaction, err := app.Service.Transactions.GetByID(r.Context(), transactionId)
+	tempAr, err := Utils.ReadFileAsString("./Texts/ArabicContract.txt")
 	if err != nil {
-		http.Error(w, "Failed to retrieve transaction: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
+	// Retrieve the listing and users
 	listing, err := app.Service.Listings.GetByID(r.Context(), transaction.ListingID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve listing: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	offeredUser, err := app.Service.Users.GetById(r.Context(), transaction.UserOfferedID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve offered user: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	offeringUser, err := app.Service.Users.GetById(r.Context(), transaction.UserOfferingID)
 	if err != nil {
-		http.Error(w, "Failed to retrieve offering user: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
+		return
+	}
+
+	// The parties are seen as the caller may see them, like their profiles
+	profiles, err := app.profiles(r, []Services.User{offeredUser, offeringUser})
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	client, tradesman := profiles[0], profiles[1]
+
+	milestones, err := app.Service.Milestones.GetByTransaction(r.Context(), transactionId)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Fill contract data
 	contractData := ContractData{
-		TradesmanFirstName:  offeringUser.FirstName,
-		TradesmanLastName:   offeringUser.LastName,
-		TradesmanPhone:      offeringUser.PhoneNumber,
-		TradesmanLocation:   offeringUser.LocDetails.Country,
-		TradesmanLocDetails: offeringUser.LocDetails.City,
-		ClientFirstName:     offeredUser.FirstName,
-		ClientLastName:      offeredUser.LastName,
-		ClientPhone:         offeredUser.PhoneNumber,
-		ClientLocation:      offeredUser.LocDetails.Country,
-		ClientLocDetails:    offeredUser.LocDetails.City,
+		TradesmanFirstName:  tradesman.FirstName,
+		TradesmanLastName:   tradesman.LastName,
+		TradesmanPhone:      tradesman.PhoneNumber,
+		TradesmanLocation:   tradesman.LocDetails.Country,
+		TradesmanLocDetails: tradesman.LocDetails.City,
+		ClientFirstName:     client.FirstName,
+		ClientLastName:      client.LastName,
+		ClientPhone:         client.PhoneNumber,
+		ClientLocation:      client.LocDetails.Country,
+		ClientLocDetails:    client.LocDetails.City,
 		ListingType:         listing.Type,
 		ListingTitle:        listing.Title,
 		ListingDescription:  listing.Description,
@@ -377,27 +564,24 @@ func (app *application) createTransactionContract(w http.ResponseWriter, r *http
 		DateCreated:         transaction.DateCreated,
 		DetailsFromOffering: transaction.DetailsFromOffering,
 		DetailsFromOffered:  transaction.DetailsFromOffered,
+		Milestones:          milestones,
 	}
 
 	// Generate the English and Arabic contracts using the templates
 	engCont, err := GenerateContract(tempEng, contractData)
 	if err != nil {
-		http.Error(w, "Error generating English contract: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	arCont, err := GenerateContract(tempAr, contractData)
 	if err != nil {
-		http.Error(w, "Error generating Arabic contract: "+err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Create a response structure with contract data and generated contracts
-	response := struct {
-		ContractData    ContractData `json:"contract_data"`
-		EnglishContract string       `json:"english_contract"`
-		ArabicContract  string       `json:"arabic_contract"`
-	}{
+	response := contractResponse{
 		ContractData:    contractData,
 		EnglishContract: engCont,
 		ArabicContract:  arCont,
@@ -431,6 +615,7 @@ type ContractData struct {
 	DateCreated         string
 	DetailsFromOffering string
 	DetailsFromOffered  string
+	Milestones          []Services.Milestone
 }
 
 func GenerateContract(templateStr string, contractData ContractData) (string, error) {
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type transactionFixture struct {
+	s           *testServer
+	client      Services.User
+	clientToken string
+	tradesman   Services.User
+	tradesToken string
+	listing     Services.Listing
+	transaction Services.Transaction
+}
+
+// seedTransaction creates a client who sends an offer on a tradesman's listing
+func seedTransaction(t *testing.T) transactionFixture {
+	s := newTestServer(t)
+	client, clientToken := s.createUser("Client", "+96170000001")
+	tradesman, tradesToken := s.createUser("Tradesman", "+96170000002")
+	listing := s.createListing(tradesman.UserID, "Offer", "Tiling", 35.5, 33.9)
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/transaction/create", map[string]interface{}{
+		"user_offered_id":      client.UserID,
+		"user_offering_id":     tradesman.UserID,
+		"listing_id":           listing.ListingID,
+		"price_with_currency":  150.5,
+		"currency_code":        "USD",
+		"job_start_date":       "2025-01-10",
+		"job_end_date":         "2025-01-20",
+		"details_from_offered": "Kitchen floor",
+	}, clientToken)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var transaction Services.Transaction
+	decode(t, rec, &transaction)
+
+	return transactionFixture{s, client, clientToken, tradesman, tradesToken, listing, transaction}
+}
+
+func decodeTransactions(t *testing.T, rec *httptest.ResponseRecorder) []Services.Transaction {
+	t.Helper()
+	expectStatus(t, rec, http.StatusOK)
+
+	var transactions []Services.Transaction
+	decode(t, rec, &transactions)
+	return transactions
+}
+
+func TestCreateTransaction(t *testing.T) {
+	f := seedTransaction(t)
+	if f.transaction.TransactionID == 0 || f.transaction.Status != "Pending" {
+		t.Fatalf("unexpected transaction %+v", f.transaction)
+	}
+
+	forged := f.transaction
+	forged.UserOfferedID = f.tradesman.UserID
+	expectStatus(t, f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", forged, f.clientToken), http.StatusForbidden)
+
+	// The offer names the owner of a published listing as the tradesman
+	victim, _ := f.s.createUser("Victim", "+96170000003")
+	for _, offer := range []struct {
+		tradesmanID, listingID, status int
+	}{
+		{victim.UserID, f.listing.ListingID, http.StatusBadRequest},
+		{f.client.UserID, f.listing.ListingID, http.StatusBadRequest},
+		{f.tradesman.UserID, 999, http.StatusNotFound},
+	} {
+		forged := f.transaction
+		forged.UserOfferingID, forged.ListingID = offer.tradesmanID, offer.listingID
+		expectStatus(t, f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", forged, f.clientToken), offer.status)
+	}
+	expectStatus(t, f.s.do(http.MethodPut, "/api/v1/listing/status/"+strconv.Itoa(f.listing.ListingID)+"/"+Services.ListingPaused, nil, "", f.tradesToken), http.StatusOK)
+	expectStatus(t, f.s.doJSON(http.MethodPost, "/api/v1/transaction/create", f.transaction, f.clientToken), http.StatusBadRequest)
+}
+
+func TestGetTransactionByID(t *testing.T) {
+	f := seedTransaction(t)
+
+	rec := f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	var got Services.Transaction
+	decode(t, rec, &got)
+	if got.Price != 150.5 {
+		t.Fatalf("unexpected transaction %+v", got)
+	}
+
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/999", nil, "", f.clientToken), http.StatusNotFound)
+}
+
+func TestGetTransactionsByUserAndStatus(t *testing.T) {
+	f := seedTransaction(t)
+
+	offered := decodeTransactions(t, f.s.do(http.MethodGet, "/api/v1/transaction/offered/"+strconv.Itoa(f.client.UserID)+"/Pending", nil, "", f.clientToken))
+	if len(offered) != 1 {
+		t.Fatalf("expected 1 offered transaction, got %+v", offered)
+	}
+
+	offering := decodeTransactions(t, f.s.do(http.MethodGet, "/api/v1/transaction/offering/"+strconv.Itoa(f.tradesman.UserID)+"/Completed", nil, "", f.tradesToken))
+	if len(offering) != 0 {
+		t.Fatalf("expected no completed transactions, got %+v", offering)
+	}
+
+	byListing := decodeTransactions(t, f.s.do(http.MethodGet, "/api/v1/transaction/listing/"+strconv.Itoa(f.listing.ListingID)+"/all", nil, "", f.tradesToken))
+	if len(byListing) != 1 {
+		t.Fatalf("expected 1 transaction on listing, got %+v", byListing)
+	}
+}
+
+func TestTransactionsOnlyShownToParties(t *testing.T) {
+	f := seedTransaction(t)
+	_, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	id := strconv.Itoa(f.transaction.TransactionID)
+
+	for _, path := range []string{
+		"/api/v1/transaction/transactionId/" + id,
+		"/api/v1/transaction/contract/" + id,
+		"/api/v1/transaction/offered/" + strconv.Itoa(f.client.UserID) + "/all",
+		"/api/v1/transaction/offering/" + strconv.Itoa(f.tradesman.UserID) + "/all",
+		"/api/v1/transaction/listing/" + strconv.Itoa(f.listing.ListingID) + "/all",
+	} {
+		expectStatus(t, f.s.do(http.MethodGet, path, nil, "", outsiderToken), http.StatusForbidden)
+	}
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+id, nil, "", f.tradesToken), http.StatusOK)
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/offered/"+strconv.Itoa(f.client.UserID)+"/all", nil, "", f.tradesToken), http.StatusForbidden)
+	// Only the owner of the listing lists all of its transactions
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/listing/"+strconv.Itoa(f.listing.ListingID)+"/all", nil, "", f.clientToken), http.StatusForbidden)
+
+	// Phone numbers in the contract follow the privacy settings, as on profiles
+	contract := func(token string) ContractData {
+		t.Helper()
+		rec := f.s.do(http.MethodGet, "/api/v1/transaction/contract/"+id, nil, "", token)
+		expectStatus(t, rec, http.StatusOK)
+		var response contractResponse
+		decode(t, rec, &response)
+		return response.ContractData
+	}
+	if pending := contract(f.clientToken); pending.ClientPhone != f.client.PhoneNumber || pending.TradesmanPhone != "" {
+		t.Fatalf("expected only the caller's own phone before acceptance, got %+v", pending)
+	}
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	if accepted := contract(f.tradesToken); accepted.ClientPhone != f.client.PhoneNumber || accepted.TradesmanPhone != f.tradesman.PhoneNumber {
+		t.Fatalf("expected both phones once accepted, got %+v", accepted)
+	}
+}
+
+func TestUpdateTransaction(t *testing.T) {
+	f := seedTransaction(t)
+	updated := f.transaction
+	updated.Status = "Accepted"
+	path := "/api/v1/transaction/update/" + strconv.Itoa(f.transaction.TransactionID)
+
+	// Only the tradesman accepts the client's offer, and the status is all it takes
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, updated, f.clientToken), http.StatusForbidden)
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, transactionUpdate{Status: "Accepted"}, f.tradesToken), http.StatusNoContent)
+	if payment := f.payment(t); payment.Status != Services.PaymentHeld || payment.Amount != 150.5 {
+		t.Fatalf("expected the price held, got %+v", payment)
+	}
+
+	// and only the client completes and rates the job
+	updated.Status, updated.Rating = "Completed", 5
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, updated, f.tradesToken), http.StatusForbidden)
+
+	stored, _ := f.s.app.Service.Transactions.GetByID(context.Background(), f.transaction.TransactionID)
+	if stored.Status != "Accepted" {
+		t.Fatalf("expected Accepted, got %+v", stored)
+	}
+}
+
+func TestUpdateTransactionByOutsider(t *testing.T) {
+	f := seedTransaction(t)
+	outsider, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	path := "/api/v1/transaction/update/" + strconv.Itoa(f.transaction.TransactionID)
+
+	// Naming themselves as the client in the body does not make an outsider a party
+	for _, status := range []string{"Cancelled", "Completed"} {
+		forged := f.transaction
+		forged.UserOfferedID, forged.Status = outsider.UserID, status
+		expectStatus(t, f.s.doJSON(http.MethodPut, path, forged, outsiderToken), http.StatusForbidden)
+	}
+
+	stored, _ := f.s.app.Service.Transactions.GetByID(context.Background(), f.transaction.TransactionID)
+	if stored.Status != "Accepted" || stored.UserOfferedID != f.client.UserID {
+		t.Fatalf("expected the transaction untouched, got %+v", stored)
+	}
+	if payment := f.payment(t); payment.Status != Services.PaymentHeld || f.s.payments.Held() != 150.5 {
+		t.Fatalf("expected the deposit still held, got %+v", payment)
+	}
+}
+
+func TestDeleteTransaction(t *testing.T) {
+	f := seedTransaction(t)
+	_, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	path := "/api/v1/transaction/delete/" + strconv.Itoa(f.transaction.TransactionID)
+
+	expectStatus(t, f.s.do(http.MethodDelete, path, nil, "", outsiderToken), http.StatusForbidden)
+	expectStatus(t, f.s.do(http.MethodDelete, path, nil, "", f.tradesToken), http.StatusNoContent)
+	expectStatus(t, f.s.do(http.MethodDelete, path, nil, "", f.tradesToken), http.StatusNotFound)
+}
+
+func TestRestoreTransaction(t *testing.T) {
+	f := seedTransaction(t)
+	_, outsiderToken := f.s.createUser("Outsider", "+96170000003")
+	id := strconv.Itoa(f.transaction.TransactionID)
+
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/transaction/delete/"+id, nil, "", f.tradesToken), http.StatusNoContent)
+	rec := f.s.do(http.MethodGet, "/api/v1/transaction/offering/"+strconv.Itoa(f.tradesman.UserID)+"/all", nil, "", f.tradesToken)
+	if transactions := decodeTransactions(t, rec); len(transactions) != 0 {
+		t.Fatalf("deleted transaction is still listed: %+v", transactions)
+	}
+
+	// Either party may restore it, as either could delete it
+	path := "/api/v1/transaction/restore/" + id
+	expectStatus(t, f.s.do(http.MethodPost, path, nil, "", outsiderToken), http.StatusNotFound)
+	rec = f.s.do(http.MethodPost, path, nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+	var restored Services.Transaction
+	decode(t, rec, &restored)
+	if restored.TransactionID != f.transaction.TransactionID || restored.DeletedAt != "" {
+		t.Fatalf("unexpected restored transaction %+v", restored)
+	}
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+id, nil, "", f.clientToken), http.StatusOK)
+}
+
+func TestDeleteListingWithTransactions(t *testing.T) {
+	f := seedTransaction(t)
+
+	path := "/api/v1/listing/delete/" + strconv.Itoa(f.listing.ListingID)
+	expectStatus(t, f.s.do(http.MethodDelete, path, nil, "", f.tradesToken), http.StatusNoContent)
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken), http.StatusOK)
+}
+
+func TestCreateTransactionContract(t *testing.T) {
+	f := seedTransaction(t)
+
+	rec := f.s.do(http.MethodGet, "/api/v1/transaction/contract/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken)
+	expectStatus(t, rec, http.StatusOK)
+
+	var response struct {
+		ContractData    ContractData `json:"contract_data"`
+		EnglishContract string       `json:"english_contract"`
+		ArabicContract  string       `json:"arabic_contract"`
+	}
+	decode(t, rec, &response)
+	if response.ContractData.ClientFirstName != "Client" || !strings.Contains(response.EnglishContract, "Tiling") {
+		t.Fatalf("unexpected contract %+v", response)
+	}
+}
+
+func TestRateTransaction(t *testing.T) {
+	f := seedTransaction(t)
+	path := "/api/v1/transaction/update/" + strconv.Itoa(f.transaction.TransactionID)
+
+	rated := f.transaction
+	rated.Rating = 4
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, rated, f.clientToken), http.StatusBadRequest)
+
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+	rated.Status = "Completed"
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, rated, f.clientToken), http.StatusNoContent)
+
+	profile := getProfile(t, f.s, f.tradesman.UserID, "")
+	if profile.Rating.Count != 1 || profile.Rating.Average != 4 {
+		t.Fatalf("expected a single 4 star rating, got %+v", profile.Rating)
+	}
+
+	rated.Rating = 6
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, rated, f.clientToken), http.StatusBadRequest)
+
+	// A rating stays as it was first given
+	rated.Rating = 1
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, rated, f.clientToken), http.StatusConflict)
+	if profile := getProfile(t, f.s, f.tradesman.UserID, ""); profile.Rating.Count != 1 || profile.Rating.Average != 4 {
+		t.Fatalf("expected the first rating to stay, got %+v", profile.Rating)
+	}
+}
+
+func TestRatingNeedsAcceptedOffer(t *testing.T) {
+	f := seedTransaction(t)
+	path := "/api/v1/transaction/update/" + strconv.Itoa(f.transaction.TransactionID)
+
+	// The client cannot skip the tradesman's acceptance to rate them
+	rated := f.transaction
+	rated.Status, rated.Rating = "Completed", 1
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, rated, f.clientToken), http.StatusConflict)
+	rated.Status = "Accepted"
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, rated, f.clientToken), http.StatusForbidden)
+	if profile := getProfile(t, f.s, f.tradesman.UserID, ""); profile.Rating.Count != 0 {
+		t.Fatalf("expected no rating, got %+v", profile.Rating)
+	}
+}
+
+func TestTransactionStatusTransitions(t *testing.T) {
+	f := seedTransaction(t)
+
+	// A job is accepted before it is completed, and final statuses stay final
+	expectStatus(t, f.setStatus("Completed"), http.StatusConflict)
+	expectStatus(t, f.setStatus("Cancelled"), http.StatusNoContent)
+	for _, status := range []string{"Pending", "Accepted", "Completed"} {
+		if problem := decodeProblem(t, f.setStatus(status), http.StatusConflict); problem.Code != "conflict" {
+			t.Fatalf("unexpected problem %+v", problem)
+		}
+	}
+	if _, err := f.s.app.Service.Invoices.GetByTransaction(context.Background(), f.transaction.TransactionID); !errors.Is(err, Services.ErrNotFound) {
+		t.Fatalf("expected no invoice for a cancelled transaction, got %v", err)
+	}
+}
+
+func TestCompletingTransactionClosesListing(t *testing.T) {
+	f := seedTransaction(t)
+	owner, _ := f.s.createUser("Other", "+96170000003")
+	other := f.s.createListing(owner.UserID, "Offer", "Painting", 35.5, 33.9)
+	expectStatus(t, f.setStatus("Accepted"), http.StatusNoContent)
+
+	// The listing named in the body is ignored, only the transaction's own listing closes
+	updated := f.transaction
+	updated.Status, updated.ListingID = "Completed", other.ListingID
+	path := "/api/v1/transaction/update/" + strconv.Itoa(f.transaction.TransactionID)
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, updated, f.clientToken), http.StatusNoContent)
+
+	listing, _ := f.s.app.Service.Listings.GetByID(context.Background(), f.listing.ListingID)
+	if listing.Status != Services.ListingClosed || listing.Active {
+		t.Fatalf("expected the listing to close, got %+v", listing)
+	}
+	if untouched, _ := f.s.app.Service.Listings.GetByID(context.Background(), other.ListingID); untouched.Status == Services.ListingClosed {
+		t.Fatalf("expected the other listing to stay open, got %+v", untouched)
+	}
+
+	// Completing again leaves the closed listing alone
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, updated, f.clientToken), http.StatusNoContent)
+}
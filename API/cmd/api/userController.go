@@ -1,245 +1,241 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Env"
 	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
 	"github.com/go-chi/chi/v5"
 	"net/http"
-	"strconv"
+	"os"
+	"path/filepath"
+	"time"
 )
 
-// GetAllUsers godoc
-//	@Summary		Get all users
-//	@Description	Retrieve a list of all users in the system
-//	@Tags			users
-//	@Produce		json
-//	@Success		200	{array}		Services.User
-//	@Failure		500	{object}	string	"Internal Server Error"
-//	@Router			/user/users [get]
+// GetAllUsers handles the request to get all users.
 func (app *application) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	// Call the service method to get all users.
 	users, err := app.Service.Users.GetAll(r.Context())
 	if err != nil {
-		// If there's an error, respond with an internal server error status and message.
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// Map the service error onto a problem response.
+		app.respondError(w, r, err)
+		return
+	}
+
+	// Show each user as the caller may see them
+	profiles, err := app.profiles(r, users)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Set the appropriate response header.
 	w.Header().Set("Content-Type", "application/json")
 
-	// Encode the users slice into JSON and send it as the response.
-	if err := json.NewEncoder(w).Encode(users); err != nil {
-		// If encoding fails, respond with an internal server error status and message.
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Encode the profiles into JSON and send them as the response.
+	if err := json.NewEncoder(w).Encode(profiles); err != nil {
+		// If encoding fails, log it and report an internal error.
+		app.respondError(w, r, err)
 	}
 }
 
-// GetUserById godoc
-//	@Summary		Get user by ID
-//	@Description	Retrieve user information by their unique ID
-//	@Tags			users
-//	@Param			id	path	int	true	"User ID"
-//	@Produce		json
-//	@Success		200	{object}	Services.User
-//	@Failure		400	{object}	string	"Bad Request"
-//	@Failure		404	{object}	string	"User not found"
-//	@Failure		500	{object}	string	"Internal Server Error"
-//	@Router			/user/userId/{id} [get]
+// GetUserById handles the request to get a user by ID.
 func (app *application) GetUserById(w http.ResponseWriter, r *http.Request) {
 	// Extract the user ID from the URL (e.g., /user/123)
-	userId := chi.URLParam(r, "id")
-
-	// Convert the userId from string to int
-	id, err := strconv.Atoi(userId)
+	id, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
-	// Call the GetById method from the UserService
+	// Call the GetById method from the UserService, which reports unknown IDs as not found
 	user, err := app.Service.Users.GetById(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
-	if user.UserID == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	profiles, err := app.profiles(r, []Services.User{user})
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
+	if viewerID, _ := authUserID(r); viewerID != id {
+		app.track(Services.EventProfileVisit, id, 0)
+	}
 
-	// Return the user as JSON response
-	err = json.NewEncoder(w).Encode(user)
+	// Return the profile as JSON response
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(profiles[0])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 }
 
-// GetUserByName godoc
-//	@Summary		Get users by name
-//	@Description	Retrieve users with matching name
-//	@Tags			users
-//	@Param			name	path	string	true	"User Name"
-//	@Produce		json
-//	@Success		200	{array}		Services.User
-//	@Failure		404	{object}	string	"No users found"
-//	@Failure		500	{object}	string	"Internal Server Error"
-//	@Router			/user/userName/{name} [get]
+// GetUserByName handles the request to get users by name.
 func (app *application) GetUserByName(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
 
 	// Call the service to get users by name
 	users, err := app.Service.Users.GetByName(r.Context(), name)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Respond with the list of users
 	if len(users) == 0 {
-		http.Error(w, "No users found", http.StatusNotFound)
+		app.respondError(w, r, fmt.Errorf("no users %w", Services.ErrNotFound))
+		return
+	}
+
+	profiles, err := app.profiles(r, users)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
-	// Return the users in JSON format
+	// Return the profiles in JSON format
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(users)
+	err = json.NewEncoder(w).Encode(profiles)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 }
 
-// CreateUser godoc
-//	@Summary		Create a new user
-//	@Description	Add a new user to the system
-//	@Tags			users
-//	@Accept			json
-//	@Produce		json
-//	@Param			user	body		Services.User	true	"User data"
-//	@Success		201		{object}	Services.User
-//	@Failure		400		{object}	string	"Bad Request"
-//	@Failure		500		{object}	string	"Internal Server Error"
-//	@Router			/user/create [post]
+// profiles returns the users as the caller may see them. Anonymous callers and
+// strangers get the public view, counterparties of an Accepted transaction see
+// what the user shares with them, and users see all of their own profile.
+func (app *application) profiles(r *http.Request, users []Services.User) ([]Services.Profile, error) {
+	// Routes behind OptionalAuth have no user in the context for anonymous callers
+	viewerID, _ := authUserID(r)
+
+	counterparties := map[int]bool{}
+	if viewerID != 0 {
+		ids, err := app.Service.Transactions.Counterparties(r.Context(), viewerID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			counterparties[id] = true
+		}
+	}
+
+	profiles := make([]Services.Profile, 0, len(users))
+	for _, user := range users {
+		relationship := Services.Stranger
+		if user.UserID == viewerID {
+			relationship = Services.Self
+		} else if counterparties[user.UserID] {
+			relationship = Services.Counterparty
+		}
+		profile := user.Profile(relationship)
+
+		rating, err := app.Service.Transactions.Rating(r.Context(), user.UserID)
+		if err != nil {
+			return nil, err
+		}
+		profile.Rating = rating
+
+		portfolio, err := app.Service.Images.GetImagesByUserProfile(r.Context(), user.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if portfolio != nil {
+			profile.Portfolio = portfolio
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// CreateUser handles the request to create a new user.
 func (app *application) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var user Services.User
 
 	// Decode the JSON request body into the User struct
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := decodeJSON(r, &user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Call the service to create the user
 	err = app.Service.Users.Create(r.Context(), &user)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Return the created user as a response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(user)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	json.NewEncoder(w).Encode(user)
 }
 
-// DeleteUser godoc
-//	@Summary		Delete a user
-//	@Description	Remove a user from the system by their ID
-//	@Tags			users
-//	@Param			id	path	int	true	"User ID"
-//	@Security		BearerAuth
-//	@Success		204	"No Content"
-//	@Failure		400	{object}	string	"Bad Request"
-//	@Failure		401	{object}	string	"Unauthorized"
-//	@Failure		404	{object}	string	"User not found"
-//	@Failure		500	{object}	string	"Internal Server Error"
-//	@Router			/user/delete/{id} [delete]
+// DeleteUser handles the request to close a user's account.
 func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	// Retrieve the user_id from the request context
-	tokenUserID, ok := r.Context().Value("token_user_id").(int)
-
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Extract the user ID from the URL parameters
-	userIDStr := chi.URLParam(r, "id")
-	userID, err := strconv.Atoi(userIDStr)
+	userID, err := intParam(r, "id")
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	if tokenUserID != userID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		app.respondError(w, r, fmt.Errorf("cannot delete another user: %w", Services.ErrForbidden))
 		return
 	}
 
-	// Call the service to delete the user and get a confirmation
-	deleted, err := app.Service.Users.Delete(r.Context(), userID)
+	// Close the account; its transactions stay, pointing at the anonymised user
+	err = app.Service.Users.Close(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
-	if !deleted {
-		http.Error(w, "User not found or already deleted", http.StatusNotFound)
-		return
-	}
-
-	// Respond with success if the user was deleted
+	// Respond with success if the account was closed
 	w.WriteHeader(http.StatusNoContent) // 204 No Content for a successful delete with no body
 }
 
-// UpdateUser godoc
-//	@Summary		Update a user
-//	@Description	Update user information by their ID
-//	@Tags			users
-//	@Param			id		path	int				true	"User ID"
-//	@Param			user	body	Services.User	true	"Updated user data"
-//	@Security		BearerAuth
-//	@Success		200	"User updated successfully"
-//	@Failure		400	{object}	string	"Bad Request"
-//	@Failure		401	{object}	string	"Unauthorized"
-//	@Failure		500	{object}	string	"Internal Server Error"
-//	@Router			/user/update/{id} [put]
+// UpdateUser handles the request to update a user.
 func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var user Services.User
 
 	// Retrieve the user_id from the request context
-	tokenUserID, ok := r.Context().Value("token_user_id").(int)
-
-	// Extract the user ID from the URL parameters
-	userIDStr := chi.URLParam(r, "id")
-	userID, err := strconv.Atoi(userIDStr)
+	tokenUserID, err := authUserID(r)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
-	if tokenUserID != userID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	// Extract the user ID from the URL parameters
+	userID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
-	if !ok {
-		http.Error(w, "User ID not found in token", http.StatusUnauthorized)
+	if tokenUserID != userID {
+		app.respondError(w, r, fmt.Errorf("cannot update another user: %w", Services.ErrForbidden))
 		return
 	}
 
 	// Parse the request body into the User struct
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+	if err := decodeJSON(r, &user); err != nil {
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -248,7 +244,7 @@ func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// Call the service to update the user
 	err = app.Service.Users.Update(r.Context(), &user)
 	if err != nil {
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -257,35 +253,170 @@ func (app *application) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User updated successfully"))
 }
 
-// authUser godoc
-//	@Summary		Authenticate user
-//	@Description	Generate a JWT token for the user
-//	@Tags			users
-//	@Accept			json
-//	@Produce		json
-//	@Param			credentials	body		object					true	"User credentials"
-//	@Success		200			{object}	map[string]interface{}	"Token and user data"
-//	@Failure		400			{object}	string					"Bad Request"
-//	@Failure		401			{object}	string					"Unauthorized"
-//	@Failure		500			{object}	string					"Internal Server Error"
-//	@Router			/user/auth [post]
-func (app *application) authUser(w http.ResponseWriter, r *http.Request) {
-	var authRequest struct {
-		PhoneNumber string `json:"phone_number"`
-		Password    string `json:"password"`
+// accountExport is the data.json of an account export, everything stored about a user
+type accountExport struct {
+	ExportedAt    string                   `json:"exported_at"`
+	User          Services.User            `json:"user"`
+	Listings      []Services.Listing       `json:"listings"`
+	Images        []Services.Image         `json:"images"`
+	Transactions  []Services.Transaction   `json:"transactions"`
+	Notifications []Services.Notification  `json:"notifications"`
+	SavedSearches []Services.SavedSearch   `json:"saved_searches"`
+	Favourites    []Services.ShortlistItem `json:"favourites"`
+	Shortlists    []Services.Shortlist     `json:"shortlists"`
+	ServiceAreas  []Services.ServiceArea   `json:"service_areas"`
+}
+
+// ExportUser handles the request to download a zip of everything stored about a user:
+// data.json plus their image files under images/.
+func (app *application) ExportUser(w http.ResponseWriter, r *http.Request) {
+	tokenUserID, err := authUserID(r)
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	userID, err := intParam(r, "id")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	if tokenUserID != userID {
+		app.respondError(w, r, fmt.Errorf("cannot export another user: %w", Services.ErrForbidden))
+		return
+	}
+
+	export := accountExport{ExportedAt: time.Now().UTC().Format(time.RFC3339)}
+	if export.User, err = app.Service.Users.GetById(r.Context(), userID); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if export.Listings, err = app.Service.Listings.GetByUserID(r.Context(), userID, ""); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if export.Images, err = app.Service.Images.GetImagesByUserID(r.Context(), userID); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	// Both sides of every transaction the user took part in
+	offered, err := app.Service.Transactions.GetByOfferedUserAndStatus(r.Context(), userID, "")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	offering, err := app.Service.Transactions.GetByOfferingUserAndStatus(r.Context(), userID, "")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	export.Transactions = append(offered, offering...)
+
+	if export.Notifications, err = app.Service.Notifications.GetByUser(r.Context(), userID, false); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if export.SavedSearches, err = app.Service.SavedSearches.GetByUser(r.Context(), userID); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if export.Favourites, err = app.Service.Favourites.Items(r.Context(), userID, 0); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	if export.Shortlists, err = app.Service.Favourites.GetShortlists(r.Context(), userID); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	for i, shortlist := range export.Shortlists {
+		if export.Shortlists[i].Items, err = app.Service.Favourites.Items(r.Context(), userID, shortlist.ShortlistID); err != nil {
+			app.respondError(w, r, err)
+			return
+		}
 	}
+	if export.ServiceAreas, err = app.Service.ServiceAreas.GetByUser(r.Context(), userID); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	// Build the archive in memory so a failure can still be reported as a problem
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+
+	data, err := zipWriter.Create("data.json")
+	if err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+	encoder := json.NewEncoder(data)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	imagesDir := filepath.Join(Env.GetString("SRV_DIR", ""), "ServerImages")
+	for _, image := range export.Images {
+		content, err := os.ReadFile(filepath.Join(imagesDir, image.URL))
+		if os.IsNotExist(err) {
+			// The record outlived its file; data.json still lists it
+			continue
+		}
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+
+		file, err := zipWriter.Create("images/" + image.URL)
+		if err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+		if _, err := file.Write(content); err != nil {
+			app.respondError(w, r, err)
+			return
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		app.respondError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="minbya3mili-export-%d.zip"`, userID))
+	w.Write(archive.Bytes())
+}
+
+// credentials is the body of an authentication request
+type credentials struct {
+	PhoneNumber string `json:"phone_number" validate:"required"`
+	Password    string `json:"password" validate:"required"`
+}
+
+// authResponse is returned on a successful authentication
+type authResponse struct {
+	Token string        `json:"token"`
+	User  Services.User `json:"user"`
+}
+
+// authUser handles the request to authenticate a user.
+func (app *application) authUser(w http.ResponseWriter, r *http.Request) {
+	var authRequest credentials
 
 	// Decode the JSON request body
-	err := json.NewDecoder(r.Body).Decode(&authRequest)
+	err := decodeJSON(r, &authRequest)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		app.respondError(w, r, err)
 		return
 	}
 
 	// Call the Auth function from UserService to generate the token
 	token, user, err := app.Service.Users.Auth(r.Context(), authRequest.PhoneNumber, authRequest.Password)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		app.respondError(w, r, err)
 		return
 	}
 
@@ -293,16 +424,13 @@ func (app *application) authUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Create a response struct to hold the token and user data
-	response := struct {
-		Token string        `json:"token"`
-		User  Services.User `json:"user"`
-	}{
+	response := authResponse{
 		Token: token,
 		User:  user,
 	}
 
 	// Encode the response struct to JSON and write it to the response writer
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		app.respondError(w, r, err)
 	}
 }
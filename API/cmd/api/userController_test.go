@@ -0,0 +1,313 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/AdamElHassanLeb/279MidtermAdamElHassan/API/Internal/Services"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCreateAndAuthUser(t *testing.T) {
+	s := newTestServer(t)
+
+	user, token := s.createUser("Adam", "+96170000001")
+	if user.UserID == 0 || token == "" {
+		t.Fatalf("expected a stored user and token, got %+v %q", user, token)
+	}
+	if user.LocDetails.City != "Beirut" || user.Password != "" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/user/auth", map[string]string{
+		"phone_number": "+96170000001",
+		"password":     "wrong",
+	}, "")
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestCreateUserDuplicatePhone(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("Adam", "+96170000001")
+
+	rec := s.doJSON(http.MethodPost, "/api/v1/user/create", map[string]interface{}{
+		"first_name":   "Other",
+		"phone_number": "+96170000001",
+		"location":     []float64{35.5, 33.9},
+		"password":     "secret",
+	}, "")
+	if rec.Code == http.StatusCreated {
+		t.Fatal("expected duplicate phone number to be rejected")
+	}
+}
+
+func TestGetAllUsers(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("Adam", "+96170000001")
+	s.createUser("Rami", "+96170000002")
+
+	rec := s.do(http.MethodGet, "/api/v1/user/users", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var users []Services.User
+	decode(t, rec, &users)
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+}
+
+func TestGetUserById(t *testing.T) {
+	s := newTestServer(t)
+	user, _ := s.createUser("Adam", "+96170000001")
+
+	rec := s.do(http.MethodGet, "/api/v1/user/userId/"+strconv.Itoa(user.UserID), nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var got Services.User
+	decode(t, rec, &got)
+	if got.FirstName != "Adam" {
+		t.Fatalf("expected Adam, got %+v", got)
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/user/userId/999", nil, "", ""), http.StatusNotFound)
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/user/userId/abc", nil, "", ""), http.StatusBadRequest)
+}
+
+func TestGetUserByName(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("Adam", "+96170000001")
+	s.createUser("Rami", "+96170000002")
+
+	rec := s.do(http.MethodGet, "/api/v1/user/userName/ada", nil, "", "")
+	expectStatus(t, rec, http.StatusOK)
+
+	var users []Services.User
+	decode(t, rec, &users)
+	if len(users) != 1 || users[0].FirstName != "Adam" {
+		t.Fatalf("expected only Adam, got %+v", users)
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/user/userName/nobody", nil, "", ""), http.StatusNotFound)
+}
+
+func TestUpdateUser(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+	path := "/api/v1/user/update/" + strconv.Itoa(user.UserID)
+
+	payload := map[string]interface{}{
+		"first_name":    "Adam",
+		"last_name":     "Haddad",
+		"phone_number":  "+96170000001",
+		"date_of_birth": "1990-05-15",
+		"profession":    "Electrician",
+		"location":      []float64{35.5, 33.9},
+		"password":      "secret",
+		"image_id":      "0",
+	}
+
+	expectStatus(t, s.doJSON(http.MethodPut, path, payload, ""), http.StatusUnauthorized)
+	expectStatus(t, s.doJSON(http.MethodPut, path, payload, token), http.StatusOK)
+
+	updated, _ := s.app.Service.Users.GetById(context.Background(), user.UserID)
+	if updated.Profession != "Electrician" {
+		t.Fatalf("expected profession to be updated, got %+v", updated)
+	}
+
+	other, _ := s.createUser("Rami", "+96170000002")
+	expectStatus(t, s.doJSON(http.MethodPut, "/api/v1/user/update/"+strconv.Itoa(other.UserID), payload, token), http.StatusForbidden)
+}
+
+func TestDeleteUser(t *testing.T) {
+	s := newTestServer(t)
+	user, token := s.createUser("Adam", "+96170000001")
+	other, _ := s.createUser("Rami", "+96170000002")
+
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/user/delete/"+strconv.Itoa(other.UserID), nil, "", token), http.StatusForbidden)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/user/delete/"+strconv.Itoa(user.UserID), nil, "", token), http.StatusNoContent)
+	expectStatus(t, s.do(http.MethodDelete, "/api/v1/user/delete/"+strconv.Itoa(user.UserID), nil, "", token), http.StatusNotFound)
+}
+
+func TestCloseAccount(t *testing.T) {
+	f := seedTransaction(t)
+	expectStatus(t, f.s.upload("/api/v1/image/uploadForListing/"+strconv.Itoa(f.listing.ListingID), "tiles.png", f.tradesToken), http.StatusOK)
+	images, _ := f.s.app.Service.Images.GetImagesByUserID(context.Background(), f.tradesman.UserID)
+	if len(images) != 1 {
+		t.Fatalf("expected one image, got %+v", images)
+	}
+	imageFile := filepath.Join(os.Getenv("SRV_DIR"), "ServerImages", images[0].URL)
+
+	expectStatus(t, f.s.do(http.MethodDelete, "/api/v1/user/delete/"+strconv.Itoa(f.tradesman.UserID), nil, "", f.tradesToken), http.StatusNoContent)
+
+	// The profile becomes a tombstone and the account can no longer sign in
+	profile := getProfile(t, f.s, f.tradesman.UserID, f.clientToken)
+	if profile.DeletedAt == "" || profile.FirstName == f.tradesman.FirstName || profile.PhoneNumber != "" || profile.Location != nil {
+		t.Fatalf("expected an anonymised profile, got %+v", profile)
+	}
+	expectStatus(t, f.s.doJSON(http.MethodPost, "/api/v1/user/auth", map[string]string{
+		"phone_number": f.tradesman.PhoneNumber,
+		"password":     "secret",
+	}, ""), http.StatusUnauthorized)
+
+	// Listings are closed, images deleted with their files, transactions kept
+	listing, _ := f.s.app.Service.Listings.GetByID(context.Background(), f.listing.ListingID)
+	if listing.Active || listing.Status != Services.ListingClosed {
+		t.Fatalf("expected the listing to be closed, got %+v", listing)
+	}
+	if images, _ := f.s.app.Service.Images.GetImagesByUserID(context.Background(), f.tradesman.UserID); len(images) != 0 {
+		t.Fatalf("expected images to be deleted, got %+v", images)
+	}
+	if _, err := os.Stat(imageFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the image file to be removed, got %v", err)
+	}
+	expectStatus(t, f.s.do(http.MethodGet, "/api/v1/transaction/transactionId/"+strconv.Itoa(f.transaction.TransactionID), nil, "", f.clientToken), http.StatusOK)
+
+	// Closed accounts are not listed, and their phone number is free again
+	users, _ := f.s.app.Service.Users.GetAll(context.Background())
+	if len(users) != 1 || users[0].UserID != f.client.UserID {
+		t.Fatalf("expected only the client to be listed, got %+v", users)
+	}
+	f.s.createUser("Returning", f.tradesman.PhoneNumber)
+}
+
+func TestExportUser(t *testing.T) {
+	f := seedTransaction(t)
+	expectStatus(t, f.s.upload("/api/v1/image/uploadForListing/"+strconv.Itoa(f.listing.ListingID), "tiles.png", f.tradesToken), http.StatusOK)
+	path := "/api/v1/user/export/" + strconv.Itoa(f.tradesman.UserID)
+
+	expectStatus(t, f.s.do(http.MethodGet, path, nil, "", f.clientToken), http.StatusForbidden)
+
+	rec := f.s.do(http.MethodGet, path, nil, "", f.tradesToken)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export accountExport
+	files := map[string]bool{}
+	for _, file := range archive.File {
+		files[file.Name] = true
+		if file.Name != "data.json" {
+			continue
+		}
+		content, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewDecoder(content).Decode(&export); err != nil {
+			t.Fatal(err)
+		}
+		content.Close()
+	}
+
+	if export.User.PhoneNumber != f.tradesman.PhoneNumber || len(export.Listings) != 1 ||
+		len(export.Images) != 1 || len(export.Transactions) != 1 {
+		t.Fatalf("incomplete export %+v", export)
+	}
+	if !files["images/"+export.Images[0].URL] {
+		t.Fatalf("expected the image file in the archive, got %v", files)
+	}
+}
+
+// getProfile fetches a user's profile as the holder of token, anonymously when empty
+func getProfile(t *testing.T, s *testServer, userID int, token string) Services.Profile {
+	t.Helper()
+	rec := s.do(http.MethodGet, "/api/v1/user/userId/"+strconv.Itoa(userID), nil, "", token)
+	expectStatus(t, rec, http.StatusOK)
+
+	var profile Services.Profile
+	decode(t, rec, &profile)
+	return profile
+}
+
+func TestProfileVisibility(t *testing.T) {
+	f := seedTransaction(t)
+
+	// Strangers get the public view with a neighbourhood-level location
+	public := getProfile(t, f.s, f.tradesman.UserID, "")
+	if public.PhoneNumber != "" || public.DateOfBirth != "" || public.Privacy != nil || public.PreciseLocation {
+		t.Fatalf("public profile exposes private fields: %+v", public)
+	}
+	if public.Location == nil || public.Location.Equals(f.tradesman.Location) ||
+		public.Location.GeoDistanceFrom(f.tradesman.Location) > 1000 {
+		t.Fatalf("expected a location fuzzed within 1km, got %v for %v", public.Location, f.tradesman.Location)
+	}
+
+	// A pending offer does not make the client a counterparty yet
+	if pending := getProfile(t, f.s, f.tradesman.UserID, f.clientToken); pending.PhoneNumber != "" {
+		t.Fatalf("phone number shown before the transaction was accepted: %+v", pending)
+	}
+
+	accepted := f.transaction
+	accepted.Status = "Accepted"
+	path := "/api/v1/transaction/update/" + strconv.Itoa(f.transaction.TransactionID)
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, accepted, f.clientToken), http.StatusForbidden)
+	if pending := getProfile(t, f.s, f.tradesman.UserID, f.clientToken); pending.PhoneNumber != "" {
+		t.Fatalf("phone number shown on an offer the client accepted for the tradesman: %+v", pending)
+	}
+	expectStatus(t, f.s.doJSON(http.MethodPut, path, accepted, f.tradesToken), http.StatusNoContent)
+
+	counterparty := getProfile(t, f.s, f.tradesman.UserID, f.clientToken)
+	if counterparty.PhoneNumber != f.tradesman.PhoneNumber || !counterparty.PreciseLocation || counterparty.DateOfBirth != "" {
+		t.Fatalf("unexpected counterparty view %+v", counterparty)
+	}
+
+	self := getProfile(t, f.s, f.tradesman.UserID, f.tradesToken)
+	if self.DateOfBirth == "" || self.Privacy == nil || self.Privacy.DateOfBirth != Services.VisibilityPrivate {
+		t.Fatalf("unexpected own profile %+v", self)
+	}
+
+	// Users can withdraw their phone number from counterparties too
+	expectStatus(t, f.s.doJSON(http.MethodPut, "/api/v1/user/update/"+strconv.Itoa(f.tradesman.UserID), map[string]interface{}{
+		"first_name":    f.tradesman.FirstName,
+		"last_name":     f.tradesman.LastName,
+		"phone_number":  f.tradesman.PhoneNumber,
+		"date_of_birth": f.tradesman.DateOfBirth,
+		"location":      f.tradesman.Location,
+		"password":      "secret",
+		"image_id":      f.tradesman.ImageId,
+		"privacy":       map[string]string{"phone_number": "private", "date_of_birth": "public"},
+	}, f.tradesToken), http.StatusOK)
+
+	counterparty = getProfile(t, f.s, f.tradesman.UserID, f.clientToken)
+	if counterparty.PhoneNumber != "" || counterparty.DateOfBirth != f.tradesman.DateOfBirth || !counterparty.PreciseLocation {
+		t.Fatalf("privacy settings not applied: %+v", counterparty)
+	}
+
+	// Phone numbers can never be made public
+	rec := f.s.doJSON(http.MethodPut, "/api/v1/user/update/"+strconv.Itoa(f.tradesman.UserID), map[string]interface{}{
+		"privacy": map[string]string{"phone_number": "public"},
+	}, f.tradesToken)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestUserListsArePublicProfiles(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("Adam", "+96170000001")
+	_, token := s.createUser("Rami", "+96170000002")
+
+	for _, token := range []string{"", token} {
+		rec := s.do(http.MethodGet, "/api/v1/user/users", nil, "", token)
+		expectStatus(t, rec, http.StatusOK)
+
+		var profiles []Services.Profile
+		decode(t, rec, &profiles)
+		for _, profile := range profiles {
+			own := token != "" && profile.FirstName == "Rami"
+			if (profile.PhoneNumber != "") != own {
+				t.Fatalf("unexpected phone visibility in %+v", profile)
+			}
+		}
+	}
+
+	expectStatus(t, s.do(http.MethodGet, "/api/v1/user/users", nil, "", "not-a-token"), http.StatusUnauthorized)
+}